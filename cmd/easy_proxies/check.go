@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/redact"
+)
+
+// udpSchemes run over QUIC/UDP, so a TCP dial says nothing about them.
+var udpSchemes = []string{"hysteria://", "hysteria2://", "hy2://", "tuic://"}
+
+// checkReport is the result of "easy_proxies check", printed as text or JSON.
+type checkReport struct {
+	Config        string           `json:"config"`
+	Valid         bool             `json:"valid"`
+	Error         string           `json:"error,omitempty"`
+	Mode          string           `json:"mode,omitempty"`
+	Nodes         int              `json:"nodes"`
+	DisabledNodes int              `json:"disabled_nodes"`
+	Warnings      []config.Warning `json:"warnings"`
+	Dials         []dialResult     `json:"dials,omitempty"`
+	DialFailures  int              `json:"dial_failures"`
+}
+
+type dialResult struct {
+	Name      string `json:"name"`
+	Address   string `json:"address,omitempty"`
+	OK        bool   `json:"ok"`
+	Skipped   string `json:"skipped,omitempty"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runCheck implements "easy_proxies check": it loads and validates the
+// config without starting any listener and returns the process exit code,
+// 1 when the config is invalid or a test dial failed.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to config file")
+	dial := fs.Bool("dial", false, "open a TCP connection to every enabled node's server")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of each test dial")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	schema := fs.Bool("schema", false, "print the JSON Schema of config.yaml and exit")
+	showSecrets := fs.Bool("show-secrets", false, "print node URIs, passwords and tokens unmasked")
+	var overrides setFlags
+	fs.Var(&overrides, "set", "override a config value, e.g. -set listener.port=8080 (repeatable)")
+	fs.Parse(args)
+	redact.SetShowSecrets(*showSecrets)
+
+	if *schema {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(config.JSONSchema()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	// Load logs warnings as it goes; they are part of the report instead.
+	log.SetOutput(io.Discard)
+	report := checkReport{Config: *configPath, Warnings: []config.Warning{}}
+	cfg, err := loadChecked(*configPath, overrides)
+	if err != nil {
+		report.Error = redact.Text(err.Error())
+	} else {
+		report.Valid = true
+		report.Mode = cfg.Mode
+		report.Nodes = len(cfg.Nodes)
+		report.Warnings = cfg.Warnings()
+		for i := range report.Warnings {
+			report.Warnings[i].Message = redact.Text(report.Warnings[i].Message)
+		}
+		for _, node := range cfg.Nodes {
+			if node.Disabled {
+				report.DisabledNodes++
+			}
+		}
+		if *dial {
+			report.Dials = dialNodes(cfg, *timeout)
+			for _, d := range report.Dials {
+				if !d.OK && d.Skipped == "" {
+					report.DialFailures++
+				}
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		printCheckReport(os.Stdout, report)
+	}
+	if !report.Valid || report.DialFailures > 0 {
+		return 1
+	}
+	return 0
+}
+
+func loadChecked(path string, overrides []string) (*config.Config, error) {
+	if err := config.SetFlagOverrides(overrides); err != nil {
+		return nil, err
+	}
+	return config.Load(path)
+}
+
+// dialNodes test-dials the enabled nodes, probe_concurrency at a time.
+func dialNodes(cfg *config.Config, timeout time.Duration) []dialResult {
+	var nodes []config.NodeConfig
+	for _, node := range cfg.Nodes {
+		if !node.Disabled {
+			nodes = append(nodes, node)
+		}
+	}
+	results := make([]dialResult, len(nodes))
+	sem := make(chan struct{}, cfg.ProbeConcurrencyOrDefault())
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, node config.NodeConfig) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = dialNode(node, timeout)
+		}(i, node)
+	}
+	wg.Wait()
+	return results
+}
+
+func dialNode(node config.NodeConfig, timeout time.Duration) dialResult {
+	result := dialResult{Name: node.Name}
+	address, err := config.ServerAddress(node.URI)
+	if err != nil {
+		result.Error = redact.Text(err.Error())
+		return result
+	}
+	result.Address = address
+	for _, scheme := range udpSchemes {
+		if strings.HasPrefix(strings.ToLower(node.URI), scheme) {
+			result.Skipped = "udp protocol"
+			return result
+		}
+	}
+	if len(node.Via) > 0 {
+		result.Skipped = "reached via " + strings.Join(node.Via, " -> ")
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	_ = conn.Close()
+	result.OK = true
+	result.LatencyMS = time.Since(start).Milliseconds()
+	return result
+}
+
+func printCheckReport(w io.Writer, r checkReport) {
+	if !r.Valid {
+		fmt.Fprintf(w, "❌ %s: %s\n", r.Config, r.Error)
+		return
+	}
+	fmt.Fprintf(w, "✅ %s is valid (mode %s, %d nodes, %d disabled)\n", r.Config, r.Mode, r.Nodes, r.DisabledNodes)
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "⚠️  %s: %s\n", warning.Field, warning.Message)
+	}
+	if r.Dials == nil {
+		return
+	}
+	for _, d := range r.Dials {
+		switch {
+		case d.Skipped != "":
+			fmt.Fprintf(w, "   ⏭  %s (%s): skipped, %s\n", d.Name, d.Address, d.Skipped)
+		case d.OK:
+			fmt.Fprintf(w, "   ✓ %s (%s): %dms\n", d.Name, d.Address, d.LatencyMS)
+		default:
+			fmt.Fprintf(w, "   ✗ %s (%s): %s\n", d.Name, d.Address, d.Error)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d dials failed\n", r.DialFailures, len(r.Dials))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"easy_proxies/internal/config"
+)
+
+// runExport implements "easy_proxies export": it asks the running instance
+// for its healthy nodes through the management API and writes them as a
+// Clash proxy provider, sing-box outbounds or a URI list. It returns the
+// process exit code.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to config file, for the management address and password")
+	format := fs.String("format", "clash", "clash, sing-box or uri")
+	scheme := fs.String("scheme", "http", "proxy scheme of the entries: http, socks5 or all")
+	apiURL := fs.String("url", "", "management API base URL (default from management.listen)")
+	output := fs.String("o", "-", "output file, - for stdout")
+	insecure := fs.Bool("insecure", false, "skip certificate verification of an HTTPS management API")
+	fs.Parse(args)
+
+	// Load logs warnings as it goes; "check" is the place for them.
+	log.SetOutput(io.Discard)
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", *configPath, err)
+		return 1
+	}
+	base := *apiURL
+	if base == "" {
+		base = managementURL(cfg)
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure}},
+	}
+
+	token, err := managementToken(client, base, cfg.Management.Password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ sign in to %s: %v\n", base, err)
+		return 1
+	}
+	query := url.Values{"format": {*format}, "scheme": {*scheme}, "show_secrets": {"1"}}
+	req, err := http.NewRequest(http.MethodGet, base+"/api/export?"+query.Encode(), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "❌ export: %s %s\n", resp.Status, bytes.TrimSpace(body))
+		return 1
+	}
+
+	if *output == "-" {
+		_, _ = os.Stdout.Write(body)
+		return 0
+	}
+	if err := os.WriteFile(*output, body, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "✅ wrote %s\n", *output)
+	return 0
+}
+
+// managementURL derives the management API address of cfg as seen from
+// this host.
+func managementURL(cfg *config.Config) string {
+	scheme := "http"
+	if cfg.Management.TLS.Enabled() {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(cfg.Management.Listen)
+	if err != nil {
+		return scheme + "://" + cfg.Management.Listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// managementToken signs in with password and returns the session token,
+// or "" when the API has no password.
+func managementToken(client *http.Client, base, password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	body, _ := json.Marshal(map[string]string{"password": password})
+	resp, err := client.Post(base+"/api/auth", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Token string `json:"token"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", resp.Status, result.Error)
+	}
+	return result.Token, nil
+}
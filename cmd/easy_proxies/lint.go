@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/redact"
+)
+
+// lintReport is the result of "easy_proxies lint", printed as text or JSON.
+type lintReport struct {
+	Config   string           `json:"config"`
+	Error    string           `json:"error,omitempty"`
+	Findings []config.Finding `json:"findings"`
+	FailOn   string           `json:"fail_on"`
+	Failed   bool             `json:"failed"`
+}
+
+// runLint implements "easy_proxies lint": it loads the config and reports
+// risky settings. The exit code is 1 when the config does not load or a
+// finding is at least as serious as -fail-on, so CI can gate on it.
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to config file")
+	failOn := fs.String("fail-on", config.SeverityError, "exit with 1 on findings of this severity or worse: info, warn or error")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	var overrides setFlags
+	fs.Var(&overrides, "set", "override a config value, e.g. -set listener.port=8080 (repeatable)")
+	fs.Parse(args)
+
+	threshold, err := config.ParseSeverity(*failOn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-fail-on: %v\n", err)
+		return 2
+	}
+
+	log.SetOutput(io.Discard)
+	report := lintReport{Config: *configPath, Findings: []config.Finding{}, FailOn: threshold}
+	cfg, err := loadChecked(*configPath, overrides)
+	if err != nil {
+		report.Error = redact.Text(err.Error())
+		report.Failed = true
+	} else {
+		for _, finding := range cfg.Lint() {
+			finding.Message = redact.Text(finding.Message)
+			report.Findings = append(report.Findings, finding)
+			if config.AtLeast(finding.Severity, threshold) {
+				report.Failed = true
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		printLintReport(os.Stdout, report)
+	}
+	if report.Failed {
+		return 1
+	}
+	return 0
+}
+
+func printLintReport(w io.Writer, r lintReport) {
+	if r.Error != "" {
+		fmt.Fprintf(w, "❌ %s: %s\n", r.Config, r.Error)
+		return
+	}
+	if len(r.Findings) == 0 {
+		fmt.Fprintf(w, "✅ %s: no risky settings found\n", r.Config)
+		return
+	}
+	for _, f := range r.Findings {
+		fmt.Fprintf(w, "%s %-5s %s: %s\n", severityIcon(f.Severity), f.Severity, f.Field, f.Message)
+	}
+	fmt.Fprintf(w, "%d finding(s) in %s\n", len(r.Findings), r.Config)
+}
+
+// logLintFindings logs the warn and error findings at startup; info
+// findings are left to "easy_proxies lint".
+func logLintFindings(cfg *config.Config) {
+	for _, f := range cfg.Lint() {
+		if config.AtLeast(f.Severity, config.SeverityWarn) {
+			log.Printf("%s lint %s: %s (run \"easy_proxies lint\" for details)", severityIcon(f.Severity), f.Field, f.Message)
+		}
+	}
+}
+
+func severityIcon(severity string) string {
+	switch severity {
+	case config.SeverityError:
+		return "❌"
+	case config.SeverityWarn:
+		return "⚠️ "
+	}
+	return "ℹ️ "
+}
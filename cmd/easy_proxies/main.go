@@ -8,24 +8,88 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"strings"
 	"time"
 
 	"easy_proxies/internal/app"
+	"easy_proxies/internal/chaos"
 	"easy_proxies/internal/config"
 	"easy_proxies/internal/monitor"
+	"easy_proxies/internal/redact"
 
 	"gopkg.in/natefinch/lumberjack.v2")
 
 func main() {
+	// "check" validates the config and exits without starting anything.
+	// "lint" flags risky security settings in it.
+	// "simulate" replays a connection history against the pool settings.
+	// "export" fetches the healthy nodes of the running instance as a
+	// Clash or sing-box config.
+	// "sysproxy on" runs the proxy with the OS proxy settings pointed at it;
+	// "sysproxy off" just switches the OS proxy off.
+	// "upgrade" replaces this binary with the latest GitHub release, and
+	// "version" prints the release it was built from.
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "check" || args[0] == "validate") {
+		os.Exit(runCheck(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "lint" {
+		os.Exit(runLint(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "simulate" {
+		os.Exit(runSimulate(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "export" {
+		os.Exit(runExport(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "upgrade" {
+		os.Exit(runUpgrade(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "version" {
+		fmt.Println(version)
+		return
+	}
+	var sysproxyMode string
+	if len(args) > 0 && args[0] == "sysproxy" {
+		if len(args) < 2 || (args[1] != "on" && args[1] != "off") {
+			fmt.Fprintln(os.Stderr, "usage: easy_proxies sysproxy on|off [-config config.yaml]")
+			os.Exit(2)
+		}
+		sysproxyMode, args = args[1], args[2:]
+	}
+
 	var configPath string
+	var showSecrets bool
+	var chaosMode bool
+	var overrides setFlags
 	flag.StringVar(&configPath, "config", "config.yaml", "path to config file")
-	flag.Parse()
+	flag.BoolVar(&showSecrets, "show-secrets", false, "print node URIs, passwords and tokens unmasked in logs, status and exports")
+	flag.BoolVar(&chaosMode, "chaos", false, "enable the /api/chaos fault injection API, for testing failover only")
+	flag.Var(&overrides, "set", "override a config value, e.g. -set listener.port=8080 (repeatable, applied after EP_* environment variables)")
+	flag.CommandLine.Parse(args)
+	redact.SetShowSecrets(showSecrets)
+	log.SetOutput(redact.Writer(os.Stderr))
+	if err := config.SetFlagOverrides(overrides); err != nil {
+		log.Fatalf("-set: %v", err)
+	}
+	if chaosMode {
+		chaos.Enable()
+		log.Printf("⚠️  Chaos mode: faults can be injected into nodes through /api/chaos; do not run this in production")
+	}
+
+	if sysproxyMode == "off" {
+		if err := disableSystemProxy(); err != nil {
+			log.Fatalf("sysproxy: %v", err)
+		}
+		return
+	}
 
 	var cfg *config.Config
 	for attempt := 1; attempt <= 3; attempt++ {
 		var err error
-		cfg, err = config.Load(configPath)
+		cfg, err = config.Load(configPath, config.WithNodeSnapshot())
 		if err == nil {
 			break
 		}
@@ -38,15 +102,70 @@ func main() {
 	}
 
 	// Setup logging based on config
+	applyTimezone(cfg)
 	setupLogging(cfg)
+	applyResourceLimits(cfg)
+	logLintFindings(cfg)
+
+	os.Exit(serve(cfg, sysproxyMode == "on"))
+}
+
+// serve runs the proxy pool until shutdown and returns the exit code. With
+// sysproxy the system proxy points at the pool entry meanwhile; every way
+// out of serve, a panic included, restores it, since os.Exit and
+// log.Fatal skip deferred calls and would leave it pointing at a dead port.
+func serve(cfg *config.Config, sysproxy bool) int {
+	if sysproxy {
+		restore, err := enableSystemProxy(cfg)
+		if err != nil {
+			log.Printf("sysproxy: %v", err)
+			return 1
+		}
+		defer restore()
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	if err := app.Run(ctx, cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "proxy pool exited with error: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// setFlags collects the values of a repeatable string flag.
+type setFlags []string
+
+func (s *setFlags) String() string { return strings.Join(*s, ", ") }
+
+func (s *setFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// applyTimezone makes the configured timezone the process's local time, so
+// logs, API timestamps and stats buckets follow it rather than the host's.
+// It runs once at start; a changed timezone needs a restart.
+func applyTimezone(cfg *config.Config) {
+	if cfg.Timezone == "" {
+		return
+	}
+	time.Local = cfg.Location()
+	log.Printf("🕐 Timezone: %s", cfg.Timezone)
+}
+
+// applyResourceLimits applies the process-wide knobs of resource_profile.
+func applyResourceLimits(cfg *config.Config) {
+	limits := cfg.Resources()
+	if limits.GOMAXPROCS > 0 {
+		runtime.GOMAXPROCS(limits.GOMAXPROCS)
+	}
+	if limits.GCPercent > 0 {
+		debug.SetGCPercent(limits.GCPercent)
 	}
+	log.Printf("⚙️  Resource profile: %s (GOMAXPROCS=%d, probe concurrency=%d)",
+		cfg.ResourceProfile, runtime.GOMAXPROCS(0), cfg.ProbeConcurrencyOrDefault())
 }
 
 func setupLogging(cfg *config.Config) {
@@ -74,5 +193,6 @@ func setupLogging(cfg *config.Config) {
 		}
 	}
 
-	log.SetOutput(io.MultiWriter(writers...))
+	// Mask credentials once, in front of every sink.
+	log.SetOutput(redact.Writer(io.MultiWriter(writers...)))
 }
@@ -0,0 +1,7 @@
+package main
+
+// Go protocol plugins are linked in with a blank import in this file. The
+// plugin's init function registers the URI scheme it handles with
+// easy_proxies/internal/plugin, e.g.
+//
+//	import _ "example.com/easy_proxies-wireguard"
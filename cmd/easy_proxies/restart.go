@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"easy_proxies/internal/handoff"
+)
+
+// signalRestart asks the running instance of exe (or process pid, when
+// set) to hand its listeners over to a new process of exe.
+func signalRestart(exe string, pid int) (int, error) {
+	if handoff.Signal == nil {
+		return 0, errors.New("listener handoff is not supported on this platform")
+	}
+	if pid == 0 {
+		pids, err := findInstances(exe)
+		if err != nil {
+			return 0, fmt.Errorf("find the running instance: %w; pass -pid", err)
+		}
+		switch len(pids) {
+		case 0:
+			return 0, fmt.Errorf("no running instance of %s found; pass -pid", exe)
+		case 1:
+			pid = pids[0]
+		default:
+			return 0, fmt.Errorf("%d instances of %s are running (PIDs %v); pass -pid", len(pids), exe, pids)
+		}
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	return pid, process.Signal(handoff.Signal)
+}
+
+// findInstances lists the processes running exe, or the binary "upgrade"
+// moved aside to exe+".old", through /proc. A process that has handed
+// over waits for its successor and passes signals on, so of such a chain
+// only the first process is returned.
+func findInstances(exe string) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[int]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join("/proc", entry.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		target = strings.TrimSuffix(target, " (deleted)")
+		if target != exe && target != exe+".old" {
+			continue
+		}
+		parents[pid] = parentPID(pid)
+	}
+	var pids []int
+	for pid, parent := range parents {
+		if _, chained := parents[parent]; !chained {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// parentPID reads the parent of pid from /proc/<pid>/stat, or returns 0.
+func parentPID(pid int) int {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0
+	}
+	// The command name in parentheses may contain spaces; the state and
+	// the parent PID follow the last ')'.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) < 2 {
+		return 0
+	}
+	parent, _ := strconv.Atoi(fields[1])
+	return parent
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/simulate"
+)
+
+// runSimulate implements "easy_proxies simulate": it replays a recorded
+// connection history under the pool settings of the config and under the
+// same config with the -set overrides applied, and prints how selection and
+// blacklisting differ. It returns the process exit code.
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to config file")
+	historyPath := fs.String("history", "", "connection history as JSON Lines (from GET /api/connections/export or the JSON access log), - for stdin")
+	window := fs.Duration("window", 5*time.Minute, "how far a node's record may be from a request to stand for its outcome")
+	seed := fs.Int64("seed", 0, "seed of random mode (default pool.seed, or 1)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	var overrides setFlags
+	fs.Var(&overrides, "set", "candidate change, e.g. -set pool.failure_threshold=5 (repeatable)")
+	fs.Parse(args)
+	if *historyPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: easy_proxies simulate -history connections.jsonl [-config config.yaml] [-set path=value ...]")
+		return 2
+	}
+
+	// Load logs warnings as it goes; "check" is the place for them.
+	log.SetOutput(io.Discard)
+	current, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", *configPath, err)
+		return 1
+	}
+	candidate, err := loadChecked(*configPath, overrides)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ candidate: %v\n", err)
+		return 1
+	}
+
+	in := os.Stdin
+	if *historyPath != "-" {
+		f, err := os.Open(*historyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	records, err := simulate.ReadJSONL(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", *historyPath, err)
+		return 1
+	}
+
+	if *seed == 0 {
+		*seed = current.Pool.Seed
+	}
+	if *seed == 0 {
+		*seed = 1
+	}
+	report := simulate.Run(records, simulate.PolicyOf(current), simulate.PolicyOf(candidate), simulate.Options{Window: *window, Seed: *seed})
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		printSimulateReport(os.Stdout, report)
+	}
+	return 0
+}
+
+func printSimulateReport(w io.Writer, r simulate.Report) {
+	if r.Records == 0 {
+		fmt.Fprintln(w, "⚠️  the history is empty")
+		return
+	}
+	fmt.Fprintf(w, "🔧 replayed %d connections from %s to %s\n", r.Records, r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	fmt.Fprintf(w, "%-22s %12s %12s %12s\n", "", "recorded", "current", "candidate")
+	rows := []struct {
+		label    string
+		recorded bool // whether the row means anything for the recorded run
+		value    func(simulate.Result) string
+	}{
+		{"mode", false, func(res simulate.Result) string { return res.Policy.Mode }},
+		{"failed requests", true, func(res simulate.Result) string { return fmt.Sprint(res.Failures) }},
+		{"attempts", true, func(res simulate.Result) string { return fmt.Sprint(res.Attempts) }},
+		{"unknown outcomes", false, func(res simulate.Result) string { return fmt.Sprint(res.Unknown) }},
+		{"blacklistings", false, func(res simulate.Result) string { return fmt.Sprint(res.Blacklistings) }},
+		{"blacklisted time", false, func(res simulate.Result) string { return res.BlacklistedTime.Round(time.Second).String() }},
+	}
+	for _, row := range rows {
+		recorded := "-"
+		if row.recorded {
+			recorded = row.value(r.Recorded)
+		}
+		fmt.Fprintf(w, "%-22s %12s %12s %12s\n", row.label, recorded, row.value(r.Current), row.value(r.Candidate))
+	}
+	fmt.Fprintf(w, "%d of %d requests would go to a different first node\n", r.Changed, r.Records)
+
+	nodes := make(map[string]bool)
+	for _, res := range []simulate.Result{r.Recorded, r.Current, r.Candidate} {
+		for node := range res.Picks {
+			nodes[node] = true
+		}
+	}
+	order := make([]string, 0, len(nodes))
+	for node := range nodes {
+		order = append(order, node)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := r.Candidate.Picks[order[i]], r.Candidate.Picks[order[j]]
+		if a != b {
+			return a > b
+		}
+		return order[i] < order[j]
+	})
+	fmt.Fprintf(w, "%-22s %12s %12s %12s\n", "requests per node", "recorded", "current", "candidate")
+	for _, node := range order {
+		fmt.Fprintf(w, "  %-20s %12d %12d %12d\n", node, r.Recorded.Picks[node], r.Current.Picks[node], r.Candidate.Picks[node])
+	}
+	if r.Current.Unknown+r.Candidate.Unknown > 0 {
+		fmt.Fprintln(w, "ℹ️  unknown outcomes had no record of that node within -window and were counted as successes")
+	}
+}
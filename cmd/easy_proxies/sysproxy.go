@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/sysproxy"
+)
+
+// enableSystemProxy points the OS proxy settings at the pool entry and
+// returns a func that restores the previous settings.
+func enableSystemProxy(cfg *config.Config) (func(), error) {
+	if cfg.Mode != "pool" && cfg.Mode != "hybrid" {
+		return nil, fmt.Errorf("sysproxy needs the pool entry (mode pool or hybrid), current mode is %q", cfg.Mode)
+	}
+	host := cfg.Listener.Address
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	restore, err := sysproxy.Enable(host, cfg.Listener.Port)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✅ System proxy set to %s:%d (restored on exit)", host, cfg.Listener.Port)
+	if len(cfg.ListenerUsers()) > 0 {
+		log.Printf("⚠️  listener authentication is enabled; applications will prompt for the proxy credentials")
+	}
+	return func() {
+		if err := restore(); err != nil {
+			log.Printf("⚠️  Failed to restore system proxy settings: %v", err)
+			return
+		}
+		log.Printf("✅ System proxy settings restored")
+	}, nil
+}
+
+func disableSystemProxy() error {
+	if err := sysproxy.Disable(); err != nil {
+		if errors.Is(err, sysproxy.ErrUnsupported) {
+			return err
+		}
+		return fmt.Errorf("disable system proxy: %w", err)
+	}
+	log.Printf("✅ System proxy disabled")
+	return nil
+}
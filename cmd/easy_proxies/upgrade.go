@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"easy_proxies/internal/selfupdate"
+)
+
+// version is the release this binary was built from, set with
+// -ldflags "-X main.version=v1.2.3". Development builds say "dev".
+var version = "dev"
+
+// upgradePublicKey is the base64 ed25519 key release checksums are signed
+// with, set with -ldflags "-X main.upgradePublicKey=...". When empty,
+// "upgrade" checks checksums only unless -pubkey is given.
+var upgradePublicKey = ""
+
+// runUpgrade implements "easy_proxies upgrade": it looks up the latest (or
+// the given) GitHub release, verifies the binary for this platform and
+// swaps it in for the running executable. It returns the process exit code.
+//
+// With -restart the running instance is then signalled to hand its
+// listeners over to a process of the new binary (see package handoff), so
+// no connection is refused while the old process drains. Without it the
+// old binary keeps running until the instance is restarted.
+func runUpgrade(args []string) int {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	tag := fs.String("tag", "", "install this release tag instead of the latest, e.g. to roll back")
+	force := fs.Bool("force", false, "install even when not newer, or when running in a container")
+	repo := fs.String("repo", selfupdate.DefaultRepo, "GitHub repository to fetch releases from")
+	pubkey := fs.String("pubkey", upgradePublicKey, "base64 ed25519 public key the release checksums must be signed with")
+	timeout := fs.Duration("timeout", 5*time.Minute, "timeout of the whole download")
+	restart := fs.Bool("restart", false, "hand the running instance over to the new binary without refusing connections")
+	pid := fs.Int("pid", 0, "PID of the instance to restart with -restart, when it cannot be found by its executable")
+	fs.Parse(args)
+
+	updater := &selfupdate.Updater{
+		Client: &http.Client{Timeout: *timeout},
+		Repo:   *repo,
+	}
+	if *pubkey != "" {
+		key, err := base64.StdEncoding.DecodeString(*pubkey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			fmt.Fprintln(os.Stderr, "❌ -pubkey is not a base64 ed25519 public key")
+			return 2
+		}
+		updater.PublicKey = key
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	rel, err := updater.Release(ctx, *tag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ look up release: %v\n", err)
+		return 1
+	}
+	newer := selfupdate.Newer(version, rel.Tag)
+	if *check {
+		if newer {
+			fmt.Printf("⬆️  %s is available (running %s)\n", rel.Tag, version)
+		} else {
+			fmt.Printf("✅ %s is up to date\n", version)
+		}
+		return 0
+	}
+	if !newer && *tag == "" && !*force {
+		fmt.Printf("✅ %s is up to date\n", version)
+		return 0
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil && !*force {
+		fmt.Fprintln(os.Stderr, "❌ running in a container; pull the new image instead (or use -force)")
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ locate executable: %v\n", err)
+		return 1
+	}
+	if updater.PublicKey == nil {
+		fmt.Fprintln(os.Stderr, "⚠️  no signing key configured, verifying the checksum only")
+	}
+	fmt.Printf("⬇️  Downloading %s for %s/%s...\n", rel.Tag, runtime.GOOS, runtime.GOARCH)
+	binary, err := updater.Download(ctx, rel, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if err := selfupdate.Replace(exe, binary); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ replace %s: %v\n", exe, err)
+		return 1
+	}
+	fmt.Printf("✅ %s upgraded from %s to %s (previous binary kept as %s.old)\n", exe, version, rel.Tag, exe)
+	if !*restart {
+		fmt.Println("   The running instance still runs the old binary; run upgrade with -restart to hand it over,")
+		fmt.Println("   or restart it through the service manager (new connections are refused until it is back up).")
+		return 0
+	}
+	target, err := signalRestart(exe, *pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ restart: %v\n", err)
+		return 1
+	}
+	fmt.Printf("🔄 Asked process %d to hand over to %s; it drains open connections for up to shutdown_timeout.\n", target, rel.Tag)
+	fmt.Println("   Check its log: if the new process fails to start, the old one keeps serving.")
+	return 0
+}
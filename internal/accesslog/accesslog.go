@@ -0,0 +1,247 @@
+// Package accesslog writes one line per proxied connection for auditing.
+// Lines are JSON objects by default, or logfmt-style text.
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Output formats (access_log.log_format).
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Results recorded for an entry.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Config selects where and how entries are written.
+type Config struct {
+	// File is the log path, or "stdout".
+	File   string
+	Format string
+	// MaxSize (MB) rotates the file when it grows past it.
+	MaxSize int
+	// RotateInterval additionally rotates the file when it is older than
+	// this; 0 rotates by size only.
+	RotateInterval time.Duration
+	MaxBackups     int
+	MaxAge         int // days old files are kept
+	Compress       bool
+	// History keeps the last History entries in memory for Recent, with or
+	// without a File; 0 keeps none.
+	History int
+	// Tags keeps totals per connection tag for at most Tags distinct tags,
+	// with or without a File; 0 keeps none.
+	Tags int
+}
+
+// Entry is one proxied connection.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Tag      string    `json:"tag,omitempty"` // chosen by the client, e.g. a job ID
+	Inbound  string    `json:"inbound,omitempty"`
+	Network  string    `json:"network"`
+	Target   string    `json:"target"`
+	Node     string    `json:"node,omitempty"`
+	NodeName string    `json:"node_name,omitempty"`
+	Upload   int64     `json:"bytes_up"`
+	Download int64     `json:"bytes_down"`
+	// CostPerGB is the node's traffic price; Cost is filled in from it and
+	// the byte counts when the connection is logged.
+	CostPerGB float64       `json:"-"`
+	Cost      float64       `json:"cost,omitempty"`
+	Duration  time.Duration `json:"-"`
+	Result    string        `json:"result"`
+	Error     string        `json:"error,omitempty"`
+	// ErrorClass and NodesTried describe a failed connection: a stable
+	// class such as "timeout" or "no_node" and the nodes dialed in order.
+	ErrorClass string   `json:"error_class,omitempty"`
+	NodesTried []string `json:"nodes_tried,omitempty"`
+}
+
+// MarshalJSON adds the duration in milliseconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type plain Entry
+	return json.Marshal(struct {
+		plain
+		DurationMS int64 `json:"duration_ms"`
+	}{plain(e), e.Duration.Milliseconds()})
+}
+
+// text formats e as space-separated key=value pairs.
+func (e Entry) text() string {
+	var b strings.Builder
+	b.WriteString(e.Time.Format(time.RFC3339Nano))
+	field := func(key, value string) {
+		if value == "" {
+			return
+		}
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	field("client", e.Client)
+	field("user", e.User)
+	field("tag", e.Tag)
+	field("inbound", e.Inbound)
+	field("network", e.Network)
+	field("target", e.Target)
+	field("node", e.Node)
+	field("node_name", e.NodeName)
+	field("bytes_up", strconv.FormatInt(e.Upload, 10))
+	field("bytes_down", strconv.FormatInt(e.Download, 10))
+	if e.Cost > 0 {
+		field("cost", strconv.FormatFloat(e.Cost, 'f', -1, 64))
+	}
+	field("duration_ms", strconv.FormatInt(e.Duration.Milliseconds(), 10))
+	field("result", e.Result)
+	field("error", e.Error)
+	field("error_class", e.ErrorClass)
+	field("nodes_tried", strings.Join(e.NodesTried, ","))
+	return b.String()
+}
+
+type logger struct {
+	mu        sync.Mutex
+	out       io.Writer
+	file      *lumberjack.Logger // nil when writing to stdout
+	format    string
+	interval  time.Duration
+	rotatedAt time.Time
+}
+
+var (
+	mu     sync.RWMutex
+	active *logger
+	recent *ring
+	tags   *tagTable
+)
+
+// Configure replaces the active access log. A zero Config disables it.
+// Entries already in the history and tag totals are kept when they stay
+// enabled.
+func Configure(cfg Config) error {
+	var next *logger
+	if cfg.File != "" {
+		format := strings.ToLower(cfg.Format)
+		switch format {
+		case "":
+			format = FormatJSON
+		case FormatJSON, FormatText:
+		default:
+			return fmt.Errorf("unknown access log format %q", cfg.Format)
+		}
+		next = &logger{format: format, interval: cfg.RotateInterval, rotatedAt: time.Now()}
+		if cfg.File == "stdout" {
+			next.out = os.Stdout
+		} else {
+			if err := os.MkdirAll(filepath.Dir(cfg.File), 0o755); err != nil {
+				return fmt.Errorf("create access log dir: %w", err)
+			}
+			next.file = &lumberjack.Logger{
+				Filename:   cfg.File,
+				MaxSize:    cfg.MaxSize,
+				MaxBackups: cfg.MaxBackups,
+				MaxAge:     cfg.MaxAge,
+				Compress:   cfg.Compress,
+			}
+			next.out = next.file
+		}
+	}
+
+	mu.Lock()
+	prev := active
+	active = next
+	recent = recent.resize(cfg.History)
+	tags = tags.resize(cfg.Tags)
+	mu.Unlock()
+	if prev != nil && prev.file != nil {
+		prev.mu.Lock()
+		_ = prev.file.Close()
+		prev.mu.Unlock()
+	}
+	return nil
+}
+
+// Close flushes and disables the access log.
+func Close() {
+	_ = Configure(Config{})
+}
+
+// Enabled reports whether entries are written, so callers can skip
+// collecting them.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return active != nil || recent != nil || tags != nil
+}
+
+// Log writes e.
+func Log(e Entry) {
+	mu.RLock()
+	l := active
+	r := recent
+	t := tags
+	mu.RUnlock()
+	r.push(e)
+	t.add(e)
+	if l == nil {
+		return
+	}
+	var line []byte
+	if l.format == FormatText {
+		line = []byte(e.text())
+	} else {
+		var err error
+		if line, err = json.Marshal(e); err != nil {
+			return
+		}
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil && l.interval > 0 && time.Since(l.rotatedAt) >= l.interval {
+		_ = l.file.Rotate()
+		l.rotatedAt = time.Now()
+	}
+	_, _ = l.out.Write(line)
+}
+
+type clientKey struct{}
+
+// WithClient tags ctx with the client address for listeners that dial the
+// pool directly instead of going through a sing-box inbound.
+func WithClient(ctx context.Context, addr string) context.Context {
+	if addr == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientKey{}, addr)
+}
+
+// ClientFromContext returns the address set by WithClient, or "".
+func ClientFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(clientKey{}).(string)
+	return addr
+}
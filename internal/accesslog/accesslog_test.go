@@ -0,0 +1,91 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapConnLogsJSONLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := Configure(Config{File: path, Format: FormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 5)
+		_, _ = server.Read(buf)
+		_, _ = server.Write([]byte("pong!!!"))
+	}()
+	conn := WrapConn(client, Entry{
+		Time:    time.Now(),
+		Client:  "10.0.0.2:51234",
+		User:    "alice",
+		Network: "tcp",
+		Target:  "example.com:443",
+		Node:    "node-a",
+		// 12 bytes at 100M per GB
+		CostPerGB: 1e8,
+	})
+	_, _ = conn.Write([]byte("ping!"))
+	_, _ = conn.Read(make([]byte, 7))
+	_ = conn.Close()
+	_ = conn.Close() // logged once
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("want 1 line, got %d: %q", len(lines), data)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["user"] != "alice" || got["target"] != "example.com:443" || got["node"] != "node-a" || got["result"] != ResultOK {
+		t.Fatalf("unexpected entry: %v", got)
+	}
+	if got["bytes_up"] != float64(5) || got["bytes_down"] != float64(7) {
+		t.Fatalf("byte counts = %v/%v, want 5/7", got["bytes_up"], got["bytes_down"])
+	}
+	if _, ok := got["duration_ms"]; !ok {
+		t.Fatal("duration_ms missing")
+	}
+	if cost, _ := got["cost"].(float64); cost < 1.19 || cost > 1.21 {
+		t.Fatalf("cost = %v, want 1.2", got["cost"])
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	e := Entry{
+		Time:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Network:    "tcp",
+		Target:     "example.com:80",
+		Result:     ResultError,
+		Error:      "no healthy proxy available",
+		ErrorClass: "no_node",
+		NodesTried: []string{"a", "b"},
+	}
+	want := `2026-01-02T03:04:05Z network=tcp target=example.com:80 bytes_up=0 bytes_down=0 duration_ms=0 result=error error="no healthy proxy available" error_class=no_node nodes_tried=a,b`
+	if got := e.text(); got != want {
+		t.Fatalf("text() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfigureRejectsUnknownFormat(t *testing.T) {
+	if err := Configure(Config{File: "stdout", Format: "xml"}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+	if Enabled() {
+		t.Fatal("a rejected config must not enable the log")
+	}
+}
@@ -0,0 +1,87 @@
+package accesslog
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WrapConn counts the traffic of c and logs entry, completed with the byte
+// counts and duration, when c is closed. entry.Time marks the start.
+func WrapConn(c net.Conn, entry Entry) net.Conn {
+	return &conn{Conn: c, counter: counter{entry: entry}}
+}
+
+// WrapPacketConn is WrapConn for packet connections.
+func WrapPacketConn(c net.PacketConn, entry Entry) net.PacketConn {
+	return &packetConn{PacketConn: c, counter: counter{entry: entry}}
+}
+
+type counter struct {
+	entry    Entry
+	upload   atomic.Int64
+	download atomic.Int64
+	once     sync.Once
+}
+
+func (c *counter) finish() {
+	c.once.Do(func() {
+		e := c.entry
+		e.Upload, e.Download = c.upload.Load(), c.download.Load()
+		if e.CostPerGB > 0 {
+			e.Cost = float64(e.Upload+e.Download) / 1e9 * e.CostPerGB
+		}
+		e.Duration = time.Since(e.Time)
+		if e.Result == "" {
+			e.Result = ResultOK
+		}
+		Log(e)
+	})
+}
+
+type conn struct {
+	net.Conn
+	counter
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.download.Add(int64(n))
+	return n, err
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.upload.Add(int64(n))
+	return n, err
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.finish()
+	return err
+}
+
+type packetConn struct {
+	net.PacketConn
+	counter
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	c.download.Add(int64(n))
+	return n, addr, err
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.upload.Add(int64(n))
+	return n, err
+}
+
+func (c *packetConn) Close() error {
+	err := c.PacketConn.Close()
+	c.finish()
+	return err
+}
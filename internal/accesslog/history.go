@@ -0,0 +1,80 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// ring is a fixed-size buffer of the most recent entries.
+type ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// resize returns a ring holding size entries that keeps the newest entries
+// of r, or nil when size is 0.
+func (r *ring) resize(size int) *ring {
+	if size <= 0 {
+		return nil
+	}
+	if r != nil && len(r.entries) == size {
+		return r
+	}
+	next := &ring{entries: make([]Entry, size)}
+	for _, e := range r.snapshot() {
+		next.push(e)
+	}
+	return next
+}
+
+func (r *ring) push(e Entry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// snapshot returns the buffered entries, oldest first.
+func (r *ring) snapshot() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Entry(nil), r.entries[:r.next]...)
+	}
+	list := make([]Entry, 0, len(r.entries))
+	list = append(list, r.entries[r.next:]...)
+	return append(list, r.entries[:r.next]...)
+}
+
+// Recent returns the entries kept by Config.History, oldest first.
+func Recent() []Entry {
+	mu.RLock()
+	r := recent
+	mu.RUnlock()
+	return r.snapshot()
+}
+
+// WriteJSONL writes entries as JSON Lines, one entry per line in the same
+// format as the JSON access log.
+func WriteJSONL(w io.Writer, entries []Entry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
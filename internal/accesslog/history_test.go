@@ -0,0 +1,72 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecentKeepsNewestEntries(t *testing.T) {
+	if err := Configure(Config{History: 3}); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if !Enabled() {
+		t.Fatal("history alone should enable collection")
+	}
+	for _, target := range []string{"a:1", "b:2", "c:3", "d:4"} {
+		Log(Entry{Time: time.Now(), Network: "tcp", Target: target, Result: ResultOK})
+	}
+	got := targets(Recent())
+	if got != "b:2,c:3,d:4" {
+		t.Fatalf("got %s, want the newest three oldest first", got)
+	}
+
+	// Growing the buffer keeps what is there.
+	if err := Configure(Config{History: 5}); err != nil {
+		t.Fatal(err)
+	}
+	Log(Entry{Network: "tcp", Target: "e:5"})
+	if got := targets(Recent()); got != "b:2,c:3,d:4,e:5" {
+		t.Fatalf("after resize got %s", got)
+	}
+
+	if err := Configure(Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() || Recent() != nil {
+		t.Fatal("zero config should drop the history")
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []Entry{
+		{Network: "tcp", Target: "a:1", Duration: 1500 * time.Millisecond, Result: ResultOK},
+		{Network: "udp", Target: "b:2", Result: ResultError, Error: "refused"},
+	}
+	if err := WriteJSONL(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got %q", buf.String())
+	}
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["target"] != "a:1" || first["duration_ms"] != float64(1500) {
+		t.Fatalf("unexpected line %v", first)
+	}
+}
+
+func targets(entries []Entry) string {
+	list := make([]string, len(entries))
+	for i, e := range entries {
+		list[i] = e.Target
+	}
+	return strings.Join(list, ",")
+}
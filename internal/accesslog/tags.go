@@ -0,0 +1,144 @@
+package accesslog
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OtherTag collects the connections of tags seen after the tracked limit
+// was reached. It cannot clash with a client tag, which has no parentheses.
+const OtherTag = "(other)"
+
+// TagStats totals the connections of one connection tag.
+type TagStats struct {
+	Tag         string    `json:"tag"`
+	Connections int64     `json:"connections"`
+	Failures    int64     `json:"failures"`
+	Upload      int64     `json:"bytes_up"`
+	Download    int64     `json:"bytes_down"`
+	LastSeen    time.Time `json:"last_seen"`
+	// FailureClasses counts the failures by error class.
+	FailureClasses map[string]int64 `json:"failure_classes,omitempty"`
+}
+
+// tagTable keeps TagStats for at most limit tags, so clients choosing tags
+// freely cannot grow it without bound.
+type tagTable struct {
+	mu    sync.Mutex
+	limit int
+	stats map[string]*TagStats
+}
+
+// resize returns a table tracking limit tags that keeps the totals of t,
+// or nil when limit is 0.
+func (t *tagTable) resize(limit int) *tagTable {
+	if limit <= 0 {
+		return nil
+	}
+	if t != nil {
+		t.mu.Lock()
+		t.limit = limit
+		t.mu.Unlock()
+		return t
+	}
+	return &tagTable{limit: limit, stats: make(map[string]*TagStats)}
+}
+
+func (t *tagTable) add(e Entry) {
+	if t == nil || e.Tag == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[e.Tag]
+	if !ok {
+		tag := e.Tag
+		if len(t.stats) >= t.limit {
+			tag = OtherTag
+		}
+		if s, ok = t.stats[tag]; !ok {
+			s = &TagStats{Tag: tag}
+			t.stats[tag] = s
+		}
+	}
+	s.Connections++
+	if e.Result == ResultError {
+		s.Failures++
+		if e.ErrorClass != "" {
+			if s.FailureClasses == nil {
+				s.FailureClasses = make(map[string]int64)
+			}
+			s.FailureClasses[e.ErrorClass]++
+		}
+	}
+	s.Upload += e.Upload
+	s.Download += e.Download
+	s.LastSeen = e.Time
+}
+
+func (t *tagTable) snapshot() []TagStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	list := make([]TagStats, 0, len(t.stats))
+	for _, s := range t.stats {
+		stats := *s
+		stats.FailureClasses = maps.Clone(s.FailureClasses)
+		list = append(list, stats)
+	}
+	t.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Connections != list[j].Connections {
+			return list[i].Connections > list[j].Connections
+		}
+		return list[i].Tag < list[j].Tag
+	})
+	return list
+}
+
+func (t *tagTable) reset() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.stats = make(map[string]*TagStats)
+	t.mu.Unlock()
+}
+
+// Tags returns the totals per connection tag, busiest first. It is empty
+// while Config.Tags is 0.
+func Tags() []TagStats {
+	mu.RLock()
+	t := tags
+	mu.RUnlock()
+	return t.snapshot()
+}
+
+// ResetTags clears the totals per connection tag.
+func ResetTags() {
+	mu.RLock()
+	t := tags
+	mu.RUnlock()
+	t.reset()
+}
+
+type tagKey struct{}
+
+// WithTag tags ctx with a client-chosen connection tag, such as a job ID,
+// for listeners that dial the pool directly.
+func WithTag(ctx context.Context, tag string) context.Context {
+	if tag == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// TagFromContext returns the tag set by WithTag, or "".
+func TagFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(tagKey{}).(string)
+	return tag
+}
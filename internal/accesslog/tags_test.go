@@ -0,0 +1,63 @@
+package accesslog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTagsAreBounded(t *testing.T) {
+	if err := Configure(Config{Tags: 2}); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if !Enabled() {
+		t.Fatal("tag totals alone should enable collection")
+	}
+	log := func(tag, result string, up int64) {
+		e := Entry{Time: time.Now(), Tag: tag, Network: "tcp", Target: "a:1", Upload: up, Result: result}
+		if result == ResultError {
+			e.ErrorClass = "timeout"
+		}
+		Log(e)
+	}
+	log("job-1", ResultOK, 10)
+	log("job-1", ResultError, 0)
+	log("job-1", ResultOK, 0)
+	log("job-2", ResultOK, 5)
+	log("job-3", ResultOK, 1)
+	log("job-4", ResultError, 1)
+	log("", ResultOK, 100)
+
+	got := map[string]TagStats{}
+	for _, s := range Tags() {
+		got[s.Tag] = s
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected job-1, job-2 and %s, got %v", OtherTag, Tags())
+	}
+	if s := got["job-1"]; s.Connections != 3 || s.Failures != 1 || s.Upload != 10 || s.FailureClasses["timeout"] != 1 {
+		t.Errorf("job-1 = %+v", s)
+	}
+	if s := got[OtherTag]; s.Connections != 2 || s.Failures != 1 {
+		t.Errorf("%s = %+v", OtherTag, s)
+	}
+	if Tags()[0].Tag != "job-1" {
+		t.Errorf("busiest tag should come first, got %v", Tags())
+	}
+
+	ResetTags()
+	if len(Tags()) != 0 {
+		t.Fatalf("expected no tags after reset, got %v", Tags())
+	}
+}
+
+func TestTagContext(t *testing.T) {
+	ctx := context.Background()
+	if WithTag(ctx, "") != ctx {
+		t.Fatal("an empty tag should not be stored")
+	}
+	if got := TagFromContext(WithTag(ctx, "job42")); got != "job42" {
+		t.Fatalf("tag = %q", got)
+	}
+}
@@ -10,10 +10,17 @@ import (
 
 	"easy_proxies/internal/boxmgr"
 	"easy_proxies/internal/config"
+	"easy_proxies/internal/handoff"
 	"easy_proxies/internal/monitor"
+	"easy_proxies/internal/plugin"
 	"easy_proxies/internal/subscription"
+	"easy_proxies/internal/tlsconf"
 )
 
+// handoffTimeout bounds how long a new process may take to load its config
+// and start listening before a handoff to it is abandoned.
+const handoffTimeout = 2 * time.Minute
+
 // Run builds the runtime components from config and blocks until shutdown.
 func Run(ctx context.Context, cfg *config.Config) error {
 	// Build monitor config
@@ -33,8 +40,28 @@ func Run(ctx context.Context, cfg *config.Config) error {
 		ProxyPassword:    proxyPassword,
 		ExternalIP:       cfg.ExternalIP,
 		ProbeConcurrency: cfg.ProbeConcurrencyOrDefault(),
+		Freebind:         cfg.Management.Freebind,
+		Language:         cfg.Management.Language,
+	}
+	if cfg.ManagementEnabled() && cfg.Management.TLS.Enabled() {
+		tlsCfg, err := tlsconf.ServerConfig(cfg.Management.TLS.Options(cfg.SelfSignedHosts(cfg.Management.Listen)))
+		if err != nil {
+			return fmt.Errorf("management TLS: %w", err)
+		}
+		monitorCfg.TLS = tlsCfg
+	}
+	if cfg.StatusPage.Enabled {
+		monitorCfg.StatusPage = monitor.StatusPageConfig{
+			Listen:        cfg.StatusPage.Listen,
+			Title:         cfg.StatusPage.Title,
+			DegradedBelow: cfg.StatusPage.DegradedBelow,
+			Language:      cfg.Management.Language,
+		}
 	}
 
+	// Stop exec plugin processes once nothing dials through them.
+	defer plugin.ConfigureExec(nil)
+
 	// Create and start BoxManager
 	boxMgr := boxmgr.New(cfg, monitorCfg)
 	if err := boxMgr.Start(ctx); err != nil {
@@ -61,41 +88,96 @@ func Run(ctx context.Context, cfg *config.Config) error {
 		server.SetSubscriptionRefresher(subMgr)
 	}
 
+	// A process started by a handoff takes over from here; its parent
+	// closes its listeners and drains.
+	handoff.Ready()
+
 	// Wait for shutdown signal
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(sigCh)
+	restartCh := make(chan os.Signal, 1)
+	if handoff.Signal != nil {
+		signal.Notify(restartCh, handoff.Signal)
+		defer signal.Stop(restartCh)
+	}
 
-	select {
-	case <-ctx.Done():
-		fmt.Println("Context cancelled, initiating graceful shutdown...")
-	case sig := <-sigCh:
-		fmt.Printf("Received %s, initiating graceful shutdown...\n", sig)
+	var successor *handoff.Successor
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Context cancelled, initiating graceful shutdown...")
+			break wait
+		case sig := <-sigCh:
+			fmt.Printf("Received %s, initiating graceful shutdown...\n", sig)
+			break wait
+		case sig := <-restartCh:
+			fmt.Printf("Received %s, starting a new process to hand the listeners over to...\n", sig)
+			s, err := handoff.Start(handoffTimeout)
+			if err != nil {
+				fmt.Printf("Restart aborted, still serving: %v\n", err)
+				continue
+			}
+			successor = s
+			fmt.Printf("New process %d is listening, initiating graceful shutdown...\n", s.Pid())
+			break wait
+		}
 	}
 
-	// Create shutdown context with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// New connections are refused from here on; in-flight tunnels get up to
+	// shutdown_timeout to finish before the sing-box instance is closed.
+	// A second signal skips the wait. After a handoff the new process
+	// already accepts them, and signals are passed on to it as well.
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer shutdownCancel()
+	go func() {
+		select {
+		case sig := <-sigCh:
+			if successor != nil {
+				_ = successor.Signal(sig)
+			}
+			fmt.Println("Second signal received, forcing shutdown...")
+			shutdownCancel()
+		case <-shutdownCtx.Done():
+		}
+	}()
 
-	// Graceful shutdown sequence
 	fmt.Println("Stopping subscription manager...")
 	if subMgr != nil {
 		subMgr.Stop()
 	}
 
-	fmt.Println("Stopping box manager...")
-	if err := boxMgr.Close(); err != nil {
+	fmt.Printf("Draining connections (up to %s)...\n", cfg.ShutdownTimeout)
+	if err := boxMgr.Shutdown(shutdownCtx); err != nil {
 		fmt.Printf("Error closing box manager: %v\n", err)
 	}
+	fmt.Println("Graceful shutdown completed")
 
-	// Wait for connections to drain
-	fmt.Println("Waiting for connections to drain...")
-	select {
-	case <-time.After(2 * time.Second):
-		fmt.Println("Graceful shutdown completed")
-	case <-shutdownCtx.Done():
-		fmt.Println("Shutdown timeout exceeded, forcing exit")
+	if successor != nil {
+		return waitForSuccessor(successor, sigCh, restartCh)
 	}
-
 	return nil
 }
+
+// waitForSuccessor keeps a process that has handed over running until its
+// successor exits, so that a service manager or container runtime watching
+// this PID does not stop the new process. It holds no listeners or nodes
+// by now and passes every signal on, a restart signal included, so the
+// service can still be stopped and restarted through this PID.
+func waitForSuccessor(successor *handoff.Successor, sigCh, restartCh <-chan os.Signal) error {
+	fmt.Printf("Waiting for process %d, which now serves\n", successor.Pid())
+	for {
+		select {
+		case sig := <-sigCh:
+			_ = successor.Signal(sig)
+		case sig := <-restartCh:
+			_ = successor.Signal(sig)
+		case err := <-successor.Wait():
+			if err != nil {
+				return fmt.Errorf("process %d: %w", successor.Pid(), err)
+			}
+			return nil
+		}
+	}
+}
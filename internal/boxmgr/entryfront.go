@@ -0,0 +1,256 @@
+package boxmgr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/builder"
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/freebind"
+	"easy_proxies/internal/handoff"
+	"easy_proxies/internal/httprewrite"
+	"easy_proxies/internal/httproute"
+	"easy_proxies/internal/outbound/pool"
+	"easy_proxies/internal/tlsconf"
+
+	"github.com/sagernet/sing-box/adapter"
+	sblog "github.com/sagernet/sing-box/log"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// entryFront owns the public pool and sticky ports when listener TLS,
+// http_rewrite, rules by HTTP method or node pinning are enabled. It
+// terminates TLS, rewrites plain HTTP requests, moves pinning headers into
+// the username, sends requests matched by a method rule through the rule's
+// pool and hands the connections to the entry inbounds of the
+// running instance, which only listen on loopback (see
+// builder.entryListenOptions). Clients speak HTTP or SOCKS5 inside the
+// tunnel, and the inbound still sees their real source address.
+type entryFront struct {
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// startEntryFront opens the fronted entries of cfg, replacing any previous
+// ones.
+func (m *Manager) startEntryFront(ctx context.Context, cfg *config.Config) error {
+	m.stopEntryFront()
+	if !cfg.EntryFront() {
+		return nil
+	}
+	var tlsCfg *tls.Config
+	if cfg.Listener.TLS.Enabled() {
+		var err error
+		tlsCfg, err = tlsconf.ServerConfig(cfg.Listener.TLS.Options(cfg.SelfSignedHosts(cfg.Listener.Address)))
+		if err != nil {
+			return fmt.Errorf("listener TLS: %w", err)
+		}
+	}
+	rules := httpRewriteRules(cfg)
+	router := httpRouter(cfg)
+	pinning := cfg.Listener.NodePinning
+	entries := map[string]uint16{builder.PoolInboundTag: cfg.Listener.Port}
+	if cfg.Sticky.Enabled {
+		entries[builder.StickyInboundTag] = cfg.Sticky.Port
+	}
+
+	front := &entryFront{}
+	for _, tag := range sortedKeys(entries) {
+		address := net.JoinHostPort(cfg.Listener.Address, strconv.Itoa(int(entries[tag])))
+		var (
+			ln  net.Listener
+			err error
+		)
+		if cfg.Listener.Freebind {
+			ln, err = freebind.Listen(ctx, "tcp", address)
+		} else {
+			ln, err = handoff.Listen(ctx, "tcp", address)
+		}
+		if err != nil {
+			front.close()
+			return fmt.Errorf("listen %s: %w", address, err)
+		}
+		front.listeners = append(front.listeners, ln)
+		var requests *httprewrite.Front
+		if rules != nil || pinning || (router != nil && tag == builder.PoolInboundTag) {
+			requests = &httprewrite.Front{Rules: rules, PinHeaders: pinning}
+			if router != nil && tag == builder.PoolInboundTag {
+				// Like the other rules, method rules only apply to the pool entry.
+				requests.Divert = router.Divert
+			}
+		}
+		front.wg.Add(1)
+		go m.serveEntryFront(ctx, ln, tlsCfg, requests, tag, &front.wg)
+		switch {
+		case tlsCfg != nil:
+			log.Printf("🔐 TLS entry %s listening on %s", tag, address)
+		case rules != nil:
+			log.Printf("✏️ HTTP rewriting entry %s listening on %s", tag, address)
+		case router != nil && tag == builder.PoolInboundTag:
+			log.Printf("🔀 HTTP routing entry %s listening on %s", tag, address)
+		default:
+			log.Printf("📌 Node pinning entry %s listening on %s", tag, address)
+		}
+	}
+
+	m.mu.Lock()
+	m.entryFront = front
+	m.mu.Unlock()
+	return nil
+}
+
+// stopEntryFront closes the TLS entry listeners. Established connections are
+// left to finish.
+func (m *Manager) stopEntryFront() {
+	m.mu.Lock()
+	front := m.entryFront
+	m.entryFront = nil
+	m.mu.Unlock()
+	front.close()
+}
+
+func (f *entryFront) close() {
+	if f == nil {
+		return
+	}
+	for _, ln := range f.listeners {
+		_ = ln.Close()
+	}
+	f.wg.Wait()
+}
+
+func (m *Manager) serveEntryFront(ctx context.Context, ln net.Listener, tlsCfg *tls.Config, requests *httprewrite.Front, tag string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+		go m.handleEntryConn(ctx, conn, tlsCfg, requests, tag)
+	}
+}
+
+func (m *Manager) handleEntryConn(ctx context.Context, raw net.Conn, tlsCfg *tls.Config, requests *httprewrite.Front, tag string) {
+	conn := raw
+	if tlsCfg != nil {
+		tlsConn := tls.Server(raw, tlsCfg)
+		hsCtx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+		err := tlsConn.HandshakeContext(hsCtx)
+		cancel()
+		if err != nil {
+			_ = raw.Close()
+			return
+		}
+		conn = tlsConn
+	}
+	if requests != nil {
+		conn = requests.Wrap(conn)
+	}
+
+	boxCtx, inbound, ok := m.entryInbound(tag)
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+	metadata := adapter.InboundContext{
+		Source:            M.SocksaddrFromNet(raw.RemoteAddr()).Unwrap(),
+		OriginDestination: M.SocksaddrFromNet(raw.LocalAddr()).Unwrap(),
+	}
+	inbound.NewConnectionEx(sblog.ContextWithNewID(boxCtx), conn, metadata, nil)
+}
+
+// entryInbound returns the inbound tag of the running instance together
+// with the context it was created with.
+func (m *Manager) entryInbound(tag string) (context.Context, adapter.TCPInjectableInbound, bool) {
+	m.mu.RLock()
+	current := m.currentBox
+	m.mu.RUnlock()
+	if current == nil {
+		return nil, nil, false
+	}
+	m.listeners.mu.Lock()
+	boxCtx, same := m.listeners.ctx, m.listeners.box == current
+	m.listeners.mu.Unlock()
+	if !same {
+		return nil, nil, false
+	}
+	inbound, ok := current.Inbound().Get(tag)
+	if !ok {
+		return nil, nil, false
+	}
+	injectable, ok := inbound.(adapter.TCPInjectableInbound)
+	return boxCtx, injectable, ok
+}
+
+// httpRewriteRules converts the http_rewrite section, or returns nil when it
+// is disabled. Pinned node names are resolved to their group for
+// group_headers.
+func httpRewriteRules(cfg *config.Config) *httprewrite.Rules {
+	h := cfg.HTTPRewrite
+	if !h.Enabled {
+		return nil
+	}
+	groups := make(map[string]string, len(cfg.Nodes))
+	for _, node := range cfg.Nodes {
+		if node.Group != "" {
+			groups[node.Name] = node.Group
+		}
+	}
+	return &httprewrite.Rules{
+		Remove:       h.RemoveHeaders,
+		Set:          h.SetHeaders,
+		GroupSet:     h.GroupHeaders,
+		GroupOf:      func(node string) string { return groups[node] },
+		ForceConnect: h.ForceConnect,
+	}
+}
+
+// httpRouter converts the rules by HTTP method, or returns nil when there
+// are none. Targets are resolved to the pools built for them like the other
+// rules: a node group, then a GeoIP region.
+func httpRouter(cfg *config.Config) *httproute.Router {
+	rules := cfg.HTTPRules()
+	if len(rules) == 0 {
+		return nil
+	}
+	router := &httproute.Router{Users: listenerCredentials(cfg), Dialer: ruleDialer, ErrorDetail: cfg.Listener.ErrorDetail}
+	for _, rc := range rules {
+		router.Rules = append(router.Rules, httproute.Rule{
+			Methods:       rc.Method,
+			DomainSuffix:  rc.DomainSuffix,
+			DomainKeyword: rc.DomainKeyword,
+			Target:        rc.Group,
+		})
+	}
+	return router
+}
+
+// ruleDialer returns the dialer of a rule target.
+func ruleDialer(target string) (httproute.Dialer, bool) {
+	tags := []string{builder.GroupPoolTag(target), fmt.Sprintf("pool-%s", target)}
+	switch target {
+	case config.RuleGroupDirect:
+		return &net.Dialer{}, true
+	case config.RuleGroupSticky:
+		tags = []string{builder.StickyPoolTag}
+	}
+	for _, tag := range tags {
+		if dialer, ok := pool.GetDialer(tag); ok {
+			return dialer, true
+		}
+	}
+	return nil, false
+}
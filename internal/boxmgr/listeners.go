@@ -0,0 +1,323 @@
+package boxmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/builder"
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/monitor"
+	"easy_proxies/internal/outbound/pool"
+
+	"github.com/sagernet/sing-box"
+	sblog "github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+)
+
+// bindRetryInterval is how often deferred listeners that failed to bind are
+// retried.
+const bindRetryInterval = 10 * time.Second
+
+// deferredListeners owns the listeners bound after the instance has started
+// rather than by sing-box itself: every per-node multi-port listener, plus
+// the entries whose section sets freebind. Binding them one by one means a
+// port that is in use, or an address that is not assigned yet, only takes
+// that listener offline (and is retried) instead of aborting startup.
+// With multi_port.lazy the per-node listeners stay closed until activated
+// and are closed again once idle.
+type deferredListeners struct {
+	mu       sync.Mutex
+	box      *box.Box
+	ctx      context.Context // box context; inbounds must be created with it
+	lazy     bool
+	idle     time.Duration
+	inbounds map[string]option.Inbound           // inbound tag -> listener
+	active   map[string]time.Time                // bound listeners -> activation time
+	failed   map[string]*monitor.ListenerFailure // inbound tag -> last bind failure
+	stop     context.CancelFunc
+}
+
+// splitDeferredInbounds moves the listeners bound after startup out of opts
+// and returns them keyed by inbound tag.
+func splitDeferredInbounds(cfg *config.Config, opts *option.Options) map[string]option.Inbound {
+	inbounds := make(map[string]option.Inbound)
+	kept := opts.Inbounds[:0]
+	for _, inbound := range opts.Inbounds {
+		if isDeferredInbound(cfg, inbound.Tag) {
+			inbounds[inbound.Tag] = inbound
+			continue
+		}
+		kept = append(kept, inbound)
+	}
+	opts.Inbounds = kept
+	return inbounds
+}
+
+func isDeferredInbound(cfg *config.Config, tag string) bool {
+	switch {
+	case tag == builder.PoolInboundTag || tag == builder.StickyInboundTag:
+		// Behind the entry front the inbounds only listen on loopback;
+		// the front applies freebind to the public address instead.
+		return cfg.Listener.Freebind && !cfg.EntryFront()
+	case builder.IsGroupInbound(tag):
+		return cfg.MultiPort.Freebind
+	}
+	_, perNode := builder.NodeTagOfInbound(tag)
+	return perNode
+}
+
+// isLazy reports whether tag is only bound on activation.
+func (l *deferredListeners) isLazy(tag string) bool {
+	_, perNode := builder.NodeTagOfInbound(tag)
+	return l.lazy && perNode
+}
+
+// reset binds the listeners to a freshly created instance. Nothing is opened
+// until start is called once the instance is running; state of a previous
+// instance is forgotten with it.
+func (l *deferredListeners) reset(instance *box.Box, ctx context.Context, inbounds map[string]option.Inbound, lazy bool, idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stop != nil {
+		l.stop()
+		l.stop = nil
+	}
+	l.box, l.ctx, l.inbounds, l.lazy, l.idle = instance, ctx, inbounds, lazy, idle
+	l.active = make(map[string]time.Time)
+	l.failed = make(map[string]*monitor.ListenerFailure)
+}
+
+// start binds every listener of a running instance except lazy ones and
+// starts the background loop retrying failed binds and closing idle lazy
+// listeners.
+func (l *deferredListeners) start(instance *box.Box) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.box != instance || len(l.inbounds) == 0 || l.stop != nil {
+		return
+	}
+	for _, tag := range sortedKeys(l.inbounds) {
+		if !l.isLazy(tag) {
+			_ = l.bindLocked(tag)
+		}
+	}
+	if n := len(l.failed); n > 0 {
+		log.Printf("⚠️  %d of %d listener(s) failed to bind, retrying every %s", n, len(l.inbounds), bindRetryInterval)
+	}
+	loopCtx, cancel := context.WithCancel(l.ctx)
+	l.stop = cancel
+	go l.loop(loopCtx)
+}
+
+// update closes and forgets the listeners in unbind, then adds those in
+// bind to the running instance, binding them unless they are lazy.
+func (l *deferredListeners) update(instance *box.Box, unbind []string, bind map[string]option.Inbound) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.box != instance {
+		return
+	}
+	for _, tag := range unbind {
+		if _, open := l.active[tag]; open {
+			if err := l.box.Inbound().Remove(tag); err != nil {
+				log.Printf("⚠️  close listener %s: %v", tag, err)
+			}
+		}
+		delete(l.inbounds, tag)
+		delete(l.active, tag)
+		delete(l.failed, tag)
+	}
+	if l.inbounds == nil {
+		l.inbounds = make(map[string]option.Inbound, len(bind))
+	}
+	for _, tag := range sortedKeys(bind) {
+		l.inbounds[tag] = bind[tag]
+		if !l.isLazy(tag) {
+			_ = l.bindLocked(tag)
+		}
+	}
+	if l.stop == nil && len(l.inbounds) > 0 {
+		loopCtx, cancel := context.WithCancel(l.ctx)
+		l.stop = cancel
+		go l.loop(loopCtx)
+	}
+}
+
+// close stops the background loop.
+func (l *deferredListeners) close() {
+	l.reset(nil, context.Background(), nil, false, 0)
+}
+
+// bindLocked opens the listener of tag, recording the outcome.
+func (l *deferredListeners) bindLocked(tag string) error {
+	inbound := l.inbounds[tag]
+	err := l.box.Inbound().Create(l.ctx, l.box.Router(), sblog.StdLogger(), inbound.Tag, inbound.Type, inbound.Options)
+	if err != nil {
+		failure := l.failed[tag]
+		if failure == nil {
+			failure = &monitor.ListenerFailure{Tag: tag, Port: inboundPort(inbound), Since: time.Now()}
+			l.failed[tag] = failure
+			log.Printf("❌ listener %s (port %d) failed to bind: %v", inbound.Tag, failure.Port, err)
+		}
+		failure.Error = err.Error()
+		failure.Attempts++
+		return err
+	}
+	if failure, ok := l.failed[tag]; ok {
+		log.Printf("✅ listener %s bound to port %d after %d attempt(s)", inbound.Tag, failure.Port, failure.Attempts+1)
+		delete(l.failed, tag)
+	}
+	l.active[tag] = time.Now()
+	return nil
+}
+
+// ActivateListener opens the lazy per-node listener of node tag and returns
+// its port. Activating an open listener refreshes its idle timer.
+func (m *Manager) ActivateListener(ctx context.Context, tag string) (uint16, error) {
+	m.mu.RLock()
+	current, shuttingDown := m.currentBox, m.shuttingDown
+	m.mu.RUnlock()
+	if shuttingDown {
+		return 0, errShuttingDown
+	}
+	if current == nil {
+		return 0, errors.New("sing-box is not running")
+	}
+
+	l := &m.listeners
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.box != current || !l.lazy {
+		return 0, errors.New("multi_port.lazy is not enabled")
+	}
+	inboundTag := builder.NodeInboundTag(tag)
+	inbound, ok := l.inbounds[inboundTag]
+	if !ok {
+		return 0, fmt.Errorf("node %q has no lazy listener", tag)
+	}
+	port := inboundPort(inbound)
+	if _, open := l.active[inboundTag]; open {
+		l.active[inboundTag] = time.Now()
+		return port, nil
+	}
+	if err := l.bindLocked(inboundTag); err != nil {
+		// A lazy listener is only retried when activated again.
+		delete(l.failed, inboundTag)
+		return 0, fmt.Errorf("start listener %s: %w", inbound.Tag, err)
+	}
+	m.logger.Infof("lazy listener %s started on port %d", inbound.Tag, port)
+	return port, nil
+}
+
+// ListenerStatus reports how many deferred listeners are bound and which
+// failed to bind.
+func (m *Manager) ListenerStatus() monitor.ListenerStatus {
+	m.mu.RLock()
+	current := m.currentBox
+	m.mu.RUnlock()
+
+	l := &m.listeners
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current == nil || l.box != current {
+		return monitor.ListenerStatus{}
+	}
+	status := monitor.ListenerStatus{
+		Total:     len(l.inbounds),
+		Listening: len(l.active),
+	}
+	for tag := range l.inbounds {
+		if _, open := l.active[tag]; !open && l.isLazy(tag) {
+			status.Idle++
+		}
+	}
+	for _, failure := range l.failed {
+		status.Failed = append(status.Failed, *failure)
+	}
+	sort.Slice(status.Failed, func(i, j int) bool { return status.Failed[i].Port < status.Failed[j].Port })
+	return status
+}
+
+// loop retries failed binds and, for lazy listeners, closes those that
+// carried no open connection for the idle timeout.
+func (l *deferredListeners) loop(ctx context.Context) {
+	retry := time.NewTicker(bindRetryInterval)
+	defer retry.Stop()
+	var reap <-chan time.Time
+	if l.lazy && l.idle > 0 {
+		interval := l.idle / 4
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		reap = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry.C:
+			l.mu.Lock()
+			if ctx.Err() == nil {
+				for _, tag := range sortedKeys(l.failed) {
+					_ = l.bindLocked(tag)
+				}
+			}
+			l.mu.Unlock()
+		case <-reap:
+			l.mu.Lock()
+			if ctx.Err() == nil {
+				l.closeIdleLocked(time.Now())
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *deferredListeners) closeIdleLocked(now time.Time) {
+	for inboundTag, activated := range l.active {
+		nodeTag, perNode := builder.NodeTagOfInbound(inboundTag)
+		if !perNode {
+			continue
+		}
+		open, lastUsed, _ := pool.Activity(fmt.Sprintf("%s-%s", pool.Tag, nodeTag))
+		if open > 0 {
+			continue
+		}
+		since := activated
+		if lastUsed.After(since) {
+			since = lastUsed
+		}
+		if now.Sub(since) < l.idle {
+			continue
+		}
+		if err := l.box.Inbound().Remove(inboundTag); err != nil {
+			log.Printf("⚠️  close idle listener %s: %v", inboundTag, err)
+		} else {
+			log.Printf("💤 lazy listener %s closed after %s idle", inboundTag, l.idle)
+		}
+		delete(l.active, inboundTag)
+	}
+}
+
+func inboundPort(inbound option.Inbound) uint16 {
+	if opts, ok := inbound.Options.(*option.HTTPMixedInboundOptions); ok {
+		return opts.ListenPort
+	}
+	return 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
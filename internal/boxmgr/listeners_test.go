@@ -0,0 +1,64 @@
+package boxmgr
+
+import (
+	"testing"
+	"time"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/monitor"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestSplitDeferredInbounds(t *testing.T) {
+	newOpts := func() option.Options {
+		return option.Options{Inbounds: []option.Inbound{
+			{Tag: "http-in"},
+			{Tag: "in-node-a", Options: &option.HTTPMixedInboundOptions{ListenOptions: option.ListenOptions{ListenPort: 24000}}},
+			{Tag: "in-port-us"},
+			{Tag: "in-node-b"},
+			{Tag: "tun-in"},
+		}}
+	}
+
+	opts := newOpts()
+	inbounds := splitDeferredInbounds(&config.Config{}, &opts)
+	if len(inbounds) != 2 || inbounds["in-node-a"].Tag != "in-node-a" || inbounds["in-node-b"].Tag != "in-node-b" {
+		t.Fatalf("unexpected deferred listeners: %+v", inbounds)
+	}
+	if len(opts.Inbounds) != 3 || opts.Inbounds[0].Tag != "http-in" || opts.Inbounds[1].Tag != "in-port-us" {
+		t.Fatalf("unexpected remaining inbounds: %+v", opts.Inbounds)
+	}
+	if port := inboundPort(inbounds["in-node-a"]); port != 24000 {
+		t.Fatalf("inboundPort = %d, want 24000", port)
+	}
+
+	cfg := &config.Config{}
+	cfg.Listener.Freebind = true
+	cfg.MultiPort.Freebind = true
+	opts = newOpts()
+	inbounds = splitDeferredInbounds(cfg, &opts)
+	if len(inbounds) != 4 || len(opts.Inbounds) != 1 || opts.Inbounds[0].Tag != "tun-in" {
+		t.Fatalf("freebind should defer pool and grouped listeners, got %+v / %+v", inbounds, opts.Inbounds)
+	}
+}
+
+func TestDeferredListenersLazyOnlyPerNode(t *testing.T) {
+	l := &deferredListeners{lazy: true}
+	if !l.isLazy("in-node-a") {
+		t.Fatal("per-node listener should be lazy")
+	}
+	if l.isLazy("http-in") || l.isLazy("in-port-us") {
+		t.Fatal("pool and grouped listeners are never lazy")
+	}
+}
+
+func TestListenerStatusWithoutInstance(t *testing.T) {
+	m := &Manager{}
+	m.listeners.failed = map[string]*monitor.ListenerFailure{
+		"in-node-a": {Tag: "in-node-a", Port: 24000, Since: time.Now()},
+	}
+	if status := m.ListenerStatus(); status.Total != 0 || len(status.Failed) != 0 {
+		t.Fatalf("stopped manager should report nothing, got %+v", status)
+	}
+}
@@ -0,0 +1,272 @@
+package boxmgr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+
+	"easy_proxies/internal/builder"
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/geoip"
+	"easy_proxies/internal/outbound/pool"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	sblog "github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+)
+
+// livePlan is what it takes to bring a running instance from one set of
+// built options to another when only nodes were added or removed: node
+// outbounds come and go, pools are replaced with their new members and
+// per-node listeners are bound or closed. Route rules cannot change on a
+// running instance, so any other difference takes a rebuild.
+type livePlan struct {
+	create []option.Outbound         // new node and via-hop outbounds
+	pools  []option.Outbound         // pools that are new or whose members changed
+	remove []string                  // outbounds gone, pools first
+	bind   map[string]option.Inbound // new per-node listeners
+	unbind []string                  // per-node listeners gone
+	nodes  []string                  // node outbounds gone, for their state
+}
+
+// planLiveUpdate compares the options a running instance was built from
+// with next and reports whether next can be applied in place.
+func planLiveUpdate(running, next option.Options) (livePlan, bool) {
+	var plan livePlan
+
+	// Everything but the outbounds, the listeners and the route rules must
+	// be the same.
+	if !reflect.DeepEqual(withoutNodeParts(running), withoutNodeParts(next)) {
+		return plan, false
+	}
+
+	oldInbounds := inboundsByTag(running.Inbounds)
+	newInbounds := inboundsByTag(next.Inbounds)
+	plan.bind = make(map[string]option.Inbound)
+	for tag, inbound := range newInbounds {
+		old, ok := oldInbounds[tag]
+		if ok && reflect.DeepEqual(old, inbound) {
+			continue
+		}
+		if _, perNode := builder.NodeTagOfInbound(tag); !perNode {
+			return plan, false
+		}
+		if ok {
+			plan.unbind = append(plan.unbind, tag)
+		}
+		plan.bind[tag] = inbound
+	}
+	for tag := range oldInbounds {
+		if _, ok := newInbounds[tag]; ok {
+			continue
+		}
+		if _, perNode := builder.NodeTagOfInbound(tag); !perNode {
+			return plan, false
+		}
+		plan.unbind = append(plan.unbind, tag)
+	}
+	slices.Sort(plan.unbind)
+
+	// The rules of listeners that are gone stay in the router but match
+	// nothing; the rest must be what next routes by.
+	if !reflect.DeepEqual(routeRules(running, newInbounds), routeRules(next, nil)) {
+		return plan, false
+	}
+
+	oldOutbounds := make(map[string]option.Outbound, len(running.Outbounds))
+	for _, outbound := range running.Outbounds {
+		oldOutbounds[outbound.Tag] = outbound
+	}
+	newTags := make(map[string]bool, len(next.Outbounds))
+	for _, outbound := range next.Outbounds {
+		newTags[outbound.Tag] = true
+		old, ok := oldOutbounds[outbound.Tag]
+		switch {
+		case ok && reflect.DeepEqual(old, outbound):
+		case outbound.Type == pool.Type:
+			plan.pools = append(plan.pools, outbound)
+		case ok:
+			// A node outbound changed under the same tag; the pools and
+			// chains holding the old one would keep using it.
+			return plan, false
+		default:
+			plan.create = append(plan.create, outbound)
+		}
+	}
+	var removedNodes []string
+	for _, outbound := range running.Outbounds {
+		if newTags[outbound.Tag] {
+			continue
+		}
+		if outbound.Type == pool.Type {
+			plan.remove = append(plan.remove, outbound.Tag)
+		} else {
+			removedNodes = append(removedNodes, outbound.Tag)
+		}
+	}
+	plan.remove = append(plan.remove, removedNodes...)
+	plan.nodes = removedNodes
+	return plan, true
+}
+
+// withoutNodeParts returns opts without the parts planLiveUpdate compares
+// on their own.
+func withoutNodeParts(opts option.Options) option.Options {
+	opts.Inbounds, opts.Outbounds = nil, nil
+	if opts.Route != nil {
+		route := *opts.Route
+		route.Rules = nil
+		opts.Route = &route
+	}
+	return opts
+}
+
+func inboundsByTag(inbounds []option.Inbound) map[string]option.Inbound {
+	byTag := make(map[string]option.Inbound, len(inbounds))
+	for _, inbound := range inbounds {
+		byTag[inbound.Tag] = inbound
+	}
+	return byTag
+}
+
+// routeRules returns the route rules of opts. With inbounds set, the rules
+// of per-node listeners not in it are left out.
+func routeRules(opts option.Options, inbounds map[string]option.Inbound) []option.Rule {
+	if opts.Route == nil {
+		return nil
+	}
+	rules := make([]option.Rule, 0, len(opts.Route.Rules))
+	for _, rule := range opts.Route.Rules {
+		if inbounds != nil && rule.Type == C.RuleTypeDefault && len(rule.DefaultOptions.Inbound) == 1 {
+			tag := rule.DefaultOptions.Inbound[0]
+			if _, perNode := builder.NodeTagOfInbound(tag); perNode {
+				if _, ok := inbounds[tag]; !ok {
+					continue
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// applyLive applies newCfg, already normalized, to the running instance in
+// place when it only adds or removes nodes, so open connections through
+// the other nodes carry on. It reports false when that takes a rebuild; an
+// error means the instance may be half updated and must be rebuilt.
+func (m *Manager) applyLive(newCfg *config.Config) (bool, error) {
+	next, err := builder.Build(newCfg)
+	if err != nil {
+		return false, fmt.Errorf("build sing-box options: %w", err)
+	}
+
+	m.mu.Lock()
+	if m.shuttingDown {
+		m.mu.Unlock()
+		return false, errShuttingDown
+	}
+	instance := m.currentBox
+	if instance == nil || m.running == nil {
+		m.mu.Unlock()
+		return false, nil
+	}
+	plan, ok := planLiveUpdate(*m.running, next)
+	if !ok {
+		m.mu.Unlock()
+		return false, nil
+	}
+	// The router keeps the rules it was started with.
+	next.Route = m.running.Route
+	m.running = nil // whatever happens below, only a rebuild sets it again
+	m.listeners.mu.Lock()
+	ctx := m.listeners.ctx
+	m.listeners.mu.Unlock()
+
+	outbounds := instance.Outbound()
+	for _, outbound := range append(plan.create, plan.pools...) {
+		// Creating a pool under a running tag replaces it; traffic already
+		// going through the old one carries on.
+		err := outbounds.Create(ctx, instance.Router(), sblog.StdLogger(), outbound.Tag, outbound.Type, outbound.Options)
+		if err != nil {
+			m.mu.Unlock()
+			return false, fmt.Errorf("create outbound %s: %w", outbound.Tag, err)
+		}
+	}
+	m.listeners.update(instance, plan.unbind, plan.bind)
+	for _, tag := range plan.remove {
+		removeOutbound(outbounds, tag)
+	}
+	pool.DropSharedState(plan.nodes)
+	if m.monitorMgr != nil {
+		m.monitorMgr.RemoveNodes(plan.nodes)
+	}
+	m.running = &next
+	m.cfg = newCfg
+	m.mu.Unlock()
+
+	if m.monitorServer != nil {
+		m.monitorServer.SetConfig(newCfg)
+	}
+	if m.monitorMgr != nil && len(plan.create) > 0 {
+		_, probeTimeout := healthCheckTiming(newCfg)
+		go m.monitorMgr.ProbeAllNow(probeTimeout)
+	}
+	// The GeoIP entry holds the pools it dials through.
+	if newCfg.GeoIP.Enabled && geoIPPoolsChanged(plan) {
+		m.startGeoIPRouter(m.baseContext(), newCfg)
+	}
+	log.Printf("✅ applied in place: %d outbound(s) added, %d pool(s) updated, %d outbound(s) removed", len(plan.create), len(plan.pools), len(plan.remove))
+	return true, nil
+}
+
+// baseContext returns the context the manager was started with.
+func (m *Manager) baseContext() context.Context {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.baseCtx == nil {
+		return context.Background()
+	}
+	return m.baseCtx
+}
+
+// geoIPPoolsChanged reports whether plan touches a pool the GeoIP entry
+// dials through.
+func geoIPPoolsChanged(plan livePlan) bool {
+	geoPools := map[string]bool{pool.Tag: true}
+	for _, region := range geoip.AllRegions() {
+		geoPools[fmt.Sprintf("pool-%s", region)] = true
+	}
+	for _, outbound := range plan.pools {
+		if geoPools[outbound.Tag] {
+			return true
+		}
+	}
+	for _, tag := range plan.remove {
+		if geoPools[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOutbound closes and drops the outbound tag. A pool replaced in
+// place leaves its old members recorded as its dependencies, so the
+// manager may drop a node outbound but refuse to close it; it is closed
+// here then.
+func removeOutbound(outbounds adapter.OutboundManager, tag string) {
+	outbound, ok := outbounds.Outbound(tag)
+	if !ok {
+		return
+	}
+	if err := outbounds.Remove(tag); err != nil {
+		if _, still := outbounds.Outbound(tag); still {
+			log.Printf("⚠️  remove outbound %s: %v", tag, err)
+			return
+		}
+		_ = common.Close(outbound)
+	}
+}
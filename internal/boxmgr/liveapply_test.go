@@ -0,0 +1,93 @@
+package boxmgr
+
+import (
+	"slices"
+	"testing"
+
+	"easy_proxies/internal/builder"
+	"easy_proxies/internal/outbound/pool"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+func liveOptions(nodes ...string) option.Options {
+	opts := option.Options{Route: &option.RouteOptions{Final: pool.Tag}}
+	for _, tag := range nodes {
+		opts.Outbounds = append(opts.Outbounds, option.Outbound{
+			Type:    C.TypeSOCKS,
+			Tag:     tag,
+			Options: &option.SOCKSOutboundOptions{ServerOptions: option.ServerOptions{Server: tag + ".example.com", ServerPort: 1080}},
+		})
+	}
+	opts.Outbounds = append(opts.Outbounds, option.Outbound{
+		Type:    pool.Type,
+		Tag:     pool.Tag,
+		Options: &pool.Options{Members: slices.Clone(nodes)},
+	})
+	opts.Inbounds = []option.Inbound{{Type: C.TypeMixed, Tag: builder.PoolInboundTag, Options: &option.HTTPMixedInboundOptions{}}}
+	return opts
+}
+
+// withNodeListeners adds a per-node listener and its rule for each node.
+func withNodeListeners(opts option.Options, nodes ...string) option.Options {
+	for _, tag := range nodes {
+		inboundTag := builder.NodeInboundTag(tag)
+		opts.Inbounds = append(opts.Inbounds, option.Inbound{Type: C.TypeMixed, Tag: inboundTag, Options: &option.HTTPMixedInboundOptions{}})
+		opts.Route.Rules = append(opts.Route.Rules, option.Rule{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{Inbound: badoption.Listable[string]{inboundTag}},
+		}})
+	}
+	return opts
+}
+
+func TestPlanLiveUpdate(t *testing.T) {
+	plan, ok := planLiveUpdate(liveOptions("a", "b"), liveOptions("a", "c"))
+	if !ok {
+		t.Fatal("adding and removing a pool node should apply in place")
+	}
+	if len(plan.create) != 1 || plan.create[0].Tag != "c" {
+		t.Fatalf("create: %+v", plan.create)
+	}
+	if len(plan.pools) != 1 || plan.pools[0].Tag != pool.Tag {
+		t.Fatalf("pools: %+v", plan.pools)
+	}
+	if !slices.Equal(plan.remove, []string{"b"}) || !slices.Equal(plan.nodes, []string{"b"}) {
+		t.Fatalf("remove: %v, nodes: %v", plan.remove, plan.nodes)
+	}
+}
+
+func TestPlanLiveUpdate_PerNodeListeners(t *testing.T) {
+	running := withNodeListeners(liveOptions("a", "b"), "a", "b")
+
+	// Removing a node closes its listener; its rule stays and matches nothing.
+	plan, ok := planLiveUpdate(running, withNodeListeners(liveOptions("a"), "a"))
+	if !ok {
+		t.Fatal("removing a node with a listener should apply in place")
+	}
+	if !slices.Equal(plan.unbind, []string{builder.NodeInboundTag("b")}) || len(plan.bind) != 0 {
+		t.Fatalf("unbind: %v, bind: %v", plan.unbind, plan.bind)
+	}
+
+	// A new listener needs a route rule the router does not have.
+	if _, ok := planLiveUpdate(running, withNodeListeners(liveOptions("a", "b", "c"), "a", "b", "c")); ok {
+		t.Fatal("a new per-node rule cannot be applied in place")
+	}
+}
+
+func TestPlanLiveUpdate_NeedsRebuild(t *testing.T) {
+	running := liveOptions("a", "b")
+
+	changed := liveOptions("a", "b")
+	changed.Outbounds[0].Options = &option.SOCKSOutboundOptions{ServerOptions: option.ServerOptions{Server: "other.example.com", ServerPort: 1080}}
+	if _, ok := planLiveUpdate(running, changed); ok {
+		t.Fatal("a node changed under the same tag cannot be applied in place")
+	}
+
+	final := liveOptions("a", "c")
+	final.Route.Final = "a"
+	if _, ok := planLiveUpdate(running, final); ok {
+		t.Fatal("a route change cannot be applied in place")
+	}
+}
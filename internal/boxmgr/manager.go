@@ -5,17 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"easy_proxies/internal/accesslog"
 	"easy_proxies/internal/builder"
 	"easy_proxies/internal/config"
 	"easy_proxies/internal/geoip"
 	"easy_proxies/internal/monitor"
+	"easy_proxies/internal/outbound/lazyout"
+	"easy_proxies/internal/outbound/pluginout"
 	"easy_proxies/internal/outbound/pool"
+	"easy_proxies/internal/users"
 
 	"github.com/sagernet/sing-box"
 	C "github.com/sagernet/sing-box/constant"
@@ -23,14 +29,23 @@ import (
 	"github.com/sagernet/sing-box/option"
 )
 
-// Ensure Manager implements monitor.NodeManager.
-var _ monitor.NodeManager = (*Manager)(nil)
+// Ensure Manager implements monitor.NodeManager and the optional listener
+// and route prediction interfaces.
+var (
+	_ monitor.NodeManager       = (*Manager)(nil)
+	_ monitor.ListenerActivator = (*Manager)(nil)
+	_ monitor.ListenerReporter  = (*Manager)(nil)
+	_ monitor.RoutePredictor    = (*Manager)(nil)
+)
 
 const (
 	defaultDrainTimeout       = 10 * time.Second
 	defaultHealthCheckTimeout = 30 * time.Second
 	healthCheckPollInterval   = 500 * time.Millisecond
-	periodicHealthInterval    = 5 * time.Minute
+	drainPollInterval         = 200 * time.Millisecond
+	// Fallbacks for configs that skipped normalization; normally the values
+	// come from pool.health_check.
+	periodicHealthInterval = 5 * time.Minute
 	// periodicHealthTimeout bounds each individual probe. Unreachable nodes wait
 	// out this full deadline, so at scale (thousands of nodes) it dominates the
 	// total sweep time; 8s comfortably covers a healthy node's dial+TLS+HTTP
@@ -38,6 +53,21 @@ const (
 	periodicHealthTimeout = 8 * time.Second
 )
 
+// healthCheckTiming returns the probe interval and per-probe timeout from cfg.
+func healthCheckTiming(cfg *config.Config) (interval, timeout time.Duration) {
+	interval, timeout = periodicHealthInterval, periodicHealthTimeout
+	if cfg == nil {
+		return interval, timeout
+	}
+	if cfg.Pool.HealthCheck.Interval > 0 {
+		interval = cfg.Pool.HealthCheck.Interval
+	}
+	if cfg.Pool.HealthCheck.Timeout > 0 {
+		timeout = cfg.Pool.HealthCheck.Timeout
+	}
+	return interval, timeout
+}
+
 // Logger defines logging interface for the manager.
 type Logger interface {
 	Infof(format string, args ...any)
@@ -60,7 +90,9 @@ type Manager struct {
 	currentBox    *box.Box
 	monitorMgr    *monitor.Manager
 	monitorServer *monitor.Server
+	statusPage    *monitor.StatusPage
 	geoRouter     *geoip.Router
+	entryFront    *entryFront
 	cfg           *config.Config
 	monitorCfg    monitor.Config
 
@@ -70,6 +102,15 @@ type Manager struct {
 
 	baseCtx            context.Context
 	healthCheckStarted bool
+	// shuttingDown is set by Shutdown; from then on nothing opens new
+	// listeners or rebuilds the instance while connections drain.
+	shuttingDown bool
+	stopWatch    context.CancelFunc // stops the nodes_file watcher
+
+	listeners deferredListeners
+	// running is what the current instance was built from (with the
+	// deferred listeners), for applying node changes to it in place.
+	running *option.Options
 }
 
 // New creates a BoxManager with the given config.
@@ -141,11 +182,22 @@ func (m *Manager) Start(ctx context.Context) error {
 	m.mu.Lock()
 	m.currentBox = instance
 	m.mu.Unlock()
+	m.listeners.start(instance)
+	if err := m.startEntryFront(ctx, cfg); err != nil {
+		return err
+	}
+	m.restoreBlacklist(cfg)
+	m.restoreStats(cfg)
+	if m.monitorMgr != nil {
+		m.monitorMgr.SetSpeedTest(speedTestOf(cfg))
+		m.monitorMgr.SetLimitWarning(cfg.LimitWarning)
+		m.monitorMgr.SetCluster(clusterOf(cfg))
+	}
 
 	// Start periodic health check after nodes are registered
 	m.mu.Lock()
 	if m.monitorMgr != nil && !m.healthCheckStarted {
-		m.monitorMgr.StartPeriodicHealthCheck(periodicHealthInterval, periodicHealthTimeout)
+		m.monitorMgr.StartPeriodicHealthCheck(healthCheckTiming(cfg))
 		m.healthCheckStarted = true
 	}
 	m.mu.Unlock()
@@ -169,17 +221,37 @@ func (m *Manager) Start(ctx context.Context) error {
 		m.startGeoIPRouter(ctx, cfg)
 	}
 
+	// Subscriptions own nodes_file when configured; otherwise follow edits to it.
+	if cfg.NodesFile != "" && len(cfg.Subscriptions) == 0 {
+		watchCtx, cancel := context.WithCancel(ctx)
+		m.mu.Lock()
+		m.stopWatch = cancel
+		m.mu.Unlock()
+		go m.watchNodesFile(watchCtx, cfg.NodesFile)
+	}
+
 	return nil
 }
 
 // Reload gracefully switches to a new configuration.
 // For multi-port mode, we must stop the old instance first to release ports.
 func (m *Manager) Reload(newCfg *config.Config) error {
+	return m.reload(newCfg, nil)
+}
+
+// reload rebuilds the sing-box instance for newCfg. When retain is nil all
+// per-node failure/blacklist/health state is reset; otherwise state is kept
+// for the tags in retain and dropped for the rest.
+func (m *Manager) reload(newCfg *config.Config, retain map[string]bool) error {
 	if newCfg == nil {
 		return errors.New("new config is nil")
 	}
 
 	m.mu.Lock()
+	if m.shuttingDown {
+		m.mu.Unlock()
+		return errShuttingDown
+	}
 	if m.currentBox == nil {
 		m.mu.Unlock()
 		return errors.New("manager not started")
@@ -212,17 +284,18 @@ func (m *Manager) Reload(newCfg *config.Config) error {
 		m.geoRouter = nil
 	}
 	m.mu.Unlock()
+	m.stopEntryFront()
 
 	// Give OS time to release ports
 	time.Sleep(500 * time.Millisecond)
 
-	// Reset shared state store to ensure clean state for new config
-	pool.ResetSharedStateStore()
-
-	// Clear stale monitor nodes so the dashboard reflects the new config
+	// Nodes that survive the reload get their blacklist back afterwards.
 	if m.monitorMgr != nil {
-		m.monitorMgr.ClearNodes()
+		if err := m.monitorMgr.SaveBlacklist(); err != nil {
+			m.logger.Warnf("save blacklist: %v", err)
+		}
 	}
+	m.resetNodeState(retain)
 
 	// Create and start new box instance with automatic port conflict resolution
 	var instance *box.Box
@@ -240,7 +313,7 @@ func (m *Manager) Reload(newCfg *config.Config) error {
 			if conflictPort := extractPortFromBindError(err); conflictPort > 0 {
 				m.logger.Warnf("port %d is in use, reassigning and retrying...", conflictPort)
 				if reassigned := reassignConflictingPort(newCfg, conflictPort); reassigned {
-					pool.ResetSharedStateStore()
+					m.resetNodeState(retain)
 					continue
 				}
 			}
@@ -251,11 +324,32 @@ func (m *Manager) Reload(newCfg *config.Config) error {
 	}
 
 	m.applyConfigSettings(newCfg)
+	if oldCfg != nil && newCfg.Timezone != oldCfg.Timezone {
+		m.logger.Warnf("timezone changed to %q, restart to apply it", newCfg.Timezone)
+	}
 
 	m.mu.Lock()
+	if m.shuttingDown {
+		// Shutdown began while the instance was rebuilt.
+		m.mu.Unlock()
+		_ = instance.Close()
+		return errShuttingDown
+	}
 	m.currentBox = instance
 	m.cfg = newCfg
 	m.mu.Unlock()
+	m.listeners.start(instance)
+	if err := m.startEntryFront(ctx, newCfg); err != nil {
+		m.logger.Errorf("start TLS entry: %v", err)
+	}
+	m.restoreBlacklist(newCfg)
+	if m.monitorMgr != nil {
+		m.monitorMgr.SetStatsFile(newCfg.StatsPath())
+		m.monitorMgr.SetStatsHistory(statsHistoryOf(newCfg))
+		m.monitorMgr.SetSpeedTest(speedTestOf(newCfg))
+		m.monitorMgr.SetLimitWarning(newCfg.LimitWarning)
+		m.monitorMgr.SetCluster(clusterOf(newCfg))
+	}
 
 	// Sync config to monitor server so future WebUI settings changes target the current config pointer
 	if m.monitorServer != nil {
@@ -264,7 +358,8 @@ func (m *Manager) Reload(newCfg *config.Config) error {
 
 	// Trigger initial health check for newly registered nodes
 	if m.monitorMgr != nil {
-		go m.monitorMgr.ProbeAllNow(periodicHealthTimeout)
+		_, probeTimeout := healthCheckTiming(newCfg)
+		go m.monitorMgr.ProbeAllNow(probeTimeout)
 	}
 
 	m.logger.Infof("reload completed successfully with %d nodes", len(newCfg.Nodes))
@@ -284,6 +379,103 @@ func (m *Manager) Reload(newCfg *config.Config) error {
 	return nil
 }
 
+// resetNodeState clears pool shared state and monitor entries before a
+// rebuild, keeping the tags in retain (nil clears everything).
+func (m *Manager) resetNodeState(retain map[string]bool) {
+	if retain == nil {
+		// Reset shared state store to ensure clean state for new config
+		pool.ResetSharedStateStore()
+		// Clear stale monitor nodes so the dashboard reflects the new config
+		if m.monitorMgr != nil {
+			m.monitorMgr.ClearNodes()
+		}
+		return
+	}
+	pool.RetainSharedState(retain)
+	if m.monitorMgr != nil {
+		m.monitorMgr.RetainNodes(retain)
+	}
+}
+
+// restoreBlacklist points the monitor at cfg's blacklist file and re-applies
+// the saved entries to the freshly registered nodes.
+func (m *Manager) restoreBlacklist(cfg *config.Config) {
+	if m.monitorMgr == nil {
+		return
+	}
+	m.monitorMgr.SetBlacklistFile(cfg.Pool.BlacklistFile)
+	restored, err := m.monitorMgr.RestoreBlacklist()
+	if err != nil {
+		m.logger.Warnf("restore blacklist: %v", err)
+		return
+	}
+	if restored > 0 {
+		m.logger.Infof("restored blacklist of %d node(s) from %s", restored, cfg.Pool.BlacklistFile)
+	}
+}
+
+// restoreStats points the monitor at cfg's stats file and adds the counters
+// saved by the previous run. Reloads keep the counters in memory, so this
+// only runs on start.
+func (m *Manager) restoreStats(cfg *config.Config) {
+	if m.monitorMgr == nil {
+		return
+	}
+	path := cfg.StatsPath()
+	m.monitorMgr.SetStatsFile(path)
+	m.monitorMgr.SetStatsHistory(statsHistoryOf(cfg))
+	restoredUsers, restoredNodes, err := m.monitorMgr.RestoreStats()
+	if err != nil {
+		m.logger.Warnf("restore stats: %v", err)
+		return
+	}
+	if restoredUsers > 0 || restoredNodes > 0 {
+		m.logger.Infof("restored usage of %d user(s) and %d node(s) from %s", restoredUsers, restoredNodes, path)
+	}
+}
+
+// statsHistoryOf returns the stats history retention of cfg, zero when the
+// history is disabled.
+func statsHistoryOf(cfg *config.Config) monitor.HistoryRetention {
+	if !cfg.StatsHistory.Enabled {
+		return monitor.HistoryRetention{}
+	}
+	return monitor.HistoryRetention{
+		Minute: cfg.StatsHistory.MinuteRetention,
+		Hour:   cfg.StatsHistory.HourRetention,
+		Day:    cfg.StatsHistory.DayRetention,
+	}
+}
+
+// speedTestOf returns the speed test settings of cfg.
+func speedTestOf(cfg *config.Config) monitor.SpeedTestSettings {
+	return monitor.SpeedTestSettings{
+		URL:      cfg.SpeedTest.URL,
+		MaxBytes: int64(cfg.SpeedTest.MaxMB) << 20,
+		Timeout:  cfg.SpeedTest.Timeout,
+		Interval: cfg.SpeedTest.Interval,
+	}
+}
+
+// clusterOf converts the cluster section; a disabled cluster yields empty
+// settings, which stop syncing. The instance name defaults to the hostname.
+func clusterOf(cfg *config.Config) monitor.ClusterSettings {
+	if !cfg.Cluster.Enabled {
+		return monitor.ClusterSettings{}
+	}
+	name := cfg.Cluster.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return monitor.ClusterSettings{
+		Name:           name,
+		Peers:          cfg.Cluster.Peers,
+		Secret:         cfg.Cluster.Secret,
+		Interval:       cfg.Cluster.Interval,
+		SkipCertVerify: cfg.Cluster.SkipCertVerify,
+	}
+}
+
 // rollbackToOldConfig attempts to restart with the previous configuration.
 func (m *Manager) rollbackToOldConfig(ctx context.Context, oldCfg *config.Config) {
 	if oldCfg == nil {
@@ -304,6 +496,11 @@ func (m *Manager) rollbackToOldConfig(ctx context.Context, oldCfg *config.Config
 	m.currentBox = instance
 	m.cfg = oldCfg
 	m.mu.Unlock()
+	m.listeners.start(instance)
+	if err := m.startEntryFront(ctx, oldCfg); err != nil {
+		m.logger.Errorf("rollback failed to start TLS entry: %v", err)
+	}
+	m.restoreBlacklist(oldCfg)
 	// Sync config pointer to monitor server after rollback
 	if m.monitorServer != nil {
 		m.monitorServer.SetConfig(m.cfg)
@@ -311,12 +508,76 @@ func (m *Manager) rollbackToOldConfig(ctx context.Context, oldCfg *config.Config
 	m.logger.Infof("rollback successful")
 }
 
+// Shutdown stops accepting new connections, waits until in-flight pool
+// connections finish or ctx expires, then closes everything via Close.
+// Reloads, node file edits and lazy listener activations are refused from
+// the start, so no listener opens again while connections drain.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.shuttingDown = true
+	if m.stopWatch != nil {
+		m.stopWatch()
+		m.stopWatch = nil
+	}
+	// Stop retrying failed binds before the bound listeners are closed.
+	m.listeners.close()
+	if m.currentBox != nil {
+		inbounds := m.currentBox.Inbound()
+		for _, inbound := range inbounds.Inbounds() {
+			if err := inbounds.Remove(inbound.Tag()); err != nil {
+				m.logger.Warnf("close inbound %s: %v", inbound.Tag(), err)
+			}
+		}
+	}
+	if m.geoRouter != nil {
+		m.geoRouter.Stop()
+		m.geoRouter = nil
+	}
+	m.entryFront.close()
+	m.entryFront = nil
+	m.mu.Unlock()
+
+	m.waitForDrain(ctx)
+	return m.Close()
+}
+
+// waitForDrain blocks until no pool connection is open or ctx is done.
+func (m *Manager) waitForDrain(ctx context.Context) {
+	open := pool.OpenConnections()
+	if open <= 0 {
+		return
+	}
+	m.logger.Infof("listeners closed, waiting for %d in-flight connection(s) to finish", open)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	lastLog := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Warnf("shutdown timeout exceeded, closing %d remaining connection(s)", pool.OpenConnections())
+			return
+		case <-ticker.C:
+		}
+		open = pool.OpenConnections()
+		if open <= 0 {
+			m.logger.Infof("all connections drained")
+			return
+		}
+		if time.Since(lastLog) >= 5*time.Second {
+			m.logger.Infof("still waiting for %d connection(s)", open)
+			lastLog = time.Now()
+		}
+	}
+}
+
 // Close terminates the active instance and auxiliary components.
 func (m *Manager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	var err error
+	m.listeners.close()
+	defer accesslog.Close()
 	if m.currentBox != nil {
 		err = m.currentBox.Close()
 		m.currentBox = nil
@@ -325,6 +586,8 @@ func (m *Manager) Close() error {
 		m.monitorServer.Shutdown(context.Background())
 		m.monitorServer = nil
 	}
+	m.statusPage.Shutdown(context.Background())
+	m.statusPage = nil
 	if m.monitorMgr != nil {
 		m.monitorMgr.Stop()
 		m.monitorMgr = nil
@@ -334,6 +597,8 @@ func (m *Manager) Close() error {
 		m.geoRouter.Stop()
 		m.geoRouter = nil
 	}
+	m.entryFront.close()
+	m.entryFront = nil
 	m.baseCtx = nil
 	return err
 }
@@ -379,11 +644,17 @@ func (m *Manager) startGeoIPRouter(ctx context.Context, cfg *config.Config) {
 		geoipListen = cfg.Listener.Address
 	}
 
+	limits := cfg.Resources()
 	routerCfg := geoip.RouterConfig{
-		Listen:   geoipListen,
-		Port:     geoipPort,
-		Username: cfg.Listener.Username,
-		Password: cfg.Listener.Password,
+		Listen:              geoipListen,
+		Port:                geoipPort,
+		Users:               listenerCredentials(cfg),
+		Freebind:            cfg.GeoIP.Freebind,
+		BufferSize:          limits.CopyBufferSize,
+		MaxIdleConns:        limits.MaxIdleConns,
+		MaxIdleConnsPerHost: limits.MaxIdleConnsPerHost,
+		Headers:             httpRewriteRules(cfg),
+		ErrorDetail:         cfg.Listener.ErrorDetail,
 	}
 
 	router := geoip.NewRouter(routerCfg, nil)
@@ -442,6 +713,13 @@ func (m *Manager) createBox(ctx context.Context, cfg *config.Config) (*box.Box,
 	if err != nil {
 		return nil, fmt.Errorf("build sing-box options: %w", err)
 	}
+	users.Configure(userLimits(cfg))
+	users.ConfigureClients(clientLimits(cfg))
+	if err := accesslog.Configure(accessLogConfig(cfg)); err != nil {
+		log.Printf("⚠️  Access log disabled: %v", err)
+	}
+	allInbounds := slices.Clone(opts.Inbounds)
+	deferred := splitDeferredInbounds(cfg, &opts)
 
 	maxRetries := len(cfg.Nodes)*3 + 50 // Dynamically scale retries to configuration size
 	outboundErrRe := regexp.MustCompile(`initialize outbound\[(\d+)\]`)
@@ -450,6 +728,8 @@ func (m *Manager) createBox(ctx context.Context, cfg *config.Config) (*box.Box,
 		inboundRegistry := include.InboundRegistry()
 		outboundRegistry := include.OutboundRegistry()
 		pool.Register(outboundRegistry)
+		pluginout.Register(outboundRegistry)
+		lazyout.Register(outboundRegistry)
 		endpointRegistry := include.EndpointRegistry()
 		dnsRegistry := include.DNSTransportRegistry()
 		serviceRegistry := include.ServiceRegistry()
@@ -462,6 +742,12 @@ func (m *Manager) createBox(ctx context.Context, cfg *config.Config) (*box.Box,
 			if attempt > 0 {
 				log.Printf("✅ sing-box instance created after removing %d invalid outbound(s)", attempt)
 			}
+			m.listeners.reset(instance, boxCtx, deferred, cfg.MultiPort.Lazy, cfg.MultiPort.IdleTimeout)
+			running := opts
+			running.Inbounds = allInbounds
+			m.mu.Lock()
+			m.running = &running
+			m.mu.Unlock()
 			return instance, nil
 		}
 
@@ -652,11 +938,14 @@ func (m *Manager) ensureMonitor(ctx context.Context) error {
 		}
 		// Note: StartPeriodicHealthCheck is called after nodes are registered in Start()
 	}
+	m.statusPage = monitor.NewStatusPage(m.monitorCfg.StatusPage, monitorMgr, log.Default())
+	statusPage := m.statusPage
 	m.mu.Unlock()
 
 	if serverToStart != nil {
 		serverToStart.Start(ctx)
 	}
+	statusPage.Start(ctx)
 	return nil
 }
 
@@ -707,7 +996,10 @@ func (a monitorLoggerAdapter) Warn(args ...any) {
 
 // --- NodeManager interface implementation ---
 
-var errConfigUnavailable = errors.New("config is not initialized")
+var (
+	errConfigUnavailable = errors.New("config is not initialized")
+	errShuttingDown      = errors.New("shutting down")
+)
 
 // ListConfigNodes returns a copy of all configured nodes.
 func (m *Manager) ListConfigNodes(ctx context.Context) ([]config.NodeConfig, error) {
@@ -776,6 +1068,9 @@ func (m *Manager) UpdateNode(ctx context.Context, name string, node config.NodeC
 	if idx == -1 {
 		return config.NodeConfig{}, monitor.ErrNodeNotFound
 	}
+	if from := m.cfg.Nodes[idx].ExpandedFrom; from != "" {
+		return config.NodeConfig{}, fmt.Errorf("%w: %s", monitor.ErrNodeGenerated, from)
+	}
 
 	normalized, err := m.prepareNodeLocked(node, name)
 	if err != nil {
@@ -814,6 +1109,9 @@ func (m *Manager) DeleteNode(ctx context.Context, name string) error {
 	if idx == -1 {
 		return monitor.ErrNodeNotFound
 	}
+	if from := m.cfg.Nodes[idx].ExpandedFrom; from != "" {
+		return fmt.Errorf("%w: %s", monitor.ErrNodeGenerated, from)
+	}
 
 	backup := cloneNodes(m.cfg.Nodes)
 	m.cfg.Nodes = append(m.cfg.Nodes[:idx], m.cfg.Nodes[idx+1:]...)
@@ -845,6 +1143,10 @@ func (m *Manager) TriggerReload(ctx context.Context) error {
 
 // ReloadWithPortMap gracefully switches to a new configuration, preserving port assignments.
 func (m *Manager) ReloadWithPortMap(newCfg *config.Config, portMap map[string]uint16) error {
+	return m.reloadWithPortMap(newCfg, portMap, nil)
+}
+
+func (m *Manager) reloadWithPortMap(newCfg *config.Config, portMap map[string]uint16, retain map[string]bool) error {
 	if newCfg == nil {
 		return errors.New("new config is nil")
 	}
@@ -857,7 +1159,7 @@ func (m *Manager) ReloadWithPortMap(newCfg *config.Config, portMap map[string]ui
 		return fmt.Errorf("normalize config with port map: %w", err)
 	}
 
-	if err := m.Reload(newCfg); err != nil {
+	if err := m.reload(newCfg, retain); err != nil {
 		return err
 	}
 
@@ -0,0 +1,196 @@
+package boxmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"easy_proxies/internal/config"
+)
+
+// nodesFilePollInterval is how often nodes_file is checked for edits. Polling
+// (rather than inotify) also works for files bind-mounted into containers.
+const nodesFilePollInterval = 5 * time.Second
+
+// nodeDiff describes how a node list changed. Nodes are matched by
+// NodeKey, so renaming a node or reordering its query string is not a change.
+type nodeDiff struct {
+	Added     []config.NodeConfig
+	Removed   []config.NodeConfig
+	Unchanged []config.NodeConfig // taken from the old list, names and ports intact
+}
+
+func (d nodeDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// diffNodes compares two node lists by NodeKey. Duplicate keys are matched
+// one-to-one so a node listed twice is handled like any other node.
+func diffNodes(oldNodes, newNodes []config.NodeConfig) nodeDiff {
+	remaining := make(map[string]int, len(newNodes))
+	for _, node := range newNodes {
+		remaining[node.NodeKey()]++
+	}
+
+	var diff nodeDiff
+	for _, node := range oldNodes {
+		key := node.NodeKey()
+		if remaining[key] > 0 {
+			remaining[key]--
+			diff.Unchanged = append(diff.Unchanged, node)
+			continue
+		}
+		diff.Removed = append(diff.Removed, node)
+	}
+	for _, node := range newNodes {
+		key := node.NodeKey()
+		if remaining[key] > 0 {
+			remaining[key]--
+			diff.Added = append(diff.Added, node)
+		}
+	}
+	return diff
+}
+
+// watchNodesFile polls path and applies edits to the running pool until ctx
+// is cancelled.
+func (m *Manager) watchNodesFile(ctx context.Context, path string) {
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(path); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+
+	ticker := time.NewTicker(nodesFilePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+		if err := m.applyNodesFile(path); err != nil {
+			m.logger.Warnf("nodes_file reload failed: %v", err)
+		}
+	}
+}
+
+// applyNodesFile re-reads nodes_file and applies only the added and removed
+// nodes. Unchanged nodes keep their name, port and health/blacklist state,
+// and, when the change can be made in place, their open connections.
+func (m *Manager) applyNodesFile(path string) error {
+	fileNodes, err := config.LoadNodesFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	// The file is readable again: leave the degraded mode a startup from the
+	// node snapshot put us in, even if the nodes did not change.
+	m.mu.Lock()
+	recovered := m.cfg != nil && m.cfg.Degraded() != ""
+	if recovered {
+		m.cfg.ClearDegraded()
+	}
+	m.mu.Unlock()
+	if recovered {
+		m.logger.Infof("nodes_file %s is readable again, leaving degraded mode", path)
+	}
+
+	m.mu.RLock()
+	cfgCopy := m.copyConfigLocked()
+	var portMap map[string]uint16
+	if m.cfg != nil {
+		portMap = m.cfg.BuildPortMap()
+	}
+	m.mu.RUnlock()
+	if cfgCopy == nil {
+		return errConfigUnavailable
+	}
+
+	var otherNodes, currentFileNodes []config.NodeConfig
+	for _, node := range cfgCopy.Nodes {
+		if node.Source == config.NodeSourceFile {
+			currentFileNodes = append(currentFileNodes, node)
+		} else {
+			otherNodes = append(otherNodes, node)
+		}
+	}
+
+	diff := diffNodes(currentFileNodes, fileNodes)
+	if recovered || !diff.empty() {
+		cfgCopy.SaveNodeSnapshot(fileNodes)
+	}
+	if diff.empty() {
+		return nil
+	}
+	m.logger.Infof("nodes_file changed: +%d -%d (%d unchanged)", len(diff.Added), len(diff.Removed), len(diff.Unchanged))
+
+	nodes := make([]config.NodeConfig, 0, len(otherNodes)+len(diff.Unchanged)+len(diff.Added))
+	nodes = append(nodes, otherNodes...)
+	nodes = append(nodes, diff.Unchanged...)
+	nodes = append(nodes, diff.Added...)
+	cfgCopy.Nodes = nodes
+	retain := m.retainedTags(nodes)
+
+	// Apply the change to the running instance when possible; anything it
+	// cannot take in place, such as a route rule for a new per-node
+	// listener, falls back to a rebuild.
+	if err := cfgCopy.NormalizeWithPortMap(portMap); err != nil {
+		return fmt.Errorf("normalize config with port map: %w", err)
+	}
+	applied, err := m.applyLive(cfgCopy)
+	if applied {
+		if err := cfgCopy.SaveNodePortMap(); err != nil {
+			m.logger.Warnf("failed to persist node ports: %v", err)
+		}
+		return nil
+	}
+	if errors.Is(err, errShuttingDown) {
+		return err
+	}
+	if err != nil {
+		m.logger.Warnf("applying nodes_file in place failed, rebuilding: %v", err)
+	}
+	return m.reloadWithPortMap(cfgCopy, portMap, retain)
+}
+
+// Degraded reports why the running nodes came from the node snapshot
+// rather than nodes_file or the subscriptions, or "" when they are current.
+func (m *Manager) Degraded() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cfg == nil {
+		return ""
+	}
+	return m.cfg.Degraded()
+}
+
+// retainedTags returns the monitor tags whose node is still present in nodes
+// under the same name, i.e. whose state can safely carry over a rebuild.
+func (m *Manager) retainedTags(nodes []config.NodeConfig) map[string]bool {
+	if m.monitorMgr == nil {
+		return map[string]bool{}
+	}
+	present := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		present[node.Name+"\x00"+node.NodeKey()] = true
+	}
+	keep := make(map[string]bool, len(nodes))
+	for _, snap := range m.monitorMgr.Snapshot() {
+		node := config.NodeConfig{URI: snap.URI}
+		if present[snap.Name+"\x00"+node.NodeKey()] {
+			keep[snap.Tag] = true
+		}
+	}
+	return keep
+}
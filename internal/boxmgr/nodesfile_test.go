@@ -0,0 +1,43 @@
+package boxmgr
+
+import (
+	"testing"
+
+	"easy_proxies/internal/config"
+)
+
+func TestDiffNodes(t *testing.T) {
+	oldNodes := []config.NodeConfig{
+		{Name: "a", URI: "trojan://pw@a.example.com:443?sni=a&alpn=h2#a", Port: 24000},
+		{Name: "b", URI: "trojan://pw@b.example.com:443#b", Port: 24001},
+		{Name: "c", URI: "trojan://pw@c.example.com:443#c", Port: 24002},
+	}
+	newNodes := []config.NodeConfig{
+		// Same server with a new display name and reordered query: unchanged.
+		{Name: "a-renamed", URI: "trojan://pw@a.example.com:443?alpn=h2&sni=a#a-renamed"},
+		{Name: "c", URI: "trojan://pw@c.example.com:443#c"},
+		{Name: "d", URI: "trojan://pw@d.example.com:443#d"},
+	}
+
+	diff := diffNodes(oldNodes, newNodes)
+	if len(diff.Unchanged) != 2 || diff.Unchanged[0].Name != "a" || diff.Unchanged[0].Port != 24000 || diff.Unchanged[1].Name != "c" {
+		t.Fatalf("unexpected unchanged set: %+v", diff.Unchanged)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "b" {
+		t.Fatalf("unexpected removed set: %+v", diff.Removed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Name != "d" {
+		t.Fatalf("unexpected added set: %+v", diff.Added)
+	}
+}
+
+func TestDiffNodes_DuplicatesMatchedOneToOne(t *testing.T) {
+	node := config.NodeConfig{Name: "dup", URI: "trojan://pw@dup.example.com:443#dup"}
+	diff := diffNodes([]config.NodeConfig{node}, []config.NodeConfig{node, node})
+	if len(diff.Unchanged) != 1 || len(diff.Added) != 1 || len(diff.Removed) != 0 {
+		t.Fatalf("expected 1 unchanged + 1 added, got %+v", diff)
+	}
+	if !diffNodes([]config.NodeConfig{node}, []config.NodeConfig{node}).empty() {
+		t.Fatalf("identical lists should produce an empty diff")
+	}
+}
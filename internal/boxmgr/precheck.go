@@ -0,0 +1,21 @@
+package boxmgr
+
+import (
+	"easy_proxies/internal/builder"
+	"easy_proxies/internal/monitor"
+	"easy_proxies/internal/outbound/pool"
+)
+
+// PredictRoute tells which node the pool or sticky entry would pick for a
+// connection, for /api/precheck.
+func (m *Manager) PredictRoute(q monitor.RouteQuery) (monitor.RoutePrediction, error) {
+	tag := pool.Tag
+	if q.Entry == monitor.EntrySticky {
+		tag = builder.StickyPoolTag
+	}
+	prediction, err := pool.Predict(tag, q.Network, q.Client, q.User, q.Pin)
+	if err != nil {
+		return monitor.RoutePrediction{}, err
+	}
+	return monitor.RoutePrediction{Node: prediction.Member, Candidates: prediction.Candidates}, nil
+}
@@ -0,0 +1,68 @@
+package boxmgr
+
+import (
+	"easy_proxies/internal/accesslog"
+	"easy_proxies/internal/builder"
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/users"
+)
+
+// listenerCredentials maps every pool-entry username to its password.
+func listenerCredentials(cfg *config.Config) map[string]string {
+	accounts := cfg.ListenerUsers()
+	if len(accounts) == 0 {
+		return nil
+	}
+	creds := make(map[string]string, len(accounts))
+	for _, u := range accounts {
+		creds[u.Username] = u.Password
+	}
+	return creds
+}
+
+// userLimits converts listener.users, with their tiers, into the limits
+// enforced by the pool.
+func userLimits(cfg *config.Config) map[string]users.Limits {
+	limits := make(map[string]users.Limits, len(cfg.Listener.Users))
+	for _, u := range cfg.Listener.Users {
+		u = cfg.UserLimits(u)
+		limits[u.Username] = users.Limits{
+			RateLimit:      u.RateLimitKBps * 1024,
+			MaxConnections: u.MaxConnections,
+			Quota:          u.QuotaMB * 1024 * 1024,
+			Tier:           u.Tier,
+			Groups:         cfg.Listener.Tiers[u.Tier].Groups,
+		}
+	}
+	return limits
+}
+
+// clientLimits converts the listener connection caps, which apply to the
+// pool and sticky entries.
+func clientLimits(cfg *config.Config) users.ClientLimits {
+	return users.ClientLimits{
+		Inbounds:     []string{builder.PoolInboundTag, builder.StickyInboundTag},
+		MaxPerIP:     cfg.MaxConnsPerIP(),
+		NewPerSecond: cfg.Listener.MaxNewConnsPerSec,
+	}
+}
+
+// accessLogConfig converts the access_log section; a disabled section turns
+// the access log file off but keeps the in-memory history.
+func accessLogConfig(cfg *config.Config) accesslog.Config {
+	a := cfg.AccessLog
+	if !a.Enabled {
+		return accesslog.Config{History: a.History, Tags: a.Tags}
+	}
+	return accesslog.Config{
+		File:           a.File,
+		Format:         a.LogFormat,
+		MaxSize:        a.MaxSize,
+		RotateInterval: a.RotateInterval,
+		MaxBackups:     a.MaxBackups,
+		MaxAge:         a.MaxAge,
+		Compress:       a.Compress,
+		History:        a.History,
+		Tags:           a.Tags,
+	}
+}
@@ -0,0 +1,28 @@
+package builder
+
+import (
+	"fmt"
+	"testing"
+
+	"easy_proxies/internal/config"
+)
+
+func TestListenerAuthUsersBounded(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Listener.NodePinning = true
+	for i := range 3 {
+		cfg.Listener.Users = append(cfg.Listener.Users, config.UserConfig{Username: fmt.Sprintf("u%d", i), Password: "p"})
+	}
+	cfg.Nodes = []config.NodeConfig{{Name: "a", Group: "jp"}, {Name: "b", Group: "JP"}, {Name: "c", Disabled: true}}
+	if got := len(listenerAuthUsers(cfg)); got != 3*(1+2+1) {
+		t.Fatalf("got %d usernames, want each account plain, per node and per group", got)
+	}
+
+	// Past the bound node pins are dropped before group pins.
+	for i := range maxPinnedUsernames / 3 {
+		cfg.Nodes = append(cfg.Nodes, config.NodeConfig{Name: fmt.Sprintf("n%d", i), Group: "jp"})
+	}
+	if got := len(listenerAuthUsers(cfg)); got != 3*(1+1) {
+		t.Fatalf("got %d usernames, want only group pins past the bound", got)
+	}
+}
@@ -8,15 +8,22 @@ import (
 	"log"
 	"net/netip"
 	"net/url"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"easy_proxies/internal/config"
 	"easy_proxies/internal/geoip"
+	"easy_proxies/internal/handoff"
+	"easy_proxies/internal/outbound/lazyout"
+	"easy_proxies/internal/outbound/pluginout"
 	poolout "easy_proxies/internal/outbound/pool"
+	"easy_proxies/internal/plugin"
 	"easy_proxies/internal/ssuri"
+	"easy_proxies/internal/users"
 
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/option"
@@ -59,14 +66,14 @@ func Build(cfg *config.Config) (option.Options, error) {
 		regionMembers[region] = []string{}
 	}
 
-	totalNodes := len(cfg.Nodes)
+	// Assign tags up front (uniqueness depends on order), then parse the
+	// nodes concurrently; results are consumed in config order. The tag is
+	// the node's ASCII ID, which normalize already made unique.
+	tags := make([]string, len(cfg.Nodes))
 	for i, node := range cfg.Nodes {
-		if i > 0 && i%1000 == 0 {
-			log.Printf("⏳ Building nodes... %d/%d", i, totalNodes)
-		}
-		baseTag := sanitizeTag(node.Name)
+		baseTag := node.ID
 		if baseTag == "" {
-			baseTag = fmt.Sprintf("node-%d", len(memberTags)+1)
+			baseTag = fmt.Sprintf("node-%d", i+1)
 		}
 
 		// Ensure tag uniqueness by appending a counter if needed
@@ -77,20 +84,77 @@ func Build(cfg *config.Config) (option.Options, error) {
 		} else {
 			usedTags[baseTag] = 1
 		}
+		tags[i] = tag
+	}
 
-		outbound, err := buildNodeOutbound(tag, node.URI, cfg.SkipCertVerify)
-		if err != nil {
-			log.Printf("❌ Failed to build node '%s': %v (skipping)", node.Name, err)
+	groupMembers := make(map[string][]string)
+	nodeGroups := make(map[string]string)   // tag -> group, for multi_port.group_by: group
+	countryCodes := make(map[string]string) // tag -> ISO country code, from GeoIP
+	var chainOutbounds []option.Outbound
+	// via may name a node by its unique name or, for nodes whose name was
+	// disambiguated, by the name as configured (first such node wins).
+	nodesByName := make(map[string]config.NodeConfig, len(cfg.Nodes))
+	for _, node := range cfg.Nodes {
+		if _, exists := nodesByName[node.Name]; !exists {
+			nodesByName[node.Name] = node
+		}
+	}
+	for _, node := range cfg.Nodes {
+		if _, exists := nodesByName[node.DisplayName]; !exists && node.DisplayName != "" {
+			nodesByName[node.DisplayName] = node
+		}
+	}
+	built := buildNodeOutbounds(cfg, tags)
+	for i, node := range cfg.Nodes {
+		tag := tags[i]
+		if node.Disabled {
+			continue
+		}
+		if built[i].err == nil && len(node.Via) > 0 {
+			// Chain through the via hops before the node's own server.
+			var uris []string
+			uris, built[i].err = chainURIs(node, nodesByName, map[string]bool{})
+			if built[i].err == nil {
+				var hops []option.Outbound
+				hops, built[i].err = buildChain(tag, &built[i].outbound, uris, cfg.SkipCertVerify, node.AllowPlaintext)
+				if built[i].err == nil && len(hops) > 0 {
+					// Only the first hop dials out of this host.
+					iface, bindAddress := cfg.NodeBind(node)
+					built[i].err = setBind(&hops[0], iface, bindAddress)
+				}
+				if built[i].err == nil {
+					chainOutbounds = append(chainOutbounds, hops...)
+				}
+			}
+		} else if built[i].err == nil && built[i].outbound.Type != lazyout.Type {
+			// Lazy nodes carry their bind and apply it when parsed.
+			iface, bindAddress := cfg.NodeBind(node)
+			if built[i].outbound.Type == pluginout.Type {
+				// Plugins dial on their own; only an explicit setting is an error.
+				iface, bindAddress = node.Interface, node.BindAddress
+			}
+			built[i].err = setBind(&built[i].outbound, iface, bindAddress)
+		}
+		if built[i].err != nil {
+			log.Printf("❌ Failed to build node '%s': %v (skipping)", node.Name, built[i].err)
 			failedNodes = append(failedNodes, node.Name)
 			continue
 		}
 		memberTags = append(memberTags, tag)
-		baseOutbounds = append(baseOutbounds, outbound)
+		baseOutbounds = append(baseOutbounds, built[i].outbound)
 		meta := poolout.MemberMeta{
-			Name: node.Name,
-			URI:  node.URI,
-			Mode: cfg.Mode,
-		}
+			Name:        node.Name,
+			DisplayName: node.DisplayName,
+			URI:         node.URI,
+			Mode:        cfg.Mode,
+			Weight:      node.Weight,
+			MaxConns:    node.MaxConns,
+			Standby:     node.Standby,
+		}
+		if node.Cost != nil {
+			meta.CostPerGB, meta.CostPerHour = node.Cost.PerGB, node.Cost.PerHour
+		}
+		meta.ResolveLocal = cfg.DNS.ResolveLocally(node.Group)
 		// For multi-port and hybrid modes, use per-node port
 		if cfg.Mode == "multi-port" || cfg.Mode == "hybrid" {
 			meta.ListenAddress = cfg.MultiPort.Address
@@ -104,6 +168,15 @@ func Build(cfg *config.Config) (option.Options, error) {
 		meta.Region = geoip.RegionOther
 		meta.Country = "Unknown"
 
+		if group := strings.ToLower(strings.TrimSpace(node.Group)); group != "" {
+			groupMembers[group] = append(groupMembers[group], tag)
+			nodeGroups[tag] = group
+			meta.Group = group
+			if gc, ok := cfg.Pool.Groups[group]; ok {
+				meta.FailureThreshold = gc.FailureThreshold
+				meta.BlacklistDuration = gc.BlacklistDuration
+			}
+		}
 		metadata[tag] = meta
 	}
 
@@ -121,8 +194,8 @@ func Build(cfg *config.Config) (option.Options, error) {
 		results := make(chan geoResult, len(memberTags))
 		var wg sync.WaitGroup
 
-		// Worker pool: min(32, len(memberTags))
-		workerCount := 32
+		// Worker pool: min(profile GeoIP workers, len(memberTags))
+		workerCount := cfg.Resources().GeoIPWorkers
 		if len(memberTags) < workerCount {
 			workerCount = len(memberTags)
 		}
@@ -166,6 +239,7 @@ func Build(cfg *config.Config) (option.Options, error) {
 			meta.Region = res.region.Code
 			meta.Country = res.region.Country
 			metadata[res.tag] = meta
+			countryCodes[res.tag] = strings.ToLower(res.region.ISOCode)
 			regionMembers[res.region.Code] = append(regionMembers[res.region.Code], res.tag)
 		}
 
@@ -213,6 +287,7 @@ func Build(cfg *config.Config) (option.Options, error) {
 		route     option.RouteOptions
 	)
 	copy(outbounds, baseOutbounds)
+	outbounds = append(outbounds, chainOutbounds...)
 
 	// Determine which components to enable based on mode
 	enablePoolInbound := cfg.Mode == "pool" || cfg.Mode == "hybrid"
@@ -229,15 +304,7 @@ func Build(cfg *config.Config) (option.Options, error) {
 			return option.Options{}, err
 		}
 		inbounds = append(inbounds, inbound)
-		poolOptions := poolout.Options{
-			Mode:              cfg.Pool.Mode,
-			Members:           memberTags,
-			FailureThreshold:  cfg.Pool.FailureThreshold,
-			BlacklistDuration: cfg.Pool.BlacklistDuration,
-			RetryEnabled:      cfg.Pool.RetryEnabledOrDefault(),
-			RetryAttempts:     cfg.Pool.RetryAttempts,
-			Metadata:          metadata,
-		}
+		poolOptions := poolOptionsFor(cfg, cfg.Pool.Mode, memberTags, metadata)
 		outbounds = append(outbounds, option.Outbound{
 			Type:    poolout.Type,
 			Tag:     poolout.Tag,
@@ -248,23 +315,14 @@ func Build(cfg *config.Config) (option.Options, error) {
 		// Build dedicated sticky entry: same node pool, but clients are pinned
 		// to a single node by source IP. Coexists with the non-sticky entry.
 		if cfg.Sticky.Enabled {
-			const stickyInboundTag = "sticky-in"
-			stickyOutboundTag := poolout.Tag + "-sticky"
+			stickyOutboundTag := StickyPoolTag
 			stickyInbound, err := buildStickyInbound(cfg)
 			if err != nil {
 				return option.Options{}, err
 			}
 			inbounds = append(inbounds, stickyInbound)
-			stickyOptions := poolout.Options{
-				Mode:              cfg.Pool.Mode,
-				Members:           memberTags,
-				FailureThreshold:  cfg.Pool.FailureThreshold,
-				BlacklistDuration: cfg.Pool.BlacklistDuration,
-				RetryEnabled:      cfg.Pool.RetryEnabledOrDefault(),
-				RetryAttempts:     cfg.Pool.RetryAttempts,
-				Metadata:          metadata,
-				Sticky:            true,
-			}
+			stickyOptions := poolOptionsFor(cfg, cfg.Pool.Mode, memberTags, metadata)
+			stickyOptions.Sticky = true
 			outbounds = append(outbounds, option.Outbound{
 				Type:    poolout.Type,
 				Tag:     stickyOutboundTag,
@@ -274,7 +332,7 @@ func Build(cfg *config.Config) (option.Options, error) {
 				Type: C.RuleTypeDefault,
 				DefaultOptions: option.DefaultRule{
 					RawDefaultRule: option.RawDefaultRule{
-						Inbound: badoption.Listable[string]{stickyInboundTag},
+						Inbound: badoption.Listable[string]{StickyInboundTag},
 					},
 					RuleAction: option.RuleAction{
 						Action: C.RuleActionTypeRoute,
@@ -287,8 +345,50 @@ func Build(cfg *config.Config) (option.Options, error) {
 		}
 	}
 
-	// Build multi-port inbounds (one port per node)
-	if enableMultiPort {
+	// Capture system traffic with a TUN device and send it through the pool.
+	if enablePoolInbound && cfg.TUN.Enabled {
+		tunInbound, err := buildTUNInbound(cfg)
+		if err != nil {
+			return option.Options{}, err
+		}
+		inbounds = append(inbounds, tunInbound)
+		route.Rules = append(route.Rules, tunRules(cfg.TUN.SplitTunnelConfig)...)
+		// Node outbounds must bypass the TUN routes to avoid a loop.
+		route.AutoDetectInterface = cfg.TUN.AutoRouteOrDefault()
+	}
+
+	// Accept LAN traffic redirected by iptables/nftables on a gateway.
+	if enablePoolInbound && cfg.Transparent.Enabled {
+		transparentInbound, err := buildTransparentInbound(cfg)
+		if err != nil {
+			return option.Options{}, err
+		}
+		inbounds = append(inbounds, transparentInbound)
+		route.Rules = append(route.Rules, transparentRules()...)
+		// Marked outbound connections are skipped by the firewall rules,
+		// so locally generated redirects do not loop back into the pool.
+		route.DefaultMark = option.FwMark(cfg.Transparent.RoutingMark)
+	}
+
+	// Build multi-port inbounds (one port per node, or per node group)
+	if enableMultiPort && cfg.MultiPort.GroupBy != config.MultiPortByNode {
+		var keyOf func(tag string) string
+		switch cfg.MultiPort.GroupBy {
+		case config.MultiPortByCountry:
+			keyOf = func(tag string) string { return countryCodes[tag] }
+		case config.MultiPortByRegion:
+			keyOf = func(tag string) string { return metadata[tag].Region }
+		default:
+			keyOf = func(tag string) string { return nodeGroups[tag] }
+		}
+		groupInbounds, groupOutbounds, groupRules, err := buildMultiPortGroups(cfg, memberTags, metadata, keyOf)
+		if err != nil {
+			return option.Options{}, err
+		}
+		inbounds = append(inbounds, groupInbounds...)
+		outbounds = append(outbounds, groupOutbounds...)
+		route.Rules = append(route.Rules, groupRules...)
+	} else if enableMultiPort {
 		addr, err := parseAddr(cfg.MultiPort.Address)
 		if err != nil {
 			return option.Options{}, fmt.Errorf("parse multi-port address: %w", err)
@@ -297,56 +397,21 @@ func Build(cfg *config.Config) (option.Options, error) {
 			meta := metadata[tag]
 			perMeta := map[string]poolout.MemberMeta{tag: meta}
 			poolTag := fmt.Sprintf("%s-%s", poolout.Tag, tag)
-			perOptions := poolout.Options{
-				Mode:              "sequential",
-				Members:           []string{tag},
-				FailureThreshold:  cfg.Pool.FailureThreshold,
-				BlacklistDuration: cfg.Pool.BlacklistDuration,
-				RetryEnabled:      cfg.Pool.RetryEnabledOrDefault(),
-				RetryAttempts:     cfg.Pool.RetryAttempts,
-				Metadata:          perMeta,
-			}
+			perOptions := poolOptionsFor(cfg, "sequential", []string{tag}, perMeta)
 			perPool := option.Outbound{
 				Type:    poolout.Type,
 				Tag:     poolTag,
 				Options: &perOptions,
 			}
 			outbounds = append(outbounds, perPool)
-			inboundOptions := &option.HTTPMixedInboundOptions{
-				ListenOptions: option.ListenOptions{
-					Listen:     addr,
-					ListenPort: meta.Port,
-				},
-			}
-			username := cfg.MultiPort.Username
-			password := cfg.MultiPort.Password
-			if username != "" {
-				inboundOptions.Users = []auth.User{{Username: username, Password: password}}
-			}
-			inboundTag := fmt.Sprintf("in-%s", tag)
-			inbounds = append(inbounds, option.Inbound{
-				Type:    C.TypeMixed,
-				Tag:     inboundTag,
-				Options: inboundOptions,
-			})
-			route.Rules = append(route.Rules, option.Rule{
-				Type: C.RuleTypeDefault,
-				DefaultOptions: option.DefaultRule{
-					RawDefaultRule: option.RawDefaultRule{
-						Inbound: badoption.Listable[string]{inboundTag},
-					},
-					RuleAction: option.RuleAction{
-						Action: C.RuleActionTypeRoute,
-						RouteOptions: option.RouteActionOptions{
-							Outbound: poolTag,
-						},
-					},
-				},
-			})
+			inbound, rule := multiPortEntry(cfg, addr, NodeInboundTag(tag), meta.Port, poolTag)
+			inbounds = append(inbounds, inbound)
+			route.Rules = append(route.Rules, rule)
 		}
 	}
 
 	// Build GeoIP region-based pool outbounds and routing
+	regionPools := make(map[string]string)
 	if cfg.GeoIP.Enabled && enablePoolInbound {
 		// Create pool outbound for each region that has nodes
 		for _, region := range geoip.AllRegions() {
@@ -362,20 +427,13 @@ func Build(cfg *config.Config) (option.Options, error) {
 			}
 
 			regionPoolTag := fmt.Sprintf("pool-%s", region)
-			regionPoolOptions := poolout.Options{
-				Mode:              cfg.Pool.Mode,
-				Members:           members,
-				FailureThreshold:  cfg.Pool.FailureThreshold,
-				BlacklistDuration: cfg.Pool.BlacklistDuration,
-				RetryEnabled:      cfg.Pool.RetryEnabledOrDefault(),
-				RetryAttempts:     cfg.Pool.RetryAttempts,
-				Metadata:          regionMeta,
-			}
+			regionPoolOptions := poolOptionsFor(cfg, cfg.Pool.Mode, members, regionMeta)
 			outbounds = append(outbounds, option.Outbound{
 				Type:    poolout.Type,
 				Tag:     regionPoolTag,
 				Options: &regionPoolOptions,
 			})
+			regionPools[region] = regionPoolTag
 		}
 
 		// Log GeoIP routing info
@@ -393,8 +451,28 @@ func Build(cfg *config.Config) (option.Options, error) {
 		log.Println("   Default (no path): all nodes pool")
 	}
 
+	// Destination-based routing rules for the shared pool entry
+	if len(cfg.Rules) > 0 {
+		if !enablePoolInbound {
+			log.Printf("⚠️  rules are set but mode is %q; rules only apply to the pool entry, ignoring", cfg.Mode)
+		} else {
+			ruleOutbounds, rules, err := buildRoutingRules(cfg, groupMembers, regionPools, metadata)
+			if err != nil {
+				return option.Options{}, err
+			}
+			outbounds = append(outbounds, ruleOutbounds...)
+			route.Rules = append(route.Rules, rules...)
+		}
+	}
+
+	dns, err := buildDNS(cfg)
+	if err != nil {
+		return option.Options{}, err
+	}
+
 	opts := option.Options{
 		Log:       &option.LogOptions{Level: strings.ToLower(cfg.LogLevel)},
+		DNS:       dns,
 		Inbounds:  inbounds,
 		Outbounds: outbounds,
 		Route:     &route,
@@ -407,54 +485,231 @@ func Build(cfg *config.Config) (option.Options, error) {
 	return opts, nil
 }
 
-func buildPoolInbound(cfg *config.Config) (option.Inbound, error) {
-	listenAddr, err := parseAddr(cfg.Listener.Address)
-	if err != nil {
-		return option.Inbound{}, fmt.Errorf("parse listener address: %w", err)
+type nodeBuildResult struct {
+	outbound option.Outbound
+	err      error
+}
+
+// buildNodeOutbounds parses every node URI into an outbound using a worker
+// pool sized by the resource profile, logging progress for large node lists.
+// With pool.lazy_nodes most nodes are left to parse on first dial instead.
+// Results are indexed like cfg.Nodes.
+func buildNodeOutbounds(cfg *config.Config, tags []string) []nodeBuildResult {
+	total := len(cfg.Nodes)
+	results := make([]nodeBuildResult, total)
+	if total == 0 {
+		return results
 	}
-	inboundOptions := &option.HTTPMixedInboundOptions{
-		ListenOptions: option.ListenOptions{
-			Listen:     listenAddr,
-			ListenPort: cfg.Listener.Port,
+
+	workerCount := cfg.Resources().BuildWorkers
+	if workerCount <= 0 {
+		workerCount = runtime.NumCPU()
+	}
+	if workerCount > total {
+		workerCount = total
+	}
+	start := time.Now()
+	if total >= 1000 {
+		log.Printf("⏳ Building %d nodes with %d workers...", total, workerCount)
+	}
+
+	var done atomic.Int64
+	jobs := make(chan int, workerCount)
+	var wg sync.WaitGroup
+	for w := 0; w < workerCount; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var (
+					outbound option.Outbound
+					err      error
+				)
+				if lazy, ok := lazyNodeOutbound(cfg, tags[i], cfg.Nodes[i]); ok {
+					outbound = lazy
+				} else if cfg.Nodes[i].Exec != nil {
+					outbound = execNodeOutbound(tags[i], cfg.Nodes[i])
+				} else {
+					outbound, err = buildNodeOutbound(tags[i], cfg.Nodes[i].URI, cfg.SkipCertVerify)
+					if err == nil && !cfg.Nodes[i].AllowPlaintext {
+						err = checkDowngrade(cfg.Nodes[i].URI, outbound)
+					}
+				}
+				results[i] = nodeBuildResult{outbound: outbound, err: err}
+				if n := done.Add(1); n%1000 == 0 && n < int64(total) {
+					log.Printf("⏳ Building nodes... %d/%d", n, total)
+				}
+			}
+		}()
+	}
+	for i := range cfg.Nodes {
+		if cfg.Nodes[i].Disabled {
+			done.Add(1)
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if total >= 1000 {
+		log.Printf("⏳ Built %d nodes in %.1fs", total, time.Since(start).Seconds())
+	}
+	return results
+}
+
+// poolOptionsFor returns pool outbound options for members using the
+// scheduling, failure and health-check settings from cfg.Pool. Per-group
+// failure settings travel in the member metadata; pool.groups modes apply
+// to requests pinned to a group, and pool.groups SLOs to the group's nodes. Members that resolve hostnames locally use
+// the dns.servers built by buildDNS.
+func poolOptionsFor(cfg *config.Config, mode string, members []string, metadata map[string]poolout.MemberMeta) poolout.Options {
+	var groupModes map[string]string
+	var groupSLOs map[string]poolout.SLOOptions
+	for group, gc := range cfg.Pool.Groups {
+		if gc.SLO != nil {
+			if groupSLOs == nil {
+				groupSLOs = make(map[string]poolout.SLOOptions)
+			}
+			groupSLOs[group] = poolout.SLOOptions{
+				Percentile: gc.SLO.Percentile,
+				Connect:    gc.SLO.Connect,
+				Window:     gc.SLO.Window,
+				MinSamples: gc.SLO.MinSamples,
+				Cooldown:   gc.SLO.Cooldown,
+			}
+		}
+		if gc.Mode == "" {
+			continue
+		}
+		if groupModes == nil {
+			groupModes = make(map[string]string)
+		}
+		groupModes[group] = gc.Mode
+	}
+	return poolout.Options{
+		Mode:              mode,
+		Members:           members,
+		FailureThreshold:  cfg.Pool.FailureThreshold,
+		BlacklistDuration: cfg.Pool.BlacklistDuration,
+		RetryEnabled:      cfg.Pool.RetryEnabledOrDefault(),
+		RetryAttempts:     cfg.Pool.RetryAttempts,
+		MaxConnsPerNode:   cfg.MaxConnsPerNode(),
+		IdleTimeout:       cfg.Pool.IdleTimeout,
+		Metadata:          metadata,
+		GroupModes:        groupModes,
+		DNSServers:        dnsServerTags(cfg),
+		HealthCheck: poolout.HealthCheckOptions{
+			Type:               cfg.Pool.HealthCheck.Type,
+			HealthyThreshold:   cfg.Pool.HealthCheck.HealthyThreshold,
+			UnhealthyThreshold: cfg.Pool.HealthCheck.UnhealthyThreshold,
 		},
+		CircuitBreaker: poolout.CircuitBreakerOptions{
+			Enabled:             cfg.Pool.CircuitBreaker.Enabled,
+			HalfOpenInterval:    cfg.Pool.CircuitBreaker.HalfOpenInterval,
+			MaxHalfOpenInterval: cfg.Pool.CircuitBreaker.MaxHalfOpenInterval,
+		},
+		Seed:             cfg.Pool.Seed,
+		StandbyThreshold: cfg.Pool.StandbyThreshold,
+		GroupSLOs:        groupSLOs,
 	}
-	if cfg.Listener.Username != "" {
-		inboundOptions.Users = []auth.User{{
-			Username: cfg.Listener.Username,
-			Password: cfg.Listener.Password,
-		}}
+}
+
+func buildPoolInbound(cfg *config.Config) (option.Inbound, error) {
+	listenOptions, err := entryListenOptions(cfg, cfg.Listener.Port)
+	if err != nil {
+		return option.Inbound{}, err
 	}
+	inboundOptions := &option.HTTPMixedInboundOptions{ListenOptions: listenOptions}
+	inboundOptions.Users = listenerAuthUsers(cfg)
 	inbound := option.Inbound{
 		Type:    C.TypeMixed,
-		Tag:     "http-in",
+		Tag:     PoolInboundTag,
 		Options: inboundOptions,
 	}
 	return inbound, nil
 }
 
+// entryListenOptions returns where the pool or sticky entry listens. With
+// listener TLS, http_rewrite, method rules or node pinning the public port
+// belongs to the
+// entry front in boxmgr, which hands decrypted and rewritten connections to
+// the inbound, so the inbound itself only binds an ephemeral loopback port.
+func entryListenOptions(cfg *config.Config, port uint16) (option.ListenOptions, error) {
+	address := cfg.Listener.Address
+	if cfg.EntryFront() {
+		address, port = "127.0.0.1", 0
+	}
+	listenAddr, err := parseAddr(address)
+	if err != nil {
+		return option.ListenOptions{}, fmt.Errorf("parse listener address: %w", err)
+	}
+	return option.ListenOptions{Listen: listenAddr, ListenPort: port, ReuseAddr: handoff.Supported()}, nil
+}
+
+// maxPinnedUsernames bounds the usernames listener.node_pinning adds to the
+// entry inbounds, which sing-box keeps in memory (roughly 100 bytes each).
+const maxPinnedUsernames = 100_000
+
+// listenerAuthUsers returns the accounts accepted on the pool and sticky
+// entries, or nil when authentication is disabled. With listener.node_pinning
+// every account is also accepted with a "-node-<name>" or "-group-<group>"
+// suffix, which the pool reads to pin the request. That is one username per
+// account, node and group; past maxPinnedUsernames only the group suffixes
+// are accepted, and past it again none.
+func listenerAuthUsers(cfg *config.Config) []auth.User {
+	accounts := cfg.ListenerUsers()
+	if len(accounts) == 0 {
+		return nil
+	}
+	var pins []users.Pin
+	if cfg.Listener.NodePinning {
+		var nodePins, groupPins []users.Pin
+		groups := make(map[string]bool)
+		for _, node := range cfg.Nodes {
+			if node.Disabled {
+				continue
+			}
+			nodePins = append(nodePins, users.Pin{Node: node.Name})
+			if group := strings.ToLower(strings.TrimSpace(node.Group)); group != "" && !groups[group] {
+				groups[group] = true
+				groupPins = append(groupPins, users.Pin{Group: group})
+			}
+		}
+		pins = append(nodePins, groupPins...)
+		if n := len(accounts) * len(pins); n > maxPinnedUsernames {
+			if len(accounts)*len(groupPins) > maxPinnedUsernames {
+				pins = nil
+				log.Printf("⚠️  listener.node_pinning: %d accounts × %d nodes and groups would add %d usernames (limit %d); pinning is off", len(accounts), len(nodePins)+len(groupPins), n, maxPinnedUsernames)
+			} else {
+				pins = groupPins
+				log.Printf("⚠️  listener.node_pinning: %d accounts × %d nodes and groups would add %d usernames (limit %d); only groups can be pinned", len(accounts), len(nodePins)+len(groupPins), n, maxPinnedUsernames)
+			}
+		}
+	}
+	authUsers := make([]auth.User, 0, len(accounts)*(len(pins)+1))
+	for _, u := range accounts {
+		authUsers = append(authUsers, auth.User{Username: u.Username, Password: u.Password})
+		for _, pin := range pins {
+			authUsers = append(authUsers, auth.User{Username: users.PinnedUsername(u.Username, pin), Password: u.Password})
+		}
+	}
+	return authUsers
+}
+
 // buildStickyInbound builds the dedicated sticky-session entry inbound.
 // It mirrors the pool inbound but listens on the configured sticky port and
 // reuses the listener's address and credentials.
 func buildStickyInbound(cfg *config.Config) (option.Inbound, error) {
-	listenAddr, err := parseAddr(cfg.Listener.Address)
+	listenOptions, err := entryListenOptions(cfg, cfg.Sticky.Port)
 	if err != nil {
-		return option.Inbound{}, fmt.Errorf("parse listener address: %w", err)
-	}
-	inboundOptions := &option.HTTPMixedInboundOptions{
-		ListenOptions: option.ListenOptions{
-			Listen:     listenAddr,
-			ListenPort: cfg.Sticky.Port,
-		},
-	}
-	if cfg.Listener.Username != "" {
-		inboundOptions.Users = []auth.User{{
-			Username: cfg.Listener.Username,
-			Password: cfg.Listener.Password,
-		}}
+		return option.Inbound{}, err
 	}
+	inboundOptions := &option.HTTPMixedInboundOptions{ListenOptions: listenOptions}
+	inboundOptions.Users = listenerAuthUsers(cfg)
 	return option.Inbound{
 		Type:    C.TypeMixed,
-		Tag:     "sticky-in",
+		Tag:     StickyInboundTag,
 		Options: inboundOptions,
 	}, nil
 }
@@ -541,10 +796,25 @@ func buildNodeOutbound(tag, rawURI string, skipCertVerify bool) (option.Outbound
 		}
 		return option.Outbound{Type: C.TypeHysteria, Tag: tag, Options: &opts}, nil
 	default:
+		if plugin.Has(parsed.Scheme) {
+			return option.Outbound{Type: pluginout.Type, Tag: tag, Options: &pluginout.Options{URI: rawURI}}, nil
+		}
 		return option.Outbound{}, fmt.Errorf("unsupported scheme %q", parsed.Scheme)
 	}
 }
 
+// execNodeOutbound returns the outbound of an exec node, which dials
+// through the node's command instead of a proxy URI.
+func execNodeOutbound(tag string, node config.NodeConfig) option.Outbound {
+	return option.Outbound{Type: pluginout.Type, Tag: tag, Options: &pluginout.Options{Command: &plugin.Command{
+		Node:    node.Name,
+		Command: node.Exec.Command,
+		Args:    node.Exec.Args,
+		Env:     node.Exec.Env,
+		SOCKS:   node.Exec.SOCKS,
+	}}}
+}
+
 func buildVLESSOptions(u *url.URL, skipCertVerify bool) (option.VLESSOutboundOptions, error) {
 	uuid := u.User.Username()
 	if uuid == "" {
@@ -672,6 +942,8 @@ func buildTLSOptions(query url.Values, skipCertVerify bool) (*option.OutboundTLS
 	tlsOptions := &option.OutboundTLSOptions{Enabled: true, Insecure: skipCertVerify}
 	if sni := query.Get("sni"); sni != "" {
 		tlsOptions.ServerName = sni
+	} else if security == "tls" {
+		tlsOptions.ServerName = transportHost(query)
 	}
 	insecure := query.Get("allowInsecure")
 	if insecure == "" {
@@ -763,6 +1035,9 @@ func buildV2RayTransport(query url.Values) (*option.V2RayTransportOptions, error
 		options.GRPCOptions.ServiceName = query.Get("serviceName")
 	case C.V2RayTransportTypeHTTPUpgrade:
 		options.HTTPUpgradeOptions.Path = query.Get("path")
+		if host := query.Get("host"); host != "" {
+			options.HTTPUpgradeOptions.Host = host
+		}
 	case "xhttp":
 		// XHTTP is not supported by sing-box, fallback to HTTPUpgrade
 		log.Printf("⚠️  XHTTP transport not supported by sing-box, falling back to HTTPUpgrade")
@@ -777,6 +1052,20 @@ func buildV2RayTransport(query url.Values) (*option.V2RayTransportOptions, error
 	return options, nil
 }
 
+// transportHost returns the Host header of a ws/h2/httpupgrade transport.
+// CDN-fronted nodes usually omit sni and expect it to match this host, the
+// same fallback the vmess JSON format already applies.
+func transportHost(query url.Values) string {
+	switch strings.ToLower(query.Get("type")) {
+	case C.V2RayTransportTypeWebsocket, C.V2RayTransportTypeHTTP, C.V2RayTransportTypeHTTPUpgrade, "xhttp":
+		if host := query.Get("host"); host != "" {
+			host, _, _ = strings.Cut(host, ",")
+			return strings.TrimSpace(host)
+		}
+	}
+	return ""
+}
+
 func buildShadowsocksOptions(rawURI string) (option.ShadowsocksOutboundOptions, error) {
 	parsed, err := ssuri.Parse(rawURI)
 	if err != nil {
@@ -794,14 +1083,35 @@ func buildShadowsocksOptions(rawURI string) (option.ShadowsocksOutboundOptions,
 
 	query := parsed.Query
 	if plugin := query.Get("plugin"); plugin != "" {
-		// sing-box library mode doesn't support external plugins like v2ray-plugin
-		// These require the plugin binary to be installed separately
-		return option.ShadowsocksOutboundOptions{}, fmt.Errorf("shadowsocks plugin not supported: %s (requires external binary)", plugin)
+		name, pluginOpts := splitSIP003Plugin(plugin)
+		switch name {
+		case "v2ray-plugin", "obfs-local":
+			// Both are implemented natively by sing-box (transport/sip003),
+			// so WS/TLS and simple-obfs settings can stay in the URI.
+			opts.Plugin = name
+			opts.PluginOptions = pluginOpts
+		default:
+			// Anything else needs an external plugin binary, which library
+			// mode cannot spawn.
+			return option.ShadowsocksOutboundOptions{}, fmt.Errorf("shadowsocks plugin not supported: %s (requires external binary)", name)
+		}
 	}
 
 	return opts, nil
 }
 
+// splitSIP003Plugin splits a SIP002 plugin parameter such as
+// "v2ray-plugin;tls;host=example.com" into the plugin name and its options.
+// "simple-obfs" is accepted as an alias of "obfs-local".
+func splitSIP003Plugin(plugin string) (string, string) {
+	name, pluginOpts, _ := strings.Cut(plugin, ";")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "simple-obfs" {
+		name = "obfs-local"
+	}
+	return name, pluginOpts
+}
+
 func isShadowsocksURI(rawURI string) bool {
 	lower := strings.ToLower(rawURI)
 	return strings.HasPrefix(lower, "ss://") || strings.HasPrefix(lower, "shadowsocks://")
@@ -1140,6 +1450,9 @@ func buildTrojanTLSOptions(query url.Values, skipCertVerify bool) (*option.Outbo
 	if peer := query.Get("peer"); peer != "" && tlsOptions.ServerName == "" {
 		tlsOptions.ServerName = peer
 	}
+	if tlsOptions.ServerName == "" {
+		tlsOptions.ServerName = transportHost(query)
+	}
 
 	insecure := query.Get("allowInsecure")
 	if insecure == "" {
@@ -1433,8 +1746,8 @@ func printProxyLinks(cfg *config.Config, metadata map[string]poolout.MemberMeta)
 	if showPoolEntry {
 		// Pool mode: single entry point for all nodes
 		var auth string
-		if cfg.Listener.Username != "" {
-			auth = fmt.Sprintf("%s:%s@", cfg.Listener.Username, cfg.Listener.Password)
+		if accounts := cfg.ListenerUsers(); len(accounts) > 0 {
+			auth = fmt.Sprintf("%s:%s@", accounts[0].Username, accounts[0].Password)
 		}
 		httpProxyURL := fmt.Sprintf("http://%s%s:%d", auth, cfg.Listener.Address, cfg.Listener.Port)
 		socksProxyURL := fmt.Sprintf("socks5://%s%s:%d", auth, cfg.Listener.Address, cfg.Listener.Port)
@@ -0,0 +1,54 @@
+package builder
+
+import (
+	"fmt"
+	"testing"
+
+	"easy_proxies/internal/config"
+)
+
+func TestBuildNodeOutboundsKeepsConfigOrder(t *testing.T) {
+	cfg := &config.Config{}
+	var tags []string
+	for i := 0; i < 200; i++ {
+		uri := fmt.Sprintf("trojan://pw@node%d.example.com:443#n%d", i, i)
+		if i%50 == 7 {
+			uri = "unknown://broken"
+		}
+		cfg.Nodes = append(cfg.Nodes, config.NodeConfig{Name: fmt.Sprintf("n%d", i), URI: uri})
+		tags = append(tags, fmt.Sprintf("n%d", i))
+	}
+
+	results := buildNodeOutbounds(cfg, tags)
+	if len(results) != len(cfg.Nodes) {
+		t.Fatalf("expected %d results, got %d", len(cfg.Nodes), len(results))
+	}
+	for i, res := range results {
+		if i%50 == 7 {
+			if res.err == nil {
+				t.Fatalf("node %d: expected build error", i)
+			}
+			continue
+		}
+		if res.err != nil {
+			t.Fatalf("node %d: unexpected error: %v", i, res.err)
+		}
+		if res.outbound.Tag != tags[i] {
+			t.Fatalf("node %d: expected tag %q, got %q", i, tags[i], res.outbound.Tag)
+		}
+	}
+}
+
+func TestBuildNodeOutboundsSkipsDisabled(t *testing.T) {
+	cfg := &config.Config{Nodes: []config.NodeConfig{
+		{Name: "a", URI: "trojan://pw@a.example.com:443#a"},
+		{Name: "b", URI: "unknown://broken", Disabled: true},
+	}}
+	results := buildNodeOutbounds(cfg, []string{"a", "b"})
+	if results[0].err != nil || results[0].outbound.Tag != "a" {
+		t.Fatalf("enabled node not built: %+v", results[0])
+	}
+	if results[1].err != nil || results[1].outbound.Tag != "" {
+		t.Fatalf("disabled node should not be parsed: %+v", results[1])
+	}
+}
@@ -36,7 +36,7 @@ func TestBuildNodeOutbound_ShadowsocksLegacyWholePayloadBase64(t *testing.T) {
 }
 
 func TestBuildNodeOutbound_ShadowsocksPluginStillUnsupported(t *testing.T) {
-	_, err := buildNodeOutbound("test-ss", "ss://aes-256-gcm:password@example.com:8388?plugin=v2ray-plugin", false)
+	_, err := buildNodeOutbound("test-ss", "ss://aes-256-gcm:password@example.com:8388?plugin=kcptun", false)
 	if err == nil {
 		t.Fatalf("expected plugin error, got nil")
 	}
@@ -44,3 +44,25 @@ func TestBuildNodeOutbound_ShadowsocksPluginStillUnsupported(t *testing.T) {
 		t.Fatalf("expected plugin unsupported error, got %v", err)
 	}
 }
+
+func TestBuildNodeOutbound_ShadowsocksBuiltinPlugins(t *testing.T) {
+	cases := []struct {
+		query      string
+		wantPlugin string
+		wantOpts   string
+	}{
+		{"plugin=v2ray-plugin%3Btls%3Bhost%3Dcdn.example.com%3Bpath%3D%2Fws", "v2ray-plugin", "tls;host=cdn.example.com;path=/ws"},
+		{"plugin=obfs-local%3Bobfs%3Dhttp%3Bobfs-host%3Dexample.org", "obfs-local", "obfs=http;obfs-host=example.org"},
+		{"plugin=simple-obfs%3Bobfs%3Dtls", "obfs-local", "obfs=tls"},
+	}
+	for _, tc := range cases {
+		outbound, err := buildNodeOutbound("test-ss", "ss://aes-256-gcm:password@example.com:443?"+tc.query, false)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.query, err)
+		}
+		opts := outbound.Options.(*option.ShadowsocksOutboundOptions)
+		if opts.Plugin != tc.wantPlugin || opts.PluginOptions != tc.wantOpts {
+			t.Fatalf("%s: expected plugin %q opts %q, got %q opts %q", tc.query, tc.wantPlugin, tc.wantOpts, opts.Plugin, opts.PluginOptions)
+		}
+	}
+}
@@ -60,3 +60,38 @@ func TestBuildNodeOutbound_VLESSNoPacketEncoding(t *testing.T) {
 		t.Fatalf("expected nil PacketEncoding, got %v", *opts.PacketEncoding)
 	}
 }
+
+func TestBuildNodeOutbound_WebsocketTLSServerNameFallsBackToHost(t *testing.T) {
+	uri := "vless://" + testVLESSUUID + "@104.16.0.1:443?type=ws&security=tls&host=cdn.example.com&path=%2Fws#CDN"
+	outbound, err := buildNodeOutbound("ws-vless", uri, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := outbound.Options.(*option.VLESSOutboundOptions)
+	if opts.Transport == nil || opts.Transport.Type != C.V2RayTransportTypeWebsocket {
+		t.Fatalf("expected websocket transport, got %+v", opts.Transport)
+	}
+	if opts.Transport.WebsocketOptions.Path != "/ws" {
+		t.Fatalf("expected ws path /ws, got %q", opts.Transport.WebsocketOptions.Path)
+	}
+	if opts.TLS == nil || opts.TLS.ServerName != "cdn.example.com" {
+		t.Fatalf("expected TLS server name from ws host, got %+v", opts.TLS)
+	}
+
+	trojan, err := buildNodeOutbound("ws-trojan", "trojan://secret@104.16.0.1:443?type=ws&host=cdn.example.com#CDN", false)
+	if err != nil {
+		t.Fatalf("unexpected trojan error: %v", err)
+	}
+	trojanOpts := trojan.Options.(*option.TrojanOutboundOptions)
+	if trojanOpts.TLS == nil || trojanOpts.TLS.ServerName != "cdn.example.com" {
+		t.Fatalf("expected trojan TLS server name from ws host, got %+v", trojanOpts.TLS)
+	}
+
+	explicit, err := buildNodeOutbound("sni-vless", "vless://"+testVLESSUUID+"@104.16.0.1:443?type=ws&security=tls&host=cdn.example.com&sni=real.example.com#SNI", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := explicit.Options.(*option.VLESSOutboundOptions).TLS.ServerName; got != "real.example.com" {
+		t.Fatalf("expected explicit sni to win, got %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"easy_proxies/internal/config"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+// chainURIs expands node.Via into hop URIs in dialing order (first hop
+// first). Entries are proxy URIs or names of other nodes; a referenced node
+// contributes its own chain followed by its URI. visiting guards against
+// loops.
+func chainURIs(node config.NodeConfig, byName map[string]config.NodeConfig, visiting map[string]bool) ([]string, error) {
+	if visiting[node.Name] {
+		return nil, fmt.Errorf("via loop at node %q", node.Name)
+	}
+	visiting[node.Name] = true
+	defer delete(visiting, node.Name)
+
+	var uris []string
+	for _, hop := range node.Via {
+		hop = strings.TrimSpace(hop)
+		if hop == "" {
+			continue
+		}
+		if strings.Contains(hop, "://") {
+			uris = append(uris, hop)
+			continue
+		}
+		ref, ok := byName[hop]
+		if !ok {
+			return nil, fmt.Errorf("via: unknown node %q", hop)
+		}
+		if ref.Exec != nil {
+			return nil, fmt.Errorf("via: exec node %q cannot be a hop", hop)
+		}
+		sub, err := chainURIs(ref, byName, visiting)
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, sub...)
+		uris = append(uris, ref.URI)
+	}
+	return uris, nil
+}
+
+// buildChain builds a private outbound for every hop in uris, links them
+// with detours and makes out dial through the last hop. Hops are never
+// shared with the pool, so chaining a node does not affect the nodes it
+// references. Hops are checked for plaintext downgrades unless the chained
+// node allows plaintext.
+func buildChain(tag string, out *option.Outbound, uris []string, skipCertVerify, allowPlaintext bool) ([]option.Outbound, error) {
+	hops := make([]option.Outbound, 0, len(uris))
+	prev := ""
+	for k, uri := range uris {
+		hop, err := buildNodeOutbound(fmt.Sprintf("%s-via-%d", tag, k+1), uri, skipCertVerify)
+		if err == nil && !allowPlaintext {
+			err = checkDowngrade(uri, hop)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("via hop %d: %w", k+1, err)
+		}
+		if prev != "" {
+			if err := setDetour(&hop, prev); err != nil {
+				return nil, fmt.Errorf("via hop %d: %w", k+1, err)
+			}
+		}
+		hops = append(hops, hop)
+		prev = hop.Tag
+	}
+	if prev != "" {
+		if err := setDetour(out, prev); err != nil {
+			return nil, err
+		}
+	}
+	return hops, nil
+}
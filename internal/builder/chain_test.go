@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/config"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestChainURIsExpandsNodeReferences(t *testing.T) {
+	relay := config.NodeConfig{Name: "relay", URI: "socks5://relay.example.com:1080", Via: config.ViaChain{"http://edge.example.com:8080"}}
+	exit := config.NodeConfig{Name: "exit", URI: "trojan://pw@exit.example.com:443", Via: config.ViaChain{"relay"}}
+	byName := map[string]config.NodeConfig{"relay": relay, "exit": exit}
+
+	uris, err := chainURIs(exit, byName, map[string]bool{})
+	if err != nil {
+		t.Fatalf("chainURIs: %v", err)
+	}
+	want := []string{"http://edge.example.com:8080", "socks5://relay.example.com:1080"}
+	if strings.Join(uris, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected %v, got %v", want, uris)
+	}
+}
+
+func TestChainURIsRejectsLoopsAndUnknownNodes(t *testing.T) {
+	a := config.NodeConfig{Name: "a", URI: "socks5://a.example.com:1080", Via: config.ViaChain{"b"}}
+	b := config.NodeConfig{Name: "b", URI: "socks5://b.example.com:1080", Via: config.ViaChain{"a"}}
+	byName := map[string]config.NodeConfig{"a": a, "b": b}
+	if _, err := chainURIs(a, byName, map[string]bool{}); err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Fatalf("expected loop error, got %v", err)
+	}
+
+	c := config.NodeConfig{Name: "c", URI: "socks5://c.example.com:1080", Via: config.ViaChain{"missing"}}
+	if _, err := chainURIs(c, byName, map[string]bool{}); err == nil || !strings.Contains(err.Error(), "unknown node") {
+		t.Fatalf("expected unknown node error, got %v", err)
+	}
+}
+
+func TestBuildChainLinksDetours(t *testing.T) {
+	out, err := buildNodeOutbound("exit", "trojan://pw@exit.example.com:443", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hops, err := buildChain("exit", &out, []string{"http://edge.example.com:8080", "socks5://relay.example.com:1080"}, false, false)
+	if err != nil {
+		t.Fatalf("buildChain: %v", err)
+	}
+	if len(hops) != 2 || hops[0].Tag != "exit-via-1" || hops[1].Tag != "exit-via-2" {
+		t.Fatalf("unexpected hops: %+v", hops)
+	}
+	if d := dialerOptionsOf(&hops[0]).Detour; d != "" {
+		t.Fatalf("first hop should dial directly, got detour %q", d)
+	}
+	if d := dialerOptionsOf(&hops[1]).Detour; d != "exit-via-1" {
+		t.Fatalf("second hop should dial via the first, got %q", d)
+	}
+	if d := out.Options.(*option.TrojanOutboundOptions).Detour; d != "exit-via-2" {
+		t.Fatalf("node should dial via the last hop, got %q", d)
+	}
+}
+
+func TestSetBind(t *testing.T) {
+	out, err := buildNodeOutbound("hk", "trojan://pw@hk.example.com:443", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setBind(&out, "wan2", "192.0.2.10"); err != nil {
+		t.Fatalf("setBind: %v", err)
+	}
+	dialer := dialerOptionsOf(&out)
+	if dialer.BindInterface != "wan2" || dialer.Inet4BindAddress == nil || dialer.Inet4BindAddress.Build(netip.Addr{}).String() != "192.0.2.10" || dialer.Inet6BindAddress != nil {
+		t.Fatalf("bind not applied: %+v", dialer)
+	}
+	if err := setBind(&out, "", "2001:db8::10"); err != nil || dialer.Inet6BindAddress == nil {
+		t.Fatalf("expected an IPv6 source address, got %+v (err=%v)", dialer, err)
+	}
+}
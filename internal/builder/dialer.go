@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// dialerOptionsOf returns the DialerOptions embedded in a node outbound's
+// options, or nil for outbound types without one.
+func dialerOptionsOf(out *option.Outbound) *option.DialerOptions {
+	switch opts := out.Options.(type) {
+	case *option.ShadowsocksOutboundOptions:
+		return &opts.DialerOptions
+	case *option.ShadowsocksROutboundOptions:
+		return &opts.DialerOptions
+	case *option.VLESSOutboundOptions:
+		return &opts.DialerOptions
+	case *option.VMessOutboundOptions:
+		return &opts.DialerOptions
+	case *option.TrojanOutboundOptions:
+		return &opts.DialerOptions
+	case *option.Hysteria2OutboundOptions:
+		return &opts.DialerOptions
+	case *option.HysteriaOutboundOptions:
+		return &opts.DialerOptions
+	case *option.TUICOutboundOptions:
+		return &opts.DialerOptions
+	case *option.AnyTLSOutboundOptions:
+		return &opts.DialerOptions
+	case *option.SOCKSOutboundOptions:
+		return &opts.DialerOptions
+	case *option.HTTPOutboundOptions:
+		return &opts.DialerOptions
+	default:
+		return nil
+	}
+}
+
+// setDetour makes out dial its server through the outbound tagged detour.
+func setDetour(out *option.Outbound, detour string) error {
+	dialer := dialerOptionsOf(out)
+	if dialer == nil {
+		return fmt.Errorf("outbound type %q cannot be chained", out.Type)
+	}
+	dialer.Detour = detour
+	return nil
+}
+
+// setBind makes out dial its server from the local interface iface and/or
+// the source address bindAddress. Empty values are left to the OS.
+func setBind(out *option.Outbound, iface, bindAddress string) error {
+	if iface == "" && bindAddress == "" {
+		return nil
+	}
+	dialer := dialerOptionsOf(out)
+	if dialer == nil {
+		return fmt.Errorf("outbound type %q cannot be bound to an interface or address", out.Type)
+	}
+	dialer.BindInterface = iface
+	if bindAddress != "" {
+		addr, err := netip.ParseAddr(bindAddress)
+		if err != nil {
+			return fmt.Errorf("invalid bind_address %q", bindAddress)
+		}
+		bind := badoption.Addr(addr.Unmap())
+		if addr.Unmap().Is4() {
+			dialer.Inet4BindAddress = &bind
+		} else {
+			dialer.Inet6BindAddress = &bind
+		}
+	}
+	return nil
+}
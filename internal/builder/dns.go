@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"fmt"
+
+	"easy_proxies/internal/config"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// dnsBootstrapTag is the system resolver used to look up DoH/DoT servers
+// that are given by hostname.
+const dnsBootstrapTag = "dns-bootstrap"
+
+// dnsServerTag returns the tag of the idx-th entry of dns.servers.
+func dnsServerTag(idx int) string {
+	return fmt.Sprintf("dns-%d", idx+1)
+}
+
+// dnsServerTags returns the tags of dns.servers in fallback order, or nil
+// when no node resolves locally.
+func dnsServerTags(cfg *config.Config) []string {
+	if !cfg.DNS.UsesLocal() {
+		return nil
+	}
+	tags := make([]string, len(cfg.DNS.Servers))
+	for idx := range tags {
+		tags[idx] = dnsServerTag(idx)
+	}
+	return tags
+}
+
+// buildDNS returns the sing-box DNS section used for local resolution, or
+// nil when every node resolves remotely. With no servers configured, local
+// resolution uses the system resolver.
+func buildDNS(cfg *config.Config) (*option.DNSOptions, error) {
+	d := cfg.DNS
+	if !d.UsesLocal() {
+		return nil, nil
+	}
+	dns := &option.DNSOptions{}
+	dns.DisableCache = d.DisableCache
+	dns.CacheCapacity = uint32(d.CacheSize)
+	dns.Strategy = dnsStrategy(d.Strategy)
+
+	needBootstrap := len(d.Servers) == 0
+	for idx, raw := range d.Servers {
+		server, err := config.ParseDNSServer(raw)
+		if err != nil {
+			return nil, fmt.Errorf("dns.servers[%d]: %w", idx, err)
+		}
+		remote := option.RemoteDNSServerOptions{
+			DNSServerAddressOptions: option.DNSServerAddressOptions{Server: server.Host, ServerPort: server.Port},
+		}
+		if !server.IsIP() {
+			remote.DomainResolver = &option.DomainResolveOptions{Server: dnsBootstrapTag}
+			needBootstrap = true
+		}
+		var options any
+		switch server.Type {
+		case "udp", "tcp":
+			options = &remote
+		case "tls":
+			options = &option.RemoteTLSDNSServerOptions{RemoteDNSServerOptions: remote}
+		case "https":
+			options = &option.RemoteHTTPSDNSServerOptions{
+				RemoteTLSDNSServerOptions: option.RemoteTLSDNSServerOptions{RemoteDNSServerOptions: remote},
+				Path:                      server.Path,
+			}
+		}
+		dns.Servers = append(dns.Servers, option.DNSServerOptions{Type: server.Type, Tag: dnsServerTag(idx), Options: options})
+	}
+	if needBootstrap {
+		dns.Servers = append(dns.Servers, option.DNSServerOptions{
+			Type:    C.DNSTypeLocal,
+			Tag:     dnsBootstrapTag,
+			Options: &option.LocalDNSServerOptions{},
+		})
+	}
+	dns.Final = dnsBootstrapTag
+	if len(d.Servers) > 0 {
+		dns.Final = dnsServerTag(0)
+	}
+	return dns, nil
+}
+
+func dnsStrategy(strategy string) option.DomainStrategy {
+	switch strategy {
+	case "prefer_ipv4":
+		return option.DomainStrategy(C.DomainStrategyPreferIPv4)
+	case "prefer_ipv6":
+		return option.DomainStrategy(C.DomainStrategyPreferIPv6)
+	case "ipv4_only":
+		return option.DomainStrategy(C.DomainStrategyIPv4Only)
+	case "ipv6_only":
+		return option.DomainStrategy(C.DomainStrategyIPv6Only)
+	}
+	return option.DomainStrategy(C.DomainStrategyAsIS)
+}
@@ -0,0 +1,95 @@
+package builder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// errPlaintextDowngrade marks nodes whose URI asks for TLS but would be
+// dialed in plaintext.
+var errPlaintextDowngrade = errors.New("plaintext downgrade")
+
+// tlsOnlyParams are URI parameters that only mean something on a TLS
+// connection. Finding one on a node without TLS usually means security=tls
+// was lost on the way: a hand-edited URI or a subscription rewritten in
+// transit. fp and sid are not among them, since generators write them on
+// plain nodes too, and a Reality sid comes with pbk anyway.
+var tlsOnlyParams = []string{"sni", "peer", "alpn", "pbk"}
+
+// tlsOnlyFlags show TLS intent only when switched on; allowInsecure=0 is
+// written on plain nodes as well.
+var tlsOnlyFlags = []string{"allowInsecure", "insecure"}
+
+// checkDowngrade refuses an outbound built from rawURI that would send its
+// credentials in the clear although the URI shows it was meant to use TLS.
+// Nodes set to allow_plaintext skip the check.
+func checkDowngrade(rawURI string, out option.Outbound) error {
+	switch out.Type {
+	case C.TypeVLESS:
+		if opts, ok := out.Options.(*option.VLESSOutboundOptions); ok && opts.TLS == nil {
+			return tlsParamsWithoutTLS(rawURI)
+		}
+	case C.TypeVMess:
+		if opts, ok := out.Options.(*option.VMessOutboundOptions); ok && opts.TLS == nil {
+			if vmess, ok := decodeVMessJSON(rawURI); ok {
+				if vmess.SNI != "" || vmess.ALPN != "" {
+					return fmt.Errorf("%w: vmess sets sni/alpn but tls is %q; set \"tls\": \"tls\" or allow_plaintext", errPlaintextDowngrade, vmess.TLS)
+				}
+				return nil
+			}
+			return tlsParamsWithoutTLS(rawURI)
+		}
+	case C.TypeHTTP:
+		opts, ok := out.Options.(*option.HTTPOutboundOptions)
+		if ok && opts.TLS == nil && opts.Username != "" && opts.ServerPort == 443 {
+			return fmt.Errorf("%w: http proxy with credentials on port 443 would send them in the clear; use https:// or allow_plaintext", errPlaintextDowngrade)
+		}
+	}
+	return nil
+}
+
+func tlsParamsWithoutTLS(rawURI string) error {
+	u, err := url.Parse(rawURI)
+	if err != nil {
+		return nil
+	}
+	query := u.Query()
+	for _, key := range tlsOnlyParams {
+		if query.Get(key) != "" {
+			return fmt.Errorf("%w: %s is set but security is %q; set security=tls or allow_plaintext", errPlaintextDowngrade, key, query.Get("security"))
+		}
+	}
+	for _, key := range tlsOnlyFlags {
+		if value := query.Get(key); value == "1" || strings.EqualFold(value, "true") {
+			return fmt.Errorf("%w: %s=%s but security is %q; set security=tls or allow_plaintext", errPlaintextDowngrade, key, value, query.Get("security"))
+		}
+	}
+	if strings.Contains(strings.ToLower(query.Get("flow")), "vision") {
+		return fmt.Errorf("%w: flow %s needs TLS but security is %q", errPlaintextDowngrade, query.Get("flow"), query.Get("security"))
+	}
+	return nil
+}
+
+// decodeVMessJSON decodes the base64 JSON form of a vmess URI, the way
+// buildVMessOptions does.
+func decodeVMessJSON(rawURI string) (vmessJSON, bool) {
+	encoded := strings.TrimPrefix(rawURI, "vmess://")
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if decoded, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return vmessJSON{}, false
+		}
+	}
+	var vmess vmessJSON
+	if err := json.Unmarshal(decoded, &vmess); err != nil {
+		return vmessJSON{}, false
+	}
+	return vmess, true
+}
@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"strings"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/outbound/lazyout"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func init() {
+	lazyout.SetParser(parseLazyNode)
+}
+
+// lazySchemes are the built-in schemes whose parsing pool.lazy_nodes defers
+// to the first dial. Plugin schemes are cheap to build and stay eager.
+var lazySchemes = map[string]bool{
+	"vless": true, "vmess": true, "trojan": true, "anytls": true, "tuic": true,
+	"hysteria": true, "hysteria2": true, "hy2": true, "ssr": true, "shadowsocksr": true,
+	"socks": true, "socks5": true, "socks5h": true, "http": true, "https": true,
+}
+
+// lazyNodeOutbound returns the outbound of a node whose URI is only parsed
+// when it is first dialed, or false when the node is built now: with
+// pool.lazy_nodes off, for exec nodes, for nodes chained through via hops
+// and for schemes only a plugin handles.
+func lazyNodeOutbound(cfg *config.Config, tag string, node config.NodeConfig) (option.Outbound, bool) {
+	if !cfg.Pool.LazyNodes || node.Exec != nil || len(node.Via) > 0 {
+		return option.Outbound{}, false
+	}
+	scheme, _, ok := strings.Cut(node.URI, "://")
+	scheme = strings.ToLower(scheme)
+	if !ok || !(lazySchemes[scheme] || isShadowsocksURI(node.URI)) {
+		return option.Outbound{}, false
+	}
+	iface, bindAddress := cfg.NodeBind(node)
+	return option.Outbound{Type: lazyout.Type, Tag: tag, Options: &lazyout.Options{
+		URI:            node.URI,
+		SkipCertVerify: cfg.SkipCertVerify,
+		AllowPlaintext: node.AllowPlaintext,
+		Interface:      iface,
+		BindAddress:    bindAddress,
+		TCPOnly:        scheme == "http" || scheme == "https",
+	}}, true
+}
+
+// parseLazyNode builds the outbound a lazy node stands for, with the same
+// checks an eagerly built node gets.
+func parseLazyNode(tag string, options lazyout.Options) (option.Outbound, error) {
+	out, err := buildNodeOutbound(tag, options.URI, options.SkipCertVerify)
+	if err != nil {
+		return option.Outbound{}, err
+	}
+	if !options.AllowPlaintext {
+		if err := checkDowngrade(options.URI, out); err != nil {
+			return option.Outbound{}, err
+		}
+	}
+	if err := setBind(&out, options.Interface, options.BindAddress); err != nil {
+		return option.Outbound{}, err
+	}
+	return out, nil
+}
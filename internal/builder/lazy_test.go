@@ -0,0 +1,83 @@
+package builder
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/outbound/lazyout"
+
+	C "github.com/sagernet/sing-box/constant"
+)
+
+func TestLazyNodes(t *testing.T) {
+	cfg := &config.Config{Pool: config.PoolConfig{LazyNodes: true}, Nodes: []config.NodeConfig{
+		{Name: "a", URI: "trojan://pw@a.example.com:443#a", BindAddress: "192.0.2.10"},
+		{Name: "b", URI: "http://b.example.com:8080"},
+		{Name: "c", URI: "unknown://broken"},
+		{Name: "d", URI: "trojan://pw@d.example.com:443#d", Via: []string{"a"}},
+	}}
+	results := buildNodeOutbounds(cfg, []string{"a", "b", "c", "d"})
+
+	a, ok := results[0].outbound.Options.(*lazyout.Options)
+	if results[0].outbound.Type != lazyout.Type || !ok || a.BindAddress != "192.0.2.10" || a.TCPOnly {
+		t.Fatalf("a: %+v", results[0].outbound)
+	}
+	if b, ok := results[1].outbound.Options.(*lazyout.Options); !ok || !b.TCPOnly {
+		t.Fatalf("b: %+v", results[1].outbound)
+	}
+	if results[2].err == nil {
+		t.Fatal("an unknown scheme should still fail at load")
+	}
+	if results[3].outbound.Type != C.TypeTrojan {
+		t.Fatalf("a chained node should be built at load: %+v", results[3].outbound)
+	}
+
+	out, err := parseLazyNode("a", *a)
+	if err != nil || out.Type != C.TypeTrojan || out.Tag != "a" {
+		t.Fatalf("parseLazyNode: %+v, %v", out, err)
+	}
+	if dialer := dialerOptionsOf(&out); dialer == nil || dialer.Inet4BindAddress == nil {
+		t.Fatal("the bind address was not applied when parsed")
+	}
+	if _, err := parseLazyNode("x", lazyout.Options{URI: "vless://uuid@x.example.com:80?sni=x.example.com"}); err == nil {
+		t.Fatal("a plaintext downgrade passed when parsed")
+	}
+}
+
+// BenchmarkBuildNodesMemory reports the heap held per node by the built
+// outbound options of a large node list, parsed at load and with
+// pool.lazy_nodes.
+//
+//	go test ./internal/builder -run '^$' -bench BuildNodesMemory -benchtime 1x
+func BenchmarkBuildNodesMemory(b *testing.B) {
+	for _, lazy := range []bool{false, true} {
+		name := "eager"
+		if lazy {
+			name = "lazy"
+		}
+		b.Run(name, func(b *testing.B) {
+			const nodes = 50000
+			cfg := &config.Config{Pool: config.PoolConfig{LazyNodes: lazy}}
+			tags := make([]string, nodes)
+			for n := range nodes {
+				tags[n] = fmt.Sprintf("node-%d", n)
+				cfg.Nodes = append(cfg.Nodes, config.NodeConfig{Name: tags[n], URI: fmt.Sprintf(
+					"vless://c2a5d3a4-0f7b-4d0e-9a7e-%012d@203.0.113.%d:443?security=tls&sni=n%d.example.com&type=ws&path=/ws#%s",
+					n, n%250, n, tags[n])})
+			}
+			for range b.N {
+				runtime.GC()
+				var before runtime.MemStats
+				runtime.ReadMemStats(&before)
+				results := buildNodeOutbounds(cfg, tags)
+				runtime.GC()
+				var after runtime.MemStats
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/nodes, "B/node")
+				runtime.KeepAlive(results)
+			}
+		})
+	}
+}
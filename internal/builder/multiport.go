@@ -0,0 +1,146 @@
+package builder
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/handoff"
+	poolout "easy_proxies/internal/outbound/pool"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/auth"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// NodeInboundTag is the tag of the per-node multi-port listener of nodeTag.
+func NodeInboundTag(nodeTag string) string {
+	return "in-" + nodeTag
+}
+
+// groupInboundPrefix prefixes the tags of grouped multi-port listeners.
+const groupInboundPrefix = "in-port-"
+
+// NodeTagOfInbound reports the node a per-node multi-port listener belongs
+// to. Grouped listeners ("in-port-<key>") are not per-node.
+func NodeTagOfInbound(inboundTag string) (string, bool) {
+	if IsGroupInbound(inboundTag) {
+		return "", false
+	}
+	return strings.CutPrefix(inboundTag, "in-")
+}
+
+// IsGroupInbound reports whether inboundTag is a grouped multi-port listener.
+func IsGroupInbound(inboundTag string) bool {
+	return strings.HasPrefix(inboundTag, groupInboundPrefix)
+}
+
+// multiPortEntry builds one multi-port listener and the rule sending its
+// traffic to poolTag.
+func multiPortEntry(cfg *config.Config, addr *badoption.Addr, inboundTag string, port uint16, poolTag string) (option.Inbound, option.Rule) {
+	inboundOptions := &option.HTTPMixedInboundOptions{
+		ListenOptions: option.ListenOptions{
+			Listen:     addr,
+			ListenPort: port,
+			ReuseAddr:  handoff.Supported(),
+		},
+	}
+	if cfg.MultiPort.Username != "" {
+		inboundOptions.Users = []auth.User{{Username: cfg.MultiPort.Username, Password: cfg.MultiPort.Password}}
+	}
+	inbound := option.Inbound{
+		Type:    C.TypeMixed,
+		Tag:     inboundTag,
+		Options: inboundOptions,
+	}
+	rule := option.Rule{
+		Type: C.RuleTypeDefault,
+		DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{
+				Inbound: badoption.Listable[string]{inboundTag},
+			},
+			RuleAction: option.RuleAction{
+				Action: C.RuleActionTypeRoute,
+				RouteOptions: option.RouteActionOptions{
+					Outbound: poolTag,
+				},
+			},
+		},
+	}
+	return inbound, rule
+}
+
+// buildMultiPortGroups gives every node group (by keyOf: country, region or
+// node group) one port starting at multi_port.base_port, in key order, and
+// load-balances within the group with pool.mode. Nodes with an empty key
+// share the "other" port. Ports used by the pool and sticky entries are
+// skipped in hybrid mode.
+func buildMultiPortGroups(cfg *config.Config, memberTags []string, metadata map[string]poolout.MemberMeta, keyOf func(tag string) string) ([]option.Inbound, []option.Outbound, []option.Rule, error) {
+	addr, err := parseAddr(cfg.MultiPort.Address)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parse multi-port address: %w", err)
+	}
+
+	groups := make(map[string][]string)
+	for _, tag := range memberTags {
+		key := sanitizeTag(keyOf(tag))
+		if key == "" {
+			key = "other"
+		}
+		groups[key] = append(groups[key], tag)
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reserved := map[int]bool{}
+	if cfg.Mode == "hybrid" {
+		reserved[int(cfg.Listener.Port)] = true
+		if cfg.Sticky.Enabled {
+			reserved[int(cfg.Sticky.Port)] = true
+		}
+	}
+
+	var (
+		inbounds  []option.Inbound
+		outbounds []option.Outbound
+		rules     []option.Rule
+	)
+	port := int(cfg.MultiPort.BasePort)
+	log.Printf("🔀 Multi-port grouped by %s:", cfg.MultiPort.GroupBy)
+	for _, key := range keys {
+		for reserved[port] {
+			port++
+		}
+		if port > 65535 {
+			return nil, nil, nil, fmt.Errorf("multi-port: no ports left for group %q starting from %d", key, cfg.MultiPort.BasePort)
+		}
+		members := groups[key]
+		groupMeta := make(map[string]poolout.MemberMeta, len(members))
+		for _, tag := range members {
+			groupMeta[tag] = metadata[tag]
+		}
+		poolTag := fmt.Sprintf("%s-port-%s", poolout.Tag, key)
+		mode := cfg.Pool.Mode
+		if cfg.MultiPort.GroupBy == config.MultiPortByGroup {
+			mode = cfg.PoolFor(key).Mode
+		}
+		poolOptions := poolOptionsFor(cfg, mode, members, groupMeta)
+		outbounds = append(outbounds, option.Outbound{
+			Type:    poolout.Type,
+			Tag:     poolTag,
+			Options: &poolOptions,
+		})
+		inbound, rule := multiPortEntry(cfg, addr, groupInboundPrefix+key, uint16(port), poolTag)
+		inbounds = append(inbounds, inbound)
+		rules = append(rules, rule)
+		log.Printf("   %s:%d → %s (%d nodes)", cfg.MultiPort.Address, port, key, len(members))
+		port++
+	}
+	return inbounds, outbounds, rules, nil
+}
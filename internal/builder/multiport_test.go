@@ -0,0 +1,51 @@
+package builder
+
+import (
+	"testing"
+
+	"easy_proxies/internal/config"
+	poolout "easy_proxies/internal/outbound/pool"
+
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestBuildMultiPortGroups(t *testing.T) {
+	cfg := &config.Config{
+		Mode:      "hybrid",
+		Listener:  config.ListenerConfig{Port: 24001},
+		MultiPort: config.MultiPortConfig{Address: "0.0.0.0", BasePort: 24000, GroupBy: config.MultiPortByCountry},
+	}
+	countries := map[string]string{"a": "us", "b": "jp", "c": "us", "d": ""}
+	metadata := map[string]poolout.MemberMeta{}
+	for tag := range countries {
+		metadata[tag] = poolout.MemberMeta{Name: tag}
+	}
+
+	inbounds, outbounds, rules, err := buildMultiPortGroups(cfg, []string{"a", "b", "c", "d"}, metadata, func(tag string) string { return countries[tag] })
+	if err != nil {
+		t.Fatalf("buildMultiPortGroups: %v", err)
+	}
+	if len(inbounds) != 3 || len(outbounds) != 3 || len(rules) != 3 {
+		t.Fatalf("expected 3 groups, got %d/%d/%d", len(inbounds), len(outbounds), len(rules))
+	}
+
+	// Groups are ordered by key; the listener port 24001 is skipped.
+	want := []struct {
+		tag     string
+		port    uint16
+		members int
+	}{{"in-port-jp", 24000, 1}, {"in-port-other", 24002, 1}, {"in-port-us", 24003, 2}}
+	for i, w := range want {
+		opts := inbounds[i].Options.(*option.HTTPMixedInboundOptions)
+		if inbounds[i].Tag != w.tag || opts.ListenPort != w.port {
+			t.Fatalf("group %d: got %s:%d, want %s:%d", i, inbounds[i].Tag, opts.ListenPort, w.tag, w.port)
+		}
+		members := outbounds[i].Options.(*poolout.Options).Members
+		if len(members) != w.members {
+			t.Fatalf("group %s: expected %d members, got %v", w.tag, w.members, members)
+		}
+		if rules[i].DefaultOptions.RouteOptions.Outbound != outbounds[i].Tag {
+			t.Fatalf("group %s routes to %s, want %s", w.tag, rules[i].DefaultOptions.RouteOptions.Outbound, outbounds[i].Tag)
+		}
+	}
+}
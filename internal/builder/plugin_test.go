@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"testing"
+	"time"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/outbound/pluginout"
+	"easy_proxies/internal/plugin"
+)
+
+func TestBuildNodeOutbound_PluginScheme(t *testing.T) {
+	if _, err := buildNodeOutbound("wg-node", "wg://peer.example.com:51820", false); err == nil {
+		t.Fatal("expected an error for a scheme without a plugin")
+	}
+
+	plugin.ConfigureExec([]plugin.ExecSpec{{Scheme: "wg", Command: "wg-plugin"}})
+	defer plugin.ConfigureExec(nil)
+	out, err := buildNodeOutbound("wg-node", "wg://peer.example.com:51820", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, ok := out.Options.(*pluginout.Options)
+	if out.Type != pluginout.Type || !ok || opts.URI != "wg://peer.example.com:51820" {
+		t.Fatalf("unexpected outbound %+v", out)
+	}
+	if err := setDetour(&out, "relay"); err == nil {
+		t.Fatal("plugin nodes cannot be chained")
+	}
+}
+
+func TestBuild_ExecNode(t *testing.T) {
+	cfg := &config.Config{
+		Mode:     "multi-port",
+		Listener: config.ListenerConfig{Address: "127.0.0.1", Port: 0},
+		MultiPort: config.MultiPortConfig{
+			Address: "127.0.0.1", BasePort: 24000, Interface: "wan0",
+		},
+		Pool: config.PoolConfig{Mode: "sequential", FailureThreshold: 3, BlacklistDuration: time.Minute},
+		Nodes: []config.NodeConfig{{
+			Name: "tunnel",
+			URI:  "exec://tunnel",
+			Port: 24000,
+			Exec: &config.NodeExec{Command: "ssh", Args: []string{"-W", "{host}:{port}", "bastion"}},
+		}},
+	}
+	opts, err := Build(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, out := range opts.Outbounds {
+		if out.Type != pluginout.Type {
+			continue
+		}
+		found = true
+		po := out.Options.(*pluginout.Options)
+		if po.Command == nil || po.Command.Command != "ssh" || po.Command.Node != "tunnel" || len(po.Command.Args) != 3 {
+			t.Fatalf("unexpected exec outbound %+v", po)
+		}
+	}
+	if !found {
+		t.Fatal("exec node missing from outbounds")
+	}
+}
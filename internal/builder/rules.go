@@ -0,0 +1,162 @@
+package builder
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/geoip"
+	poolout "easy_proxies/internal/outbound/pool"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// Tags of the shared pool entry and the sticky entry inbounds.
+const (
+	PoolInboundTag   = "http-in"
+	StickyInboundTag = "sticky-in"
+)
+
+// StickyPoolTag is the outbound tag of the sticky pool.
+const StickyPoolTag = poolout.Tag + "-sticky"
+
+// GroupPoolTag returns the outbound tag of the pool serving a node group.
+func GroupPoolTag(group string) string {
+	return "group-" + group
+}
+
+// buildRoutingRules translates cfg.Rules into route rules for the shared
+// pool entry (and the TUN and transparent inbounds when enabled). Each group referenced by a rule gets its own pool outbound;
+// regionPools maps GeoIP region codes to already-built region pools. Rules
+// by HTTP method only get their pool, since the entry front applies them.
+// Rules whose target has no nodes are skipped with a warning so a group
+// emptied by failing nodes does not prevent startup.
+func buildRoutingRules(cfg *config.Config, groupMembers map[string][]string, regionPools map[string]string, metadata map[string]poolout.MemberMeta) ([]option.Outbound, []option.Rule, error) {
+	var (
+		outbounds []option.Outbound
+		rules     []option.Rule
+	)
+	groupPools := make(map[string]string)
+	inbounds := badoption.Listable[string]{PoolInboundTag}
+	if cfg.TUN.Enabled {
+		inbounds = append(inbounds, tunInboundTag)
+	}
+	if cfg.Transparent.Enabled {
+		inbounds = append(inbounds, transparentInboundTag)
+	}
+	for idx, rc := range cfg.Rules {
+		var action option.RuleAction
+		switch {
+		case rc.Group == config.RuleGroupDirect:
+			action = option.RuleAction{Action: C.RuleActionTypeDirect}
+		case rc.Group == config.RuleGroupSticky:
+			action = routeTo(StickyPoolTag)
+		case len(groupMembers[rc.Group]) > 0:
+			tag, ok := groupPools[rc.Group]
+			if !ok {
+				members := groupMembers[rc.Group]
+				groupMeta := make(map[string]poolout.MemberMeta, len(members))
+				for _, member := range members {
+					groupMeta[member] = metadata[member]
+				}
+				tag = GroupPoolTag(rc.Group)
+				groupOptions := poolOptionsFor(cfg, cfg.PoolFor(rc.Group).Mode, members, groupMeta)
+				outbounds = append(outbounds, option.Outbound{
+					Type:    poolout.Type,
+					Tag:     tag,
+					Options: &groupOptions,
+				})
+				groupPools[rc.Group] = tag
+			}
+			action = routeTo(tag)
+		case regionPools[rc.Group] != "":
+			action = routeTo(regionPools[rc.Group])
+		default:
+			log.Printf("⚠️  rules[%d]: group %q has no available nodes, rule skipped", idx, rc.Group)
+			continue
+		}
+
+		if len(rc.Method) > 0 {
+			// Matched per request by the entry front, which dials the
+			// pool built above through its registered dialer.
+			log.Printf("🔀 Rule %d: %s → %s (plain HTTP)", idx+1, describeRule(rc), rc.Group)
+			continue
+		}
+
+		cidrs := append([]string(nil), rc.IPCIDR...)
+		if len(rc.GeoIP) > 0 {
+			countryCIDRs, err := geoip.CountryCIDRs(cfg.GeoIP.DatabasePath, rc.GeoIP)
+			if err != nil {
+				return nil, nil, fmt.Errorf("rules[%d]: %w", idx, err)
+			}
+			if len(countryCIDRs) == 0 {
+				log.Printf("⚠️  rules[%d]: no networks found for geoip %v", idx, rc.GeoIP)
+			}
+			cidrs = append(cidrs, countryCIDRs...)
+		}
+		if len(rc.DomainSuffix) == 0 && len(rc.DomainKeyword) == 0 && len(cidrs) == 0 {
+			continue
+		}
+
+		rules = append(rules, option.Rule{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultRule{
+				RawDefaultRule: option.RawDefaultRule{
+					Inbound:       inbounds,
+					DomainSuffix:  badoption.Listable[string](rc.DomainSuffix),
+					DomainKeyword: badoption.Listable[string](rc.DomainKeyword),
+					IPCIDR:        badoption.Listable[string](cidrs),
+				},
+				RuleAction: action,
+			},
+		})
+		log.Printf("🔀 Rule %d: %s → %s", idx+1, describeRule(rc), rc.Group)
+	}
+	if len(rules) == 0 {
+		return outbounds, nil, nil
+	}
+
+	// Sniff first so SOCKS clients that connect by IP still match domain rules.
+	sniff := option.Rule{
+		Type: C.RuleTypeDefault,
+		DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{
+				Inbound: badoption.Listable[string]{PoolInboundTag},
+			},
+			RuleAction: option.RuleAction{Action: C.RuleActionTypeSniff},
+		},
+	}
+	return outbounds, append([]option.Rule{sniff}, rules...), nil
+}
+
+func routeTo(outbound string) option.RuleAction {
+	return option.RuleAction{
+		Action: C.RuleActionTypeRoute,
+		RouteOptions: option.RouteActionOptions{
+			Outbound: outbound,
+		},
+	}
+}
+
+func describeRule(rc config.RuleConfig) string {
+	var parts []string
+	if len(rc.Method) > 0 {
+		parts = append(parts, "method="+strings.Join(rc.Method, ","))
+	}
+	if len(rc.DomainSuffix) > 0 {
+		parts = append(parts, "domain_suffix="+strings.Join(rc.DomainSuffix, ","))
+	}
+	if len(rc.DomainKeyword) > 0 {
+		parts = append(parts, "domain_keyword="+strings.Join(rc.DomainKeyword, ","))
+	}
+	if len(rc.IPCIDR) > 0 {
+		parts = append(parts, "ip_cidr="+strings.Join(rc.IPCIDR, ","))
+	}
+	if len(rc.GeoIP) > 0 {
+		parts = append(parts, "geoip="+strings.Join(rc.GeoIP, ","))
+	}
+	return strings.Join(parts, " ")
+}
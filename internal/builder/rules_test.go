@@ -0,0 +1,60 @@
+package builder
+
+import (
+	"testing"
+
+	"easy_proxies/internal/config"
+	poolout "easy_proxies/internal/outbound/pool"
+
+	C "github.com/sagernet/sing-box/constant"
+)
+
+func TestBuildRoutingRules(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Mode: "sequential"},
+		Rules: []config.RuleConfig{
+			{DomainSuffix: []string{"example.com"}, Group: "us"},
+			{IPCIDR: []string{"10.0.0.0/8"}, Group: config.RuleGroupDirect},
+			{DomainKeyword: []string{"google"}, Group: "jp"},
+			{DomainSuffix: []string{"example.org"}, Group: "missing"},
+			{DomainKeyword: []string{"example"}, Group: "us"},
+		},
+	}
+	groups := map[string][]string{"us": {"us-1", "us-2"}}
+	regions := map[string]string{"jp": "pool-jp"}
+	meta := map[string]poolout.MemberMeta{"us-1": {Name: "us-1"}, "us-2": {Name: "us-2"}}
+
+	outbounds, rules, err := buildRoutingRules(cfg, groups, regions, meta)
+	if err != nil {
+		t.Fatalf("buildRoutingRules: %v", err)
+	}
+	if len(outbounds) != 1 || outbounds[0].Tag != GroupPoolTag("us") {
+		t.Fatalf("expected a single group pool outbound, got %+v", outbounds)
+	}
+	if opts := outbounds[0].Options.(*poolout.Options); len(opts.Members) != 2 {
+		t.Fatalf("expected 2 group members, got %v", opts.Members)
+	}
+
+	// sniff + 4 rules (the rule targeting a missing group is skipped)
+	if len(rules) != 5 {
+		t.Fatalf("expected 5 route rules, got %d", len(rules))
+	}
+	if rules[0].DefaultOptions.Action != C.RuleActionTypeSniff {
+		t.Fatalf("expected sniff rule first, got %q", rules[0].DefaultOptions.Action)
+	}
+	want := []struct{ action, outbound string }{
+		{C.RuleActionTypeRoute, GroupPoolTag("us")},
+		{C.RuleActionTypeDirect, ""},
+		{C.RuleActionTypeRoute, "pool-jp"},
+		{C.RuleActionTypeRoute, GroupPoolTag("us")},
+	}
+	for i, w := range want {
+		rule := rules[i+1].DefaultOptions
+		if rule.Action != w.action || rule.RouteOptions.Outbound != w.outbound {
+			t.Fatalf("rule %d: expected %s %q, got %s %q", i, w.action, w.outbound, rule.Action, rule.RouteOptions.Outbound)
+		}
+		if len(rule.Inbound) != 1 || rule.Inbound[0] != PoolInboundTag {
+			t.Fatalf("rule %d: expected to be scoped to %s, got %v", i, PoolInboundTag, rule.Inbound)
+		}
+	}
+}
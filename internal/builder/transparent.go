@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"fmt"
+
+	"easy_proxies/internal/config"
+	"easy_proxies/internal/handoff"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// transparentInboundTag is the tag of the optional REDIRECT/TPROXY inbound.
+const transparentInboundTag = "transparent-in"
+
+// buildTransparentInbound builds the inbound for traffic redirected to this
+// host by iptables/nftables. Like the TUN inbound, what it accepts follows
+// the normal pool route (route.Final and the routing rules).
+func buildTransparentInbound(cfg *config.Config) (option.Inbound, error) {
+	t := cfg.Transparent
+	listenAddr, err := parseAddr(t.Listen)
+	if err != nil {
+		return option.Inbound{}, fmt.Errorf("parse transparent.listen: %w", err)
+	}
+	listen := option.ListenOptions{Listen: listenAddr, ListenPort: t.Port, ReuseAddr: handoff.Supported()}
+	if t.Mode == config.TransparentTProxy {
+		// An empty network list accepts both TCP and UDP.
+		return option.Inbound{
+			Type:    C.TypeTProxy,
+			Tag:     transparentInboundTag,
+			Options: &option.TProxyInboundOptions{ListenOptions: listen},
+		}, nil
+	}
+	return option.Inbound{
+		Type:    C.TypeRedirect,
+		Tag:     transparentInboundTag,
+		Options: &option.RedirectInboundOptions{ListenOptions: listen},
+	}, nil
+}
+
+// transparentRules are evaluated before any other rule for redirected
+// traffic. Its destinations are bare IP addresses, so it is sniffed for
+// domain rules to match; DNS is answered locally and LAN destinations are
+// never sent through the pool, as for the TUN inbound.
+func transparentRules() []option.Rule {
+	scope := option.RawDefaultRule{Inbound: badoption.Listable[string]{transparentInboundTag}}
+	dns := scope
+	dns.Protocol = badoption.Listable[string]{C.ProtocolDNS}
+	private := scope
+	private.IPIsPrivate = true
+	return []option.Rule{
+		{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: scope,
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeSniff},
+		}},
+		{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: dns,
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeHijackDNS},
+		}},
+		{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: private,
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeDirect},
+		}},
+	}
+}
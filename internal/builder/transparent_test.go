@@ -0,0 +1,47 @@
+package builder
+
+import (
+	"testing"
+
+	"easy_proxies/internal/config"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestBuildTransparentInbound(t *testing.T) {
+	cfg := &config.Config{Transparent: config.TransparentConfig{Enabled: true, Mode: config.TransparentRedirect, Listen: "0.0.0.0", Port: 7892}}
+	inbound, err := buildTransparentInbound(cfg)
+	if err != nil {
+		t.Fatalf("buildTransparentInbound: %v", err)
+	}
+	if inbound.Type != C.TypeRedirect || inbound.Tag != transparentInboundTag {
+		t.Fatalf("unexpected inbound %s/%s", inbound.Type, inbound.Tag)
+	}
+	if opts := inbound.Options.(*option.RedirectInboundOptions); opts.ListenPort != 7892 || opts.Listen == nil {
+		t.Fatalf("listen options not applied: %+v", opts.ListenOptions)
+	}
+
+	cfg.Transparent.Mode = config.TransparentTProxy
+	cfg.Transparent.Port = 7893
+	inbound, err = buildTransparentInbound(cfg)
+	if err != nil {
+		t.Fatalf("buildTransparentInbound: %v", err)
+	}
+	opts, ok := inbound.Options.(*option.TProxyInboundOptions)
+	if inbound.Type != C.TypeTProxy || !ok || opts.ListenPort != 7893 || len(opts.Network.Build()) != 2 {
+		t.Fatalf("unexpected tproxy inbound %s %+v", inbound.Type, inbound.Options)
+	}
+}
+
+func TestTransparentRulesScopeToInbound(t *testing.T) {
+	rules := transparentRules()
+	if len(rules) != 3 || rules[0].DefaultOptions.Action != C.RuleActionTypeSniff {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	for _, rule := range rules {
+		if got := rule.DefaultOptions.Inbound; len(got) != 1 || got[0] != transparentInboundTag {
+			t.Fatalf("rule not scoped to the transparent inbound: %v", got)
+		}
+	}
+}
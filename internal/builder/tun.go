@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"fmt"
+	"net/netip"
+
+	"easy_proxies/internal/config"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+// tunInboundTag is the tag of the optional TUN inbound.
+const tunInboundTag = "tun-in"
+
+// buildTUNInbound builds the TUN inbound from cfg.TUN. Traffic it captures
+// follows the normal pool route (route.Final and the routing rules).
+//
+// ICMP never reaches the router: every sing-tun stack answers echo requests
+// itself, which is what we want since no pool protocol can relay ICMP and
+// OS connectivity probes would otherwise report the network as down.
+func buildTUNInbound(cfg *config.Config) (option.Inbound, error) {
+	t := cfg.TUN
+	address, err := parsePrefixes(t.Address)
+	if err != nil {
+		return option.Inbound{}, fmt.Errorf("tun address: %w", err)
+	}
+	include, err := parsePrefixes(t.RouteAddress)
+	if err != nil {
+		return option.Inbound{}, fmt.Errorf("tun route_address: %w", err)
+	}
+	exclude, err := parsePrefixes(t.RouteExcludeAddress)
+	if err != nil {
+		return option.Inbound{}, fmt.Errorf("tun route_exclude_address: %w", err)
+	}
+	return option.Inbound{
+		Type: C.TypeTun,
+		Tag:  tunInboundTag,
+		Options: &option.TunInboundOptions{
+			InterfaceName:       t.InterfaceName,
+			MTU:                 t.MTU,
+			Address:             address,
+			AutoRoute:           t.AutoRouteOrDefault(),
+			StrictRoute:         t.StrictRoute,
+			RouteAddress:        include,
+			RouteExcludeAddress: exclude,
+			Stack:               t.Stack,
+		},
+	}, nil
+}
+
+// tunRules are evaluated before any other rule for TUN traffic: sniff so
+// domain rules can match, answer DNS locally, keep LAN traffic off the pool
+// and apply the domain/process part of split tunneling.
+func tunRules(split config.SplitTunnelConfig) []option.Rule {
+	tunOnly := option.RawDefaultRule{Inbound: badoption.Listable[string]{tunInboundTag}}
+	dns := tunOnly
+	dns.Protocol = badoption.Listable[string]{C.ProtocolDNS}
+	private := tunOnly
+	private.IPIsPrivate = true
+	rules := []option.Rule{
+		{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: tunOnly,
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeSniff},
+		}},
+		{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: dns,
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeHijackDNS},
+		}},
+		{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: private,
+			RuleAction:     option.RuleAction{Action: C.RuleActionTypeDirect},
+		}},
+	}
+	return append(rules, splitTunnelRules(tunOnly, split)...)
+}
+
+// splitTunnelRules sends excluded domains and processes direct. When include
+// lists are set, everything matching none of them goes direct as well, so
+// only the listed domains or programs reach the pool.
+func splitTunnelRules(scope option.RawDefaultRule, split config.SplitTunnelConfig) []option.Rule {
+	direct := option.RuleAction{Action: C.RuleActionTypeDirect}
+	var rules []option.Rule
+	if len(split.ExcludeDomain) > 0 {
+		r := scope
+		r.DomainSuffix = split.ExcludeDomain
+		rules = append(rules, option.Rule{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{RawDefaultRule: r, RuleAction: direct}})
+	}
+	if len(split.ExcludeProcess) > 0 {
+		r := scope
+		r.ProcessPath = split.ExcludeProcess
+		rules = append(rules, option.Rule{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{RawDefaultRule: r, RuleAction: direct}})
+	}
+
+	var included []option.Rule
+	if len(split.IncludeDomain) > 0 {
+		included = append(included, option.Rule{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{DomainSuffix: split.IncludeDomain},
+		}})
+	}
+	if len(split.IncludeProcess) > 0 {
+		included = append(included, option.Rule{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{
+			RawDefaultRule: option.RawDefaultRule{ProcessPath: split.IncludeProcess},
+		}})
+	}
+	if len(included) > 0 {
+		// scope AND NOT (any include list) -> direct
+		rules = append(rules, option.Rule{Type: C.RuleTypeLogical, LogicalOptions: option.LogicalRule{
+			RawLogicalRule: option.RawLogicalRule{Mode: C.LogicalTypeAnd, Rules: []option.Rule{
+				{Type: C.RuleTypeDefault, DefaultOptions: option.DefaultRule{RawDefaultRule: scope}},
+				{Type: C.RuleTypeLogical, LogicalOptions: option.LogicalRule{
+					RawLogicalRule: option.RawLogicalRule{Mode: C.LogicalTypeOr, Rules: included, Invert: true},
+				}},
+			}},
+			RuleAction: direct,
+		}})
+	}
+	return rules
+}
+
+func parsePrefixes(values []string) (badoption.Listable[netip.Prefix], error) {
+	prefixes := make(badoption.Listable[netip.Prefix], 0, len(values))
+	for _, value := range values {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
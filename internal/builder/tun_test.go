@@ -0,0 +1,70 @@
+package builder
+
+import (
+	"testing"
+
+	"easy_proxies/internal/config"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+func TestBuildTUNInbound(t *testing.T) {
+	autoRoute := false
+	cfg := &config.Config{TUN: config.TUNConfig{
+		Enabled:   true,
+		Address:   []string{"172.19.0.1/30"},
+		MTU:       1500,
+		Stack:     "system",
+		AutoRoute: &autoRoute,
+		SplitTunnelConfig: config.SplitTunnelConfig{
+			RouteExcludeAddress: []string{"192.168.0.0/16"},
+		},
+	}}
+	inbound, err := buildTUNInbound(cfg)
+	if err != nil {
+		t.Fatalf("buildTUNInbound: %v", err)
+	}
+	if inbound.Type != C.TypeTun || inbound.Tag != tunInboundTag {
+		t.Fatalf("unexpected inbound %s/%s", inbound.Type, inbound.Tag)
+	}
+	opts := inbound.Options.(*option.TunInboundOptions)
+	if opts.AutoRoute || opts.MTU != 1500 || opts.Stack != "system" {
+		t.Fatalf("options not applied: %+v", opts)
+	}
+	if len(opts.Address) != 1 || opts.Address[0].String() != "172.19.0.1/30" {
+		t.Fatalf("unexpected address %v", opts.Address)
+	}
+	if len(opts.RouteExcludeAddress) != 1 || opts.RouteExcludeAddress[0].String() != "192.168.0.0/16" {
+		t.Fatalf("unexpected route_exclude_address %v", opts.RouteExcludeAddress)
+	}
+}
+
+func TestSplitTunnelRules(t *testing.T) {
+	if rules := tunRules(config.SplitTunnelConfig{}); len(rules) != 3 {
+		t.Fatalf("expected only the base TUN rules, got %d", len(rules))
+	}
+
+	rules := tunRules(config.SplitTunnelConfig{
+		ExcludeDomain:  []string{"corp.example"},
+		ExcludeProcess: []string{"/usr/bin/ssh"},
+		IncludeDomain:  []string{"example.com"},
+	})
+	if len(rules) != 6 {
+		t.Fatalf("expected 6 rules, got %d", len(rules))
+	}
+	if got := rules[3].DefaultOptions.DomainSuffix; len(got) != 1 || got[0] != "corp.example" {
+		t.Fatalf("exclude_domain rule: %v", got)
+	}
+	if got := rules[4].DefaultOptions.ProcessPath; len(got) != 1 || got[0] != "/usr/bin/ssh" {
+		t.Fatalf("exclude_process rule: %v", got)
+	}
+	include := rules[5]
+	if include.Type != C.RuleTypeLogical || include.LogicalOptions.Action != C.RuleActionTypeDirect {
+		t.Fatalf("include rule should be a logical direct rule: %+v", include)
+	}
+	inner := include.LogicalOptions.Rules
+	if len(inner) != 2 || inner[0].DefaultOptions.Inbound[0] != tunInboundTag || !inner[1].LogicalOptions.Invert {
+		t.Fatalf("include rule must be scoped to TUN and inverted: %+v", inner)
+	}
+}
@@ -0,0 +1,240 @@
+// Package chaos injects artificial dial failures, latency and throttling
+// into chosen nodes, so that blacklisting, retries and alerts can be
+// checked before they are relied on.
+//
+// Injection is off unless the process is started with -chaos. Faults are
+// kept in memory only and apply to every pool the node belongs to, as well
+// as to its health probes and per-node checks.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrInjected is the error of a dial failed on purpose.
+	ErrInjected = errors.New("chaos: injected dial failure")
+	// ErrDisabled is returned by Set when injection is off.
+	ErrDisabled = errors.New("chaos: fault injection is disabled (start with -chaos)")
+)
+
+// Fault is what is injected into one node.
+type Fault struct {
+	FailRate     float64       // share of dials that fail, 0 to 1
+	Latency      time.Duration // added to every dial
+	ThrottleKBps int64         // per-connection cap in KB/s, each way; TCP only
+	Until        time.Time     // zero keeps the fault until it is cleared
+}
+
+// Entry is a fault and the node it applies to.
+type Entry struct {
+	Node string
+	Fault
+}
+
+var (
+	enabled atomic.Bool
+	mu      sync.RWMutex
+	faults  = map[string]Fault{}
+
+	rngMu sync.Mutex
+	rng   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Enable turns fault injection on for the life of the process.
+func Enable() {
+	enabled.Store(true)
+}
+
+// Enabled reports whether fault injection is on.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Set replaces the fault of node.
+func Set(node string, f Fault) error {
+	if !Enabled() {
+		return ErrDisabled
+	}
+	if f.FailRate < 0 || f.FailRate > 1 {
+		return fmt.Errorf("fail_rate must be between 0 and 1, got %v", f.FailRate)
+	}
+	if f.Latency < 0 {
+		return fmt.Errorf("latency must be >= 0, got %s", f.Latency)
+	}
+	if f.ThrottleKBps < 0 {
+		return fmt.Errorf("throttle_kbps must be >= 0, got %d", f.ThrottleKBps)
+	}
+	mu.Lock()
+	faults[node] = f
+	mu.Unlock()
+	return nil
+}
+
+// Clear removes the fault of node and reports whether there was one.
+func Clear(node string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := faults[node]
+	delete(faults, node)
+	return ok
+}
+
+// ClearAll removes every fault.
+func ClearAll() {
+	mu.Lock()
+	faults = map[string]Fault{}
+	mu.Unlock()
+}
+
+// List returns the faults in effect, ordered by node.
+func List() []Entry {
+	now := time.Now()
+	mu.RLock()
+	list := make([]Entry, 0, len(faults))
+	for node, f := range faults {
+		if f.expired(now) {
+			continue
+		}
+		list = append(list, Entry{Node: node, Fault: f})
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Node < list[j].Node })
+	return list
+}
+
+func (f Fault) expired(now time.Time) bool {
+	return !f.Until.IsZero() && now.After(f.Until)
+}
+
+func lookup(node string) (Fault, bool) {
+	if !Enabled() {
+		return Fault{}, false
+	}
+	mu.RLock()
+	f, ok := faults[node]
+	mu.RUnlock()
+	if !ok || f.expired(time.Now()) {
+		return Fault{}, false
+	}
+	return f, true
+}
+
+// Dial applies the fault of node to a dial about to be made through it:
+// it waits for the injected latency and then fails the dial at the
+// configured rate with ErrInjected.
+func Dial(ctx context.Context, node string) error {
+	f, ok := lookup(node)
+	if !ok {
+		return nil
+	}
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if f.FailRate > 0 {
+		rngMu.Lock()
+		fail := rng.Float64() < f.FailRate
+		rngMu.Unlock()
+		if fail {
+			return ErrInjected
+		}
+	}
+	return nil
+}
+
+// WrapConn throttles c when node has a throttle fault, and returns c as is
+// otherwise. The rate is fixed when the connection is made.
+func WrapConn(c net.Conn, node string) net.Conn {
+	f, ok := lookup(node)
+	if !ok || f.ThrottleKBps <= 0 {
+		return c
+	}
+	rate := f.ThrottleKBps * 1024
+	return &throttledConn{Conn: c, read: newPacer(rate), write: newPacer(rate)}
+}
+
+type throttledConn struct {
+	net.Conn
+	read, write *pacer
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if len(b) > c.read.chunk() {
+		b = b[:c.read.chunk()]
+	}
+	n, err := c.Conn.Read(b)
+	c.read.wait(n)
+	return n, err
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > c.write.chunk() {
+			chunk = chunk[:c.write.chunk()]
+		}
+		c.write.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// pacer holds a byte stream to rate bytes per second on average.
+type pacer struct {
+	mu    sync.Mutex
+	rate  int64
+	start time.Time
+	total int64
+}
+
+func newPacer(rate int64) *pacer {
+	return &pacer{rate: rate, start: time.Now()}
+}
+
+// chunk is the largest read or write passed through at once, a tenth of a
+// second's worth, so the pace stays even.
+func (p *pacer) chunk() int {
+	if c := p.rate / 10; c > 0 {
+		return int(c)
+	}
+	return 1
+}
+
+// wait records n bytes and sleeps until they are due at the rate. An idle
+// connection builds up at most one second of credit.
+func (p *pacer) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.total += int64(n)
+	due := p.start.Add(time.Duration(float64(p.total) / float64(p.rate) * float64(time.Second)))
+	if lag := time.Since(due); lag > time.Second {
+		p.start = p.start.Add(lag - time.Second)
+		due = due.Add(lag - time.Second)
+	}
+	p.mu.Unlock()
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,97 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSetRequiresEnable(t *testing.T) {
+	enabled.Store(false)
+	defer ClearAll()
+	if err := Set("a", Fault{FailRate: 1}); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("expected ErrDisabled, got %v", err)
+	}
+	if err := Dial(context.Background(), "a"); err != nil {
+		t.Fatalf("nothing should be injected while disabled, got %v", err)
+	}
+}
+
+func TestDialInjectsFailuresAndLatency(t *testing.T) {
+	Enable()
+	defer ClearAll()
+	if err := Set("a", Fault{FailRate: 2}); err == nil {
+		t.Fatal("expected fail_rate above 1 to be rejected")
+	}
+	if err := Set("a", Fault{FailRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set("slow", Fault{Latency: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dial(context.Background(), "a"); !errors.Is(err, ErrInjected) {
+		t.Fatalf("expected ErrInjected, got %v", err)
+	}
+	if err := Dial(context.Background(), "b"); err != nil {
+		t.Fatalf("other nodes should be untouched, got %v", err)
+	}
+	start := time.Now()
+	if err := Dial(context.Background(), "slow"); err != nil || time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("expected a 50ms delay without error, got %v after %s", err, time.Since(start))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Dial(ctx, "slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("a cancelled dial should stop waiting, got %v", err)
+	}
+
+	if !Clear("a") || Clear("a") {
+		t.Fatal("Clear should report whether a fault was removed")
+	}
+	if list := List(); len(list) != 1 || list[0].Node != "slow" {
+		t.Fatalf("unexpected faults %+v", list)
+	}
+}
+
+func TestFaultsExpire(t *testing.T) {
+	Enable()
+	defer ClearAll()
+	if err := Set("a", Fault{FailRate: 1, Until: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dial(context.Background(), "a"); err != nil {
+		t.Fatalf("an expired fault should not apply, got %v", err)
+	}
+	if list := List(); len(list) != 0 {
+		t.Fatalf("expired faults should not be listed, got %+v", list)
+	}
+}
+
+func TestWrapConnThrottles(t *testing.T) {
+	Enable()
+	defer ClearAll()
+	server, client := net.Pipe()
+	defer server.Close()
+	if got := WrapConn(client, "a"); got != client {
+		t.Fatal("a node without a throttle should keep its connection")
+	}
+	if err := Set("a", Fault{ThrottleKBps: 100}); err != nil {
+		t.Fatal(err)
+	}
+	conn := WrapConn(client, "a")
+	defer conn.Close()
+
+	go func() {
+		_, _ = server.Write(make([]byte, 30*1024))
+		server.Close()
+	}()
+	start := time.Now()
+	n, _ := io.Copy(io.Discard, conn)
+	// 30KB at 100KB/s takes about 300ms.
+	if elapsed := time.Since(start); n != 30*1024 || elapsed < 250*time.Millisecond {
+		t.Fatalf("read %d bytes in %s, expected throttling", n, elapsed)
+	}
+}
@@ -0,0 +1,84 @@
+// Package clock is the time source for timers that must not be thrown off
+// by wall clock changes. An NTP step or a manual date change does not move
+// it, and on Linux it keeps counting while the system is suspended, so a
+// 24h blacklist ends 24 real hours later even across a laptop sleep.
+//
+// Times from Now carry a monotonic reading and must only be compared with
+// other times from Now. Convert with Wall before showing or storing them,
+// and with FromWall when reading a stored wall time back.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	processStart = time.Now()
+	startBoot    = bootElapsed()
+)
+
+// Now returns the current time on the clock.
+func Now() time.Time {
+	return processStart.Add(bootElapsed() - startBoot)
+}
+
+// Since returns the time elapsed on the clock since t, which must come
+// from Now.
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// Wall converts a time from Now to the current wall clock.
+func Wall(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Now().Add(t.Sub(Now())).Round(0)
+}
+
+// FromWall converts a wall clock time to the clock, so that it can be
+// compared with Now.
+func FromWall(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return Now().Add(time.Until(t))
+}
+
+// Jump describes a discontinuity noticed by Watch.
+type Jump struct {
+	// Wall is how far the wall clock moved beyond the elapsed time, e.g.
+	// after an NTP step. Negative when it went back.
+	Wall time.Duration
+	// Suspend is how long the system was asleep, where that can be told.
+	Suspend time.Duration
+}
+
+// Watch calls fn from its own goroutine whenever, between two checks
+// interval apart, the wall clock jumped or the system was suspended by
+// more than threshold. It returns when ctx is done.
+func Watch(ctx context.Context, interval, threshold time.Duration, fn func(Jump)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		prevWall, prevMono, prevBoot := time.Now().Round(0), time.Now(), bootElapsed()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			wall, mono, boot := time.Now().Round(0), time.Now(), bootElapsed()
+			elapsed := boot - prevBoot
+			jump := Jump{
+				Wall:    wall.Sub(prevWall) - elapsed,
+				Suspend: elapsed - mono.Sub(prevMono),
+			}
+			prevWall, prevMono, prevBoot = wall, mono, boot
+			if jump.Wall > threshold || jump.Wall < -threshold || jump.Suspend > threshold {
+				fn(jump)
+			}
+		}
+	}()
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package clock
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// bootElapsed reads CLOCK_BOOTTIME, which unlike Go's monotonic clock keeps
+// counting while the system is suspended.
+func bootElapsed() time.Duration {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_BOOTTIME, &ts); err != nil {
+		return time.Since(processStart)
+	}
+	return time.Duration(ts.Nano())
+}
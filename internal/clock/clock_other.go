@@ -0,0 +1,11 @@
+//go:build !linux
+
+package clock
+
+import "time"
+
+// bootElapsed falls back to Go's monotonic clock, which ignores wall clock
+// changes but may stop while the system is suspended.
+func bootElapsed() time.Duration {
+	return time.Since(processStart)
+}
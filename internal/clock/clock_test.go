@@ -0,0 +1,33 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNowAdvances(t *testing.T) {
+	a := Now()
+	time.Sleep(10 * time.Millisecond)
+	b := Now()
+	if d := b.Sub(a); d < 10*time.Millisecond || d > time.Second {
+		t.Fatalf("Now advanced by %s over a 10ms sleep", d)
+	}
+	if d := Since(a); d < 10*time.Millisecond {
+		t.Fatalf("Since = %s", d)
+	}
+}
+
+func TestWallRoundTrip(t *testing.T) {
+	deadline := Now().Add(time.Hour)
+	wall := Wall(deadline)
+	if d := time.Until(wall); d < 59*time.Minute || d > 61*time.Minute {
+		t.Fatalf("Wall(deadline) is %s away, want about 1h", d)
+	}
+	back := FromWall(wall)
+	if d := back.Sub(deadline); d < -time.Second || d > time.Second {
+		t.Fatalf("FromWall(Wall(t)) is off by %s", d)
+	}
+	if !Wall(time.Time{}).IsZero() || !FromWall(time.Time{}).IsZero() {
+		t.Fatal("zero times must stay zero")
+	}
+}
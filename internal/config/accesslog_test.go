@@ -0,0 +1,30 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeAccessLog(t *testing.T) {
+	c := &Config{filePath: "/etc/easy_proxies/config.yaml"}
+	c.AccessLog.LogFormat = "TEXT"
+	if err := c.normalizeAccessLog(); err != nil {
+		t.Fatal(err)
+	}
+	a := c.AccessLog
+	if a.LogFormat != AccessLogFormatText {
+		t.Fatalf("format = %q, want text", a.LogFormat)
+	}
+	if want := filepath.Join("/etc/easy_proxies", "logs/access.log"); a.File != want {
+		t.Fatalf("file = %q, want %q", a.File, want)
+	}
+	if a.MaxSize != 100 || a.MaxBackups != 7 || a.MaxAge != 30 {
+		t.Fatalf("unexpected defaults: %+v", a)
+	}
+
+	c = &Config{}
+	c.AccessLog.LogFormat = "csv"
+	if err := c.normalizeAccessLog(); err == nil {
+		t.Fatal("expected error for unknown log_format")
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestNodeBind(t *testing.T) {
+	cfg := &Config{
+		Mode:      "hybrid",
+		MultiPort: MultiPortConfig{Interface: " wan1 ", BindAddress: "192.0.2.1"},
+		Nodes: []NodeConfig{
+			{Name: "a", URI: "socks5://a:1080"},
+			{Name: "b", URI: "socks5://b:1080", Interface: "wan2", BindAddress: " 2001:db8::2 "},
+		},
+	}
+	if err := cfg.normalizeNodeBinds(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if iface, addr := cfg.NodeBind(cfg.Nodes[0]); iface != "wan1" || addr != "192.0.2.1" {
+		t.Fatalf("expected the multi_port defaults, got %q %q", iface, addr)
+	}
+	if iface, addr := cfg.NodeBind(cfg.Nodes[1]); iface != "wan2" || addr != "2001:db8::2" {
+		t.Fatalf("expected the node's own bind, got %q %q", iface, addr)
+	}
+	cfg.Mode = "pool"
+	if iface, addr := cfg.NodeBind(cfg.Nodes[0]); iface != "" || addr != "" {
+		t.Fatalf("multi_port defaults should not apply in pool mode, got %q %q", iface, addr)
+	}
+
+	for _, bad := range []*Config{
+		{MultiPort: MultiPortConfig{BindAddress: "wan1"}},
+		{Nodes: []NodeConfig{{Name: "a", BindAddress: "192.0.2.1/24"}}},
+	} {
+		if err := bad.normalizeNodeBinds(); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeCluster(t *testing.T) {
+	cfg := &Config{
+		Management: ManagementConfig{Listen: "0.0.0.0:9090"},
+		Cluster:    ClusterConfig{Enabled: true, Secret: " s3cret ", Peers: []string{" http://10.0.0.2:9090/ "}},
+	}
+	if err := cfg.normalizeCluster(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cl := cfg.Cluster
+	if cl.Secret != "s3cret" || cl.Peers[0] != "http://10.0.0.2:9090" || cl.Interval != 10*time.Second {
+		t.Fatalf("cluster not normalized: %+v", cl)
+	}
+	if len(cfg.Warnings()) != 0 {
+		t.Fatalf("unexpected warnings: %v", cfg.Warnings())
+	}
+
+	disabled := false
+	for _, bad := range []*Config{
+		{Cluster: ClusterConfig{Enabled: true, Peers: []string{"http://10.0.0.2:9090"}}},
+		{Cluster: ClusterConfig{Enabled: true, Secret: "s", Peers: []string{"10.0.0.2:9090"}}},
+		{Cluster: ClusterConfig{Enabled: true, Secret: "s", Interval: -time.Second}},
+		{Management: ManagementConfig{Enabled: &disabled}, Cluster: ClusterConfig{Enabled: true, Secret: "s"}},
+	} {
+		if err := bad.normalizeCluster(); err == nil {
+			t.Errorf("expected error for %+v", bad.Cluster)
+		}
+	}
+
+	cfg = &Config{
+		Management: ManagementConfig{Listen: "127.0.0.1:9090"},
+		Cluster:    ClusterConfig{Enabled: true, Secret: "s"},
+	}
+	if err := cfg.normalizeCluster(); err != nil || len(cfg.Warnings()) != 2 {
+		t.Fatalf("expected warnings for no peers and a loopback listen (err=%v, warnings=%v)", err, cfg.Warnings())
+	}
+}
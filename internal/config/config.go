@@ -1,21 +1,31 @@
 package config
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"easy_proxies/internal/freebind"
+	"easy_proxies/internal/handoff"
+	"easy_proxies/internal/plugin"
+
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,18 +36,42 @@ type Config struct {
 	MultiPort           MultiPortConfig           `yaml:"multi_port"`
 	Pool                PoolConfig                `yaml:"pool"`
 	Sticky              StickyConfig              `yaml:"sticky"`
+	TUN                 TUNConfig                 `yaml:"tun"`
+	Transparent         TransparentConfig         `yaml:"transparent,omitempty"`  // 透明网关入口：接收 iptables REDIRECT/TPROXY 转发的流量（仅 Linux）
+	HTTPRewrite         HTTPRewriteConfig         `yaml:"http_rewrite,omitempty"` // 改写经代理转发的普通 HTTP 请求头（非 CONNECT）
 	Management          ManagementConfig          `yaml:"management"`
 	SubscriptionRefresh SubscriptionRefreshConfig `yaml:"subscription_refresh"`
 	GeoIP               GeoIPConfig               `yaml:"geoip"`
+	Rules               []RuleConfig              `yaml:"rules"`         // 按目标地址分流规则，自上而下匹配
+	DNS                 DNSConfig                 `yaml:"dns,omitempty"` // 目标域名解析：交给上游节点（默认）或本机解析
 	Log                 LogConfig                 `yaml:"log"`
+	AccessLog           AccessLogConfig           `yaml:"access_log"` // 每个代理连接一行的访问日志
 	Nodes               []NodeConfig              `yaml:"nodes"`
-	NodesFile           string                    `yaml:"nodes_file"`    // 节点文件路径，每行一个 URI
-	Subscriptions       []string                  `yaml:"subscriptions"` // 订阅链接列表
-	ExternalIP          string                    `yaml:"external_ip"`   // 外部 IP 地址，用于导出时替换 0.0.0.0
+	NodeTemplates       []NodeTemplate            `yaml:"node_templates,omitempty"` // 节点模板：URI 中的 [1-50] / [a,b] 范围在加载时展开
+	NodesFile           string                    `yaml:"nodes_file"`               // 节点文件路径，每行一个 URI
+	Subscriptions       []string                  `yaml:"subscriptions"`            // 订阅链接列表
+	Plugins             []PluginConfig            `yaml:"plugins,omitempty"`        // 外部协议插件：按 URI 协议名交给外部程序建立连接
+	ExternalIP          string                    `yaml:"external_ip"`              // 外部 IP 地址，用于导出时替换 0.0.0.0
 	LogLevel            string                    `yaml:"log_level"`
-	SkipCertVerify      bool                      `yaml:"skip_cert_verify"` // 全局跳过 SSL 证书验证
-
-	filePath string `yaml:"-"` // 配置文件路径，用于保存
+	ShutdownTimeout     time.Duration             `yaml:"shutdown_timeout"`             // 退出时等待在途连接结束的最长时间，默认 30s
+	Timezone            string                    `yaml:"timezone,omitempty"`           // 时区（IANA 名称，如 Asia/Shanghai），用于日志时间与统计按小时/天分桶，默认主机本地时区；修改后重启生效
+	SkipCertVerify      bool                      `yaml:"skip_cert_verify"`             // 全局跳过 SSL 证书验证
+	ResourceProfile     string                    `yaml:"resource_profile"`             // 资源档位: low(路由器/开发板) / default / high(大型服务器)
+	GOMAXPROCS          int                       `yaml:"gomaxprocs"`                   // 最大并行 CPU 数，0 表示按 resource_profile 默认
+	StatsFile           string                    `yaml:"stats_file,omitempty"`         // 统计快照文件：退出时保存用户流量与节点统计，启动时恢复，默认 stats.json（与配置文件同目录）
+	StatsHistory        StatsHistoryConfig        `yaml:"stats_history,omitempty"`      // 节点与用户统计的历史趋势（分钟 → 小时 → 天降采样）
+	SpeedTest           SpeedTestConfig           `yaml:"speed_test,omitempty"`         // 通过节点下载测速文件测量带宽（pool.mode: bandwidth 按结果调度）
+	LimitWarning        int                       `yaml:"limit_warning,omitempty"`      // 限制预警阈值（百分比，如 80）：并发连接、带宽、流量配额用到该比例时记录警告，0 关闭
+	Cluster             ClusterConfig             `yaml:"cluster,omitempty"`            // 多实例集群：经管理 API 互相同步节点健康、延迟与黑名单
+	StatusPage          StatusPageConfig          `yaml:"status_page,omitempty"`        // 无需登录的公开状态页：只显示节点池整体可用率与运行时长
+	NodeSnapshotFile    string                    `yaml:"node_snapshot_file,omitempty"` // 节点快照文件：每次成功读取 nodes_file 或订阅后保存，源暂时不可用时用它启动（降级状态），默认 nodes_snapshot.txt（与配置文件同目录）
+
+	filePath   string          `yaml:"-"` // 配置文件路径，用于保存
+	location   *time.Location  `yaml:"-"` // timezone 解析结果
+	warnings   []Warning       `yaml:"-"` // 规范化时收集的非致命警告
+	overridden map[string]bool `yaml:"-"` // 被环境变量或 -set 覆盖的配置路径，保存时保留文件中的值
+	degraded   string          `yaml:"-"` // 节点源不可用、改用快照启动的原因
+	snapshots  bool            `yaml:"-"` // 读取节点源时保存快照，源不可用时用快照（仅运行服务时）
 }
 
 // LogConfig controls log output and rotation.
@@ -50,6 +84,27 @@ type LogConfig struct {
 	Compress   bool   `yaml:"compress"`    // 是否压缩旧日志，默认 false
 }
 
+// AccessLogConfig controls the access log: one line per proxied connection
+// with client, user, target, node, traffic, duration and result.
+type AccessLogConfig struct {
+	Enabled        bool          `yaml:"enabled"`         // 是否记录访问日志
+	File           string        `yaml:"file"`            // 日志文件路径，默认 "logs/access.log"，"stdout" 输出到标准输出
+	LogFormat      string        `yaml:"log_format"`      // 日志格式: json(默认) / text
+	MaxSize        int           `yaml:"max_size"`        // 单个文件最大 MB，超过即切分，默认 100
+	RotateInterval time.Duration `yaml:"rotate_interval"` // 按时间切分间隔，如 24h，0 表示仅按大小切分
+	MaxBackups     int           `yaml:"max_backups"`     // 保留旧文件个数，默认 7
+	MaxAge         int           `yaml:"max_age"`         // 保留旧文件天数，默认 30
+	Compress       bool          `yaml:"compress"`        // 是否压缩旧文件
+	History        int           `yaml:"history"`         // 内存中保留最近多少条连接记录，供 /api/connections/export 导出 JSONL，0 关闭；不依赖 enabled
+	Tags           int           `yaml:"tags,omitempty"`  // 按连接标签（X-Proxy-Tag 或用户名 -tag- 后缀）汇总连接、失败与流量，最多跟踪的标签数，超出的计入 (other)，0 关闭；不依赖 enabled
+}
+
+// Access log formats (access_log.log_format).
+const (
+	AccessLogFormatJSON = "json"
+	AccessLogFormatText = "text"
+)
+
 // GeoIPConfig controls GeoIP-based region routing.
 type GeoIPConfig struct {
 	Enabled            bool          `yaml:"enabled"`              // 是否启用 GeoIP 地域分区
@@ -58,14 +113,124 @@ type GeoIPConfig struct {
 	Port               uint16        `yaml:"port"`                 // GeoIP 路由监听端口，默认 1221
 	AutoUpdateEnabled  bool          `yaml:"auto_update_enabled"`  // 是否启用自动更新数据库
 	AutoUpdateInterval time.Duration `yaml:"auto_update_interval"` // 自动更新间隔，默认 24 小时
+	ASNDatabasePath    string        `yaml:"asn_database_path"`    // GeoLite2-ASN.mmdb 路径（可选），用于查询节点出口 IP 的 ASN
+	Freebind           bool          `yaml:"freebind,omitempty"`   // 允许监听尚未分配到本机的地址（VIP 漂移），仅 Linux
+}
+
+// RuleConfig routes pool-entry traffic whose destination matches any of the
+// listed conditions to a node group, a GeoIP region pool or DIRECT.
+type RuleConfig struct {
+	DomainSuffix  []string `yaml:"domain_suffix,omitempty"`  // 域名后缀，如 example.com
+	DomainKeyword []string `yaml:"domain_keyword,omitempty"` // 域名关键字
+	IPCIDR        []string `yaml:"ip_cidr,omitempty"`        // 目标 IP 段
+	GeoIP         []string `yaml:"geoip,omitempty"`          // 目标 IP 所属国家 ISO 代码，如 CN、US
+	// Method makes the rule match plain (non-CONNECT) HTTP requests on the
+	// pool entry by method, with domain_suffix and domain_keyword matched
+	// against the Host header. Such rules are applied by the entry front
+	// before the others, request by request.
+	Method []string `yaml:"method,omitempty"` // HTTP 方法，如 POST；仅匹配 pool 入口的明文 HTTP 请求
+	Group  string   `yaml:"group"`            // 目标: 节点分组名 / 地域代码(jp, us...) / direct / sticky
+}
+
+// Special rule targets: RuleGroupDirect bypasses the proxy pool and
+// RuleGroupSticky uses the sticky pool, which keeps each client IP on one
+// node.
+const (
+	RuleGroupDirect = "direct"
+	RuleGroupSticky = "sticky"
+)
+
+// HTTPRules returns the rules that match plain HTTP requests by method.
+func (c *Config) HTTPRules() []RuleConfig {
+	var rules []RuleConfig
+	for _, rule := range c.Rules {
+		if len(rule.Method) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
 }
 
 // ListenerConfig defines how the HTTP/SOCKS5 mixed proxy should listen for clients.
 type ListenerConfig struct {
-	Address  string `yaml:"address"`
-	Port     uint16 `yaml:"port"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Address  string       `yaml:"address"`
+	Port     uint16       `yaml:"port"`
+	Username string       `yaml:"username"`
+	Password string       `yaml:"password"`
+	Users    []UserConfig `yaml:"users,omitempty"` // 多用户认证，设置后替代 username/password
+	// Tiers are credential tiers that listener.users join with tier: each
+	// tier limits its users to some node groups and sets their default
+	// limits.
+	Tiers map[string]TierConfig `yaml:"tiers,omitempty"` // 用户等级：可用节点分组及默认限制
+	// Freebind lets the pool and sticky entries listen on an address that is
+	// not assigned yet: they are bound after startup and retried until the
+	// address appears.
+	Freebind bool `yaml:"freebind,omitempty"` // 地址尚未分配时延迟绑定并重试（VIP 漂移）
+	// NodePinning also accepts "<user>-node-<name>" and "<user>-group-<group>"
+	// usernames, pinning that request to one node or group.
+	NodePinning bool `yaml:"node_pinning,omitempty"` // 用户名后缀指定节点/分组
+	// MaxConnsPerIP caps concurrent connections of one client IP, and
+	// MaxNewConnsPerSec the connections each entry admits per second.
+	MaxConnsPerIP     int `yaml:"max_conns_per_ip,omitempty"`      // 单个客户端 IP 最大并发连接数
+	MaxNewConnsPerSec int `yaml:"max_new_conns_per_sec,omitempty"` // 每个入口每秒最多接受的新连接数
+	// ErrorDetail makes the 502 responses easy_proxies writes itself (GeoIP
+	// entry, HTTP method rules) carry the nodes tried, an error class and a
+	// retry hint as JSON and X-Proxy-Error headers.
+	ErrorDetail bool `yaml:"error_detail,omitempty"` // 502 响应附带结构化错误：尝试的节点、错误类别与重试建议
+	// TLS serves the pool and sticky entries over TLS (HTTP and SOCKS5
+	// inside the tunnel).
+	TLS TLSConfig `yaml:",inline"`
+}
+
+// UserConfig is one pool-entry account with optional limits. Zero limits
+// mean unlimited.
+type UserConfig struct {
+	Username       string `yaml:"username"`
+	Password       string `yaml:"password"`
+	RateLimitKBps  int64  `yaml:"rate_limit_kbps,omitempty"` // 限速（KB/s，上下行合计）
+	MaxConnections int    `yaml:"max_connections,omitempty"` // 最大并发连接数
+	QuotaMB        int64  `yaml:"quota_mb,omitempty"`        // 流量配额（MB，进程重启后清零）
+	Tier           string `yaml:"tier,omitempty"`            // 所属等级（listener.tiers），未设置的限制沿用等级的值
+}
+
+// TierConfig is a credential tier. Groups are the node groups (nodes[].group)
+// its users may use, and may overlap with other tiers; empty allows every
+// node. The limits apply to each user of the tier that does not set its own.
+type TierConfig struct {
+	Groups         []string `yaml:"groups,omitempty"`          // 可用的节点分组，留空为全部节点
+	RateLimitKBps  int64    `yaml:"rate_limit_kbps,omitempty"` // 每个用户的默认限速（KB/s）
+	MaxConnections int      `yaml:"max_connections,omitempty"` // 每个用户的默认最大并发连接数
+	QuotaMB        int64    `yaml:"quota_mb,omitempty"`        // 每个用户的默认流量配额（MB）
+}
+
+// UserLimits returns the limits of u with unset ones taken from its tier.
+func (c *Config) UserLimits(u UserConfig) UserConfig {
+	tier, ok := c.Listener.Tiers[u.Tier]
+	if !ok {
+		return u
+	}
+	if u.RateLimitKBps == 0 {
+		u.RateLimitKBps = tier.RateLimitKBps
+	}
+	if u.MaxConnections == 0 {
+		u.MaxConnections = tier.MaxConnections
+	}
+	if u.QuotaMB == 0 {
+		u.QuotaMB = tier.QuotaMB
+	}
+	return u
+}
+
+// ListenerUsers returns the accounts accepted on the pool entry: listener.users
+// when set, otherwise the single listener.username/password (if any).
+func (c *Config) ListenerUsers() []UserConfig {
+	if len(c.Listener.Users) > 0 {
+		return c.Listener.Users
+	}
+	if c.Listener.Username != "" {
+		return []UserConfig{{Username: c.Listener.Username, Password: c.Listener.Password}}
+	}
+	return nil
 }
 
 // StickyConfig configures an optional dedicated sticky-session entry port.
@@ -90,6 +255,83 @@ type PoolConfig struct {
 	// For pools with multiple members, each retry picks a different member when possible.
 	// For single-member pools (e.g. per-node multi-port pools), retries dial the same member.
 	RetryAttempts int `yaml:"retry_attempts,omitempty"`
+	// MaxConnsPerNode caps concurrent tunnels through one upstream node; a
+	// node at its cap is skipped by the scheduler. nodes[].max_conns
+	// overrides it per node.
+	MaxConnsPerNode int `yaml:"max_conns_per_node,omitempty"`
+	// IdleTimeout closes tunnels that carried no bytes in either direction
+	// for this long, such as upstream connections a provider left half-open.
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"` // 隧道双向均无流量超过该时长即关闭，0 为不限制
+	// BlacklistFile keeps blacklisted nodes across restarts. Relative paths
+	// are resolved against the config directory.
+	BlacklistFile string `yaml:"blacklist_file,omitempty"` // 拉黑状态保存文件，默认 blacklist.json（与配置文件同目录）
+	// MaxRetries is the number of extra nodes tried after the first dial
+	// fails. When set it takes precedence: retry_attempts = max_retries + 1,
+	// and 0 disables retrying.
+	MaxRetries *int `yaml:"max_retries,omitempty"`
+	// HealthCheck configures the background prober that pulls failing nodes
+	// out of rotation independently of client request failures.
+	HealthCheck HealthCheckConfig `yaml:"health_check"`
+	// CircuitBreaker replaces the fixed blacklist_duration with half-open
+	// trials when enabled.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"` // 熔断：失败后定期放行单个试探请求，成功即恢复
+	// Groups overrides the scheduling and failure settings for the nodes of
+	// a group (nodes[].group). Unset fields inherit from the pool section.
+	Groups map[string]GroupPoolConfig `yaml:"groups,omitempty"` // 按节点分组覆盖调度策略
+	// Seed makes random mode pick the same sequence of nodes on every run
+	// (and after every reload), for reproducible tests. 0 seeds from the clock.
+	Seed int64 `yaml:"seed,omitempty"` // random 模式的随机数种子，非 0 时选择顺序可复现，仅用于测试
+	// StandbyThreshold is the number of usable regular nodes below which
+	// standby nodes (nodes[].standby) join the rotation. Default 1: standby
+	// nodes are only used when no regular node is left.
+	StandbyThreshold int `yaml:"standby_threshold,omitempty"` // 可用的常规节点少于该数量时启用备用节点，默认 1
+	// LazyNodes parses a node's URI on its first dial instead of at load and
+	// drops the parsed outbound again once it has been idle, for very large
+	// node lists. A URI that does not parse then fails its health checks
+	// instead of being skipped at load.
+	LazyNodes bool `yaml:"lazy_nodes,omitempty"` // 节点按需解析：首次拨号时才解析 URI，空闲后释放，适合超大节点列表
+}
+
+// GroupPoolConfig is the per-group subset of PoolConfig. Zero values inherit
+// the pool-wide setting.
+type GroupPoolConfig struct {
+	Mode              string        `yaml:"mode,omitempty"`               // 组内调度模式
+	FailureThreshold  int           `yaml:"failure_threshold,omitempty"`  // 组内节点连续失败多少次后拉黑
+	BlacklistDuration time.Duration `yaml:"blacklist_duration,omitempty"` // 组内节点拉黑时长
+	// SLO rotates out the nodes of the group whose connect times miss the
+	// objective and promotes a standby node of the group in their place.
+	SLO *SLOConfig `yaml:"slo,omitempty"` // 连接耗时 SLO：超标的节点自动轮换出去并启用组内备用节点
+}
+
+// SLOConfig is a connect-time objective: the Percentile of a node's connect
+// times over Window must stay at or below Connect.
+type SLOConfig struct {
+	Percentile int           `yaml:"percentile,omitempty" json:"percentile"`   // 百分位，默认 95
+	Connect    time.Duration `yaml:"connect" json:"connect"`                   // 连接耗时上限，如 800ms
+	Window     time.Duration `yaml:"window,omitempty" json:"window"`           // 统计窗口，默认 5m
+	MinSamples int           `yaml:"min_samples,omitempty" json:"min_samples"` // 窗口内至少多少次连接才判定，默认 20
+	Cooldown   time.Duration `yaml:"cooldown,omitempty" json:"cooldown"`       // 超标节点移出轮换的时长，默认等于 window
+}
+
+// CircuitBreakerConfig turns the blacklist into a circuit breaker: after
+// failure_threshold failures a node is opened for HalfOpenInterval, then a
+// single trial request is let through. Success closes the circuit; failure
+// reopens it for twice as long, up to MaxHalfOpenInterval.
+type CircuitBreakerConfig struct {
+	Enabled             bool          `yaml:"enabled" json:"enabled"`
+	HalfOpenInterval    time.Duration `yaml:"half_open_interval,omitempty" json:"half_open_interval"`         // 熔断后多久放行一次试探请求，默认 30s
+	MaxHalfOpenInterval time.Duration `yaml:"max_half_open_interval,omitempty" json:"max_half_open_interval"` // 试探连续失败时间隔翻倍的上限，默认 10m
+}
+
+// HealthCheckConfig tunes active health checks. A node is taken out of
+// rotation after UnhealthyThreshold consecutive failed probes and put back
+// after HealthyThreshold consecutive successful ones.
+type HealthCheckConfig struct {
+	Interval           time.Duration `yaml:"interval"`            // 探测间隔，默认 5m
+	Type               string        `yaml:"type"`                // 探测方式: http(默认) / tcp / tls
+	Timeout            time.Duration `yaml:"timeout"`             // 单次探测超时，默认 8s
+	HealthyThreshold   int           `yaml:"healthy_threshold"`   // 连续成功多少次后恢复，默认 1
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // 连续失败多少次后摘除，默认 2
 }
 
 // RetryEnabledOrDefault reports whether retry is enabled (default true).
@@ -106,6 +348,140 @@ type MultiPortConfig struct {
 	BasePort uint16 `yaml:"base_port"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	GroupBy  string `yaml:"group_by,omitempty"` // 端口划分: node(默认，每节点一个端口) / country / region / group，后三种每个端口在组内负载均衡
+	// Lazy leaves per-node ports closed until activated through the
+	// management API and closes them again after IdleTimeout without traffic.
+	Lazy        bool          `yaml:"lazy,omitempty"`         // 按需监听：端口默认关闭，经管理 API 激活
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"` // 按需监听的端口空闲多久后关闭，默认 10m
+	Freebind    bool          `yaml:"freebind,omitempty"`     // 地址尚未分配时延迟绑定并重试（VIP 漂移）
+	// PortMapFile keeps the node→port assignment across restarts and
+	// reloads. Relative paths are resolved against the config directory.
+	PortMapFile string `yaml:"port_map_file,omitempty"` // 节点端口映射文件，默认 node_ports.json（与配置文件同目录）
+	// Interface and BindAddress are the defaults of nodes[].interface and
+	// nodes[].bind_address in multi-port and hybrid mode.
+	Interface   string `yaml:"interface,omitempty"`    // 节点未设置 interface 时使用的出站网卡
+	BindAddress string `yaml:"bind_address,omitempty"` // 节点未设置 bind_address 时使用的出站源 IP
+}
+
+// Multi-port grouping modes (multi_port.group_by).
+const (
+	MultiPortByNode    = "node"
+	MultiPortByCountry = "country"
+	MultiPortByRegion  = "region"
+	MultiPortByGroup   = "group"
+)
+
+// TransparentConfig configures an inbound for traffic sent to this host by
+// iptables/nftables on a Linux gateway, so LAN devices without proxy
+// settings go through the pool. REDIRECT carries TCP only and the original
+// destination is read with SO_ORIGINAL_DST; TPROXY carries TCP and UDP and
+// needs the policy routing shown in the README.
+type TransparentConfig struct {
+	Enabled     bool   `yaml:"enabled"`                // 是否启用透明代理入口（仅 Linux，pool/hybrid 模式）
+	Mode        string `yaml:"mode"`                   // redirect(默认，仅 TCP) / tproxy(TCP+UDP)
+	Listen      string `yaml:"listen"`                 // 监听地址，默认 0.0.0.0
+	Port        uint16 `yaml:"port"`                   // 监听端口，默认 redirect 7892 / tproxy 7893
+	RoutingMark uint32 `yaml:"routing_mark,omitempty"` // 本机发往节点的连接打上的 fwmark，供 iptables 排除以免回环，0 不设置
+}
+
+// Transparent inbound modes (transparent.mode).
+const (
+	TransparentRedirect = "redirect"
+	TransparentTProxy   = "tproxy"
+)
+
+// HTTPRewriteConfig rewrites the headers of plain (non-CONNECT) HTTP
+// requests on the pool, sticky and GeoIP router entries. Headers that carry
+// client addresses (Via, X-Forwarded-For, ...) are always removed.
+type HTTPRewriteConfig struct {
+	Enabled       bool                         `yaml:"enabled"`
+	RemoveHeaders []string                     `yaml:"remove_headers,omitempty"` // 额外删除的请求头
+	SetHeaders    map[string]string            `yaml:"set_headers,omitempty"`    // 添加或覆盖的请求头
+	GroupHeaders  map[string]map[string]string `yaml:"group_headers,omitempty"`  // 按节点分组添加的请求头，对指定了该分组或其中节点的请求生效
+	ForceConnect  bool                         `yaml:"force_connect,omitempty"`  // 普通 http:// 请求改经 CONNECT 隧道发送，目标只收到改写后的原始请求
+}
+
+// EntryFront reports whether the pool and sticky entries are served by the
+// front in boxmgr, for listener TLS, http_rewrite, rules by HTTP method or
+// the pinning headers of listener.node_pinning. The sing-box inbounds
+// behind it only listen on loopback.
+func (c *Config) EntryFront() bool {
+	return (c.Mode == "pool" || c.Mode == "hybrid") &&
+		(c.Listener.TLS.Enabled() || c.HTTPRewrite.Enabled || len(c.HTTPRules()) > 0 || c.Listener.NodePinning)
+}
+
+// TUNConfig configures an optional TUN inbound that captures system traffic
+// and sends it through the pool (and rules) without per-app proxy settings.
+// Requires root / CAP_NET_ADMIN.
+type TUNConfig struct {
+	Enabled           bool     `yaml:"enabled"`        // 是否启用 TUN 模式（仅 pool/hybrid 模式）
+	InterfaceName     string   `yaml:"interface_name"` // 网卡名，默认由系统分配
+	Address           []string `yaml:"address"`        // 网卡地址，默认 172.19.0.1/30 和 fdfe:dcba:9876::1/126
+	MTU               uint32   `yaml:"mtu"`            // 默认 9000
+	Stack             string   `yaml:"stack"`          // 协议栈: mixed(默认) / system / gvisor
+	AutoRoute         *bool    `yaml:"auto_route"`     // 自动设置系统路由，默认 true
+	StrictRoute       bool     `yaml:"strict_route"`   // 严格路由，防止流量绕过 TUN
+	SplitTunnelConfig `yaml:",inline"`
+}
+
+// SplitTunnelConfig decides what enters the tunnel. CIDR lists act on the
+// system routes; domain and process lists are route rules, so traffic they
+// exclude is still captured by the TUN but sent direct instead of via the
+// pool. It can be changed at runtime through /api/tun/split.
+type SplitTunnelConfig struct {
+	RouteAddress        []string `yaml:"route_address,omitempty" json:"route_address"`                 // 仅这些网段进入 TUN，为空表示全部
+	RouteExcludeAddress []string `yaml:"route_exclude_address,omitempty" json:"route_exclude_address"` // 不经过 TUN 的网段
+	IncludeDomain       []string `yaml:"include_domain,omitempty" json:"include_domain"`               // 仅这些域名（含子域名）走代理，其余直连
+	ExcludeDomain       []string `yaml:"exclude_domain,omitempty" json:"exclude_domain"`               // 这些域名（含子域名）直连
+	IncludeProcess      []string `yaml:"include_process,omitempty" json:"include_process"`             // 仅这些程序（完整路径）走代理，仅桌面系统
+	ExcludeProcess      []string `yaml:"exclude_process,omitempty" json:"exclude_process"`             // 这些程序（完整路径）直连，仅桌面系统
+}
+
+// Normalize trims and validates the lists in place. Domains are lowercased
+// and a leading dot is dropped since matching is by suffix anyway.
+func (s *SplitTunnelConfig) Normalize() error {
+	for _, prefixes := range [][]string{s.RouteAddress, s.RouteExcludeAddress} {
+		for _, prefix := range prefixes {
+			if _, err := netip.ParsePrefix(prefix); err != nil {
+				return fmt.Errorf("tun: invalid prefix %q", prefix)
+			}
+		}
+	}
+	for _, list := range []*[]string{&s.IncludeDomain, &s.ExcludeDomain} {
+		*list = cleanList(*list, func(v string) string {
+			return strings.TrimPrefix(strings.ToLower(v), ".")
+		})
+	}
+	for _, list := range []*[]string{&s.IncludeProcess, &s.ExcludeProcess} {
+		*list = cleanList(*list, nil)
+	}
+	return nil
+}
+
+// cleanList trims entries, applies fn and drops empty ones.
+func cleanList(values []string, fn func(string) string) []string {
+	out := values[:0]
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if fn != nil {
+			v = fn(v)
+		}
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// AutoRouteOrDefault reports whether auto_route is enabled (default true).
+func (t TUNConfig) AutoRouteOrDefault() bool {
+	if t.AutoRoute == nil {
+		return true
+	}
+	return *t.AutoRoute
 }
 
 // ManagementConfig controls the monitoring HTTP endpoint.
@@ -113,8 +489,32 @@ type ManagementConfig struct {
 	Enabled          *bool  `yaml:"enabled"`
 	Listen           string `yaml:"listen"`
 	ProbeTarget      string `yaml:"probe_target"`
-	Password         string `yaml:"password"`          // WebUI 访问密码，为空则不需要密码
-	ProbeConcurrency int    `yaml:"probe_concurrency"` // 并发探测线程数（8-1024，默认 32），大规模节点可调高以加快探测
+	Password         string `yaml:"password"`           // WebUI 访问密码，为空则不需要密码
+	ProbeConcurrency int    `yaml:"probe_concurrency"`  // 并发探测线程数（8-1024，默认 32），大规模节点可调高以加快探测
+	IPCheckURL       string `yaml:"ip_check_url"`       // 查询节点出口 IP 的服务，返回纯文本 IP 或 {"ip": ...}，默认 https://api.ipify.org
+	Freebind         bool   `yaml:"freebind,omitempty"` // 允许监听尚未分配到本机的地址（VIP 漂移），仅 Linux
+	Language         string `yaml:"language,omitempty"` // WebUI 与 API 提示语言：zh-CN / en，留空按浏览器 Accept-Language 选择
+	// TLS serves the WebUI and management API over HTTPS.
+	TLS TLSConfig `yaml:",inline"`
+}
+
+// Languages of the WebUI and API messages (management.language).
+const (
+	LanguageZH = "zh-CN"
+	LanguageEN = "en"
+)
+
+// ParseLanguage maps a language tag such as "zh", "zh-Hans" or "en-US" to
+// a supported language, or returns "" when it is not one.
+func ParseLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	switch {
+	case tag == "zh" || strings.HasPrefix(tag, "zh-") || strings.HasPrefix(tag, "zh_"):
+		return LanguageZH
+	case tag == "en" || strings.HasPrefix(tag, "en-") || strings.HasPrefix(tag, "en_"):
+		return LanguageEN
+	}
+	return ""
 }
 
 // SubscriptionRefreshConfig controls subscription auto-refresh and reload settings.
@@ -134,16 +534,68 @@ const (
 	NodeSourceInline       NodeSource = "inline"       // Defined directly in config.yaml nodes array
 	NodeSourceFile         NodeSource = "nodes_file"   // Loaded from external nodes file
 	NodeSourceSubscription NodeSource = "subscription" // Fetched from subscription URL
+	NodeSourceTemplate     NodeSource = "template"     // Generated from config.yaml node_templates
 )
 
 // NodeConfig describes a single upstream proxy endpoint expressed as URI.
 type NodeConfig struct {
-	Name     string     `yaml:"name" json:"name"`
-	URI      string     `yaml:"uri" json:"uri"`
-	Port     uint16     `yaml:"port,omitempty" json:"port,omitempty"`
-	Username string     `yaml:"username,omitempty" json:"username,omitempty"`
-	Password string     `yaml:"password,omitempty" json:"password,omitempty"`
-	Source   NodeSource `yaml:"-" json:"source,omitempty"` // Runtime only, not persisted
+	Name string `yaml:"name" json:"name"`
+	ID   string `yaml:"-" json:"id,omitempty"` // 由名称生成的 ASCII 标识，用作 tag 和 API 路径；Name 保留为显示名
+	// DisplayName is the name as configured. Name is made unique by adding
+	// a suffix when several nodes share it; see disambiguateNames.
+	DisplayName string     `yaml:"-" json:"display_name,omitempty"`
+	URI         string     `yaml:"uri" json:"uri"`
+	Port        uint16     `yaml:"port,omitempty" json:"port,omitempty"`
+	Username    string     `yaml:"username,omitempty" json:"username,omitempty"`
+	Password    string     `yaml:"password,omitempty" json:"password,omitempty"`
+	Weight      int        `yaml:"weight,omitempty" json:"weight,omitempty"`       // 加权轮询权重（pool.mode: weighted），默认 1
+	MaxConns    int        `yaml:"max_conns,omitempty" json:"max_conns,omitempty"` // 该节点最大并发隧道数，覆盖 pool.max_conns_per_node
+	Group       string     `yaml:"group,omitempty" json:"group,omitempty"`         // 节点分组，供 rules 引用
+	Cost        *NodeCost  `yaml:"cost,omitempty" json:"cost,omitempty"`           // 节点费用（按流量/按时长），用于 pool.mode: cost 和费用报表
+	Via         ViaChain   `yaml:"via,omitempty" json:"via,omitempty"`             // 前置跳板：节点名或代理 URI，按顺序依次经过
+	Disabled    bool       `yaml:"disabled,omitempty" json:"disabled"`             // 停用：保留配置但不加入代理池
+	Standby     bool       `yaml:"standby,omitempty" json:"standby,omitempty"`     // 备用节点：照常健康检查，可用的常规节点少于 pool.standby_threshold 时才参与轮换
+	Source      NodeSource `yaml:"-" json:"source,omitempty"`                      // Runtime only, not persisted
+	// Expand generates one node per upstream port and/or server address
+	// from this entry; see NodeExpand.
+	Expand *NodeExpand `yaml:"expand,omitempty" json:"expand,omitempty"` // 按端口/地址范围展开为多个节点
+	// ExpandedFrom names the expand stanza or node template a generated
+	// node came from. Such nodes are saved back as the stanza (templates are
+	// left as written), not one by one.
+	ExpandedFrom string `yaml:"-" json:"expanded_from,omitempty"`
+	// Interface and BindAddress pin dials to the node's server to a local
+	// interface or source IP, e.g. one of several WAN uplinks.
+	Interface   string `yaml:"interface,omitempty" json:"interface,omitempty"`       // 经指定本机网卡连接该节点（多 WAN 出口）
+	BindAddress string `yaml:"bind_address,omitempty" json:"bind_address,omitempty"` // 以指定本机 IP 为源地址连接该节点
+	// AllowPlaintext keeps a node whose URI carries TLS parameters (sni, fp,
+	// ...) without enabling TLS; such nodes are refused by default.
+	AllowPlaintext bool `yaml:"allow_plaintext,omitempty" json:"allow_plaintext,omitempty"` // 允许明文连接，跳过 TLS 降级检查
+	// Exec makes this an exec node that dials through an external command
+	// instead of a proxy URI; see NodeExec.
+	Exec *NodeExec `yaml:"exec,omitempty" json:"exec,omitempty"` // 通过外部命令（cloudflared、ssh 等）连接，替代 uri
+}
+
+// ViaChain lists the hops a node is reached through, first hop first. Each
+// entry is another node's name or a proxy URI. In YAML a single hop may be
+// written as a plain string.
+type ViaChain []string
+
+// UnmarshalYAML accepts both a scalar and a sequence.
+func (v *ViaChain) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		if value.Value == "" {
+			*v = nil
+		} else {
+			*v = ViaChain{value.Value}
+		}
+		return nil
+	}
+	var hops []string
+	if err := value.Decode(&hops); err != nil {
+		return err
+	}
+	*v = hops
+	return nil
 }
 
 // NodeKey returns a stable identifier for the node, used to preserve port
@@ -193,8 +645,20 @@ func stableNodeKey(uri string) string {
 	return u.String()
 }
 
+// LoadOption adjusts how Load reads a config.
+type LoadOption func(*Config)
+
+// WithNodeSnapshot makes Load save the nodes read from nodes_file or the
+// subscriptions as the node snapshot, and start from that snapshot when
+// they are unavailable. The service sets it; the commands that only
+// inspect a config do not, so they neither write the snapshot nor pass on
+// a stale one.
+func WithNodeSnapshot() LoadOption {
+	return func(c *Config) { c.snapshots = true }
+}
+
 // Load reads YAML config from disk and applies defaults/validation.
-func Load(path string) (*Config, error) {
+func Load(path string, opts ...LoadOption) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
@@ -203,7 +667,13 @@ func Load(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("decode config: %w", err)
 	}
+	if err := cfg.applyOverrides(); err != nil {
+		return nil, fmt.Errorf("override config: %w", err)
+	}
 	cfg.filePath = path
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
 	// Resolve nodes_file path relative to config file directory
 	if cfg.NodesFile != "" && !filepath.IsAbs(cfg.NodesFile) {
@@ -271,6 +741,7 @@ func ExtractNodeName(uri string) string {
 }
 
 func (c *Config) normalize() error {
+	c.warnings = nil
 	if c.Mode == "" {
 		c.Mode = "pool"
 	}
@@ -298,9 +769,24 @@ func (c *Config) normalize() error {
 	if c.Pool.BlacklistDuration <= 0 {
 		c.Pool.BlacklistDuration = 24 * time.Hour
 	}
+	if err := c.normalizeMaxRetries(); err != nil {
+		return err
+	}
 	if c.Pool.RetryAttempts <= 0 {
 		c.Pool.RetryAttempts = 3
 	}
+	if err := c.normalizeHealthCheck(); err != nil {
+		return err
+	}
+	if err := c.normalizeCircuitBreaker(); err != nil {
+		return err
+	}
+	if err := c.normalizeResources(); err != nil {
+		return err
+	}
+	if err := c.normalizePlugins(); err != nil {
+		return err
+	}
 	if c.MultiPort.Address == "" {
 		c.MultiPort.Address = "0.0.0.0"
 	}
@@ -339,12 +825,34 @@ func (c *Config) normalize() error {
 	for idx := range c.Nodes {
 		c.Nodes[idx].Source = NodeSourceInline
 	}
+	expanded, err := expandNodes(c.Nodes)
+	if err != nil {
+		return err
+	}
+	templated, err := expandTemplates(c.NodeTemplates)
+	if err != nil {
+		return err
+	}
+	c.Nodes = append(expanded, templated...)
 
 	// Load nodes from file if specified (but NOT if subscriptions exist - subscription takes priority)
 	if c.NodesFile != "" && len(c.Subscriptions) == 0 {
 		fileNodes, err := loadNodesFromFile(c.NodesFile)
 		if err != nil {
-			return fmt.Errorf("load nodes from file %q: %w", c.NodesFile, err)
+			// A momentarily unreachable nodes_file (NFS hiccup, volume not
+			// mounted yet) falls back to the last good node list.
+			if !c.snapshots {
+				return fmt.Errorf("load nodes from file %q: %w", c.NodesFile, err)
+			}
+			snapshot, path, snapErr := c.loadNodeSnapshot(NodeSourceFile)
+			if snapErr != nil {
+				return fmt.Errorf("load nodes from file %q: %w", c.NodesFile, err)
+			}
+			c.warnf("nodes_file", "cannot read %s: %v; starting degraded with %d nodes from the snapshot %s", c.NodesFile, err, len(snapshot), path)
+			c.degraded = fmt.Sprintf("nodes_file %s unavailable, using snapshot %s", c.NodesFile, path)
+			fileNodes = snapshot
+		} else if c.snapshots {
+			c.SaveNodeSnapshot(fileNodes)
 		}
 		for idx := range fileNodes {
 			fileNodes[idx].Source = NodeSourceFile
@@ -359,7 +867,7 @@ func (c *Config) normalize() error {
 		for _, subURL := range c.Subscriptions {
 			nodes, err := loadNodesFromSubscription(subURL, subTimeout)
 			if err != nil {
-				log.Printf("⚠️ Failed to load subscription %q: %v (skipping)", subURL, err)
+				c.warnf("subscriptions", "failed to load %q: %v (skipping)", subURL, err)
 				continue
 			}
 			log.Printf("✅ Loaded %d nodes from subscription", len(nodes))
@@ -382,14 +890,26 @@ func (c *Config) normalize() error {
 			} else {
 				log.Printf("✅ Written %d subscription nodes to %s", len(subNodes), nodesFilePath)
 			}
+			if c.snapshots {
+				c.SaveNodeSnapshot(subNodes)
+			}
 		}
 		c.Nodes = append(c.Nodes, subNodes...)
 		// Fallback: if all subscriptions failed, try loading cached nodes.txt
 		if len(subNodes) == 0 && c.NodesFile != "" {
 			cachedNodes, err := loadNodesFromFile(c.NodesFile)
 			if err == nil && len(cachedNodes) > 0 {
-				log.Printf("⚠️  All subscriptions failed, using %d cached nodes from %s", len(cachedNodes), c.NodesFile)
+				c.warnf("subscriptions", "all subscriptions failed, using %d cached nodes from %s", len(cachedNodes), c.NodesFile)
 				c.Nodes = append(c.Nodes, cachedNodes...)
+				subNodes = cachedNodes
+			}
+		}
+		// Last resort: the snapshot of the last good node list.
+		if len(subNodes) == 0 && c.snapshots {
+			if snapshot, path, err := c.loadNodeSnapshot(NodeSourceSubscription); err == nil {
+				c.warnf("subscriptions", "all subscriptions failed and no cached nodes; starting degraded with %d nodes from the snapshot %s", len(snapshot), path)
+				c.degraded = fmt.Sprintf("subscriptions unavailable, using snapshot %s", path)
+				c.Nodes = append(c.Nodes, snapshot...)
 			}
 		}
 	}
@@ -403,10 +923,19 @@ func (c *Config) normalize() error {
 	for idx := range c.Nodes {
 		c.Nodes[idx].Name = strings.TrimSpace(c.Nodes[idx].Name)
 		c.Nodes[idx].URI = strings.TrimSpace(c.Nodes[idx].URI)
+		if err := c.Nodes[idx].normalizeExec(); err != nil {
+			return err
+		}
 
 		if c.Nodes[idx].URI == "" {
 			return fmt.Errorf("node %d is missing uri", idx)
 		}
+		if c.Nodes[idx].Weight < 0 {
+			return fmt.Errorf("node %d has negative weight %d", idx, c.Nodes[idx].Weight)
+		}
+		if c.Nodes[idx].MaxConns < 0 {
+			return fmt.Errorf("node %d has negative max_conns %d", idx, c.Nodes[idx].MaxConns)
+		}
 
 		// Auto-extract name from URI if not provided
 		if c.Nodes[idx].Name == "" {
@@ -440,9 +969,32 @@ func (c *Config) normalize() error {
 	if c.LogLevel == "" {
 		c.LogLevel = "info"
 	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 30 * time.Second
+	}
 
 	// Log config defaults
 	c.normalizeLogConfig()
+	if err := c.normalizeAccessLog(); err != nil {
+		return err
+	}
+	if err := c.normalizeConnLimits(); err != nil {
+		return err
+	}
+	c.normalizeBlacklistFile()
+	if err := c.normalizeTLS("listener", &c.Listener.TLS); err != nil {
+		return err
+	}
+	if err := c.normalizeTLS("management", &c.Management.TLS); err != nil {
+		return err
+	}
+	if c.Management.Language != "" {
+		lang := ParseLanguage(c.Management.Language)
+		if lang == "" {
+			return fmt.Errorf("management.language must be zh-CN or en, got %q", c.Management.Language)
+		}
+		c.Management.Language = lang
+	}
 
 	// Auto-fix port conflicts in hybrid mode (pool port vs multi-port)
 	if c.Mode == "hybrid" {
@@ -462,7 +1014,7 @@ func (c *Config) normalize() error {
 						return fmt.Errorf("no available port for node %q after conflict with pool port %d", c.Nodes[idx].Name, poolPort)
 					}
 				}
-				log.Printf("⚠️  Node %q port %d conflicts with pool port, reassigned to %d", c.Nodes[idx].Name, poolPort, newPort)
+				c.warnf("nodes", "node %q port %d conflicts with pool port, reassigned to %d", c.Nodes[idx].Name, poolPort, newPort)
 				usedPorts[newPort] = true
 				c.Nodes[idx].Port = newPort
 			}
@@ -472,6 +1024,57 @@ func (c *Config) normalize() error {
 	if err := c.normalizeSticky(); err != nil {
 		return err
 	}
+	if err := c.normalizeTUN(); err != nil {
+		return err
+	}
+	if err := c.normalizeTransparent(); err != nil {
+		return err
+	}
+	if err := c.normalizeHTTPRewrite(); err != nil {
+		return err
+	}
+	if err := c.normalizeNodeBinds(); err != nil {
+		return err
+	}
+	if c.LimitWarning < 0 || c.LimitWarning >= 100 {
+		return fmt.Errorf("limit_warning must be a percentage between 1 and 99, got %d", c.LimitWarning)
+	}
+	if err := c.normalizeMultiPortGroupBy(); err != nil {
+		return err
+	}
+	if err := c.normalizeRules(); err != nil {
+		return err
+	}
+	if err := c.normalizePoolGroups(); err != nil {
+		return err
+	}
+	if err := c.normalizeNodeCosts(); err != nil {
+		return err
+	}
+	if err := c.normalizeDNS(); err != nil {
+		return err
+	}
+	if err := c.normalizeStatsHistory(); err != nil {
+		return err
+	}
+	if err := c.normalizeSpeedTest(); err != nil {
+		return err
+	}
+	if err := c.normalizeCluster(); err != nil {
+		return err
+	}
+	if err := c.normalizeStatusPage(); err != nil {
+		return err
+	}
+	if err := c.normalizeTimezone(); err != nil {
+		return err
+	}
+	if err := c.normalizeUsers(); err != nil {
+		return err
+	}
+	disambiguateNames(c.Nodes)
+	assignNodeIDs(c.Nodes)
+	c.collectWarnings()
 
 	return nil
 }
@@ -488,17 +1091,253 @@ func (c *Config) BuildPortMap() map[string]uint16 {
 	return portMap
 }
 
-// nodePortMapFile is the sidecar file storing node→port assignments so they
-// survive a process restart.
+// nodePortMapFile is the default sidecar file storing node→port assignments
+// so they survive a process restart.
 const nodePortMapFile = "node_ports.json"
 
-// portMapPath returns the path of the port-map sidecar, located next to the
-// main config file. It is empty when the config path is unknown.
-func (c *Config) portMapPath() string {
+// PortMapPath returns the path of the port-map sidecar: multi_port.port_map_file,
+// by default node_ports.json next to the main config file. It is empty when
+// the path is relative and the config path is unknown.
+func (c *Config) PortMapPath() string {
+	file := c.MultiPort.PortMapFile
+	if file == "" {
+		file = nodePortMapFile
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	if c.filePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.filePath), file)
+}
+
+// statsFile is the default file keeping traffic and node counters across
+// restarts.
+const statsFile = "stats.json"
+
+// StatsPath returns where usage counters are saved on shutdown: stats_file,
+// by default stats.json next to the main config file. It is empty when the
+// path is relative and the config path is unknown.
+func (c *Config) StatsPath() string {
+	file := c.StatsFile
+	if file == "" {
+		file = statsFile
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
 	if c.filePath == "" {
 		return ""
 	}
-	return filepath.Join(filepath.Dir(c.filePath), nodePortMapFile)
+	return filepath.Join(filepath.Dir(c.filePath), file)
+}
+
+// StatsHistoryConfig controls the per-node and per-user trend history kept
+// in the stats file.
+type StatsHistoryConfig struct {
+	Enabled         bool          `yaml:"enabled"`                    // 每分钟采样一次节点成功/失败/延迟与用户流量
+	MinuteRetention time.Duration `yaml:"minute_retention,omitempty"` // 分钟粒度保留时长，默认 24h
+	HourRetention   time.Duration `yaml:"hour_retention,omitempty"`   // 小时粒度保留时长，默认 720h（30 天）
+	DayRetention    time.Duration `yaml:"day_retention,omitempty"`    // 天粒度保留时长，默认 8760h（365 天）
+}
+
+func (c *Config) normalizeStatsHistory() error {
+	h := &c.StatsHistory
+	for _, field := range []struct {
+		name  string
+		value *time.Duration
+		def   time.Duration
+	}{
+		{"minute_retention", &h.MinuteRetention, 24 * time.Hour},
+		{"hour_retention", &h.HourRetention, 30 * 24 * time.Hour},
+		{"day_retention", &h.DayRetention, 365 * 24 * time.Hour},
+	} {
+		if *field.value < 0 {
+			return fmt.Errorf("stats_history.%s must be >= 0, got %s", field.name, *field.value)
+		}
+		if *field.value == 0 {
+			*field.value = field.def
+		}
+	}
+	if h.HourRetention < time.Hour {
+		c.warnf("stats_history.hour_retention", "%s keeps less than one hourly bucket", h.HourRetention)
+	}
+	if h.DayRetention < 24*time.Hour {
+		c.warnf("stats_history.day_retention", "%s keeps less than one daily bucket", h.DayRetention)
+	}
+	return nil
+}
+
+// ClusterConfig lets several instances share node state. Each instance
+// periodically sends the health, latency and blacklist of its nodes to the
+// management API of its peers and takes over the blacklists they report.
+type ClusterConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Name           string        `yaml:"name,omitempty"`             // 本实例名称，默认主机名，各实例须不同
+	Peers          []string      `yaml:"peers,omitempty"`            // 其他实例的管理地址，如 http://10.0.0.2:9090
+	Secret         string        `yaml:"secret,omitempty"`           // 实例间共享密钥，各实例须一致
+	Interval       time.Duration `yaml:"interval,omitempty"`         // 同步间隔，默认 10s
+	SkipCertVerify bool          `yaml:"skip_cert_verify,omitempty"` // 对端管理接口为自签名 HTTPS 时跳过证书验证
+}
+
+func (c *Config) normalizeCluster() error {
+	cl := &c.Cluster
+	if !cl.Enabled {
+		return nil
+	}
+	cl.Name = strings.TrimSpace(cl.Name)
+	cl.Secret = strings.TrimSpace(cl.Secret)
+	if cl.Secret == "" {
+		return fmt.Errorf("cluster.secret is required when cluster is enabled")
+	}
+	if !c.ManagementEnabled() {
+		return fmt.Errorf("cluster requires management to be enabled, peers sync through its API")
+	}
+	peers := make([]string, 0, len(cl.Peers))
+	for _, peer := range cl.Peers {
+		peer = strings.TrimRight(strings.TrimSpace(peer), "/")
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("cluster.peers: %q is not an http(s) URL", peer)
+		}
+		peers = append(peers, peer)
+	}
+	cl.Peers = peers
+	if len(cl.Peers) == 0 {
+		c.warnf("cluster.peers", "no peers; this instance only takes the state other instances send to it")
+	}
+	if cl.Interval < 0 {
+		return fmt.Errorf("cluster.interval must be >= 0, got %s", cl.Interval)
+	}
+	if cl.Interval == 0 {
+		cl.Interval = 10 * time.Second
+	}
+	if host, _, err := net.SplitHostPort(c.Management.Listen); err == nil {
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			c.warnf("cluster", "management.listen %s is loopback-only, peers cannot reach this instance", c.Management.Listen)
+		}
+	}
+	return nil
+}
+
+// StatusPageConfig serves a public, unauthenticated status page with the
+// aggregate health of the pool on its own address, so availability can be
+// shared with end users without exposing the management API. It never shows
+// node names, addresses or counts.
+type StatusPageConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen,omitempty"` // 监听地址，默认 0.0.0.0:9092，不能与管理接口相同
+	Title   string `yaml:"title,omitempty"`  // 页面标题，默认 "Proxy Status"
+	// DegradedBelow is the share of usable nodes, in percent, below which
+	// the pool is reported as degraded rather than up.
+	DegradedBelow int `yaml:"degraded_below,omitempty"` // 可用节点占比低于该百分比时显示为降级，默认 50
+}
+
+func (c *Config) normalizeStatusPage() error {
+	sp := &c.StatusPage
+	if !sp.Enabled {
+		return nil
+	}
+	sp.Listen = strings.TrimSpace(sp.Listen)
+	if sp.Listen == "" {
+		sp.Listen = "0.0.0.0:9092"
+	}
+	if _, _, err := net.SplitHostPort(sp.Listen); err != nil {
+		return fmt.Errorf("status_page.listen: %w", err)
+	}
+	if c.ManagementEnabled() && sp.Listen == c.Management.Listen {
+		return fmt.Errorf("status_page.listen must differ from management.listen %s", c.Management.Listen)
+	}
+	sp.Title = strings.TrimSpace(sp.Title)
+	if sp.Title == "" {
+		sp.Title = "Proxy Status"
+	}
+	if sp.DegradedBelow < 0 || sp.DegradedBelow > 100 {
+		return fmt.Errorf("status_page.degraded_below must be a percentage between 0 and 100, got %d", sp.DegradedBelow)
+	}
+	if sp.DegradedBelow == 0 {
+		sp.DegradedBelow = 50
+	}
+	return nil
+}
+
+// SpeedTestConfig controls bandwidth measurement through each node, run
+// on demand through the API and, with Interval set, on a schedule.
+type SpeedTestConfig struct {
+	URL      string        `yaml:"url,omitempty"`      // 测速下载地址，默认 https://speed.cloudflare.com/__down?bytes=100000000
+	MaxMB    int           `yaml:"max_mb,omitempty"`   // 单次测速最多下载 MB，默认 10
+	Timeout  time.Duration `yaml:"timeout,omitempty"`  // 单次测速最长时间，默认 30s
+	Interval time.Duration `yaml:"interval,omitempty"` // 定时测速间隔（逐个节点依次测速），0 表示仅手动触发
+}
+
+func (c *Config) normalizeSpeedTest() error {
+	st := &c.SpeedTest
+	st.URL = strings.TrimSpace(st.URL)
+	if st.URL != "" {
+		u, err := url.Parse(st.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("speed_test.url: %q is not an http(s) URL", st.URL)
+		}
+	}
+	if st.MaxMB < 0 {
+		return fmt.Errorf("speed_test.max_mb must be >= 0, got %d", st.MaxMB)
+	}
+	if st.MaxMB == 0 {
+		st.MaxMB = 10
+	}
+	if st.Timeout < 0 {
+		return fmt.Errorf("speed_test.timeout must be >= 0, got %s", st.Timeout)
+	}
+	if st.Timeout == 0 {
+		st.Timeout = 30 * time.Second
+	}
+	if st.Interval < 0 {
+		return fmt.Errorf("speed_test.interval must be >= 0, got %s", st.Interval)
+	}
+	if st.Interval > 0 && st.Interval < 10*time.Minute {
+		c.warnf("speed_test.interval", "%s tests every node that often, each downloading up to %dMB", st.Interval, st.MaxMB)
+	}
+	if strings.EqualFold(c.Pool.Mode, "bandwidth") && st.Interval == 0 {
+		c.warnf("speed_test.interval", "pool.mode is bandwidth but scheduled speed tests are off; nodes are ranked only after a manual test")
+	}
+	return nil
+}
+
+// PortAssignment is one entry of the per-node port mapping.
+type PortAssignment struct {
+	Port     uint16 `json:"port"`
+	Name     string `json:"name"`
+	ID       string `json:"id"`
+	Group    string `json:"group,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// PortAssignments returns the per-node ports ordered by port, or nil when
+// nodes have no port of their own (pool mode, or multi_port.group_by other
+// than node).
+func (c *Config) PortAssignments() []PortAssignment {
+	if c.Mode != "multi-port" && c.Mode != "hybrid" {
+		return nil
+	}
+	if c.MultiPort.GroupBy != "" && c.MultiPort.GroupBy != MultiPortByNode {
+		return nil
+	}
+	list := make([]PortAssignment, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		if node.Port == 0 {
+			continue
+		}
+		list = append(list, PortAssignment{
+			Port:     node.Port,
+			Name:     node.Name,
+			ID:       node.ID,
+			Group:    node.Group,
+			Disabled: node.Disabled,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Port < list[j].Port })
+	return list
 }
 
 // loadNodePortMap reads a previously saved stableNodeKey→port mapping. It
@@ -549,7 +1388,7 @@ func (c *Config) SaveNodePortMap() error {
 	if c.Mode != "multi-port" && c.Mode != "hybrid" {
 		return nil
 	}
-	path := c.portMapPath()
+	path := c.PortMapPath()
 	if path == "" {
 		return errors.New("config file path is unknown")
 	}
@@ -579,7 +1418,7 @@ func (c *Config) applyPersistedPorts() error {
 	// normalize() only assigned provisional ports (no bind checks). Run the
 	// authoritative, bind-checked assignment exactly once here. A saved sidecar
 	// supplies preserved ports; an empty/missing one means "assign all fresh".
-	saved := loadNodePortMap(c.portMapPath())
+	saved := loadNodePortMap(c.PortMapPath())
 	if len(saved) > 0 {
 		// Migrate any legacy entries: sidecars written before stableNodeKey was
 		// keyed by the raw full URI. Without this bridge, every node's stable key
@@ -590,9 +1429,12 @@ func (c *Config) applyPersistedPorts() error {
 	for i := range c.Nodes {
 		c.Nodes[i].Port = 0
 	}
+	// Warnings about loading nodes are only produced by normalize(); keep them.
+	loadWarnings := c.warnings
 	if err := c.NormalizeWithPortMap(saved); err != nil {
 		return fmt.Errorf("restore persisted ports: %w", err)
 	}
+	c.mergeWarnings(loadWarnings)
 	// Persisting is best-effort by design: the proxy runs correctly without the
 	// sidecar; only a subsequent restart would re-derive ports. A write failure
 	// is logged rather than fatal.
@@ -605,6 +1447,7 @@ func (c *Config) applyPersistedPorts() error {
 // NormalizeWithPortMap applies defaults and validation, preserving port assignments
 // for nodes that exist in the provided port map.
 func (c *Config) NormalizeWithPortMap(portMap map[string]uint16) error {
+	c.warnings = nil
 	if c.Mode == "" {
 		c.Mode = "pool"
 	}
@@ -616,171 +1459,824 @@ func (c *Config) NormalizeWithPortMap(portMap map[string]uint16) error {
 	default:
 		return fmt.Errorf("unsupported mode %q (use 'pool', 'multi-port', or 'hybrid')", c.Mode)
 	}
-	if c.Listener.Address == "" {
-		c.Listener.Address = "0.0.0.0"
+	if c.Listener.Address == "" {
+		c.Listener.Address = "0.0.0.0"
+	}
+	if c.Listener.Port == 0 {
+		c.Listener.Port = 2323
+	}
+	if c.Pool.Mode == "" {
+		c.Pool.Mode = "sequential"
+	}
+	if c.Pool.FailureThreshold <= 0 {
+		c.Pool.FailureThreshold = 3
+	}
+	if c.Pool.BlacklistDuration <= 0 {
+		c.Pool.BlacklistDuration = 24 * time.Hour
+	}
+	if err := c.normalizeMaxRetries(); err != nil {
+		return err
+	}
+	if c.Pool.RetryAttempts <= 0 {
+		c.Pool.RetryAttempts = 3
+	}
+	if err := c.normalizeHealthCheck(); err != nil {
+		return err
+	}
+	if err := c.normalizeCircuitBreaker(); err != nil {
+		return err
+	}
+	if err := c.normalizeResources(); err != nil {
+		return err
+	}
+	if err := c.normalizePlugins(); err != nil {
+		return err
+	}
+	if c.MultiPort.Address == "" {
+		c.MultiPort.Address = "0.0.0.0"
+	}
+	if c.MultiPort.BasePort == 0 {
+		c.MultiPort.BasePort = 24000
+	}
+	if c.Management.Listen == "" {
+		c.Management.Listen = "127.0.0.1:9091"
+	}
+	if c.Management.ProbeTarget == "" {
+		c.Management.ProbeTarget = "www.apple.com:80"
+	}
+	if c.Management.Enabled == nil {
+		defaultEnabled := true
+		c.Management.Enabled = &defaultEnabled
+	}
+	if c.SubscriptionRefresh.Interval <= 0 {
+		c.SubscriptionRefresh.Interval = 1 * time.Hour
+	}
+	if c.SubscriptionRefresh.Timeout <= 0 {
+		c.SubscriptionRefresh.Timeout = 30 * time.Second
+	}
+	if c.SubscriptionRefresh.HealthCheckTimeout <= 0 {
+		c.SubscriptionRefresh.HealthCheckTimeout = 60 * time.Second
+	}
+	if c.SubscriptionRefresh.DrainTimeout <= 0 {
+		c.SubscriptionRefresh.DrainTimeout = 30 * time.Second
+	}
+	if c.SubscriptionRefresh.MinAvailableNodes <= 0 {
+		c.SubscriptionRefresh.MinAvailableNodes = 1
+	}
+
+	expanded, err := expandNodes(c.Nodes)
+	if err != nil {
+		return err
+	}
+	c.Nodes = expanded
+	if len(c.Nodes) == 0 {
+		return errors.New("config.nodes cannot be empty")
+	}
+
+	// Build set of ports already assigned from portMap
+	usedPorts := make(map[uint16]bool)
+	if c.Mode == "hybrid" {
+		usedPorts[c.Listener.Port] = true
+	}
+
+	// First pass: assign ports from portMap for existing nodes
+	for idx := range c.Nodes {
+		c.Nodes[idx].Name = strings.TrimSpace(c.Nodes[idx].Name)
+		c.Nodes[idx].URI = strings.TrimSpace(c.Nodes[idx].URI)
+		if err := c.Nodes[idx].normalizeExec(); err != nil {
+			return err
+		}
+		if c.Nodes[idx].URI == "" {
+			return fmt.Errorf("node %d is missing uri", idx)
+		}
+		if c.Nodes[idx].Weight < 0 {
+			return fmt.Errorf("node %d has negative weight %d", idx, c.Nodes[idx].Weight)
+		}
+		if c.Nodes[idx].MaxConns < 0 {
+			return fmt.Errorf("node %d has negative max_conns %d", idx, c.Nodes[idx].MaxConns)
+		}
+
+		// Auto-extract name from URI if not provided
+		if c.Nodes[idx].Name == "" {
+			c.Nodes[idx].Name = ExtractNodeName(c.Nodes[idx].URI)
+		}
+		if c.Nodes[idx].Name == "" {
+			c.Nodes[idx].Name = fmt.Sprintf("node-%d", idx)
+		}
+
+		// Check if this node has a preserved port from portMap. Guard against a
+		// port that was already claimed by an earlier node sharing the same
+		// stable key (e.g. a subscription listing the same server twice under
+		// different display names): preserving it again would bind the same
+		// proxy port twice (EADDRINUSE). Such a node is left at Port==0 so the
+		// second pass assigns it a fresh, collision-free port.
+		if c.Mode == "multi-port" || c.Mode == "hybrid" {
+			nodeKey := c.Nodes[idx].NodeKey()
+			if existingPort, ok := portMap[nodeKey]; ok && existingPort > 0 {
+				if usedPorts[existingPort] {
+					c.warnf("nodes", "port %d already assigned to another node with the same identity; node %q will get a fresh port", existingPort, c.Nodes[idx].Name)
+				} else {
+					c.Nodes[idx].Port = existingPort
+					usedPorts[existingPort] = true
+					log.Printf("✅ Preserved port %d for node %q", existingPort, c.Nodes[idx].Name)
+				}
+			}
+		}
+	}
+
+	// Ports in portMap that no node kept were freed by removed nodes. During
+	// a reload they are still bound by the instance being replaced, so they
+	// skip the bind check; otherwise a new node would be pushed past them and
+	// which port it gets would depend on timing. A port meanwhile taken by
+	// another process is still caught when the listener fails to bind.
+	freed := make(map[uint16]bool)
+	for _, port := range portMap {
+		if !usedPorts[port] {
+			freed[port] = true
+		}
+	}
+
+	// Second pass: assign new ports for nodes without preserved ports, lowest
+	// free port first in config order, so freed ports are reused before the
+	// range grows. portCursor is an int (not uint16) so the >65535 exhaustion
+	// guard actually fires: a uint16 cursor would wrap to 0 and silently hand
+	// out unbindable low ports.
+	portCursor := int(c.MultiPort.BasePort)
+	for idx := range c.Nodes {
+		if c.Nodes[idx].Port == 0 && (c.Mode == "multi-port" || c.Mode == "hybrid") {
+			// Find next available port that's not used
+			for usedPorts[uint16(portCursor)] || (!freed[uint16(portCursor)] && !IsPortAvailable(c.MultiPort.Address, uint16(portCursor))) {
+				portCursor++
+				if portCursor > 65535 {
+					return fmt.Errorf("no available ports found starting from %d", c.MultiPort.BasePort)
+				}
+			}
+			c.Nodes[idx].Port = uint16(portCursor)
+			usedPorts[uint16(portCursor)] = true
+			log.Printf("📌 Assigned new port %d for node %q", portCursor, c.Nodes[idx].Name)
+			portCursor++
+		} else if c.Nodes[idx].Port == 0 {
+			c.Nodes[idx].Port = uint16(portCursor)
+			portCursor++
+		}
+
+		// Apply default credentials
+		if c.Mode == "multi-port" || c.Mode == "hybrid" {
+			if c.Nodes[idx].Username == "" {
+				c.Nodes[idx].Username = c.MultiPort.Username
+				c.Nodes[idx].Password = c.MultiPort.Password
+			}
+		}
+	}
+
+	if c.LogLevel == "" {
+		c.LogLevel = "info"
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 30 * time.Second
+	}
+
+	c.normalizeLogConfig()
+	if err := c.normalizeAccessLog(); err != nil {
+		return err
+	}
+	if err := c.normalizeConnLimits(); err != nil {
+		return err
+	}
+	c.normalizeBlacklistFile()
+	if err := c.normalizeTLS("listener", &c.Listener.TLS); err != nil {
+		return err
+	}
+	if err := c.normalizeTLS("management", &c.Management.TLS); err != nil {
+		return err
+	}
+	if c.Management.Language != "" {
+		lang := ParseLanguage(c.Management.Language)
+		if lang == "" {
+			return fmt.Errorf("management.language must be zh-CN or en, got %q", c.Management.Language)
+		}
+		c.Management.Language = lang
+	}
+
+	if err := c.normalizeSticky(); err != nil {
+		return err
+	}
+	if err := c.normalizeTUN(); err != nil {
+		return err
+	}
+	if err := c.normalizeTransparent(); err != nil {
+		return err
+	}
+	if err := c.normalizeHTTPRewrite(); err != nil {
+		return err
+	}
+	if err := c.normalizeNodeBinds(); err != nil {
+		return err
+	}
+	if c.LimitWarning < 0 || c.LimitWarning >= 100 {
+		return fmt.Errorf("limit_warning must be a percentage between 1 and 99, got %d", c.LimitWarning)
+	}
+	if err := c.normalizeMultiPortGroupBy(); err != nil {
+		return err
+	}
+	if err := c.normalizeRules(); err != nil {
+		return err
+	}
+	if err := c.normalizePoolGroups(); err != nil {
+		return err
+	}
+	if err := c.normalizeNodeCosts(); err != nil {
+		return err
+	}
+	if err := c.normalizeDNS(); err != nil {
+		return err
+	}
+	if err := c.normalizeStatsHistory(); err != nil {
+		return err
+	}
+	if err := c.normalizeSpeedTest(); err != nil {
+		return err
+	}
+	if err := c.normalizeCluster(); err != nil {
+		return err
+	}
+	if err := c.normalizeStatusPage(); err != nil {
+		return err
+	}
+	if err := c.normalizeTimezone(); err != nil {
+		return err
+	}
+	if err := c.normalizeUsers(); err != nil {
+		return err
+	}
+	disambiguateNames(c.Nodes)
+	assignNodeIDs(c.Nodes)
+	c.collectWarnings()
+
+	return nil
+}
+
+// normalizeSticky applies defaults and validation for the optional sticky entry port.
+// Sticky sessions only apply to the shared pool entry, so they are disabled
+// outside pool/hybrid mode. Must run after node ports are assigned.
+func (c *Config) normalizeSticky() error {
+	if !c.Sticky.Enabled {
+		return nil
+	}
+	if c.Mode != "pool" && c.Mode != "hybrid" {
+		c.warnf("sticky.enabled", "mode is %q; sticky only applies to pool/hybrid mode, disabling", c.Mode)
+		c.Sticky.Enabled = false
+		return nil
+	}
+	if c.Sticky.Port == 0 {
+		if c.Listener.Port >= 65535 {
+			return fmt.Errorf("cannot auto-assign sticky.port (listener.port is %d); set sticky.port explicitly", c.Listener.Port)
+		}
+		c.Sticky.Port = c.Listener.Port + 1
+	}
+	if c.Sticky.Port == c.Listener.Port {
+		return fmt.Errorf("sticky.port %d conflicts with listener.port", c.Sticky.Port)
+	}
+	for idx := range c.Nodes {
+		if c.Nodes[idx].Port == c.Sticky.Port {
+			return fmt.Errorf("sticky.port %d conflicts with node %q port", c.Sticky.Port, c.Nodes[idx].Name)
+		}
+	}
+	return nil
+}
+
+// normalizeConnLimits validates the listener and per-node connection caps.
+func (c *Config) normalizeConnLimits() error {
+	if c.Listener.MaxConnsPerIP < 0 || c.Listener.MaxNewConnsPerSec < 0 {
+		return fmt.Errorf("listener.max_conns_per_ip and max_new_conns_per_sec must be >= 0")
+	}
+	if c.Pool.MaxConnsPerNode < 0 {
+		return fmt.Errorf("pool.max_conns_per_node must be >= 0")
+	}
+	if c.Pool.IdleTimeout < 0 {
+		return fmt.Errorf("pool.idle_timeout must be >= 0")
+	}
+	if c.Pool.IdleTimeout > 0 && c.Pool.IdleTimeout < minIdleTimeout {
+		c.warnf("pool.idle_timeout", "%s is short; quiet but healthy connections (keep-alive, long polling, websockets) will be closed too", c.Pool.IdleTimeout)
+	}
+	return nil
+}
+
+// minIdleTimeout is the shortest pool.idle_timeout accepted without a
+// warning.
+const minIdleTimeout = 30 * time.Second
+
+// normalizeBlacklistFile defaults pool.blacklist_file to blacklist.json next
+// to the config file. Without a config file it stays empty (not persisted).
+func (c *Config) normalizeBlacklistFile() {
+	if c.Pool.BlacklistFile == "" {
+		c.Pool.BlacklistFile = "blacklist.json"
+	}
+	if !filepath.IsAbs(c.Pool.BlacklistFile) {
+		if c.filePath == "" {
+			c.Pool.BlacklistFile = ""
+			return
+		}
+		c.Pool.BlacklistFile = filepath.Join(filepath.Dir(c.filePath), c.Pool.BlacklistFile)
+	}
+}
+
+// normalizeUsers validates listener.users and listener.tiers. Tier and
+// group names are matched case-insensitively; a tier group with no node is
+// kept but reported, since subscriptions may fill it later.
+func (c *Config) normalizeUsers() error {
+	if err := c.normalizeTiers(); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(c.Listener.Users))
+	for idx := range c.Listener.Users {
+		u := &c.Listener.Users[idx]
+		u.Username = strings.TrimSpace(u.Username)
+		if u.Username == "" {
+			return fmt.Errorf("listener.users[%d]: username is required", idx)
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("listener.users[%d]: duplicate username %q", idx, u.Username)
+		}
+		seen[u.Username] = true
+		if u.RateLimitKBps < 0 || u.MaxConnections < 0 || u.QuotaMB < 0 {
+			return fmt.Errorf("listener.users[%d]: limits must be >= 0", idx)
+		}
+		if u.Tier = strings.ToLower(strings.TrimSpace(u.Tier)); u.Tier != "" {
+			if _, ok := c.Listener.Tiers[u.Tier]; !ok {
+				return fmt.Errorf("listener.users[%d]: unknown tier %q", idx, u.Tier)
+			}
+		}
+	}
+	if len(c.Listener.Users) > 0 && c.Listener.Username != "" {
+		c.warnf("listener.users", "listener.username/password are ignored when users are set")
+	}
+	if len(c.Listener.Tiers) > 0 && len(c.Listener.Users) == 0 {
+		c.warnf("listener.tiers", "tiers only apply to listener.users")
+	}
+	return nil
+}
+
+func (c *Config) normalizeTiers() error {
+	if len(c.Listener.Tiers) == 0 {
+		return nil
+	}
+	nodeGroups := make(map[string]bool)
+	for _, node := range c.Nodes {
+		if group := strings.ToLower(strings.TrimSpace(node.Group)); group != "" {
+			nodeGroups[group] = true
+		}
+	}
+	tiers := make(map[string]TierConfig, len(c.Listener.Tiers))
+	for _, name := range slices.Sorted(maps.Keys(c.Listener.Tiers)) {
+		tier := c.Listener.Tiers[name]
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" {
+			return fmt.Errorf("listener.tiers: tier name is required")
+		}
+		if _, dup := tiers[key]; dup {
+			return fmt.Errorf("listener.tiers: tier %q is configured twice", key)
+		}
+		field := "listener.tiers." + key
+		if tier.RateLimitKBps < 0 || tier.MaxConnections < 0 || tier.QuotaMB < 0 {
+			return fmt.Errorf("%s: limits must be >= 0", field)
+		}
+		groups := make([]string, 0, len(tier.Groups))
+		for _, group := range tier.Groups {
+			group = strings.ToLower(strings.TrimSpace(group))
+			if group == "" || slices.Contains(groups, group) {
+				continue
+			}
+			if !nodeGroups[group] {
+				c.warnf(field+".groups", "no node is in group %q", group)
+			}
+			groups = append(groups, group)
+		}
+		tier.Groups = groups
+		tiers[key] = tier
+	}
+	c.Listener.Tiers = tiers
+	return nil
+}
+
+// normalizeTUN applies defaults and validation for the tun section. TUN
+// traffic goes to the shared pool, so it is disabled outside pool/hybrid mode.
+func (c *Config) normalizeTUN() error {
+	t := &c.TUN
+	if !t.Enabled {
+		return nil
+	}
+	if c.Mode != "pool" && c.Mode != "hybrid" {
+		c.warnf("tun.enabled", "mode is %q; TUN only applies to pool/hybrid mode, disabling", c.Mode)
+		t.Enabled = false
+		return nil
+	}
+	if len(t.Address) == 0 {
+		t.Address = []string{"172.19.0.1/30", "fdfe:dcba:9876::1/126"}
+	}
+	for _, prefix := range t.Address {
+		if _, err := netip.ParsePrefix(prefix); err != nil {
+			return fmt.Errorf("tun: invalid prefix %q", prefix)
+		}
+	}
+	if err := t.SplitTunnelConfig.Normalize(); err != nil {
+		return err
 	}
-	if c.Listener.Port == 0 {
-		c.Listener.Port = 2323
+	if t.MTU == 0 {
+		t.MTU = 9000
 	}
-	if c.Pool.Mode == "" {
-		c.Pool.Mode = "sequential"
+	t.Stack = strings.ToLower(strings.TrimSpace(t.Stack))
+	switch t.Stack {
+	case "":
+		t.Stack = "mixed"
+	case "mixed", "system", "gvisor":
+	default:
+		return fmt.Errorf("unsupported tun.stack %q (use 'mixed', 'system' or 'gvisor')", t.Stack)
 	}
-	if c.Pool.FailureThreshold <= 0 {
-		c.Pool.FailureThreshold = 3
+	return nil
+}
+
+// normalizeTransparent validates the transparent section. Like TUN it only
+// feeds the pool entry; on other systems than Linux it is disabled with a
+// warning so a gateway config can still be checked elsewhere.
+// normalizeHTTPRewrite validates and canonicalizes the header names of the
+// http_rewrite section.
+func (c *Config) normalizeHTTPRewrite() error {
+	h := &c.HTTPRewrite
+	if !h.Enabled {
+		return nil
 	}
-	if c.Pool.BlacklistDuration <= 0 {
-		c.Pool.BlacklistDuration = 24 * time.Hour
+	if c.Mode == "multi-port" && !c.GeoIP.Enabled {
+		c.warnf("http_rewrite.enabled", "only the pool, sticky and GeoIP router entries rewrite requests; none is enabled in multi-port mode")
 	}
-	if c.Pool.RetryAttempts <= 0 {
-		c.Pool.RetryAttempts = 3
+	for i, name := range h.RemoveHeaders {
+		if !validHeaderName(name) {
+			return fmt.Errorf("http_rewrite.remove_headers: invalid header name %q", name)
+		}
+		h.RemoveHeaders[i] = http.CanonicalHeaderKey(strings.TrimSpace(name))
 	}
-	if c.MultiPort.Address == "" {
-		c.MultiPort.Address = "0.0.0.0"
+	set, err := canonicalHeaders("http_rewrite.set_headers", h.SetHeaders)
+	if err != nil {
+		return err
 	}
-	if c.MultiPort.BasePort == 0 {
-		c.MultiPort.BasePort = 24000
+	h.SetHeaders = set
+	for group, headers := range h.GroupHeaders {
+		set, err := canonicalHeaders("http_rewrite.group_headers."+group, headers)
+		if err != nil {
+			return err
+		}
+		h.GroupHeaders[group] = set
 	}
-	if c.Management.Listen == "" {
-		c.Management.Listen = "127.0.0.1:9091"
+	return nil
+}
+
+// canonicalHeaders validates a header map and returns it with canonical
+// names.
+func canonicalHeaders(field string, headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
 	}
-	if c.Management.ProbeTarget == "" {
-		c.Management.ProbeTarget = "www.apple.com:80"
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("%s: invalid header name %q", field, name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%s: value of %s must be a single line", field, name)
+		}
+		out[http.CanonicalHeaderKey(strings.TrimSpace(name))] = value
 	}
-	if c.Management.Enabled == nil {
-		defaultEnabled := true
-		c.Management.Enabled = &defaultEnabled
+	return out, nil
+}
+
+func validHeaderName(name string) bool {
+	name = strings.TrimSpace(name)
+	return name != "" && !strings.ContainsAny(name, " \t\r\n:")
+}
+
+func (c *Config) normalizeTransparent() error {
+	t := &c.Transparent
+	if !t.Enabled {
+		return nil
 	}
-	if c.SubscriptionRefresh.Interval <= 0 {
-		c.SubscriptionRefresh.Interval = 1 * time.Hour
+	if c.Mode != "pool" && c.Mode != "hybrid" {
+		c.warnf("transparent.enabled", "mode is %q; the transparent inbound only applies to pool/hybrid mode, disabling", c.Mode)
+		t.Enabled = false
+		return nil
 	}
-	if c.SubscriptionRefresh.Timeout <= 0 {
-		c.SubscriptionRefresh.Timeout = 30 * time.Second
+	if runtime.GOOS != "linux" {
+		c.warnf("transparent.enabled", "REDIRECT/TPROXY is only supported on Linux, disabling on %s", runtime.GOOS)
+		t.Enabled = false
+		return nil
 	}
-	if c.SubscriptionRefresh.HealthCheckTimeout <= 0 {
-		c.SubscriptionRefresh.HealthCheckTimeout = 60 * time.Second
+	t.Mode = strings.ToLower(strings.TrimSpace(t.Mode))
+	switch t.Mode {
+	case "":
+		t.Mode = TransparentRedirect
+	case TransparentRedirect, TransparentTProxy:
+	default:
+		return fmt.Errorf("unsupported transparent.mode %q (use 'redirect' or 'tproxy')", t.Mode)
 	}
-	if c.SubscriptionRefresh.DrainTimeout <= 0 {
-		c.SubscriptionRefresh.DrainTimeout = 30 * time.Second
+	if t.Listen == "" {
+		t.Listen = "0.0.0.0"
 	}
-	if c.SubscriptionRefresh.MinAvailableNodes <= 0 {
-		c.SubscriptionRefresh.MinAvailableNodes = 1
+	if _, err := netip.ParseAddr(t.Listen); err != nil {
+		return fmt.Errorf("transparent.listen: invalid address %q", t.Listen)
 	}
-
-	if len(c.Nodes) == 0 {
-		return errors.New("config.nodes cannot be empty")
+	if t.Port == 0 {
+		t.Port = 7892
+		if t.Mode == TransparentTProxy {
+			t.Port = 7893
+		}
 	}
-
-	// Build set of ports already assigned from portMap
-	usedPorts := make(map[uint16]bool)
-	if c.Mode == "hybrid" {
-		usedPorts[c.Listener.Port] = true
+	if t.Port == c.Listener.Port {
+		return fmt.Errorf("transparent.port %d is already used by listener.port", t.Port)
 	}
+	return nil
+}
 
-	// First pass: assign ports from portMap for existing nodes
+// normalizeNodeBinds validates the outbound interface and source address
+// of the nodes and of multi_port. Whether the interface exists is only
+// known on the host that runs the nodes, so it is not checked here.
+func (c *Config) normalizeNodeBinds() error {
+	c.MultiPort.Interface = strings.TrimSpace(c.MultiPort.Interface)
+	c.MultiPort.BindAddress = strings.TrimSpace(c.MultiPort.BindAddress)
+	if c.MultiPort.BindAddress != "" {
+		if _, err := netip.ParseAddr(c.MultiPort.BindAddress); err != nil {
+			return fmt.Errorf("multi_port.bind_address: invalid address %q", c.MultiPort.BindAddress)
+		}
+	}
 	for idx := range c.Nodes {
-		c.Nodes[idx].Name = strings.TrimSpace(c.Nodes[idx].Name)
-		c.Nodes[idx].URI = strings.TrimSpace(c.Nodes[idx].URI)
-		if c.Nodes[idx].URI == "" {
-			return fmt.Errorf("node %d is missing uri", idx)
+		node := &c.Nodes[idx]
+		node.Interface = strings.TrimSpace(node.Interface)
+		node.BindAddress = strings.TrimSpace(node.BindAddress)
+		if node.BindAddress == "" {
+			continue
 		}
+		if _, err := netip.ParseAddr(node.BindAddress); err != nil {
+			return fmt.Errorf("node %q: invalid bind_address %q", node.Name, node.BindAddress)
+		}
+	}
+	return nil
+}
 
-		// Auto-extract name from URI if not provided
-		if c.Nodes[idx].Name == "" {
-			c.Nodes[idx].Name = ExtractNodeName(c.Nodes[idx].URI)
+// NodeBind returns the local interface and source address the node's
+// server is dialed from, falling back to the multi_port defaults in
+// multi-port and hybrid mode. Empty values leave the choice to the OS.
+func (c *Config) NodeBind(node NodeConfig) (iface, bindAddress string) {
+	iface, bindAddress = node.Interface, node.BindAddress
+	if c.Mode == "multi-port" || c.Mode == "hybrid" {
+		if iface == "" {
+			iface = c.MultiPort.Interface
 		}
-		if c.Nodes[idx].Name == "" {
-			c.Nodes[idx].Name = fmt.Sprintf("node-%d", idx)
+		if bindAddress == "" {
+			bindAddress = c.MultiPort.BindAddress
 		}
+	}
+	return iface, bindAddress
+}
 
-		// Check if this node has a preserved port from portMap. Guard against a
-		// port that was already claimed by an earlier node sharing the same
-		// stable key (e.g. a subscription listing the same server twice under
-		// different display names): preserving it again would bind the same
-		// proxy port twice (EADDRINUSE). Such a node is left at Port==0 so the
-		// second pass assigns it a fresh, collision-free port.
-		if c.Mode == "multi-port" || c.Mode == "hybrid" {
-			nodeKey := c.Nodes[idx].NodeKey()
-			if existingPort, ok := portMap[nodeKey]; ok && existingPort > 0 {
-				if usedPorts[existingPort] {
-					log.Printf("⚠️  Port %d already assigned to another node with the same identity; node %q will get a fresh port", existingPort, c.Nodes[idx].Name)
-				} else {
-					c.Nodes[idx].Port = existingPort
-					usedPorts[existingPort] = true
-					log.Printf("✅ Preserved port %d for node %q", existingPort, c.Nodes[idx].Name)
-				}
-			}
+// normalizeMultiPortGroupBy validates multi_port.group_by. Country and region
+// grouping rely on GeoIP; without it every node lands in the "other" group.
+// Lazy listening is only supported for per-node ports.
+func (c *Config) normalizeMultiPortGroupBy() error {
+	mp := &c.MultiPort
+	mp.GroupBy = strings.ToLower(strings.TrimSpace(mp.GroupBy))
+	switch mp.GroupBy {
+	case "":
+		mp.GroupBy = MultiPortByNode
+	case MultiPortByNode, MultiPortByGroup:
+	case MultiPortByCountry, MultiPortByRegion:
+		if !c.GeoIP.Enabled && (c.Mode == "multi-port" || c.Mode == "hybrid") {
+			c.warnf("multi_port.group_by", "%q needs geoip, which is disabled; all nodes will share one port", mp.GroupBy)
 		}
+	default:
+		return fmt.Errorf("unsupported multi_port.group_by %q (use 'node', 'country', 'region' or 'group')", mp.GroupBy)
+	}
+	if mp.Lazy && mp.GroupBy != MultiPortByNode {
+		c.warnf("multi_port.lazy", "only applies to per-node ports (group_by: node), ignoring")
+		mp.Lazy = false
+	}
+	if mp.IdleTimeout <= 0 {
+		mp.IdleTimeout = 10 * time.Minute
 	}
+	return nil
+}
 
-	// Second pass: assign new ports for nodes without preserved ports. portCursor
-	// is an int (not uint16) so the >65535 exhaustion guard actually fires:
-	// a uint16 cursor would wrap to 0 and silently hand out unbindable low ports.
-	portCursor := int(c.MultiPort.BasePort)
-	for idx := range c.Nodes {
-		if c.Nodes[idx].Port == 0 && (c.Mode == "multi-port" || c.Mode == "hybrid") {
-			// Find next available port that's not used
-			for usedPorts[uint16(portCursor)] || !IsPortAvailable(c.MultiPort.Address, uint16(portCursor)) {
-				portCursor++
-				if portCursor > 65535 {
-					return fmt.Errorf("no available ports found starting from %d", c.MultiPort.BasePort)
+// normalizeRules validates the routing rules section. Group names are
+// case-insensitive; whether a group actually has nodes is only known once
+// the nodes are built, so unknown targets are reported by the builder.
+func (c *Config) normalizeRules() error {
+	for idx := range c.Rules {
+		rule := &c.Rules[idx]
+		rule.Group = strings.ToLower(strings.TrimSpace(rule.Group))
+		if rule.Group == "" {
+			return fmt.Errorf("rules[%d]: group is required", idx)
+		}
+		if len(rule.DomainSuffix) == 0 && len(rule.DomainKeyword) == 0 && len(rule.IPCIDR) == 0 && len(rule.GeoIP) == 0 && len(rule.Method) == 0 {
+			return fmt.Errorf("rules[%d]: at least one of method, domain_suffix, domain_keyword, ip_cidr or geoip is required", idx)
+		}
+		if rule.Group == RuleGroupSticky && !c.Sticky.Enabled {
+			return fmt.Errorf("rules[%d]: group sticky requires sticky.enabled", idx)
+		}
+		if err := normalizeRuleMethods(rule); err != nil {
+			return fmt.Errorf("rules[%d]: %w", idx, err)
+		}
+		for _, cidr := range rule.IPCIDR {
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				if _, err := netip.ParseAddr(cidr); err != nil {
+					return fmt.Errorf("rules[%d]: invalid ip_cidr %q", idx, cidr)
 				}
 			}
-			c.Nodes[idx].Port = uint16(portCursor)
-			usedPorts[uint16(portCursor)] = true
-			log.Printf("📌 Assigned new port %d for node %q", portCursor, c.Nodes[idx].Name)
-			portCursor++
-		} else if c.Nodes[idx].Port == 0 {
-			c.Nodes[idx].Port = uint16(portCursor)
-			portCursor++
 		}
+		if len(rule.GeoIP) > 0 && c.GeoIP.DatabasePath == "" {
+			return fmt.Errorf("rules[%d]: geoip matching requires geoip.database_path", idx)
+		}
+	}
+	return nil
+}
+
+// normalizeRuleMethods upper-cases rule.Method and checks that the rule
+// only uses matchers available for plain HTTP requests.
+func normalizeRuleMethods(rule *RuleConfig) error {
+	if len(rule.Method) == 0 {
+		return nil
+	}
+	if len(rule.IPCIDR) > 0 || len(rule.GeoIP) > 0 {
+		return fmt.Errorf("method cannot be combined with ip_cidr or geoip; plain HTTP requests are matched by their Host header")
+	}
+	for i, method := range rule.Method {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" || strings.Trim(method, "ABCDEFGHIJKLMNOPQRSTUVWXYZ-") != "" {
+			return fmt.Errorf("invalid method %q", rule.Method[i])
+		}
+		if method == http.MethodConnect {
+			return fmt.Errorf("method CONNECT cannot be matched; CONNECT tunnels follow the other rules")
+		}
+		rule.Method[i] = method
+	}
+	return nil
+}
 
-		// Apply default credentials
-		if c.Mode == "multi-port" || c.Mode == "hybrid" {
-			if c.Nodes[idx].Username == "" {
-				c.Nodes[idx].Username = c.MultiPort.Username
-				c.Nodes[idx].Password = c.MultiPort.Password
+// poolModes are the scheduling modes understood by the pool outbound.
+var poolModes = []string{"sequential", "random", "balance", "latency", "weighted", "bandwidth", "cost"}
+
+// normalizePoolGroups validates pool.groups. Group names are matched
+// case-insensitively like nodes[].group and rules[].group; a group with no
+// node is kept but reported, since subscriptions may fill it later.
+func (c *Config) normalizePoolGroups() error {
+	if len(c.Pool.Groups) == 0 {
+		return nil
+	}
+	nodeGroups := make(map[string]bool)
+	standbyGroups := make(map[string]bool)
+	for _, node := range c.Nodes {
+		if group := strings.ToLower(strings.TrimSpace(node.Group)); group != "" {
+			nodeGroups[group] = true
+			standbyGroups[group] = standbyGroups[group] || node.Standby
+		}
+	}
+	groups := make(map[string]GroupPoolConfig, len(c.Pool.Groups))
+	for _, name := range slices.Sorted(maps.Keys(c.Pool.Groups)) {
+		gc := c.Pool.Groups[name]
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" {
+			return fmt.Errorf("pool.groups: group name is required")
+		}
+		if _, dup := groups[key]; dup {
+			return fmt.Errorf("pool.groups: group %q is configured twice", key)
+		}
+		field := "pool.groups." + key
+		gc.Mode = strings.ToLower(strings.TrimSpace(gc.Mode))
+		if gc.Mode != "" && !slices.Contains(poolModes, gc.Mode) {
+			return fmt.Errorf("%s.mode: unsupported mode %q (use %s)", field, gc.Mode, strings.Join(poolModes, ", "))
+		}
+		if gc.FailureThreshold < 0 {
+			return fmt.Errorf("%s.failure_threshold must be >= 0, got %d", field, gc.FailureThreshold)
+		}
+		if gc.BlacklistDuration < 0 {
+			return fmt.Errorf("%s.blacklist_duration must be >= 0, got %s", field, gc.BlacklistDuration)
+		}
+		if gc.SLO != nil {
+			slo, err := normalizeSLO(field+".slo", *gc.SLO)
+			if err != nil {
+				return err
 			}
+			gc.SLO = &slo
 		}
+		if !nodeGroups[key] {
+			c.warnf(field, "no node is in group %q", key)
+		} else if gc.SLO != nil && !standbyGroups[key] {
+			c.warnf(field+".slo", "group %q has no standby node; nodes that miss the SLO are only replaced by the rest of the pool", key)
+		}
+		groups[key] = gc
 	}
+	c.Pool.Groups = groups
+	return nil
+}
 
-	if c.LogLevel == "" {
-		c.LogLevel = "info"
+// normalizeSLO validates an SLO and fills in its defaults.
+func normalizeSLO(field string, slo SLOConfig) (SLOConfig, error) {
+	if slo.Connect <= 0 {
+		return slo, fmt.Errorf("%s.connect is required (e.g. 800ms)", field)
 	}
+	if slo.Percentile == 0 {
+		slo.Percentile = 95
+	}
+	if slo.Percentile < 1 || slo.Percentile > 100 {
+		return slo, fmt.Errorf("%s.percentile must be between 1 and 100, got %d", field, slo.Percentile)
+	}
+	if slo.Window < 0 || slo.MinSamples < 0 || slo.Cooldown < 0 {
+		return slo, fmt.Errorf("%s: window, min_samples and cooldown must be >= 0", field)
+	}
+	if slo.Window == 0 {
+		slo.Window = 5 * time.Minute
+	}
+	if slo.MinSamples == 0 {
+		slo.MinSamples = 20
+	}
+	if slo.Cooldown == 0 {
+		slo.Cooldown = slo.Window
+	}
+	return slo, nil
+}
 
-	c.normalizeLogConfig()
-
-	if err := c.normalizeSticky(); err != nil {
-		return err
+// PoolFor returns the pool settings that apply to the nodes of group: the
+// pool section with the group's overrides from pool.groups applied.
+func (c *Config) PoolFor(group string) PoolConfig {
+	pool := c.Pool
+	gc, ok := c.Pool.Groups[strings.ToLower(strings.TrimSpace(group))]
+	if !ok {
+		return pool
+	}
+	if gc.Mode != "" {
+		pool.Mode = gc.Mode
+	}
+	if gc.FailureThreshold > 0 {
+		pool.FailureThreshold = gc.FailureThreshold
 	}
+	if gc.BlacklistDuration > 0 {
+		pool.BlacklistDuration = gc.BlacklistDuration
+	}
+	return pool
+}
 
+// normalizeMaxRetries maps pool.max_retries onto retry_enabled/retry_attempts.
+func (c *Config) normalizeMaxRetries() error {
+	if c.Pool.MaxRetries == nil {
+		return nil
+	}
+	retries := *c.Pool.MaxRetries
+	if retries < 0 {
+		return fmt.Errorf("pool.max_retries must be >= 0, got %d", retries)
+	}
+	enabled := retries > 0
+	c.Pool.RetryEnabled = &enabled
+	c.Pool.RetryAttempts = retries + 1
 	return nil
 }
 
-// normalizeSticky applies defaults and validation for the optional sticky entry port.
-// Sticky sessions only apply to the shared pool entry, so they are disabled
-// outside pool/hybrid mode. Must run after node ports are assigned.
-func (c *Config) normalizeSticky() error {
-	if !c.Sticky.Enabled {
-		return nil
+// normalizeHealthCheck applies defaults and validation for pool.health_check.
+func (c *Config) normalizeHealthCheck() error {
+	hc := &c.Pool.HealthCheck
+	if hc.Interval <= 0 {
+		hc.Interval = 5 * time.Minute
 	}
-	if c.Mode != "pool" && c.Mode != "hybrid" {
-		log.Printf("⚠️  sticky.enabled is set but mode is %q; sticky only applies to pool/hybrid mode, disabling", c.Mode)
-		c.Sticky.Enabled = false
-		return nil
+	if hc.Timeout <= 0 {
+		hc.Timeout = 8 * time.Second
 	}
-	if c.Sticky.Port == 0 {
-		if c.Listener.Port >= 65535 {
-			return fmt.Errorf("cannot auto-assign sticky.port (listener.port is %d); set sticky.port explicitly", c.Listener.Port)
-		}
-		c.Sticky.Port = c.Listener.Port + 1
+	hc.Type = strings.ToLower(strings.TrimSpace(hc.Type))
+	switch hc.Type {
+	case "":
+		hc.Type = "http"
+	case "http", "tcp", "tls":
+	default:
+		return fmt.Errorf("unsupported pool.health_check.type %q (use 'http', 'tcp' or 'tls')", hc.Type)
 	}
-	if c.Sticky.Port == c.Listener.Port {
-		return fmt.Errorf("sticky.port %d conflicts with listener.port", c.Sticky.Port)
+	if hc.HealthyThreshold <= 0 {
+		hc.HealthyThreshold = 1
 	}
-	for idx := range c.Nodes {
-		if c.Nodes[idx].Port == c.Sticky.Port {
-			return fmt.Errorf("sticky.port %d conflicts with node %q port", c.Sticky.Port, c.Nodes[idx].Name)
-		}
+	if hc.UnhealthyThreshold <= 0 {
+		hc.UnhealthyThreshold = 2
+	}
+	return nil
+}
+
+func (c *Config) normalizeCircuitBreaker() error {
+	cb := &c.Pool.CircuitBreaker
+	if cb.HalfOpenInterval < 0 || cb.MaxHalfOpenInterval < 0 {
+		return fmt.Errorf("pool.circuit_breaker intervals must be >= 0")
+	}
+	if cb.HalfOpenInterval == 0 {
+		cb.HalfOpenInterval = 30 * time.Second
+	}
+	if cb.MaxHalfOpenInterval == 0 {
+		cb.MaxHalfOpenInterval = 10 * time.Minute
+	}
+	if cb.MaxHalfOpenInterval < cb.HalfOpenInterval {
+		c.warnf("pool.circuit_breaker.max_half_open_interval", "%s is shorter than half_open_interval %s, using %s",
+			cb.MaxHalfOpenInterval, cb.HalfOpenInterval, cb.HalfOpenInterval)
+		cb.MaxHalfOpenInterval = cb.HalfOpenInterval
 	}
 	return nil
 }
@@ -808,6 +2304,44 @@ func (c *Config) normalizeLogConfig() {
 	}
 }
 
+// normalizeAccessLog validates the access log format and applies defaults.
+func (c *Config) normalizeAccessLog() error {
+	a := &c.AccessLog
+	a.LogFormat = strings.ToLower(strings.TrimSpace(a.LogFormat))
+	switch a.LogFormat {
+	case "":
+		a.LogFormat = AccessLogFormatJSON
+	case AccessLogFormatJSON, AccessLogFormatText:
+	default:
+		return fmt.Errorf("access_log.log_format must be %q or %q, got %q", AccessLogFormatJSON, AccessLogFormatText, a.LogFormat)
+	}
+	if a.RotateInterval < 0 {
+		return fmt.Errorf("access_log.rotate_interval must not be negative")
+	}
+	if a.History < 0 {
+		return fmt.Errorf("access_log.history must not be negative")
+	}
+	if a.Tags < 0 {
+		return fmt.Errorf("access_log.tags must not be negative")
+	}
+	if a.File == "" {
+		a.File = "logs/access.log"
+	}
+	if a.File != "stdout" && c.filePath != "" && !filepath.IsAbs(a.File) {
+		a.File = filepath.Join(filepath.Dir(c.filePath), a.File)
+	}
+	if a.MaxSize <= 0 {
+		a.MaxSize = 100
+	}
+	if a.MaxBackups <= 0 {
+		a.MaxBackups = 7
+	}
+	if a.MaxAge <= 0 {
+		a.MaxAge = 30
+	}
+	return nil
+}
+
 // ManagementEnabled reports whether the monitoring endpoint should run.
 func (c *Config) ManagementEnabled() bool {
 	if c.Management.Enabled == nil {
@@ -817,11 +2351,12 @@ func (c *Config) ManagementEnabled() bool {
 }
 
 // ProbeConcurrencyOrDefault returns the configured probe concurrency clamped
-// to a safe range (1-1024). When unset or invalid, a sensible default is used.
+// to a safe range (1-1024). When unset or invalid, the resource profile's
+// default is used.
 func (c *Config) ProbeConcurrencyOrDefault() int {
 	v := c.Management.ProbeConcurrency
 	if v <= 0 {
-		return 32
+		return c.Resources().ProbeConcurrency
 	}
 	if v > 1024 {
 		return 1024
@@ -829,6 +2364,18 @@ func (c *Config) ProbeConcurrencyOrDefault() int {
 	return v
 }
 
+// LoadNodesFile reads a nodes_file and marks its nodes with NodeSourceFile.
+func LoadNodesFile(path string) ([]NodeConfig, error) {
+	nodes, err := loadNodesFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range nodes {
+		nodes[idx].Source = NodeSourceFile
+	}
+	return nodes, nil
+}
+
 // loadNodesFromFile reads a nodes file where each line is a proxy URI
 // Lines starting with # are comments, empty lines are ignored
 func loadNodesFromFile(path string) ([]NodeConfig, error) {
@@ -982,6 +2529,9 @@ func IsProxyURI(s string) bool {
 			return true
 		}
 	}
+	if scheme, _, ok := strings.Cut(lower, "://"); ok {
+		return plugin.Has(scheme)
+	}
 	return false
 }
 
@@ -1270,7 +2820,62 @@ func buildAnyTLSURI(p clashProxy) string {
 func buildShadowsocksURI(p clashProxy) string {
 	// Encode method:password in base64
 	userInfo := base64.StdEncoding.EncodeToString([]byte(p.Cipher + ":" + p.Password))
-	return fmt.Sprintf("ss://%s@%s:%d#%s", userInfo, p.Server, int(p.Port), url.QueryEscape(p.Name))
+	query := ""
+	if plugin := clashSIP003Plugin(p); plugin != "" {
+		query = "?" + url.Values{"plugin": {plugin}}.Encode()
+	}
+	return fmt.Sprintf("ss://%s@%s:%d%s#%s", userInfo, p.Server, int(p.Port), query, url.QueryEscape(p.Name))
+}
+
+// clashSIP003Plugin converts Clash plugin/plugin-opts into the SIP002
+// "name;key=value" plugin parameter. Only plugins sing-box implements
+// natively are translated; others are passed through by name so the
+// builder can reject them with a clear error.
+func clashSIP003Plugin(p clashProxy) string {
+	optString := func(key string) string {
+		if v, ok := p.PluginOpts[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	optBool := func(key string) bool {
+		v, _ := p.PluginOpts[key].(bool)
+		return v
+	}
+
+	var parts []string
+	switch strings.ToLower(p.Plugin) {
+	case "":
+		return ""
+	case "obfs", "obfs-local", "simple-obfs":
+		parts = append(parts, "obfs-local")
+		if mode := optString("mode"); mode != "" {
+			parts = append(parts, "obfs="+mode)
+		}
+		if host := optString("host"); host != "" {
+			parts = append(parts, "obfs-host="+host)
+		}
+	case "v2ray-plugin":
+		parts = append(parts, "v2ray-plugin")
+		if mode := optString("mode"); mode != "" {
+			parts = append(parts, "mode="+mode)
+		}
+		if optBool("tls") {
+			parts = append(parts, "tls")
+		}
+		if host := optString("host"); host != "" {
+			parts = append(parts, "host="+host)
+		}
+		if path := optString("path"); path != "" {
+			parts = append(parts, "path="+path)
+		}
+		if optBool("mux") {
+			parts = append(parts, "mux=1")
+		}
+	default:
+		return p.Plugin
+	}
+	return strings.Join(parts, ";")
 }
 
 func buildHysteria2URI(p clashProxy) string {
@@ -1494,19 +3099,29 @@ func (c *Config) SaveNodes() error {
 	// Separate nodes by source
 	var inlineNodes []NodeConfig
 	var fileNodes []NodeConfig
+	stanzaSaved := make(map[string]bool)
 
 	for _, node := range c.Nodes {
-		// Create a clean copy without runtime fields for saving
-		cleanNode := NodeConfig{
-			Name:     node.Name,
-			URI:      node.URI,
-			Port:     node.Port,
-			Username: node.Username,
-			Password: node.Password,
+		if node.ExpandedFrom != "" && node.Source == NodeSourceInline {
+			// Placeholder, replaced by the stanza read back from config.yaml.
+			if !stanzaSaved[node.ExpandedFrom] {
+				stanzaSaved[node.ExpandedFrom] = true
+				inlineNodes = append(inlineNodes, NodeConfig{Name: node.ExpandedFrom, Expand: &NodeExpand{}})
+			}
+			continue
+		}
+		// Save a copy without the runtime fields, under the configured name
+		cleanNode := node
+		cleanNode.Name = node.ConfiguredName()
+		cleanNode.ID, cleanNode.DisplayName, cleanNode.Source = "", "", ""
+		if cleanNode.Exec != nil {
+			cleanNode.URI = "" // derived from the name on load
 		}
 		switch node.Source {
 		case NodeSourceInline:
 			inlineNodes = append(inlineNodes, cleanNode)
+		case NodeSourceTemplate:
+			// Kept as node_templates in config.yaml.
 		case NodeSourceFile, NodeSourceSubscription:
 			fileNodes = append(fileNodes, cleanNode)
 		default:
@@ -1542,8 +3157,25 @@ func (c *Config) SaveNodes() error {
 		if err := yaml.Unmarshal(data, &saveCfg); err != nil {
 			return fmt.Errorf("decode config: %w", err)
 		}
-		// Update only the inline nodes
-		saveCfg.Nodes = inlineNodes
+		// Update only the inline nodes, keeping expand stanzas as written
+		stanzas := make(map[string]NodeConfig)
+		for _, node := range saveCfg.Nodes {
+			if node.Expand != nil {
+				stanzas[node.stanzaName()] = node
+			}
+		}
+		kept := inlineNodes[:0]
+		for _, node := range inlineNodes {
+			if node.Expand != nil {
+				stanza, ok := stanzas[node.Name]
+				if !ok {
+					continue
+				}
+				node = stanza
+			}
+			kept = append(kept, node)
+		}
+		saveCfg.Nodes = kept
 
 		newData, err := yaml.Marshal(&saveCfg)
 		if err != nil {
@@ -1583,6 +3215,7 @@ func (c *Config) SaveSettings() error {
 	if err := yaml.Unmarshal(data, &saveCfg); err != nil {
 		return fmt.Errorf("decode config: %w", err)
 	}
+	fileCfg := saveCfg
 
 	saveCfg.ExternalIP = c.ExternalIP
 	saveCfg.Management.ProbeTarget = c.Management.ProbeTarget
@@ -1596,6 +3229,8 @@ func (c *Config) SaveSettings() error {
 	saveCfg.MultiPort = c.MultiPort
 	saveCfg.Pool = c.Pool
 	saveCfg.Management = c.Management
+	saveCfg.TUN.SplitTunnelConfig = c.TUN.SplitTunnelConfig
+	saveCfg.keepFileValues(c.overridden, &fileCfg)
 
 	newData, err := yaml.Marshal(&saveCfg)
 	if err != nil {
@@ -1609,12 +3244,16 @@ func (c *Config) SaveSettings() error {
 	return nil
 }
 
-// IsPortAvailable checks if a port is available for binding.
+// IsPortAvailable checks if a port is available for binding. An address
+// that is not assigned to this host yet (a failover VIP) cannot have its
+// ports taken, so every port counts as available. The probe shares ports
+// the way every listener does (see package handoff), so a port the process
+// being handed over from still holds counts as available too.
 func IsPortAvailable(address string, port uint16) bool {
 	addr := fmt.Sprintf("%s:%d", address, port)
-	ln, err := net.Listen("tcp", addr)
+	ln, err := handoff.Listen(context.Background(), "tcp", addr)
 	if err != nil {
-		return false
+		return freebind.IsAddrNotAvail(err)
 	}
 	_ = ln.Close()
 	return true
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// NodeCost is what an upstream node costs: per GB of traffic for metered
+// nodes, per hour for nodes rented by time. Flat-rate nodes leave it unset.
+// Amounts are in whatever currency the operator uses.
+type NodeCost struct {
+	PerGB   float64 `yaml:"per_gb,omitempty" json:"per_gb,omitempty"`     // 每 GB 流量费用（上下行合计，1 GB = 10^9 字节）
+	PerHour float64 `yaml:"per_hour,omitempty" json:"per_hour,omitempty"` // 每小时费用（按时长计费的节点）
+}
+
+// normalizeNodeCosts validates nodes[].cost. A cost of zero is dropped, so
+// the node counts as flat-rate.
+func (c *Config) normalizeNodeCosts() error {
+	metered := false
+	for idx := range c.Nodes {
+		cost := c.Nodes[idx].Cost
+		if cost == nil {
+			continue
+		}
+		for _, v := range []float64{cost.PerGB, cost.PerHour} {
+			if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("node %q: cost must be a non-negative number, got %v", c.Nodes[idx].Name, v)
+			}
+		}
+		if cost.PerGB == 0 && cost.PerHour == 0 {
+			c.Nodes[idx].Cost = nil
+			continue
+		}
+		if cost.PerGB > 0 {
+			metered = true
+		}
+	}
+	if strings.EqualFold(c.Pool.Mode, "cost") && !metered {
+		c.warnf("pool.mode", "pool.mode is cost but no node sets cost.per_gb; nodes are picked by load only")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNodeCosts(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{
+		{Name: "metered", Cost: &NodeCost{PerGB: 0.8}},
+		{Name: "rented", Cost: &NodeCost{PerHour: 0.02}},
+		{Name: "zero", Cost: &NodeCost{}},
+	}}
+	cfg.Pool.Mode = "cost"
+	if err := cfg.normalizeNodeCosts(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Nodes[2].Cost != nil {
+		t.Fatalf("expected a zero cost to be dropped, got %+v", cfg.Nodes[2].Cost)
+	}
+	if warnings := cfg.Warnings(); len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %+v", warnings)
+	}
+
+	cfg = &Config{Nodes: []NodeConfig{{Name: "bad", Cost: &NodeCost{PerGB: -1}}}}
+	if err := cfg.normalizeNodeCosts(); err == nil || !strings.Contains(err.Error(), `node "bad"`) {
+		t.Fatalf("expected a negative cost to be rejected, got %v", err)
+	}
+}
+
+func TestNormalizeNodeCostsWarnsWithoutMeteredNodes(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{Name: "rented", Cost: &NodeCost{PerHour: 1}}}}
+	cfg.Pool.Mode = "Cost"
+	if err := cfg.normalizeNodeCosts(); err != nil {
+		t.Fatal(err)
+	}
+	if warnings := cfg.Warnings(); len(warnings) != 1 || warnings[0].Field != "pool.mode" {
+		t.Fatalf("expected a pool.mode warning, got %+v", warnings)
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DNS resolution modes.
+const (
+	// DNSResolveRemote passes hostnames to the upstream node, which resolves
+	// them where it is.
+	DNSResolveRemote = "remote"
+	// DNSResolveLocal resolves hostnames here and sends the node an IP.
+	DNSResolveLocal = "local"
+)
+
+// dnsStrategies are the accepted values of dns.strategy.
+var dnsStrategies = []string{"prefer_ipv4", "prefer_ipv6", "ipv4_only", "ipv6_only"}
+
+// DNSConfig controls where destination hostnames are resolved.
+type DNSConfig struct {
+	Resolve      string            `yaml:"resolve,omitempty"`       // remote(默认，交给上游节点解析) / local(本机解析后按 IP 连接)
+	Servers      []string          `yaml:"servers,omitempty"`       // 本机解析使用的 DNS 服务器，按顺序回退：8.8.8.8、tcp://、tls://、https://（DoH），留空使用系统 DNS
+	Strategy     string            `yaml:"strategy,omitempty"`      // prefer_ipv4 / prefer_ipv6 / ipv4_only / ipv6_only，默认同时查询
+	CacheSize    int               `yaml:"cache_size,omitempty"`    // 解析缓存条目数，默认 1024
+	DisableCache bool              `yaml:"disable_cache,omitempty"` // 关闭解析缓存
+	Groups       map[string]string `yaml:"groups,omitempty"`        // 按节点分组覆盖 resolve，如 residential: remote
+}
+
+// DNSServer is a parsed dns.servers entry.
+type DNSServer struct {
+	Type string // udp, tcp, tls or https
+	Host string
+	Port uint16
+	Path string // https only
+}
+
+// ParseDNSServer parses a dns.servers entry: a bare address ("8.8.8.8",
+// "1.1.1.1:53") for plain UDP, or a tcp://, tls:// or https:// URL. https
+// is DNS over HTTPS and defaults to the /dns-query path.
+func ParseDNSServer(raw string) (DNSServer, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return DNSServer{}, fmt.Errorf("empty server")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "udp://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return DNSServer{}, err
+	}
+	server := DNSServer{Type: strings.ToLower(u.Scheme), Host: u.Hostname()}
+	var defaultPort uint16
+	switch server.Type {
+	case "udp", "tcp":
+		defaultPort = 53
+	case "tls":
+		defaultPort = 853
+	case "https":
+		defaultPort = 443
+		server.Path = u.Path
+		if server.Path == "" {
+			server.Path = "/dns-query"
+		}
+	default:
+		return DNSServer{}, fmt.Errorf("unsupported scheme %q (use udp, tcp, tls or https)", u.Scheme)
+	}
+	if server.Host == "" {
+		return DNSServer{}, fmt.Errorf("missing host")
+	}
+	server.Port = defaultPort
+	if p := u.Port(); p != "" {
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil || port == 0 {
+			return DNSServer{}, fmt.Errorf("invalid port %q", p)
+		}
+		server.Port = uint16(port)
+	}
+	return server, nil
+}
+
+// IsIP reports whether the server is given by address, so reaching it needs
+// no resolver of its own.
+func (s DNSServer) IsIP() bool {
+	return net.ParseIP(s.Host) != nil
+}
+
+// ResolveLocally reports whether hostnames sent through nodes of group are
+// resolved here rather than by the node.
+func (d DNSConfig) ResolveLocally(group string) bool {
+	if mode, ok := d.Groups[strings.ToLower(strings.TrimSpace(group))]; ok {
+		return mode == DNSResolveLocal
+	}
+	return d.Resolve == DNSResolveLocal
+}
+
+// UsesLocal reports whether any node resolves hostnames locally.
+func (d DNSConfig) UsesLocal() bool {
+	if d.Resolve == DNSResolveLocal {
+		return true
+	}
+	for _, mode := range d.Groups {
+		if mode == DNSResolveLocal {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDNS validates the dns section. Group names are matched
+// case-insensitively like nodes[].group.
+func (c *Config) normalizeDNS() error {
+	d := &c.DNS
+	var err error
+	if d.Resolve, err = normalizeResolveMode(d.Resolve); err != nil {
+		return fmt.Errorf("dns.resolve: %w", err)
+	}
+	if d.Resolve == "" {
+		d.Resolve = DNSResolveRemote
+	}
+	for idx, server := range d.Servers {
+		if _, err := ParseDNSServer(server); err != nil {
+			return fmt.Errorf("dns.servers[%d] %q: %w", idx, server, err)
+		}
+	}
+	d.Strategy = strings.ToLower(strings.TrimSpace(d.Strategy))
+	if d.Strategy != "" && !slices.Contains(dnsStrategies, d.Strategy) {
+		return fmt.Errorf("dns.strategy: unsupported strategy %q (use %s)", d.Strategy, strings.Join(dnsStrategies, ", "))
+	}
+	if d.CacheSize < 0 {
+		return fmt.Errorf("dns.cache_size must be >= 0, got %d", d.CacheSize)
+	}
+
+	if len(d.Groups) > 0 {
+		nodeGroups := make(map[string]bool)
+		for _, node := range c.Nodes {
+			if group := strings.ToLower(strings.TrimSpace(node.Group)); group != "" {
+				nodeGroups[group] = true
+			}
+		}
+		groups := make(map[string]string, len(d.Groups))
+		for _, name := range slices.Sorted(maps.Keys(d.Groups)) {
+			key := strings.ToLower(strings.TrimSpace(name))
+			if key == "" {
+				return fmt.Errorf("dns.groups: group name is required")
+			}
+			if _, dup := groups[key]; dup {
+				return fmt.Errorf("dns.groups: group %q is configured twice", key)
+			}
+			mode, err := normalizeResolveMode(d.Groups[name])
+			if err != nil {
+				return fmt.Errorf("dns.groups.%s: %w", key, err)
+			}
+			if mode == "" {
+				mode = d.Resolve
+			}
+			if !nodeGroups[key] {
+				c.warnf("dns.groups."+key, "no node is in group %q", key)
+			}
+			groups[key] = mode
+		}
+		d.Groups = groups
+	}
+
+	if !d.UsesLocal() && (len(d.Servers) > 0 || d.Strategy != "") {
+		c.warnf("dns.servers", "only used for local resolution, but every node resolves remotely")
+	}
+	return nil
+}
+
+func normalizeResolveMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", DNSResolveRemote, DNSResolveLocal:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unsupported mode %q (use 'remote' or 'local')", mode)
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDNSServer(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    DNSServer
+		wantErr string
+	}{
+		{raw: "8.8.8.8", want: DNSServer{Type: "udp", Host: "8.8.8.8", Port: 53}},
+		{raw: "1.1.1.1:5353", want: DNSServer{Type: "udp", Host: "1.1.1.1", Port: 5353}},
+		{raw: "tcp://8.8.4.4", want: DNSServer{Type: "tcp", Host: "8.8.4.4", Port: 53}},
+		{raw: "tls://dns.google", want: DNSServer{Type: "tls", Host: "dns.google", Port: 853}},
+		{raw: "https://1.1.1.1", want: DNSServer{Type: "https", Host: "1.1.1.1", Port: 443, Path: "/dns-query"}},
+		{raw: "HTTPS://doh.example:8443/resolve", want: DNSServer{Type: "https", Host: "doh.example", Port: 8443, Path: "/resolve"}},
+		{raw: "[2606:4700:4700::1111]", want: DNSServer{Type: "udp", Host: "2606:4700:4700::1111", Port: 53}},
+		{raw: "quic://dns.adguard.com", wantErr: "unsupported scheme"},
+		{raw: "8.8.8.8:0", wantErr: "invalid port"},
+		{raw: " ", wantErr: "empty server"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDNSServer(tt.raw)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: expected error containing %q, got %v", tt.raw, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.raw, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDNS(t *testing.T) {
+	tests := []struct {
+		name    string
+		dns     DNSConfig
+		wantErr string
+	}{
+		{name: "empty"},
+		{name: "local", dns: DNSConfig{Resolve: " Local ", Servers: []string{"8.8.8.8", "https://1.1.1.1"}, Strategy: "IPv4_Only"}},
+		{name: "bad mode", dns: DNSConfig{Resolve: "system"}, wantErr: "dns.resolve"},
+		{name: "bad server", dns: DNSConfig{Resolve: "local", Servers: []string{"quic://x"}}, wantErr: "dns.servers[0]"},
+		{name: "bad strategy", dns: DNSConfig{Resolve: "local", Strategy: "ipv4"}, wantErr: "dns.strategy"},
+		{name: "negative cache", dns: DNSConfig{CacheSize: -1}, wantErr: "cache_size"},
+		{name: "bad group mode", dns: DNSConfig{Groups: map[string]string{"dc": "both"}}, wantErr: "dns.groups.dc"},
+		{name: "duplicate group", dns: DNSConfig{Groups: map[string]string{"dc": "local", "DC": "remote"}}, wantErr: "configured twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "dc"}}, DNS: tt.dns}
+			err := cfg.normalizeDNS()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDNSResolveLocally(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "residential"}, {Name: "b", Group: "dc"}}}
+	cfg.DNS = DNSConfig{Resolve: "local", Groups: map[string]string{"Residential": "remote", "dc": ""}}
+	if err := cfg.normalizeDNS(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DNS.ResolveLocally(" RESIDENTIAL ") {
+		t.Fatal("expected residential to resolve remotely")
+	}
+	if !cfg.DNS.ResolveLocally("dc") || !cfg.DNS.ResolveLocally("") {
+		t.Fatal("expected dc and ungrouped nodes to inherit local resolution")
+	}
+	if !cfg.DNS.UsesLocal() {
+		t.Fatal("expected UsesLocal")
+	}
+}
+
+func TestNormalizeDNSWarnsAboutUnusedServers(t *testing.T) {
+	cfg := &Config{DNS: DNSConfig{Servers: []string{"8.8.8.8"}}}
+	if err := cfg.normalizeDNS(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DNS.Resolve != DNSResolveRemote {
+		t.Fatalf("expected default resolve %q, got %q", DNSResolveRemote, cfg.DNS.Resolve)
+	}
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 || warnings[0].Field != "dns.servers" {
+		t.Fatalf("expected one warning for dns.servers, got %+v", warnings)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+)
+
+// disambiguateNames makes node names unique. Nodes sharing a name (common
+// after merging subscriptions) are renamed to "<name> #<hash>", where the
+// hash comes from the node's stable URI key, so a node keeps its suffix no
+// matter where it appears in the list or which other nodes share its name.
+// Identical URIs fall back to "-2", "-3", ... in config order.
+//
+// The name as configured is kept in DisplayName. Running it again on
+// already disambiguated nodes gives the same names.
+func disambiguateNames(nodes []NodeConfig) {
+	counts := make(map[string]int, len(nodes))
+	for i := range nodes {
+		if nodes[i].DisplayName == "" {
+			nodes[i].DisplayName = nodes[i].Name
+		}
+		counts[nodes[i].DisplayName]++
+	}
+	used := make(map[string]bool, len(nodes))
+	for i := range nodes {
+		if counts[nodes[i].DisplayName] == 1 {
+			nodes[i].Name = nodes[i].DisplayName
+			used[nodes[i].Name] = true
+		}
+	}
+	for i := range nodes {
+		display := nodes[i].DisplayName
+		if counts[display] == 1 {
+			continue
+		}
+		sum := sha1.Sum([]byte(nodes[i].NodeKey()))
+		base := display + " #" + hex.EncodeToString(sum[:2])
+		name := base
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[name] = true
+		nodes[i].Name = name
+	}
+}
+
+// ConfiguredName returns the name as written in the config, before
+// disambiguateNames added a suffix.
+func (n *NodeConfig) ConfiguredName() string {
+	if n.DisplayName != "" {
+		return n.DisplayName
+	}
+	return n.Name
+}
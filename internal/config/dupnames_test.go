@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDisambiguateNamesStable(t *testing.T) {
+	nodes := []NodeConfig{
+		{Name: "HK", URI: "socks5://1.1.1.1:1080"},
+		{Name: "JP", URI: "socks5://2.2.2.2:1080"},
+		{Name: "HK", URI: "socks5://3.3.3.3:1080"},
+	}
+	disambiguateNames(nodes)
+	if nodes[1].Name != "JP" || nodes[1].DisplayName != "JP" {
+		t.Fatalf("unique name changed: %+v", nodes[1])
+	}
+	first, second := nodes[0].Name, nodes[2].Name
+	if first == second || !strings.HasPrefix(first, "HK #") || !strings.HasPrefix(second, "HK #") {
+		t.Fatalf("names = %q, %q", first, second)
+	}
+	if nodes[0].DisplayName != "HK" || nodes[2].DisplayName != "HK" {
+		t.Fatalf("display names = %q, %q", nodes[0].DisplayName, nodes[2].DisplayName)
+	}
+
+	// Running again, or with the list reordered and another duplicate
+	// added, keeps the names already given.
+	disambiguateNames(nodes)
+	if nodes[0].Name != first || nodes[2].Name != second {
+		t.Fatalf("not idempotent: %q, %q", nodes[0].Name, nodes[2].Name)
+	}
+	reordered := []NodeConfig{
+		{Name: "HK", URI: "socks5://4.4.4.4:1080"},
+		{Name: "HK", URI: "socks5://3.3.3.3:1080"},
+		{Name: "HK", URI: "socks5://1.1.1.1:1080"},
+	}
+	disambiguateNames(reordered)
+	if reordered[1].Name != second || reordered[2].Name != first {
+		t.Fatalf("suffix depends on order: %q, %q", reordered[1].Name, reordered[2].Name)
+	}
+}
+
+func TestDisambiguateNamesIdenticalURIs(t *testing.T) {
+	nodes := []NodeConfig{
+		{Name: "dup", URI: "socks5://1.1.1.1:1080"},
+		{Name: "dup", URI: "socks5://1.1.1.1:1080"},
+	}
+	disambiguateNames(nodes)
+	if nodes[0].Name == nodes[1].Name || nodes[1].Name != nodes[0].Name+"-2" {
+		t.Fatalf("names = %q, %q", nodes[0].Name, nodes[1].Name)
+	}
+}
+
+func TestSaveNodesKeepsConfiguredNames(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	body := `
+nodes:
+  - name: dup
+    uri: socks5://1.1.1.1:1080
+  - name: dup
+    uri: socks5://1.1.1.2:1080
+`
+	if err := os.WriteFile(cfgPath, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Nodes[0].Name == cfg.Nodes[1].Name || cfg.Nodes[0].ID == cfg.Nodes[1].ID {
+		t.Fatalf("names not unique: %+v", cfg.Nodes)
+	}
+	if err := cfg.SaveNodes(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "#") || strings.Count(string(saved), "name: dup") != 2 {
+		t.Fatalf("saved config lost the configured names:\n%s", saved)
+	}
+}
+
+func TestSaveNodesKeepsNodeFields(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	body := `
+nodes:
+  - name: hk
+    uri: socks5://1.1.1.1:1080
+    weight: 3
+    max_conns: 10
+    group: residential
+    standby: true
+    interface: eth1
+    cost:
+      per_gb: 2
+`
+	if err := os.WriteFile(cfgPath, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SaveNodes(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := saved.Nodes[0]
+	if got.Weight != 3 || got.MaxConns != 10 || got.Group != "residential" || !got.Standby || got.Interface != "eth1" || got.Cost == nil || got.Cost.PerGB != 2 {
+		t.Fatalf("saved node lost fields: %+v", got)
+	}
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxExpandedNodes caps how many nodes a single expand stanza may produce.
+const maxExpandedNodes = 10000
+
+// NodeExpand turns one nodes entry into a node per upstream port and/or
+// server address, for providers exposing many exit IPs behind sequential
+// ports or an address range. With both set every combination is generated.
+type NodeExpand struct {
+	Ports   string `yaml:"ports,omitempty" json:"ports,omitempty"`     // 上游端口，如 "10001-10100" 或 "8001,8003,9000-9010"
+	Servers string `yaml:"servers,omitempty" json:"servers,omitempty"` // 上游地址，如 "203.0.113.10-203.0.113.40"、"203.0.113.0/27" 或逗号分隔的主机名
+}
+
+// expandNodes replaces every entry with an expand stanza by the nodes it
+// describes. Other entries are returned unchanged.
+func expandNodes(nodes []NodeConfig) ([]NodeConfig, error) {
+	hasStanza := false
+	for _, node := range nodes {
+		if node.Expand != nil {
+			hasStanza = true
+			break
+		}
+	}
+	if !hasStanza {
+		return nodes, nil
+	}
+	out := make([]NodeConfig, 0, len(nodes))
+	for idx, node := range nodes {
+		if node.Expand == nil {
+			out = append(out, node)
+			continue
+		}
+		expanded, err := node.expand()
+		if err != nil {
+			return nil, fmt.Errorf("node %d (%s): expand: %w", idx, node.stanzaName(), err)
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
+
+// stanzaName is the base name of the nodes an expand stanza produces.
+func (n *NodeConfig) stanzaName() string {
+	if name := strings.TrimSpace(n.Name); name != "" {
+		return name
+	}
+	if name := ExtractNodeName(n.URI); name != "" {
+		return name
+	}
+	return "node"
+}
+
+func (n *NodeConfig) expand() ([]NodeConfig, error) {
+	ports, err := parsePortList(n.Expand.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("ports: %w", err)
+	}
+	servers, err := parseServerList(n.Expand.Servers)
+	if err != nil {
+		return nil, fmt.Errorf("servers: %w", err)
+	}
+	if len(ports) == 0 && len(servers) == 0 {
+		return nil, fmt.Errorf("set ports and/or servers")
+	}
+	if len(ports) == 0 {
+		ports = []uint16{0}
+	}
+	if len(servers) == 0 {
+		servers = []string{""}
+	}
+	if total := len(ports) * len(servers); total > maxExpandedNodes {
+		return nil, fmt.Errorf("%d nodes exceed the limit of %d", total, maxExpandedNodes)
+	}
+
+	base := n.stanzaName()
+	var out []NodeConfig
+	for _, server := range servers {
+		for _, port := range ports {
+			uri, err := setURIEndpoint(strings.TrimSpace(n.URI), server, port)
+			if err != nil {
+				return nil, err
+			}
+			node := *n
+			node.Expand = nil
+			node.ExpandedFrom = base
+			node.URI = uri
+			node.Name = base + "-" + endpointSuffix(server, port)
+			if n.Port != 0 {
+				listen := int(n.Port) + len(out)
+				if listen > 65535 {
+					return nil, fmt.Errorf("local port %d+%d exceeds 65535", n.Port, len(out))
+				}
+				node.Port = uint16(listen)
+			}
+			out = append(out, node)
+		}
+	}
+	return out, nil
+}
+
+func endpointSuffix(server string, port uint16) string {
+	switch {
+	case server == "":
+		return strconv.Itoa(int(port))
+	case port == 0:
+		return server
+	}
+	return net.JoinHostPort(server, strconv.Itoa(int(port)))
+}
+
+// parsePortList parses "8001,8003,9000-9010".
+func parsePortList(spec string) ([]uint16, error) {
+	var ports []uint16
+	for _, part := range splitList(spec) {
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := parsePort(lo)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = parsePort(hi); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("range %q is reversed", part)
+			}
+		}
+		for p := int(first); p <= int(last); p++ {
+			ports = append(ports, uint16(p))
+			if len(ports) > maxExpandedNodes {
+				return nil, fmt.Errorf("more than %d ports", maxExpandedNodes)
+			}
+		}
+	}
+	return ports, nil
+}
+
+func parsePort(s string) (uint16, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint16(p), nil
+}
+
+// parseServerList parses comma-separated hosts, IP ranges
+// ("203.0.113.10-203.0.113.40") and CIDR prefixes ("203.0.113.0/27").
+func parseServerList(spec string) ([]string, error) {
+	var servers []string
+	add := func(addr netip.Addr) error {
+		servers = append(servers, addr.String())
+		if len(servers) > maxExpandedNodes {
+			return fmt.Errorf("more than %d servers", maxExpandedNodes)
+		}
+		return nil
+	}
+	for _, part := range splitList(spec) {
+		switch {
+		case strings.Contains(part, "/"):
+			prefix, err := netip.ParsePrefix(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid prefix %q", part)
+			}
+			for addr := prefix.Masked().Addr(); prefix.Contains(addr); addr = addr.Next() {
+				if err := add(addr); err != nil {
+					return nil, err
+				}
+			}
+		case strings.Contains(part, "-"):
+			lo, hi, _ := strings.Cut(part, "-")
+			first, err1 := netip.ParseAddr(strings.TrimSpace(lo))
+			last, err2 := netip.ParseAddr(strings.TrimSpace(hi))
+			if err1 != nil || err2 != nil {
+				// Not an address range: a host name containing a dash.
+				servers = append(servers, part)
+				continue
+			}
+			if first.BitLen() != last.BitLen() || last.Less(first) {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+			for addr := first; addr.IsValid() && !last.Less(addr); addr = addr.Next() {
+				if err := add(addr); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			servers = append(servers, part)
+		}
+	}
+	return servers, nil
+}
+
+func splitList(spec string) []string {
+	var parts []string
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// setURIEndpoint replaces the server host (when server is non-empty) and
+// port (when non-zero) of a proxy URI.
+func setURIEndpoint(uri, server string, port uint16) (string, error) {
+	if strings.HasPrefix(uri, "vmess://") {
+		return setVMessEndpoint(uri, server, port)
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("uri must have the form scheme://[userinfo@]host:port")
+	}
+	host, portStr := u.Hostname(), u.Port()
+	if server != "" {
+		host = server
+	}
+	if port != 0 {
+		portStr = strconv.Itoa(int(port))
+	}
+	if portStr == "" {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	} else {
+		u.Host = net.JoinHostPort(host, portStr)
+	}
+	return u.String(), nil
+}
+
+// setVMessEndpoint rewrites the "add" and "port" fields of a base64 JSON
+// vmess:// link, keeping every other field.
+func setVMessEndpoint(uri, server string, port uint16) (string, error) {
+	payload := strings.TrimPrefix(uri, "vmess://")
+	fragment := ""
+	if idx := strings.Index(payload, "#"); idx != -1 {
+		payload, fragment = payload[:idx], payload[idx:]
+	}
+	payload = strings.TrimSpace(payload)
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(payload)
+	}
+	if err != nil {
+		decoded, err = base64.RawURLEncoding.DecodeString(payload)
+	}
+	if err != nil {
+		return "", fmt.Errorf("decode vmess link: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return "", fmt.Errorf("decode vmess link: %w", err)
+	}
+	if server != "" {
+		fields["add"] = server
+	}
+	if port != 0 {
+		fields["port"] = strconv.Itoa(int(port))
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(encoded) + fragment, nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeHealthCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      HealthCheckConfig
+		want    HealthCheckConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: HealthCheckConfig{Interval: 5 * time.Minute, Type: "http", Timeout: 8 * time.Second, HealthyThreshold: 1, UnhealthyThreshold: 2},
+		},
+		{
+			name: "explicit values kept, type lower-cased",
+			in:   HealthCheckConfig{Interval: time.Minute, Type: " TCP ", Timeout: 3 * time.Second, HealthyThreshold: 2, UnhealthyThreshold: 5},
+			want: HealthCheckConfig{Interval: time.Minute, Type: "tcp", Timeout: 3 * time.Second, HealthyThreshold: 2, UnhealthyThreshold: 5},
+		},
+		{
+			name:    "unknown type rejected",
+			in:      HealthCheckConfig{Type: "icmp"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Pool: PoolConfig{HealthCheck: tt.in}}
+			err := cfg.normalizeHealthCheck()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.Pool.HealthCheck != tt.want {
+				t.Fatalf("got %+v, want %+v", cfg.Pool.HealthCheck, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestNormalizeHTTPRewrite(t *testing.T) {
+	cfg := &Config{Mode: "pool", HTTPRewrite: HTTPRewriteConfig{
+		Enabled:       true,
+		RemoveHeaders: []string{" x-trace "},
+		SetHeaders:    map[string]string{"accept-language": "en"},
+		GroupHeaders:  map[string]map[string]string{"jp": {"accept-language": "ja"}},
+	}}
+	if err := cfg.normalizeHTTPRewrite(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := cfg.HTTPRewrite
+	if h.RemoveHeaders[0] != "X-Trace" || h.SetHeaders["Accept-Language"] != "en" || h.GroupHeaders["jp"]["Accept-Language"] != "ja" {
+		t.Fatalf("header names not canonicalized: %+v", h)
+	}
+
+	for _, bad := range []HTTPRewriteConfig{
+		{Enabled: true, RemoveHeaders: []string{""}},
+		{Enabled: true, SetHeaders: map[string]string{"X Bad": "1"}},
+		{Enabled: true, SetHeaders: map[string]string{"X-Inject": "a\r\nHost: evil"}},
+		{Enabled: true, GroupHeaders: map[string]map[string]string{"jp": {"X:Bad": "1"}}},
+	} {
+		cfg := &Config{Mode: "pool", HTTPRewrite: bad}
+		if err := cfg.normalizeHTTPRewrite(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+
+	cfg = &Config{Mode: "multi-port", HTTPRewrite: HTTPRewriteConfig{Enabled: true}}
+	if err := cfg.normalizeHTTPRewrite(); err != nil || len(cfg.Warnings()) != 1 {
+		t.Fatalf("expected a warning without a rewriting entry (err=%v, warnings=%v)", err, cfg.Warnings())
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeIdleTimeout(t *testing.T) {
+	cfg := &Config{}
+	cfg.Pool.IdleTimeout = -time.Second
+	if err := cfg.normalizeConnLimits(); err == nil {
+		t.Fatal("expected an error for a negative idle_timeout")
+	}
+
+	cfg = &Config{}
+	cfg.Pool.IdleTimeout = 5 * time.Minute
+	if err := cfg.normalizeConnLimits(); err != nil || len(cfg.Warnings()) != 0 {
+		t.Fatalf("unexpected result: %v, %v", err, cfg.Warnings())
+	}
+
+	cfg = &Config{}
+	cfg.Pool.IdleTimeout = 5 * time.Second
+	if err := cfg.normalizeConnLimits(); err != nil || len(cfg.Warnings()) != 1 {
+		t.Fatalf("expected a warning for a short idle_timeout: %v, %v", err, cfg.Warnings())
+	}
+}
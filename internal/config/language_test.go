@@ -0,0 +1,19 @@
+package config
+
+import "testing"
+
+func TestParseLanguage(t *testing.T) {
+	for tag, want := range map[string]string{
+		"zh-CN":   LanguageZH,
+		"zh":      LanguageZH,
+		"zh-Hans": LanguageZH,
+		" EN ":    LanguageEN,
+		"en-US":   LanguageEN,
+		"ja":      "",
+		"":        "",
+	} {
+		if got := ParseLanguage(tag); got != want {
+			t.Errorf("ParseLanguage(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
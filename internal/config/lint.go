@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Severities of lint findings, from least to most serious.
+const (
+	SeverityInfo  = "info"
+	SeverityWarn  = "warn"
+	SeverityError = "error"
+)
+
+var severities = []string{SeverityInfo, SeverityWarn, SeverityError}
+
+// ParseSeverity validates a severity name as used by "lint -fail-on".
+func ParseSeverity(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		s = SeverityWarn
+	}
+	if !slices.Contains(severities, s) {
+		return "", fmt.Errorf("unknown severity %q (use %s)", s, strings.Join(severities, ", "))
+	}
+	return s, nil
+}
+
+// AtLeast reports whether severity is as serious as min or more.
+func AtLeast(severity, min string) bool {
+	return slices.Index(severities, severity) >= slices.Index(severities, min)
+}
+
+// Finding is a setting that works but is risky, such as an open proxy or
+// a management API reachable without a password.
+type Finding struct {
+	Severity string `json:"severity"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+// Lint checks the normalized config for security foot-guns. Unlike
+// Warnings, findings never stop or change the config; they are printed by
+// "easy_proxies lint" and logged at startup.
+func (c *Config) Lint() []Finding {
+	var findings []Finding
+	add := func(severity, field, format string, args ...any) {
+		findings = append(findings, Finding{Severity: severity, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	poolMode := c.Mode == "pool" || c.Mode == "hybrid"
+	if poolMode && len(c.ListenerUsers()) == 0 {
+		if scope := listenScope(c.Listener.Address); scope != scopeLoopback {
+			add(openProxySeverity(scope), "listener", "the pool entry listens on %s without credentials; anyone who can reach it can use your nodes", describeListen(c.Listener.Address))
+		}
+		if c.GeoIP.Enabled {
+			listen := c.GeoIP.Listen
+			if listen == "" {
+				listen = c.Listener.Address
+			}
+			if scope := listenScope(listen); scope != scopeLoopback {
+				add(openProxySeverity(scope), "geoip.listen", "the GeoIP router listens on %s without credentials", describeListen(listen))
+			}
+		}
+	}
+	if (c.Mode == "multi-port" || c.Mode == "hybrid") && c.MultiPort.Username == "" {
+		if scope := listenScope(c.MultiPort.Address); scope != scopeLoopback {
+			add(openProxySeverity(scope), "multi_port", "per-node ports listen on %s without credentials", describeListen(c.MultiPort.Address))
+		}
+	}
+	if c.Transparent.Enabled {
+		if scope := listenScope(c.Transparent.Listen); scope != scopeLoopback {
+			add(SeverityInfo, "transparent.listen", "the transparent entry on %s takes no credentials; make sure only the redirected traffic can reach it", describeListen(c.Transparent.Listen))
+		}
+	}
+
+	if c.ManagementEnabled() {
+		if scope := listenScope(c.Management.Listen); scope != scopeLoopback {
+			switch {
+			case c.Management.Password == "":
+				add(openProxySeverity(scope), "management.password", "the management API on %s has no password; anyone who can reach it can read node credentials and change the config", c.Management.Listen)
+			case !c.Management.TLS.Enabled() && scope != scopePrivate:
+				add(SeverityWarn, "management", "the management API on %s is served without TLS; the password and session cookie travel in clear text", c.Management.Listen)
+			}
+		}
+	}
+	if c.Cluster.Enabled {
+		for _, peer := range c.Cluster.Peers {
+			if u, err := url.Parse(peer); err == nil && u.Scheme == "http" && listenScope(u.Hostname()) == scopePublic {
+				add(SeverityWarn, "cluster.peers", "peer %s is reached over plain HTTP on a public address; the cluster secret is sent in clear text", peer)
+			}
+		}
+	}
+
+	if c.SkipCertVerify {
+		add(SeverityWarn, "skip_cert_verify", "TLS certificates of every node are not verified; a man in the middle can read and alter the traffic")
+	} else if insecure := c.insecureNodes(); insecure > 0 {
+		severity := SeverityInfo
+		if insecure == len(c.Nodes) {
+			severity = SeverityWarn
+		}
+		add(severity, "nodes", "%d of %d nodes skip TLS certificate verification (insecure / allowInsecure in the URI)", insecure, len(c.Nodes))
+	}
+	return findings
+}
+
+// insecureNodes counts the nodes whose URI turns certificate checks off.
+func (c *Config) insecureNodes() int {
+	n := 0
+	for _, node := range c.Nodes {
+		u, err := url.Parse(node.URI)
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		for _, key := range []string{"insecure", "allowInsecure", "allow_insecure", "skip-cert-verify"} {
+			if v := query.Get(key); v == "1" || strings.EqualFold(v, "true") {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Reach of a listen address.
+const (
+	scopeLoopback = iota
+	scopePrivate
+	scopePublic // a public address or every interface
+)
+
+// listenScope classifies a listen host (an address with or without a
+// port). Hostnames other than localhost count as public.
+func listenScope(address string) int {
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return scopeLoopback
+	}
+	addr, err := netip.ParseAddr(host)
+	switch {
+	case host == "" || err != nil || addr.IsUnspecified():
+		return scopePublic
+	case addr.IsLoopback():
+		return scopeLoopback
+	case addr.IsPrivate() || addr.IsLinkLocalUnicast():
+		return scopePrivate
+	}
+	return scopePublic
+}
+
+// openProxySeverity is an error on public addresses and a warning on
+// private ones, where only the local network can reach the listener.
+func openProxySeverity(scope int) string {
+	if scope == scopePrivate {
+		return SeverityWarn
+	}
+	return SeverityError
+}
+
+func describeListen(address string) string {
+	if address == "" {
+		return "all interfaces"
+	}
+	return address
+}
@@ -0,0 +1,74 @@
+package config
+
+import "testing"
+
+func findingFor(findings []Finding, field string) (Finding, bool) {
+	for _, f := range findings {
+		if f.Field == field {
+			return f, true
+		}
+	}
+	return Finding{}, false
+}
+
+func TestLintOpenListeners(t *testing.T) {
+	cfg := &Config{Mode: "hybrid"}
+	cfg.Listener.Address = "0.0.0.0"
+	cfg.MultiPort.Address = "192.168.1.10"
+	cfg.Management.Listen = "0.0.0.0:9091"
+	findings := cfg.Lint()
+	if f, ok := findingFor(findings, "listener"); !ok || f.Severity != SeverityError {
+		t.Fatalf("expected an error for the open pool entry, got %+v", findings)
+	}
+	if f, ok := findingFor(findings, "multi_port"); !ok || f.Severity != SeverityWarn {
+		t.Fatalf("expected a warning for ports on a private address, got %+v", findings)
+	}
+	if f, ok := findingFor(findings, "management.password"); !ok || f.Severity != SeverityError {
+		t.Fatalf("expected an error for the management API without password, got %+v", findings)
+	}
+
+	cfg.Listener.Username, cfg.Listener.Password = "alice", "secret"
+	cfg.MultiPort.Username = "bob"
+	cfg.Management.Password = "admin"
+	findings = cfg.Lint()
+	if len(findings) != 1 || findings[0].Field != "management" || findings[0].Severity != SeverityWarn {
+		t.Fatalf("expected only the missing management TLS, got %+v", findings)
+	}
+
+	cfg.Management.Listen = "127.0.0.1:9091"
+	if findings := cfg.Lint(); len(findings) != 0 {
+		t.Fatalf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestLintInsecureNodes(t *testing.T) {
+	cfg := &Config{Mode: "pool", Nodes: []NodeConfig{
+		{Name: "a", URI: "trojan://pw@a.example.com:443?allowInsecure=1"},
+		{Name: "b", URI: "trojan://pw@b.example.com:443"},
+	}}
+	cfg.Listener.Address = "127.0.0.1"
+	cfg.Management.Listen = "127.0.0.1:9091"
+	if f, ok := findingFor(cfg.Lint(), "nodes"); !ok || f.Severity != SeverityInfo {
+		t.Fatalf("expected info for one insecure node, got %+v", f)
+	}
+	cfg.Nodes[1].URI += "?insecure=true"
+	if f, ok := findingFor(cfg.Lint(), "nodes"); !ok || f.Severity != SeverityWarn {
+		t.Fatalf("expected a warning when every node is insecure, got %+v", f)
+	}
+	cfg.SkipCertVerify = true
+	if f, ok := findingFor(cfg.Lint(), "skip_cert_verify"); !ok || f.Severity != SeverityWarn {
+		t.Fatalf("expected a warning for skip_cert_verify, got %+v", f)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	if s, err := ParseSeverity(" Warning "); err != nil || s != SeverityWarn {
+		t.Fatalf("ParseSeverity = %q, %v", s, err)
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Fatal("expected an error for an unknown severity")
+	}
+	if !AtLeast(SeverityError, SeverityWarn) || AtLeast(SeverityInfo, SeverityWarn) {
+		t.Fatal("AtLeast ordering is wrong")
+	}
+}
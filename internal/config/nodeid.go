@@ -0,0 +1,97 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NodeID derives the ASCII identifier of a node from its display name. The
+// identifier is used for outbound tags, so it shows up in log lines and
+// management API paths where emoji and spaces get in the way.
+//
+// Flag emoji become their country code ("🇭🇰" -> "hk"), full-width letters
+// and digits their ASCII form, and everything else that is not a letter or
+// digit separates words. Other non-ASCII characters (CJK, accented letters)
+// are dropped, and a short hash of the name is appended so that "香港 01"
+// and "日本 01" do not both become "01". The result is empty for an empty
+// name.
+func NodeID(name string) string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	dropped := false
+	runes := []rune(strings.TrimSpace(name))
+	for i := 0; i < len(runes); i++ {
+		r := foldWidth(runes[i])
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			word.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			word.WriteRune(unicode.ToLower(r))
+		case isRegionalIndicator(r) && i+1 < len(runes) && isRegionalIndicator(runes[i+1]):
+			flush()
+			words = append(words, string([]rune{regionalLetter(r), regionalLetter(runes[i+1])}))
+			i++
+		case r <= unicode.MaxASCII || unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) ||
+			unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r):
+			// Separators, plus emoji, variation selectors and joiners that
+			// carry no identifying text of their own.
+			flush()
+		default:
+			flush()
+			dropped = true
+		}
+	}
+	flush()
+	if dropped {
+		sum := sha1.Sum([]byte(name))
+		words = append(words, hex.EncodeToString(sum[:3]))
+	}
+	return strings.Join(words, "-")
+}
+
+// assignNodeIDs sets ID on every node, adding "-2", "-3", ... in config
+// order when two names give the same identifier.
+func assignNodeIDs(nodes []NodeConfig) {
+	used := make(map[string]bool, len(nodes))
+	for i := range nodes {
+		base := NodeID(nodes[i].Name)
+		if base == "" {
+			base = fmt.Sprintf("node-%d", i+1)
+		}
+		id := base
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[id] = true
+		nodes[i].ID = id
+	}
+}
+
+// foldWidth maps full-width forms (U+FF01..U+FF5E) and the ideographic space
+// to their ASCII counterparts.
+func foldWidth(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		return r - 0xFEE0
+	case r == 0x3000:
+		return ' '
+	}
+	return r
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func regionalLetter(r rune) rune {
+	return 'a' + (r - 0x1F1E6)
+}
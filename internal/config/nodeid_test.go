@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNodeID(t *testing.T) {
+	cases := map[string]string{
+		"HK-Node 01":       "hk-node-01",
+		"🇭🇰 HK 01":         "hk-hk-01",
+		"🇯🇵Tokyo｜０２":       "jp-tokyo-02",
+		"🚀 Fast  Node":     "fast-node",
+		"US　West":          "us-west",
+		"❤️ Love":          "love",
+		"   ":              "",
+		"trojan_sg.edge-1": "trojan-sg-edge-1",
+	}
+	for name, want := range cases {
+		if got := NodeID(name); got != want {
+			t.Errorf("NodeID(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNodeIDHashesDroppedText(t *testing.T) {
+	hk, jp := NodeID("🇭🇰 香港 01"), NodeID("🇯🇵 日本 01")
+	if !strings.HasPrefix(hk, "hk-01-") || !strings.HasPrefix(jp, "jp-01-") {
+		t.Fatalf("ids = %q, %q", hk, jp)
+	}
+	a, b := NodeID("香港 01"), NodeID("日本 01")
+	if a == b || !strings.HasPrefix(a, "01-") {
+		t.Fatalf("ids = %q, %q; want distinct ids starting with 01-", a, b)
+	}
+	if NodeID("香港 01") != a {
+		t.Fatal("NodeID is not stable")
+	}
+	for _, id := range []string{hk, jp, a, b, NodeID("香港")} {
+		for _, r := range id {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				t.Fatalf("id %q has non-identifier rune %q", id, r)
+			}
+		}
+	}
+}
+
+func TestAssignNodeIDsUnique(t *testing.T) {
+	nodes := []NodeConfig{{Name: "HK 01"}, {Name: "hk-01"}, {Name: ""}, {Name: "🇭🇰 HK 01"}, {Name: "HK_01"}}
+	assignNodeIDs(nodes)
+	want := []string{"hk-01", "hk-01-2", "node-3", "hk-hk-01", "hk-01-3"}
+	for i, w := range want {
+		if nodes[i].ID != w {
+			t.Fatalf("node %d id = %q, want %q", i, nodes[i].ID, w)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of every environment override. The rest of the
+// name is the YAML path of the setting in upper case with dots replaced by
+// underscores: listener.port is EP_LISTENER_PORT.
+const EnvPrefix = "EP_"
+
+// flagOverrides holds the "path=value" pairs given with -set, applied on
+// every Load after the environment.
+var flagOverrides []string
+
+// SetFlagOverrides sets the "path=value" overrides from the command line,
+// e.g. "listener.port=8080". Paths are checked up front so a typo fails at
+// startup rather than being ignored.
+func SetFlagOverrides(sets []string) error {
+	var cfg Config
+	for _, set := range sets {
+		path, value, ok := strings.Cut(set, "=")
+		if !ok {
+			return fmt.Errorf("override %q: want path=value", set)
+		}
+		field, err := fieldByPath(reflect.ValueOf(&cfg).Elem(), strings.TrimSpace(path))
+		if err != nil {
+			return fmt.Errorf("override %q: %w", set, err)
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("override %q: %w", set, err)
+		}
+	}
+	flagOverrides = append([]string(nil), sets...)
+	return nil
+}
+
+// applyOverrides layers environment variables and then -set flags on top of
+// the values decoded from the YAML file. The overridden paths are recorded
+// so SaveSettings leaves them as they are in the file.
+func (c *Config) applyOverrides() error {
+	root := reflect.ValueOf(c).Elem()
+	apply := func(path, value, source string) error {
+		field, err := fieldByPath(root, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		if c.overridden == nil {
+			c.overridden = make(map[string]bool)
+		}
+		c.overridden[path] = true
+		log.Printf("🔧 %s overridden by %s", path, source)
+		return nil
+	}
+	for _, path := range overridePaths() {
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			if err := apply(path, value, name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, set := range flagOverrides {
+		path, value, _ := strings.Cut(set, "=")
+		if err := apply(strings.TrimSpace(path), value, "-set "+strings.TrimSpace(path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepFileValues copies the overridden settings of file into c, so saving
+// c does not write values that came from the environment or flags.
+func (c *Config) keepFileValues(overridden map[string]bool, file *Config) {
+	dst, src := reflect.ValueOf(c).Elem(), reflect.ValueOf(file).Elem()
+	for path := range overridden {
+		to, err1 := fieldByPath(dst, path)
+		from, err2 := fieldByPath(src, path)
+		if err1 == nil && err2 == nil {
+			to.Set(from)
+		}
+	}
+}
+
+// overridePaths lists the YAML paths of every setting that can be
+// overridden: scalars, durations and string lists outside the node list.
+func overridePaths() []string {
+	var paths []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, inline, ok := yamlName(field)
+			if !ok {
+				continue
+			}
+			ft := field.Type
+			if inline {
+				walk(ft, prefix)
+				continue
+			}
+			path := prefix + name
+			switch {
+			case isOverridable(ft):
+				paths = append(paths, path)
+			case ft.Kind() == reflect.Struct && ft != durationType:
+				walk(ft, path+".")
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	sort.Strings(paths)
+	return paths
+}
+
+func isOverridable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// yamlName returns the YAML key of a struct field and whether it is inlined.
+func yamlName(field reflect.StructField) (string, bool, bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if strings.Contains(opts, "inline") {
+		return "", true, true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false, true
+}
+
+// fieldByPath finds the overridable setting at a dotted YAML path in v.
+func fieldByPath(v reflect.Value, path string) (reflect.Value, error) {
+	if path == "" {
+		return reflect.Value{}, fmt.Errorf("empty path")
+	}
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		next, ok := structField(v, part)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown setting %q", strings.Join(parts[:i+1], "."))
+		}
+		v = next
+		if i < len(parts)-1 && (v.Kind() != reflect.Struct || v.Type() == durationType) {
+			return reflect.Value{}, fmt.Errorf("%q is not a section", strings.Join(parts[:i+1], "."))
+		}
+	}
+	if !isOverridable(v.Type()) {
+		return reflect.Value{}, fmt.Errorf("%q cannot be overridden", path)
+	}
+	return v, nil
+}
+
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, inline, ok := yamlName(t.Field(i))
+		if !ok {
+			continue
+		}
+		if inline {
+			if f, found := structField(v.Field(i), name); found {
+				return f, true
+			}
+			continue
+		}
+		if key == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setField parses value into an overridable field. String lists are
+// comma-separated.
+func setField(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items).Convert(field.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
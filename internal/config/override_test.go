@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeOverrideConfig(t *testing.T) string {
+	t.Helper()
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	body := `
+listener:
+  port: 2323
+  password: from-file
+pool:
+  mode: sequential
+nodes:
+  - uri: socks5://1.1.1.1:1080
+`
+	if err := os.WriteFile(cfgPath, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return cfgPath
+}
+
+func setTestFlagOverrides(t *testing.T, sets ...string) {
+	t.Helper()
+	if err := SetFlagOverrides(sets); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flagOverrides = nil })
+}
+
+func TestOverridesLayerEnvThenFlags(t *testing.T) {
+	t.Setenv("EP_LISTENER_PORT", "8080")
+	t.Setenv("EP_POOL_MODE", "balanced")
+	t.Setenv("EP_POOL_BLACKLIST_DURATION", "2h")
+	t.Setenv("EP_MANAGEMENT_ENABLED", "false")
+	t.Setenv("EP_SUBSCRIPTIONS", "")
+	t.Setenv("EP_POOL_SEED", "42")
+	setTestFlagOverrides(t, "pool.mode=weighted", "multi_port.username=alice")
+
+	cfg, err := Load(writeOverrideConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listener.Port != 8080 {
+		t.Fatalf("listener.port = %d, want 8080 from the environment", cfg.Listener.Port)
+	}
+	if cfg.Pool.Mode != "weighted" {
+		t.Fatalf("pool.mode = %q, want the flag to win over the environment", cfg.Pool.Mode)
+	}
+	if cfg.Pool.BlacklistDuration != 2*time.Hour {
+		t.Fatalf("pool.blacklist_duration = %s", cfg.Pool.BlacklistDuration)
+	}
+	if cfg.Management.Enabled == nil || *cfg.Management.Enabled {
+		t.Fatalf("management.enabled = %v, want false", cfg.Management.Enabled)
+	}
+	if cfg.MultiPort.Username != "alice" {
+		t.Fatalf("multi_port.username = %q", cfg.MultiPort.Username)
+	}
+	if cfg.Pool.Seed != 42 {
+		t.Fatalf("pool.seed = %d, want 42 from the environment", cfg.Pool.Seed)
+	}
+}
+
+func TestOverrideErrors(t *testing.T) {
+	for _, set := range []string{"listener.prot=1", "listener=1", "nodes=x", "listener.port", "listener.port=abc"} {
+		if err := SetFlagOverrides([]string{set}); err == nil {
+			t.Errorf("SetFlagOverrides(%q) succeeded", set)
+		}
+	}
+	flagOverrides = nil
+
+	t.Setenv("EP_LISTENER_PORT", "70000")
+	if _, err := Load(writeOverrideConfig(t)); err == nil || !strings.Contains(err.Error(), "EP_LISTENER_PORT") {
+		t.Fatalf("Load error = %v, want it to name EP_LISTENER_PORT", err)
+	}
+}
+
+func TestSaveSettingsKeepsOverriddenFileValues(t *testing.T) {
+	t.Setenv("EP_LISTENER_PASSWORD", "from-env")
+	cfgPath := writeOverrideConfig(t)
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listener.Password != "from-env" {
+		t.Fatalf("listener.password = %q", cfg.Listener.Password)
+	}
+	cfg.Listener.Port = 3000
+	if err := cfg.SaveSettings(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "from-env") || !strings.Contains(string(saved), "from-file") {
+		t.Fatalf("overridden value written to the file:\n%s", saved)
+	}
+	if !strings.Contains(string(saved), "port: 3000") {
+		t.Fatalf("other listener changes were not saved:\n%s", saved)
+	}
+}
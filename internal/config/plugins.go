@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"easy_proxies/internal/plugin"
+)
+
+// PluginConfig declares an exec plugin: an external program that handles
+// the node URIs of one scheme. See package plugin for the handshake.
+type PluginConfig struct {
+	Scheme  string   `yaml:"scheme" json:"scheme"`                 // 该插件处理的节点 URI 协议名，如 wg 对应 wg://
+	Command string   `yaml:"command" json:"command"`               // 插件程序路径
+	Args    []string `yaml:"args,omitempty" json:"args,omitempty"` // 命令行参数
+	Env     []string `yaml:"env,omitempty" json:"env,omitempty"`   // 额外环境变量，KEY=VALUE
+}
+
+// NodeExec is the command of an exec node, for tunnels the core has no
+// protocol for. With socks set, the command is started once and must serve
+// a SOCKS5 proxy there; otherwise it is run per connection with {host} and
+// {port} in args replaced by the destination, relaying over stdin/stdout.
+// Exec nodes can only be declared in config.yaml.
+type NodeExec struct {
+	Command string   `yaml:"command" json:"command"`                 // 命令路径
+	Args    []string `yaml:"args,omitempty" json:"args,omitempty"`   // 命令行参数，未设置 socks 时 {host}/{port} 替换为目标地址
+	Env     []string `yaml:"env,omitempty" json:"env,omitempty"`     // 额外环境变量，KEY=VALUE
+	SOCKS   string   `yaml:"socks,omitempty" json:"socks,omitempty"` // 命令提供的本地 SOCKS5 地址，如 127.0.0.1:1080
+}
+
+// ExecScheme is the scheme of the URI given to exec nodes, which have no
+// proxy URI of their own.
+const ExecScheme = "exec"
+
+// normalizeExec validates an exec node and sets its URI to exec://<name>.
+func (n *NodeConfig) normalizeExec() error {
+	if n.Exec == nil {
+		return nil
+	}
+	if n.Name == "" {
+		return fmt.Errorf("exec node %q needs a name", n.Exec.Command)
+	}
+	n.Exec.Command = strings.TrimSpace(n.Exec.Command)
+	if n.Exec.Command == "" {
+		return fmt.Errorf("exec node %q: exec.command is required", n.Name)
+	}
+	if n.URI != "" && !strings.HasPrefix(n.URI, ExecScheme+"://") {
+		return fmt.Errorf("exec node %q: uri and exec are mutually exclusive", n.Name)
+	}
+	if len(n.Via) > 0 || n.ExpandedFrom != "" {
+		return fmt.Errorf("exec node %q cannot use via or expand", n.Name)
+	}
+	if n.Exec.SOCKS = strings.TrimSpace(n.Exec.SOCKS); n.Exec.SOCKS != "" {
+		if _, _, err := net.SplitHostPort(n.Exec.SOCKS); err != nil {
+			return fmt.Errorf("exec node %q: invalid exec.socks %q", n.Name, n.Exec.SOCKS)
+		}
+	}
+	for _, kv := range n.Exec.Env {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("exec node %q: exec.env %q must be KEY=VALUE", n.Name, kv)
+		}
+	}
+	n.URI = ExecScheme + "://" + url.PathEscape(n.Name)
+	return nil
+}
+
+// builtinSchemes are the node URI schemes handled by the core, which a
+// plugin cannot take over.
+var builtinSchemes = []string{"vmess", "vless", "trojan", "ss", "shadowsocks", "ssr", "shadowsocksr", "hysteria", "hysteria2", "hy2", "tuic", "socks5", "socks5h", "socks", "http", "https", "anytls", ExecScheme}
+
+var pluginScheme = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// normalizePlugins validates plugins and registers them with the plugin
+// package. It runs before nodes are loaded so nodes files and subscriptions
+// recognize plugin URIs. Plugin processes are started on first use.
+func (c *Config) normalizePlugins() error {
+	seen := make(map[string]bool, len(c.Plugins))
+	specs := make([]plugin.ExecSpec, 0, len(c.Plugins))
+	for i := range c.Plugins {
+		p := &c.Plugins[i]
+		p.Scheme = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(p.Scheme), "://"))
+		if !pluginScheme.MatchString(p.Scheme) {
+			return fmt.Errorf("plugins[%d].scheme %q is not a valid URI scheme", i, p.Scheme)
+		}
+		for _, builtin := range builtinSchemes {
+			if p.Scheme == builtin {
+				return fmt.Errorf("plugins[%d].scheme %q is a built-in protocol", i, p.Scheme)
+			}
+		}
+		if seen[p.Scheme] {
+			return fmt.Errorf("plugins[%d].scheme %q is declared twice", i, p.Scheme)
+		}
+		seen[p.Scheme] = true
+		if p.Command == "" {
+			return fmt.Errorf("plugins[%d].command is required", i)
+		}
+		if _, err := exec.LookPath(p.Command); err != nil {
+			c.warnf(fmt.Sprintf("plugins[%d].command", i), "%q not found; nodes of %s:// fail until it is installed", p.Command, p.Scheme)
+		}
+		for _, kv := range p.Env {
+			if !strings.Contains(kv, "=") {
+				return fmt.Errorf("plugins[%d].env %q must be KEY=VALUE", i, kv)
+			}
+		}
+		specs = append(specs, plugin.ExecSpec{Scheme: p.Scheme, Command: p.Command, Args: p.Args, Env: p.Env})
+	}
+	plugin.ConfigureExec(specs)
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/plugin"
+)
+
+func TestNormalizePlugins(t *testing.T) {
+	t.Cleanup(func() { plugin.ConfigureExec(nil) })
+	cfg := &Config{Plugins: []PluginConfig{{Scheme: "WG://", Command: os.Args[0], Env: []string{"LOG=debug"}}}}
+	if err := cfg.normalizePlugins(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Plugins[0].Scheme != "wg" || !plugin.Has("wg") {
+		t.Fatalf("plugin not registered: %+v", cfg.Plugins)
+	}
+	if !IsProxyURI("wg://peer.example.com:51820") {
+		t.Fatal("plugin URIs should be recognized in nodes files")
+	}
+
+	for _, bad := range []PluginConfig{
+		{Scheme: "vless", Command: "x"},
+		{Scheme: "1x", Command: "x"},
+		{Scheme: "wg"},
+		{Scheme: "wg", Command: "x", Env: []string{"NOEQUALS"}},
+	} {
+		cfg := &Config{Plugins: []PluginConfig{bad}}
+		if err := cfg.normalizePlugins(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+	cfg = &Config{Plugins: []PluginConfig{{Scheme: "wg", Command: "x"}, {Scheme: "wg", Command: "y"}}}
+	if err := cfg.normalizePlugins(); err == nil || !strings.Contains(err.Error(), "twice") {
+		t.Fatalf("expected a duplicate error, got %v", err)
+	}
+
+	cfg = &Config{Plugins: []PluginConfig{{Scheme: "wg", Command: "/nonexistent/wg-plugin"}}}
+	if err := cfg.normalizePlugins(); err != nil || len(cfg.Warnings()) != 1 {
+		t.Fatalf("expected a warning for a missing command: %v, %v", err, cfg.Warnings())
+	}
+}
+
+func TestNormalizeExecNode(t *testing.T) {
+	node := NodeConfig{Name: "office tunnel", Exec: &NodeExec{Command: " cloudflared ", Args: []string{"access", "tcp"}, SOCKS: "127.0.0.1:1080"}}
+	if err := node.normalizeExec(); err != nil {
+		t.Fatal(err)
+	}
+	if node.URI != "exec://office%20tunnel" || node.Exec.Command != "cloudflared" {
+		t.Fatalf("unexpected node %+v", node)
+	}
+	// Reloading a saved or edited node keeps working.
+	if err := node.normalizeExec(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []NodeConfig{
+		{Exec: &NodeExec{Command: "ssh"}},
+		{Name: "n", Exec: &NodeExec{}},
+		{Name: "n", URI: "socks5://127.0.0.1:1080", Exec: &NodeExec{Command: "ssh"}},
+		{Name: "n", Via: ViaChain{"relay"}, Exec: &NodeExec{Command: "ssh"}},
+		{Name: "n", Exec: &NodeExec{Command: "ssh", SOCKS: "1080"}},
+		{Name: "n", Exec: &NodeExec{Command: "ssh", Env: []string{"NOEQUALS"}}},
+	} {
+		if err := bad.normalizeExec(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
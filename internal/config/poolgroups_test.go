@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizePoolGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		groups  map[string]GroupPoolConfig
+		wantErr string
+	}{
+		{name: "valid", groups: map[string]GroupPoolConfig{" Residential ": {Mode: "Latency", FailureThreshold: 1, BlacklistDuration: 5 * time.Minute}}},
+		{name: "inherit everything", groups: map[string]GroupPoolConfig{"residential": {}}},
+		{name: "bad mode", groups: map[string]GroupPoolConfig{"residential": {Mode: "fastest"}}, wantErr: "unsupported mode"},
+		{name: "negative threshold", groups: map[string]GroupPoolConfig{"residential": {FailureThreshold: -1}}, wantErr: "failure_threshold"},
+		{name: "empty name", groups: map[string]GroupPoolConfig{" ": {}}, wantErr: "group name is required"},
+		{name: "duplicate", groups: map[string]GroupPoolConfig{"dc": {}, "DC": {}}, wantErr: "configured twice"},
+		{name: "slo", groups: map[string]GroupPoolConfig{"residential": {SLO: &SLOConfig{Connect: 800 * time.Millisecond}}}},
+		{name: "slo without target", groups: map[string]GroupPoolConfig{"residential": {SLO: &SLOConfig{Percentile: 95}}}, wantErr: "slo.connect is required"},
+		{name: "slo bad percentile", groups: map[string]GroupPoolConfig{"residential": {SLO: &SLOConfig{Connect: time.Second, Percentile: 101}}}, wantErr: "percentile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "Residential"}}}
+			cfg.Pool.Groups = tt.groups
+			err := cfg.normalizePoolGroups()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNormalizePoolGroupsWarnsAboutEmptyGroup(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "dc"}}}
+	cfg.Pool.Groups = map[string]GroupPoolConfig{"dc": {}, "residential": {}}
+	if err := cfg.normalizePoolGroups(); err != nil {
+		t.Fatal(err)
+	}
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 || warnings[0].Field != "pool.groups.residential" {
+		t.Fatalf("expected one warning for pool.groups.residential, got %+v", warnings)
+	}
+}
+
+func TestPoolFor(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "residential"}}}
+	cfg.Pool.Mode = "sequential"
+	cfg.Pool.FailureThreshold = 3
+	cfg.Pool.BlacklistDuration = 24 * time.Hour
+	cfg.Pool.Groups = map[string]GroupPoolConfig{"Residential": {Mode: "latency", BlacklistDuration: 5 * time.Minute}}
+	if err := cfg.normalizePoolGroups(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := cfg.PoolFor(" RESIDENTIAL ")
+	if got.Mode != "latency" || got.FailureThreshold != 3 || got.BlacklistDuration != 5*time.Minute {
+		t.Fatalf("residential: got mode=%s threshold=%d blacklist=%s", got.Mode, got.FailureThreshold, got.BlacklistDuration)
+	}
+	got = cfg.PoolFor("dc")
+	if got.Mode != "sequential" || got.FailureThreshold != 3 || got.BlacklistDuration != 24*time.Hour {
+		t.Fatalf("dc: got mode=%s threshold=%d blacklist=%s", got.Mode, got.FailureThreshold, got.BlacklistDuration)
+	}
+	if got := cfg.PoolFor(""); got.Mode != "sequential" {
+		t.Fatalf("no group: got mode %s", got.Mode)
+	}
+}
+
+func TestNormalizePoolGroupsSLODefaults(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "residential"}}}
+	cfg.Pool.Groups = map[string]GroupPoolConfig{"residential": {SLO: &SLOConfig{Connect: 800 * time.Millisecond, Window: time.Minute}}}
+	if err := cfg.normalizePoolGroups(); err != nil {
+		t.Fatal(err)
+	}
+	slo := cfg.Pool.Groups["residential"].SLO
+	if slo.Percentile != 95 || slo.MinSamples != 20 || slo.Cooldown != time.Minute {
+		t.Fatalf("unexpected defaults: %+v", *slo)
+	}
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 || warnings[0].Field != "pool.groups.residential.slo" {
+		t.Fatalf("expected a warning about the missing standby node, got %+v", warnings)
+	}
+}
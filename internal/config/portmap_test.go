@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad_PortMapFileSetting(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, cfgPath, `mode: multi-port
+multi_port:
+  address: 127.0.0.1
+  base_port: 24000
+  port_map_file: ports.json
+management:
+  enabled: false
+nodes:
+  - uri: "vless://uuid-a@a.example.com:443?type=ws&security=tls#NodeA"
+`)
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got, want := cfg.PortMapPath(), filepath.Join(dir, "ports.json"); got != want {
+		t.Fatalf("PortMapPath = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ports.json")); err != nil {
+		t.Fatalf("expected ports.json to be written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nodePortMapFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s, got err=%v", nodePortMapFile, err)
+	}
+}
+
+// A node added while another is removed takes over the freed port even though
+// the instance being replaced still holds it.
+func TestNormalizeWithPortMap_ReusesFreedPort(t *testing.T) {
+	const (
+		uriA = "vless://uuid-a@a.example.com:443?type=ws&security=tls#NodeA"
+		uriB = "vless://uuid-b@b.example.com:443?type=ws&security=tls#NodeB"
+		uriC = "vless://uuid-c@c.example.com:443?type=ws&security=tls#NodeC"
+		uriD = "vless://uuid-d@d.example.com:443?type=ws&security=tls#NodeD"
+	)
+	newCfg := func(uris ...string) *Config {
+		cfg := &Config{Mode: "multi-port"}
+		cfg.MultiPort.Address = "127.0.0.1"
+		cfg.MultiPort.BasePort = 24000
+		for _, uri := range uris {
+			cfg.Nodes = append(cfg.Nodes, NodeConfig{URI: uri})
+		}
+		return cfg
+	}
+
+	first := newCfg(uriA, uriB, uriC)
+	if err := first.NormalizeWithPortMap(nil); err != nil {
+		t.Fatal(err)
+	}
+	portMap := first.BuildPortMap()
+	freedPort := portMap[first.Nodes[1].NodeKey()]
+
+	// The running instance still listens on B's port.
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", freedPort))
+	if err != nil {
+		t.Skipf("cannot bind port %d: %v", freedPort, err)
+	}
+	defer ln.Close()
+
+	second := newCfg(uriC, uriD, uriA)
+	if err := second.NormalizeWithPortMap(portMap); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range second.Nodes {
+		want := portMap[node.NodeKey()]
+		if node.URI == uriD {
+			want = freedPort
+		}
+		if node.Port != want {
+			t.Errorf("node %q: port %d, want %d", node.Name, node.Port, want)
+		}
+	}
+}
+
+func TestPortAssignments(t *testing.T) {
+	cfg := &Config{Mode: "hybrid"}
+	cfg.MultiPort.GroupBy = MultiPortByNode
+	cfg.Nodes = []NodeConfig{
+		{Name: "b", ID: "b", Port: 24001, Group: "us"},
+		{Name: "a", ID: "a", Port: 24000, Disabled: true},
+	}
+	got := cfg.PortAssignments()
+	if len(got) != 2 || got[0].Name != "a" || got[1].Name != "b" {
+		t.Fatalf("expected a, b ordered by port, got %+v", got)
+	}
+	if !got[0].Disabled || got[1].Group != "us" {
+		t.Fatalf("unexpected entries %+v", got)
+	}
+
+	cfg.MultiPort.GroupBy = MultiPortByCountry
+	if got := cfg.PortAssignments(); got != nil {
+		t.Fatalf("expected no per-node ports with group_by country, got %+v", got)
+	}
+	cfg.Mode = "pool"
+	cfg.MultiPort.GroupBy = MultiPortByNode
+	if got := cfg.PortAssignments(); got != nil {
+		t.Fatalf("expected no per-node ports in pool mode, got %+v", got)
+	}
+}
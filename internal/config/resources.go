@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Resource profiles selectable via resource_profile.
+const (
+	ResourceProfileLow     = "low"
+	ResourceProfileDefault = "default"
+	ResourceProfileHigh    = "high"
+)
+
+// ResourceLimits are the runtime tunables derived from resource_profile.
+// Zero values mean "leave the Go / library default alone".
+type ResourceLimits struct {
+	GOMAXPROCS          int // runtime.GOMAXPROCS
+	GCPercent           int // debug.SetGCPercent
+	ProbeConcurrency    int // default probe workers when management.probe_concurrency is unset
+	BuildWorkers        int // workers parsing node URIs at startup/reload
+	GeoIPWorkers        int // workers resolving node regions
+	CopyBufferSize      int // per-direction relay buffer of the GeoIP router
+	MaxIdleConns        int // GeoIP router upstream keep-alive pool
+	MaxIdleConnsPerHost int
+	// Caps used when pool.max_conns_per_node and listener.max_conns_per_ip
+	// are unset: tunnels through one node in every pool, and connections
+	// of one client IP on the pool and sticky entries.
+	MaxConnsPerNode int
+	MaxConnsPerIP   int
+}
+
+// ResourceLimitsFor returns the limits of a profile. Unknown profiles get
+// the default limits.
+func ResourceLimitsFor(profile string) ResourceLimits {
+	switch profile {
+	case ResourceProfileLow:
+		// Routers and SBCs: a couple of cores and a few hundred MB of RAM.
+		return ResourceLimits{
+			GOMAXPROCS:          2,
+			GCPercent:           50,
+			ProbeConcurrency:    8,
+			BuildWorkers:        2,
+			GeoIPWorkers:        4,
+			CopyBufferSize:      8 * 1024,
+			MaxIdleConns:        16,
+			MaxIdleConnsPerHost: 2,
+			MaxConnsPerNode:     64,
+			MaxConnsPerIP:       128,
+		}
+	case ResourceProfileHigh:
+		return ResourceLimits{
+			ProbeConcurrency:    128,
+			BuildWorkers:        2 * runtime.NumCPU(),
+			GeoIPWorkers:        64,
+			CopyBufferSize:      64 * 1024,
+			MaxIdleConns:        512,
+			MaxIdleConnsPerHost: 64,
+		}
+	default:
+		return ResourceLimits{
+			ProbeConcurrency:    32,
+			BuildWorkers:        runtime.NumCPU(),
+			GeoIPWorkers:        32,
+			CopyBufferSize:      32 * 1024,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+		}
+	}
+}
+
+// Resources returns the limits for the configured profile, with an explicit
+// gomaxprocs taking precedence over the profile's value.
+func (c *Config) Resources() ResourceLimits {
+	limits := ResourceLimitsFor(c.ResourceProfile)
+	if c.GOMAXPROCS > 0 {
+		limits.GOMAXPROCS = c.GOMAXPROCS
+	}
+	return limits
+}
+
+// MaxConnsPerNode returns pool.max_conns_per_node, or the resource
+// profile's cap when it is unset.
+func (c *Config) MaxConnsPerNode() int {
+	if c.Pool.MaxConnsPerNode > 0 {
+		return c.Pool.MaxConnsPerNode
+	}
+	return c.Resources().MaxConnsPerNode
+}
+
+// MaxConnsPerIP returns listener.max_conns_per_ip, or the resource
+// profile's cap when it is unset.
+func (c *Config) MaxConnsPerIP() int {
+	if c.Listener.MaxConnsPerIP > 0 {
+		return c.Listener.MaxConnsPerIP
+	}
+	return c.Resources().MaxConnsPerIP
+}
+
+// normalizeResources applies defaults and validation for resource_profile
+// and gomaxprocs.
+func (c *Config) normalizeResources() error {
+	c.ResourceProfile = strings.ToLower(strings.TrimSpace(c.ResourceProfile))
+	switch c.ResourceProfile {
+	case "":
+		c.ResourceProfile = ResourceProfileDefault
+	case ResourceProfileLow, ResourceProfileDefault, ResourceProfileHigh:
+	default:
+		return fmt.Errorf("unsupported resource_profile %q (use 'low', 'default' or 'high')", c.ResourceProfile)
+	}
+	if c.GOMAXPROCS < 0 {
+		return fmt.Errorf("gomaxprocs must be >= 0, got %d", c.GOMAXPROCS)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import "testing"
+
+func TestNormalizeResources(t *testing.T) {
+	cfg := &Config{ResourceProfile: " LOW "}
+	if err := cfg.normalizeResources(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ResourceProfile != ResourceProfileLow {
+		t.Fatalf("expected profile %q, got %q", ResourceProfileLow, cfg.ResourceProfile)
+	}
+
+	cfg = &Config{}
+	if err := cfg.normalizeResources(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ResourceProfile != ResourceProfileDefault {
+		t.Fatalf("expected profile %q, got %q", ResourceProfileDefault, cfg.ResourceProfile)
+	}
+
+	for _, bad := range []*Config{{ResourceProfile: "huge"}, {GOMAXPROCS: -1}} {
+		if err := bad.normalizeResources(); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestResourcesProfileDefaults(t *testing.T) {
+	low := (&Config{ResourceProfile: ResourceProfileLow}).Resources()
+	def := (&Config{ResourceProfile: ResourceProfileDefault}).Resources()
+	high := (&Config{ResourceProfile: ResourceProfileHigh}).Resources()
+	if !(low.ProbeConcurrency < def.ProbeConcurrency && def.ProbeConcurrency < high.ProbeConcurrency) {
+		t.Fatalf("probe concurrency should grow with the profile: %d/%d/%d", low.ProbeConcurrency, def.ProbeConcurrency, high.ProbeConcurrency)
+	}
+	if !(low.CopyBufferSize < def.CopyBufferSize && def.CopyBufferSize < high.CopyBufferSize) {
+		t.Fatalf("buffer size should grow with the profile: %d/%d/%d", low.CopyBufferSize, def.CopyBufferSize, high.CopyBufferSize)
+	}
+	if def.GOMAXPROCS != 0 {
+		t.Fatalf("default profile should keep Go's GOMAXPROCS, got %d", def.GOMAXPROCS)
+	}
+
+	cfg := &Config{ResourceProfile: ResourceProfileLow, GOMAXPROCS: 4}
+	if got := cfg.Resources().GOMAXPROCS; got != 4 {
+		t.Fatalf("explicit gomaxprocs should win, got %d", got)
+	}
+	if got := cfg.ProbeConcurrencyOrDefault(); got != low.ProbeConcurrency {
+		t.Fatalf("expected profile probe concurrency %d, got %d", low.ProbeConcurrency, got)
+	}
+	cfg.Management.ProbeConcurrency = 50
+	if got := cfg.ProbeConcurrencyOrDefault(); got != 50 {
+		t.Fatalf("explicit probe_concurrency should win, got %d", got)
+	}
+}
+
+func TestResourcesConnectionCaps(t *testing.T) {
+	low := &Config{ResourceProfile: ResourceProfileLow}
+	if low.MaxConnsPerNode() <= 0 || low.MaxConnsPerIP() <= 0 {
+		t.Fatalf("low profile should cap the entries, got %d per node, %d per IP", low.MaxConnsPerNode(), low.MaxConnsPerIP())
+	}
+	low.Pool.MaxConnsPerNode, low.Listener.MaxConnsPerIP = 500, 1000
+	if low.MaxConnsPerNode() != 500 || low.MaxConnsPerIP() != 1000 {
+		t.Fatalf("explicit caps should win, got %d per node, %d per IP", low.MaxConnsPerNode(), low.MaxConnsPerIP())
+	}
+	def := &Config{ResourceProfile: ResourceProfileDefault}
+	if def.MaxConnsPerNode() != 0 || def.MaxConnsPerIP() != 0 {
+		t.Fatalf("default profile should leave the entries unlimited, got %d per node, %d per IP", def.MaxConnsPerNode(), def.MaxConnsPerIP())
+	}
+}
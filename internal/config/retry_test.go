@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestNormalizeMaxRetries(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+
+	cfg := &Config{Pool: PoolConfig{MaxRetries: intPtr(4)}}
+	if err := cfg.normalizeMaxRetries(); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Pool.RetryEnabledOrDefault() || cfg.Pool.RetryAttempts != 5 {
+		t.Fatalf("max_retries 4: got enabled=%v attempts=%d", cfg.Pool.RetryEnabledOrDefault(), cfg.Pool.RetryAttempts)
+	}
+
+	cfg = &Config{Pool: PoolConfig{MaxRetries: intPtr(0), RetryAttempts: 3}}
+	if err := cfg.normalizeMaxRetries(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Pool.RetryEnabledOrDefault() || cfg.Pool.RetryAttempts != 1 {
+		t.Fatalf("max_retries 0: got enabled=%v attempts=%d", cfg.Pool.RetryEnabledOrDefault(), cfg.Pool.RetryAttempts)
+	}
+
+	cfg = &Config{Pool: PoolConfig{RetryAttempts: 7}}
+	if err := cfg.normalizeMaxRetries(); err != nil || cfg.Pool.RetryAttempts != 7 {
+		t.Fatalf("unset max_retries must keep retry_attempts (err=%v, attempts=%d)", err, cfg.Pool.RetryAttempts)
+	}
+
+	cfg = &Config{Pool: PoolConfig{MaxRetries: intPtr(-1)}}
+	if err := cfg.normalizeMaxRetries(); err == nil {
+		t.Fatal("expected error for negative max_retries")
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []RuleConfig
+		geoipDB string
+		wantErr string
+	}{
+		{name: "valid", rules: []RuleConfig{{DomainSuffix: []string{"example.com"}, Group: " US "}, {IPCIDR: []string{"10.0.0.0/8", "1.1.1.1"}, Group: "direct"}}},
+		{name: "missing group", rules: []RuleConfig{{DomainSuffix: []string{"example.com"}}}, wantErr: "group is required"},
+		{name: "no matcher", rules: []RuleConfig{{Group: "us"}}, wantErr: "at least one of"},
+		{name: "bad cidr", rules: []RuleConfig{{IPCIDR: []string{"10.0.0.0/33"}, Group: "us"}}, wantErr: "invalid ip_cidr"},
+		{name: "geoip without database", rules: []RuleConfig{{GeoIP: []string{"CN"}, Group: "direct"}}, wantErr: "geoip.database_path"},
+		{name: "geoip with database", rules: []RuleConfig{{GeoIP: []string{"CN"}, Group: "direct"}}, geoipDB: "GeoLite2-Country.mmdb"},
+		{name: "method only", rules: []RuleConfig{{Method: []string{"post"}, Group: "us"}}},
+		{name: "bad method", rules: []RuleConfig{{Method: []string{"GET /"}, Group: "us"}}, wantErr: "invalid method"},
+		{name: "connect method", rules: []RuleConfig{{Method: []string{"CONNECT"}, Group: "us"}}, wantErr: "CONNECT"},
+		{name: "method with ip_cidr", rules: []RuleConfig{{Method: []string{"POST"}, IPCIDR: []string{"10.0.0.0/8"}, Group: "us"}}, wantErr: "cannot be combined"},
+		{name: "sticky without sticky pool", rules: []RuleConfig{{Method: []string{"POST"}, Group: "sticky"}}, wantErr: "sticky.enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Rules: tt.rules}
+			cfg.GeoIP.DatabasePath = tt.geoipDB
+			err := cfg.normalizeRules()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cfg := &Config{Rules: []RuleConfig{{DomainSuffix: []string{"example.com"}, Group: " US "}}}
+	if err := cfg.normalizeRules(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Rules[0].Group != "us" {
+		t.Fatalf("expected group to be normalized to %q, got %q", "us", cfg.Rules[0].Group)
+	}
+
+	cfg = &Config{Rules: []RuleConfig{
+		{DomainSuffix: []string{"example.com"}, Group: "us"},
+		{Method: []string{"post", "Put"}, DomainSuffix: []string{"api.example.com"}, Group: "sticky"},
+	}}
+	cfg.Mode = "pool"
+	cfg.Sticky.Enabled = true
+	if err := cfg.normalizeRules(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Rules[1].Method; got[0] != "POST" || got[1] != "PUT" {
+		t.Fatalf("expected methods to be upper-cased, got %v", got)
+	}
+	if rules := cfg.HTTPRules(); len(rules) != 1 || rules[0].Group != "sticky" {
+		t.Fatalf("expected the method rule only, got %+v", rules)
+	}
+	if !cfg.EntryFront() {
+		t.Fatal("method rules must enable the entry front")
+	}
+}
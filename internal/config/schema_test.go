@@ -0,0 +1,39 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSchemaDescribesConfig(t *testing.T) {
+	schema := JSONSchema()
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("schema is not JSON encodable: %v", err)
+	}
+	props := schema["properties"].(map[string]any)
+	if _, ok := props["filePath"]; ok {
+		t.Fatal("unexported fields must not appear in the schema")
+	}
+
+	listener := props["listener"].(map[string]any)["properties"].(map[string]any)
+	if got := listener["port"].(map[string]any)["maximum"]; got != 65535 {
+		t.Fatalf("listener.port maximum = %v, want 65535", got)
+	}
+	pool := props["pool"].(map[string]any)["properties"].(map[string]any)
+	if got := pool["blacklist_duration"].(map[string]any)["type"]; got != "string" {
+		t.Fatalf("pool.blacklist_duration type = %v, want string", got)
+	}
+
+	nodes := props["nodes"].(map[string]any)
+	if nodes["type"] != "array" {
+		t.Fatalf("nodes type = %v, want array", nodes["type"])
+	}
+	node := nodes["items"].(map[string]any)["properties"].(map[string]any)
+	if _, ok := node["uri"]; !ok {
+		t.Fatal("nodes[].uri missing from schema")
+	}
+	// via accepts a string or a list, so the schema leaves it open.
+	if via := node["via"].(map[string]any); len(via) != 0 {
+		t.Fatalf("nodes[].via = %v, want an unconstrained schema", via)
+	}
+}
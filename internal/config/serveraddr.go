@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"easy_proxies/internal/ssuri"
+)
+
+// defaultPorts are used when a URI of the scheme names no port.
+var defaultPorts = map[string]int{
+	"http":   80,
+	"https":  443,
+	"socks":  1080,
+	"socks5": 1080,
+	"trojan": 443,
+}
+
+// ServerAddress returns the "host:port" of the upstream server a node URI
+// points at. It does not resolve the host.
+func ServerAddress(uri string) (string, error) {
+	uri = strings.TrimSpace(uri)
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "", fmt.Errorf("missing scheme")
+	}
+	scheme = strings.ToLower(scheme)
+	switch scheme {
+	case "vmess":
+		if host, port, ok := vmessServer(rest); ok {
+			return net.JoinHostPort(host, strconv.Itoa(port)), nil
+		}
+	case "ss", "shadowsocks":
+		parsed, err := ssuri.Parse(uri)
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(parsed.Server, strconv.Itoa(parsed.Port)), nil
+	case "ssr":
+		return ssrServer(rest)
+	}
+
+	host, port, err := hostPort(uri)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return "", fmt.Errorf("missing host")
+	}
+	if port == "" {
+		p, ok := defaultPorts[scheme]
+		if !ok {
+			return "", fmt.Errorf("missing port")
+		}
+		port = strconv.Itoa(p)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// hostPort splits the authority of a URL-style URI. Hysteria2 port hopping
+// ("host:443,8443-8450") is not a valid URL port, so on a parse failure the
+// authority is split by hand and the first port is reported.
+func hostPort(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err == nil {
+		return u.Hostname(), u.Port(), nil
+	}
+	_, rest, _ := strings.Cut(uri, "://")
+	if idx := strings.IndexAny(rest, "/?#"); idx != -1 {
+		rest = rest[:idx]
+	}
+	if idx := strings.LastIndex(rest, "@"); idx != -1 {
+		rest = rest[idx+1:]
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx == -1 || strings.HasSuffix(rest, "]") {
+		return "", "", err
+	}
+	ports := rest[idx+1:]
+	first := strings.FieldsFunc(ports, func(r rune) bool { return r == ',' || r == '-' })
+	if len(first) == 0 {
+		return "", "", err
+	}
+	if _, convErr := strconv.Atoi(first[0]); convErr != nil {
+		return "", "", err
+	}
+	return strings.Trim(rest[:idx], "[]"), first[0], nil
+}
+
+// vmessServer reads "add" and "port" from a base64 JSON vmess payload.
+func vmessServer(payload string) (string, int, bool) {
+	if idx := strings.Index(payload, "#"); idx != -1 {
+		payload = payload[:idx]
+	}
+	decoded, ok := decodeBase64Any(strings.TrimSpace(payload))
+	if !ok {
+		return "", 0, false
+	}
+	var obj struct {
+		Add  string          `json:"add"`
+		Port json.RawMessage `json:"port"`
+	}
+	if json.Unmarshal(decoded, &obj) != nil || obj.Add == "" {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(strings.Trim(string(obj.Port), `"`))
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, false
+	}
+	return obj.Add, port, true
+}
+
+// ssrServer decodes ssr://base64(host:port:protocol:method:obfs:password/?params).
+func ssrServer(payload string) (string, error) {
+	decoded, ok := decodeBase64Any(strings.TrimSpace(payload))
+	if !ok {
+		return "", fmt.Errorf("invalid ssr payload")
+	}
+	body, _, _ := strings.Cut(string(decoded), "/?")
+	parts := strings.Split(body, ":")
+	if len(parts) < 6 {
+		return "", fmt.Errorf("invalid ssr payload")
+	}
+	// The host may be an IPv6 address containing colons.
+	host := strings.Join(parts[:len(parts)-5], ":")
+	port, err := strconv.Atoi(parts[len(parts)-5])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid ssr port %q", parts[len(parts)-5])
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func decodeBase64Any(s string) ([]byte, bool) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := enc.DecodeString(s); err == nil {
+			return decoded, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestServerAddress(t *testing.T) {
+	vmess := "vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"add":"v.example.com","port":"8443","id":"x","ps":"n"}`))
+	ssr := "ssr://" + base64.RawURLEncoding.EncodeToString([]byte("r.example.com:9000:origin:aes-256-cfb:plain:cGFzcw/?remarks=eA"))
+	ss := "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:pass")) + "@s.example.com:8388#name"
+	cases := map[string]string{
+		"socks5://u:p@1.2.3.4:1080":                      "1.2.3.4:1080",
+		"http://proxy.example.com":                       "proxy.example.com:80",
+		"trojan://pw@t.example.com?sni=x#n":              "t.example.com:443",
+		"vless://id@[2001:db8::1]:443?type=tcp":          "[2001:db8::1]:443",
+		"hysteria2://pw@h.example.com:443,8443-8450/?x=": "h.example.com:443",
+		vmess: "v.example.com:8443",
+		ssr:   "r.example.com:9000",
+		ss:    "s.example.com:8388",
+	}
+	for uri, want := range cases {
+		got, err := ServerAddress(uri)
+		if err != nil || got != want {
+			t.Errorf("ServerAddress(%q) = %q, %v; want %q", uri, got, err, want)
+		}
+	}
+	for _, uri := range []string{"no-scheme", "vless://id@host", "socks5://:1080"} {
+		if got, err := ServerAddress(uri); err == nil {
+			t.Errorf("ServerAddress(%q) = %q, want error", uri, got)
+		}
+	}
+}
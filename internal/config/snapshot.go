@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+)
+
+// nodeSnapshotFile is the default copy of the last node list loaded from
+// nodes_file or the subscriptions.
+const nodeSnapshotFile = "nodes_snapshot.txt"
+
+// NodeSnapshotPath returns where the last good node list is kept:
+// node_snapshot_file, by default nodes_snapshot.txt next to the main config
+// file. It is empty when the path is relative and the config path is
+// unknown.
+func (c *Config) NodeSnapshotPath() string {
+	file := c.NodeSnapshotFile
+	if file == "" {
+		file = nodeSnapshotFile
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	if c.filePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.filePath), file)
+}
+
+// SaveNodeSnapshot records nodes as the last good list. It is best effort:
+// a failed write is logged and the previous snapshot stays in place.
+func (c *Config) SaveNodeSnapshot(nodes []NodeConfig) {
+	path := c.NodeSnapshotPath()
+	if path == "" || len(nodes) == 0 {
+		return
+	}
+	if err := writeNodesToFile(path, nodes); err != nil {
+		log.Printf("⚠️ Failed to write node snapshot %q: %v", path, err)
+	}
+}
+
+// loadNodeSnapshot reads the last good node list, marking every node with
+// source. It fails when there is no snapshot or it holds no nodes.
+func (c *Config) loadNodeSnapshot(source NodeSource) ([]NodeConfig, string, error) {
+	path := c.NodeSnapshotPath()
+	if path == "" {
+		return nil, "", errNoSnapshot
+	}
+	nodes, err := loadNodesFromFile(path)
+	if err != nil {
+		return nil, path, err
+	}
+	if len(nodes) == 0 {
+		return nil, path, errNoSnapshot
+	}
+	for idx := range nodes {
+		nodes[idx].Source = source
+	}
+	return nodes, path, nil
+}
+
+var errNoSnapshot = errors.New("no node snapshot")
+
+// Degraded returns why the config runs on the node snapshot instead of its
+// real node source, or "" when the nodes are current.
+func (c *Config) Degraded() string {
+	return c.degraded
+}
+
+// ClearDegraded marks the nodes as current again, after the node source
+// has been read successfully.
+func (c *Config) ClearDegraded() {
+	c.degraded = ""
+}
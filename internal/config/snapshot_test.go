@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFallsBackToNodeSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	nodesPath := filepath.Join(dir, "nodes.txt")
+
+	writeFile(t, cfgPath, `mode: multi-port
+multi_port:
+  address: 127.0.0.1
+  base_port: 25000
+nodes_file: nodes.txt
+management:
+  enabled: false
+`)
+	const (
+		uriA = "vless://uuid-a@a.example.com:443?type=ws&security=tls#NodeA"
+		uriB = "vless://uuid-b@b.example.com:443?type=ws&security=tls#NodeB"
+	)
+	writeFile(t, nodesPath, uriA+"\n"+uriB+"\n")
+
+	cfg, err := Load(cfgPath, WithNodeSnapshot())
+	if err != nil {
+		t.Fatalf("first load: %v", err)
+	}
+	if reason := cfg.Degraded(); reason != "" {
+		t.Fatalf("first load is degraded: %s", reason)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nodeSnapshotFile)); err != nil {
+		t.Fatalf("expected %s to be written: %v", nodeSnapshotFile, err)
+	}
+
+	// nodes_file goes away, as on an NFS hiccup.
+	if err := os.Remove(nodesPath); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(cfgPath, WithNodeSnapshot())
+	if err != nil {
+		t.Fatalf("load without nodes_file: %v", err)
+	}
+	if len(cfg.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes from the snapshot, got %d", len(cfg.Nodes))
+	}
+	for _, node := range cfg.Nodes {
+		if node.Source != NodeSourceFile {
+			t.Errorf("node %q source = %q, want %q", node.Name, node.Source, NodeSourceFile)
+		}
+	}
+	if !strings.Contains(cfg.Degraded(), "nodes_file") {
+		t.Errorf("Degraded() = %q, want a nodes_file reason", cfg.Degraded())
+	}
+	found := false
+	for _, w := range cfg.Warnings() {
+		if w.Field == "nodes_file" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a nodes_file warning, got %v", cfg.Warnings())
+	}
+
+	// Without a snapshot the missing file is still fatal.
+	if err := os.Remove(filepath.Join(dir, nodeSnapshotFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfgPath, WithNodeSnapshot()); err == nil {
+		t.Fatal("expected an error without nodes_file and snapshot")
+	}
+}
+
+func TestLoadWithoutSnapshotOption(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, cfgPath, `nodes_file: nodes.txt
+management:
+  enabled: false
+`)
+	writeFile(t, filepath.Join(dir, "nodes.txt"), "vless://uuid-a@a.example.com:443?type=ws&security=tls#NodeA\n")
+
+	if _, err := Load(cfgPath); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nodeSnapshotFile)); !os.IsNotExist(err) {
+		t.Fatalf("%s written without WithNodeSnapshot: %v", nodeSnapshotFile, err)
+	}
+
+	// A snapshot left by the service does not stand in for a missing file.
+	writeFile(t, filepath.Join(dir, nodeSnapshotFile), "vless://uuid-a@a.example.com:443?type=ws&security=tls#NodeA\n")
+	if err := os.Remove(filepath.Join(dir, "nodes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfgPath); err == nil {
+		t.Fatal("expected an error for the missing nodes_file")
+	}
+}
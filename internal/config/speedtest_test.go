@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeSpeedTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		in       SpeedTestConfig
+		want     SpeedTestConfig
+		wantErr  bool
+		warnings int
+	}{
+		{
+			name: "defaults",
+			want: SpeedTestConfig{MaxMB: 10, Timeout: 30 * time.Second},
+		},
+		{
+			name: "explicit values kept",
+			in:   SpeedTestConfig{URL: " https://example.com/100mb.bin ", MaxMB: 50, Timeout: time.Minute, Interval: 6 * time.Hour},
+			want: SpeedTestConfig{URL: "https://example.com/100mb.bin", MaxMB: 50, Timeout: time.Minute, Interval: 6 * time.Hour},
+		},
+		{
+			name:     "bandwidth mode without schedule warns",
+			mode:     "bandwidth",
+			want:     SpeedTestConfig{MaxMB: 10, Timeout: 30 * time.Second},
+			warnings: 1,
+		},
+		{
+			name:    "non-http url rejected",
+			in:      SpeedTestConfig{URL: "ftp://example.com/file"},
+			wantErr: true,
+		},
+		{
+			name:    "negative interval rejected",
+			in:      SpeedTestConfig{Interval: -time.Minute},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Pool: PoolConfig{Mode: tt.mode}, SpeedTest: tt.in}
+			err := cfg.normalizeSpeedTest()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if cfg.SpeedTest != tt.want {
+				t.Fatalf("got %+v, want %+v", cfg.SpeedTest, tt.want)
+			}
+			if got := len(cfg.Warnings()); got != tt.warnings {
+				t.Fatalf("got %d warnings %+v, want %d", got, cfg.Warnings(), tt.warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NodeTemplate generates nodes from one URI containing variable ranges:
+// "[30000-30099]" (numbers, zero-padded when the start is) or "[a,b,c]"
+// (a list). With several ranges every combination is generated, e.g.
+// "socks5://u:p@node[1-50].example.com:[30000-30001]" gives 100 nodes.
+//
+// The other fields apply to every generated node. Port is the local port of
+// the first node and counts up from there.
+type NodeTemplate struct {
+	// Name is the base name; generated nodes are named "<name>-<values>",
+	// or by substituting "{1}", "{2}", ... with the values of the first,
+	// second, ... range when the name contains them.
+	Name     string    `yaml:"name"`
+	URI      string    `yaml:"uri"`
+	Port     uint16    `yaml:"port,omitempty"`
+	Username string    `yaml:"username,omitempty"`
+	Password string    `yaml:"password,omitempty"`
+	Weight   int       `yaml:"weight,omitempty"`
+	MaxConns int       `yaml:"max_conns,omitempty"`
+	Group    string    `yaml:"group,omitempty"`
+	Cost     *NodeCost `yaml:"cost,omitempty"`
+	Via      ViaChain  `yaml:"via,omitempty"`
+	Disabled bool      `yaml:"disabled,omitempty"`
+	Standby  bool      `yaml:"standby,omitempty"`
+
+	Interface      string `yaml:"interface,omitempty"`
+	BindAddress    string `yaml:"bind_address,omitempty"`
+	AllowPlaintext bool   `yaml:"allow_plaintext,omitempty"`
+}
+
+// templateVar matches "[1-50]", "[01-50]" and "[a,b,c]". Bracketed IPv6
+// hosts never match since their contents contain colons.
+var templateVar = regexp.MustCompile(`\[(\d+)-(\d+)\]|\[([^\[\]:,]+(?:,[^\[\]:,]+)+)\]`)
+
+// expandTemplates returns the nodes described by templates, marked with
+// NodeSourceTemplate.
+func expandTemplates(templates []NodeTemplate) ([]NodeConfig, error) {
+	var out []NodeConfig
+	for idx, tmpl := range templates {
+		nodes, err := tmpl.expand()
+		if err != nil {
+			name := tmpl.Name
+			if name == "" {
+				name = strconv.Itoa(idx)
+			}
+			return nil, fmt.Errorf("node_templates[%s]: %w", name, err)
+		}
+		if len(out)+len(nodes) > maxExpandedNodes {
+			return nil, fmt.Errorf("node_templates produce more than %d nodes", maxExpandedNodes)
+		}
+		out = append(out, nodes...)
+	}
+	return out, nil
+}
+
+func (t NodeTemplate) expand() ([]NodeConfig, error) {
+	uri := strings.TrimSpace(t.URI)
+	if uri == "" {
+		return nil, fmt.Errorf("uri is required")
+	}
+	matches := templateVar.FindAllStringSubmatchIndex(uri, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("uri has no [from-to] or [a,b] range")
+	}
+	values := make([][]string, len(matches))
+	total := 1
+	for i, m := range matches {
+		vals, err := templateValues(uri, m)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = vals
+		if total *= len(vals); total > maxExpandedNodes {
+			return nil, fmt.Errorf("more than %d nodes", maxExpandedNodes)
+		}
+	}
+
+	base := strings.TrimSpace(t.Name)
+	if base == "" {
+		base = ExtractNodeName(uri)
+	}
+	out := make([]NodeConfig, 0, total)
+	choice := make([]string, len(matches))
+	var generate func(depth int) error
+	generate = func(depth int) error {
+		if depth < len(matches) {
+			for _, v := range values[depth] {
+				choice[depth] = v
+				if err := generate(depth + 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		node := NodeConfig{
+			Name:           t.nodeName(base, choice),
+			URI:            substituteVars(uri, matches, choice),
+			Username:       t.Username,
+			Password:       t.Password,
+			Weight:         t.Weight,
+			MaxConns:       t.MaxConns,
+			Group:          t.Group,
+			Cost:           t.Cost,
+			Via:            t.Via,
+			Disabled:       t.Disabled,
+			Standby:        t.Standby,
+			Interface:      t.Interface,
+			BindAddress:    t.BindAddress,
+			AllowPlaintext: t.AllowPlaintext,
+			Source:         NodeSourceTemplate,
+			ExpandedFrom:   base,
+		}
+		if t.Port != 0 {
+			listen := int(t.Port) + len(out)
+			if listen > 65535 {
+				return fmt.Errorf("local port %d+%d exceeds 65535", t.Port, len(out))
+			}
+			node.Port = uint16(listen)
+		}
+		out = append(out, node)
+		return nil
+	}
+	if err := generate(0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (t NodeTemplate) nodeName(base string, values []string) string {
+	if !strings.Contains(base, "{1}") {
+		return base + "-" + strings.Join(values, "-")
+	}
+	name := base
+	for i, v := range values {
+		name = strings.ReplaceAll(name, "{"+strconv.Itoa(i+1)+"}", v)
+	}
+	return name
+}
+
+// templateValues lists the values of the range at submatch indexes m.
+func templateValues(uri string, m []int) ([]string, error) {
+	if m[6] >= 0 {
+		return splitList(uri[m[6]:m[7]]), nil
+	}
+	loStr, hiStr := uri[m[2]:m[3]], uri[m[4]:m[5]]
+	lo, err1 := strconv.Atoi(loStr)
+	hi, err2 := strconv.Atoi(hiStr)
+	if err1 != nil || err2 != nil || hi < lo {
+		return nil, fmt.Errorf("invalid range [%s-%s]", loStr, hiStr)
+	}
+	if hi-lo >= maxExpandedNodes {
+		return nil, fmt.Errorf("range [%s-%s] exceeds %d values", loStr, hiStr, maxExpandedNodes)
+	}
+	width := 0
+	if len(loStr) > 1 && loStr[0] == '0' {
+		width = len(loStr)
+	}
+	vals := make([]string, 0, hi-lo+1)
+	for n := lo; n <= hi; n++ {
+		vals = append(vals, fmt.Sprintf("%0*d", width, n))
+	}
+	return vals, nil
+}
+
+func substituteVars(uri string, matches [][]int, values []string) string {
+	var b strings.Builder
+	last := 0
+	for i, m := range matches {
+		b.WriteString(uri[last:m[0]])
+		b.WriteString(values[i])
+		last = m[1]
+	}
+	b.WriteString(uri[last:])
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandTemplatesHostsAndPorts(t *testing.T) {
+	nodes, err := expandTemplates([]NodeTemplate{{
+		Name:  "edge",
+		URI:   "socks5://u:p@node[1-2].example.com:[30000-30001]",
+		Port:  40000,
+		Group: "edge",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, uri string
+		port      uint16
+	}{
+		{"edge-1-30000", "socks5://u:p@node1.example.com:30000", 40000},
+		{"edge-1-30001", "socks5://u:p@node1.example.com:30001", 40001},
+		{"edge-2-30000", "socks5://u:p@node2.example.com:30000", 40002},
+		{"edge-2-30001", "socks5://u:p@node2.example.com:30001", 40003},
+	}
+	if len(nodes) != len(want) {
+		t.Fatalf("got %d nodes, want %d", len(nodes), len(want))
+	}
+	for i, w := range want {
+		got := nodes[i]
+		if got.Name != w.name || got.URI != w.uri || got.Port != w.port {
+			t.Fatalf("node %d = %+v, want %+v", i, got, w)
+		}
+		if got.Source != NodeSourceTemplate || got.ExpandedFrom != "edge" || got.Group != "edge" {
+			t.Fatalf("node %d not marked as generated: %+v", i, got)
+		}
+	}
+}
+
+func TestExpandTemplatesListsPaddingAndNames(t *testing.T) {
+	nodes, err := expandTemplates([]NodeTemplate{{
+		Name: "{2} exit {1}",
+		URI:  "http://[2001:db8::1]:8080/?exit=[08-10]&cc=[jp,us]",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 6 {
+		t.Fatalf("got %d nodes, want 6", len(nodes))
+	}
+	if nodes[0].Name != "jp exit 08" || nodes[0].URI != "http://[2001:db8::1]:8080/?exit=08&cc=jp" {
+		t.Fatalf("unexpected first node %+v", nodes[0])
+	}
+	if nodes[5].Name != "us exit 10" {
+		t.Fatalf("unexpected last node name %q", nodes[5].Name)
+	}
+}
+
+func TestExpandTemplatesErrors(t *testing.T) {
+	for name, tmpl := range map[string]NodeTemplate{
+		"no range": {Name: "a", URI: "http://10.0.0.1:8080"},
+		"reversed": {Name: "a", URI: "http://10.0.0.1:[9-1]"},
+		"too many": {Name: "a", URI: "http://h[1-200].example.com:[1-100]"},
+		"port":     {Name: "a", URI: "http://10.0.0.1:[1-3]", Port: 65535},
+	} {
+		if _, err := expandTemplates([]NodeTemplate{tmpl}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSaveNodesKeepsTemplates(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeFile(t, cfgPath, `mode: pool
+management:
+  enabled: false
+nodes:
+  - name: solo
+    uri: http://10.0.0.1:8080
+node_templates:
+  - name: res
+    uri: socks5://gw.example.com:[30000-30099]
+`)
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Nodes) != 101 {
+		t.Fatalf("loaded %d nodes, want 101", len(cfg.Nodes))
+	}
+	if err := cfg.SaveNodes(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(cfgPath)
+	if strings.Count(string(data), "uri:") != 2 || !strings.Contains(string(data), "[30000-30099]") {
+		t.Fatalf("templates not preserved:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nodes.txt")); err == nil {
+		t.Fatal("template nodes must not be written to nodes.txt")
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTiers(t *testing.T) {
+	cfg := &Config{Nodes: []NodeConfig{{Name: "a", Group: "DC"}, {Name: "b", Group: "residential"}}}
+	cfg.Listener.Tiers = map[string]TierConfig{
+		" Free ":  {Groups: []string{"dc"}, MaxConnections: 5, QuotaMB: 1024},
+		"premium": {Groups: []string{" DC", "Residential", "dc", "mobile"}},
+	}
+	cfg.Listener.Users = []UserConfig{
+		{Username: "alice", Password: "x", Tier: "FREE"},
+		{Username: "bob", Password: "y", Tier: "free", MaxConnections: 20},
+	}
+	if err := cfg.normalizeUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Listener.Tiers["premium"].Groups; !slices.Equal(got, []string{"dc", "residential", "mobile"}) {
+		t.Fatalf("premium groups = %v", got)
+	}
+	if warnings := cfg.Warnings(); len(warnings) != 1 || warnings[0].Field != "listener.tiers.premium.groups" {
+		t.Fatalf("expected one warning for the mobile group, got %+v", warnings)
+	}
+	alice := cfg.UserLimits(cfg.Listener.Users[0])
+	if alice.Tier != "free" || alice.MaxConnections != 5 || alice.QuotaMB != 1024 {
+		t.Fatalf("alice limits = %+v", alice)
+	}
+	if bob := cfg.UserLimits(cfg.Listener.Users[1]); bob.MaxConnections != 20 || bob.QuotaMB != 1024 {
+		t.Fatalf("bob's own max_connections must win, got %+v", bob)
+	}
+}
+
+func TestNormalizeTiersErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tiers   map[string]TierConfig
+		user    UserConfig
+		wantErr string
+	}{
+		{name: "unknown tier", tiers: map[string]TierConfig{"free": {}}, user: UserConfig{Username: "a", Tier: "gold"}, wantErr: "unknown tier"},
+		{name: "negative limit", tiers: map[string]TierConfig{"free": {QuotaMB: -1}}, user: UserConfig{Username: "a"}, wantErr: "limits must be >= 0"},
+		{name: "duplicate", tiers: map[string]TierConfig{"free": {}, "FREE": {}}, user: UserConfig{Username: "a"}, wantErr: "configured twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Listener.Tiers = tt.tiers
+			cfg.Listener.Users = []UserConfig{tt.user}
+			err := cfg.normalizeUsers()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo
+)
+
+// normalizeTimezone resolves timezone to a location.
+func (c *Config) normalizeTimezone() error {
+	c.Timezone = strings.TrimSpace(c.Timezone)
+	c.location = nil
+	if c.Timezone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return fmt.Errorf("timezone: unknown time zone %q (use an IANA name such as Asia/Shanghai or UTC)", c.Timezone)
+	}
+	c.location = loc
+	return nil
+}
+
+// Location returns the configured timezone, or the host's local time zone
+// when none is set.
+func (c *Config) Location() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeTimezone(t *testing.T) {
+	cfg := &Config{Timezone: " Asia/Shanghai "}
+	if err := cfg.normalizeTimezone(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Timezone != "Asia/Shanghai" || cfg.Location().String() != "Asia/Shanghai" {
+		t.Fatalf("timezone = %q, location = %s", cfg.Timezone, cfg.Location())
+	}
+
+	if err := (&Config{Timezone: "Mars/Olympus"}).normalizeTimezone(); err == nil {
+		t.Fatal("expected an error for an unknown zone")
+	}
+	if loc := (&Config{}).Location(); loc != time.Local {
+		t.Fatalf("unset timezone should use the host zone, got %s", loc)
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"easy_proxies/internal/tlsconf"
+)
+
+// TLSConfig serves a listener over TLS. Setting cert_file/key_file or
+// self_signed turns it on.
+type TLSConfig struct {
+	CertFile   string     `yaml:"cert_file,omitempty"`   // PEM 证书（可含证书链）
+	KeyFile    string     `yaml:"key_file,omitempty"`    // PEM 私钥
+	SelfSigned bool       `yaml:"self_signed,omitempty"` // 未指定证书时自动生成自签名证书，保存在配置目录 tls/ 下
+	SNICerts   []CertPair `yaml:"sni_certs,omitempty"`   // 额外证书，按客户端 SNI 匹配证书中的域名选择
+}
+
+// CertPair is a PEM certificate and its private key.
+type CertPair struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled reports whether the listener serves TLS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+// Options converts t for tlsconf; hosts are the names a generated
+// self-signed certificate covers.
+func (t TLSConfig) Options(hosts []string) tlsconf.Options {
+	opts := tlsconf.Options{
+		Default:    tlsconf.Pair{CertFile: t.CertFile, KeyFile: t.KeyFile},
+		SelfSigned: t.SelfSigned,
+		Hosts:      hosts,
+	}
+	for _, pair := range t.SNICerts {
+		opts.SNI = append(opts.SNI, tlsconf.Pair{CertFile: pair.CertFile, KeyFile: pair.KeyFile})
+	}
+	return opts
+}
+
+// normalizeTLS validates the TLS settings of section, resolves relative
+// paths against the config directory and picks the self-signed paths.
+func (c *Config) normalizeTLS(section string, t *TLSConfig) error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("%s: cert_file and key_file must be set together", section)
+	}
+	if t.CertFile == "" && t.SelfSigned {
+		t.CertFile = filepath.Join("tls", section+".crt")
+		t.KeyFile = filepath.Join("tls", section+".key")
+	}
+	if !t.Enabled() {
+		if len(t.SNICerts) > 0 {
+			return fmt.Errorf("%s: sni_certs requires cert_file/key_file or self_signed", section)
+		}
+		return nil
+	}
+	t.CertFile, t.KeyFile = c.resolvePath(t.CertFile), c.resolvePath(t.KeyFile)
+	for i := range t.SNICerts {
+		pair := &t.SNICerts[i]
+		if pair.CertFile == "" || pair.KeyFile == "" {
+			return fmt.Errorf("%s: sni_certs[%d] needs cert_file and key_file", section, i)
+		}
+		pair.CertFile, pair.KeyFile = c.resolvePath(pair.CertFile), c.resolvePath(pair.KeyFile)
+	}
+	return nil
+}
+
+// resolvePath makes path relative to the config file's directory.
+func (c *Config) resolvePath(path string) string {
+	if c.filePath == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(c.filePath), path)
+}
+
+// SelfSignedHosts lists the names a generated certificate for a listener
+// on address should cover: localhost, the address when it is specific and
+// external_ip.
+func (c *Config) SelfSignedHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1"}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if ip := net.ParseIP(address); address != "" && (ip == nil || !ip.IsUnspecified()) {
+		hosts = append(hosts, address)
+	}
+	if c.ExternalIP != "" {
+		hosts = append(hosts, c.ExternalIP)
+	}
+	return hosts
+}
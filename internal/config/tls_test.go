@@ -0,0 +1,43 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeTLS(t *testing.T) {
+	c := &Config{filePath: "/etc/easy_proxies/config.yaml"}
+
+	self := TLSConfig{SelfSigned: true}
+	if err := c.normalizeTLS("listener", &self); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/etc/easy_proxies", "tls", "listener.crt"); self.CertFile != want {
+		t.Fatalf("cert_file = %q, want %q", self.CertFile, want)
+	}
+
+	files := TLSConfig{CertFile: "/certs/a.pem", KeyFile: "a.key", SNICerts: []CertPair{{CertFile: "b.pem", KeyFile: "b.key"}}}
+	if err := c.normalizeTLS("listener", &files); err != nil {
+		t.Fatal(err)
+	}
+	if files.CertFile != "/certs/a.pem" || files.KeyFile != filepath.Join("/etc/easy_proxies", "a.key") ||
+		files.SNICerts[0].CertFile != filepath.Join("/etc/easy_proxies", "b.pem") {
+		t.Fatalf("paths not resolved: %+v", files)
+	}
+
+	for _, bad := range []TLSConfig{
+		{CertFile: "a.pem"},
+		{SNICerts: []CertPair{{CertFile: "b.pem", KeyFile: "b.key"}}},
+		{SelfSigned: true, SNICerts: []CertPair{{CertFile: "b.pem"}}},
+	} {
+		bad := bad
+		if err := c.normalizeTLS("listener", &bad); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+
+	var off TLSConfig
+	if err := c.normalizeTLS("management", &off); err != nil || off.Enabled() {
+		t.Fatalf("disabled TLS changed: %+v, %v", off, err)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestNormalizeTransparent(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		cfg := &Config{Mode: "pool", Transparent: TransparentConfig{Enabled: true}}
+		if err := cfg.normalizeTransparent(); err != nil || cfg.Transparent.Enabled {
+			t.Fatalf("the transparent inbound should be disabled off Linux (err=%v)", err)
+		}
+		return
+	}
+
+	cfg := &Config{Mode: "pool", Listener: ListenerConfig{Port: 2323}, Transparent: TransparentConfig{Enabled: true}}
+	if err := cfg.normalizeTransparent(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Transparent; got.Mode != TransparentRedirect || got.Listen != "0.0.0.0" || got.Port != 7892 {
+		t.Fatalf("defaults not applied: %+v", got)
+	}
+	cfg = &Config{Mode: "hybrid", Transparent: TransparentConfig{Enabled: true, Mode: " TProxy "}}
+	if err := cfg.normalizeTransparent(); err != nil || cfg.Transparent.Mode != TransparentTProxy || cfg.Transparent.Port != 7893 {
+		t.Fatalf("tproxy defaults not applied: %+v (err=%v)", cfg.Transparent, err)
+	}
+
+	cfg = &Config{Mode: "multi-port", Transparent: TransparentConfig{Enabled: true}}
+	if err := cfg.normalizeTransparent(); err != nil || cfg.Transparent.Enabled || len(cfg.Warnings()) != 1 {
+		t.Fatalf("the transparent inbound should be disabled in multi-port mode (err=%v)", err)
+	}
+
+	for _, bad := range []TransparentConfig{
+		{Enabled: true, Mode: "nat"},
+		{Enabled: true, Listen: "lan"},
+		{Enabled: true, Port: 2323},
+	} {
+		cfg := &Config{Mode: "pool", Listener: ListenerConfig{Port: 2323}, Transparent: bad}
+		if err := cfg.normalizeTransparent(); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import "testing"
+
+func TestNormalizeTUN(t *testing.T) {
+	cfg := &Config{Mode: "pool", TUN: TUNConfig{Enabled: true}}
+	if err := cfg.normalizeTUN(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TUN.Stack != "mixed" || cfg.TUN.MTU != 9000 || len(cfg.TUN.Address) != 2 || !cfg.TUN.AutoRouteOrDefault() {
+		t.Fatalf("defaults not applied: %+v", cfg.TUN)
+	}
+
+	cfg = &Config{Mode: "multi-port", TUN: TUNConfig{Enabled: true}}
+	if err := cfg.normalizeTUN(); err != nil || cfg.TUN.Enabled {
+		t.Fatalf("TUN should be disabled in multi-port mode (err=%v)", err)
+	}
+
+	for _, bad := range []TUNConfig{
+		{Enabled: true, Stack: "lwip"},
+		{Enabled: true, Address: []string{"172.19.0.1"}},
+		{Enabled: true, SplitTunnelConfig: SplitTunnelConfig{RouteExcludeAddress: []string{"bogus"}}},
+	} {
+		cfg := &Config{Mode: "pool", TUN: bad}
+		if err := cfg.normalizeTUN(); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestSplitTunnelNormalize(t *testing.T) {
+	split := SplitTunnelConfig{
+		RouteAddress:   []string{"10.0.0.0/8"},
+		IncludeDomain:  []string{" .Example.COM ", ""},
+		ExcludeProcess: []string{"  "},
+	}
+	if err := split.Normalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(split.IncludeDomain) != 1 || split.IncludeDomain[0] != "example.com" {
+		t.Fatalf("include_domain not cleaned: %v", split.IncludeDomain)
+	}
+	if split.ExcludeProcess != nil {
+		t.Fatalf("blank exclude_process should be dropped: %v", split.ExcludeProcess)
+	}
+
+	bad := SplitTunnelConfig{RouteAddress: []string{"10.0.0.0"}}
+	if err := bad.Normalize(); err == nil {
+		t.Fatal("expected error for invalid route_address")
+	}
+}
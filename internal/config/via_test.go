@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestViaChainAcceptsScalarAndList(t *testing.T) {
+	var nodes []NodeConfig
+	data := `
+- name: a
+  uri: socks5://a:1080
+  via: relay
+- name: b
+  uri: socks5://b:1080
+  via: [relay, "http://edge:8080"]
+- name: c
+  uri: socks5://c:1080
+`
+	if err := yaml.Unmarshal([]byte(data), &nodes); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(nodes[0].Via) != 1 || nodes[0].Via[0] != "relay" {
+		t.Fatalf("scalar via: got %v", nodes[0].Via)
+	}
+	if len(nodes[1].Via) != 2 || nodes[1].Via[1] != "http://edge:8080" {
+		t.Fatalf("list via: got %v", nodes[1].Via)
+	}
+	if nodes[2].Via != nil {
+		t.Fatalf("missing via should be nil, got %v", nodes[2].Via)
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Warning is a non-fatal problem found while normalizing the configuration.
+// The configuration still loads, but probably does not do what was meant.
+type Warning struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Warnings returns the warnings collected by the last normalize.
+func (c *Config) Warnings() []Warning {
+	out := make([]Warning, len(c.warnings))
+	copy(out, c.warnings)
+	return out
+}
+
+// warnf logs a configuration warning and records it for Warnings.
+func (c *Config) warnf(field, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("⚠️  %s: %s", field, msg)
+	c.warnings = append(c.warnings, Warning{Field: field, Message: msg})
+}
+
+// collectWarnings runs the checks that only warn. It is called at the end of
+// normalize, after defaults have been applied.
+func (c *Config) collectWarnings() {
+	c.warnDuplicateNames()
+	c.warnProbeTarget()
+	c.warnDurations()
+}
+
+func (c *Config) warnDuplicateNames() {
+	seen := make(map[string]int, len(c.Nodes))
+	for i := range c.Nodes {
+		seen[c.Nodes[i].ConfiguredName()]++
+	}
+	reported := make(map[string]bool)
+	for i := range c.Nodes {
+		name := c.Nodes[i].ConfiguredName()
+		if n := seen[name]; n > 1 && !reported[name] {
+			reported[name] = true
+			c.warnf("nodes", "name %q is used by %d nodes; they are told apart as %q and similar", name, n, c.Nodes[i].Name)
+		}
+	}
+}
+
+// warnProbeTarget checks the probe target without resolving it: probes go
+// through the upstream nodes, so a local or private address never answers.
+func (c *Config) warnProbeTarget() {
+	target := strings.TrimSpace(c.Management.ProbeTarget)
+	if target == "" {
+		return
+	}
+	if scheme, rest, ok := strings.Cut(target, "://"); ok {
+		if scheme != "http" && scheme != "https" {
+			c.warnf("management.probe_target", "scheme %q is not supported, use http:// or https://", scheme)
+			return
+		}
+		target = rest
+	}
+	if idx := strings.Index(target, "/"); idx != -1 {
+		target = target[:idx]
+	}
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		c.warnf("management.probe_target", "%q has no host", c.Management.ProbeTarget)
+		return
+	}
+	if strings.EqualFold(host, "localhost") {
+		c.warnf("management.probe_target", "%q is not reachable through upstream nodes", host)
+		return
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.IsLoopback() || addr.IsUnspecified() || addr.IsPrivate() || addr.IsLinkLocalUnicast() {
+			c.warnf("management.probe_target", "%s is a local address and is not reachable through upstream nodes", addr)
+		}
+	}
+}
+
+func (c *Config) warnDurations() {
+	warnDuration := func(field string, d, min, max time.Duration) {
+		switch {
+		case d <= 0:
+		case d < time.Second:
+			c.warnf(field, "%s is under a second; check the unit (e.g. 30s, 5m)", d)
+		case d < min:
+			c.warnf(field, "%s is unusually short (expected at least %s)", d, min)
+		case max > 0 && d > max:
+			c.warnf(field, "%s is unusually long (expected at most %s)", d, max)
+		}
+	}
+	warnDuration("pool.blacklist_duration", c.Pool.BlacklistDuration, time.Minute, 7*24*time.Hour)
+	for _, name := range slices.Sorted(maps.Keys(c.Pool.Groups)) {
+		warnDuration("pool.groups."+name+".blacklist_duration", c.Pool.Groups[name].BlacklistDuration, time.Minute, 7*24*time.Hour)
+	}
+	warnDuration("pool.health_check.interval", c.Pool.HealthCheck.Interval, 10*time.Second, 24*time.Hour)
+	warnDuration("pool.health_check.timeout", c.Pool.HealthCheck.Timeout, time.Second, time.Minute)
+	if hc := c.Pool.HealthCheck; hc.Timeout > 0 && hc.Interval > 0 && hc.Timeout >= hc.Interval {
+		c.warnf("pool.health_check.timeout", "%s is not shorter than the interval %s; probes will overlap", hc.Timeout, hc.Interval)
+	}
+	warnDuration("shutdown_timeout", c.ShutdownTimeout, time.Second, 10*time.Minute)
+	if c.SubscriptionRefresh.Enabled {
+		warnDuration("subscription_refresh.interval", c.SubscriptionRefresh.Interval, 5*time.Minute, 0)
+		warnDuration("subscription_refresh.timeout", c.SubscriptionRefresh.Timeout, time.Second, 10*time.Minute)
+	}
+	if c.MultiPort.Lazy {
+		warnDuration("multi_port.idle_timeout", c.MultiPort.IdleTimeout, 10*time.Second, 0)
+	}
+}
+
+// mergeWarnings appends the warnings of prev that are not recorded yet.
+func (c *Config) mergeWarnings(prev []Warning) {
+	for _, w := range prev {
+		if !containsWarning(c.warnings, w) {
+			c.warnings = append(c.warnings, w)
+		}
+	}
+}
+
+func containsWarning(list []Warning, w Warning) bool {
+	for _, have := range list {
+		if have == w {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadWarnings(t *testing.T, body string) []Warning {
+	t.Helper()
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return cfg.Warnings()
+}
+
+func hasWarning(list []Warning, field, substr string) bool {
+	for _, w := range list {
+		if w.Field == field && strings.Contains(w.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWarningsCleanConfig(t *testing.T) {
+	warnings := loadWarnings(t, `
+nodes:
+  - name: a
+    uri: socks5://1.1.1.1:1080
+  - name: b
+    uri: socks5://1.1.1.2:1080
+`)
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %+v", warnings)
+	}
+}
+
+func TestWarningsDuplicateNames(t *testing.T) {
+	warnings := loadWarnings(t, `
+nodes:
+  - name: dup
+    uri: socks5://1.1.1.1:1080
+  - name: dup
+    uri: socks5://1.1.1.2:1080
+  - name: dup
+    uri: socks5://1.1.1.3:1080
+`)
+	if !hasWarning(warnings, "nodes", `"dup" is used by 3 nodes`) {
+		t.Fatalf("missing duplicate name warning: %+v", warnings)
+	}
+	count := 0
+	for _, w := range warnings {
+		if strings.Contains(w.Message, `"dup"`) {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("duplicate name reported %d times, want once", count)
+	}
+}
+
+func TestWarningsProbeTarget(t *testing.T) {
+	cases := map[string]string{
+		"127.0.0.1:80":          "local address",
+		"http://localhost/":     "not reachable",
+		"https://192.168.1.1":   "local address",
+		"ftp://example.com":     "not supported",
+		"http://:8080/generate": "has no host",
+	}
+	for target, want := range cases {
+		warnings := loadWarnings(t, `
+management:
+  probe_target: "`+target+`"
+nodes:
+  - uri: socks5://1.1.1.1:1080
+`)
+		if !hasWarning(warnings, "management.probe_target", want) {
+			t.Fatalf("probe_target %q: want warning containing %q, got %+v", target, want, warnings)
+		}
+	}
+}
+
+func TestWarningsDurations(t *testing.T) {
+	warnings := loadWarnings(t, `
+shutdown_timeout: 30ms
+pool:
+  blacklist_duration: 10s
+  health_check:
+    interval: 30s
+    timeout: 45s
+nodes:
+  - uri: socks5://1.1.1.1:1080
+`)
+	if !hasWarning(warnings, "shutdown_timeout", "check the unit") {
+		t.Fatalf("missing sub-second warning: %+v", warnings)
+	}
+	if !hasWarning(warnings, "pool.blacklist_duration", "unusually short") {
+		t.Fatalf("missing short duration warning: %+v", warnings)
+	}
+	if !hasWarning(warnings, "pool.health_check.timeout", "not shorter than the interval") {
+		t.Fatalf("missing timeout/interval warning: %+v", warnings)
+	}
+}
+
+func TestWarningsKeptAcrossPortRestore(t *testing.T) {
+	warnings := loadWarnings(t, `
+mode: multi-port
+sticky:
+  enabled: true
+nodes:
+  - name: dup
+    uri: socks5://1.1.1.1:1080
+  - name: dup
+    uri: socks5://1.1.1.2:1080
+`)
+	if !hasWarning(warnings, "sticky.enabled", "disabling") || !hasWarning(warnings, "nodes", `"dup"`) {
+		t.Fatalf("warnings lost after port restore: %+v", warnings)
+	}
+}
@@ -0,0 +1,36 @@
+// Package freebind opens listeners on addresses that may not be assigned to
+// this host yet, as with a virtual IP that moves between machines on
+// failover. On Linux it sets IP_FREEBIND; elsewhere it is a plain listen.
+package freebind
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+
+	"easy_proxies/internal/handoff"
+)
+
+// Listen is handoff.Listen with IP_FREEBIND set where supported.
+func Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		if err := handoff.Control(network, address, c); err != nil {
+			return err
+		}
+		return control(network, address, c)
+	}}
+	return lc.Listen(ctx, network, address)
+}
+
+// Supported reports whether Listen can bind unassigned addresses on this
+// platform.
+func Supported() bool {
+	return supported
+}
+
+// IsAddrNotAvail reports whether err is a bind failure because the address
+// is not assigned to any interface.
+func IsAddrNotAvail(err error) bool {
+	return errors.Is(err, syscall.EADDRNOTAVAIL)
+}
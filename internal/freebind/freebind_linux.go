@@ -0,0 +1,30 @@
+//go:build linux
+
+package freebind
+
+import (
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const supported = true
+
+func control(network, _ string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if strings.HasSuffix(network, "6") {
+			// IPV6_FREEBIND needs Linux 4.15; older kernels honour
+			// IP_FREEBIND on IPv6 sockets as well.
+			if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_IPV6, unix.IPV6_FREEBIND, 1); sockErr == nil {
+				return
+			}
+		}
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_IP, unix.IP_FREEBIND, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
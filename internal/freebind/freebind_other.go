@@ -0,0 +1,11 @@
+//go:build !linux
+
+package freebind
+
+import "syscall"
+
+const supported = false
+
+func control(string, string, syscall.RawConn) error {
+	return nil
+}
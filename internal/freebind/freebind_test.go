@@ -0,0 +1,18 @@
+package freebind
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListenUnassignedAddress(t *testing.T) {
+	if !Supported() {
+		t.Skip("IP_FREEBIND not supported on this platform")
+	}
+	// 192.0.2.0/24 (TEST-NET-1) is never assigned to a local interface.
+	ln, err := Listen(context.Background(), "tcp4", "192.0.2.1:0")
+	if err != nil {
+		t.Fatalf("freebind listen: %v", err)
+	}
+	ln.Close()
+}
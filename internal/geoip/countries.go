@@ -0,0 +1,52 @@
+package geoip
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// CountryCIDRs returns every network in the database at dbPath whose country
+// ISO code is one of countries (case-insensitive). The result is suitable for
+// an ip_cidr route rule.
+func CountryCIDRs(dbPath string, countries []string) ([]string, error) {
+	if len(countries) == 0 {
+		return nil, nil
+	}
+	if err := EnsureDatabase(dbPath); err != nil {
+		return nil, err
+	}
+	want := make(map[string]bool, len(countries))
+	for _, code := range countries {
+		want[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+
+	db, err := maxminddb.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database: %w", err)
+	}
+	defer db.Close()
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	var cidrs []string
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		record.Country.ISOCode = ""
+		subnet, err := networks.Network(&record)
+		if err != nil {
+			return nil, fmt.Errorf("read geoip network: %w", err)
+		}
+		if want[record.Country.ISOCode] {
+			cidrs = append(cidrs, subnet.String())
+		}
+	}
+	if err := networks.Err(); err != nil {
+		return nil, fmt.Errorf("walk geoip database: %w", err)
+	}
+	return cidrs, nil
+}
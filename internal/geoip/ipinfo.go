@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// IPDetails is what the local databases know about one address.
+type IPDetails struct {
+	Country string `json:"country,omitempty"`
+	ISOCode string `json:"iso_code,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+// IPInfo looks up country and ASN details from local MaxMind databases.
+// Unlike Lookup it never downloads anything: a missing path simply leaves the
+// corresponding fields empty.
+type IPInfo struct {
+	country *geoip2.Reader
+	asn     *geoip2.Reader
+}
+
+// OpenIPInfo opens the country and ASN databases. Either path may be empty.
+func OpenIPInfo(countryPath, asnPath string) (*IPInfo, error) {
+	info := &IPInfo{}
+	var err error
+	if countryPath != "" {
+		if info.country, err = geoip2.Open(countryPath); err != nil {
+			return nil, err
+		}
+	}
+	if asnPath != "" {
+		if info.asn, err = geoip2.Open(asnPath); err != nil {
+			info.Close()
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// Lookup returns the details known for ip; lookup errors leave fields empty.
+func (i *IPInfo) Lookup(ip net.IP) IPDetails {
+	var d IPDetails
+	if i == nil || ip == nil {
+		return d
+	}
+	if i.country != nil {
+		if record, err := i.country.Country(ip); err == nil {
+			d.ISOCode = record.Country.IsoCode
+			d.Country = record.Country.Names["en"]
+		}
+	}
+	if i.asn != nil {
+		if record, err := i.asn.ASN(ip); err == nil {
+			d.ASN = record.AutonomousSystemNumber
+			d.ASOrg = record.AutonomousSystemOrganization
+		}
+	}
+	return d
+}
+
+// Close releases both databases.
+func (i *IPInfo) Close() error {
+	if i == nil {
+		return nil
+	}
+	var errs []error
+	if i.country != nil {
+		errs = append(errs, i.country.Close())
+	}
+	if i.asn != nil {
+		errs = append(errs, i.asn.Close())
+	}
+	return errors.Join(errs...)
+}
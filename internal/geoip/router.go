@@ -11,16 +11,41 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"easy_proxies/internal/accesslog"
+	"easy_proxies/internal/freebind"
+	"easy_proxies/internal/handoff"
+	"easy_proxies/internal/httprewrite"
+	"easy_proxies/internal/proxyerr"
+	"easy_proxies/internal/users"
 )
 
 // RouterConfig holds configuration for the GeoIP router
 type RouterConfig struct {
-	Listen   string
-	Port     uint16
-	Username string
-	Password string
+	Listen string
+	Port   uint16
+	Users  map[string]string // username -> password; empty disables proxy auth
+	// Freebind allows Listen to be an address not assigned to this host yet.
+	Freebind bool
+
+	// Tuning; zero values fall back to the defaults below.
+	BufferSize          int // CONNECT relay buffer per direction
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// Headers rewrites plain HTTP requests; nil leaves them unchanged.
+	Headers *httprewrite.Rules
+	// ErrorDetail answers failed requests with a JSON body and headers
+	// naming the nodes tried, the error class and a retry hint.
+	ErrorDetail bool
 }
 
+const (
+	defaultBufferSize          = 32 * 1024
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+)
+
 // PoolDialer is an interface for dialing through a specific pool
 type PoolDialer interface {
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
@@ -42,6 +67,15 @@ func NewRouter(cfg RouterConfig, logger *log.Logger) *Router {
 	if logger == nil {
 		logger = log.Default()
 	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
 	return &Router{
 		cfg:        cfg,
 		pools:      make(map[string]PoolDialer),
@@ -80,7 +114,19 @@ func (r *Router) Start(ctx context.Context) error {
 	go func() {
 		r.logger.Printf("🌐 GeoIP Router started on %s", addr)
 		r.logger.Println("   Routes: /jp, /kr, /us, /hk, /tw, /sg, /other (default: all nodes)")
-		if err := r.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var (
+			ln  net.Listener
+			err error
+		)
+		if r.cfg.Freebind {
+			ln, err = freebind.Listen(ctx, "tcp", addr)
+		} else {
+			ln, err = handoff.Listen(ctx, "tcp", addr)
+		}
+		if err == nil {
+			err = r.server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			r.logger.Printf("GeoIP router error: %v", err)
 		}
 	}()
@@ -103,38 +149,82 @@ func (r *Router) Stop() error {
 	return nil
 }
 
-// checkProxyAuth validates the Proxy-Authorization header.
-// Proxy clients send credentials via "Proxy-Authorization", not "Authorization".
-func (r *Router) checkProxyAuth(req *http.Request) bool {
+// checkProxyAuth validates the Proxy-Authorization header and returns the
+// authenticated username with the pin and connection tag encoded in it, if
+// any. Proxy clients send credentials via "Proxy-Authorization", not
+// "Authorization".
+func (r *Router) checkProxyAuth(req *http.Request) (string, users.Pin, string, bool) {
 	auth := req.Header.Get("Proxy-Authorization")
 	if auth == "" {
-		return false
+		return "", users.Pin{}, "", false
 	}
 	const prefix = "Basic "
 	if !strings.HasPrefix(auth, prefix) {
-		return false
+		return "", users.Pin{}, "", false
 	}
 	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
 	if err != nil {
-		return false
+		return "", users.Pin{}, "", false
 	}
 	parts := strings.SplitN(string(decoded), ":", 2)
 	if len(parts) != 2 {
-		return false
+		return "", users.Pin{}, "", false
+	}
+	name, tag := users.SplitTag(parts[0])
+	username, pin := users.SplitPinned(name)
+	password, ok := r.cfg.Users[username]
+	if !ok || password != parts[1] {
+		return "", users.Pin{}, "", false
 	}
-	return parts[0] == r.cfg.Username && parts[1] == r.cfg.Password
+	return username, pin, tag, true
+}
+
+// requestPin returns the pin from the X-Proxy-Node / X-Proxy-Group headers,
+// falling back to authPin, and strips the headers from req.
+func requestPin(req *http.Request, authPin users.Pin) users.Pin {
+	pin := users.Pin{
+		Node:  strings.TrimSpace(req.Header.Get(users.NodeHeader)),
+		Group: strings.TrimSpace(req.Header.Get(users.GroupHeader)),
+	}
+	req.Header.Del(users.NodeHeader)
+	req.Header.Del(users.GroupHeader)
+	if pin.IsZero() {
+		return authPin
+	}
+	return pin
+}
+
+// requestTag returns the connection tag from the X-Proxy-Tag header,
+// falling back to authTag, and strips the header from req.
+func requestTag(req *http.Request, authTag string) string {
+	tag := users.CleanTag(req.Header.Get(users.TagHeader))
+	req.Header.Del(users.TagHeader)
+	if tag == "" {
+		return authTag
+	}
+	return tag
 }
 
 // ServeHTTP handles incoming HTTP proxy requests
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Check proxy authentication if configured
-	if r.cfg.Username != "" {
-		if !r.checkProxyAuth(req) {
+	var (
+		authPin users.Pin
+		authTag string
+	)
+	if len(r.cfg.Users) > 0 {
+		username, pin, tag, ok := r.checkProxyAuth(req)
+		if !ok {
 			w.Header().Set("Proxy-Authenticate", `Basic realm="Proxy"`)
 			http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
 			return
 		}
+		authPin, authTag = pin, tag
+		req = req.WithContext(users.WithUser(req.Context(), username))
 	}
+	req = req.WithContext(users.WithPin(req.Context(), requestPin(req, authPin)))
+	req = req.WithContext(accesslog.WithTag(req.Context(), requestTag(req, authTag)))
+	req = req.WithContext(accesslog.WithClient(req.Context(), req.RemoteAddr))
 
 	// Extract region from path
 	region, targetHost := r.parseRequest(req)
@@ -206,7 +296,7 @@ func (r *Router) handleConnect(w http.ResponseWriter, req *http.Request, dialer
 
 	targetConn, err := dialer.DialContext(ctx, "tcp", targetHost)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusBadGateway)
+		r.badGateway(w, "Failed to connect", err)
 		return
 	}
 	defer targetConn.Close()
@@ -233,17 +323,26 @@ func (r *Router) handleConnect(w http.ResponseWriter, req *http.Request, dialer
 
 	go func() {
 		defer wg.Done()
-		io.Copy(targetConn, clientConn)
+		io.CopyBuffer(targetConn, clientConn, make([]byte, r.cfg.BufferSize))
 	}()
 
 	go func() {
 		defer wg.Done()
-		io.Copy(clientConn, targetConn)
+		io.CopyBuffer(clientConn, targetConn, make([]byte, r.cfg.BufferSize))
 	}()
 
 	wg.Wait()
 }
 
+// badGateway answers a request that failed through the pool.
+func (r *Router) badGateway(w http.ResponseWriter, what string, err error) {
+	if r.cfg.ErrorDetail {
+		proxyerr.WriteBadGateway(w, err)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", what, err), http.StatusBadGateway)
+}
+
 // getTransport returns a cached http.Transport for the given dialer, creating one if needed.
 func (r *Router) getTransport(dialer PoolDialer) *http.Transport {
 	r.mu.RLock()
@@ -260,8 +359,8 @@ func (r *Router) getTransport(dialer PoolDialer) *http.Transport {
 	}
 	t = &http.Transport{
 		DialContext:         dialer.DialContext,
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
+		MaxIdleConns:        r.cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: r.cfg.MaxIdleConnsPerHost,
 		IdleConnTimeout:     90 * time.Second,
 	}
 	r.transports[dialer] = t
@@ -298,13 +397,19 @@ func (r *Router) handleHTTP(w http.ResponseWriter, req *http.Request, dialer Poo
 	// Remove hop-by-hop headers
 	outReq.Header.Del("Proxy-Connection")
 	outReq.Header.Del("Proxy-Authorization")
+	r.cfg.Headers.Apply(outReq.Header, users.PinFromContext(req.Context()))
 
-	// Use cached transport with connection pooling
+	// Use cached transport with connection pooling. Pooled connections may
+	// belong to any node and carry the tag of an earlier request, so pinned
+	// and tagged requests get a fresh one.
 	transport := r.getTransport(dialer)
+	if !users.PinFromContext(req.Context()).IsZero() || accesslog.TagFromContext(req.Context()) != "" {
+		transport = &http.Transport{DialContext: dialer.DialContext, DisableKeepAlives: true}
+	}
 
 	resp, err := transport.RoundTrip(outReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Request failed: %v", err), http.StatusBadGateway)
+		r.badGateway(w, "Request failed", err)
 		return
 	}
 	defer resp.Body.Close()
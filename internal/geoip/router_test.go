@@ -0,0 +1,80 @@
+package geoip
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"easy_proxies/internal/httprewrite"
+	"easy_proxies/internal/users"
+)
+
+func TestRouterPinFromAuthAndHeaders(t *testing.T) {
+	r := NewRouter(RouterConfig{Users: map[string]string{"alice": "secret"}}, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice-node-tokyo1:secret")))
+	username, pin, _, ok := r.checkProxyAuth(req)
+	if !ok || username != "alice" || pin.Node != "tokyo1" {
+		t.Fatalf("checkProxyAuth = %q, %+v, %v", username, pin, ok)
+	}
+
+	req.Header.Set(users.GroupHeader, "jp")
+	if got := requestPin(req, pin); got != (users.Pin{Group: "jp"}) {
+		t.Fatalf("header should override the username pin, got %+v", got)
+	}
+	if req.Header.Get(users.GroupHeader) != "" {
+		t.Fatal("pin header must be stripped before forwarding")
+	}
+	if got := requestPin(req, pin); got.Node != "tokyo1" {
+		t.Fatalf("without headers the username pin applies, got %+v", got)
+	}
+}
+
+func TestRouterTagFromAuthAndHeader(t *testing.T) {
+	r := NewRouter(RouterConfig{Users: map[string]string{"alice": "secret"}}, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice-group-jp-tag-job42:secret")))
+	username, pin, tag, ok := r.checkProxyAuth(req)
+	if !ok || username != "alice" || pin.Group != "jp" || tag != "job42" {
+		t.Fatalf("checkProxyAuth = %q, %+v, %q, %v", username, pin, tag, ok)
+	}
+
+	req.Header.Set(users.TagHeader, "job-7")
+	if got := requestTag(req, tag); got != "job-7" {
+		t.Fatalf("header should override the username tag, got %q", got)
+	}
+	if req.Header.Get(users.TagHeader) != "" {
+		t.Fatal("tag header must be stripped before forwarding")
+	}
+	if got := requestTag(req, tag); got != "job42" {
+		t.Fatalf("without the header the username tag applies, got %q", got)
+	}
+}
+
+func TestRouterRewritesPlainHTTPHeaders(t *testing.T) {
+	var got http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header.Clone()
+	}))
+	defer target.Close()
+
+	r := NewRouter(RouterConfig{Headers: &httprewrite.Rules{Set: map[string]string{"Accept-Language": "en"}}}, nil)
+	req := httptest.NewRequest(http.MethodGet, target.URL+"/", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.7")
+	rec := httptest.NewRecorder()
+	r.handleHTTP(rec, req, &net.Dialer{}, "")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if got.Get("X-Forwarded-For") != "" || got.Get("Accept-Language") != "en" {
+		t.Fatalf("headers were not rewritten: %v", got)
+	}
+	if _, ok := got["User-Agent"]; ok {
+		t.Fatalf("no User-Agent should be added, got %q", got.Get("User-Agent"))
+	}
+}
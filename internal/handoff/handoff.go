@@ -0,0 +1,45 @@
+// Package handoff lets a running instance hand its listening ports over to
+// a new process without refusing connections in between.
+//
+// Every listener is opened with SO_REUSEPORT where the platform has it, so
+// a second process of the same user can bind the same ports while the
+// first still holds them. On Signal the running process starts its
+// executable again (the path it was started from, which "upgrade" has
+// replaced by then) with the same arguments. The new process calls Ready
+// once it is listening. Only then does the old one close its listeners and
+// drain. If the new process fails or times out first, it is killed and
+// the old one keeps serving.
+package handoff
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+)
+
+// readyEnv names the descriptor of the pipe a new process reports
+// readiness on.
+const readyEnv = "EASY_PROXIES_HANDOFF_FD"
+
+// executable is recorded at start, since the path may point at a replaced
+// binary later on.
+var executable, _ = os.Executable()
+
+// Listen is net.Listen with Control applied.
+func Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: Control}
+	return lc.Listen(ctx, network, address)
+}
+
+// Control prepares a listening socket so that the next process can bind
+// the same address during a handoff.
+func Control(network, address string, c syscall.RawConn) error {
+	return control(network, address, c)
+}
+
+// Supported reports whether listeners can be shared with a new process on
+// this platform.
+func Supported() bool {
+	return supported
+}
@@ -0,0 +1,22 @@
+package handoff
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListenSharesPort(t *testing.T) {
+	if !Supported() {
+		t.Skip("SO_REUSEPORT not supported on this platform")
+	}
+	first, err := Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := Listen(context.Background(), "tcp", first.Addr().String())
+	if err != nil {
+		t.Fatalf("second listener on %s: %v", first.Addr(), err)
+	}
+	second.Close()
+}
@@ -0,0 +1,113 @@
+//go:build unix
+
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Signal is the signal that asks a running instance to hand over to a new
+// process, or nil where there is none.
+var Signal os.Signal = syscall.SIGUSR2
+
+func init() {
+	// Keep the readiness pipe out of processes this one starts (exec
+	// plugins), which would otherwise hold it open after a failed start.
+	if fd, ok := readyFD(); ok {
+		syscall.CloseOnExec(fd)
+	}
+}
+
+func readyFD() (int, bool) {
+	fd, err := strconv.Atoi(os.Getenv(readyEnv))
+	return fd, err == nil && fd > 2
+}
+
+// Successor is the process an instance has handed over to.
+type Successor struct {
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// Start runs the executable again with the same arguments and waits up to
+// timeout for it to call Ready. On failure the new process is killed and
+// the caller keeps serving.
+func Start(timeout time.Duration) (*Successor, error) {
+	if executable == "" {
+		return nil, errors.New("executable path unknown")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), readyEnv+"=3")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w", executable, err)
+	}
+	s := &Successor{cmd: cmd, done: make(chan error, 1)}
+	go func() { s.done <- cmd.Wait() }()
+
+	// Ready writes one byte; a process that exits first closes the pipe
+	// without writing and the read fails with EOF.
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+		if err == nil {
+			return s, nil
+		}
+		err = errors.New("exited before listening")
+	case <-timer.C:
+		err = fmt.Errorf("not listening after %s", timeout)
+	}
+	_ = cmd.Process.Kill()
+	if werr := <-s.done; werr != nil {
+		err = fmt.Errorf("%w (%v)", err, werr)
+	}
+	return nil, fmt.Errorf("new process %d %w", cmd.Process.Pid, err)
+}
+
+// Pid returns the process ID of the successor.
+func (s *Successor) Pid() int {
+	return s.cmd.Process.Pid
+}
+
+// Signal forwards sig to the successor.
+func (s *Successor) Signal(sig os.Signal) error {
+	return s.cmd.Process.Signal(sig)
+}
+
+// Wait returns the exit error of the successor once it has exited.
+func (s *Successor) Wait() <-chan error {
+	return s.done
+}
+
+// Ready tells the process that started this one, if any, that it is
+// listening and the old listeners can be closed. Later calls do nothing.
+func Ready() {
+	fd, ok := readyFD()
+	if !ok {
+		return
+	}
+	os.Unsetenv(readyEnv)
+	f := os.NewFile(uintptr(fd), "handoff")
+	_, _ = f.Write([]byte{1})
+	_ = f.Close()
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package handoff
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// Signal is the signal that asks a running instance to hand over to a new
+// process, or nil where there is none.
+var Signal os.Signal
+
+// Successor is the process an instance has handed over to.
+type Successor struct{}
+
+// Start is not supported on this platform.
+func Start(time.Duration) (*Successor, error) {
+	return nil, errors.New("listener handoff is not supported on this platform")
+}
+
+// Pid returns the process ID of the successor.
+func (s *Successor) Pid() int { return 0 }
+
+// Signal forwards sig to the successor.
+func (s *Successor) Signal(os.Signal) error { return nil }
+
+// Wait returns the exit error of the successor once it has exited.
+func (s *Successor) Wait() <-chan error { return nil }
+
+// Ready does nothing on this platform.
+func Ready() {}
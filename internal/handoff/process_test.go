@@ -0,0 +1,35 @@
+//go:build unix
+
+package handoff
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain plays the new process when the test binary is started by Start.
+func TestMain(m *testing.M) {
+	if _, ok := readyFD(); ok {
+		if os.Getenv("HANDOFF_TEST_FAIL") == "" {
+			Ready()
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStart(t *testing.T) {
+	s, err := Start(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-s.Wait(); err != nil {
+		t.Fatalf("successor: %v", err)
+	}
+
+	t.Setenv("HANDOFF_TEST_FAIL", "1")
+	if _, err := Start(10 * time.Second); err == nil {
+		t.Fatal("a process that exited without calling Ready was taken as ready")
+	}
+}
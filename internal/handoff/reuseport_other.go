@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package handoff
+
+import "syscall"
+
+// SO_REUSEADDR on Windows lets any process take over a bound port, so
+// nothing is set here and a handoff fails to bind.
+const supported = false
+
+func control(string, string, syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,327 @@
+// Package httprewrite changes the headers of plain (non-CONNECT) HTTP proxy
+// requests before they leave through the pool, so that nothing a client or
+// an earlier proxy added can identify it to the target.
+package httprewrite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"easy_proxies/internal/users"
+)
+
+// DefaultRemove lists the headers that carry client addresses or the proxy
+// chain. They are always removed.
+var DefaultRemove = []string{
+	"Via",
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"X-Cluster-Client-Ip",
+	"Client-Ip",
+	"True-Client-Ip",
+}
+
+// maxReplyHead bounds the CONNECT reply buffered while it is swallowed.
+const maxReplyHead = 16 * 1024
+
+var errReplyTooLarge = errors.New("httprewrite: CONNECT reply header too large")
+
+// Rules describes how requests are rewritten. A nil *Rules changes nothing.
+type Rules struct {
+	Remove []string          // removed in addition to DefaultRemove
+	Set    map[string]string // added, replacing any value sent by the client
+	// GroupSet adds headers to requests pinned to a node group (or to a
+	// node of that group); keys are group names, matched case-insensitively.
+	GroupSet map[string]map[string]string
+	// GroupOf returns the group of a node tag or name.
+	GroupOf func(node string) string
+	// ForceConnect sends each plain http:// request through a CONNECT
+	// tunnel of its own instead of letting the proxy forward it, so the
+	// target receives exactly the rewritten request.
+	ForceConnect bool
+}
+
+// Apply rewrites the headers of a request pinned by pin.
+func (r *Rules) Apply(h http.Header, pin users.Pin) {
+	if r == nil {
+		return
+	}
+	keepUserAgent(h)
+	for _, name := range DefaultRemove {
+		h.Del(name)
+	}
+	for _, name := range r.Remove {
+		h.Del(name)
+	}
+	for name, value := range r.Set {
+		h.Set(name, value)
+	}
+	if group := r.group(pin); group != "" {
+		for g, headers := range r.GroupSet {
+			if strings.EqualFold(g, group) {
+				for name, value := range headers {
+					h.Set(name, value)
+				}
+			}
+		}
+	}
+}
+
+func (r *Rules) group(pin users.Pin) string {
+	if pin.Group != "" {
+		return pin.Group
+	}
+	if pin.Node != "" && r.GroupOf != nil {
+		return r.GroupOf(pin.Node)
+	}
+	return ""
+}
+
+// Wrap returns client as the entry inbound should see it: plain HTTP
+// requests read from it are rewritten, while SOCKS, CONNECT tunnels and
+// upgraded connections pass through unchanged. Pins are read from the
+// username suffix in Proxy-Authorization.
+func (r *Rules) Wrap(client net.Conn) net.Conn {
+	return (&Front{Rules: r}).Wrap(client)
+}
+
+// DivertFunc may answer a plain request itself instead of the entry
+// inbound, writing the response to client. It reports whether it did, and
+// must leave req.Body unread when it did not; io.EOF ends the connection
+// after the response.
+type DivertFunc func(req *http.Request, client net.Conn) (bool, error)
+
+// Front is what stands between a client and the entry inbound: it rewrites
+// plain HTTP requests with Rules and offers them to Divert. The pinning and
+// tag headers (users.NodeHeader, users.GroupHeader, users.TagHeader) are
+// removed from every request, since the inbound would forward them to the
+// target.
+type Front struct {
+	Rules  *Rules     // nil leaves headers alone
+	Divert DivertFunc // nil passes every request to the inbound
+	// PinHeaders moves the pin of the pinning headers into the
+	// Proxy-Authorization username ("alice-node-tokyo1"), which the
+	// inbound accepts with listener.node_pinning. Requests without
+	// credentials cannot be pinned this way.
+	PinHeaders bool
+}
+
+// Wrap is Rules.Wrap for f.
+func (f *Front) Wrap(client net.Conn) net.Conn {
+	pr, pw := io.Pipe()
+	c := &conn{Conn: client, r: pr}
+	go func() {
+		err := f.copyRequests(bufio.NewReader(client), pw, c)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		pw.CloseWithError(err)
+	}()
+	return c
+}
+
+// copyRequests copies the client stream to w, rewriting the requests it
+// can parse and leaving out those answered by f.Divert.
+func (f *Front) copyRequests(br *bufio.Reader, w io.Writer, c *conn) error {
+	first, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] == 4 || first[0] == 5 { // SOCKS4 / SOCKS5
+		_, err = io.Copy(w, br)
+		return err
+	}
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return err
+		}
+		keepUserAgent(req.Header)
+		pin := f.takePin(req.Header)
+		if req.Method == http.MethodConnect {
+			if err := req.Write(w); err != nil {
+				return err
+			}
+			_, err = io.Copy(w, br)
+			return err
+		}
+		upgrade := strings.EqualFold(req.Header.Get("Connection"), "upgrade")
+		f.Rules.Apply(req.Header, pin)
+		if f.Divert != nil && !upgrade {
+			handled, err := f.Divert(req, c)
+			if err != nil {
+				return err
+			}
+			if handled {
+				continue
+			}
+		}
+		if f.Rules != nil && f.Rules.ForceConnect && req.URL.Scheme == "http" {
+			return f.Rules.tunnel(req, br, w, c)
+		}
+		if err := req.WriteProxy(w); err != nil {
+			return err
+		}
+		if upgrade {
+			_, err = io.Copy(w, br)
+			return err
+		}
+	}
+}
+
+// tunnel sends req through a CONNECT to its host. The target closes the
+// tunnel after answering, so the client opens a new connection for its
+// next request.
+func (r *Rules) tunnel(req *http.Request, br *bufio.Reader, w io.Writer, c *conn) error {
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		host = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	var head strings.Builder
+	head.WriteString("CONNECT " + host + " HTTP/1.1\r\nHost: " + host + "\r\n")
+	if auth := req.Header.Get("Proxy-Authorization"); auth != "" {
+		head.WriteString("Proxy-Authorization: " + auth + "\r\n")
+	}
+	head.WriteString("\r\n")
+	req.Header.Del("Proxy-Authorization")
+	req.Header.Del("Proxy-Connection")
+	req.Close = true
+
+	c.swallowReply()
+	if _, err := io.WriteString(w, head.String()); err != nil {
+		return err
+	}
+	if err := req.Write(w); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, br)
+	return err
+}
+
+// keepUserAgent stops Request.Write and http.Transport from adding Go's
+// default User-Agent to requests that had none.
+func keepUserAgent(h http.Header) {
+	if _, ok := h["User-Agent"]; !ok {
+		h["User-Agent"] = []string{""}
+	}
+}
+
+// takePin removes the pinning and tag headers from h and returns the pin
+// the request is sent with: the headers' one when PinHeaders moved it into
+// the username, else the one already in the username.
+func (f *Front) takePin(h http.Header) users.Pin {
+	pin := users.Pin{
+		Node:  strings.TrimSpace(h.Get(users.NodeHeader)),
+		Group: strings.TrimSpace(h.Get(users.GroupHeader)),
+	}
+	h.Del(users.NodeHeader)
+	h.Del(users.GroupHeader)
+	h.Del(users.TagHeader)
+	authorization := h.Get("Proxy-Authorization")
+	if !pin.IsZero() && f.PinHeaders {
+		if username, password, ok := basicAuth(authorization); ok {
+			name, tag := users.SplitTag(username)
+			account, _ := users.SplitPinned(name)
+			username = users.TaggedUsername(users.PinnedUsername(account, pin), tag)
+			h.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+			return pin
+		}
+	}
+	return pinFromAuth(authorization)
+}
+
+// pinFromAuth returns the pin encoded in a Basic Proxy-Authorization
+// username, e.g. "alice-group-jp".
+func pinFromAuth(header string) users.Pin {
+	username, _, ok := basicAuth(header)
+	if !ok {
+		return users.Pin{}
+	}
+	_, pin := users.SplitPinned(username)
+	return pin
+}
+
+// basicAuth decodes a Basic Proxy-Authorization header.
+func basicAuth(header string) (username, password string, ok bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// conn is the client connection seen by the inbound: reads come from the
+// rewritten stream, writes go to the client.
+type conn struct {
+	net.Conn
+	r *io.PipeReader
+
+	mu      sync.Mutex
+	swallow bool   // the next response is the reply to a CONNECT added by tunnel
+	reply   []byte // that reply, until its header is complete
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *conn) Close() error {
+	_ = c.r.Close()
+	return c.Conn.Close()
+}
+
+func (c *conn) swallowReply() {
+	c.mu.Lock()
+	c.swallow = true
+	c.mu.Unlock()
+}
+
+// Write hides a successful reply to the CONNECT added by tunnel; the client
+// sent a plain request and expects only the target's response. Any other
+// reply, e.g. 407, is passed on.
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.swallow {
+		return c.Conn.Write(b)
+	}
+	c.reply = append(c.reply, b...)
+	end := bytes.Index(c.reply, []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(c.reply) > maxReplyHead {
+			return 0, errReplyTooLarge
+		}
+		return len(b), nil
+	}
+	out := c.reply
+	if isConnected(c.reply[:end]) {
+		out = c.reply[end+4:]
+	}
+	c.swallow, c.reply = false, nil
+	if len(out) > 0 {
+		if _, err := c.Conn.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// isConnected reports whether a response header is "HTTP/1.x 200 ...".
+func isConnected(head []byte) bool {
+	return len(head) >= 12 && bytes.HasPrefix(head, []byte("HTTP/1.")) && head[8] == ' ' && string(head[9:12]) == "200"
+}
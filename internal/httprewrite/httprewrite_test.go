@@ -0,0 +1,165 @@
+package httprewrite
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve wraps one end of a pipe, writes raw to the client end and returns a
+// reader over what the inbound would read.
+func serve(t *testing.T, rules *Rules, raw string) (net.Conn, net.Conn, *bufio.Reader) {
+	t.Helper()
+	client, server := net.Pipe()
+	wrapped := rules.Wrap(server)
+	t.Cleanup(func() {
+		client.Close()
+		wrapped.Close()
+	})
+	go io.WriteString(client, raw)
+	return client, wrapped, bufio.NewReader(wrapped)
+}
+
+func TestPlainRequestsAreRewritten(t *testing.T) {
+	rules := &Rules{
+		Remove:   []string{"X-Trace"},
+		Set:      map[string]string{"Accept-Language": "en"},
+		GroupSet: map[string]map[string]string{"JP": {"Accept-Language": "ja"}},
+		GroupOf:  func(node string) string { return map[string]string{"tokyo1": "jp"}[node] },
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("alice-node-tokyo1:secret"))
+	_, _, inbound := serve(t, rules,
+		"GET http://example.com/a HTTP/1.1\r\nHost: example.com\r\nVia: 1.1 corp\r\nX-Forwarded-For: 10.0.0.7\r\nX-Trace: 1\r\n\r\n"+
+			"POST http://example.com/b HTTP/1.1\r\nHost: example.com\r\nProxy-Authorization: Basic "+auth+"\r\nContent-Length: 2\r\n\r\nok")
+
+	first, err := http.ReadRequest(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RequestURI != "http://example.com/a" {
+		t.Fatalf("the proxy form should be kept, got %q", first.RequestURI)
+	}
+	for _, name := range []string{"Via", "X-Forwarded-For", "X-Trace", "User-Agent"} {
+		if _, ok := first.Header[name]; ok {
+			t.Errorf("%s should not be forwarded: %v", name, first.Header)
+		}
+	}
+	if got := first.Header.Get("Accept-Language"); got != "en" {
+		t.Errorf("Accept-Language = %q, want en", got)
+	}
+
+	second, err := http.ReadRequest(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := second.Header.Get("Accept-Language"); got != "ja" {
+		t.Errorf("a request pinned to a jp node should get the group headers, got %q", got)
+	}
+	if body, _ := io.ReadAll(second.Body); string(body) != "ok" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestTunnelsPassThrough(t *testing.T) {
+	for name, raw := range map[string]string{
+		"connect": "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\nX-Forwarded-For: raw tunnel bytes",
+		"socks5":  "\x05\x01\x00X-Forwarded-For: raw",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, inbound := serve(t, &Rules{}, raw)
+			if name == "connect" {
+				req, err := http.ReadRequest(inbound)
+				if err != nil || req.Method != http.MethodConnect || req.Host != "example.com:443" {
+					t.Fatalf("unexpected CONNECT %+v (err=%v)", req, err)
+				}
+				raw = raw[strings.Index(raw, "\r\n\r\n")+4:]
+			}
+			got := make([]byte, len(raw))
+			if _, err := io.ReadFull(inbound, got); err != nil || string(got) != raw {
+				t.Fatalf("tunnel bytes changed: %q (err=%v)", got, err)
+			}
+		})
+	}
+}
+
+func TestForceConnect(t *testing.T) {
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+	client, wrapped, inbound := serve(t, &Rules{ForceConnect: true},
+		"GET http://example.com/a HTTP/1.1\r\nHost: example.com\r\nProxy-Authorization: "+auth+"\r\nProxy-Connection: keep-alive\r\nVia: 1.1 corp\r\n\r\n")
+
+	connect, err := http.ReadRequest(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connect.Method != http.MethodConnect || connect.Host != "example.com:80" || connect.Header.Get("Proxy-Authorization") != auth {
+		t.Fatalf("unexpected CONNECT %s %s %v", connect.Method, connect.Host, connect.Header)
+	}
+	req, err := http.ReadRequest(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.RequestURI != "/a" || !req.Close || req.Header.Get("Via") != "" || req.Header.Get("Proxy-Authorization") != "" {
+		t.Fatalf("unexpected tunnelled request %s %v", req.RequestURI, req.Header)
+	}
+
+	// The inbound's CONNECT reply is hidden from the client, which only sees
+	// the target's response.
+	go func() {
+		io.WriteString(wrapped, "HTTP/1.1 200 Connection established\r\n")
+		io.WriteString(wrapped, "\r\nHTTP/1.1 204 No Content\r\n\r\n")
+	}()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("client should see the 204, got %+v (err=%v)", resp, err)
+	}
+}
+
+func TestPinHeaders(t *testing.T) {
+	basic := func(userpass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userpass))
+	}
+	read := func(front *Front, raw string) *http.Request {
+		t.Helper()
+		client, server := net.Pipe()
+		wrapped := front.Wrap(server)
+		t.Cleanup(func() {
+			client.Close()
+			wrapped.Close()
+		})
+		go io.WriteString(client, raw)
+		req, err := http.ReadRequest(bufio.NewReader(wrapped))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	plain := "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\nProxy-Authorization: " + basic("alice-group-us-tag-job1:secret") +
+		"\r\nX-Proxy-Node: tokyo1\r\nX-Proxy-Tag: job2\r\n\r\n"
+	req := read(&Front{PinHeaders: true}, plain)
+	if got := req.Header.Get("Proxy-Authorization"); got != basic("alice-node-tokyo1-tag-job1:secret") {
+		t.Errorf("the header pin should replace the username pin, got %q", got)
+	}
+	for _, name := range []string{"X-Proxy-Node", "X-Proxy-Tag"} {
+		if _, ok := req.Header[name]; ok {
+			t.Errorf("%s should not be forwarded", name)
+		}
+	}
+
+	connect := "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\nProxy-Authorization: " + basic("alice:secret") + "\r\nX-Proxy-Group: jp\r\n\r\n"
+	if got := read(&Front{PinHeaders: true}, connect).Header.Get("Proxy-Authorization"); got != basic("alice-group-jp:secret") {
+		t.Errorf("CONNECT not pinned, got %q", got)
+	}
+
+	// Without PinHeaders the headers are still removed, the username is kept.
+	req = read(&Front{}, plain)
+	if req.Header.Get("X-Proxy-Node") != "" || req.Header.Get("Proxy-Authorization") != basic("alice-group-us-tag-job1:secret") {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+}
@@ -0,0 +1,206 @@
+// Package httproute sends plain (non-CONNECT) HTTP proxy requests that
+// match a rule by method and Host header through the rule's target, one
+// request at a time, so requests sharing a client connection can take
+// different routes.
+package httproute
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"easy_proxies/internal/accesslog"
+	"easy_proxies/internal/proxyerr"
+	"easy_proxies/internal/users"
+)
+
+const dialTimeout = 30 * time.Second
+
+// Dialer opens connections through a rule target.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Rule matches requests whose method is one of Methods and whose host
+// matches DomainSuffix or DomainKeyword (any host when both are empty).
+type Rule struct {
+	Methods       []string
+	DomainSuffix  []string
+	DomainKeyword []string
+	Target        string
+}
+
+// Router diverts the requests matched by Rules, first match wins.
+type Router struct {
+	Rules []Rule
+	// Dialer returns the dialer of a rule target, or false when the target
+	// is not available; the request then takes the usual route.
+	Dialer func(target string) (Dialer, bool)
+	// Users are the accepted credentials; empty disables proxy auth.
+	// Requests that fail auth are left to the entry inbound to reject.
+	Users map[string]string
+	// ErrorDetail answers failed requests with a JSON body and headers
+	// naming the nodes tried, the error class and a retry hint.
+	ErrorDetail bool
+}
+
+// Match returns the first rule matching req.
+func (r *Router) Match(req *http.Request) (Rule, bool) {
+	host := strings.ToLower(strings.TrimSuffix(req.URL.Hostname(), "."))
+	for _, rule := range r.Rules {
+		if slices.Contains(rule.Methods, req.Method) && rule.matchesHost(host) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (rule Rule) matchesHost(host string) bool {
+	if len(rule.DomainSuffix) == 0 && len(rule.DomainKeyword) == 0 {
+		return true
+	}
+	for _, suffix := range rule.DomainSuffix {
+		suffix = strings.ToLower(strings.TrimSpace(suffix))
+		if strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	for _, keyword := range rule.DomainKeyword {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" && strings.Contains(host, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Divert implements httprewrite.DivertFunc: a matched request is sent to its
+// host through the rule's target on a connection of its own, and the
+// response is written to client.
+func (r *Router) Divert(req *http.Request, client net.Conn) (bool, error) {
+	if r == nil || req.URL.Scheme != "http" || req.URL.Host == "" {
+		return false, nil
+	}
+	rule, ok := r.Match(req)
+	if !ok {
+		return false, nil
+	}
+	username, pin, tag, ok := r.authenticate(req.Header.Get("Proxy-Authorization"))
+	if !ok {
+		return false, nil
+	}
+	if header := users.CleanTag(req.Header.Get(users.TagHeader)); header != "" {
+		tag = header
+	}
+	dialer, ok := r.Dialer(rule.Target)
+	if !ok {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = accesslog.WithClient(ctx, client.RemoteAddr().String())
+	if username != "" {
+		ctx = users.WithUser(ctx, username)
+	}
+	ctx = users.WithPin(ctx, pin)
+	ctx = accesslog.WithTag(ctx, tag)
+
+	address := req.URL.Host
+	if req.URL.Port() == "" {
+		address = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	dialCtx, dialCancel := context.WithTimeout(ctx, dialTimeout)
+	upstream, err := dialer.DialContext(dialCtx, "tcp", address)
+	dialCancel()
+	if err != nil {
+		log.Printf("⚠️ HTTP rule → %s: dial %s: %v", rule.Target, address, err)
+		return true, r.badGateway(client, req, err)
+	}
+	defer upstream.Close()
+
+	req.Header.Del("Proxy-Authorization")
+	req.Header.Del("Proxy-Connection")
+	req.Header.Del(users.TagHeader)
+	if err := req.Write(upstream); err != nil {
+		return true, r.badGateway(client, req, err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(upstream), req)
+	if err != nil {
+		return true, r.badGateway(client, req, err)
+	}
+	defer resp.Body.Close()
+	// The upstream connection is not reused, but the client's may be.
+	resp.Close = req.Close
+	if err := resp.Write(client); err != nil {
+		return true, err
+	}
+	if req.Close {
+		return true, io.EOF
+	}
+	return true, nil
+}
+
+// authenticate checks a Basic Proxy-Authorization header against r.Users
+// and returns the account with the pin and connection tag encoded in its
+// username.
+func (r *Router) authenticate(header string) (string, users.Pin, string, bool) {
+	if len(r.Users) == 0 {
+		return "", users.Pin{}, "", true
+	}
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", users.Pin{}, "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", users.Pin{}, "", false
+	}
+	name, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", users.Pin{}, "", false
+	}
+	name, tag := users.SplitTag(name)
+	username, pin := users.SplitPinned(name)
+	if want, ok := r.Users[username]; !ok || want != password {
+		return "", users.Pin{}, "", false
+	}
+	return username, pin, tag, true
+}
+
+// badGateway answers req with a 502. The request body may be partly read,
+// so the client connection is closed afterwards.
+func (r *Router) badGateway(client net.Conn, req *http.Request, cause error) error {
+	body := fmt.Sprintf("Request failed: %v\n", cause)
+	header := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+	if r.ErrorDetail {
+		body = string(proxyerr.Body(cause))
+		header.Set("Content-Type", "application/json")
+		proxyerr.Header(header, cause)
+	}
+	resp := &http.Response{
+		StatusCode:    http.StatusBadGateway,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		Close:         true,
+	}
+	if err := resp.Write(client); err != nil {
+		return err
+	}
+	return io.EOF
+}
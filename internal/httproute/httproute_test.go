@@ -0,0 +1,216 @@
+package httproute
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"easy_proxies/internal/accesslog"
+	"easy_proxies/internal/httprewrite"
+	"easy_proxies/internal/proxyerr"
+	"easy_proxies/internal/users"
+)
+
+func TestMatch(t *testing.T) {
+	router := &Router{Rules: []Rule{
+		{Methods: []string{"POST", "PUT"}, DomainSuffix: []string{"api.example.com"}, Target: "sticky"},
+		{Methods: []string{"DELETE"}, DomainKeyword: []string{"admin"}, Target: "dc"},
+		{Methods: []string{"PATCH"}, Target: "direct"},
+	}}
+	tests := []struct {
+		method, url, want string
+	}{
+		{"POST", "http://api.example.com/v1", "sticky"},
+		{"PUT", "http://eu.api.example.com:8080/v1", "sticky"},
+		{"GET", "http://api.example.com/v1", ""},
+		{"POST", "http://notapi.example.com/", ""},
+		{"DELETE", "http://admin.example.org/", "dc"},
+		{"PATCH", "http://anything.test/", "direct"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		rule, ok := router.Match(req)
+		if got := rule.Target; got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s %s: got %q (%v), want %q", tt.method, tt.url, got, ok, tt.want)
+		}
+	}
+}
+
+// recordingDialer dials the origin and records the context of each dial.
+type recordingDialer struct {
+	mu   sync.Mutex
+	ctxs []context.Context
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.ctxs = append(d.ctxs, ctx)
+	d.mu.Unlock()
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+
+func TestDivertSendsMatchedRequestsThroughTarget(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Errorf("Proxy-Authorization reached the origin")
+		}
+		io.WriteString(w, r.Method+" "+string(body))
+	}))
+	defer origin.Close()
+	originHost := strings.TrimPrefix(origin.URL, "http://")
+
+	dialer := &recordingDialer{}
+	router := &Router{
+		Rules: []Rule{{Methods: []string{"POST"}, Target: "sticky"}},
+		Dialer: func(target string) (Dialer, bool) {
+			return dialer, target == "sticky"
+		},
+		Users: map[string]string{"alice": "secret"},
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("alice-group-jp-tag-job42:secret"))
+
+	client, server := net.Pipe()
+	defer client.Close()
+	wrapped := (&httprewrite.Front{Divert: router.Divert}).Wrap(server)
+	defer wrapped.Close()
+	inbound := bufio.NewReader(wrapped)
+
+	go io.WriteString(client,
+		"POST http://"+originHost+"/submit HTTP/1.1\r\nHost: "+originHost+"\r\nProxy-Authorization: Basic "+auth+"\r\nContent-Length: 4\r\n\r\ndata"+
+			"GET http://"+originHost+"/list HTTP/1.1\r\nHost: "+originHost+"\r\nProxy-Authorization: Basic "+auth+"\r\n\r\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "POST data" {
+		t.Fatalf("diverted response: %d %q", resp.StatusCode, body)
+	}
+
+	// The GET is not matched and reaches the inbound unchanged.
+	req, err := http.ReadRequest(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodGet || req.Header.Get("Proxy-Authorization") == "" {
+		t.Fatalf("unexpected request at the inbound: %s %v", req.Method, req.Header)
+	}
+
+	dialer.mu.Lock()
+	defer dialer.mu.Unlock()
+	if len(dialer.ctxs) != 1 {
+		t.Fatalf("expected one dial through the target, got %d", len(dialer.ctxs))
+	}
+	ctx := dialer.ctxs[0]
+	if got := users.FromContext(ctx); got != "alice" {
+		t.Errorf("user = %q, want alice", got)
+	}
+	if got := users.PinFromContext(ctx); got.Group != "jp" {
+		t.Errorf("pin = %+v, want group jp", got)
+	}
+	if got := accesslog.TagFromContext(ctx); got != "job42" {
+		t.Errorf("tag = %q, want job42", got)
+	}
+}
+
+func TestDivertLeavesUnauthenticatedRequests(t *testing.T) {
+	router := &Router{
+		Rules:  []Rule{{Methods: []string{"POST"}, Target: "sticky"}},
+		Dialer: func(string) (Dialer, bool) { t.Fatal("must not dial"); return nil, false },
+		Users:  map[string]string{"alice": "secret"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("x"))
+	handled, err := router.Divert(req, nil)
+	if handled || err != nil {
+		t.Fatalf("expected the inbound to answer, got %v %v", handled, err)
+	}
+}
+
+func TestDivertAnswersDialErrors(t *testing.T) {
+	router := &Router{
+		Rules: []Rule{{Methods: []string{"POST"}, Target: "dc"}},
+		Dialer: func(string) (Dialer, bool) {
+			return failingDialer{}, true
+		},
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("x"))
+	done := make(chan error, 1)
+	go func() {
+		_, err := router.Divert(req, server)
+		done <- err
+	}()
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || !resp.Close {
+		t.Fatalf("expected a closing 502, got %d close=%v", resp.StatusCode, resp.Close)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	if err := <-done; err != io.EOF {
+		t.Fatalf("expected the connection to end, got %v", err)
+	}
+}
+
+type failingDialer struct{}
+
+func (failingDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, io.ErrUnexpectedEOF
+}
+
+func TestDivertErrorDetail(t *testing.T) {
+	router := &Router{
+		Rules: []Rule{{Methods: []string{"POST"}, Target: "dc"}},
+		Dialer: func(string) (Dialer, bool) {
+			return poolFailingDialer{}, true
+		},
+		ErrorDetail: true,
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("x"))
+	go router.Divert(req, server)
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Proxy-Error"); got != proxyerr.ClassTimeout {
+		t.Errorf("X-Proxy-Error = %q, want %q", got, proxyerr.ClassTimeout)
+	}
+	if got := resp.Header.Get("X-Proxy-Nodes-Tried"); got != "jp-1,jp-2" {
+		t.Errorf("X-Proxy-Nodes-Tried = %q", got)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	var detail proxyerr.Detail
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if detail.Class != proxyerr.ClassTimeout || len(detail.NodesTried) != 2 {
+		t.Errorf("detail = %+v", detail)
+	}
+}
+
+type poolFailingDialer struct{}
+
+func (poolFailingDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, proxyerr.New(errors.New("dial tcp 203.0.113.1:443: i/o timeout"), []string{"jp-1", "jp-2"}, "")
+}
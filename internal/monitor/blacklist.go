@@ -0,0 +1,212 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/clock"
+)
+
+// blacklistSaveInterval is how often changed blacklist state is written to
+// the blacklist file.
+const blacklistSaveInterval = 30 * time.Second
+
+// BlacklistEntry is one blacklisted node. The list is persisted so a restart
+// does not put known-dead nodes straight back into rotation.
+type BlacklistEntry struct {
+	Tag    string    `json:"tag"`
+	Name   string    `json:"name"`
+	URI    string    `json:"uri"`
+	Until  time.Time `json:"until"`
+	Manual bool      `json:"manual"` // set through the API rather than by failures
+	// SavedAt is when the entry was written to the blacklist file. If the
+	// wall clock is behind it on restore, the clock was set back and the
+	// time left is taken from Until - SavedAt instead.
+	SavedAt time.Time `json:"saved_at,omitempty"`
+}
+
+type blacklistStore struct {
+	mu        sync.Mutex
+	path      string
+	lastSaved []byte
+	loop      sync.Once
+}
+
+// SetBlacklistFile sets where blacklist state is persisted and starts saving
+// it in the background. An empty path disables persistence.
+func (m *Manager) SetBlacklistFile(path string) {
+	m.blacklist.mu.Lock()
+	if m.blacklist.path != path {
+		m.blacklist.path = path
+		m.blacklist.lastSaved = nil
+	}
+	m.blacklist.mu.Unlock()
+	if path == "" {
+		return
+	}
+	m.blacklist.loop.Do(func() {
+		go func() {
+			ticker := time.NewTicker(blacklistSaveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case <-ticker.C:
+					if err := m.SaveBlacklist(); err != nil && m.logger != nil {
+						m.logger.Warn("save blacklist: ", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Blacklist lists the nodes currently blacklisted, soonest expiry first.
+func (m *Manager) Blacklist() []BlacklistEntry {
+	now := clock.Now()
+	m.mu.RLock()
+	list := make([]BlacklistEntry, 0)
+	for _, e := range m.nodes {
+		e.mu.RLock()
+		if e.blacklist && e.until.After(now) {
+			list = append(list, BlacklistEntry{
+				Tag:  e.info.Tag,
+				Name: e.info.Name,
+				URI:  e.info.URI,
+				// Rounded so the wall time is steady between calls.
+				Until:  clock.Wall(e.until).Round(time.Second),
+				Manual: e.manual,
+			})
+		}
+		e.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Until.Equal(list[j].Until) {
+			return list[i].Until.Before(list[j].Until)
+		}
+		return list[i].Tag < list[j].Tag
+	})
+	return list
+}
+
+// ReleaseAll clears the blacklist of every node and returns how many were
+// released.
+func (m *Manager) ReleaseAll() int {
+	released := 0
+	for _, item := range m.Blacklist() {
+		if m.Release(item.Tag) == nil {
+			released++
+		}
+	}
+	return released
+}
+
+// SaveBlacklist writes the current blacklist to the blacklist file if it
+// changed since the last save.
+func (m *Manager) SaveBlacklist() error {
+	list := m.Blacklist()
+	current, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	m.blacklist.mu.Lock()
+	defer m.blacklist.mu.Unlock()
+	path := m.blacklist.path
+	if path == "" || bytes.Equal(current, m.blacklist.lastSaved) {
+		return nil
+	}
+	savedAt := time.Now().Round(time.Second)
+	for i := range list {
+		list[i].SavedAt = savedAt
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	m.blacklist.lastSaved = current
+	return nil
+}
+
+// RestoreBlacklist re-applies the saved blacklist to the registered nodes.
+// A saved entry matches a node with the same tag and URI, or else the same
+// URI, so renamed nodes keep their state. Expired entries are skipped.
+// It returns the number of nodes blacklisted.
+func (m *Manager) RestoreBlacklist() (int, error) {
+	m.blacklist.mu.Lock()
+	path := m.blacklist.path
+	m.blacklist.mu.Unlock()
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var saved []BlacklistEntry
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	m.mu.RLock()
+	byURI := make(map[string]*entry, len(m.nodes))
+	for _, e := range m.nodes {
+		byURI[e.info.URI] = e
+	}
+	targets := make([]*entry, len(saved))
+	for i, item := range saved {
+		if e, ok := m.nodes[item.Tag]; ok && e.info.URI == item.URI {
+			targets[i] = e
+		} else {
+			targets[i] = byURI[item.URI]
+		}
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+	restored := 0
+	for i, item := range saved {
+		e := targets[i]
+		remaining := item.Until.Sub(now)
+		if !item.SavedAt.IsZero() && now.Before(item.SavedAt) {
+			remaining = item.Until.Sub(item.SavedAt)
+		}
+		if e == nil || remaining <= 0 {
+			continue
+		}
+		e.mu.RLock()
+		fn := e.blacklistFn
+		e.mu.RUnlock()
+		if fn != nil {
+			fn(remaining)
+		}
+		e.blacklistUntil(clock.Now().Add(remaining))
+		e.mu.Lock()
+		e.manual = item.Manual
+		e.mu.Unlock()
+		restored++
+	}
+	return restored, nil
+}
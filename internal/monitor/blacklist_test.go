@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlacklistPersistsAcrossManagers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+
+	first, _ := NewManager(Config{})
+	defer first.Stop()
+	first.SetBlacklistFile(path)
+	first.Register(NodeInfo{Tag: "a", Name: "A", URI: "socks5://a:1080"})
+	first.Register(NodeInfo{Tag: "b", Name: "B", URI: "socks5://b:1080"})
+	first.Register(NodeInfo{Tag: "c", Name: "C", URI: "socks5://c:1080"}).Blacklist(time.Now().Add(-time.Minute))
+	if err := first.ManualBlacklist("a", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	first.Register(NodeInfo{Tag: "b", Name: "B", URI: "socks5://b:1080"}).Blacklist(time.Now().Add(2 * time.Hour))
+
+	list := first.Blacklist()
+	if len(list) != 2 || list[0].Tag != "a" || !list[0].Manual || list[1].Tag != "b" || list[1].Manual {
+		t.Fatalf("unexpected blacklist %+v", list)
+	}
+	if err := first.SaveBlacklist(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := NewManager(Config{})
+	defer second.Stop()
+	second.SetBlacklistFile(path)
+	var applied time.Duration
+	// Node "a" was renamed: it is matched by URI.
+	second.Register(NodeInfo{Tag: "renamed", URI: "socks5://a:1080"}).SetBlacklistFn(func(d time.Duration) { applied = d })
+	second.Register(NodeInfo{Tag: "c", URI: "socks5://c:1080"})
+
+	restored, err := second.RestoreBlacklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 1 {
+		t.Fatalf("restored %d nodes, want 1", restored)
+	}
+	if applied <= 50*time.Minute || applied > time.Hour {
+		t.Fatalf("pool blacklist applied for %s, want about 1h", applied)
+	}
+	list = second.Blacklist()
+	if len(list) != 1 || list[0].Tag != "renamed" || !list[0].Manual {
+		t.Fatalf("unexpected restored blacklist %+v", list)
+	}
+
+	if n := second.ReleaseAll(); n != 0 {
+		t.Fatalf("released %d nodes without a release func, want 0", n)
+	}
+}
+
+func TestRestoreBlacklistAfterClockSetBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+	// Written by a run whose wall clock was a day ahead of the current one.
+	savedAt := time.Now().Add(24 * time.Hour).UTC()
+	saved := []BlacklistEntry{{Tag: "a", URI: "socks5://a:1080", Until: savedAt.Add(30 * time.Minute), SavedAt: savedAt}}
+	data, _ := json.Marshal(saved)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := NewManager(Config{})
+	defer m.Stop()
+	m.SetBlacklistFile(path)
+	var applied time.Duration
+	m.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"}).SetBlacklistFn(func(d time.Duration) { applied = d })
+	if n, err := m.RestoreBlacklist(); err != nil || n != 1 {
+		t.Fatalf("RestoreBlacklist = %d, %v", n, err)
+	}
+	if applied != 30*time.Minute {
+		t.Fatalf("pool blacklist applied for %s, want the 30m left when it was saved", applied)
+	}
+	list := m.Blacklist()
+	if len(list) != 1 || time.Until(list[0].Until) > 31*time.Minute {
+		t.Fatalf("unexpected restored blacklist %+v", list)
+	}
+}
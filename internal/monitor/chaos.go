@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"easy_proxies/internal/chaos"
+)
+
+// chaosFault is a fault as shown and accepted by /api/chaos.
+type chaosFault struct {
+	Node         string    `json:"node,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	FailRate     float64   `json:"fail_rate"`
+	Latency      string    `json:"latency,omitempty"`
+	ThrottleKBps int64     `json:"throttle_kbps,omitempty"`
+	Duration     string    `json:"duration,omitempty"` // request only: how long the fault lasts
+	Until        time.Time `json:"until,omitempty"`
+}
+
+// handleChaos serves the fault injection API, which only exists when the
+// process was started with -chaos:
+//
+//	GET    /api/chaos         list the faults in effect
+//	DELETE /api/chaos         clear every fault
+//	PUT    /api/chaos/{node}  set the fault of a node (tag or name)
+//	DELETE /api/chaos/{node}  clear it
+func (s *Server) handleChaos(w http.ResponseWriter, r *http.Request) {
+	if !chaos.Enabled() {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": "未启用故障注入，请以 -chaos 参数启动"})
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/chaos"), "/")
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			list := chaos.List()
+			faults := make([]chaosFault, 0, len(list))
+			for _, e := range list {
+				f := chaosFault{Node: e.Node, FailRate: e.FailRate, ThrottleKBps: e.ThrottleKBps, Until: e.Until}
+				if info, ok := s.mgr.nodeInfo(e.Node); ok {
+					f.Name = info.Name
+				}
+				if e.Latency > 0 {
+					f.Latency = e.Latency.String()
+				}
+				faults = append(faults, f)
+			}
+			writeJSON(w, map[string]any{"faults": faults})
+		case http.MethodDelete:
+			chaos.ClearAll()
+			s.logger.Printf("🧪 [chaos] all faults cleared")
+			writeJSON(w, map[string]any{"message": "已清除全部故障"})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	info, ok := s.mgr.nodeInfo(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": ErrNodeNotFound.Error()})
+		return
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var req chaosFault
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "请求格式错误"})
+			return
+		}
+		fault := chaos.Fault{FailRate: req.FailRate, ThrottleKBps: req.ThrottleKBps}
+		if req.Latency != "" {
+			latency, err := time.ParseDuration(req.Latency)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]any{"error": "无效的 latency"})
+				return
+			}
+			fault.Latency = latency
+		}
+		if req.Duration != "" {
+			duration, err := time.ParseDuration(req.Duration)
+			if err != nil || duration <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]any{"error": "无效的 duration"})
+				return
+			}
+			fault.Until = time.Now().Add(duration)
+		}
+		if err := chaos.Set(info.Tag, fault); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": err.Error()})
+			return
+		}
+		s.logger.Printf("🧪 [chaos] %s: fail_rate=%v latency=%s throttle=%dKB/s until=%s", info.Tag, fault.FailRate, fault.Latency, fault.ThrottleKBps, untilText(fault.Until))
+		writeJSON(w, map[string]any{"message": "已注入故障", "tag": info.Tag})
+	case http.MethodDelete:
+		if chaos.Clear(info.Tag) {
+			s.logger.Printf("🧪 [chaos] %s: fault cleared", info.Tag)
+		}
+		writeJSON(w, map[string]any{"message": "已清除故障", "tag": info.Tag})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func untilText(until time.Time) string {
+	if until.IsZero() {
+		return "cleared"
+	}
+	return until.Format("15:04:05")
+}
@@ -0,0 +1,52 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/chaos"
+)
+
+func TestChaosAPI(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	mgr.Register(NodeInfo{Tag: "hk-1", Name: "HK 1"})
+	s := &Server{mgr: mgr, logger: log.Default()}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleChaos(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/chaos", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("without -chaos the API should not exist, got %d", rec.Code)
+	}
+
+	chaos.Enable()
+	defer chaos.ClearAll()
+	if rec := do(http.MethodPut, "/api/chaos/HK%201", `{"fail_rate": 1, "latency": "10ms", "duration": "1m"}`); rec.Code != http.StatusOK {
+		t.Fatalf("set by name: %d %s", rec.Code, rec.Body)
+	}
+	if err := chaos.Dial(context.Background(), "hk-1"); !errors.Is(err, chaos.ErrInjected) {
+		t.Fatalf("expected the fault on the node's tag, got %v", err)
+	}
+	rec := do(http.MethodGet, "/api/chaos", "")
+	if body := rec.Body.String(); !strings.Contains(body, `"node":"hk-1"`) || !strings.Contains(body, `"latency":"10ms"`) {
+		t.Fatalf("unexpected list %s", body)
+	}
+	if rec := do(http.MethodPut, "/api/chaos/hk-1", `{"fail_rate": 3}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid fail_rate: got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/chaos/missing", `{}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown node: got %d", rec.Code)
+	}
+	do(http.MethodDelete, "/api/chaos/hk-1", "")
+	if len(chaos.List()) != 0 {
+		t.Fatalf("expected no faults after DELETE, got %+v", chaos.List())
+	}
+}
@@ -0,0 +1,487 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/clock"
+)
+
+const (
+	// clusterSyncTimeout bounds one exchange with a peer.
+	clusterSyncTimeout = 10 * time.Second
+	// maxClusterState bounds the state accepted from a peer.
+	maxClusterState = 64 << 20
+	// clusterUntilSlack is how much later a peer's blacklist must end than
+	// ours before it is adopted, so that the same blacklist echoed back by a
+	// peer is not re-applied on every sync.
+	clusterUntilSlack = time.Second
+)
+
+// ClusterSettings configures sharing node state with other instances.
+type ClusterSettings struct {
+	Name           string        // this instance, as reported to the peers
+	Peers          []string      // management base URLs of the other instances
+	Secret         string        // shared by all instances; empty disables the cluster
+	Interval       time.Duration // between two syncs with the peers
+	SkipCertVerify bool          // for peers serving the API over self-signed HTTPS
+}
+
+// ClusterNode is the state of one node as exchanged between instances.
+// Nodes are matched by URI, since tags may differ between instances, but
+// only a keyed hash of it is sent (see clusterNodeID) so that credentials
+// never leave the instance. Times are sent as ages so that clock
+// differences between hosts do not matter.
+type ClusterNode struct {
+	ID             string `json:"id"`
+	Available      bool   `json:"available"`
+	LatencyMs      int64  `json:"latency_ms"`                 // -1 when not measured
+	BlacklistMs    int64  `json:"blacklist_ms,omitempty"`     // time left on the blacklist
+	BlacklistAgeMs int64  `json:"blacklist_age_ms,omitempty"` // time since the node was blacklisted
+	Manual         bool   `json:"manual,omitempty"`
+	ReleasedAgeMs  int64  `json:"released_age_ms,omitempty"` // time since a release through the API
+	Unhealthy      bool   `json:"unhealthy,omitempty"`       // out of rotation after failed health checks
+	HealthAgeMs    int64  `json:"health_age_ms,omitempty"`   // time since Unhealthy last changed
+}
+
+// ClusterState is what an instance sends to its peers, and what they answer.
+type ClusterState struct {
+	Instance string        `json:"instance"`
+	Nodes    []ClusterNode `json:"nodes"`
+}
+
+// ClusterPeer is the sync status of one configured peer.
+type ClusterPeer struct {
+	URL         string    `json:"url"`
+	Instance    string    `json:"instance,omitempty"`
+	LastSync    time.Time `json:"last_sync,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Nodes       int       `json:"nodes"`
+	Available   int       `json:"available"`
+	Blacklisted int       `json:"blacklisted"`
+	Adopted     int64     `json:"adopted"` // blacklists and health verdicts taken over from this peer
+}
+
+type clusterStore struct {
+	mu       sync.Mutex
+	settings ClusterSettings
+	client   *http.Client
+	released map[string]time.Time              // node ID -> last release through the API, on the clock
+	peers    map[string]*ClusterPeer           // configured peers by URL
+	views    map[string]map[string]ClusterNode // instance -> node ID -> latest state received
+	loop     sync.Once
+}
+
+// SetCluster applies the cluster settings and starts syncing with the peers
+// in the background. Settings without a secret or peers turn syncing off;
+// incoming syncs are then refused.
+func (m *Manager) SetCluster(settings ClusterSettings) {
+	cs := &m.cluster
+	cs.mu.Lock()
+	cs.settings = settings
+	cs.client = &http.Client{
+		Timeout: clusterSyncTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: settings.SkipCertVerify},
+		},
+	}
+	peers := make(map[string]*ClusterPeer, len(settings.Peers))
+	for _, url := range settings.Peers {
+		if p, ok := cs.peers[url]; ok {
+			peers[url] = p
+		} else {
+			peers[url] = &ClusterPeer{URL: url}
+		}
+	}
+	cs.peers = peers
+	if settings.Secret == "" {
+		cs.views = nil
+	}
+	cs.mu.Unlock()
+	if settings.Secret == "" || len(settings.Peers) == 0 {
+		return
+	}
+	cs.loop.Do(func() {
+		go func() {
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case <-time.After(m.clusterInterval()):
+					m.syncCluster()
+				}
+			}
+		}()
+	})
+}
+
+func (m *Manager) clusterInterval() time.Duration {
+	m.cluster.mu.Lock()
+	defer m.cluster.mu.Unlock()
+	if m.cluster.settings.Interval <= 0 {
+		return 10 * time.Second
+	}
+	return m.cluster.settings.Interval
+}
+
+// clusterEnabled reports whether the cluster is configured, and the
+// instance name and secret.
+func (m *Manager) clusterEnabled() (name, secret string, ok bool) {
+	m.cluster.mu.Lock()
+	defer m.cluster.mu.Unlock()
+	s := m.cluster.settings
+	return s.Name, s.Secret, s.Secret != ""
+}
+
+// clusterNodeID identifies the node with uri between instances: an HMAC of
+// the URI keyed with the cluster secret, which every instance computes alike
+// but which tells nothing about the node's server or credentials.
+func clusterNodeID(secret, uri string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(uri))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// noteRelease records that the node with uri was released through the API,
+// so that the release reaches the peers and their older blacklists of it
+// are not taken back.
+func (m *Manager) noteRelease(uri string) {
+	cs := &m.cluster
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.settings.Secret == "" {
+		return
+	}
+	if cs.released == nil {
+		cs.released = make(map[string]time.Time)
+	}
+	cs.released[clusterNodeID(cs.settings.Secret, uri)] = clock.Now()
+}
+
+// ClusterState returns the local state of every node, as sent to the peers.
+func (m *Manager) ClusterState() ClusterState {
+	name, secret, _ := m.clusterEnabled()
+	now := clock.Now()
+
+	m.mu.RLock()
+	nodes := make([]ClusterNode, 0, len(m.nodes))
+	for _, e := range m.nodes {
+		e.mu.RLock()
+		node := ClusterNode{ID: clusterNodeID(secret, e.info.URI), Available: e.available, LatencyMs: -1}
+		if e.lastProbe > 0 {
+			node.LatencyMs = max(e.lastProbe.Milliseconds(), 1)
+		}
+		if !e.healthSince.IsZero() {
+			node.Unhealthy = e.unhealthy
+			node.HealthAgeMs = max(now.Sub(e.healthSince).Milliseconds(), 1)
+		}
+		if e.blacklist && e.until.After(now) {
+			node.BlacklistMs = max(e.until.Sub(now).Milliseconds(), 1)
+			node.Manual = e.manual
+			if !e.since.IsZero() {
+				node.BlacklistAgeMs = max(now.Sub(e.since).Milliseconds(), 1)
+			}
+		}
+		e.mu.RUnlock()
+		nodes = append(nodes, node)
+	}
+	m.mu.RUnlock()
+
+	m.cluster.mu.Lock()
+	known := make(map[string]bool, len(nodes))
+	for i := range nodes {
+		known[nodes[i].ID] = true
+		if at, ok := m.cluster.released[nodes[i].ID]; ok {
+			nodes[i].ReleasedAgeMs = max(now.Sub(at).Milliseconds(), 1)
+		}
+	}
+	for id := range m.cluster.released {
+		if !known[id] {
+			delete(m.cluster.released, id)
+		}
+	}
+	m.cluster.mu.Unlock()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return ClusterState{Instance: name, Nodes: nodes}
+}
+
+// MergeClusterState applies the state of a peer: releases made on the peer
+// after a node was blacklisted here clear the blacklist, and blacklists
+// made on the peer after the last release here, ending later than ours,
+// are taken over. A node whose health checks changed its verdict on the
+// peer later than here is taken out of rotation or put back the same way;
+// the local probes then need the full threshold to overturn it. Latency
+// is not merged, since it depends on each host's path to the node. It
+// returns how many blacklists and health verdicts were taken over.
+func (m *Manager) MergeClusterState(state ClusterState) int {
+	name, secret, ok := m.clusterEnabled()
+	if !ok || state.Instance == "" || state.Instance == name {
+		return 0
+	}
+	now := clock.Now()
+	ago := func(ms int64) time.Time { return now.Add(-time.Duration(ms) * time.Millisecond) }
+
+	m.mu.RLock()
+	byID := make(map[string]*entry, len(m.nodes))
+	for _, e := range m.nodes {
+		byID[clusterNodeID(secret, e.info.URI)] = e
+	}
+	m.mu.RUnlock()
+
+	view := make(map[string]ClusterNode, len(state.Nodes))
+	adopted, released, health := 0, 0, 0
+	for _, node := range state.Nodes {
+		view[node.ID] = node
+		e := byID[node.ID]
+		if e == nil {
+			continue
+		}
+		m.cluster.mu.Lock()
+		if node.ReleasedAgeMs > 0 {
+			if at := ago(node.ReleasedAgeMs); at.After(m.cluster.released[node.ID]) {
+				if m.cluster.released == nil {
+					m.cluster.released = make(map[string]time.Time)
+				}
+				m.cluster.released[node.ID] = at
+			}
+		}
+		releasedAt := m.cluster.released[node.ID]
+		m.cluster.mu.Unlock()
+
+		e.mu.RLock()
+		blacklisted := e.blacklist && e.until.After(now)
+		until, since := e.until, e.since
+		blacklistFn, releaseFn := e.blacklistFn, e.release
+		unhealthy, healthSince, healthFn := e.unhealthy, e.healthSince, e.healthFn
+		e.mu.RUnlock()
+
+		if node.HealthAgeMs > 0 && node.Unhealthy != unhealthy && healthFn != nil {
+			if remoteSince := ago(node.HealthAgeMs); remoteSince.After(healthSince.Add(clusterUntilSlack)) {
+				healthFn(node.Unhealthy)
+				e.adoptHealth(node.Unhealthy, remoteSince)
+				health++
+			}
+		}
+
+		if blacklisted && !releasedAt.IsZero() && since.Before(releasedAt) {
+			if releaseFn != nil {
+				releaseFn()
+			}
+			e.clearBlacklist()
+			blacklisted = false
+			released++
+		}
+		if node.BlacklistMs <= 0 {
+			continue
+		}
+		remoteSince := ago(node.BlacklistAgeMs)
+		remoteUntil := now.Add(time.Duration(node.BlacklistMs) * time.Millisecond)
+		if !remoteSince.After(releasedAt) || (blacklisted && !remoteUntil.After(until.Add(clusterUntilSlack))) {
+			continue
+		}
+		if blacklistFn != nil {
+			blacklistFn(remoteUntil.Sub(now))
+		}
+		e.adoptBlacklist(remoteUntil, remoteSince, node.Manual)
+		adopted++
+	}
+
+	m.cluster.mu.Lock()
+	if m.cluster.views == nil {
+		m.cluster.views = make(map[string]map[string]ClusterNode)
+	}
+	m.cluster.views[state.Instance] = view
+	m.cluster.mu.Unlock()
+
+	if health > 0 && m.logger != nil {
+		m.logger.Info(fmt.Sprintf("🤝 cluster: health of %d node(s) taken over from instance %s", health, state.Instance))
+	}
+	if adopted > 0 || released > 0 {
+		if m.logger != nil {
+			m.logger.Info(fmt.Sprintf("🤝 cluster: %d blacklisted and %d released node(s) from instance %s", adopted, released, state.Instance))
+		}
+		_ = m.SaveBlacklist()
+	}
+	return adopted + health
+}
+
+// syncCluster exchanges state with every configured peer.
+func (m *Manager) syncCluster() {
+	m.cluster.mu.Lock()
+	urls := make([]string, 0, len(m.cluster.peers))
+	for url := range m.cluster.peers {
+		urls = append(urls, url)
+	}
+	client, name, secret := m.cluster.client, m.cluster.settings.Name, m.cluster.settings.Secret
+	m.cluster.mu.Unlock()
+	if secret == "" || len(urls) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(m.ClusterState())
+	if err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state, err := exchangeClusterState(m.ctx, client, url, secret, body)
+			if err == nil && state.Instance == name {
+				err = fmt.Errorf("peer uses the name of this instance (%q), set cluster.name", name)
+			}
+			adopted := 0
+			if err == nil {
+				adopted = m.MergeClusterState(state)
+			}
+			m.recordPeerSync(url, state, adopted, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// exchangeClusterState posts the local state to a peer and returns the
+// peer's.
+func exchangeClusterState(ctx context.Context, client *http.Client, baseURL, secret string, body []byte) (ClusterState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/api/cluster/sync", bytes.NewReader(body))
+	if err != nil {
+		return ClusterState{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ClusterState{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ClusterState{}, fmt.Errorf("peer answered %s", resp.Status)
+	}
+	var state ClusterState
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxClusterState)).Decode(&state); err != nil {
+		return ClusterState{}, fmt.Errorf("decode peer state: %w", err)
+	}
+	return state, nil
+}
+
+func (m *Manager) recordPeerSync(url string, state ClusterState, adopted int, err error) {
+	m.cluster.mu.Lock()
+	defer m.cluster.mu.Unlock()
+	p, ok := m.cluster.peers[url]
+	if !ok {
+		return
+	}
+	if err != nil {
+		if p.LastError == "" && m.logger != nil {
+			m.logger.Warn("cluster peer ", url, ": ", err)
+		}
+		p.LastError = err.Error()
+		return
+	}
+	p.LastError = ""
+	p.LastSync = time.Now()
+	p.Instance = state.Instance
+	p.Nodes, p.Available, p.Blacklisted = len(state.Nodes), 0, 0
+	for _, node := range state.Nodes {
+		if node.Available {
+			p.Available++
+		}
+		if node.BlacklistMs > 0 {
+			p.Blacklisted++
+		}
+	}
+	p.Adopted += int64(adopted)
+}
+
+// ClusterPeers returns the sync status of the configured peers.
+func (m *Manager) ClusterPeers() []ClusterPeer {
+	m.cluster.mu.Lock()
+	defer m.cluster.mu.Unlock()
+	peers := make([]ClusterPeer, 0, len(m.cluster.peers))
+	for _, p := range m.cluster.peers {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].URL < peers[j].URL })
+	return peers
+}
+
+// ClusterNodeViews returns how each instance last reported the node with
+// uri, by instance name.
+func (m *Manager) ClusterNodeViews(uri string) map[string]ClusterNode {
+	m.cluster.mu.Lock()
+	defer m.cluster.mu.Unlock()
+	id := clusterNodeID(m.cluster.settings.Secret, uri)
+	views := make(map[string]ClusterNode)
+	for instance, nodes := range m.cluster.views {
+		if node, ok := nodes[id]; ok {
+			views[instance] = node
+		}
+	}
+	return views
+}
+
+// handleClusterSync accepts the state of a peer and answers with the local
+// one (POST /api/cluster/sync). Peers authenticate with the shared secret
+// rather than a session.
+func (s *Server) handleClusterSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	_, secret, ok := s.mgr.clusterEnabled()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": "未启用集群"})
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]any{"error": "集群密钥错误"})
+		return
+	}
+	var state ClusterState
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxClusterState)).Decode(&state); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": "请求格式错误"})
+		return
+	}
+	s.mgr.MergeClusterState(state)
+	writeJSON(w, s.mgr.ClusterState())
+}
+
+// handleCluster reports the cluster peers (GET /api/cluster), or with
+// ?node=<tag> how each instance last reported that node.
+func (s *Server) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name, _, enabled := s.mgr.clusterEnabled()
+	if tag := r.URL.Query().Get("node"); tag != "" {
+		e, err := s.mgr.entry(tag)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]any{"error": "节点不存在"})
+			return
+		}
+		writeJSON(w, map[string]any{"node": tag, "instances": s.mgr.ClusterNodeViews(e.info.URI)})
+		return
+	}
+	writeJSON(w, map[string]any{"enabled": enabled, "instance": name, "peers": s.mgr.ClusterPeers()})
+}
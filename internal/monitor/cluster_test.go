@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/clock"
+)
+
+func TestClusterSharesBlacklistAndRelease(t *testing.T) {
+	newInstance := func(name, tag string) (*Manager, *time.Duration) {
+		m, _ := NewManager(Config{})
+		t.Cleanup(m.Stop)
+		m.SetCluster(ClusterSettings{Name: name, Secret: "s3cret"})
+		applied := new(time.Duration)
+		h := m.Register(NodeInfo{Tag: tag, URI: "socks5://x:1080"})
+		h.SetBlacklistFn(func(d time.Duration) { *applied = d })
+		h.SetRelease(h.ClearBlacklist)
+		return m, applied
+	}
+	a, _ := newInstance("a", "x")
+	b, appliedB := newInstance("b", "renamed-x")
+
+	if err := a.ManualBlacklist("x", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.MergeClusterState(a.ClusterState()); n != 1 {
+		t.Fatalf("adopted %d blacklists, want 1", n)
+	}
+	if list := b.Blacklist(); len(list) != 1 || list[0].Tag != "renamed-x" || !list[0].Manual {
+		t.Fatalf("unexpected blacklist on b: %+v", list)
+	}
+	if *appliedB <= 59*time.Minute || *appliedB > time.Hour {
+		t.Fatalf("pool blacklist applied for %s, want about 1h", *appliedB)
+	}
+	if n := a.MergeClusterState(b.ClusterState()); n != 0 {
+		t.Fatalf("the echoed blacklist should not be adopted again, got %d", n)
+	}
+
+	if err := a.Release("x"); err != nil {
+		t.Fatal(err)
+	}
+	b.MergeClusterState(a.ClusterState())
+	if list := b.Blacklist(); len(list) != 0 {
+		t.Fatalf("the release should reach b, still blacklisted: %+v", list)
+	}
+	// b's older blacklist must not come back to a either.
+	if n := a.MergeClusterState(b.ClusterState()); n != 0 || len(a.Blacklist()) != 0 {
+		t.Fatalf("released node blacklisted again (adopted %d)", n)
+	}
+
+	// A later failure on b is shared again despite the earlier release.
+	// Ages are exchanged in milliseconds.
+	time.Sleep(10 * time.Millisecond)
+	b.Register(NodeInfo{Tag: "renamed-x", URI: "socks5://x:1080"}).Blacklist(time.Now().Add(time.Minute))
+	if n := a.MergeClusterState(b.ClusterState()); n != 1 {
+		t.Fatalf("adopted %d blacklists after the release, want 1", n)
+	}
+}
+
+func TestClusterSharesHealth(t *testing.T) {
+	newInstance := func(name string) (*Manager, *EntryHandle, *[]bool) {
+		m, _ := NewManager(Config{})
+		t.Cleanup(m.Stop)
+		m.SetCluster(ClusterSettings{Name: name, Secret: "s3cret"})
+		applied := new([]bool)
+		h := m.Register(NodeInfo{Tag: "x", URI: "socks5://x:1080"})
+		h.SetHealthFn(func(unhealthy bool) { *applied = append(*applied, unhealthy) })
+		return m, h, applied
+	}
+	a, ha, appliedA := newInstance("a")
+	b, hb, appliedB := newInstance("b")
+
+	ha.MarkUnhealthy(true)
+	if n := b.MergeClusterState(a.ClusterState()); n != 1 || len(*appliedB) != 1 || !(*appliedB)[0] {
+		t.Fatalf("health verdict not taken over (adopted %d, applied %v)", n, *appliedB)
+	}
+	if n := a.MergeClusterState(b.ClusterState()); n != 0 || len(*appliedA) != 0 {
+		t.Fatalf("the echoed verdict should not be applied again, got %d", n)
+	}
+
+	// b's probes recover later; the newer verdict wins on a.
+	ha.ref.healthSince = clock.Now().Add(-time.Minute)
+	hb.MarkUnhealthy(false)
+	if n := a.MergeClusterState(b.ClusterState()); n != 1 || len(*appliedA) != 1 || (*appliedA)[0] {
+		t.Fatalf("recovery not taken over (adopted %d, applied %v)", n, *appliedA)
+	}
+}
+
+func TestClusterSyncEndpoint(t *testing.T) {
+	m, _ := NewManager(Config{})
+	defer m.Stop()
+	s := &Server{mgr: m}
+
+	post := func(secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/cluster/sync", strings.NewReader(`{"instance":"peer","nodes":[]}`))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		s.handleClusterSync(rec, req)
+		return rec
+	}
+	if rec := post("s3cret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("sync without a cluster: status %d", rec.Code)
+	}
+
+	m.SetCluster(ClusterSettings{Name: "local", Secret: "s3cret"})
+	m.Register(NodeInfo{Tag: "x", URI: "socks5://x:1080"})
+	if rec := post("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: status %d", rec.Code)
+	}
+	rec := post("s3cret")
+	if strings.Contains(rec.Body.String(), "x:1080") {
+		t.Fatalf("node URI sent to the peer: %s", rec.Body)
+	}
+	var state ClusterState
+	if err := json.NewDecoder(rec.Body).Decode(&state); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, err %v", rec.Code, err)
+	}
+	if state.Instance != "local" || len(state.Nodes) != 1 || state.Nodes[0].ID != clusterNodeID("s3cret", "socks5://x:1080") {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/accesslog"
+)
+
+func TestConnectionsExportFilters(t *testing.T) {
+	if err := accesslog.Configure(accesslog.Config{History: 10}); err != nil {
+		t.Fatal(err)
+	}
+	defer accesslog.Close()
+	now := time.Now()
+	accesslog.Log(accesslog.Entry{Time: now.Add(-2 * time.Hour), User: "alice", Target: "old:1", Node: "a", Result: accesslog.ResultOK})
+	accesslog.Log(accesslog.Entry{Time: now, User: "alice", Target: "x:1", Node: "a", NodeName: "tokyo", Result: accesslog.ResultOK})
+	accesslog.Log(accesslog.Entry{Time: now, User: "bob", Target: "y:2", Node: "b", Result: accesslog.ResultError})
+	accesslog.Log(accesslog.Entry{Time: now, User: "alice", Target: "z:3", Node: "a", NodeName: "tokyo", Result: accesslog.ResultError})
+
+	s := &Server{}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"old:1", "x:1", "y:2", "z:3"}},
+		{query: "since=1h", want: []string{"x:1", "y:2", "z:3"}},
+		{query: "user=alice&node=tokyo", want: []string{"x:1", "z:3"}},
+		{query: "result=error&limit=1", want: []string{"z:3"}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.handleConnectionsExport(rec, httptest.NewRequest(http.MethodGet, "/api/connections/export?"+tt.query, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("%q: status %d, content type %q", tt.query, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		body := strings.TrimSpace(rec.Body.String())
+		var lines []string
+		if body != "" {
+			lines = strings.Split(body, "\n")
+		}
+		if len(lines) != len(tt.want) {
+			t.Fatalf("%q: got %d lines, want %d: %s", tt.query, len(lines), len(tt.want), body)
+		}
+		for i, target := range tt.want {
+			if !strings.Contains(lines[i], `"target":"`+target+`"`) {
+				t.Fatalf("%q: line %d = %s, want target %s", tt.query, i, lines[i], target)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleConnectionsExport(rec, httptest.NewRequest(http.MethodGet, "/api/connections/export?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("limit=0: status %d, want 400", rec.Code)
+	}
+}
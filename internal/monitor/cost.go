@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// bytesPerGB is the unit of NodeInfo.CostPerGB: decimal gigabytes, as
+// providers bill traffic.
+const bytesPerGB = 1e9
+
+// NodeCost is one node of the cost report. Traffic counts both directions
+// since Since, the node's registration or the last reset; per-hour costs
+// accrue over the same period.
+type NodeCost struct {
+	Tag         string    `json:"tag"`
+	Name        string    `json:"name"`
+	PerGB       float64   `json:"per_gb,omitempty"`
+	PerHour     float64   `json:"per_hour,omitempty"`
+	Since       time.Time `json:"since"`
+	Bytes       int64     `json:"bytes"`
+	Hours       float64   `json:"hours"`
+	TrafficCost float64   `json:"traffic_cost"`
+	TimeCost    float64   `json:"time_cost"`
+	Total       float64   `json:"total"`
+	Available   bool      `json:"available"`
+}
+
+// CostReport is the spend of every registered node, most expensive first.
+type CostReport struct {
+	GeneratedAt time.Time  `json:"generated_at"`
+	Nodes       []NodeCost `json:"nodes"`
+	Bytes       int64      `json:"bytes"`
+	TrafficCost float64    `json:"traffic_cost"`
+	TimeCost    float64    `json:"time_cost"`
+	Total       float64    `json:"total"`
+}
+
+// AddTraffic counts n bytes carried by the node.
+func (h *EntryHandle) AddTraffic(n int64) {
+	if h == nil || h.ref == nil || n <= 0 {
+		return
+	}
+	h.ref.traffic.Add(n)
+}
+
+// CostReport computes the traffic and time costs of the registered nodes.
+// Nodes without a cost are listed with their traffic and a cost of zero.
+func (m *Manager) CostReport() CostReport {
+	now := time.Now()
+	report := CostReport{GeneratedAt: now, Nodes: []NodeCost{}}
+	m.mu.RLock()
+	for _, e := range m.nodes {
+		e.mu.RLock()
+		row := NodeCost{
+			Tag:       e.info.Tag,
+			Name:      e.info.Name,
+			PerGB:     e.info.CostPerGB,
+			PerHour:   e.info.CostPerHour,
+			Since:     e.billedSince,
+			Bytes:     e.traffic.Load(),
+			Available: e.available && !e.blacklist,
+		}
+		e.mu.RUnlock()
+		if !row.Since.IsZero() && now.After(row.Since) {
+			row.Hours = now.Sub(row.Since).Hours()
+		}
+		row.TrafficCost = float64(row.Bytes) / bytesPerGB * row.PerGB
+		row.TimeCost = row.Hours * row.PerHour
+		row.Total = row.TrafficCost + row.TimeCost
+		report.Nodes = append(report.Nodes, row)
+		report.Bytes += row.Bytes
+		report.TrafficCost += row.TrafficCost
+		report.TimeCost += row.TimeCost
+	}
+	m.mu.RUnlock()
+	report.Total = report.TrafficCost + report.TimeCost
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		a, b := report.Nodes[i], report.Nodes[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+// ResetCosts zeroes the traffic counters and restarts the per-hour accrual
+// of every node, e.g. at the start of a billing period.
+func (m *Manager) ResetCosts() {
+	now := time.Now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.nodes {
+		e.mu.Lock()
+		e.traffic.Store(0)
+		e.billedSince = now
+		e.mu.Unlock()
+	}
+}
+
+// writeCostCSV writes report as CSV, one row per node plus a total row.
+func writeCostCSV(w http.ResponseWriter, report CostReport) {
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"tag", "name", "per_gb", "per_hour", "since", "bytes", "hours", "traffic_cost", "time_cost", "total"})
+	for _, n := range report.Nodes {
+		_ = out.Write([]string{
+			n.Tag, n.Name, money(n.PerGB), money(n.PerHour), n.Since.Format(time.RFC3339),
+			strconv.FormatInt(n.Bytes, 10), strconv.FormatFloat(n.Hours, 'f', 2, 64),
+			money(n.TrafficCost), money(n.TimeCost), money(n.Total),
+		})
+	}
+	_ = out.Write([]string{"", "total", "", "", "", strconv.FormatInt(report.Bytes, 10), "",
+		money(report.TrafficCost), money(report.TimeCost), money(report.Total)})
+	out.Flush()
+}
+
+// handleCosts serves the cost report (GET, ?format=csv) and resets it
+// (DELETE).
+func (s *Server) handleCosts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := s.mgr.CostReport()
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			filename := fmt.Sprintf("costs-%s.csv", report.GeneratedAt.Format("20060102-150405"))
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+			writeCostCSV(w, report)
+			return
+		}
+		writeJSON(w, report)
+	case http.MethodDelete:
+		s.mgr.ResetCosts()
+		writeJSON(w, map[string]any{"message": "已重置费用统计"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
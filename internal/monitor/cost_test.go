@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCostReport(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	metered := mgr.Register(NodeInfo{Tag: "metered", Name: "Metered", CostPerGB: 2})
+	mgr.Register(NodeInfo{Tag: "rented", Name: "Rented", CostPerHour: 0.5})
+	mgr.Register(NodeInfo{Tag: "flat", Name: "Flat"})
+	metered.AddTraffic(1500_000_000)
+	metered.AddTraffic(-1)
+
+	mgr.mu.RLock()
+	mgr.nodes["rented"].billedSince = time.Now().Add(-4 * time.Hour)
+	mgr.mu.RUnlock()
+
+	report := mgr.CostReport()
+	if len(report.Nodes) != 3 {
+		t.Fatalf("expected every node in the report, got %+v", report.Nodes)
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) < 0.01 }
+	if n := report.Nodes[0]; n.Tag != "metered" || n.Bytes != 1500_000_000 || !near(n.TrafficCost, 3) {
+		t.Fatalf("expected the metered node first at 3.00, got %+v", n)
+	}
+	if n := report.Nodes[1]; n.Tag != "rented" || !near(n.Hours, 4) || !near(n.TimeCost, 2) {
+		t.Fatalf("expected the rented node at 2.00 for 4h, got %+v", n)
+	}
+	if n := report.Nodes[2]; n.Tag != "flat" || n.Total != 0 {
+		t.Fatalf("expected the flat-rate node to cost nothing, got %+v", n)
+	}
+	if !near(report.Total, 5) || report.Bytes != 1500_000_000 {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+
+	mgr.ResetCosts()
+	if report := mgr.CostReport(); report.Bytes != 0 || !near(report.Total, 0) {
+		t.Fatalf("expected a reset report, got %+v", report)
+	}
+}
+
+func TestCostTrafficPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	first, _ := NewManager(Config{})
+	first.SetStatsFile(path)
+	first.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080", CostPerGB: 1}).AddTraffic(42)
+	first.mu.RLock()
+	since := first.nodes["a"].billedSince
+	first.mu.RUnlock()
+	if err := first.SaveStats(); err != nil {
+		t.Fatal(err)
+	}
+	first.Stop()
+
+	second, _ := NewManager(Config{})
+	defer second.Stop()
+	second.SetStatsFile(path)
+	second.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080", CostPerGB: 1})
+	if _, _, err := second.RestoreStats(); err != nil {
+		t.Fatal(err)
+	}
+	n := second.CostReport().Nodes[0]
+	if n.Bytes != 42 || !n.Since.Equal(since) {
+		t.Fatalf("expected the saved traffic and period start, got %+v", n)
+	}
+}
+
+func TestCostsAPI(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	mgr.Register(NodeInfo{Tag: "a", Name: "A", CostPerGB: 1}).AddTraffic(2_000_000_000)
+	s := &Server{mgr: mgr, logger: log.Default()}
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleCosts(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	var report CostReport
+	if err := json.Unmarshal(do(http.MethodGet, "/api/costs").Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 2 {
+		t.Fatalf("expected a total of 2, got %+v", report)
+	}
+	rec := do(http.MethodGet, "/api/costs?format=csv")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "tag,name,per_gb") ||
+		!strings.HasPrefix(lines[1], "a,A,1.0000,") || !strings.HasSuffix(lines[2], ",2.0000,0.0000,2.0000") {
+		t.Fatalf("unexpected CSV:\n%s", rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/api/costs"); rec.Code != http.StatusOK {
+		t.Fatalf("reset: %d", rec.Code)
+	}
+	if got := mgr.CostReport().Bytes; got != 0 {
+		t.Fatalf("expected the counters reset, got %d bytes", got)
+	}
+	if rec := do(http.MethodPost, "/api/costs"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/geoip"
+)
+
+const (
+	// DefaultIPCheckURL answers with the caller's address as plain text.
+	DefaultIPCheckURL = "https://api.ipify.org"
+	// exitIPCacheTTL is how long a looked-up exit IP is served from cache.
+	exitIPCacheTTL = 30 * time.Minute
+	exitIPTimeout  = 15 * time.Second
+)
+
+// ExitIP is the address a node's traffic leaves from, as seen by the IP
+// check service, enriched from the local GeoIP databases when available.
+type ExitIP struct {
+	Tag  string `json:"tag"`
+	Name string `json:"name"`
+	IP   string `json:"ip,omitempty"`
+	geoip.IPDetails
+	// ClaimedRegion is the region derived from the server address, so
+	// callers can compare it with where the node actually exits.
+	ClaimedRegion string    `json:"claimed_region,omitempty"`
+	CheckedAt     time.Time `json:"checked_at"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// exitIPResolver looks up and caches exit IPs per node tag.
+type exitIPResolver struct {
+	mu       sync.Mutex
+	cache    map[string]ExitIP
+	info     *geoip.IPInfo
+	infoKey  string // country and ASN paths info was opened with
+	inflight map[string]chan struct{}
+}
+
+// Lookup returns the cached exit IP of tag, or fetches it through the node
+// when the cache is empty, stale or refresh is set. Concurrent callers for
+// the same tag share one request.
+func (r *exitIPResolver) Lookup(ctx context.Context, mgr *Manager, info NodeInfo, checkURL, countryDB, asnDB string, refresh bool) ExitIP {
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]ExitIP)
+		r.inflight = make(map[string]chan struct{})
+	}
+	for {
+		if cached, ok := r.cache[info.Tag]; ok && !refresh && time.Since(cached.CheckedAt) < exitIPCacheTTL {
+			r.mu.Unlock()
+			return cached
+		}
+		wait, busy := r.inflight[info.Tag]
+		if !busy {
+			break
+		}
+		r.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ExitIP{Tag: info.Tag, Name: info.Name, CheckedAt: time.Now(), Error: ctx.Err().Error()}
+		}
+		refresh = false
+		r.mu.Lock()
+	}
+	done := make(chan struct{})
+	r.inflight[info.Tag] = done
+	r.mu.Unlock()
+
+	result := ExitIP{Tag: info.Tag, Name: info.Name, ClaimedRegion: info.Region}
+	ip, err := fetchExitIP(ctx, mgr, info.Tag, checkURL)
+	result.CheckedAt = time.Now()
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.IP = ip.String()
+		result.IPDetails = r.details(ip, countryDB, asnDB)
+	}
+
+	r.mu.Lock()
+	r.cache[info.Tag] = result
+	delete(r.inflight, info.Tag)
+	r.mu.Unlock()
+	close(done)
+	return result
+}
+
+// details looks ip up, reopening the databases when their paths changed.
+// Databases that failed to open are tried again on the next lookup, so one
+// that appears after startup is picked up.
+func (r *exitIPResolver) details(ip net.IP, countryDB, asnDB string) geoip.IPDetails {
+	key := countryDB + "\x00" + asnDB
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.infoKey != key {
+		_ = r.info.Close()
+		r.info, r.infoKey = nil, ""
+		if countryDB != "" || asnDB != "" {
+			info, err := geoip.OpenIPInfo(countryDB, asnDB)
+			if err != nil {
+				return geoip.IPDetails{}
+			}
+			r.info = info
+		}
+		r.infoKey = key
+	}
+	return r.info.Lookup(ip)
+}
+
+// fetchExitIP requests checkURL through the node tag. The service may answer
+// with a bare address or a JSON object with an "ip" field.
+func fetchExitIP(ctx context.Context, mgr *Manager, tag, checkURL string) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, exitIPTimeout)
+	defer cancel()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return mgr.DialNode(ctx, tag, network, address)
+		},
+		DisableKeepAlives: true,
+	}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ip check returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, err
+	}
+	return parseExitIP(body)
+}
+
+func parseExitIP(body []byte) (net.IP, error) {
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "{") {
+		var obj struct {
+			IP string `json:"ip"`
+		}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil, fmt.Errorf("decode ip check response: %w", err)
+		}
+		text = strings.TrimSpace(obj.IP)
+	}
+	ip := net.ParseIP(text)
+	if ip == nil {
+		return nil, errors.New("ip check response is not an IP address")
+	}
+	return ip, nil
+}
+
+// nodeInfo finds a registered node by tag, falling back to its name.
+func (m *Manager) nodeInfo(id string) (NodeInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if e, ok := m.nodes[id]; ok {
+		return e.info, true
+	}
+	for _, e := range m.nodes {
+		if e.info.Name == id {
+			return e.info, true
+		}
+	}
+	return NodeInfo{}, false
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestExitIPLookupDialsThroughNodeAndCaches(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte(`{"ip": "203.0.113.7"}`))
+	}))
+	defer srv.Close()
+
+	mgr, err := NewManager(Config{})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	var dialed atomic.Int32
+	entry := mgr.Register(NodeInfo{Tag: "hk-1", Name: "HK 1", Region: "hk"})
+	entry.SetDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed.Add(1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	})
+
+	info, ok := mgr.nodeInfo("HK 1")
+	if !ok || info.Tag != "hk-1" {
+		t.Fatalf("nodeInfo by name: %+v, %v", info, ok)
+	}
+
+	var r exitIPResolver
+	got := r.Lookup(context.Background(), mgr, info, srv.URL, "", "", false)
+	if got.Error != "" || got.IP != "203.0.113.7" || got.ClaimedRegion != "hk" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	if dialed.Load() == 0 {
+		t.Fatal("lookup did not dial through the node")
+	}
+
+	r.Lookup(context.Background(), mgr, info, srv.URL, "", "", false)
+	if hits.Load() != 1 {
+		t.Fatalf("expected cached result, service hit %d times", hits.Load())
+	}
+	r.Lookup(context.Background(), mgr, info, srv.URL, "", "", true)
+	if hits.Load() != 2 {
+		t.Fatalf("refresh should bypass the cache, service hit %d times", hits.Load())
+	}
+}
+
+func TestParseExitIP(t *testing.T) {
+	for body, want := range map[string]string{
+		"198.51.100.1\n":               "198.51.100.1",
+		`{"ip":"2001:db8::1"}`:         "2001:db8::1",
+		` {"ip": "192.0.2.9", "x": 1}`: "192.0.2.9",
+	} {
+		ip, err := parseExitIP([]byte(body))
+		if err != nil || ip.String() != want {
+			t.Fatalf("parseExitIP(%q) = %v, %v", body, ip, err)
+		}
+	}
+	if _, err := parseExitIP([]byte("<html>")); err == nil {
+		t.Fatal("expected error for non-IP body")
+	}
+}
+
+func TestExitIPDetailsRetriesMissingDatabase(t *testing.T) {
+	var r exitIPResolver
+	missing := t.TempDir() + "/country.mmdb"
+	if got := r.details(net.ParseIP("203.0.113.7"), missing, ""); got.Country != "" {
+		t.Fatalf("details from a missing database: %+v", got)
+	}
+	if r.infoKey != "" {
+		t.Fatal("a database that failed to open is never tried again")
+	}
+}
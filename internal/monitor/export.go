@@ -0,0 +1,217 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"easy_proxies/internal/redact"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Export formats of /api/export besides the default URI list.
+const (
+	ExportClash   = "clash"
+	ExportSingBox = "sing-box"
+)
+
+// exportEndpoint is a local entry clients can connect to: the pool entry
+// or the port of one healthy node.
+type exportEndpoint struct {
+	Name     string
+	Host     string
+	Port     uint16
+	Username string
+	Password string
+	TLS      bool // the entry only accepts TLS (listener TLS)
+}
+
+// exportEndpoints lists the pool entry in pool/hybrid mode and the ports of
+// the nodes that passed their health check. Passwords are masked unless
+// showSecrets is set.
+func (s *Server) exportEndpoints(showSecrets bool) []exportEndpoint {
+	extIP, _, _, _ := s.getSettings()
+	public := func(addr string) string {
+		if (addr == "" || addr == "0.0.0.0" || addr == "::") && extIP != "" {
+			return extIP
+		}
+		if addr == "" {
+			return "127.0.0.1"
+		}
+		return addr
+	}
+	secret := func(v string) string {
+		if showSecrets {
+			return v
+		}
+		return redact.Secret(v)
+	}
+
+	var endpoints []exportEndpoint
+	s.cfgMu.RLock()
+	if cfg := s.cfgSrc; cfg != nil && (cfg.Mode == "pool" || cfg.Mode == "hybrid") && cfg.Listener.Port > 0 {
+		endpoints = append(endpoints, exportEndpoint{
+			Name:     "easy_proxies pool",
+			Host:     public(cfg.Listener.Address),
+			Port:     cfg.Listener.Port,
+			Username: cfg.Listener.Username,
+			Password: secret(cfg.Listener.Password),
+			TLS:      cfg.Listener.TLS.Enabled(),
+		})
+	}
+	s.cfgMu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, snap := range s.mgr.SnapshotFiltered(true) {
+		if snap.ListenAddress == "" || snap.Port == 0 {
+			continue
+		}
+		host := public(snap.ListenAddress)
+		key := fmt.Sprintf("%s:%d", host, snap.Port)
+		if seen[key] {
+			continue // grouped ports are shared by several nodes
+		}
+		seen[key] = true
+		endpoints = append(endpoints, exportEndpoint{
+			Name:     snap.Name,
+			Host:     host,
+			Port:     snap.Port,
+			Username: s.cfg.ProxyUsername,
+			Password: secret(s.cfg.ProxyPassword),
+		})
+	}
+	return endpoints
+}
+
+// clashProxy is one entry of a Clash proxy provider.
+type clashProxy struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Server   string `yaml:"server"`
+	Port     uint16 `yaml:"port"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	TLS      bool   `yaml:"tls,omitempty"`
+	UDP      bool   `yaml:"udp,omitempty"`
+}
+
+// clashProvider renders endpoints as a Clash proxy provider, one proxy per
+// endpoint and scheme.
+func clashProvider(endpoints []exportEndpoint, schemes []string) ([]byte, error) {
+	var proxies []clashProxy
+	for _, ep := range endpoints {
+		for _, scheme := range schemes {
+			p := clashProxy{
+				Name:     exportName(ep.Name, scheme, schemes),
+				Type:     scheme,
+				Server:   ep.Host,
+				Port:     ep.Port,
+				Username: ep.Username,
+				Password: ep.Password,
+				TLS:      ep.TLS,
+			}
+			if scheme == "socks5" {
+				p.UDP = !ep.TLS // SOCKS5 UDP is not available over a TLS entry
+			}
+			proxies = append(proxies, p)
+		}
+	}
+	if proxies == nil {
+		proxies = []clashProxy{}
+	}
+	return yaml.Marshal(map[string]any{"proxies": proxies})
+}
+
+// singBoxOutbounds renders endpoints as sing-box outbounds. sing-box has no
+// SOCKS over TLS, so TLS entries are exported as HTTPS proxies only.
+func singBoxOutbounds(endpoints []exportEndpoint, schemes []string) ([]byte, error) {
+	outbounds := make([]map[string]any, 0, len(endpoints)*len(schemes))
+	for _, ep := range endpoints {
+		for _, scheme := range schemes {
+			if scheme == "socks5" && ep.TLS {
+				continue
+			}
+			out := map[string]any{
+				"tag":         exportName(ep.Name, scheme, schemes),
+				"server":      ep.Host,
+				"server_port": ep.Port,
+			}
+			if scheme == "socks5" {
+				out["type"] = "socks"
+				out["version"] = "5"
+			} else {
+				out["type"] = "http"
+			}
+			if ep.Username != "" {
+				out["username"] = ep.Username
+				out["password"] = ep.Password
+			}
+			if ep.TLS {
+				out["tls"] = map[string]any{"enabled": true, "server_name": ep.Host}
+			}
+			outbounds = append(outbounds, out)
+		}
+	}
+	return json.MarshalIndent(map[string]any{"outbounds": outbounds}, "", "  ")
+}
+
+// exportName suffixes the scheme when both are exported, so names stay
+// unique.
+func exportName(name, scheme string, schemes []string) string {
+	if len(schemes) < 2 {
+		return name
+	}
+	if scheme == "socks5" {
+		return name + " (SOCKS5)"
+	}
+	return name + " (HTTP)"
+}
+
+// handleExportConfig serves /api/export?format=clash|sing-box.
+func (s *Server) handleExportConfig(w http.ResponseWriter, r *http.Request, format, scheme string) {
+	schemes := []string{scheme}
+	if scheme == "all" {
+		schemes = []string{"http", "socks5"}
+	}
+	endpoints := s.exportEndpoints(queryBool(r, "show_secrets"))
+
+	var (
+		body                  []byte
+		err                   error
+		contentType, filename string
+	)
+	switch format {
+	case ExportClash:
+		body, err = clashProvider(endpoints, schemes)
+		contentType, filename = "application/yaml; charset=utf-8", "easy_proxies_clash.yaml"
+	case ExportSingBox:
+		body, err = singBoxOutbounds(endpoints, schemes)
+		contentType, filename = "application/json", "easy_proxies_sing-box.json"
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": "invalid format, use uri/clash/sing-box"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeJSON(w, map[string]any{"error": "服务器错误"})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	_, _ = w.Write(body)
+}
+
+// exportFormat reads the format query parameter of /api/export.
+func exportFormat(r *http.Request) string {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	switch format {
+	case "singbox", "sing_box":
+		return ExportSingBox
+	case "":
+		return "uri"
+	}
+	return format
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportClashAndSingBox(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	mgr.Register(NodeInfo{Tag: "jp-1", Name: "JP 1", ListenAddress: "0.0.0.0", Port: 24000}).MarkInitialCheckDone(true)
+	mgr.Register(NodeInfo{Tag: "us-1", Name: "US 1", ListenAddress: "0.0.0.0", Port: 24001}).MarkInitialCheckDone(false)
+	s := &Server{
+		logger: log.Default(),
+		mgr:    mgr,
+		cfg:    Config{ExternalIP: "203.0.113.5", ProxyUsername: "mp", ProxyPassword: "mppass"},
+		cfgSrc: &config.Config{Mode: "hybrid", Listener: config.ListenerConfig{Address: "0.0.0.0", Port: 2323, Username: "u", Password: "secret"}},
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleExport(rec, httptest.NewRequest(http.MethodGet, "/api/export?"+query, nil))
+		return rec
+	}
+
+	rec := get("format=clash&scheme=all&show_secrets=1")
+	var provider struct {
+		Proxies []clashProxy `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(rec.Body.Bytes(), &provider); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, err %v:\n%s", rec.Code, err, rec.Body)
+	}
+	if len(provider.Proxies) != 4 {
+		t.Fatalf("want pool and the healthy node in both schemes, got %+v", provider.Proxies)
+	}
+	pool, node := provider.Proxies[0], provider.Proxies[3]
+	if pool.Name != "easy_proxies pool (HTTP)" || pool.Server != "203.0.113.5" || pool.Port != 2323 || pool.Password != "secret" {
+		t.Errorf("unexpected pool proxy %+v", pool)
+	}
+	if node.Name != "JP 1 (SOCKS5)" || node.Type != "socks5" || node.Port != 24000 || node.Username != "mp" || !node.UDP {
+		t.Errorf("unexpected node proxy %+v", node)
+	}
+
+	rec = get("format=sing-box")
+	var out struct {
+		Outbounds []map[string]any `json:"outbounds"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || len(out.Outbounds) != 2 {
+		t.Fatalf("unexpected sing-box export (err=%v):\n%s", err, rec.Body)
+	}
+	if o := out.Outbounds[1]; o["type"] != "http" || o["tag"] != "JP 1" || o["server_port"] != float64(24000) {
+		t.Errorf("unexpected outbound %v", o)
+	}
+	if strings.Contains(rec.Body.String(), "mppass") {
+		t.Error("passwords should be masked without show_secrets")
+	}
+
+	if rec := get("format=v2ray"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,386 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/users"
+)
+
+// Stats history resolutions.
+const (
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+	ResolutionDay    = "day"
+)
+
+// historySampleInterval is how often node and user counters are sampled
+// into the history.
+const historySampleInterval = time.Minute
+
+// HistoryRetention is how long each resolution of the stats history is
+// kept. A zero Minute disables the history.
+type HistoryRetention struct {
+	Minute time.Duration
+	Hour   time.Duration
+	Day    time.Duration
+}
+
+// HistoryPoint is the activity of a node or user within one bucket.
+type HistoryPoint struct {
+	Time      time.Time `json:"time"` // bucket start
+	Success   int64     `json:"success,omitempty"`
+	Failure   int64     `json:"failure,omitempty"`
+	LatencyMs int64     `json:"latency_ms,omitempty"` // mean probe latency
+	Probes    int64     `json:"probes,omitempty"`     // latency samples behind LatencyMs
+	Upload    int64     `json:"upload,omitempty"`
+	Download  int64     `json:"download,omitempty"`
+}
+
+func (p HistoryPoint) empty() bool {
+	return p.Success == 0 && p.Failure == 0 && p.Probes == 0 && p.Upload == 0 && p.Download == 0
+}
+
+func (p *HistoryPoint) merge(o HistoryPoint) {
+	if probes := p.Probes + o.Probes; probes > 0 {
+		p.LatencyMs = (p.LatencyMs*p.Probes + o.LatencyMs*o.Probes) / probes
+	}
+	p.Probes += o.Probes
+	p.Success += o.Success
+	p.Failure += o.Failure
+	p.Upload += o.Upload
+	p.Download += o.Download
+}
+
+// HistorySeries is the history of one node or user. Every sample is added
+// to the minute, hour and day buckets it falls in, so coarser resolutions
+// outlive the finer ones.
+type HistorySeries struct {
+	URI    string         `json:"uri,omitempty"` // nodes only, to follow a renamed tag
+	Minute []HistoryPoint `json:"minute,omitempty"`
+	Hour   []HistoryPoint `json:"hour,omitempty"`
+	Day    []HistoryPoint `json:"day,omitempty"`
+}
+
+// Hours and days start on the hour and at midnight in now's location,
+// which is the configured timezone.
+func (s *HistorySeries) add(now time.Time, p HistoryPoint) {
+	y, mo, d := now.Date()
+	s.Minute = addHistoryPoint(s.Minute, now.Truncate(time.Minute), p)
+	s.Hour = addHistoryPoint(s.Hour, time.Date(y, mo, d, now.Hour(), 0, 0, 0, now.Location()), p)
+	s.Day = addHistoryPoint(s.Day, time.Date(y, mo, d, 0, 0, 0, 0, now.Location()), p)
+}
+
+func addHistoryPoint(points []HistoryPoint, bucket time.Time, p HistoryPoint) []HistoryPoint {
+	if n := len(points); n > 0 && points[n-1].Time.Equal(bucket) {
+		points[n-1].merge(p)
+		return points
+	}
+	p.Time = bucket
+	return append(points, p)
+}
+
+// prune drops buckets that ended before their retention and reports
+// whether the series is empty.
+func (s *HistorySeries) prune(now time.Time, r HistoryRetention) bool {
+	s.Minute = pruneHistoryPoints(s.Minute, now.Add(-r.Minute), time.Minute)
+	s.Hour = pruneHistoryPoints(s.Hour, now.Add(-r.Hour), time.Hour)
+	s.Day = pruneHistoryPoints(s.Day, now.Add(-r.Day), 24*time.Hour)
+	return len(s.Minute) == 0 && len(s.Hour) == 0 && len(s.Day) == 0
+}
+
+func pruneHistoryPoints(points []HistoryPoint, cutoff time.Time, width time.Duration) []HistoryPoint {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Time.Add(width).After(cutoff) })
+	if i == 0 {
+		return points
+	}
+	return append([]HistoryPoint(nil), points[i:]...)
+}
+
+func (s *HistorySeries) points(resolution string) []HistoryPoint {
+	switch resolution {
+	case ResolutionMinute:
+		return s.Minute
+	case ResolutionDay:
+		return s.Day
+	}
+	return s.Hour
+}
+
+// HistorySnapshot is the stats history saved in the stats file, keyed by
+// node tag and username.
+type HistorySnapshot struct {
+	Nodes map[string]*HistorySeries `json:"nodes,omitempty"`
+	Users map[string]*HistorySeries `json:"users,omitempty"`
+}
+
+// nodeCounters are the cumulative node counters at the last sample.
+type nodeCounters struct {
+	success, failure int64
+	latencySum       time.Duration
+	latencyCount     int64
+}
+
+type historyStore struct {
+	mu        sync.Mutex
+	retention HistoryRetention
+	nodes     map[string]*HistorySeries
+	users     map[string]*HistorySeries
+	lastNodes map[string]nodeCounters
+	lastUsers map[string]users.Usage
+	loop      sync.Once
+}
+
+// SetStatsHistory sets how long the stats history is kept and starts
+// sampling once a minute. A zero retention.Minute stops sampling and drops
+// the history.
+func (m *Manager) SetStatsHistory(retention HistoryRetention) {
+	h := &m.history
+	h.mu.Lock()
+	h.retention = retention
+	if retention.Minute <= 0 {
+		h.nodes, h.users, h.lastNodes, h.lastUsers = nil, nil, nil, nil
+	}
+	h.mu.Unlock()
+	if retention.Minute <= 0 {
+		return
+	}
+	h.loop.Do(func() {
+		go func() {
+			ticker := time.NewTicker(historySampleInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case now := <-ticker.C:
+					m.sampleHistory(now)
+				}
+			}
+		}()
+	})
+}
+
+// sampleHistory adds the node and user activity since the previous sample
+// to the history. The first sample of a node or user only sets its
+// baseline, so counters restored on start do not show up as a spike.
+func (m *Manager) sampleHistory(now time.Time) {
+	m.mu.RLock()
+	counters := make(map[string]nodeCounters, len(m.nodes))
+	uris := make(map[string]string, len(m.nodes))
+	for tag, e := range m.nodes {
+		e.mu.RLock()
+		counters[tag] = nodeCounters{
+			success:      e.success,
+			failure:      int64(e.failure),
+			latencySum:   e.latencySum,
+			latencyCount: e.latencyCount,
+		}
+		uris[tag] = e.info.URI
+		e.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+	usage := users.Snapshot()
+
+	h := &m.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.retention.Minute <= 0 {
+		return
+	}
+	if h.nodes == nil {
+		h.nodes = make(map[string]*HistorySeries)
+	}
+	if h.users == nil {
+		h.users = make(map[string]*HistorySeries)
+	}
+	lastNodes := h.lastNodes
+	h.lastNodes = counters
+	for tag, cur := range counters {
+		prev, ok := lastNodes[tag]
+		if !ok {
+			continue
+		}
+		point := HistoryPoint{
+			Success: counterDelta(cur.success, prev.success),
+			Failure: counterDelta(cur.failure, prev.failure),
+			Probes:  counterDelta(cur.latencyCount, prev.latencyCount),
+		}
+		if point.Probes > 0 {
+			point.LatencyMs = time.Duration(counterDelta(int64(cur.latencySum), int64(prev.latencySum))).Milliseconds() / point.Probes
+		}
+		if point.empty() {
+			continue
+		}
+		series := h.nodes[tag]
+		if series == nil {
+			series = &HistorySeries{}
+			h.nodes[tag] = series
+		}
+		series.URI = uris[tag]
+		series.add(now, point)
+	}
+	lastUsers := h.lastUsers
+	h.lastUsers = make(map[string]users.Usage, len(usage))
+	for _, cur := range usage {
+		h.lastUsers[cur.Username] = cur
+		prev, ok := lastUsers[cur.Username]
+		if !ok {
+			continue
+		}
+		point := HistoryPoint{
+			Upload:   counterDelta(cur.Upload, prev.Upload),
+			Download: counterDelta(cur.Download, prev.Download),
+		}
+		if point.empty() {
+			continue
+		}
+		series := h.users[cur.Username]
+		if series == nil {
+			series = &HistorySeries{}
+			h.users[cur.Username] = series
+		}
+		series.add(now, point)
+	}
+	h.pruneLocked(now)
+}
+
+// counterDelta is the growth of a cumulative counter, which restarts from
+// zero when it is reset.
+func counterDelta(cur, prev int64) int64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+func (h *historyStore) pruneLocked(now time.Time) {
+	for _, list := range []map[string]*HistorySeries{h.nodes, h.users} {
+		for key, series := range list {
+			if series.prune(now, h.retention) {
+				delete(list, key)
+			}
+		}
+	}
+}
+
+// History returns the points of a node (kind "node") or user (kind "user")
+// at the given resolution that end after since. An empty key sums all nodes
+// or users. It returns nil when the history is disabled.
+func (m *Manager) History(kind, key, resolution string, since time.Time) []HistoryPoint {
+	h := &m.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.retention.Minute <= 0 {
+		return nil
+	}
+	list := h.nodes
+	if kind == "user" {
+		list = h.users
+	}
+	var series []*HistorySeries
+	if key != "" {
+		if s := list[key]; s != nil {
+			series = append(series, s)
+		}
+	} else {
+		for _, s := range list {
+			series = append(series, s)
+		}
+	}
+
+	var width time.Duration
+	switch resolution {
+	case ResolutionMinute:
+		width = time.Minute
+	case ResolutionDay:
+		width = 24 * time.Hour
+	default:
+		width = time.Hour
+	}
+	merged := make(map[time.Time]*HistoryPoint)
+	for _, s := range series {
+		for _, p := range s.points(resolution) {
+			if !p.Time.Add(width).After(since) {
+				continue
+			}
+			if acc := merged[p.Time]; acc != nil {
+				acc.merge(p)
+			} else {
+				merged[p.Time] = &p
+			}
+		}
+	}
+	points := make([]HistoryPoint, 0, len(merged))
+	for _, p := range merged {
+		points = append(points, *p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points
+}
+
+// historySnapshot copies the history for the stats file.
+func (m *Manager) historySnapshot() *HistorySnapshot {
+	h := &m.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.nodes) == 0 && len(h.users) == 0 {
+		return nil
+	}
+	snapshot := &HistorySnapshot{
+		Nodes: make(map[string]*HistorySeries, len(h.nodes)),
+		Users: make(map[string]*HistorySeries, len(h.users)),
+	}
+	for tag, s := range h.nodes {
+		snapshot.Nodes[tag] = s.clone()
+	}
+	for name, s := range h.users {
+		snapshot.Users[name] = s.clone()
+	}
+	return snapshot
+}
+
+func (s *HistorySeries) clone() *HistorySeries {
+	return &HistorySeries{
+		URI:    s.URI,
+		Minute: append([]HistoryPoint(nil), s.Minute...),
+		Hour:   append([]HistoryPoint(nil), s.Hour...),
+		Day:    append([]HistoryPoint(nil), s.Day...),
+	}
+}
+
+// restoreHistory loads the saved series of the nodes in tags, which maps a
+// saved tag to the current one, and of the users that still exist, dropping
+// what fell out of the retention.
+func (m *Manager) restoreHistory(saved *HistorySnapshot, tags map[string]string, knownUsers map[string]bool) {
+	if saved == nil {
+		return
+	}
+	h := &m.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.retention.Minute <= 0 {
+		return
+	}
+	if h.nodes == nil {
+		h.nodes = make(map[string]*HistorySeries)
+	}
+	if h.users == nil {
+		h.users = make(map[string]*HistorySeries)
+	}
+	for tag, s := range saved.Nodes {
+		if s == nil {
+			continue
+		}
+		if target := tags[tag]; target != "" {
+			h.nodes[target] = s
+		}
+	}
+	for name, s := range saved.Users {
+		if s != nil && knownUsers[name] {
+			h.users[name] = s
+		}
+	}
+	h.pruneLocked(time.Now())
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/users"
+)
+
+var testRetention = HistoryRetention{Minute: time.Hour, Hour: 48 * time.Hour, Day: 30 * 24 * time.Hour}
+
+func TestSampleHistoryRecordsDeltas(t *testing.T) {
+	users.Configure(map[string]users.Limits{"alice": {}})
+	defer users.Configure(nil)
+	m, _ := NewManager(Config{})
+	defer m.Stop()
+	m.SetStatsHistory(testRetention)
+	a := m.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	a.RecordSuccess()
+
+	start := time.Date(2026, 3, 1, 10, 0, 30, 0, time.UTC)
+	m.sampleHistory(start) // baseline: the earlier success is not counted
+
+	a.RecordSuccessWithLatency(10 * time.Millisecond)
+	a.RecordSuccessWithLatency(30 * time.Millisecond)
+	a.RecordFailure(errors.New("dial timeout"))
+	users.RestoreUsage(users.Usage{Username: "alice", Upload: 10, Download: 20})
+	m.sampleHistory(start.Add(time.Minute))
+
+	a.RecordSuccessWithLatency(50 * time.Millisecond)
+	m.sampleHistory(start.Add(2 * time.Minute))
+
+	since := start.Add(-time.Hour)
+	minutes := m.History("node", "a", ResolutionMinute, since)
+	if len(minutes) != 2 {
+		t.Fatalf("expected 2 minute points, got %+v", minutes)
+	}
+	if p := minutes[0]; p.Success != 2 || p.Failure != 1 || p.Probes != 2 || p.LatencyMs != 20 {
+		t.Fatalf("unexpected first minute %+v", p)
+	}
+	hours := m.History("node", "a", ResolutionHour, since)
+	if len(hours) != 1 {
+		t.Fatalf("expected 1 hour point, got %+v", hours)
+	}
+	if p := hours[0]; !p.Time.Equal(start.Truncate(time.Hour)) || p.Success != 3 || p.Probes != 3 || p.LatencyMs != 30 {
+		t.Fatalf("unexpected hour point %+v", p)
+	}
+	userHours := m.History("user", "alice", ResolutionHour, since)
+	if len(userHours) != 1 || userHours[0].Upload != 10 || userHours[0].Download != 20 {
+		t.Fatalf("unexpected user history %+v", userHours)
+	}
+}
+
+func TestHistoryPruneKeepsCoarserBuckets(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	var s HistorySeries
+	s.add(start, HistoryPoint{Success: 1})
+	s.add(start.Add(3*time.Hour), HistoryPoint{Success: 1})
+
+	if empty := s.prune(start.Add(3*time.Hour), testRetention); empty {
+		t.Fatal("series should not be empty")
+	}
+	if len(s.Minute) != 1 || len(s.Hour) != 2 || len(s.Day) != 1 || s.Day[0].Success != 2 {
+		t.Fatalf("unexpected buckets after prune: %+v", s)
+	}
+	if empty := s.prune(start.Add(60*24*time.Hour), testRetention); !empty {
+		t.Fatalf("expected everything to expire, got %+v", s)
+	}
+}
+
+func TestHistoryBucketsFollowTimezone(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata") // UTC+5:30
+	if err != nil {
+		t.Skip(err)
+	}
+	var s HistorySeries
+	s.add(time.Date(2026, 3, 1, 23, 50, 0, 0, time.UTC).In(kolkata), HistoryPoint{Success: 1})
+
+	hour, day := s.Hour[0].Time, s.Day[0].Time
+	if !hour.Equal(time.Date(2026, 3, 2, 5, 0, 0, 0, kolkata)) {
+		t.Errorf("hour bucket starts at %s, want 05:00 local", hour)
+	}
+	if !day.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, kolkata)) {
+		t.Errorf("day bucket starts at %s, want local midnight", day)
+	}
+}
+
+func TestHistorySumsAllNodes(t *testing.T) {
+	m, _ := NewManager(Config{})
+	defer m.Stop()
+	m.SetStatsHistory(testRetention)
+	a := m.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	b := m.Register(NodeInfo{Tag: "b", URI: "socks5://b:1080"})
+	now := time.Now()
+	m.sampleHistory(now)
+	a.RecordSuccess()
+	b.RecordSuccess()
+	b.RecordFailure(errors.New("refused"))
+	m.sampleHistory(now.Add(time.Minute))
+
+	points := m.History("node", "", ResolutionDay, now.Add(-time.Hour))
+	if len(points) != 1 || points[0].Success != 2 || points[0].Failure != 1 {
+		t.Fatalf("unexpected total %+v", points)
+	}
+	if points := m.History("node", "missing", ResolutionDay, now.Add(-time.Hour)); len(points) != 0 {
+		t.Fatalf("expected no points for unknown node, got %+v", points)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	m, _ := NewManager(Config{})
+	defer m.Stop()
+	m.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	m.sampleHistory(time.Now())
+	if points := m.History("node", "a", ResolutionHour, time.Time{}); points != nil {
+		t.Fatalf("expected nil history when disabled, got %+v", points)
+	}
+}
+
+func TestHistoryPersistsInStatsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	now := time.Now()
+
+	first, _ := NewManager(Config{})
+	first.SetStatsFile(path)
+	first.SetStatsHistory(testRetention)
+	a := first.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	first.sampleHistory(now.Add(-2 * time.Minute))
+	a.RecordSuccess()
+	first.sampleHistory(now.Add(-time.Minute))
+	first.Stop()
+
+	second, _ := NewManager(Config{})
+	defer second.Stop()
+	second.SetStatsFile(path)
+	second.SetStatsHistory(testRetention)
+	second.Register(NodeInfo{Tag: "renamed", URI: "socks5://a:1080"})
+	if _, _, err := second.RestoreStats(); err != nil {
+		t.Fatal(err)
+	}
+	points := second.History("node", "renamed", ResolutionMinute, now.Add(-time.Hour))
+	if len(points) != 1 || points[0].Success != 1 {
+		t.Fatalf("expected restored history under the new tag, got %+v", points)
+	}
+}
@@ -0,0 +1,405 @@
+package monitor
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"easy_proxies/internal/config"
+)
+
+// langCookie remembers the language picked with the WebUI switch.
+const langCookie = "lang"
+
+// messagesEN translates the WebUI and the API messages, which are written in
+// Chinese, to English. Messages with values in them are translated by the
+// fixed parts around the values; the longest match wins, so a whole phrase
+// takes precedence over the words in it.
+var messagesEN = map[string]string{
+	// WebUI: navigation and header
+	"监控中心":   "Monitor",
+	"监控看板":   "Dashboard",
+	"节点配置":   "Nodes",
+	"诊断分析":   "Diagnostics",
+	"控制台日志":  "Console Logs",
+	"系统设置":   "Settings",
+	"探测中:":   "Probing:",
+	"成功:":    "Success:",
+	"失败:":    "Failed:",
+	"切换主题":   "Toggle theme",
+	"跟随系统":   "System",
+	"深色模式":   "Dark",
+	"浅色模式":   "Light",
+	"批量探测":   "Probe All",
+	"刷新订阅":   "Refresh Subscriptions",
+	"导出配置":   "Export",
+	"关闭自动刷新": "Pause Auto-refresh",
+	"开启自动刷新": "Resume Auto-refresh",
+	"刷新":     "Refresh",
+
+	// Public status page
+	"服务正常":  "Operational",
+	"服务降级":  "Degraded",
+	"服务不可用": "Outage",
+	"正在启动":  "Starting",
+	"运行时长":  "Uptime",
+	"更新于":   "Updated",
+
+	// WebUI: dashboard
+	"总节点数":                        "Total Nodes",
+	"健康在线":                        "Healthy",
+	"活跃连接数":                       "Active Connections",
+	"当前建立会话":                      "open sessions",
+	"异常/拉黑":                       "Failing / Blacklisted",
+	"不可用节点":                       "unavailable nodes",
+	"上行速率":                        "Upload",
+	"实时上传":                        "real-time upload",
+	"下行速率":                        "Download",
+	"实时下载":                        "real-time download",
+	"地域连通率 (Region Availability)": "Region Availability",
+	"最优节点延迟 (Top Fastest Nodes)":  "Top Fastest Nodes",
+	"实时流量带宽 (Real-time Traffic)":  "Real-time Traffic",
+	"过滤:":                         "Filter:",
+	"节点监控列表":                      "Nodes",
+	"状态":                          "Status",
+	"地域":                          "Region",
+	"名称 (Name/Tag)":               "Name / Tag",
+	"延迟 / 质量":                     "Latency / Quality",
+	"连接":                          "Conns",
+	"失败":                          "Failed",
+	"操作":                          "Actions",
+	"暂无数据":                        "No data",
+	"拉黑 Blocked":                  "Blocked",
+	"未测试 Unknown":                 "Unknown",
+	"异常 Error":                    "Error",
+	"在线 Healthy":                  "Healthy",
+	"探测":                          "Probe",
+	"未测速":                         "Not tested",
+	"测速":                          "Speed Test",
+	"解封":                          "Release",
+	"拉黑":                          "Blacklist",
+	"显示 ":                         "Showing ",
+	"个节点":                         "nodes",
+	"显示更多":                        "Show more",
+	"探测中...":                      "Probing...",
+	"测速中...":                      "Testing speed...",
+	"已解封":                         "Released",
+	"确定拉黑该节点 24 小时？":              "Blacklist this node for 24 hours?",
+	"拉黑失败":                        "Failed to blacklist",
+	"探测完成: 成功":                    "Probe finished: success ",
+	", 失败":                        ", failed ",
+	"导出失败":                        "Export failed",
+	"导出文件包含明文入口密码？取消则导出隐藏密码的版本": "Include the entry passwords in clear text? Cancel exports them masked",
+	"本地节点已修改，刷新将覆盖，继续？":         "Local nodes were modified and will be overwritten. Continue?",
+	"开始刷新订阅...": "Refreshing subscriptions...",
+	"成功获取 ":     "Fetched ",
+	" 节点`":      " nodes`",
+	"成功":        "Success",
+
+	// WebUI: node configuration
+	"配置管理": "Configuration",
+	"修改配置后点击上方重载按钮生效": "Changes take effect after reloading the core",
+	"添加节点": "Add Node",
+	"编辑节点": "Edit Node",
+	"重载核心": "Reload Core",
+	"警告：当前使用订阅模式。手动修改配置将在下次订阅刷新时被覆盖。": "Warning: subscription mode is in use. Manual changes are overwritten by the next subscription refresh.",
+	"名称":   "Name",
+	"端口":   "Port",
+	"来源":   "Source",
+	"已停用":  "Disabled",
+	"编辑":   "Edit",
+	"启用":   "Enable",
+	"停用":   "Disable",
+	"删除":   "Delete",
+	"删除成功": "Deleted",
+	"？停用后该节点不再参与代理池（将重载核心）": "? It leaves the pool (the core is reloaded).",
+	"操作失败": "Operation failed",
+	"重载核心将中断连接，确认？": "Reloading the core drops active connections. Continue?",
+	"重载成功":                       "Reloaded",
+	"节点名称 Name":                  "Name",
+	"节点 URI":                     "URI",
+	"vless://... 或 anytls://...": "vless://... or anytls://...",
+	"映射端口 (可选)":                  "Port (optional)",
+	"取消":                         "Cancel",
+	"保存":                         "Save",
+	"处理中...":                     "Working...",
+
+	// WebUI: diagnostics and logs
+	"总调用次数": "Total Calls",
+	"总成功次数": "Total Successes",
+	"全局成功率": "Success Rate",
+	"全局质量分数 (Overall Health Score)": "Overall Health Score",
+	"稳定性掉线排行 (Top Unstable Nodes)":  "Top Unstable Nodes",
+	"节点质量分析":                        "Node Quality",
+	"成功率":                           "Success Rate",
+	"成功 / 失败":                       "Success / Failed",
+	"最近调用时间线":                       "Recent Calls",
+	"控制台日志 (Console Logs)":          "Console Logs",
+	"自动滚动":                          "Auto-scroll",
+
+	// WebUI: settings
+	"基础配置":                  "General",
+	"运行模式 (Mode)":           "Mode",
+	" - 单端口负载池":             " - single-port pool",
+	" - 多端口模式":              " - one port per node",
+	" - 混合模式":               " - pool and multi-port",
+	"外部 IP (External IP)":   "External IP",
+	"探测目标 (Probe Target)":   "Probe Target",
+	"跳过 SSL 证书验证":           "Skip SSL certificate verification",
+	"监听配置 (Listener)":       "Listener",
+	"监听地址":                  "Listen Address",
+	"监听端口":                  "Listen Port",
+	"用户名 (可选)":              "Username (optional)",
+	"密码 (可选)":               "Password (optional)",
+	"多端口配置 (Multi-Port)":    "Multi-Port",
+	"起始端口":                  "Base Port",
+	"节点池配置 (Pool)":          "Pool",
+	"调度模式":                  "Scheduling",
+	" - 随机":                 "",
+	" - 轮询":                 "",
+	" - 均衡":                 " - least connections",
+	" - 最低延迟":               " - lowest latency",
+	" - 加权轮询":               " - weighted round-robin",
+	" - 最高带宽":               " - highest bandwidth",
+	" - 最低费用":               " - lowest cost",
+	"故障阈值":                  "Failure Threshold",
+	"黑名单时长":                 "Blacklist Duration",
+	"粘性代理 (Sticky Session)": "Sticky Session",
+	"启用粘性代理（独立端口，按客户端来源 IP 固定上游节点）": "Enable sticky sessions (a separate port that pins each client IP to one upstream node)",
+	"粘性端口": "Sticky Port",
+	"2324（留空则为 listener 端口 +1）": "2324 (empty: listener port + 1)",
+	"仅 pool / hybrid 模式生效。开启后会额外监听一个端口，与原 listener 端口共存；通过粘性端口接入的客户端会按来源 IP 永久绑定到同一上游节点（节点失效时自动重选）。": "Pool / hybrid mode only. Opens an extra port next to the listener port; clients connecting through it stay on the same upstream node per source IP (a new one is picked when it fails).",
+	"管理面板 (Management)": "Management",
+	"访问密码":              "Password",
+	"探测并发数":             "Probe Concurrency",
+	"探测并发数：初始/周期健康检查与批量探测的并发线程数（8-1024，默认 32），节点数多时调高可加快探测，修改后需重载核心生效": "Probe concurrency: parallel probes for health checks and Probe All (8-1024, default 32). Raise it for many nodes; takes effect after reloading the core.",
+	"GeoIP 地域路由":    "GeoIP Region Routing",
+	"启用 GeoIP 地域路由": "Enable GeoIP region routing",
+	"自动更新数据库":       "Auto-update the database",
+	"数据库路径":         "Database Path",
+	"路由监听地址":        "Router Listen Address",
+	"路由端口":          "Router Port",
+	"更新间隔":          "Update Interval",
+	"首次启用会自动下载 GeoIP 数据库（约 9MB），需重载核心生效": "The GeoIP database (about 9 MB) is downloaded on first use; takes effect after reloading the core",
+	"日志配置":                     "Logging",
+	"日志输出":                     "Output",
+	"仅控制台 (stdout)":            "Console only (stdout)",
+	"控制台 + 文件 (stdout + file)": "Console and file (stdout + file)",
+	"单文件最大 MB":                 "Max File Size (MB)",
+	"保留旧日志个数":                  "Old Files Kept",
+	"保留天数":                     "Days Kept",
+	"压缩旧日志":                    "Compress old files",
+	"日志设置需重启服务生效":              "Log settings take effect after a restart",
+	"订阅配置":                     "Subscriptions",
+	"启用订阅自动刷新":                 "Refresh subscriptions automatically",
+	"刷新间隔":                     "Refresh Interval",
+	" 分钟":                      " min",
+	" 小时":                      " h",
+	"订阅链接 (每行一个 URL)":          "Subscription URLs (one per line)",
+	"订阅配置变更保存后立即生效":            "Subscription changes take effect when saved",
+	"保存配置":                     "Save",
+	"配置未变更":                    "No changes",
+	"保存中...":                   "Saving...",
+	"保存失败":                     "Save failed",
+	"更新订阅中...":                 "Updating subscriptions...",
+	"正在拉取订阅并重载节点，请稍候": "Fetching subscriptions and reloading nodes, please wait",
+	"订阅配置保存失败":        "Failed to save subscriptions",
+	"订阅已保存，但刷新失败: ":   "Subscriptions saved, but the refresh failed: ",
+	"已保存，获取 ":         "Saved, fetched ",
+	"重载核心中...":        "Reloading the core...",
+	"正在应用新配置":         "Applying the new configuration",
+	"已保存并重载成功":        "Saved and reloaded",
+	"已保存，重载失败":        "Saved, but the reload failed",
+	"身份验证":            "Sign In",
+	"系统密码":            "Password",
+	"验证授权":            "Sign In",
+
+	// API messages
+	"请求格式错误":     "Malformed request",
+	"未授权，请先登录":   "Unauthorized, please sign in",
+	"无需密码":       "No password required",
+	"密码错误":       "Wrong password",
+	"服务器错误":      "Server error",
+	"登录成功":       "Signed in",
+	"节点不存在":      "Node not found",
+	"节点名称或端口已存在": "Node name or port already exists",
+	"无效的节点配置":    "Invalid node config",
+	"节点由 expand 或 node_templates 生成，请在配置文件中修改": "The node is generated by expand or node_templates; edit it in the config file",
+	"URI 不能为空": "URI must not be empty",
+	"节点":       "Node",
+	" 已存在":     " already exists",
+	" 已被占用":    " is already in use",
+	"节点名称无效":   "Invalid node name",
+	"节点已添加，请点击重载使配置生效": "Node added, reload to apply",
+	"节点已更新，请点击重载使配置生效": "Node updated, reload to apply",
+	"节点已删除，请点击重载使配置生效": "Node deleted, reload to apply",
+	"节点已启用":                          "Node enabled",
+	"节点已停用":                          "Node disabled",
+	"节点管理未启用":                        "Node management is not enabled",
+	"配置存储未初始化":                       "Config store is not initialized",
+	"配置不可用":                          "Config unavailable",
+	"保存配置失败: ":                       "Failed to save config: ",
+	"设置已保存":                          "Settings saved",
+	"不支持按需监听":                        "On-demand ports are not supported",
+	"端口已开启":                          "Port opened",
+	"探测成功":                           "Probe succeeded",
+	"批量探测已在进行中，请稍候":                  "A batch probe is already running, please wait",
+	"测速完成":                           "Speed test finished",
+	"测速失败: ":                         "Speed test failed: ",
+	"已拉黑 ":                           "Blacklisted for ",
+	"已解除拉黑":                          "Released from the blacklist",
+	"已解除 ":                           "Released ",
+	"个节点的拉黑":                         "nodes from the blacklist",
+	"已清空连接标签统计":                      "Connection tag totals cleared",
+	"订阅刷新未启用":                        "Subscription refresh is not enabled",
+	"刷新成功":                           "Refreshed",
+	"刷新超时":                           "Refresh timed out",
+	"刷新失败: ":                         "Refresh failed: ",
+	"订阅配置已保存，但刷新失败: ":                "Subscriptions saved, but the refresh failed: ",
+	"订阅配置已更新并生效":                     "Subscriptions updated and applied",
+	"重载成功，现有连接已被中断":                  "Reloaded, existing connections were dropped",
+	"无法连接到流量统计接口":                    "Cannot connect to the traffic stats endpoint",
+	"流量统计已重置":                        "Traffic stats reset",
+	"用户不存在":                          "User not found",
+	"node 与 user 只能指定一个":             "Specify either node or user, not both",
+	"resolution 只能是 minute/hour/day": "resolution must be minute, hour or day",
+	"since 格式无效，例如 1h、72h":           "Invalid since, e.g. 1h or 72h",
+	"since 格式无效，例如 30m、24h":          "Invalid since, e.g. 30m or 24h",
+	"limit 必须是正整数":                   "limit must be a positive integer",
+	"分流设置已保存":                        "Split tunneling settings saved",
+	"分流设置已生效":                        "Split tunneling settings applied",
+	"PAC 仅在 pool/hybrid 模式下可用":       "PAC is only available in pool/hybrid mode",
+	"未启用故障注入，请以 -chaos 参数启动":         "Fault injection is not enabled, start with -chaos",
+	"无效的 latency":                    "Invalid latency",
+	"无效的 duration":                   "Invalid duration",
+	"已注入故障":                          "Fault injected",
+	"已清除故障":                          "Fault cleared",
+	"已清除全部故障":                        "All faults cleared",
+	"已重置费用统计":                        "Cost report reset",
+	"未启用集群":                          "Cluster is not enabled",
+	"集群密钥错误":                         "Wrong cluster secret",
+	"不支持连接预检":                        "Connection pre-check is not supported",
+	"network 只能是 tcp 或 udp":          "network must be tcp or udp",
+	"当前模式没有节点池入口":                    "The current mode has no pool entry",
+	"粘性代理未启用":                        "Sticky sessions are not enabled",
+	"entry 只能是 pool 或 sticky":        "entry must be pool or sticky",
+}
+
+var enReplacer = sync.OnceValue(func() *strings.Replacer {
+	keys := make([]string, 0, len(messagesEN))
+	for k := range messagesEN {
+		keys = append(keys, k)
+	}
+	// strings.Replacer tries the pairs in order at each position.
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, messagesEN[k])
+	}
+	return strings.NewReplacer(pairs...)
+})
+
+// indexEN is the WebUI page translated to English.
+var indexEN = sync.OnceValues(func() ([]byte, error) {
+	data, err := embeddedFS.ReadFile("assets/index.html")
+	if err != nil {
+		return nil, err
+	}
+	page := strings.Replace(string(data), `<html lang="zh-CN">`, `<html lang="en">`, 1)
+	return []byte(enReplacer().Replace(page)), nil
+})
+
+// localize translates a message to lang. Unknown text is kept as is.
+func localize(lang, text string) string {
+	if lang != config.LanguageEN {
+		return text
+	}
+	return enReplacer().Replace(text)
+}
+
+// language picks the language of a request: the lang query parameter or the
+// cookie set by the WebUI switch, then management.language, then the
+// browser's Accept-Language. Chinese is the default.
+func (s *Server) language(r *http.Request) string {
+	if lang := config.ParseLanguage(r.URL.Query().Get("lang")); lang != "" {
+		return lang
+	}
+	if c, err := r.Cookie(langCookie); err == nil {
+		if lang := config.ParseLanguage(c.Value); lang != "" {
+			return lang
+		}
+	}
+	if s.cfg.Language != "" {
+		return s.cfg.Language
+	}
+	return acceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// acceptLanguage returns the supported language with the highest weight in
+// an Accept-Language header.
+func acceptLanguage(header string) string {
+	best, bestQ := config.LanguageZH, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang := config.ParseLanguage(tag); lang != "" && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// langWriter carries the language of a request to writeJSON.
+type langWriter struct {
+	http.ResponseWriter
+	lang string
+}
+
+// Flush keeps server-sent events working through the wrapper.
+func (w *langWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withLanguage resolves the language of every request once, so handlers
+// can keep writing their messages in Chinese.
+func (s *Server) withLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&langWriter{ResponseWriter: w, lang: s.language(r)}, r)
+	})
+}
+
+// languageOf returns the language resolved for a response.
+func languageOf(w http.ResponseWriter) string {
+	if lw, ok := w.(*langWriter); ok {
+		return lw.lang
+	}
+	return config.LanguageZH
+}
+
+// localizeMessages translates the human-readable fields of an API response.
+func localizeMessages(lang string, payload map[string]any) map[string]any {
+	out := make(map[string]any, len(payload))
+	for k, v := range payload {
+		if text, ok := v.(string); ok && (k == "error" || k == "message") {
+			v = localize(lang, text)
+		}
+		out[k] = v
+	}
+	return out
+}
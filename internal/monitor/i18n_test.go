@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode"
+
+	"easy_proxies/internal/config"
+)
+
+func TestAcceptLanguage(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                              config.LanguageZH,
+		"en-US,en;q=0.9":                config.LanguageEN,
+		"zh-CN,zh;q=0.9,en;q=0.8":       config.LanguageZH,
+		"ja,en;q=0.5,zh;q=0.3":          config.LanguageEN,
+		"fr, de;q=0.5":                  config.LanguageZH,
+		"en;q=0, zh-TW":                 config.LanguageZH,
+		"en-GB;q=0.8, zh-Hans;q=0.9, *": config.LanguageZH,
+	} {
+		if got := acceptLanguage(header); got != want {
+			t.Errorf("acceptLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestIndexIsFullyTranslated(t *testing.T) {
+	page, err := indexEN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `<html lang="en">`) {
+		t.Fatal("the English page should declare lang=en")
+	}
+	for i, line := range strings.Split(string(page), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		if strings.ContainsFunc(line, func(r rune) bool { return unicode.Is(unicode.Han, r) }) {
+			t.Errorf("line %d is not translated: %s", i+1, strings.TrimSpace(line))
+		}
+	}
+}
+
+func TestAPIMessagesFollowLanguage(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	s := NewServer(Config{Enabled: true, Password: "secret"}, mgr, nil)
+
+	for _, tc := range []struct {
+		lang   string
+		header string
+		cookie string
+		want   string
+	}{
+		{want: "请求格式错误"},
+		{header: "en-US,en;q=0.9", want: "Malformed request"},
+		{lang: config.LanguageEN, want: "Malformed request"},
+		{lang: config.LanguageEN, cookie: "zh-CN", want: "请求格式错误"},
+	} {
+		s.cfg.Language = tc.lang
+		req := httptest.NewRequest(http.MethodPost, "/api/auth", strings.NewReader("{"))
+		if tc.header != "" {
+			req.Header.Set("Accept-Language", tc.header)
+		}
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: langCookie, Value: tc.cookie})
+		}
+		rec := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rec, req)
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["error"] != tc.want {
+			t.Errorf("%+v: got %v", tc, body["error"])
+		}
+	}
+
+	// Wrapped errors are translated phrase by phrase.
+	if got := localize(config.LanguageEN, "节点名称或端口已存在: 节点 hk-1 已存在"); got != "Node name or port already exists: Node hk-1 already exists" {
+		t.Errorf("unexpected translation %q", got)
+	}
+}
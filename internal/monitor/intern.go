@@ -0,0 +1,24 @@
+package monitor
+
+import "unique"
+
+// intern returns a canonical copy of s so identical strings repeated across
+// many entries (regions, countries, modes) share one allocation. Canonical
+// values are garbage-collected once unused. Error text is not interned: it
+// carries addresses and ports, so nearly every string is unique.
+func intern(s string) string {
+	if s == "" {
+		return ""
+	}
+	return unique.Make(s).Value()
+}
+
+// internNodeInfo interns the low-cardinality NodeInfo fields. Tag, Name and
+// URI are unique per node and are left alone.
+func internNodeInfo(info NodeInfo) NodeInfo {
+	info.Mode = intern(info.Mode)
+	info.ListenAddress = intern(info.ListenAddress)
+	info.Region = intern(info.Region)
+	info.Country = intern(info.Country)
+	return info
+}
@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/users"
+)
+
+const (
+	// limitCheckInterval is how often usage is compared with the limits;
+	// user bandwidth is averaged over this interval.
+	limitCheckInterval = 5 * time.Second
+	// maxLimitEvents is how many warnings are kept for /api/limits.
+	maxLimitEvents = 200
+)
+
+// Kinds of limit warnings.
+const (
+	LimitUserConnections   = "user_connections"   // listener.users[].max_connections
+	LimitUserBandwidth     = "user_bandwidth"     // listener.users[].rate_limit_kbps
+	LimitUserQuota         = "user_quota"         // listener.users[].quota_mb
+	LimitClientConnections = "client_connections" // listener.max_conns_per_ip
+	LimitNodeConnections   = "node_connections"   // pool.max_conns_per_node / nodes[].max_conns
+)
+
+// LimitWarning reports a limit whose usage reached the warning threshold.
+// Bandwidth is in bytes per second and quota in bytes.
+type LimitWarning struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Subject string    `json:"subject"` // user name, client IP or node tag
+	Used    int64     `json:"used"`
+	Limit   int64     `json:"limit"`
+	Percent float64   `json:"percent"`
+}
+
+type limitStore struct {
+	mu          sync.Mutex
+	percent     int
+	loop        sync.Once
+	active      map[string]LimitWarning // kind/subject -> warning, while over the threshold
+	events      []LimitWarning
+	lastTraffic map[string]int64 // user -> upload+download at the last check
+	lastCheck   time.Time
+}
+
+// SetLimitWarning sets the share of a limit, in percent, at which a warning
+// is raised. Each limit warns once when it crosses the threshold and again
+// only after falling back below it. 0 turns warnings off.
+func (m *Manager) SetLimitWarning(percent int) {
+	ls := &m.limits
+	ls.mu.Lock()
+	ls.percent = percent
+	if percent <= 0 {
+		ls.active = nil
+	}
+	ls.mu.Unlock()
+	if percent <= 0 {
+		return
+	}
+	ls.loop.Do(func() {
+		go func() {
+			ticker := time.NewTicker(limitCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case now := <-ticker.C:
+					m.checkLimits(now)
+				}
+			}
+		}()
+	})
+}
+
+// LimitWarnings returns the threshold, the limits currently over it and
+// the recent warnings, newest first.
+func (m *Manager) LimitWarnings() (percent int, active, events []LimitWarning) {
+	ls := &m.limits
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	active = make([]LimitWarning, 0, len(ls.active))
+	for _, w := range ls.active {
+		active = append(active, w)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Kind != active[j].Kind {
+			return active[i].Kind < active[j].Kind
+		}
+		return active[i].Subject < active[j].Subject
+	})
+	events = make([]LimitWarning, len(ls.events))
+	for i, w := range ls.events {
+		events[len(events)-1-i] = w
+	}
+	return ls.percent, active, events
+}
+
+// checkLimits compares the current usage of every limited user, client IP
+// and node with its limit and records the limits that crossed the threshold.
+func (m *Manager) checkLimits(now time.Time) {
+	ls := &m.limits
+	ls.mu.Lock()
+	percent := ls.percent
+	elapsed := now.Sub(ls.lastCheck)
+	lastTraffic := ls.lastTraffic
+	ls.mu.Unlock()
+	if percent <= 0 {
+		return
+	}
+
+	var usage []LimitWarning
+	observe := func(kind, subject string, used, limit int64) {
+		if limit > 0 {
+			usage = append(usage, LimitWarning{Time: now, Kind: kind, Subject: subject, Used: used, Limit: limit})
+		}
+	}
+	traffic := make(map[string]int64)
+	for _, u := range users.Snapshot() {
+		observe(LimitUserConnections, u.Username, u.Active, int64(u.MaxConnections))
+		observe(LimitUserQuota, u.Username, u.Upload+u.Download, u.Quota)
+		traffic[u.Username] = u.Upload + u.Download
+		if prev, ok := lastTraffic[u.Username]; ok && elapsed > 0 {
+			rate := float64(counterDelta(u.Upload+u.Download, prev)) / elapsed.Seconds()
+			observe(LimitUserBandwidth, u.Username, int64(rate), u.RateLimit)
+		}
+	}
+	if perIP, active := users.Clients(); perIP > 0 {
+		for addr, n := range active {
+			observe(LimitClientConnections, addr.String(), int64(n), int64(perIP))
+		}
+	}
+	m.mu.RLock()
+	for tag, e := range m.nodes {
+		observe(LimitNodeConnections, tag, int64(e.active.Load()), int64(e.info.MaxConns))
+	}
+	m.mu.RUnlock()
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.lastTraffic = traffic
+	ls.lastCheck = now
+	if ls.percent != percent {
+		return // changed meanwhile; the next check uses the new threshold
+	}
+	over := make(map[string]LimitWarning)
+	var raised []LimitWarning
+	for _, w := range usage {
+		if w.Used*100 < int64(percent)*w.Limit {
+			continue
+		}
+		w.Percent = float64(w.Used*1000/w.Limit) / 10
+		key := w.Kind + "/" + w.Subject
+		if _, already := ls.active[key]; !already {
+			raised = append(raised, w)
+		}
+		over[key] = w
+	}
+	ls.active = over
+	for _, w := range raised {
+		ls.events = append(ls.events, w)
+		if m.logger != nil {
+			m.logger.Warn(fmt.Sprintf("limit warning: %s %s at %.0f%% (%d of %d)", w.Kind, w.Subject, w.Percent, w.Used, w.Limit))
+		}
+	}
+	if n := len(ls.events) - maxLimitEvents; n > 0 {
+		ls.events = append([]LimitWarning(nil), ls.events[n:]...)
+	}
+}
+
+// handleLimits lists the limits over the warning threshold and the recent
+// warnings.
+func (s *Server) handleLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	percent, active, events := s.mgr.LimitWarnings()
+	writeJSON(w, map[string]any{"threshold": percent, "warnings": active, "events": events})
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"easy_proxies/internal/users"
+)
+
+func TestCheckLimitsWarnsOnceAboveThreshold(t *testing.T) {
+	users.Configure(map[string]users.Limits{"alice": {MaxConnections: 4, Quota: 1000, RateLimit: 100}})
+	defer users.Configure(nil)
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	node := mgr.Register(NodeInfo{Tag: "hk-1", MaxConns: 10})
+	mgr.limits.percent = 80 // SetLimitWarning without its ticker
+
+	start := time.Now()
+	mgr.checkLimits(start)
+	if _, active, events := mgr.LimitWarnings(); len(active) != 0 || len(events) != 0 {
+		t.Fatalf("nothing is near a limit yet, got %+v", active)
+	}
+
+	var releases []func()
+	for i := 0; i < 4; i++ {
+		release, err := users.Acquire("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	users.RestoreUsage(users.Usage{Username: "alice", Download: 850}) // 850 bytes in 5s: 170 B/s
+	for i := 0; i < 8; i++ {
+		node.IncActive()
+	}
+	mgr.checkLimits(start.Add(5 * time.Second))
+	_, active, events := mgr.LimitWarnings()
+	kinds := map[string]bool{}
+	for _, w := range active {
+		kinds[w.Kind] = true
+	}
+	for _, kind := range []string{LimitUserConnections, LimitUserQuota, LimitUserBandwidth, LimitNodeConnections} {
+		if !kinds[kind] {
+			t.Errorf("expected a %s warning, got %+v", kind, active)
+		}
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %+v", events)
+	}
+
+	// Still over: no new event. Connections drop below: the warning clears.
+	for _, release := range releases {
+		release()
+	}
+	mgr.checkLimits(start.Add(10 * time.Second))
+	_, active, events = mgr.LimitWarnings()
+	if len(events) != 4 {
+		t.Fatalf("a limit still over the threshold should not warn again, got %+v", events)
+	}
+	for _, w := range active {
+		if w.Kind == LimitUserConnections || w.Kind == LimitUserBandwidth {
+			t.Fatalf("%s should have cleared, got %+v", w.Kind, active)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ListenerActivator is implemented by node managers that can open lazy
+// per-node multi-port listeners on demand.
+type ListenerActivator interface {
+	ActivateListener(ctx context.Context, tag string) (uint16, error)
+}
+
+// ListenerReporter is implemented by node managers that track whether the
+// per-node multi-port listeners are bound.
+type ListenerReporter interface {
+	ListenerStatus() ListenerStatus
+}
+
+// DegradedReporter is implemented by node managers that can run on the
+// last node snapshot while nodes_file or the subscriptions are unavailable.
+type DegradedReporter interface {
+	// Degraded returns why the nodes are not current, or "" when they are.
+	Degraded() string
+}
+
+// ListenerStatus summarises the per-node multi-port listeners.
+type ListenerStatus struct {
+	Total     int               `json:"total"`
+	Listening int               `json:"listening"`
+	Idle      int               `json:"idle"` // lazy listeners not activated
+	Failed    []ListenerFailure `json:"failed"`
+}
+
+// ListenerFailure is a per-node listener that could not bind its port and
+// is being retried.
+type ListenerFailure struct {
+	Tag      string    `json:"tag"`
+	Port     uint16    `json:"port"`
+	Error    string    `json:"error"`
+	Since    time.Time `json:"since"`
+	Attempts int       `json:"attempts"`
+}
+
+// handleStatus reports the overall health of the running instance.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	total, available := 0, 0
+	var idleClosed int64
+	for _, snap := range s.mgr.Snapshot() {
+		total++
+		if snap.Available && !snap.Blacklisted {
+			available++
+		}
+		idleClosed += snap.IdleClosed
+	}
+	resp := map[string]any{
+		"nodes_total":     total,
+		"nodes_available": available,
+		"idle_closed":     idleClosed,
+	}
+	if reporter, ok := s.nodeMgr.(ListenerReporter); ok {
+		status := reporter.ListenerStatus()
+		if status.Failed == nil {
+			status.Failed = []ListenerFailure{}
+		}
+		resp["listeners"] = status
+	}
+	if reporter, ok := s.nodeMgr.(DegradedReporter); ok {
+		reason := reporter.Degraded()
+		resp["degraded"] = reason != ""
+		if reason != "" {
+			resp["degraded_reason"] = reason
+		}
+	}
+	writeJSON(w, resp)
+}
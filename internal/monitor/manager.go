@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -12,6 +13,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"easy_proxies/internal/clock"
+
 	M "github.com/sagernet/sing/common/metadata"
 )
 
@@ -26,18 +29,31 @@ type Config struct {
 	ExternalIP       string // 外部 IP 地址，用于导出时替换 0.0.0.0
 	SkipCertVerify   bool   // 全局跳过 SSL 证书验证
 	ProbeConcurrency int    // 并发探测线程数（批量探测与周期健康检查共用）
+	Freebind         bool   // 允许监听尚未分配到本机的地址
+	Language         string // WebUI 与 API 提示语言，空则按 Accept-Language
+	// StatusPage serves the public status page when its Listen is set.
+	StatusPage StatusPageConfig
+	// TLS serves the WebUI and API over HTTPS when set.
+	TLS *tls.Config
 }
 
 // NodeInfo is static metadata about a proxy entry.
 type NodeInfo struct {
 	Tag           string `json:"tag"`
 	Name          string `json:"name"`
+	DisplayName   string `json:"display_name,omitempty"` // name as configured; Name differs when duplicates were suffixed
 	URI           string `json:"uri"`
 	Mode          string `json:"mode"`
 	ListenAddress string `json:"listen_address,omitempty"`
 	Port          uint16 `json:"port,omitempty"`
-	Region        string `json:"region,omitempty"`  // GeoIP region code: "jp", "kr", "us", "hk", "tw", "other"
-	Country       string `json:"country,omitempty"` // Full country name from GeoIP
+	Region        string `json:"region,omitempty"`    // GeoIP region code: "jp", "kr", "us", "hk", "tw", "other"
+	Country       string `json:"country,omitempty"`   // Full country name from GeoIP
+	MaxConns      int    `json:"max_conns,omitempty"` // concurrent connection cap, 0 = unlimited
+	// CostPerGB and CostPerHour are what the node costs; see CostReport.
+	CostPerGB   float64 `json:"cost_per_gb,omitempty"`
+	CostPerHour float64 `json:"cost_per_hour,omitempty"`
+	// Standby nodes are probed but only used when too few others are up.
+	Standby bool `json:"standby,omitempty"`
 }
 
 // TimelineEvent represents a single usage event for debug tracking.
@@ -63,6 +79,8 @@ type Snapshot struct {
 	LastSuccess       time.Time       `json:"last_success,omitempty"`
 	LastProbeLatency  time.Duration   `json:"last_probe_latency,omitempty"`
 	LastLatencyMs     int64           `json:"last_latency_ms"`
+	BandwidthMbps     float64         `json:"bandwidth_mbps,omitempty"` // latest successful speed test
+	IdleClosed        int64           `json:"idle_closed"`              // tunnels closed for carrying no traffic
 	Available         bool            `json:"available"`
 	InitialCheckDone  bool            `json:"initial_check_done"`
 	Timeline          []TimelineEvent `json:"timeline,omitempty"`
@@ -70,29 +88,47 @@ type Snapshot struct {
 
 type probeFunc func(ctx context.Context) (time.Duration, error)
 type releaseFunc func()
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
 
 type EntryHandle struct {
 	ref *entry
 }
 
+// entry is kept compact because one exists per node and aggregated lists
+// can reach tens of thousands of nodes: small fields are grouped to avoid
+// padding, repeated strings are interned, and the timeline is allocated on
+// the first event rather than up front.
 type entry struct {
 	info             NodeInfo
-	failure          int
-	success          int64
-	timeline         []TimelineEvent
-	blacklist        bool
 	until            time.Time
-	lastError        string
+	since            time.Time // when the current blacklist was set
 	lastFail         time.Time
 	lastOK           time.Time
+	lastError        string
+	timeline         []TimelineEvent
+	speeds           []SpeedTestResult
+	success          int64
 	lastProbe        time.Duration
-	active           atomic.Int32
+	latencySum       time.Duration // all probe latencies, for stats history
+	latencyCount     int64
+	bandwidth        float64      // Mbit/s of the latest successful speed test
+	traffic          atomic.Int64 // bytes carried since billedSince
+	billedSince      time.Time    // start of the cost report period
+	idleClosed       atomic.Int64 // tunnels closed by pool.idle_timeout
 	probe            probeFunc
 	release          releaseFunc
 	blacklistFn      func(time.Duration)
+	healthFn         func(unhealthy bool)
+	dial             dialFunc
+	mu               sync.RWMutex
+	failure          int32
+	active           atomic.Int32
+	blacklist        bool
+	manual           bool // blacklisted through the API
 	initialCheckDone bool
 	available        bool
-	mu               sync.RWMutex
+	unhealthy        bool      // out of rotation after failed health checks
+	healthSince      time.Time // when unhealthy last changed
 }
 
 // Manager aggregates all node states for the UI/API.
@@ -108,6 +144,14 @@ type Manager struct {
 	ctx              context.Context
 	cancel           context.CancelFunc
 	logger           Logger
+	blacklist        blacklistStore
+	stats            statsStore
+	history          historyStore
+	speed            speedTestStore
+	limits           limitStore
+	slo              sloStore
+	cluster          clusterStore
+	started          time.Time
 }
 
 // Logger interface for logging
@@ -177,6 +221,8 @@ func NewManager(cfg Config) (*Manager, error) {
 		ctx:              ctx,
 		cancel:           cancel,
 		probeConcurrency: clampProbeConcurrency(cfg.ProbeConcurrency),
+		speed:            speedTestStore{slot: make(chan struct{}, 1)},
+		started:          time.Now(),
 	}
 	m.probeDst, m.probeHost, m.probeTLS, m.probeReady = resolveProbeTarget(cfg.ProbeTarget, cfg.SkipCertVerify)
 	return m, nil
@@ -215,6 +261,13 @@ func (m *Manager) SetProbeTarget(probeTarget string, skipCertVerify bool) {
 	m.mu.Unlock()
 }
 
+// clockCheckInterval and clockJumpThreshold tune how wall clock steps and
+// system suspends are noticed by the periodic health check.
+const (
+	clockCheckInterval = 30 * time.Second
+	clockJumpThreshold = time.Minute
+)
+
 // StartPeriodicHealthCheck starts a background goroutine that periodically checks all nodes.
 // interval: how often to check (e.g., 30 * time.Second)
 // timeout: timeout for each probe (e.g., 10 * time.Second)
@@ -231,6 +284,15 @@ func (m *Manager) StartPeriodicHealthCheck(interval, timeout time.Duration) {
 		return
 	}
 
+	// After a suspend or a wall clock step the last results are stale and
+	// the ticker may be far from due, so probe again right away.
+	clock.Watch(m.ctx, clockCheckInterval, clockJumpThreshold, func(jump clock.Jump) {
+		if m.logger != nil {
+			m.logger.Warn("clock jump detected (wall ", jump.Wall.Round(time.Second), ", suspended ", jump.Suspend.Round(time.Second), "), re-probing all nodes")
+		}
+		m.probeAllNodes(timeout)
+	})
+
 	go func() {
 		// 启动后立即进行一次检查
 		m.probeAllNodes(timeout)
@@ -326,7 +388,7 @@ func (m *Manager) probeAllNodes(timeout time.Duration) {
 			} else {
 				availableCount.Add(1)
 				entry.lastOK = time.Now()
-				entry.lastProbe = latency
+				entry.setLatencyLocked(latency)
 				entry.available = true
 				entry.initialCheckDone = true
 			}
@@ -344,8 +406,15 @@ func (m *Manager) probeAllNodes(timeout time.Duration) {
 	}
 }
 
-// Stop stops the periodic health check.
+// Stop stops the periodic health check and saves the blacklist and the
+// usage counters.
 func (m *Manager) Stop() {
+	if err := m.SaveBlacklist(); err != nil && m.logger != nil {
+		m.logger.Warn("save blacklist: ", err)
+	}
+	if err := m.SaveStats(); err != nil && m.logger != nil {
+		m.logger.Warn("save stats: ", err)
+	}
 	if m.cancel != nil {
 		m.cancel()
 	}
@@ -363,12 +432,10 @@ func parsePort(value string) uint16 {
 func (m *Manager) Register(info NodeInfo) *EntryHandle {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	info = internNodeInfo(info)
 	e, ok := m.nodes[info.Tag]
 	if !ok {
-		e = &entry{
-			info:     info,
-			timeline: make([]TimelineEvent, 0, maxTimelineSize),
-		}
+		e = &entry{info: info, billedSince: time.Now()}
 		m.nodes[info.Tag] = e
 	} else {
 		e.info = info
@@ -384,6 +451,27 @@ func (m *Manager) ClearNodes() {
 	m.nodes = make(map[string]*entry)
 }
 
+// RetainNodes removes every registered node whose tag is not in keep.
+// Used by incremental reloads so unchanged nodes keep their history.
+func (m *Manager) RetainNodes(keep map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tag := range m.nodes {
+		if !keep[tag] {
+			delete(m.nodes, tag)
+		}
+	}
+}
+
+// RemoveNodes drops the entries of tags, for nodes removed without a rebuild.
+func (m *Manager) RemoveNodes(tags []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tag := range tags {
+		delete(m.nodes, tag)
+	}
+}
+
 // DestinationForProbe exposes the configured destination for health checks.
 // host is the probe target's hostname (used as TLS SNI); useTLS is true when
 // the probe must perform a TLS handshake with strict certificate verification.
@@ -470,7 +558,7 @@ func (m *Manager) Probe(ctx context.Context, tag string) (time.Duration, error)
 		e.available = false
 	} else {
 		e.lastOK = time.Now()
-		e.lastProbe = latency
+		e.setLatencyLocked(latency)
 		e.available = true
 	}
 	e.mu.Unlock()
@@ -490,6 +578,8 @@ func (m *Manager) Release(tag string) error {
 		return errors.New("release not available for this node")
 	}
 	e.release()
+	m.noteRelease(e.info.URI)
+	_ = m.SaveBlacklist()
 	return nil
 }
 
@@ -508,10 +598,29 @@ func (m *Manager) ManualBlacklist(tag string, duration time.Duration) error {
 		fn(duration)
 	}
 	// Also mark in monitor state (affects UI display)
-	e.blacklistUntil(time.Now().Add(duration))
+	e.blacklistUntil(clock.Now().Add(duration))
+	e.mu.Lock()
+	e.manual = true
+	e.mu.Unlock()
+	_ = m.SaveBlacklist()
 	return nil
 }
 
+// DialNode dials address through the node tag, bypassing pool selection.
+func (m *Manager) DialNode(ctx context.Context, tag, network, address string) (net.Conn, error) {
+	e, err := m.entry(tag)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	fn := e.dial
+	e.mu.RUnlock()
+	if fn == nil {
+		return nil, errors.New("dial not available for this node")
+	}
+	return fn(ctx, network, address)
+}
+
 func (m *Manager) entry(tag string) (*entry, error) {
 	m.mu.RLock()
 	e, ok := m.nodes[tag]
@@ -542,16 +651,18 @@ func (e *entry) snapshot() Snapshot {
 
 	return Snapshot{
 		NodeInfo:          e.info,
-		FailureCount:      e.failure,
+		FailureCount:      int(e.failure),
 		SuccessCount:      e.success,
 		Blacklisted:       e.blacklist,
-		BlacklistedUntil:  e.until,
+		BlacklistedUntil:  clock.Wall(e.until),
 		ActiveConnections: e.active.Load(),
 		LastError:         e.lastError,
 		LastFailure:       e.lastFail,
 		LastSuccess:       e.lastOK,
 		LastProbeLatency:  e.lastProbe,
 		LastLatencyMs:     latencyMs,
+		BandwidthMbps:     e.bandwidth,
+		IdleClosed:        e.idleClosed.Load(),
 		Available:         e.available,
 		InitialCheckDone:  e.initialCheckDone,
 		Timeline:          timelineCopy,
@@ -576,12 +687,19 @@ func (e *entry) recordSuccess() {
 	e.appendTimelineLocked(true, 0, "")
 }
 
+// setLatencyLocked records the latency of a successful probe.
+func (e *entry) setLatencyLocked(latency time.Duration) {
+	e.lastProbe = latency
+	e.latencySum += latency
+	e.latencyCount++
+}
+
 func (e *entry) recordSuccessWithLatency(latency time.Duration) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.success++
 	e.lastOK = time.Now()
-	e.lastProbe = latency
+	e.setLatencyLocked(latency)
 	latencyMs := latency.Milliseconds()
 	if latencyMs == 0 && latency > 0 {
 		latencyMs = 1
@@ -596,6 +714,9 @@ func (e *entry) appendTimelineLocked(success bool, latencyMs int64, errStr strin
 		LatencyMs: latencyMs,
 		Error:     errStr,
 	}
+	if e.timeline == nil {
+		e.timeline = make([]TimelineEvent, 0, maxTimelineSize)
+	}
 	if len(e.timeline) >= maxTimelineSize {
 		copy(e.timeline, e.timeline[1:])
 		e.timeline[len(e.timeline)-1] = evt
@@ -605,16 +726,36 @@ func (e *entry) appendTimelineLocked(success bool, latencyMs int64, errStr strin
 }
 
 func (e *entry) blacklistUntil(until time.Time) {
+	e.adoptBlacklist(until, clock.Now(), false)
+}
+
+// adoptBlacklist sets a blacklist that started at since, which may be
+// earlier than now when it was taken over from a cluster peer.
+func (e *entry) adoptBlacklist(until, since time.Time, manual bool) {
 	e.mu.Lock()
 	e.blacklist = true
+	e.manual = manual
 	e.until = until
+	e.since = since
+	e.mu.Unlock()
+}
+
+func (e *entry) adoptHealth(unhealthy bool, since time.Time) {
+	e.mu.Lock()
+	e.unhealthy = unhealthy
+	e.healthSince = since
+	if unhealthy {
+		e.available = false
+	}
 	e.mu.Unlock()
 }
 
 func (e *entry) clearBlacklist() {
 	e.mu.Lock()
 	e.blacklist = false
+	e.manual = false
 	e.until = time.Time{}
+	e.since = time.Time{}
 	e.mu.Unlock()
 }
 
@@ -662,7 +803,8 @@ func (h *EntryHandle) RecordSuccessWithLatency(latency time.Duration) {
 	h.ref.recordSuccessWithLatency(latency)
 }
 
-// Blacklist marks the node unavailable until the given deadline.
+// Blacklist marks the node unavailable until the given deadline, a time
+// from clock.Now.
 func (h *EntryHandle) Blacklist(until time.Time) {
 	if h == nil || h.ref == nil {
 		return
@@ -694,6 +836,14 @@ func (h *EntryHandle) DecActive() {
 	h.ref.decActive()
 }
 
+// AddIdleClosed counts a tunnel closed for being idle too long.
+func (h *EntryHandle) AddIdleClosed() {
+	if h == nil || h.ref == nil {
+		return
+	}
+	h.ref.idleClosed.Add(1)
+}
+
 // SetProbe assigns a probe function.
 func (h *EntryHandle) SetProbe(fn func(ctx context.Context) (time.Duration, error)) {
 	if h == nil || h.ref == nil {
@@ -720,6 +870,41 @@ func (h *EntryHandle) SetBlacklistFn(fn func(time.Duration)) {
 	h.ref.mu.Unlock()
 }
 
+// SetHealthFn assigns the function that takes the node out of rotation, or
+// puts it back, on a health verdict from a cluster peer.
+func (h *EntryHandle) SetHealthFn(fn func(unhealthy bool)) {
+	if h == nil || h.ref == nil {
+		return
+	}
+	h.ref.mu.Lock()
+	h.ref.healthFn = fn
+	h.ref.mu.Unlock()
+}
+
+// MarkUnhealthy records that active health checks took the node out of
+// rotation or put it back, for the cluster peers.
+func (h *EntryHandle) MarkUnhealthy(unhealthy bool) {
+	if h == nil || h.ref == nil {
+		return
+	}
+	h.ref.mu.Lock()
+	if h.ref.unhealthy != unhealthy {
+		h.ref.unhealthy = unhealthy
+		h.ref.healthSince = clock.Now()
+	}
+	h.ref.mu.Unlock()
+}
+
+// SetDialer assigns a function that dials through this node only.
+func (h *EntryHandle) SetDialer(fn func(ctx context.Context, network, address string) (net.Conn, error)) {
+	if h == nil || h.ref == nil {
+		return
+	}
+	h.ref.mu.Lock()
+	h.ref.dial = fn
+	h.ref.mu.Unlock()
+}
+
 // MarkInitialCheckDone marks the initial health check as completed.
 func (h *EntryHandle) MarkInitialCheckDone(available bool) {
 	if h == nil || h.ref == nil {
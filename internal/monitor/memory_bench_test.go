@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// BenchmarkRegisterNodesMemory registers a large aggregated node list and
+// reports the retained heap per node. Timelines are only allocated for
+// nodes with an event, so the node list is measured with no failing node,
+// with one in a hundred failing (a healthy list) and with every node
+// failing (the worst case).
+//
+//	go test ./internal/monitor -run '^$' -bench RegisterNodesMemory -benchtime 1x
+func BenchmarkRegisterNodesMemory(b *testing.B) {
+	for _, bc := range []struct {
+		name      string
+		failEvery int // every failEvery-th node records a failure, 0 for none
+	}{
+		{"idle", 0},
+		{"1pct-failing", 100},
+		{"all-failing", 1},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			benchmarkRegisterNodesMemory(b, bc.failEvery)
+		})
+	}
+}
+
+func benchmarkRegisterNodesMemory(b *testing.B, failEvery int) {
+	const nodes = 50000
+	regions := []string{"jp", "kr", "us", "hk", "tw", "other"}
+	countries := []string{"Japan", "Korea", "United States", "Hong Kong", "Taiwan", "Other"}
+	probeErr := errors.New("dial tcp: i/o timeout")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		mgr, _ := NewManager(Config{})
+		for n := 0; n < nodes; n++ {
+			tag := fmt.Sprintf("node-%d", n)
+			handle := mgr.Register(NodeInfo{
+				Tag:           tag,
+				Name:          tag,
+				URI:           fmt.Sprintf("trojan://password@203.0.113.%d:%d#%s", n%250, 10000+n%50000, tag),
+				Mode:          "hybrid",
+				ListenAddress: "0.0.0.0",
+				Port:          uint16(24000 + n%40000),
+				Region:        regions[n%len(regions)],
+				Country:       countries[n%len(countries)],
+			})
+			if failEvery > 0 && n%failEvery == 0 {
+				handle.RecordFailure(probeErr)
+			}
+		}
+
+		runtime.GC()
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/nodes, "B/node")
+		runtime.KeepAlive(mgr)
+	}
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"easy_proxies/internal/config"
+)
+
+// handlePAC serves a proxy auto-config script that points browsers at the
+// pool entry. It needs no login, since browsers fetch PAC files without
+// credentials; the script only holds the entry address, never the proxy
+// username or password.
+func (s *Server) handlePAC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.cfgMu.RLock()
+	mode := ""
+	var listenerCfg config.ListenerConfig
+	var rules []config.RuleConfig
+	if s.cfgSrc != nil {
+		mode = s.cfgSrc.Mode
+		listenerCfg = s.cfgSrc.Listener
+		rules = s.cfgSrc.Rules
+	}
+	s.cfgMu.RUnlock()
+
+	if (mode != "pool" && mode != "hybrid") || listenerCfg.Port == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": "PAC 仅在 pool/hybrid 模式下可用"})
+		return
+	}
+
+	host := listenerCfg.Address
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		if extIP, _, _, _ := s.getSettings(); extIP != "" {
+			host = extIP
+		} else if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			// The host the client reached the management API on is the
+			// best guess at an address it can reach the pool on too.
+			host = h
+		} else {
+			host = r.Host
+		}
+	}
+	proxy := "PROXY " + net.JoinHostPort(host, strconv.Itoa(int(listenerCfg.Port)))
+	if listenerCfg.TLS.Enabled() {
+		proxy = "HTTPS " + net.JoinHostPort(host, strconv.Itoa(int(listenerCfg.Port)))
+	}
+
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write([]byte(pacScript(proxy, rules)))
+}
+
+// pacScript builds the PAC script for proxy. Rules are translated in order
+// up to the last direct rule, since anything after it goes to the pool
+// anyway. Conditions a browser cannot evaluate (geoip, IPv6 ip_cidr) are
+// left out, and so are rules by HTTP method; ip_cidr, like in the pool, only
+// matches IP-address hosts.
+func pacScript(proxy string, rules []config.RuleConfig) string {
+	last := -1
+	for idx, rule := range rules {
+		if rule.Group == config.RuleGroupDirect && len(rule.Method) == 0 {
+			last = idx
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("// Generated by easy_proxies.\n")
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	b.WriteString("  if (isPlainHostName(host) || host == \"localhost\" || host == \"127.0.0.1\" || host == \"::1\") return \"DIRECT\";\n")
+	if last >= 0 {
+		b.WriteString("  var ipv4 = /^\\d+\\.\\d+\\.\\d+\\.\\d+$/.test(host);\n")
+	}
+	for idx, rule := range rules[:last+1] {
+		conds := pacConditions(rule)
+		if len(conds) == 0 {
+			continue
+		}
+		target := proxy
+		if rule.Group == config.RuleGroupDirect {
+			target = "DIRECT"
+		}
+		fmt.Fprintf(&b, "  // rules[%d] -> %s\n", idx, rule.Group)
+		fmt.Fprintf(&b, "  if (%s) return %q;\n", strings.Join(conds, " ||\n      "), target)
+	}
+	fmt.Fprintf(&b, "  return %q;\n", proxy)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func pacConditions(rule config.RuleConfig) []string {
+	if len(rule.Method) > 0 {
+		return nil
+	}
+	var conds []string
+	for _, suffix := range rule.DomainSuffix {
+		suffix = strings.ToLower(strings.Trim(strings.TrimSpace(suffix), "."))
+		if suffix == "" {
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("host == %s || dnsDomainIs(host, %s)", strconv.Quote(suffix), strconv.Quote("."+suffix)))
+	}
+	for _, keyword := range rule.DomainKeyword {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" {
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("host.indexOf(%s) >= 0", strconv.Quote(keyword)))
+	}
+	for _, cidr := range rule.IPCIDR {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if !prefix.Addr().Is4() {
+			continue
+		}
+		mask := net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+		conds = append(conds, fmt.Sprintf("(ipv4 && isInNet(host, %q, %q))", prefix.Masked().Addr().String(), mask))
+	}
+	return conds
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/config"
+)
+
+func TestPACScriptFollowsRules(t *testing.T) {
+	script := pacScript("PROXY 10.0.0.1:2323", []config.RuleConfig{
+		{DomainSuffix: []string{"corp.example.com"}, IPCIDR: []string{"192.168.0.0/16", "fd00::/8"}, Group: "direct"},
+		{DomainKeyword: []string{"video"}, Group: "us"},
+		{GeoIP: []string{"CN"}, Group: "direct"},
+		{DomainSuffix: []string{"intranet"}, Group: "direct"},
+		{DomainSuffix: []string{"after.example.com"}, Group: "us"},
+		// Browsers cannot see the method, so this rule is left out.
+		{DomainSuffix: []string{"api.example.com"}, Method: []string{"POST"}, Group: "direct"},
+	})
+	for _, want := range []string{
+		`dnsDomainIs(host, ".corp.example.com")`,
+		`isInNet(host, "192.168.0.0", "255.255.0.0")`,
+		`host.indexOf("video") >= 0) return "PROXY 10.0.0.1:2323"`,
+		`host == "intranet"`,
+		`return "PROXY 10.0.0.1:2323";` + "\n}",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %s:\n%s", want, script)
+		}
+	}
+	for _, unwanted := range []string{"fd00", "rules[2]", "after.example.com", "api.example.com"} {
+		if strings.Contains(script, unwanted) {
+			t.Errorf("script should not contain %s:\n%s", unwanted, script)
+		}
+	}
+	// The video rule comes before the direct ones and must keep its place.
+	if strings.Index(script, "video") > strings.Index(script, "intranet") {
+		t.Errorf("rules out of order:\n%s", script)
+	}
+}
+
+func TestHandlePAC(t *testing.T) {
+	s := &Server{logger: log.Default()}
+	get := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/proxy.pac", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		s.handlePAC(rec, req)
+		return rec
+	}
+
+	s.cfgSrc = &config.Config{Mode: "multi-port"}
+	if rec := get("proxy.lan:9091"); rec.Code != http.StatusNotFound {
+		t.Fatalf("multi-port mode has no pool entry, got %d", rec.Code)
+	}
+
+	s.cfgSrc = &config.Config{Mode: "pool", Listener: config.ListenerConfig{Address: "0.0.0.0", Port: 2323, Username: "u", Password: "secret"}}
+	rec := get("proxy.lan:9091")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ns-proxy-autoconfig" {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"PROXY proxy.lan:2323"`) || strings.Contains(body, "secret") {
+		t.Fatalf("unexpected script:\n%s", body)
+	}
+
+	s.cfg.ExternalIP = "203.0.113.5"
+	if body := get("proxy.lan:9091").Body.String(); !strings.Contains(body, `"PROXY 203.0.113.5:2323"`) {
+		t.Fatalf("external_ip should win over the request host:\n%s", body)
+	}
+}
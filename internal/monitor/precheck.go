@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"easy_proxies/internal/users"
+)
+
+// Entries of the pool that /api/precheck can predict.
+const (
+	EntryPool   = "pool"
+	EntrySticky = "sticky"
+)
+
+// RouteQuery describes a connection a client is about to open.
+type RouteQuery struct {
+	Entry   string    // EntryPool or EntrySticky
+	Network string    // "tcp" or "udp"
+	Client  string    // client IP, which sticky pools pin by
+	User    string    // proxy user, whose credential tier limits the nodes
+	Pin     users.Pin // node or group the connection is pinned to
+}
+
+// RoutePrediction is the node a connection would go through.
+type RoutePrediction struct {
+	// Node is the tag of the node, or "" when the pool picks at random.
+	Node string
+	// Candidates are the tags of the nodes the connection may use.
+	Candidates []string
+}
+
+// RoutePredictor is implemented by node managers that can tell which node
+// the pool would pick for a connection without opening it.
+type RoutePredictor interface {
+	PredictRoute(q RouteQuery) (RoutePrediction, error)
+}
+
+// Precheck is the answer of /api/precheck.
+type Precheck struct {
+	Entry      string    `json:"entry"`
+	Network    string    `json:"network"`
+	Pin        string    `json:"pin,omitempty"`
+	Node       *NodeInfo `json:"node,omitempty"`
+	LatencyMs  int64     `json:"latency_ms,omitempty"`
+	Exit       *ExitIP   `json:"exit,omitempty"`
+	Candidates int       `json:"candidates"`
+	// Predictable is false in random mode, where no node is named.
+	Predictable bool `json:"predictable"`
+}
+
+// handlePrecheck tells a client which node its next connection would use
+// and where that node exits. Besides a management session it accepts the
+// proxy credentials as HTTP Basic auth, including a pinning suffix, so
+// client SDKs can call it with what they already have.
+func (s *Server) handlePrecheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	user, pin, ok := s.precheckAuth(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="easy_proxies"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]any{"error": "未授权，请先登录"})
+		return
+	}
+	predictor, ok := s.nodeMgr.(RoutePredictor)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		writeJSON(w, map[string]any{"error": "不支持连接预检"})
+		return
+	}
+
+	query := r.URL.Query()
+	q := RouteQuery{Entry: EntryPool, Network: "tcp", User: user, Pin: pin}
+	if entry := strings.ToLower(query.Get("entry")); entry != "" {
+		q.Entry = entry
+	}
+	if network := strings.ToLower(query.Get("network")); network != "" {
+		q.Network = network
+	}
+	if node := query.Get("node"); node != "" {
+		q.Pin = users.Pin{Node: node}
+	} else if group := query.Get("group"); group != "" {
+		q.Pin = users.Pin{Group: group}
+	}
+	if q.Network != "tcp" && q.Network != "udp" {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": "network 只能是 tcp 或 udp"})
+		return
+	}
+	if err := s.precheckEntry(q.Entry); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": err.Error()})
+		return
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		q.Client = host
+	}
+
+	prediction, err := predictor.PredictRoute(q)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		writeJSON(w, map[string]any{"error": err.Error()})
+		return
+	}
+	result := Precheck{
+		Entry:       q.Entry,
+		Network:     q.Network,
+		Candidates:  len(prediction.Candidates),
+		Predictable: prediction.Node != "",
+	}
+	if !q.Pin.IsZero() {
+		result.Pin = q.Pin.String()
+	}
+	if prediction.Node != "" {
+		if snap, ok := s.mgr.snapshotOf(prediction.Node); ok {
+			info := snap.NodeInfo
+			info.URI = ""
+			result.Node = &info
+			if snap.LastLatencyMs > 0 {
+				result.LatencyMs = snap.LastLatencyMs
+			}
+			exit := s.lookupExitIP(r.Context(), snap.NodeInfo, false)
+			result.Exit = &exit
+		}
+	}
+	writeJSON(w, result)
+}
+
+// precheckAuth accepts a management session or the proxy credentials, and
+// returns the proxy user and the pin carried by its username.
+func (s *Server) precheckAuth(r *http.Request) (string, users.Pin, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		if header := r.Header.Get("Proxy-Authorization"); header != "" {
+			probe := &http.Request{Header: http.Header{"Authorization": {header}}}
+			username, password, ok = probe.BasicAuth()
+		}
+	}
+	if ok {
+		name, pin := users.SplitPinned(username)
+		s.cfgMu.RLock()
+		var accounts map[string]string
+		if s.cfgSrc != nil {
+			accounts = make(map[string]string)
+			for _, u := range s.cfgSrc.ListenerUsers() {
+				accounts[u.Username] = u.Password
+			}
+		}
+		s.cfgMu.RUnlock()
+		if want, found := accounts[name]; found && secureCompareStrings(password, want) {
+			return name, pin, true
+		}
+	}
+	return "", users.Pin{}, s.authorized(r)
+}
+
+// precheckEntry checks that entry is served in the current mode.
+func (s *Server) precheckEntry(entry string) error {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	cfg := s.cfgSrc
+	if cfg == nil || (cfg.Mode != "pool" && cfg.Mode != "hybrid") {
+		return errors.New("当前模式没有节点池入口")
+	}
+	switch entry {
+	case EntryPool:
+		return nil
+	case EntrySticky:
+		if !cfg.Sticky.Enabled {
+			return errors.New("粘性代理未启用")
+		}
+		return nil
+	}
+	return errors.New("entry 只能是 pool 或 sticky")
+}
+
+// snapshotOf returns the state of the registered node tag.
+func (m *Manager) snapshotOf(tag string) (Snapshot, bool) {
+	m.mu.RLock()
+	e, ok := m.nodes[tag]
+	m.mu.RUnlock()
+	if !ok {
+		return Snapshot{}, false
+	}
+	return e.snapshot(), true
+}
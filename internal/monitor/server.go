@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/subtle"
+	"crypto/tls"
 	"embed"
 	"encoding/hex"
 	"encoding/json"
@@ -11,15 +12,22 @@ import (
 	"fmt"
 	"log"
 	mathrand "math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"easy_proxies/internal/accesslog"
 	"easy_proxies/internal/config"
+	"easy_proxies/internal/freebind"
 	"easy_proxies/internal/geoip"
+	"easy_proxies/internal/handoff"
+	"easy_proxies/internal/redact"
+	"easy_proxies/internal/users"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -47,6 +55,9 @@ var (
 	ErrNodeNotFound = errors.New("节点不存在")
 	ErrNodeConflict = errors.New("节点名称或端口已存在")
 	ErrInvalidNode  = errors.New("无效的节点配置")
+	// ErrNodeGenerated is returned when editing a node generated by an
+	// expand stanza or node template, which only the config file can change.
+	ErrNodeGenerated = errors.New("节点由 expand 或 node_templates 生成，请在配置文件中修改")
 )
 
 // SubscriptionRefresher interface for subscription manager.
@@ -89,6 +100,8 @@ type Server struct {
 
 	subRefresher SubscriptionRefresher
 	nodeMgr      NodeManager
+
+	exitIPs exitIPResolver
 }
 
 // NewServer constructs a server; it can be nil when disabled.
@@ -114,21 +127,42 @@ func NewServer(cfg Config, mgr *Manager, logger *log.Logger) *Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/api/auth", s.handleAuth)
+	mux.HandleFunc("/proxy.pac", s.handlePAC)
 	mux.HandleFunc("/api/settings", s.withAuth(s.handleSettings))
+	mux.HandleFunc("/api/config/warnings", s.withAuth(s.handleConfigWarnings))
 	mux.HandleFunc("/api/nodes", s.withAuth(s.handleNodes))
 	mux.HandleFunc("/api/nodes/config", s.withAuth(s.handleConfigNodes))
 	mux.HandleFunc("/api/nodes/config/", s.withAuth(s.handleConfigNodeItem))
 	mux.HandleFunc("/api/nodes/probe-all", s.withAuth(s.handleProbeAll))
+	mux.HandleFunc("/api/nodes/ips", s.withAuth(s.handleNodeIPs))
+	mux.HandleFunc("/api/ports", s.withAuth(s.handlePorts))
+	mux.HandleFunc("/api/stats/history", s.withAuth(s.handleStatsHistory))
+	mux.HandleFunc("/api/connections/export", s.withAuth(s.handleConnectionsExport))
+	mux.HandleFunc("/api/tags", s.withAuth(s.handleTags))
 	mux.HandleFunc("/api/nodes/", s.withAuth(s.handleNodeAction))
 	mux.HandleFunc("/api/debug", s.withAuth(s.handleDebug))
+	mux.HandleFunc("/api/status", s.withAuth(s.handleStatus))
 	mux.HandleFunc("/api/export", s.withAuth(s.handleExport))
+	mux.HandleFunc("/api/precheck", s.handlePrecheck)
 	mux.HandleFunc("/api/subscription/status", s.withAuth(s.handleSubscriptionStatus))
 	mux.HandleFunc("/api/subscription/refresh", s.withAuth(s.handleSubscriptionRefresh))
 	mux.HandleFunc("/api/subscription/config", s.withAuth(s.handleSubscriptionConfig))
 	mux.HandleFunc("/api/reload", s.withAuth(s.handleReload))
 	mux.HandleFunc("/api/traffic", s.withAuth(s.handleTraffic))
 	mux.HandleFunc("/api/logs", s.withAuth(s.handleLogs))
-	s.srv = &http.Server{Addr: cfg.Listen, Handler: mux}
+	mux.HandleFunc("/api/blacklist", s.withAuth(s.handleBlacklist))
+	mux.HandleFunc("/api/blacklist/", s.withAuth(s.handleBlacklistItem))
+	mux.HandleFunc("/api/users", s.withAuth(s.handleUsers))
+	mux.HandleFunc("/api/users/", s.withAuth(s.handleUserAction))
+	mux.HandleFunc("/api/tun/split", s.withAuth(s.handleTUNSplit))
+	mux.HandleFunc("/api/limits", s.withAuth(s.handleLimits))
+	mux.HandleFunc("/api/slo", s.withAuth(s.handleSLO))
+	mux.HandleFunc("/api/costs", s.withAuth(s.handleCosts))
+	mux.HandleFunc("/api/chaos", s.withAuth(s.handleChaos))
+	mux.HandleFunc("/api/chaos/", s.withAuth(s.handleChaos))
+	mux.HandleFunc("/api/cluster", s.withAuth(s.handleCluster))
+	mux.HandleFunc("/api/cluster/sync", s.handleClusterSync)
+	s.srv = &http.Server{Addr: cfg.Listen, Handler: s.withLanguage(mux)}
 	return s
 }
 
@@ -262,13 +296,32 @@ func (s *Server) Start(ctx context.Context) {
 	}
 	s.logger.Printf("Starting monitor server on %s", s.cfg.Listen)
 	go func() {
-		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var (
+			ln  net.Listener
+			err error
+		)
+		if s.cfg.Freebind {
+			ln, err = freebind.Listen(ctx, "tcp", s.cfg.Listen)
+		} else {
+			ln, err = handoff.Listen(ctx, "tcp", s.cfg.Listen)
+		}
+		if err == nil {
+			if s.cfg.TLS != nil {
+				ln = tls.NewListener(ln, s.cfg.TLS)
+			}
+			err = s.srv.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Printf("❌ Monitor server error: %v", err)
 		}
 	}()
 	// Give server a moment to start and check for immediate errors
 	time.Sleep(100 * time.Millisecond)
-	s.logger.Printf("✅ Monitor server started on http://%s", s.cfg.Listen)
+	scheme := "http"
+	if s.cfg.TLS != nil {
+		scheme = "https"
+	}
+	s.logger.Printf("✅ Monitor server started on %s://%s", scheme, s.cfg.Listen)
 
 	go func() {
 		<-ctx.Done()
@@ -285,12 +338,19 @@ func (s *Server) Shutdown(ctx context.Context) {
 }
 
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	data, err := embeddedFS.ReadFile("assets/index.html")
+	var data []byte
+	var err error
+	if languageOf(w) == config.LanguageEN {
+		data, err = indexEN()
+	} else {
+		data, err = embeddedFS.ReadFile("assets/index.html")
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Vary", "Accept-Language, Cookie")
 	_, _ = w.Write(data)
 }
 
@@ -320,7 +380,7 @@ func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	payload := map[string]any{
-		"nodes":          filtered,
+		"nodes":          redactSnapshots(filtered),
 		"total_nodes":    totalNodes,
 		"region_stats":   regionStats,
 		"region_healthy": regionHealthy,
@@ -328,6 +388,25 @@ func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, payload)
 }
 
+// redactSnapshots returns a copy of snaps with upstream node URIs masked.
+func redactSnapshots(snaps []Snapshot) []Snapshot {
+	out := make([]Snapshot, len(snaps))
+	for i, snap := range snaps {
+		snap.URI = redact.URI(snap.URI)
+		out[i] = snap
+	}
+	return out
+}
+
+// queryBool reports whether query parameter key is set to a truthy value.
+func queryBool(r *http.Request, key string) bool {
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
 func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -383,6 +462,42 @@ func (s *Server) handleNodeAction(w http.ResponseWriter, r *http.Request) {
 		action = parts[1]
 	}
 	switch action {
+	case "ip":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		info, ok := s.mgr.nodeInfo(tag)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]any{"error": ErrNodeNotFound.Error()})
+			return
+		}
+		writeJSON(w, s.lookupExitIP(r.Context(), info, r.URL.Query().Get("refresh") != ""))
+	case "listen":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		activator, ok := s.nodeMgr.(ListenerActivator)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			writeJSON(w, map[string]any{"error": "不支持按需监听"})
+			return
+		}
+		info, ok := s.mgr.nodeInfo(tag)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]any{"error": ErrNodeNotFound.Error()})
+			return
+		}
+		port, err := activator.ActivateListener(r.Context(), info.Tag)
+		if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			writeJSON(w, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, map[string]any{"message": "端口已开启", "tag": info.Tag, "port": port})
 	case "probe":
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -430,11 +545,81 @@ func (s *Server) handleNodeAction(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		writeJSON(w, map[string]any{"message": fmt.Sprintf("已拉黑 %s", duration)})
+	case "speedtest":
+		info, ok := s.mgr.nodeInfo(tag)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]any{"error": ErrNodeNotFound.Error()})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			results, err := s.mgr.SpeedTests(info.Tag)
+			if err != nil {
+				writeJSON(w, map[string]any{"error": err.Error()})
+				return
+			}
+			writeJSON(w, map[string]any{"tag": info.Tag, "name": info.Name, "results": results})
+		case http.MethodPost:
+			result, err := s.mgr.SpeedTest(r.Context(), info.Tag)
+			if err != nil {
+				writeJSON(w, map[string]any{"error": err.Error()})
+				return
+			}
+			if result.Error != "" {
+				writeJSON(w, map[string]any{"error": "测速失败: " + result.Error, "tag": info.Tag, "result": result})
+				return
+			}
+			writeJSON(w, map[string]any{"message": "测速完成", "tag": info.Tag, "result": result})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
 	default:
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
+// lookupExitIP resolves the exit IP of one node using the current settings.
+func (s *Server) lookupExitIP(ctx context.Context, info NodeInfo, refresh bool) ExitIP {
+	checkURL := DefaultIPCheckURL
+	var countryDB, asnDB string
+	s.cfgMu.RLock()
+	if s.cfgSrc != nil {
+		if s.cfgSrc.Management.IPCheckURL != "" {
+			checkURL = s.cfgSrc.Management.IPCheckURL
+		}
+		countryDB = s.cfgSrc.GeoIP.DatabasePath
+		asnDB = s.cfgSrc.GeoIP.ASNDatabasePath
+	}
+	s.cfgMu.RUnlock()
+	return s.exitIPs.Lookup(ctx, s.mgr, info, checkURL, countryDB, asnDB, refresh)
+}
+
+// handleNodeIPs returns the exit IP of every node. Cached results are reused
+// unless ?refresh=1 is given; lookups run with the probe concurrency.
+func (s *Server) handleNodeIPs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	refresh := r.URL.Query().Get("refresh") != ""
+	snapshots := s.mgr.Snapshot()
+	results := make([]ExitIP, len(snapshots))
+	sem := make(chan struct{}, s.mgr.ProbeConcurrency())
+	var wg sync.WaitGroup
+	for i, snap := range snapshots {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, info NodeInfo) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.lookupExitIP(r.Context(), info, refresh)
+		}(i, snap.NodeInfo)
+	}
+	wg.Wait()
+	writeJSON(w, map[string]any{"nodes": results})
+}
+
 // handleProbeAll probes all nodes in batches and returns results via SSE
 func (s *Server) handleProbeAll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -457,7 +642,7 @@ func (s *Server) handleProbeAll(w http.ResponseWriter, r *http.Request) {
 	// would multiply total in-flight probes (each request bounds itself, but
 	// not the others), so reject it cleanly instead.
 	if !s.probeAllInFlight.CompareAndSwap(false, true) {
-		busy, _ := json.Marshal(map[string]any{"type": "error", "message": "批量探测已在进行中，请稍候"})
+		busy, _ := json.Marshal(map[string]any{"type": "error", "message": localize(languageOf(w), "批量探测已在进行中，请稍候")})
 		fmt.Fprintf(w, "data: %s\n\n", busy)
 		flusher.Flush()
 		return
@@ -602,6 +787,11 @@ func (s *Server) handleProbeAll(w http.ResponseWriter, r *http.Request) {
 }
 
 func writeJSON(w http.ResponseWriter, payload any) {
+	if m, ok := payload.(map[string]any); ok {
+		if lang := languageOf(w); lang != config.LanguageZH {
+			payload = localizeMessages(lang, m)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(payload)
 }
@@ -609,35 +799,41 @@ func writeJSON(w http.ResponseWriter, payload any) {
 // withAuth 认证中间件，如果配置了密码则需要验证
 func (s *Server) withAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// 如果没有配置密码，直接放行
-		if s.cfg.Password == "" {
-			next(w, r)
-			return
-		}
-
-		// 检查 Cookie 中的 session token
-		cookie, err := r.Cookie("session_token")
-		if err == nil && s.validateSession(cookie.Value) {
+		if s.authorized(r) {
 			next(w, r)
 			return
 		}
 
-		// 检查 Authorization header (Bearer token)
-		authHeader := r.Header.Get("Authorization")
-		if authHeader != "" {
-			token := strings.TrimPrefix(authHeader, "Bearer ")
-			if s.validateSession(token) {
-				next(w, r)
-				return
-			}
-		}
-
 		// 未授权
 		w.WriteHeader(http.StatusUnauthorized)
 		writeJSON(w, map[string]any{"error": "未授权，请先登录"})
 	}
 }
 
+// authorized 判断请求是否已登录管理界面
+func (s *Server) authorized(r *http.Request) bool {
+	// 如果没有配置密码，直接放行
+	if s.cfg.Password == "" {
+		return true
+	}
+
+	// 检查 Cookie 中的 session token
+	cookie, err := r.Cookie("session_token")
+	if err == nil && s.validateSession(cookie.Value) {
+		return true
+	}
+
+	// 检查 Authorization header (Bearer token)
+	authHeader := r.Header.Get("Authorization")
+	if authHeader != "" {
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if s.validateSession(token) {
+			return true
+		}
+	}
+	return false
+}
+
 // handleAuth 处理登录认证
 func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
 	// 如果没有配置密码，直接返回成功（不需要token）
@@ -701,6 +897,7 @@ func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
 //   - scheme=http   (默认)
 //   - scheme=socks5
 //   - scheme=all    (同时导出 HTTP 和 SOCKS5)
+//   - format=clash / format=sing-box (导出为 Clash proxy provider YAML 或 sing-box outbounds JSON，见 export.go)
 //
 // 在 pool/hybrid 模式下，还会导出 Pool 代理池入口和 GeoIP 分区路由入口。
 func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
@@ -718,6 +915,10 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, map[string]any{"error": "invalid scheme, use http/socks5/all"})
 		return
 	}
+	if format := exportFormat(r); format != "uri" {
+		s.handleExportConfig(w, r, format, scheme)
+		return
+	}
 
 	// 只导出初始检查通过的可用节点
 	snapshots := s.mgr.SnapshotFiltered(true)
@@ -750,7 +951,11 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 			poolAuth = fmt.Sprintf("%s:%s@", listenerCfg.Username, listenerCfg.Password)
 		}
 		lines = append(lines, "# Pool 代理池入口")
-		poolHTTP := fmt.Sprintf("http://%s%s:%d", poolAuth, poolAddr, listenerCfg.Port)
+		poolScheme := "http"
+		if listenerCfg.TLS.Enabled() {
+			poolScheme = "https"
+		}
+		poolHTTP := fmt.Sprintf("%s://%s%s:%d", poolScheme, poolAuth, poolAddr, listenerCfg.Port)
 		poolSocks := fmt.Sprintf("socks5://%s%s:%d", poolAuth, poolAddr, listenerCfg.Port)
 		switch scheme {
 		case "http":
@@ -842,6 +1047,13 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 默认隐藏入口凭据，显式传 show_secrets=1 才导出明文
+	if !queryBool(r, "show_secrets") {
+		for i, line := range lines {
+			lines[i] = redact.Text(line)
+		}
+	}
+
 	// 返回纯文本，每行一个 URI
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	filename := "proxy_pool.txt"
@@ -1274,6 +1486,17 @@ func (s *Server) handleConfigNodeItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodPost {
+		if name, ok := strings.CutSuffix(nodeName, "/enable"); ok {
+			s.setNodeDisabled(w, r, name, false)
+			return
+		}
+		if name, ok := strings.CutSuffix(nodeName, "/disable"); ok {
+			s.setNodeDisabled(w, r, name, true)
+			return
+		}
+	}
+
 	switch r.Method {
 	case http.MethodPut:
 		var payload nodePayload
@@ -1282,14 +1505,30 @@ func (s *Server) handleConfigNodeItem(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, map[string]any{"error": "请求格式错误"})
 			return
 		}
-		node, err := s.nodeMgr.UpdateNode(r.Context(), nodeName, payload.toConfig())
+		node, err := s.findConfigNode(r.Context(), nodeName)
+		if err != nil {
+			s.respondNodeError(w, err)
+			return
+		}
+		// Fields the edit form does not carry are kept as they are; the
+		// runtime-only ones are derived again when the node is stored.
+		updated := node
+		updated.Name, updated.URI, updated.Port = payload.Name, payload.URI, payload.Port
+		updated.Username, updated.Password = payload.Username, payload.Password
+		updated.ID, updated.DisplayName, updated.Source = "", "", ""
+		node, err = s.nodeMgr.UpdateNode(r.Context(), node.Name, updated)
 		if err != nil {
 			s.respondNodeError(w, err)
 			return
 		}
 		writeJSON(w, map[string]any{"node": node, "message": "节点已更新，请点击重载使配置生效"})
 	case http.MethodDelete:
-		if err := s.nodeMgr.DeleteNode(r.Context(), nodeName); err != nil {
+		node, err := s.findConfigNode(r.Context(), nodeName)
+		if err != nil {
+			s.respondNodeError(w, err)
+			return
+		}
+		if err := s.nodeMgr.DeleteNode(r.Context(), node.Name); err != nil {
 			s.respondNodeError(w, err)
 			return
 		}
@@ -1299,6 +1538,53 @@ func (s *Server) handleConfigNodeItem(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// findConfigNode returns the configured node called name, or else the one
+// whose ASCII ID is name.
+func (s *Server) findConfigNode(ctx context.Context, name string) (config.NodeConfig, error) {
+	nodes, err := s.nodeMgr.ListConfigNodes(ctx)
+	if err != nil {
+		return config.NodeConfig{}, err
+	}
+	for _, node := range nodes {
+		if node.Name == name {
+			return node, nil
+		}
+	}
+	for _, node := range nodes {
+		if node.ID == name {
+			return node, nil
+		}
+	}
+	return config.NodeConfig{}, ErrNodeNotFound
+}
+
+// setNodeDisabled takes a node out of (or back into) the pool and reloads.
+// The flag is saved for inline nodes; nodes_file and subscription nodes keep
+// it until the process restarts.
+func (s *Server) setNodeDisabled(w http.ResponseWriter, r *http.Request, name string, disabled bool) {
+	node, err := s.findConfigNode(r.Context(), name)
+	if err != nil {
+		s.respondNodeError(w, err)
+		return
+	}
+	if node.Disabled != disabled {
+		node.Disabled = disabled
+		if _, err := s.nodeMgr.UpdateNode(r.Context(), node.Name, node); err != nil {
+			s.respondNodeError(w, err)
+			return
+		}
+		if err := s.nodeMgr.TriggerReload(r.Context()); err != nil {
+			s.respondNodeError(w, err)
+			return
+		}
+	}
+	msg := "节点已启用"
+	if disabled {
+		msg = "节点已停用"
+	}
+	writeJSON(w, map[string]any{"message": msg, "disabled": disabled})
+}
+
 // handleReload triggers a configuration reload.
 func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -1318,6 +1604,334 @@ func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleUsers returns per-user connection and traffic counters for
+// listener.users.
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]any{"users": users.Snapshot()})
+}
+
+// handleConfigWarnings lists the non-fatal problems found when the running
+// configuration was loaded.
+func (s *Server) handleConfigWarnings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	warnings := []config.Warning{}
+	s.cfgMu.RLock()
+	if s.cfgSrc != nil {
+		warnings = s.cfgSrc.Warnings()
+	}
+	s.cfgMu.RUnlock()
+	writeJSON(w, map[string]any{"warnings": warnings, "count": len(warnings)})
+}
+
+// handlePorts returns the per-node port mapping of multi-port and hybrid
+// mode, ordered by port. The list is empty when nodes share ports.
+func (s *Server) handlePorts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.cfgMu.RLock()
+	cfg := s.cfgSrc
+	if cfg == nil {
+		s.cfgMu.RUnlock()
+		writeJSON(w, map[string]any{"ports": []config.PortAssignment{}, "count": 0})
+		return
+	}
+	ports := cfg.PortAssignments()
+	resp := map[string]any{
+		"mode":     cfg.Mode,
+		"group_by": cfg.MultiPort.GroupBy,
+		"address":  cfg.MultiPort.Address,
+		"file":     cfg.PortMapPath(),
+	}
+	s.cfgMu.RUnlock()
+	if ports == nil {
+		ports = []config.PortAssignment{}
+	}
+	resp["ports"] = ports
+	resp["count"] = len(ports)
+	writeJSON(w, resp)
+}
+
+// handleStatsHistory returns the stats history of a node (?node=tag), a
+// user (?user=name) or, with neither, of all nodes summed, at the given
+// resolution (minute, hour or day; default hour) over the last ?since
+// (default 24h).
+func (s *Server) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	node, user := query.Get("node"), query.Get("user")
+	if node != "" && user != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": "node 与 user 只能指定一个"})
+		return
+	}
+	resolution := strings.ToLower(strings.TrimSpace(query.Get("resolution")))
+	if resolution == "" {
+		resolution = ResolutionHour
+	}
+	if resolution != ResolutionMinute && resolution != ResolutionHour && resolution != ResolutionDay {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": "resolution 只能是 minute/hour/day"})
+		return
+	}
+	since := 24 * time.Hour
+	if raw := strings.TrimSpace(query.Get("since")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "since 格式无效，例如 1h、72h"})
+			return
+		}
+		since = d
+	}
+
+	kind, key := "node", node
+	if user != "" {
+		kind, key = "user", user
+	}
+	points := s.mgr.History(kind, key, resolution, time.Now().Add(-since))
+	resp := map[string]any{
+		"enabled":    points != nil,
+		"resolution": resolution,
+		"since":      since.String(),
+	}
+	if key != "" {
+		resp[kind] = key
+	}
+	if points == nil {
+		points = []HistoryPoint{}
+	}
+	resp["points"] = points
+	writeJSON(w, resp)
+}
+
+// handleConnectionsExport downloads the connection records kept by
+// access_log.history as JSON Lines, oldest first. ?since (e.g. 1h), ?user,
+// ?node (tag or name), ?result (ok/error) filter them and ?limit keeps the
+// newest N.
+func (s *Server) handleConnectionsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	var since time.Time
+	if raw := strings.TrimSpace(query.Get("since")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "since 格式无效，例如 30m、24h"})
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+	limit := 0
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "limit 必须是正整数"})
+			return
+		}
+		limit = n
+	}
+	user, node, result := query.Get("user"), query.Get("node"), strings.ToLower(query.Get("result"))
+	tag := query.Get("tag")
+
+	entries := accesslog.Recent()
+	kept := entries[:0]
+	for _, e := range entries {
+		if !since.IsZero() && e.Time.Before(since) {
+			continue
+		}
+		if user != "" && e.User != user {
+			continue
+		}
+		if tag != "" && e.Tag != tag {
+			continue
+		}
+		if node != "" && e.Node != node && e.NodeName != node {
+			continue
+		}
+		if result != "" && e.Result != result {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if limit > 0 && len(kept) > limit {
+		kept = kept[len(kept)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	filename := fmt.Sprintf("connections-%s.jsonl", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	_ = accesslog.WriteJSONL(w, kept)
+}
+
+// handleTags reports the connections, failures and traffic per connection
+// tag (GET) or clears them (DELETE).
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tags := accesslog.Tags()
+		if tags == nil {
+			tags = []accesslog.TagStats{}
+		}
+		writeJSON(w, map[string]any{"tags": tags, "count": len(tags)})
+	case http.MethodDelete:
+		accesslog.ResetTags()
+		writeJSON(w, map[string]any{"message": "已清空连接标签统计"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBlacklist lists the blacklisted nodes (GET) or releases all of
+// them (DELETE).
+func (s *Server) handleBlacklist(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := s.mgr.Blacklist()
+		writeJSON(w, map[string]any{"nodes": list, "count": len(list)})
+	case http.MethodDelete:
+		released := s.mgr.ReleaseAll()
+		writeJSON(w, map[string]any{"message": fmt.Sprintf("已解除 %d 个节点的拉黑", released), "released": released})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBlacklistItem blacklists one node for a duration (POST, body
+// {"duration": "1h"}, default 24h) or clears its entry (DELETE). The node
+// is addressed by tag or name.
+func (s *Server) handleBlacklistItem(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.mgr.nodeInfo(strings.TrimPrefix(r.URL.Path, "/api/blacklist/"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": ErrNodeNotFound.Error()})
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Duration == "" {
+			req.Duration = "24h"
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "无效的 duration"})
+			return
+		}
+		if err := s.mgr.ManualBlacklist(info.Tag, duration); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeJSON(w, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, map[string]any{"message": fmt.Sprintf("已拉黑 %s", duration), "tag": info.Tag, "until": time.Now().Add(duration)})
+	case http.MethodDelete:
+		if err := s.mgr.Release(info.Tag); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			writeJSON(w, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, map[string]any{"message": "已解除拉黑", "tag": info.Tag})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUserAction handles POST /api/users/{name}/reset, which clears the
+// user's traffic counters and lifts an exhausted quota.
+func (s *Server) handleUserAction(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	if !ok || action != "reset" || name == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !users.ResetUsage(name) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]any{"error": "用户不存在"})
+		return
+	}
+	writeJSON(w, map[string]any{"message": "流量统计已重置"})
+}
+
+// handleTUNSplit reads (GET) or replaces (PUT) the TUN split tunneling lists.
+// A PUT is saved to the config file and applied with a reload.
+func (s *Server) handleTUNSplit(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.cfgMu.RLock()
+		defer s.cfgMu.RUnlock()
+		if s.cfgSrc == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			writeJSON(w, map[string]any{"error": "配置不可用"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"enabled": s.cfgSrc.TUN.Enabled,
+			"split":   s.cfgSrc.TUN.SplitTunnelConfig,
+		})
+	case http.MethodPut:
+		var split config.SplitTunnelConfig
+		if err := json.NewDecoder(r.Body).Decode(&split); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "请求格式错误"})
+			return
+		}
+		if err := split.Normalize(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": err.Error()})
+			return
+		}
+
+		s.cfgMu.Lock()
+		if s.cfgSrc == nil {
+			s.cfgMu.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			writeJSON(w, map[string]any{"error": "配置不可用"})
+			return
+		}
+		s.cfgSrc.TUN.SplitTunnelConfig = split
+		enabled := s.cfgSrc.TUN.Enabled
+		saveErr := s.cfgSrc.SaveSettings()
+		s.cfgMu.Unlock()
+		if saveErr != nil {
+			s.logger.Printf("⚠️  save split tunneling config: %v", saveErr)
+		}
+
+		if !enabled || s.nodeMgr == nil {
+			writeJSON(w, map[string]any{"message": "分流设置已保存", "split": split})
+			return
+		}
+		if err := s.nodeMgr.TriggerReload(r.Context()); err != nil {
+			s.respondNodeError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"message": "分流设置已生效", "split": split})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (s *Server) ensureNodeManager(w http.ResponseWriter) bool {
 	if s.nodeMgr == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -1332,7 +1946,7 @@ func (s *Server) respondNodeError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, ErrNodeNotFound):
 		status = http.StatusNotFound
-	case errors.Is(err, ErrNodeConflict), errors.Is(err, ErrInvalidNode):
+	case errors.Is(err, ErrNodeConflict), errors.Is(err, ErrInvalidNode), errors.Is(err, ErrNodeGenerated):
 		status = http.StatusBadRequest
 	}
 	w.WriteHeader(status)
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxSLOEvents is how many SLO decisions are kept for /api/slo.
+const maxSLOEvents = 200
+
+// Decisions taken on a node that missed its group's SLO.
+const (
+	SLORotatedOut = "rotated_out" // taken out of rotation for the cooldown
+	SLOKept       = "kept"        // left in rotation, no other node could take over
+)
+
+// SLOEvent records a node that missed its group's connect-time SLO
+// (pool.groups.<name>.slo) and what the pool did about it.
+type SLOEvent struct {
+	Time       time.Time `json:"time"`
+	Group      string    `json:"group"`
+	Node       string    `json:"node"`
+	Action     string    `json:"action"`
+	Percentile int       `json:"percentile"`
+	ObservedMs int64     `json:"observed_ms"` // connect time at the percentile over the window
+	TargetMs   int64     `json:"target_ms"`
+	Samples    int       `json:"samples"`
+	Until      time.Time `json:"until,omitempty"`    // end of the rotation, for rotated_out
+	Promoted   string    `json:"promoted,omitempty"` // standby node put in its place
+}
+
+type sloStore struct {
+	mu     sync.Mutex
+	events []SLOEvent
+}
+
+// RecordSLOEvent keeps an SLO decision for /api/slo and logs it.
+func (m *Manager) RecordSLOEvent(ev SLOEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	ss := &m.slo
+	ss.mu.Lock()
+	ss.events = append(ss.events, ev)
+	if n := len(ss.events) - maxSLOEvents; n > 0 {
+		ss.events = append([]SLOEvent(nil), ss.events[n:]...)
+	}
+	ss.mu.Unlock()
+	if m.logger != nil {
+		m.logger.Warn(fmt.Sprintf("slo: %s in group %s at p%d %dms (target %dms, %d samples): %s",
+			ev.Node, ev.Group, ev.Percentile, ev.ObservedMs, ev.TargetMs, ev.Samples, ev.Action))
+	}
+}
+
+// SLOEvents returns the recent SLO decisions, newest first.
+func (m *Manager) SLOEvents() []SLOEvent {
+	ss := &m.slo
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	events := make([]SLOEvent, len(ss.events))
+	for i, ev := range ss.events {
+		events[len(events)-1-i] = ev
+	}
+	return events
+}
+
+// handleSLO lists the recent SLO decisions.
+func (s *Server) handleSLO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]any{"events": s.mgr.SLOEvents()})
+}
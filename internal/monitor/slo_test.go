@@ -0,0 +1,21 @@
+package monitor
+
+import "testing"
+
+func TestSLOEventsNewestFirstAndBounded(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	for i := 0; i < maxSLOEvents+5; i++ {
+		mgr.RecordSLOEvent(SLOEvent{Node: "hk-1", Action: SLORotatedOut, Samples: i})
+	}
+	events := mgr.SLOEvents()
+	if len(events) != maxSLOEvents {
+		t.Fatalf("expected %d events, got %d", maxSLOEvents, len(events))
+	}
+	if events[0].Samples != maxSLOEvents+4 || events[len(events)-1].Samples != 5 {
+		t.Fatalf("events not newest first: first %d, last %d", events[0].Samples, events[len(events)-1].Samples)
+	}
+	if events[0].Time.IsZero() {
+		t.Fatal("event time not set")
+	}
+}
@@ -0,0 +1,259 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSpeedTestURL serves as many bytes as asked for; the download
+	// is cut at SpeedTestSettings.MaxBytes.
+	DefaultSpeedTestURL = "https://speed.cloudflare.com/__down?bytes=100000000"
+	// maxSpeedTests is how many results are kept per node.
+	maxSpeedTests = 20
+	// speedTestCheckInterval is how often the schedule is checked, so a
+	// changed interval applies without restarting the loop.
+	speedTestCheckInterval = time.Minute
+)
+
+// SpeedTestSettings configures speed tests. A zero Interval runs them on
+// demand only.
+type SpeedTestSettings struct {
+	URL      string
+	MaxBytes int64
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+// SpeedTestResult is one bandwidth measurement of a node. Throughput is
+// measured from the response headers to the end of the download, so the
+// connection setup does not count against it.
+type SpeedTestResult struct {
+	Time       time.Time `json:"time"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"duration_ms"`
+	Mbps       float64   `json:"mbps"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type speedTestStore struct {
+	mu       sync.Mutex
+	settings SpeedTestSettings
+	lastRun  time.Time
+	loop     sync.Once
+	slot     chan struct{} // one test at a time, so tests don't share the uplink
+}
+
+// SetSpeedTest sets how speed tests run and, when settings.Interval is
+// set, starts testing every node in turn on that schedule.
+func (m *Manager) SetSpeedTest(settings SpeedTestSettings) {
+	st := &m.speed
+	st.mu.Lock()
+	st.settings = settings
+	st.mu.Unlock()
+	if settings.Interval <= 0 {
+		return
+	}
+	st.loop.Do(func() {
+		go func() {
+			ticker := time.NewTicker(speedTestCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case now := <-ticker.C:
+					m.runScheduledSpeedTests(now)
+				}
+			}
+		}()
+	})
+}
+
+func (m *Manager) speedTestSettings() SpeedTestSettings {
+	m.speed.mu.Lock()
+	s := m.speed.settings
+	m.speed.mu.Unlock()
+	if s.URL == "" {
+		s.URL = DefaultSpeedTestURL
+	}
+	if s.MaxBytes <= 0 {
+		s.MaxBytes = 10 << 20
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = 30 * time.Second
+	}
+	return s
+}
+
+// runScheduledSpeedTests tests every available node, one after another,
+// once the interval since the previous round has passed.
+func (m *Manager) runScheduledSpeedTests(now time.Time) {
+	st := &m.speed
+	st.mu.Lock()
+	interval := st.settings.Interval
+	due := interval > 0 && now.Sub(st.lastRun) >= interval
+	if due {
+		st.lastRun = now
+	}
+	st.mu.Unlock()
+	if !due {
+		return
+	}
+
+	m.mu.RLock()
+	tags := make([]string, 0, len(m.nodes))
+	for tag, e := range m.nodes {
+		e.mu.RLock()
+		usable := e.dial != nil && !e.blacklist && (e.available || !e.initialCheckDone)
+		e.mu.RUnlock()
+		if usable {
+			tags = append(tags, tag)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Strings(tags)
+
+	failed := 0
+	for _, tag := range tags {
+		result, err := m.SpeedTest(m.ctx, tag)
+		if m.ctx.Err() != nil {
+			return
+		}
+		if err != nil || result.Error != "" {
+			failed++
+		}
+	}
+	if m.logger != nil && len(tags) > 0 {
+		m.logger.Info("speed test completed: ", len(tags)-failed, " measured, ", failed, " failed")
+	}
+}
+
+// SpeedTest downloads the test URL through the node tag and records the
+// result in its history. Tests run one at a time; a caller waits for the
+// running test or for ctx. The error is only set when no test was run.
+func (m *Manager) SpeedTest(ctx context.Context, tag string) (SpeedTestResult, error) {
+	e, err := m.entry(tag)
+	if err != nil {
+		return SpeedTestResult{}, err
+	}
+	e.mu.RLock()
+	dial := e.dial
+	e.mu.RUnlock()
+	if dial == nil {
+		return SpeedTestResult{}, errors.New("speed test not available for this node")
+	}
+
+	select {
+	case m.speed.slot <- struct{}{}:
+	case <-ctx.Done():
+		return SpeedTestResult{}, ctx.Err()
+	}
+	result := measureSpeed(ctx, dial, m.speedTestSettings())
+	<-m.speed.slot
+
+	e.recordSpeedTest(result)
+	return result, nil
+}
+
+// measureSpeed downloads up to settings.MaxBytes of settings.URL through
+// dial. Hitting the timeout after some data arrived still counts as a
+// measurement over the time it ran.
+func measureSpeed(ctx context.Context, dial dialFunc, settings SpeedTestSettings) SpeedTestResult {
+	result := SpeedTestResult{Time: time.Now()}
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout)
+	defer cancel()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dial(ctx, network, address)
+		},
+		DisableKeepAlives:  true,
+		DisableCompression: true,
+	}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, settings.URL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("speed test returned %s", resp.Status)
+		return result
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, settings.MaxBytes))
+	elapsed := time.Since(start)
+	result.Bytes = n
+	result.DurationMs = elapsed.Milliseconds()
+	if err != nil && !(errors.Is(ctx.Err(), context.DeadlineExceeded) && n > 0) {
+		result.Error = err.Error()
+		return result
+	}
+	if n == 0 {
+		result.Error = "speed test downloaded nothing"
+		return result
+	}
+	if elapsed > 0 {
+		result.Mbps = math.Round(float64(n)*8/elapsed.Seconds()/1e4) / 100
+	}
+	return result
+}
+
+func (e *entry) recordSpeedTest(result SpeedTestResult) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.speeds = appendSpeedTests(e.speeds, result)
+	if result.Error == "" {
+		e.bandwidth = result.Mbps
+	}
+}
+
+// appendSpeedTests appends results to list, keeping the newest
+// maxSpeedTests.
+func appendSpeedTests(list []SpeedTestResult, results ...SpeedTestResult) []SpeedTestResult {
+	list = append(list, results...)
+	if len(list) > maxSpeedTests {
+		list = append([]SpeedTestResult(nil), list[len(list)-maxSpeedTests:]...)
+	}
+	return list
+}
+
+// SpeedTests returns the speed test history of tag, oldest first.
+func (m *Manager) SpeedTests(tag string) ([]SpeedTestResult, error) {
+	e, err := m.entry(tag)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]SpeedTestResult{}, e.speeds...), nil
+}
+
+// LastBandwidth returns the throughput in Mbit/s of the node's latest
+// successful speed test, or 0 when it has none or is unavailable.
+func (h *EntryHandle) LastBandwidth() float64 {
+	if h == nil || h.ref == nil {
+		return 0
+	}
+	h.ref.mu.RLock()
+	defer h.ref.mu.RUnlock()
+	if !h.ref.available {
+		return 0
+	}
+	return h.ref.bandwidth
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func directDial(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func TestSpeedTestRecordsBandwidth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, 256<<10))
+	}))
+	defer srv.Close()
+
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	mgr.SetSpeedTest(SpeedTestSettings{URL: srv.URL, MaxBytes: 64 << 10, Timeout: 5 * time.Second})
+	entry := mgr.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	entry.SetDialer(directDial)
+	entry.MarkAvailable(true)
+
+	result, err := mgr.SpeedTest(context.Background(), "a")
+	if err != nil || result.Error != "" {
+		t.Fatalf("speed test failed: %v %+v", err, result)
+	}
+	if result.Bytes != 64<<10 || result.Mbps <= 0 {
+		t.Fatalf("expected the download to stop at MaxBytes, got %+v", result)
+	}
+	if got := entry.LastBandwidth(); got != result.Mbps {
+		t.Fatalf("LastBandwidth = %v, want %v", got, result.Mbps)
+	}
+	history, _ := mgr.SpeedTests("a")
+	if len(history) != 1 {
+		t.Fatalf("expected one result in the history, got %+v", history)
+	}
+}
+
+func TestSpeedTestFailureKeepsBandwidth(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(make([]byte, 1024))
+	}))
+	defer srv.Close()
+
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	mgr.SetSpeedTest(SpeedTestSettings{URL: srv.URL, Timeout: 5 * time.Second})
+	entry := mgr.Register(NodeInfo{Tag: "a"})
+	entry.SetDialer(directDial)
+	entry.MarkAvailable(true)
+
+	first, _ := mgr.SpeedTest(context.Background(), "a")
+	fail.Store(true)
+	second, err := mgr.SpeedTest(context.Background(), "a")
+	if err != nil || !strings.Contains(second.Error, "403") {
+		t.Fatalf("expected a status error, got %v %+v", err, second)
+	}
+	if entry.LastBandwidth() != first.Mbps {
+		t.Fatalf("a failed test should keep the last measurement, got %v", entry.LastBandwidth())
+	}
+	if _, err := mgr.SpeedTest(context.Background(), "missing"); err == nil {
+		t.Fatal("expected an error for an unknown node")
+	}
+}
+
+func TestSpeedTestTimeoutCountsPartialDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		for r.Context().Err() == nil {
+			if _, err := w.Write(make([]byte, 4096)); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	result := measureSpeed(context.Background(), directDial, SpeedTestSettings{URL: srv.URL, MaxBytes: 100 << 20, Timeout: 300 * time.Millisecond})
+	if result.Error != "" || result.Bytes == 0 || result.Mbps <= 0 {
+		t.Fatalf("expected a measurement over the timeout window, got %+v", result)
+	}
+}
+
+func TestSpeedTestsPersistInStatsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+
+	first, _ := NewManager(Config{})
+	first.SetStatsFile(path)
+	a := first.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	a.ref.recordSpeedTest(SpeedTestResult{Time: time.Now(), Bytes: 1 << 20, Mbps: 42})
+	a.ref.recordSpeedTest(SpeedTestResult{Time: time.Now(), Error: "timeout"})
+	first.Stop()
+
+	second, _ := NewManager(Config{})
+	defer second.Stop()
+	second.SetStatsFile(path)
+	b := second.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	b.MarkAvailable(true)
+	if _, _, err := second.RestoreStats(); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := second.SpeedTests("a")
+	if len(history) != 2 || b.LastBandwidth() != 42 {
+		t.Fatalf("expected restored speed tests, got %+v (bandwidth %v)", history, b.LastBandwidth())
+	}
+}
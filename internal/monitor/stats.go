@@ -0,0 +1,257 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/users"
+)
+
+// statsSaveInterval is how often usage counters are written to the stats
+// file, so a crash loses at most this much accounting.
+const statsSaveInterval = 5 * time.Minute
+
+// NodeStats is the persisted history of one node.
+type NodeStats struct {
+	Tag          string            `json:"tag"`
+	URI          string            `json:"uri"`
+	SuccessCount int64             `json:"success_count"`
+	FailureCount int               `json:"failure_count"`
+	LastError    string            `json:"last_error,omitempty"`
+	LastFailure  time.Time         `json:"last_failure,omitempty"`
+	LastSuccess  time.Time         `json:"last_success,omitempty"`
+	Timeline     []TimelineEvent   `json:"timeline,omitempty"`
+	SpeedTests   []SpeedTestResult `json:"speed_tests,omitempty"`
+	// Bytes and BilledSince carry the cost report period over restarts.
+	Bytes       int64     `json:"bytes,omitempty"`
+	BilledSince time.Time `json:"billed_since,omitempty"`
+}
+
+// StatsSnapshot is the content of the stats file: per-user traffic and
+// per-node counters at the time of saving, plus the stats history when
+// enabled.
+type StatsSnapshot struct {
+	SavedAt time.Time        `json:"saved_at"`
+	Users   []users.Usage    `json:"users"`
+	Nodes   []NodeStats      `json:"nodes"`
+	History *HistorySnapshot `json:"history,omitempty"`
+}
+
+type statsStore struct {
+	mu   sync.Mutex
+	path string
+	loop sync.Once
+}
+
+// SetStatsFile sets where usage counters are saved and starts saving them
+// in the background. An empty path disables persistence.
+func (m *Manager) SetStatsFile(path string) {
+	m.stats.mu.Lock()
+	m.stats.path = path
+	m.stats.mu.Unlock()
+	if path == "" {
+		return
+	}
+	m.stats.loop.Do(func() {
+		go func() {
+			ticker := time.NewTicker(statsSaveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case <-ticker.C:
+					if err := m.SaveStats(); err != nil && m.logger != nil {
+						m.logger.Warn("save stats: ", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// SaveStats writes the current user traffic and node counters to the stats
+// file.
+func (m *Manager) SaveStats() error {
+	snapshot := StatsSnapshot{
+		SavedAt: time.Now().Round(time.Second),
+		Users:   users.Snapshot(),
+		Nodes:   m.nodeStats(),
+		History: m.historySnapshot(),
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+	path := m.stats.path
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) nodeStats() []NodeStats {
+	m.mu.RLock()
+	list := make([]NodeStats, 0, len(m.nodes))
+	for _, e := range m.nodes {
+		e.mu.RLock()
+		stats := NodeStats{
+			Tag:          e.info.Tag,
+			URI:          e.info.URI,
+			SuccessCount: e.success,
+			FailureCount: int(e.failure),
+			LastError:    e.lastError,
+			LastFailure:  e.lastFail,
+			LastSuccess:  e.lastOK,
+			Bytes:        e.traffic.Load(),
+			BilledSince:  e.billedSince,
+		}
+		if len(e.timeline) > 0 {
+			stats.Timeline = append([]TimelineEvent(nil), e.timeline...)
+		}
+		if len(e.speeds) > 0 {
+			stats.SpeedTests = append([]SpeedTestResult(nil), e.speeds...)
+		}
+		e.mu.RUnlock()
+		if stats.SuccessCount == 0 && stats.FailureCount == 0 && len(stats.SpeedTests) == 0 && stats.Bytes == 0 {
+			continue
+		}
+		list = append(list, stats)
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Tag < list[j].Tag })
+	return list
+}
+
+// RestoreStats adds the saved counters to the configured users and the
+// registered nodes. Nodes are matched like in RestoreBlacklist: same tag and
+// URI, or else the same URI. The saved stats history of those nodes and
+// users is loaded too when the history is enabled. It returns the number of
+// users and nodes restored.
+func (m *Manager) RestoreStats() (int, int, error) {
+	m.stats.mu.Lock()
+	path := m.stats.path
+	m.stats.mu.Unlock()
+	if path == "" {
+		return 0, 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var saved StatsSnapshot
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, 0, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	restoredUsers := 0
+	for _, usage := range saved.Users {
+		if users.RestoreUsage(usage) {
+			restoredUsers++
+		}
+	}
+
+	m.mu.RLock()
+	byURI := make(map[string]*entry, len(m.nodes))
+	for _, e := range m.nodes {
+		byURI[e.info.URI] = e
+	}
+	match := func(tag, uri string) *entry {
+		if e, ok := m.nodes[tag]; ok && e.info.URI == uri {
+			return e
+		}
+		return byURI[uri]
+	}
+	targets := make([]*entry, len(saved.Nodes))
+	for i, item := range saved.Nodes {
+		targets[i] = match(item.Tag, item.URI)
+	}
+	historyTags := make(map[string]string)
+	if saved.History != nil {
+		for tag, s := range saved.History.Nodes {
+			if s == nil {
+				continue
+			}
+			if e := match(tag, s.URI); e != nil {
+				historyTags[tag] = e.info.Tag
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	knownUsers := make(map[string]bool)
+	for _, usage := range users.Snapshot() {
+		knownUsers[usage.Username] = true
+	}
+	m.restoreHistory(saved.History, historyTags, knownUsers)
+
+	restoredNodes := 0
+	for i, item := range saved.Nodes {
+		if e := targets[i]; e != nil {
+			e.restoreStats(item)
+			restoredNodes++
+		}
+	}
+	return restoredUsers, restoredNodes, nil
+}
+
+// restoreStats merges saved counters into e, which may already have
+// recorded probes since it was registered.
+func (e *entry) restoreStats(saved NodeStats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.success += saved.SuccessCount
+	e.failure += int32(saved.FailureCount)
+	if saved.LastFailure.After(e.lastFail) {
+		e.lastFail = saved.LastFailure
+		if e.lastError == "" {
+			e.lastError = saved.LastError
+		}
+	}
+	if saved.LastSuccess.After(e.lastOK) {
+		e.lastOK = saved.LastSuccess
+	}
+	e.traffic.Add(saved.Bytes)
+	if !saved.BilledSince.IsZero() && saved.BilledSince.Before(e.billedSince) {
+		e.billedSince = saved.BilledSince
+	}
+	if len(saved.SpeedTests) > 0 {
+		e.speeds = appendSpeedTests(append([]SpeedTestResult(nil), saved.SpeedTests...), e.speeds...)
+		for i := len(e.speeds) - 1; i >= 0; i-- {
+			if e.speeds[i].Error == "" {
+				e.bandwidth = e.speeds[i].Mbps
+				break
+			}
+		}
+	}
+	if len(saved.Timeline) == 0 {
+		return
+	}
+	timeline := append(append([]TimelineEvent(nil), saved.Timeline...), e.timeline...)
+	if len(timeline) > maxTimelineSize {
+		timeline = timeline[len(timeline)-maxTimelineSize:]
+	}
+	e.timeline = timeline
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/users"
+)
+
+func TestStatsPersistAcrossManagers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	users.Configure(map[string]users.Limits{"alice": {}})
+	defer users.Configure(nil)
+	users.RestoreUsage(users.Usage{Username: "alice", Upload: 100, Download: 200})
+
+	first, _ := NewManager(Config{})
+	first.SetStatsFile(path)
+	a := first.Register(NodeInfo{Tag: "a", URI: "socks5://a:1080"})
+	a.RecordSuccessWithLatency(20 * time.Millisecond)
+	a.RecordFailure(errors.New("dial timeout"))
+	first.Register(NodeInfo{Tag: "idle", URI: "socks5://idle:1080"})
+	first.Stop()
+
+	// A restart starts from zero before the saved counters are added back.
+	users.Configure(nil)
+	users.Configure(map[string]users.Limits{"alice": {}})
+
+	second, _ := NewManager(Config{})
+	defer second.Stop()
+	second.SetStatsFile(path)
+	// Node "a" was renamed and already probed once since start.
+	renamed := second.Register(NodeInfo{Tag: "renamed", URI: "socks5://a:1080"})
+	renamed.RecordSuccess()
+
+	restoredUsers, restoredNodes, err := second.RestoreStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restoredUsers != 1 || restoredNodes != 1 {
+		t.Fatalf("restored %d users and %d nodes, want 1 and 1", restoredUsers, restoredNodes)
+	}
+	usage := users.Snapshot()[0]
+	if usage.Upload != 100 || usage.Download != 200 {
+		t.Fatalf("unexpected restored usage %+v", usage)
+	}
+	snap := second.Snapshot()[0]
+	if snap.SuccessCount != 2 || snap.FailureCount != 1 || snap.LastError != "dial timeout" {
+		t.Fatalf("unexpected restored node counters %+v", snap)
+	}
+	if len(snap.Timeline) != 3 || !snap.Timeline[0].Success || snap.Timeline[1].Success || !snap.Timeline[2].Success {
+		t.Fatalf("expected saved events before the new one, got %+v", snap.Timeline)
+	}
+}
+
+func TestRestoreStatsWithoutFile(t *testing.T) {
+	m, _ := NewManager(Config{})
+	defer m.Stop()
+	m.SetStatsFile(filepath.Join(t.TempDir(), "missing.json"))
+	if u, n, err := m.RestoreStats(); err != nil || u != 0 || n != 0 {
+		t.Fatalf("got %d, %d, %v; want nothing restored and no error", u, n, err)
+	}
+}
@@ -0,0 +1,242 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"easy_proxies/internal/handoff"
+)
+
+// Pool states shown on the public status page.
+const (
+	PoolUp       = "up"
+	PoolDegraded = "degraded"
+	PoolDown     = "down"
+	PoolStarting = "starting" // no node has finished its first check yet
+)
+
+// StatusPageConfig configures the public status page.
+type StatusPageConfig struct {
+	Listen string
+	Title  string
+	// DegradedBelow is the share of usable nodes, in percent, below which
+	// the pool is reported as degraded.
+	DegradedBelow int
+	Language      string // page language, empty follows Accept-Language
+}
+
+// PublicStatus is the aggregate pool health shown on the public status
+// page. It deliberately carries no node names, addresses or counts.
+type PublicStatus struct {
+	Status       string    `json:"status"`
+	Availability int       `json:"availability"` // percent of checked nodes that are usable
+	Uptime       int64     `json:"uptime_seconds"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PublicStatus summarises the pool for the public status page. Nodes whose
+// first health check is still pending are left out.
+func (m *Manager) PublicStatus(degradedBelow int) PublicStatus {
+	checked, usable := 0, 0
+	for _, snap := range m.Snapshot() {
+		if !snap.InitialCheckDone {
+			continue
+		}
+		checked++
+		if snap.Available && !snap.Blacklisted {
+			usable++
+		}
+	}
+	status := PublicStatus{
+		Status:    PoolStarting,
+		Uptime:    int64(time.Since(m.started) / time.Second),
+		UpdatedAt: time.Now(),
+	}
+	if checked == 0 {
+		return status
+	}
+	status.Availability = usable * 100 / checked
+	switch {
+	case usable == 0:
+		status.Status = PoolDown
+	case status.Availability < degradedBelow:
+		status.Status = PoolDegraded
+	default:
+		status.Status = PoolUp
+	}
+	return status
+}
+
+// statusTTL is how long the status page reuses PublicStatus. The page is
+// unauthenticated, so a request must not walk every node.
+const statusTTL = 5 * time.Second
+
+// StatusPage serves PublicStatus without authentication on its own address:
+// an HTML page at / and JSON at /status.json.
+type StatusPage struct {
+	cfg    StatusPageConfig
+	mgr    *Manager
+	srv    *http.Server
+	logger *log.Logger
+
+	mu          sync.Mutex
+	cached      PublicStatus
+	cachedUntil time.Time
+}
+
+// NewStatusPage constructs the status page server; it is nil when cfg has
+// no listen address.
+func NewStatusPage(cfg StatusPageConfig, mgr *Manager, logger *log.Logger) *StatusPage {
+	if cfg.Listen == "" || mgr == nil {
+		return nil
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	p := &StatusPage{cfg: cfg, mgr: mgr, logger: logger}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.handlePage)
+	mux.HandleFunc("/status.json", p.handleJSON)
+	p.srv = &http.Server{Addr: cfg.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return p
+}
+
+// Start listens in the background until ctx is done.
+func (p *StatusPage) Start(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	ln, err := handoff.Listen(ctx, "tcp", p.cfg.Listen)
+	if err != nil {
+		p.logger.Printf("❌ Status page error: %v", err)
+		return
+	}
+	p.logger.Printf("✅ Status page started on http://%s", p.cfg.Listen)
+	go func() {
+		if err := p.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Printf("❌ Status page error: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		p.Shutdown(context.Background())
+	}()
+}
+
+// Shutdown stops the server.
+func (p *StatusPage) Shutdown(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	_ = p.srv.Shutdown(ctx)
+}
+
+// status returns PublicStatus, computed at most once per statusTTL.
+// Requests arriving while it is computed wait for that result.
+func (p *StatusPage) status() PublicStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().Before(p.cachedUntil) {
+		return p.cached
+	}
+	p.cached = p.mgr.PublicStatus(p.cfg.DegradedBelow)
+	p.cachedUntil = time.Now().Add(statusTTL)
+	return p.cached
+}
+
+func (p *StatusPage) handleJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, p.status())
+}
+
+func (p *StatusPage) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	lang := p.cfg.Language
+	if lang == "" {
+		lang = acceptLanguage(r.Header.Get("Accept-Language"))
+	}
+	status := p.status()
+	data := map[string]any{
+		"Lang":         lang,
+		"Title":        p.cfg.Title,
+		"Status":       status.Status,
+		"StatusText":   localize(lang, statusTexts[status.Status]),
+		"Availability": status.Availability,
+		"UptimeLabel":  localize(lang, "运行时长"),
+		"Uptime":       formatUptime(time.Duration(status.Uptime) * time.Second),
+		"UpdatedLabel": localize(lang, "更新于"),
+		"UpdatedAt":    status.UpdatedAt.Format("2006-01-02 15:04:05 MST"),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Language")
+	if err := statusPageTemplate.Execute(w, data); err != nil {
+		p.logger.Printf("status page: %v", err)
+	}
+}
+
+var statusTexts = map[string]string{
+	PoolUp:       "服务正常",
+	PoolDegraded: "服务降级",
+	PoolDown:     "服务不可用",
+	PoolStarting: "正在启动",
+}
+
+// formatUptime renders d as days, hours and minutes.
+func formatUptime(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; background: #f5f6f8; color: #222; margin: 0; }
+main { max-width: 480px; margin: 12vh auto; padding: 32px; background: #fff; border-radius: 12px; box-shadow: 0 2px 12px rgba(0,0,0,.08); }
+h1 { font-size: 20px; margin: 0 0 24px; }
+.state { font-size: 24px; font-weight: 600; display: flex; align-items: center; gap: 10px; }
+.dot { width: 14px; height: 14px; border-radius: 50%; background: #9aa0a6; }
+.up .dot { background: #1e9e4a; } .degraded .dot { background: #e8a317; } .down .dot { background: #d93025; }
+.bar { height: 8px; background: #e8eaed; border-radius: 4px; margin: 20px 0 8px; overflow: hidden; }
+.bar div { height: 100%; background: #1e9e4a; }
+.meta { color: #666; font-size: 14px; line-height: 1.8; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<div class="state {{.Status}}"><span class="dot"></span>{{.StatusText}}</div>
+<div class="bar"><div style="width: {{.Availability}}%"></div></div>
+<div class="meta">{{.Availability}}%<br>{{.UptimeLabel}}: {{.Uptime}}<br>{{.UpdatedLabel}}: {{.UpdatedAt}}</div>
+</main>
+</body>
+</html>
+`))
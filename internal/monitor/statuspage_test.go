@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublicStatus(t *testing.T) {
+	mgr, _ := NewManager(Config{})
+	defer mgr.Stop()
+	if got := mgr.PublicStatus(50).Status; got != PoolStarting {
+		t.Fatalf("expected %s before any check, got %s", PoolStarting, got)
+	}
+
+	a := mgr.Register(NodeInfo{Tag: "a", Name: "tokyo-secret-1"})
+	b := mgr.Register(NodeInfo{Tag: "b", Name: "b"})
+	c := mgr.Register(NodeInfo{Tag: "c", Name: "c"})
+	mgr.Register(NodeInfo{Tag: "d", Name: "d"}) // not checked yet
+	a.MarkInitialCheckDone(true)
+	b.MarkInitialCheckDone(false)
+	c.MarkInitialCheckDone(false)
+	if got := mgr.PublicStatus(50); got.Status != PoolDegraded || got.Availability != 33 {
+		t.Fatalf("expected degraded at 33%%, got %+v", got)
+	}
+	b.MarkAvailable(true)
+	if got := mgr.PublicStatus(50); got.Status != PoolUp || got.Availability != 66 {
+		t.Fatalf("expected up at 66%%, got %+v", got)
+	}
+	a.MarkAvailable(false)
+	b.MarkAvailable(false)
+	if got := mgr.PublicStatus(50).Status; got != PoolDown {
+		t.Fatalf("expected %s, got %s", PoolDown, got)
+	}
+
+	page := NewStatusPage(StatusPageConfig{Listen: "127.0.0.1:0", Title: "Acme", DegradedBelow: 50}, mgr, nil)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "en-US")
+	page.srv.Handler.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "Outage") || !strings.Contains(string(body), "Acme") {
+		t.Fatalf("unexpected page:\n%s", body)
+	}
+	rec = httptest.NewRecorder()
+	page.srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/status.json", nil))
+	if json := rec.Body.String(); !strings.Contains(json, `"status":"down"`) || strings.Contains(json, "tokyo") {
+		t.Fatalf("unexpected status.json: %s", json)
+	}
+
+	// The aggregate is reused for statusTTL rather than recomputed per request.
+	a.MarkAvailable(true)
+	rec = httptest.NewRecorder()
+	page.srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/status.json", nil))
+	if json := rec.Body.String(); !strings.Contains(json, `"status":"down"`) {
+		t.Fatalf("status recomputed within statusTTL: %s", json)
+	}
+}
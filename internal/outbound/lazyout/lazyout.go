@@ -0,0 +1,267 @@
+// Package lazyout is the sing-box outbound of a node whose URI is parsed
+// only when the node is dialed (pool.lazy_nodes). The outbound it stands
+// for is created on first use and closed again once it has carried no
+// connection for IdleRelease, so a large node list only holds parsed
+// outbounds for the nodes in use.
+package lazyout
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/outbound"
+	singlog "github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/service"
+)
+
+// Type is the outbound type name exposed to sing-box.
+const Type = "lazy"
+
+// IdleRelease is how long a parsed outbound is kept without an open
+// connection before it is closed and dropped.
+const IdleRelease = 2 * time.Minute
+
+// Options is the node and the settings applied when its URI is parsed.
+type Options struct {
+	URI            string
+	SkipCertVerify bool   `json:",omitempty"`
+	AllowPlaintext bool   `json:",omitempty"`
+	Interface      string `json:",omitempty"`
+	BindAddress    string `json:",omitempty"`
+	TCPOnly        bool   `json:",omitempty"` // the protocol carries no UDP
+}
+
+// Parser turns the node of tag into the outbound options to create.
+type Parser func(tag string, options Options) (option.Outbound, error)
+
+var parser Parser
+
+// SetParser sets the function that parses node URIs. The builder sets it,
+// since it owns the URI formats.
+func SetParser(p Parser) {
+	parser = p
+}
+
+// Register wires the lazy outbound into the registry.
+func Register(registry *outbound.Registry) {
+	outbound.Register[Options](registry, Type, newOutbound)
+}
+
+type lazyOutbound struct {
+	outbound.Adapter
+	ctx     context.Context
+	router  adapter.Router
+	logger  singlog.ContextLogger
+	options Options
+
+	mu       sync.Mutex
+	inner    adapter.Outbound
+	parseErr error // parsing is deterministic, so a bad URI is parsed once
+	open     int   // dials in progress and connections through inner
+	lastUsed time.Time
+	closed   bool
+}
+
+func newOutbound(ctx context.Context, router adapter.Router, logger singlog.ContextLogger, tag string, options Options) (adapter.Outbound, error) {
+	if options.URI == "" {
+		return nil, E.New("lazy outbound ", tag, " has no URI")
+	}
+	network := []string{N.NetworkTCP, N.NetworkUDP}
+	if options.TCPOnly {
+		network = []string{N.NetworkTCP}
+	}
+	return &lazyOutbound{
+		Adapter: outbound.NewAdapter(Type, tag, network, nil),
+		ctx:     ctx,
+		router:  router,
+		logger:  logger,
+		options: options,
+	}, nil
+}
+
+// acquire returns the parsed outbound, creating it if needed, and counts a
+// use that release ends.
+func (o *lazyOutbound) acquire() (adapter.Outbound, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil, net.ErrClosed
+	}
+	if o.inner == nil {
+		if o.parseErr != nil {
+			return nil, o.parseErr
+		}
+		inner, err := o.create()
+		if err != nil {
+			return nil, err
+		}
+		o.inner = inner
+		track(o)
+	}
+	o.open++
+	return o.inner, nil
+}
+
+func (o *lazyOutbound) release() {
+	o.mu.Lock()
+	o.open--
+	o.lastUsed = time.Now()
+	o.mu.Unlock()
+}
+
+// create parses the node and creates and starts its outbound.
+func (o *lazyOutbound) create() (adapter.Outbound, error) {
+	if parser == nil {
+		return nil, E.New("lazy outbound ", o.Tag(), ": no parser")
+	}
+	out, err := parser(o.Tag(), o.options)
+	if err != nil {
+		o.parseErr = E.Cause(err, "parse node ", o.Tag())
+		return nil, o.parseErr
+	}
+	registry := service.FromContext[adapter.OutboundRegistry](o.ctx)
+	if registry == nil {
+		return nil, E.New("lazy outbound ", o.Tag(), ": missing outbound registry")
+	}
+	inner, err := registry.CreateOutbound(o.ctx, o.router, o.logger, o.Tag(), out.Type, out.Options)
+	if err != nil {
+		return nil, E.Cause(err, "create outbound ", o.Tag())
+	}
+	for _, stage := range adapter.ListStartStages {
+		if err := adapter.LegacyStart(inner, stage); err != nil {
+			_ = common.Close(inner)
+			return nil, E.Cause(err, stage, " outbound ", o.Tag())
+		}
+	}
+	return inner, nil
+}
+
+func (o *lazyOutbound) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	inner, err := o.acquire()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := inner.DialContext(ctx, network, destination)
+	if err != nil {
+		o.release()
+		return nil, err
+	}
+	return &trackedConn{Conn: conn, release: o.release}, nil
+}
+
+func (o *lazyOutbound) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	inner, err := o.acquire()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := inner.ListenPacket(ctx, destination)
+	if err != nil {
+		o.release()
+		return nil, err
+	}
+	return &trackedPacketConn{PacketConn: conn, release: o.release}, nil
+}
+
+// releaseIdle closes the parsed outbound when it has been unused for
+// IdleRelease.
+func (o *lazyOutbound) releaseIdle(now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.inner == nil || o.open > 0 || now.Sub(o.lastUsed) < IdleRelease {
+		return
+	}
+	_ = common.Close(o.inner)
+	o.inner = nil
+	untrack(o)
+}
+
+func (o *lazyOutbound) Close() error {
+	o.mu.Lock()
+	o.closed = true
+	inner := o.inner
+	o.inner = nil
+	o.mu.Unlock()
+	untrack(o)
+	return common.Close(inner)
+}
+
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+type trackedPacketConn struct {
+	net.PacketConn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedPacketConn) Close() error {
+	err := c.PacketConn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// The parsed outbounds are swept by one goroutine, which runs while any
+// is held.
+var (
+	parsedMu sync.Mutex
+	parsed   = make(map[*lazyOutbound]struct{})
+	sweeping bool
+)
+
+func track(o *lazyOutbound) {
+	parsedMu.Lock()
+	defer parsedMu.Unlock()
+	parsed[o] = struct{}{}
+	if !sweeping {
+		sweeping = true
+		go sweep()
+	}
+}
+
+func untrack(o *lazyOutbound) {
+	parsedMu.Lock()
+	delete(parsed, o)
+	parsedMu.Unlock()
+}
+
+func sweep() {
+	ticker := time.NewTicker(IdleRelease / 4)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		parsedMu.Lock()
+		held := make([]*lazyOutbound, 0, len(parsed))
+		for o := range parsed {
+			held = append(held, o)
+		}
+		parsedMu.Unlock()
+
+		for _, o := range held {
+			o.releaseIdle(now)
+		}
+
+		parsedMu.Lock()
+		if len(parsed) == 0 {
+			sweeping = false
+			parsedMu.Unlock()
+			return
+		}
+		parsedMu.Unlock()
+	}
+}
@@ -0,0 +1,150 @@
+package lazyout
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/outbound"
+	singlog "github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/service"
+)
+
+// fakeRegistry creates pipe outbounds and counts them.
+type fakeRegistry struct {
+	created int
+	closed  int
+}
+
+func (r *fakeRegistry) CreateOptions(string) (any, bool) { return nil, false }
+
+func (r *fakeRegistry) CreateOutbound(_ context.Context, _ adapter.Router, _ singlog.ContextLogger, tag, outboundType string, _ any) (adapter.Outbound, error) {
+	r.created++
+	return &pipeOutbound{Adapter: outbound.NewAdapter(outboundType, tag, []string{N.NetworkTCP}, nil), registry: r}, nil
+}
+
+type pipeOutbound struct {
+	outbound.Adapter
+	registry *fakeRegistry
+}
+
+func (p *pipeOutbound) DialContext(context.Context, string, M.Socksaddr) (net.Conn, error) {
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func (p *pipeOutbound) ListenPacket(context.Context, M.Socksaddr) (net.PacketConn, error) {
+	return nil, errors.New("no udp")
+}
+
+func (p *pipeOutbound) Close() error {
+	p.registry.closed++
+	return nil
+}
+
+func newTestOutbound(t *testing.T, registry *fakeRegistry, uri string) *lazyOutbound {
+	t.Helper()
+	ctx := service.ContextWith[adapter.OutboundRegistry](context.Background(), adapter.OutboundRegistry(registry))
+	out, err := newOutbound(ctx, nil, singlog.NewNOPFactory().Logger(), "node-1", Options{URI: uri, TCPOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.(*lazyOutbound)
+}
+
+func TestParsedOnFirstDialAndReleasedWhenIdle(t *testing.T) {
+	parses := 0
+	SetParser(func(tag string, options Options) (option.Outbound, error) {
+		parses++
+		if options.URI == "bad://" {
+			return option.Outbound{}, errors.New("unsupported scheme")
+		}
+		return option.Outbound{Type: "pipe", Tag: tag}, nil
+	})
+	defer SetParser(nil)
+
+	registry := &fakeRegistry{}
+	o := newTestOutbound(t, registry, "socks5://203.0.113.1:1080")
+	defer o.Close()
+	if registry.created != 0 || len(o.Network()) != 1 {
+		t.Fatalf("created %d outbound(s) before use, network %v", registry.created, o.Network())
+	}
+
+	conn, err := o.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddr("example.com:80"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddr("example.com:80")); err != nil {
+		t.Fatal(err)
+	}
+	if registry.created != 1 || parses != 1 {
+		t.Fatalf("parsed %d and created %d times, want once", parses, registry.created)
+	}
+
+	// An open connection keeps the parsed outbound.
+	o.releaseIdle(time.Now().Add(2 * IdleRelease))
+	if registry.closed != 0 {
+		t.Fatal("released with a connection open")
+	}
+	conn.Close()
+	o.releaseIdle(time.Now().Add(2 * IdleRelease))
+	if registry.closed != 0 {
+		t.Fatal("released with the second connection still counted")
+	}
+
+	bad := newTestOutbound(t, registry, "bad://")
+	defer bad.Close()
+	for range 2 {
+		if _, err := bad.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddr("example.com:80")); err == nil {
+			t.Fatal("dialed a node whose URI does not parse")
+		}
+	}
+	if parses != 2 {
+		t.Fatalf("a bad URI was parsed again: %d parses", parses)
+	}
+}
+
+func TestReleaseIdle(t *testing.T) {
+	SetParser(func(tag string, options Options) (option.Outbound, error) {
+		return option.Outbound{Type: "pipe", Tag: tag}, nil
+	})
+	defer SetParser(nil)
+
+	registry := &fakeRegistry{}
+	o := newTestOutbound(t, registry, "socks5://203.0.113.1:1080")
+	conn, err := o.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddr("example.com:80"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	conn.Close() // closing twice releases once
+
+	o.releaseIdle(time.Now())
+	if registry.closed != 0 {
+		t.Fatal("released before IdleRelease")
+	}
+	o.releaseIdle(time.Now().Add(IdleRelease))
+	if registry.closed != 1 {
+		t.Fatal("not released after IdleRelease")
+	}
+	if _, err := o.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddr("example.com:80")); err != nil {
+		t.Fatal(err)
+	}
+	if registry.created != 2 {
+		t.Fatalf("created %d times, want the node parsed again after release", registry.created)
+	}
+	o.Close()
+	if registry.closed != 2 {
+		t.Fatal("Close left the parsed outbound open")
+	}
+	if _, err := o.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddr("example.com:80")); err == nil {
+		t.Fatal("dialed after Close")
+	}
+}
@@ -0,0 +1,72 @@
+// Package pluginout is the sing-box outbound of nodes handled by a protocol
+// plugin (see package plugin). Such nodes join the pool, health checks and
+// stats like any other node; they carry TCP only.
+package pluginout
+
+import (
+	"context"
+	"net"
+
+	"easy_proxies/internal/plugin"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/outbound"
+	singlog "github.com/sagernet/sing-box/log"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// Type is the outbound type name exposed to sing-box.
+const Type = "plugin"
+
+// Options is the node the outbound dials through: a plugin URI, or an
+// external command for exec nodes.
+type Options struct {
+	URI     string
+	Command *plugin.Command `json:",omitempty"`
+}
+
+// Register wires the plugin outbound into the registry.
+func Register(registry *outbound.Registry) {
+	outbound.Register[Options](registry, Type, newOutbound)
+}
+
+type pluginOutbound struct {
+	outbound.Adapter
+	dialer plugin.Dialer
+}
+
+func newOutbound(_ context.Context, _ adapter.Router, _ singlog.ContextLogger, tag string, options Options) (adapter.Outbound, error) {
+	var (
+		dialer plugin.Dialer
+		err    error
+	)
+	if options.Command != nil {
+		dialer, err = plugin.NewCommand(*options.Command)
+	} else {
+		dialer, err = plugin.New(options.URI)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pluginOutbound{
+		Adapter: outbound.NewAdapter(Type, tag, []string{N.NetworkTCP}, nil),
+		dialer:  dialer,
+	}, nil
+}
+
+func (o *pluginOutbound) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	if N.NetworkName(network) != N.NetworkTCP {
+		return nil, E.New("plugin outbound ", o.Tag(), " supports TCP only")
+	}
+	return o.dialer.DialContext(ctx, N.NetworkTCP, destination.String())
+}
+
+func (o *pluginOutbound) ListenPacket(context.Context, M.Socksaddr) (net.PacketConn, error) {
+	return nil, E.New("plugin outbound ", o.Tag(), " supports TCP only")
+}
+
+func (o *pluginOutbound) Close() error {
+	return o.dialer.Close()
+}
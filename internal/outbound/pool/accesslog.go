@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"easy_proxies/internal/accesslog"
+	"easy_proxies/internal/proxyerr"
+
+	"github.com/sagernet/sing-box/adapter"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+// accessEntry starts the access log entry of a connection through p. The
+// client and inbound come from the sing-box inbound metadata, or from
+// listeners that dial the pool directly. It is empty while the access log
+// is disabled.
+func (p *poolOutbound) accessEntry(ctx context.Context, network string, destination M.Socksaddr, user string) accesslog.Entry {
+	if !accesslog.Enabled() {
+		return accesslog.Entry{}
+	}
+	entry := accesslog.Entry{
+		Time:    time.Now(),
+		Client:  accesslog.ClientFromContext(ctx),
+		User:    user,
+		Tag:     accesslog.TagFromContext(ctx),
+		Network: network,
+		Target:  destination.String(),
+	}
+	if md := adapter.ContextFrom(ctx); md != nil {
+		if md.Source.IsValid() {
+			entry.Client = md.Source.String()
+		}
+		entry.Inbound = md.Inbound
+	}
+	return entry
+}
+
+// withMember records the node that carried the connection.
+func (p *poolOutbound) withMember(entry accesslog.Entry, member *memberState) accesslog.Entry {
+	entry.Node = member.tag
+	entry.NodeName = p.options.Metadata[member.tag].Name
+	entry.CostPerGB = member.costPerGB
+	return entry
+}
+
+// logAccessFailure logs a connection that could not be established, with
+// the error class and the nodes tried. Entries served by sing-box cannot
+// answer with a 502, so this is where their failure reason is kept.
+func logAccessFailure(entry accesslog.Entry, err error) {
+	if !accesslog.Enabled() {
+		return
+	}
+	detail := proxyerr.DetailOf(err)
+	entry.Duration = time.Since(entry.Time)
+	entry.Result = accesslog.ResultError
+	entry.Error = err.Error()
+	entry.ErrorClass = detail.Class
+	entry.NodesTried = detail.NodesTried
+	accesslog.Log(entry)
+}
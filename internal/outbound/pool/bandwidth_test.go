@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/monitor"
+)
+
+func TestSelectBandwidthPrefersFastest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	saved := monitor.StatsSnapshot{Nodes: []monitor.NodeStats{
+		{Tag: "slow", URI: "socks5://slow:1080", SpeedTests: []monitor.SpeedTestResult{{Time: time.Now(), Mbps: 10}}},
+		{Tag: "fast", URI: "socks5://fast:1080", SpeedTests: []monitor.SpeedTestResult{{Time: time.Now(), Mbps: 80}, {Time: time.Now(), Error: "timeout"}}},
+	}}
+	data, _ := json.Marshal(saved)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mgr, _ := monitor.NewManager(monitor.Config{})
+	defer mgr.Stop()
+	mgr.SetStatsFile(path)
+	members := make([]*memberState, 0, 3)
+	for _, tag := range []string{"untested", "slow", "fast"} {
+		entry := mgr.Register(monitor.NodeInfo{Tag: tag, URI: "socks5://" + tag + ":1080"})
+		entry.MarkAvailable(true)
+		members = append(members, &memberState{tag: tag, entry: entry})
+	}
+	if _, _, err := mgr.RestoreStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &poolOutbound{mode: modeBandwidth}
+	if got := p.selectByMode(members).tag; got != "fast" {
+		t.Fatalf("expected the fastest member, got %s", got)
+	}
+	members[2].entry.MarkAvailable(false)
+	if got := p.selectByMode(members).tag; got != "slow" {
+		t.Fatalf("expected the fastest available member, got %s", got)
+	}
+	// Nothing measured: round-robin like latency mode.
+	if got := p.selectByMode(members[:1]).tag; got != "untested" {
+		t.Fatalf("expected the round-robin fallback, got %s", got)
+	}
+}
+
+func TestNormalizeOptionsAcceptsBandwidth(t *testing.T) {
+	if got := normalizeOptions(Options{Mode: "Bandwidth"}).Mode; got != modeBandwidth {
+		t.Fatalf("expected mode %q, got %q", modeBandwidth, got)
+	}
+}
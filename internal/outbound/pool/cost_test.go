@@ -0,0 +1,28 @@
+package pool
+
+import "testing"
+
+func TestSelectCostPrefersCheapest(t *testing.T) {
+	members := []*memberState{
+		{tag: "metered", costPerGB: 2, shared: &sharedMemberState{}},
+		{tag: "cheap", costPerGB: 0.5, shared: &sharedMemberState{}},
+		{tag: "flat-a", shared: &sharedMemberState{}},
+		{tag: "flat-b", shared: &sharedMemberState{}},
+	}
+	p := &poolOutbound{mode: modeCost}
+	if got := p.selectByMode(members[:2]).tag; got != "cheap" {
+		t.Fatalf("expected the cheapest member, got %s", got)
+	}
+	// Flat-rate members are free at the margin and share the load.
+	members[2].shared.active.Store(3)
+	members[3].shared.active.Store(1)
+	if got := p.selectByMode(members).tag; got != "flat-b" {
+		t.Fatalf("expected the least busy flat-rate member, got %s", got)
+	}
+}
+
+func TestNormalizeOptionsAcceptsCost(t *testing.T) {
+	if got := normalizeOptions(Options{Mode: "COST"}).Mode; got != modeCost {
+		t.Fatalf("expected mode %q, got %q", modeCost, got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"sync"
+	"time"
 
 	M "github.com/sagernet/sing/common/metadata"
 )
@@ -26,8 +27,10 @@ func (a *poolDialerAdapter) DialContext(ctx context.Context, network, address st
 }
 
 // registerDialer adds a pool outbound to the global dialer registry.
-func registerDialer(tag string, p *poolOutbound) {
-	dialerRegistry.Store(tag, &poolDialerAdapter{pool: p})
+func registerDialer(tag string, p *poolOutbound) *poolDialerAdapter {
+	adapter := &poolDialerAdapter{pool: p}
+	dialerRegistry.Store(tag, adapter)
+	return adapter
 }
 
 // GetDialer returns a NetDialer for the given pool tag.
@@ -39,6 +42,20 @@ func GetDialer(tag string) (NetDialer, bool) {
 	return v.(NetDialer), true
 }
 
+// Activity reports how many connections of the pool outbound tag are open
+// and when one was last opened or closed (zero if never).
+func Activity(tag string) (open int64, lastUsed time.Time, ok bool) {
+	v, ok := dialerRegistry.Load(tag)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	p := v.(*poolDialerAdapter).pool
+	if last := p.lastUsed.Load(); last > 0 {
+		lastUsed = time.Unix(0, last)
+	}
+	return p.open.Load(), lastUsed, true
+}
+
 // ResetDialerRegistry clears the dialer registry (called during config reload).
 func ResetDialerRegistry() {
 	dialerRegistry.Range(func(key, _ any) bool {
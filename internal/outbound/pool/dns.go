@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/sagernet/sing-box/adapter"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/service"
+)
+
+// resolvesLocally reports whether hostnames sent through member are
+// resolved here (dns.resolve: local) instead of by the node.
+func (p *poolOutbound) resolvesLocally(member *memberState) bool {
+	return p.options.Metadata[member.tag].ResolveLocal
+}
+
+// lookup resolves domain with the configured DNS servers, trying each in
+// order, or with the default server when none are configured.
+func (p *poolOutbound) lookup(ctx context.Context, domain string) ([]netip.Addr, error) {
+	router := service.FromContext[adapter.DNSRouter](p.ctx)
+	if router == nil {
+		return nil, E.New("local DNS resolution is not available")
+	}
+	transports := service.FromContext[adapter.DNSTransportManager](p.ctx)
+	if len(p.options.DNSServers) == 0 || transports == nil {
+		return router.Lookup(ctx, domain, adapter.DNSQueryOptions{})
+	}
+	var lastErr error
+	for _, tag := range p.options.DNSServers {
+		transport, ok := transports.Transport(tag)
+		if !ok {
+			continue
+		}
+		addrs, err := router.Lookup(ctx, domain, adapter.DNSQueryOptions{Transport: transport})
+		if err == nil {
+			return addrs, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = E.New("no DNS server available")
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailurePolicyUsesMemberOverride(t *testing.T) {
+	p := &poolOutbound{options: normalizeOptions(Options{
+		FailureThreshold:  3,
+		BlacklistDuration: 24 * time.Hour,
+		Metadata: map[string]MemberMeta{
+			"residential": {Group: "residential", FailureThreshold: 1, BlacklistDuration: 5 * time.Minute},
+			"partial":     {Group: "dc", BlacklistDuration: time.Hour},
+		},
+	})}
+
+	tests := []struct {
+		tag       string
+		threshold int
+		duration  time.Duration
+	}{
+		{tag: "residential", threshold: 1, duration: 5 * time.Minute},
+		{tag: "partial", threshold: 3, duration: time.Hour},
+		{tag: "plain", threshold: 3, duration: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		threshold, duration := p.failurePolicy(tt.tag)
+		if threshold != tt.threshold || duration != tt.duration {
+			t.Errorf("%s: got %d/%s, want %d/%s", tt.tag, threshold, duration, tt.threshold, tt.duration)
+		}
+	}
+}
+
+func TestNormalizeOptionsGroupModes(t *testing.T) {
+	options := normalizeOptions(Options{Mode: "random", GroupModes: map[string]string{"Residential": "Weighted", "dc": "bogus"}})
+	if got := options.GroupModes["residential"]; got != modeWeighted {
+		t.Fatalf("expected residential mode %q, got %q", modeWeighted, got)
+	}
+	if got := options.GroupModes["dc"]; got != modeSequential {
+		t.Fatalf("expected unknown mode to fall back to %q, got %q", modeSequential, got)
+	}
+}
+
+func TestSelectWithModeOverridesPoolMode(t *testing.T) {
+	p := &poolOutbound{mode: modeSequential}
+	a := &memberState{tag: "a", weight: 2}
+	b := &memberState{tag: "b", weight: 1}
+	candidates := []*memberState{a, b}
+
+	var got string
+	for i := 0; i < 3; i++ {
+		got += p.selectWithMode(modeWeighted, candidates).tag
+	}
+	if got != "aba" {
+		t.Fatalf("expected weighted order aba, got %s", got)
+	}
+}
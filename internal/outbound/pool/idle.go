@@ -0,0 +1,126 @@
+package pool
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idleTracker closes the tunnels of a pool outbound that carried no bytes in
+// either direction for longer than timeout. Some providers leave upstream
+// connections half-open, and without this they pile up until the process
+// runs out of file descriptors. The sweeper runs only while tunnels are
+// open, so idle pools (one per node in multi-port mode) cost nothing.
+type idleTracker struct {
+	timeout  time.Duration
+	mu       sync.Mutex
+	conns    map[*idleConn]struct{}
+	sweeping bool
+}
+
+func newIdleTracker(timeout time.Duration) *idleTracker {
+	if timeout <= 0 {
+		return nil
+	}
+	return &idleTracker{timeout: timeout, conns: make(map[*idleConn]struct{})}
+}
+
+// track wraps conn so its reads and writes count as activity.
+func (t *idleTracker) track(conn net.Conn, member *memberState) net.Conn {
+	c := &idleConn{Conn: conn, member: member, tracker: t}
+	c.touch()
+	t.mu.Lock()
+	t.conns[c] = struct{}{}
+	if !t.sweeping {
+		t.sweeping = true
+		go t.sweep()
+	}
+	t.mu.Unlock()
+	return c
+}
+
+// sweepInterval is how often open tunnels are checked: a quarter of the
+// timeout, between one second and one minute.
+func (t *idleTracker) sweepInterval() time.Duration {
+	return min(max(t.timeout/4, time.Second), time.Minute)
+}
+
+func (t *idleTracker) sweep() {
+	ticker := time.NewTicker(t.sweepInterval())
+	defer ticker.Stop()
+	for range ticker.C {
+		if !t.closeIdle(time.Now()) {
+			return
+		}
+	}
+}
+
+// closeIdle closes the tunnels idle since before now-timeout and reports
+// whether any tunnel is left to watch; the sweeper stops when none is.
+func (t *idleTracker) closeIdle(now time.Time) bool {
+	deadline := now.Add(-t.timeout).UnixNano()
+	var idle []*idleConn
+	t.mu.Lock()
+	for c := range t.conns {
+		if c.lastActive.Load() < deadline {
+			idle = append(idle, c)
+			delete(t.conns, c)
+		}
+	}
+	left := len(t.conns) > 0
+	if !left {
+		t.sweeping = false
+	}
+	t.mu.Unlock()
+
+	for _, c := range idle {
+		_ = c.Conn.Close()
+		if c.member != nil {
+			c.member.entry.AddIdleClosed()
+		}
+	}
+	if len(idle) > 0 {
+		log.Printf("🧹 [pool] closed %d tunnel(s) idle for over %s", len(idle), t.timeout)
+	}
+	return left
+}
+
+func (t *idleTracker) forget(c *idleConn) {
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+}
+
+type idleConn struct {
+	net.Conn
+	member     *memberState
+	tracker    *idleTracker
+	lastActive atomic.Int64 // unix nanos of the last read or write
+}
+
+func (c *idleConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *idleConn) Close() error {
+	c.tracker.forget(c)
+	return c.Conn.Close()
+}
@@ -0,0 +1,35 @@
+package pool
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIdleTrackerClosesQuietTunnels(t *testing.T) {
+	tracker := newIdleTracker(time.Minute)
+	quietClient, quietServer := net.Pipe()
+	busyClient, busyServer := net.Pipe()
+	defer quietServer.Close()
+	defer busyServer.Close()
+	quiet := tracker.track(quietClient, &memberState{tag: "a"})
+	busy := tracker.track(busyClient, &memberState{tag: "b"})
+
+	// Age the quiet tunnel past the timeout.
+	quiet.(*idleConn).lastActive.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if left := tracker.closeIdle(time.Now()); !left {
+		t.Fatal("the busy tunnel should still be watched")
+	}
+	if _, err := quiet.Write([]byte("x")); err == nil {
+		t.Fatal("expected the idle tunnel to be closed")
+	}
+
+	go func() { _, _ = busyServer.Read(make([]byte, 1)) }()
+	if _, err := busy.Write([]byte("x")); err != nil {
+		t.Fatalf("busy tunnel was closed: %v", err)
+	}
+	_ = busy.Close()
+	if left := tracker.closeIdle(time.Now()); left {
+		t.Fatal("closed tunnels must be forgotten")
+	}
+}
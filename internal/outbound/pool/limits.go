@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	"easy_proxies/internal/users"
+
+	"github.com/sagernet/sing-box/adapter"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+// errNodeBusy is returned when every usable member is at its connection cap.
+var errNodeBusy = E.New("all proxies are at their connection limit")
+
+// acquireConn admits a new connection against the user's limits and the
+// client limits of the inbound it came from. The returned release func must
+// be called exactly once when the connection ends.
+func acquireConn(ctx context.Context, user string) (func(), error) {
+	releaseUser, err := users.Acquire(user)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", user, err)
+	}
+	md := adapter.ContextFrom(ctx)
+	if md == nil {
+		return releaseUser, nil
+	}
+	releaseClient, err := users.AcquireClient(md.Inbound, md.Source.Addr)
+	if err != nil {
+		releaseUser()
+		return nil, fmt.Errorf("client %s: %w", md.Source.AddrString(), err)
+	}
+	return func() {
+		releaseClient()
+		releaseUser()
+	}, nil
+}
+
+// memberConnLimit returns the connection cap of tag, 0 for unlimited.
+func (p *poolOutbound) memberConnLimit(tag string) int32 {
+	if limit := p.options.Metadata[tag].MaxConns; limit > 0 {
+		return int32(limit)
+	}
+	return int32(p.options.MaxConnsPerNode)
+}
+
+// tryIncActive counts a new connection through member unless it is at its
+// cap. The count is shared with every pool the member belongs to.
+func (p *poolOutbound) tryIncActive(member *memberState) bool {
+	if member.shared == nil {
+		return true
+	}
+	return member.shared.tryIncActive(member.maxConns)
+}
+
+// admit counts a new connection through member like tryIncActive and, when
+// the member is half-open, claims its single trial request.
+func (p *poolOutbound) admit(member *memberState) bool {
+	if !p.tryIncActive(member) {
+		return false
+	}
+	if member.shared != nil && !member.shared.beginTrial() {
+		p.decActive(member)
+		return false
+	}
+	return true
+}
+
+// full reports whether member is at its connection cap.
+func (m *memberState) full() bool {
+	return m.maxConns > 0 && m.shared != nil && m.shared.activeCount() >= m.maxConns
+}
+
+// withoutFullMembers filters candidates in place, so a member at its cap is
+// passed over for another rather than queued.
+func withoutFullMembers(candidates []*memberState) []*memberState {
+	kept := candidates[:0]
+	for _, m := range candidates {
+		if !m.full() {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
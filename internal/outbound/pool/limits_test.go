@@ -0,0 +1,48 @@
+package pool
+
+import "testing"
+
+func TestTryIncActiveRespectsCap(t *testing.T) {
+	state := &sharedMemberState{}
+	member := &memberState{tag: "a", shared: state, maxConns: 2}
+	p := &poolOutbound{}
+
+	if !p.tryIncActive(member) || !p.tryIncActive(member) {
+		t.Fatal("expected two connections below the cap")
+	}
+	if p.tryIncActive(member) {
+		t.Fatal("expected the third connection to be refused")
+	}
+	if !member.full() {
+		t.Fatal("member at its cap must report full")
+	}
+	state.decActive()
+	if member.full() || !p.tryIncActive(member) {
+		t.Fatal("expected a free slot after a connection closed")
+	}
+}
+
+func TestWithoutFullMembersSkipsBusyNode(t *testing.T) {
+	busy := &memberState{tag: "busy", shared: &sharedMemberState{}, maxConns: 1}
+	idle := &memberState{tag: "idle", shared: &sharedMemberState{}, maxConns: 1}
+	unlimited := &memberState{tag: "unlimited", shared: &sharedMemberState{}}
+	busy.shared.tryIncActive(busy.maxConns)
+
+	got := withoutFullMembers([]*memberState{busy, idle, unlimited})
+	if len(got) != 2 || got[0] != idle || got[1] != unlimited {
+		t.Fatalf("expected idle and unlimited members, got %v", got)
+	}
+}
+
+func TestMemberConnLimitOverride(t *testing.T) {
+	p := &poolOutbound{options: Options{
+		MaxConnsPerNode: 10,
+		Metadata:        map[string]MemberMeta{"b": {MaxConns: 3}},
+	}}
+	if got := p.memberConnLimit("a"); got != 10 {
+		t.Fatalf("default limit = %d, want 10", got)
+	}
+	if got := p.memberConnLimit("b"); got != 3 {
+		t.Fatalf("override = %d, want 3", got)
+	}
+}
@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"net"
+	"testing"
+)
+
+func TestOpenConnectionsTracksWrappedConns(t *testing.T) {
+	p := &poolOutbound{}
+	member := &memberState{tag: "a"}
+	before := OpenConnections()
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	conn := p.wrapConn(c1, member)
+	if got := OpenConnections() - before; got != 1 {
+		t.Fatalf("expected 1 open connection, got %d", got)
+	}
+	conn.Close()
+	conn.Close() // double close must not double count
+	if got := OpenConnections() - before; got != 0 {
+		t.Fatalf("expected 0 open connections after close, got %d", got)
+	}
+}
+
+func TestActivityReportsPerPoolUsage(t *testing.T) {
+	p := &poolOutbound{}
+	registerDialer("activity-test", p)
+	defer dialerRegistry.Delete("activity-test")
+
+	if open, last, ok := Activity("activity-test"); !ok || open != 0 || !last.IsZero() {
+		t.Fatalf("fresh pool: open=%d last=%v ok=%v", open, last, ok)
+	}
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	conn := p.wrapConn(c1, &memberState{tag: "a"})
+	if open, last, _ := Activity("activity-test"); open != 1 || last.IsZero() {
+		t.Fatalf("after open: open=%d last=%v", open, last)
+	}
+	conn.Close()
+	if open, _, _ := Activity("activity-test"); open != 0 {
+		t.Fatalf("after close: open=%d", open)
+	}
+	if _, _, ok := Activity("missing"); ok {
+		t.Fatal("unknown tag should not be found")
+	}
+}
@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/users"
+
+	"github.com/sagernet/sing-box/adapter"
+	N "github.com/sagernet/sing/common/network"
+)
+
+func TestPickMemberHonoursPin(t *testing.T) {
+	tcp := networkOutbound{networks: []string{N.NetworkTCP}}
+	p := &poolOutbound{
+		members: []*memberState{{tag: "a", outbound: tcp}, {tag: "b", outbound: tcp}, {tag: "c", outbound: tcp}},
+		options: Options{Metadata: map[string]MemberMeta{
+			"a": {Name: "tokyo1", Group: "jp"},
+			"b": {Name: "tokyo2", Group: "JP"},
+			"c": {Name: "dallas", Group: "us"},
+		}},
+	}
+
+	for _, pin := range []users.Pin{{Node: "tokyo2"}, {Node: "b"}} {
+		for i := 0; i < 3; i++ {
+			member, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", pin, nil)
+			if err != nil || member.tag != "b" {
+				t.Fatalf("pin %+v picked %v, %v", pin, member, err)
+			}
+		}
+	}
+	for i := 0; i < 6; i++ {
+		member, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{Group: "jp"}, nil)
+		if err != nil || member.tag == "c" {
+			t.Fatalf("group pin picked %v, %v", member, err)
+		}
+	}
+	_, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{Node: "paris"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "node paris") {
+		t.Fatalf("expected no-match error, got %v", err)
+	}
+}
+
+func TestPinFromInboundUser(t *testing.T) {
+	ctx := adapter.WithContext(context.Background(), &adapter.InboundContext{User: "alice-node-tokyo1"})
+	if got := userFromCtx(ctx); got != "alice" {
+		t.Fatalf("userFromCtx = %q, want alice", got)
+	}
+	if got := pinFromCtx(ctx); got.Node != "tokyo1" {
+		t.Fatalf("pinFromCtx = %+v", got)
+	}
+	ctx = users.WithPin(context.Background(), users.Pin{Group: "jp"})
+	if got := pinFromCtx(ctx); got.Group != "jp" {
+		t.Fatalf("pinFromCtx = %+v", got)
+	}
+}
+
+func TestPickMemberHonoursTierGroups(t *testing.T) {
+	tcp := networkOutbound{networks: []string{N.NetworkTCP}}
+	p := &poolOutbound{
+		members: []*memberState{{tag: "a", outbound: tcp}, {tag: "b", outbound: tcp}, {tag: "c", outbound: tcp}},
+		options: Options{Metadata: map[string]MemberMeta{
+			"a": {Name: "free1", Group: "free"},
+			"b": {Name: "tokyo", Group: "Premium"},
+			"c": {Name: "dallas", Group: "premium"},
+		}},
+	}
+
+	for i := 0; i < 6; i++ {
+		member, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{}, []string{"premium"})
+		if err != nil || member.tag == "a" {
+			t.Fatalf("premium tier picked %v, %v", member, err)
+		}
+	}
+	if _, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{Node: "tokyo"}, []string{"free"}); err == nil {
+		t.Fatal("a pin must not reach nodes outside the tier")
+	}
+	if _, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{}, []string{"vip"}); err == nil || !strings.Contains(err.Error(), "groups vip") {
+		t.Fatalf("expected no-match error, got %v", err)
+	}
+}
@@ -4,16 +4,23 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"net/netip"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"easy_proxies/internal/accesslog"
+	"easy_proxies/internal/chaos"
+	"easy_proxies/internal/clock"
 	"easy_proxies/internal/monitor"
+	"easy_proxies/internal/proxyerr"
+	"easy_proxies/internal/users"
 
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/adapter/outbound"
@@ -35,6 +42,13 @@ const (
 	modeRandom     = "random"
 	modeBalance    = "balance"
 	modeLatency    = "latency"
+	modeWeighted   = "weighted"
+	modeBandwidth  = "bandwidth"
+	modeCost       = "cost"
+
+	healthCheckHTTP = "http"
+	healthCheckTCP  = "tcp"
+	healthCheckTLS  = "tls"
 )
 
 // Options controls pool outbound behaviour.
@@ -48,21 +62,92 @@ type Options struct {
 	// RetryAttempts is the maximum total dial attempts (including the first).
 	// Multi-member pools pick a different member per retry; single-member pools retry the same member.
 	RetryAttempts int
-	Metadata      map[string]MemberMeta
+	// MaxConnsPerNode caps concurrent connections through one member; a
+	// member at its cap is skipped. MemberMeta.MaxConns overrides it.
+	MaxConnsPerNode int
+	// IdleTimeout closes TCP tunnels that carried no bytes in either
+	// direction for this long; 0 keeps them open.
+	IdleTimeout time.Duration
+	Metadata    map[string]MemberMeta
+	// GroupModes maps a node group to the scheduling mode used when a
+	// request is pinned to that group; unset groups use Mode.
+	GroupModes map[string]string
+	// DNSServers are the DNS server tags, in fallback order, used for
+	// members with MemberMeta.ResolveLocal; empty uses the default server.
+	DNSServers []string
 	// Sticky pins each client (by source IP) to a single member, only
 	// re-selecting when the pinned member becomes unavailable. Pool/hybrid entry only.
 	Sticky bool
+	// HealthCheck controls how active probes judge a member and when a
+	// member is taken out of / put back into rotation.
+	HealthCheck HealthCheckOptions
+	// CircuitBreaker replaces the fixed BlacklistDuration with half-open
+	// trials when enabled.
+	CircuitBreaker CircuitBreakerOptions
+	// Seed seeds random mode so its choices repeat from run to run; 0
+	// seeds from the clock.
+	Seed int64
+	// StandbyThreshold is the number of usable regular members below which
+	// standby members (MemberMeta.Standby) join the rotation. Values < 1
+	// count as 1, so standby members only step in when no regular member
+	// is left.
+	StandbyThreshold int
+	// GroupSLOs maps a node group to the connect-time objective of its
+	// members.
+	GroupSLOs map[string]SLOOptions
+}
+
+// CircuitBreakerOptions configures the circuit breaker. An open member gets
+// a single trial request after HalfOpenInterval; each failed trial doubles
+// the wait, up to MaxHalfOpenInterval.
+type CircuitBreakerOptions struct {
+	Enabled             bool
+	HalfOpenInterval    time.Duration
+	MaxHalfOpenInterval time.Duration
+}
+
+// HealthCheckOptions configures active probing of pool members.
+type HealthCheckOptions struct {
+	// Type is "http" (dial + HTTP request, default), "tcp" (dial only) or
+	// "tls" (dial + verified TLS handshake with the probe host).
+	Type string
+	// HealthyThreshold is the number of consecutive successful probes that
+	// return an unhealthy member to rotation.
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of consecutive failed probes that
+	// remove a member from rotation.
+	UnhealthyThreshold int
 }
 
 // MemberMeta carries optional descriptive information for monitoring UI.
 type MemberMeta struct {
 	Name          string
+	DisplayName   string // Name as configured, before duplicates were suffixed
 	URI           string
 	Mode          string
 	ListenAddress string
 	Port          uint16
 	Region        string // GeoIP region code: "jp", "kr", "us", "hk", "tw", "other"
 	Country       string // Full country name from GeoIP
+	Group         string // Node group, matched by per-request group pins
+	// Weight is the member's share in weighted mode (values < 1 count as 1).
+	Weight int
+	// MaxConns overrides Options.MaxConnsPerNode for this member.
+	MaxConns int
+	// CostPerGB and CostPerHour are what the member costs. Cost mode picks
+	// the lowest CostPerGB; both are shown in the monitor's cost report.
+	CostPerGB   float64
+	CostPerHour float64
+	// FailureThreshold and BlacklistDuration override the pool's values for
+	// this member, so a node keeps its group's policy in every pool.
+	FailureThreshold  int
+	BlacklistDuration time.Duration
+	// ResolveLocal resolves TCP destination hostnames before dialing, so
+	// the node is sent an IP address. UDP destinations are passed as is.
+	ResolveLocal bool
+	// Standby keeps the member out of rotation, though still probed, until
+	// fewer than Options.StandbyThreshold regular members are usable.
+	Standby bool
 }
 
 // Register wires the pool outbound into the registry.
@@ -75,6 +160,20 @@ type memberState struct {
 	tag      string
 	entry    *monitor.EntryHandle
 	shared   *sharedMemberState
+	weight   int
+	maxConns int32 // 0 = unlimited
+	// costPerGB is the member's traffic price; its traffic is counted in
+	// the monitor when it is set.
+	costPerGB float64
+	standby   bool
+	group     string
+	slo       *SLOOptions // objective of the member's group, nil when none
+	// promotedUntil puts a standby member in rotation as a regular one
+	// while another member of its group is out for missing the SLO,
+	// guarded by poolOutbound.mu.
+	promotedUntil time.Time
+	// currentWeight is the smooth weighted round-robin accumulator, guarded by poolOutbound.wrrMu.
+	currentWeight int
 }
 
 type poolOutbound struct {
@@ -89,11 +188,17 @@ type poolOutbound struct {
 	rrCounter      atomic.Uint32
 	rng            *rand.Rand
 	rngMu          sync.Mutex // protects rng for random mode
+	wrrMu          sync.Mutex // protects memberState.currentWeight for weighted mode
 	monitor        *monitor.Manager
 	candidatesPool sync.Pool
 	sticky         bool
 	stickyMu       sync.Mutex        // protects stickyMap
 	stickyMap      map[string]string // sticky key (client source IP) -> member tag
+	idle           *idleTracker      // nil unless Options.IdleTimeout is set
+	open           atomic.Int64      // connections of this pool not yet closed
+	lastUsed       atomic.Int64      // unix nanos of the last opened or closed connection
+	standbyInUse   atomic.Bool       // standby members are in rotation
+	dialer         *poolDialerAdapter
 }
 
 func newPool(ctx context.Context, _ adapter.Router, logger singlog.ContextLogger, tag string, options Options) (adapter.Outbound, error) {
@@ -114,9 +219,10 @@ func newPool(ctx context.Context, _ adapter.Router, logger singlog.ContextLogger
 		manager: manager,
 		options: normalized,
 		mode:    normalized.Mode,
-		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		rng:     newRand(normalized.Seed),
 		monitor: monitorMgr,
 		sticky:  normalized.Sticky,
+		idle:    newIdleTracker(normalized.IdleTimeout),
 		candidatesPool: sync.Pool{
 			New: func() any {
 				return make([]*memberState, 0, memberCount)
@@ -138,12 +244,17 @@ func newPool(ctx context.Context, _ adapter.Router, logger singlog.ContextLogger
 			info := monitor.NodeInfo{
 				Tag:           memberTag,
 				Name:          meta.Name,
+				DisplayName:   meta.DisplayName,
 				URI:           meta.URI,
 				Mode:          meta.Mode,
 				ListenAddress: meta.ListenAddress,
 				Port:          meta.Port,
 				Region:        meta.Region,
 				Country:       meta.Country,
+				MaxConns:      int(p.memberConnLimit(memberTag)),
+				CostPerGB:     meta.CostPerGB,
+				CostPerHour:   meta.CostPerHour,
+				Standby:       meta.Standby,
 			}
 			entry := monitorMgr.Register(info)
 			if entry != nil {
@@ -153,9 +264,11 @@ func newPool(ctx context.Context, _ adapter.Router, logger singlog.ContextLogger
 				// Set probe, release, and blacklist functions immediately
 				entry.SetRelease(p.makeReleaseByTagFunc(memberTag))
 				entry.SetBlacklistFn(p.makeBlacklistByTagFunc(memberTag))
+				entry.SetHealthFn(p.makeHealthByTagFunc(memberTag))
 				if probeFn := p.makeProbeByTagFunc(memberTag); probeFn != nil {
 					entry.SetProbe(probeFn)
 				}
+				entry.SetDialer(p.makeDialByTagFunc(memberTag))
 			} else {
 				logger.Warn("failed to register node: ", memberTag)
 			}
@@ -165,11 +278,20 @@ func newPool(ctx context.Context, _ adapter.Router, logger singlog.ContextLogger
 	}
 
 	// Register this pool outbound in the dialer registry for GeoIP router
-	registerDialer(tag, p)
+	p.dialer = registerDialer(tag, p)
 
 	return p, nil
 }
 
+// newRand returns the random source of random mode, seeded with seed or,
+// when it is 0, with the clock.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
 func normalizeOptions(options Options) Options {
 	if options.FailureThreshold <= 0 {
 		options.FailureThreshold = 3
@@ -183,17 +305,47 @@ func normalizeOptions(options Options) Options {
 	if options.Metadata == nil {
 		options.Metadata = make(map[string]MemberMeta)
 	}
-	switch strings.ToLower(options.Mode) {
+	switch strings.ToLower(options.HealthCheck.Type) {
+	case healthCheckTCP:
+		options.HealthCheck.Type = healthCheckTCP
+	case healthCheckTLS:
+		options.HealthCheck.Type = healthCheckTLS
+	default:
+		options.HealthCheck.Type = healthCheckHTTP
+	}
+	if options.HealthCheck.HealthyThreshold <= 0 {
+		options.HealthCheck.HealthyThreshold = 1
+	}
+	if options.HealthCheck.UnhealthyThreshold <= 0 {
+		options.HealthCheck.UnhealthyThreshold = 2
+	}
+	options.Mode = normalizeMode(options.Mode)
+	groupModes := make(map[string]string, len(options.GroupModes))
+	for group, mode := range options.GroupModes {
+		groupModes[strings.ToLower(group)] = normalizeMode(mode)
+	}
+	options.GroupModes = groupModes
+	options.GroupSLOs = normalizeSLOs(options.GroupSLOs)
+	return options
+}
+
+func normalizeMode(mode string) string {
+	switch strings.ToLower(mode) {
 	case modeRandom:
-		options.Mode = modeRandom
+		return modeRandom
 	case modeBalance:
-		options.Mode = modeBalance
+		return modeBalance
 	case modeLatency:
-		options.Mode = modeLatency
+		return modeLatency
+	case modeWeighted:
+		return modeWeighted
+	case modeBandwidth:
+		return modeBandwidth
+	case modeCost:
+		return modeCost
 	default:
-		options.Mode = modeSequential
+		return modeSequential
 	}
-	return options
 }
 
 func (p *poolOutbound) Start(stage adapter.StartStage) error {
@@ -214,6 +366,13 @@ func (p *poolOutbound) Start(stage adapter.StartStage) error {
 	return nil
 }
 
+// Close drops the pool from the dialer registry, unless a pool created
+// under the same tag has taken its place there.
+func (p *poolOutbound) Close() error {
+	dialerRegistry.CompareAndDelete(p.Tag(), p.dialer)
+	return nil
+}
+
 // initializeMembersLocked must be called with p.mu held
 func (p *poolOutbound) initializeMembersLocked() error {
 	if len(p.members) > 0 {
@@ -231,10 +390,18 @@ func (p *poolOutbound) initializeMembersLocked() error {
 		state := acquireSharedState(tag)
 
 		member := &memberState{
-			outbound: detour,
-			tag:      tag,
-			shared:   state,
-			entry:    state.entryHandle(),
+			outbound:  detour,
+			tag:       tag,
+			shared:    state,
+			entry:     state.entryHandle(),
+			weight:    p.options.Metadata[tag].Weight,
+			maxConns:  p.memberConnLimit(tag),
+			costPerGB: p.options.Metadata[tag].CostPerGB,
+			standby:   p.options.Metadata[tag].Standby,
+			group:     p.options.Metadata[tag].Group,
+		}
+		if slo, ok := p.options.GroupSLOs[member.group]; ok {
+			member.slo = &slo
 		}
 
 		// Connect to existing monitor entry if available
@@ -243,12 +410,16 @@ func (p *poolOutbound) initializeMembersLocked() error {
 			info := monitor.NodeInfo{
 				Tag:           tag,
 				Name:          meta.Name,
+				DisplayName:   meta.DisplayName,
 				URI:           meta.URI,
 				Mode:          meta.Mode,
 				ListenAddress: meta.ListenAddress,
 				Port:          meta.Port,
 				Region:        meta.Region,
 				Country:       meta.Country,
+				CostPerGB:     meta.CostPerGB,
+				CostPerHour:   meta.CostPerHour,
+				Standby:       meta.Standby,
 			}
 			entry := p.monitor.Register(info)
 			if entry != nil {
@@ -256,9 +427,11 @@ func (p *poolOutbound) initializeMembersLocked() error {
 				member.entry = entry
 				entry.SetRelease(p.makeReleaseFunc(member))
 				entry.SetBlacklistFn(p.makeBlacklistByTagFunc(member.tag))
+				entry.SetHealthFn(p.makeHealthByTagFunc(member.tag))
 				if probe := p.makeProbeFunc(member); probe != nil {
 					entry.SetProbe(probe)
 				}
+				entry.SetDialer(p.makeDialByTagFunc(member.tag))
 			}
 		}
 		members = append(members, member)
@@ -270,24 +443,77 @@ func (p *poolOutbound) initializeMembersLocked() error {
 }
 
 func (p *poolOutbound) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	user := userFromCtx(ctx)
+	entry := p.accessEntry(ctx, network, destination, user)
+	release, err := acquireConn(ctx, user)
+	if err != nil {
+		logAccessFailure(entry, err)
+		return nil, proxyerr.New(err, nil, "")
+	}
+	conn, member, err := p.dial(ctx, network, destination)
+	if err != nil {
+		release()
+		logAccessFailure(entry, err)
+		return nil, err
+	}
+	if member.costPerGB > 0 {
+		conn = countTraffic(conn, member.entry)
+	}
+	if accesslog.Enabled() {
+		conn = accesslog.WrapConn(conn, p.withMember(entry, member))
+	}
+	return users.WrapConn(conn, user, release), nil
+}
+
+func (p *poolOutbound) dial(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, *memberState, error) {
 	maxAttempts := p.maxAttempts()
 	stickyKey := p.stickyKeyFromCtx(ctx)
+	pin := pinFromCtx(ctx)
+	groups := users.Groups(userFromCtx(ctx))
 	singleMember := len(p.options.Members) <= 1
 	var tried map[string]bool
 	if !singleMember && maxAttempts > 1 {
 		tried = make(map[string]bool, maxAttempts)
 	}
 	var lastErr error
+	// attempted lists the members dialed, for the error detail.
+	var attempted []string
+	// resolved caches the local lookup of destination across attempts.
+	var resolved []netip.Addr
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		member, err := p.pickMemberFiltered(network, tried, stickyKey)
+		member, err := p.pickMemberFiltered(network, tried, stickyKey, pin, groups)
 		if err != nil {
 			if lastErr != nil {
-				return nil, fmt.Errorf("%w (after %d attempt(s); last: %v)", err, attempt-1, lastErr)
+				return nil, nil, proxyerr.New(fmt.Errorf("%w (after %d attempt(s); last: %v)", err, attempt-1, lastErr), attempted, proxyerr.Classify(lastErr))
 			}
-			return nil, err
+			return nil, nil, proxyerr.New(err, attempted, proxyerr.ClassNoNode)
+		}
+		resolveLocally := destination.IsFqdn() && p.resolvesLocally(member)
+		if resolveLocally && resolved == nil {
+			resolved, err = p.lookup(ctx, destination.Fqdn)
+			if err != nil {
+				// Not the member's fault: fail without blacklisting it.
+				return nil, nil, proxyerr.New(err, attempted, proxyerr.ClassDNS)
+			}
+		}
+		if !p.admit(member) {
+			// Filled up or taken for a half-open trial since it was
+			// picked: count it as tried and move on.
+			lastErr = errNodeBusy
+			if tried != nil {
+				tried[member.tag] = true
+			}
+			continue
+		}
+		attempted = append(attempted, member.tag)
+		var conn net.Conn
+		start := clock.Now()
+		dialErr := chaos.Dial(ctx, member.tag)
+		if dialErr == nil && resolveLocally {
+			conn, dialErr = N.DialSerial(ctx, member.outbound, network, destination, resolved)
+		} else if dialErr == nil {
+			conn, dialErr = member.outbound.DialContext(ctx, network, destination)
 		}
-		p.incActive(member)
-		conn, dialErr := member.outbound.DialContext(ctx, network, destination)
 		if dialErr != nil {
 			p.decActive(member)
 			p.recordFailure(member, dialErr)
@@ -298,7 +524,7 @@ func (p *poolOutbound) DialContext(ctx context.Context, network string, destinat
 			if attempt < maxAttempts {
 				p.logger.Warn("dial via ", member.tag, " failed (attempt ", attempt, "/", maxAttempts, "), retrying: ", dialErr)
 				if ctx.Err() != nil {
-					return nil, ctx.Err()
+					return nil, nil, proxyerr.New(ctx.Err(), attempted, "")
 				}
 				continue
 			}
@@ -308,33 +534,78 @@ func (p *poolOutbound) DialContext(ctx context.Context, network string, destinat
 			p.logger.Info("dial succeeded via ", member.tag, " after ", attempt, " attempts")
 		}
 		p.recordSuccess(member)
-		return p.wrapConn(conn, member), nil
+		p.observeConnect(member, clock.Since(start))
+		return p.wrapConn(chaos.WrapConn(conn, member.tag), member), member, nil
 	}
 	if lastErr == nil {
-		lastErr = E.New("no healthy proxy available")
+		return nil, nil, proxyerr.New(E.New("no healthy proxy available"), attempted, proxyerr.ClassNoNode)
+	}
+	class := proxyerr.Classify(lastErr)
+	if errors.Is(lastErr, errNodeBusy) {
+		class = proxyerr.ClassNodeBusy
 	}
-	return nil, fmt.Errorf("dial failed after %d attempts: %w", maxAttempts, lastErr)
+	return nil, nil, proxyerr.New(fmt.Errorf("dial failed after %d attempts: %w", maxAttempts, lastErr), attempted, class)
 }
 
 func (p *poolOutbound) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	user := userFromCtx(ctx)
+	entry := p.accessEntry(ctx, N.NetworkUDP, destination, user)
+	release, err := acquireConn(ctx, user)
+	if err != nil {
+		logAccessFailure(entry, err)
+		return nil, proxyerr.New(err, nil, "")
+	}
+	conn, member, err := p.listenPacket(ctx, destination)
+	if err != nil {
+		release()
+		logAccessFailure(entry, err)
+		return nil, err
+	}
+	if member.costPerGB > 0 {
+		conn = countPacketTraffic(conn, member.entry)
+	}
+	if accesslog.Enabled() {
+		conn = accesslog.WrapPacketConn(conn, p.withMember(entry, member))
+	}
+	return users.WrapPacketConn(conn, user, release), nil
+}
+
+func (p *poolOutbound) listenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, *memberState, error) {
 	maxAttempts := p.maxAttempts()
 	stickyKey := p.stickyKeyFromCtx(ctx)
+	pin := pinFromCtx(ctx)
+	groups := users.Groups(userFromCtx(ctx))
 	singleMember := len(p.options.Members) <= 1
 	var tried map[string]bool
 	if !singleMember && maxAttempts > 1 {
 		tried = make(map[string]bool, maxAttempts)
 	}
 	var lastErr error
+	// attempted lists the members tried, for the error detail.
+	var attempted []string
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		member, err := p.pickMemberFiltered(N.NetworkUDP, tried, stickyKey)
+		member, err := p.pickMemberFiltered(N.NetworkUDP, tried, stickyKey, pin, groups)
 		if err != nil {
 			if lastErr != nil {
-				return nil, fmt.Errorf("%w (after %d attempt(s); last: %v)", err, attempt-1, lastErr)
+				return nil, nil, proxyerr.New(fmt.Errorf("%w (after %d attempt(s); last: %v)", err, attempt-1, lastErr), attempted, proxyerr.Classify(lastErr))
 			}
-			return nil, err
+			return nil, nil, proxyerr.New(err, attempted, proxyerr.ClassNoNode)
+		}
+		if !p.admit(member) {
+			// Filled up or taken for a half-open trial since it was
+			// picked: count it as tried and move on.
+			lastErr = errNodeBusy
+			if tried != nil {
+				tried[member.tag] = true
+			}
+			continue
+		}
+		attempted = append(attempted, member.tag)
+		var conn net.PacketConn
+		listenErr := chaos.Dial(ctx, member.tag)
+		if listenErr == nil {
+			conn, listenErr = member.outbound.ListenPacket(ctx, destination)
 		}
-		p.incActive(member)
-		conn, listenErr := member.outbound.ListenPacket(ctx, destination)
 		if listenErr != nil {
 			p.decActive(member)
 			p.recordFailure(member, listenErr)
@@ -345,7 +616,7 @@ func (p *poolOutbound) ListenPacket(ctx context.Context, destination M.Socksaddr
 			if attempt < maxAttempts {
 				p.logger.Warn("listen-packet via ", member.tag, " failed (attempt ", attempt, "/", maxAttempts, "), retrying: ", listenErr)
 				if ctx.Err() != nil {
-					return nil, ctx.Err()
+					return nil, nil, proxyerr.New(ctx.Err(), attempted, "")
 				}
 				continue
 			}
@@ -355,12 +626,16 @@ func (p *poolOutbound) ListenPacket(ctx context.Context, destination M.Socksaddr
 			p.logger.Info("listen-packet succeeded via ", member.tag, " after ", attempt, " attempts")
 		}
 		p.recordSuccess(member)
-		return p.wrapPacketConn(conn, member), nil
+		return p.wrapPacketConn(conn, member), member, nil
 	}
 	if lastErr == nil {
-		lastErr = E.New("no healthy proxy available")
+		return nil, nil, proxyerr.New(E.New("no healthy proxy available"), attempted, proxyerr.ClassNoNode)
+	}
+	class := proxyerr.Classify(lastErr)
+	if errors.Is(lastErr, errNodeBusy) {
+		class = proxyerr.ClassNodeBusy
 	}
-	return nil, fmt.Errorf("listen-packet failed after %d attempts: %w", maxAttempts, lastErr)
+	return nil, nil, proxyerr.New(fmt.Errorf("listen-packet failed after %d attempts: %w", maxAttempts, lastErr), attempted, class)
 }
 
 // maxAttempts returns the configured retry budget (>=1).
@@ -377,8 +652,45 @@ func (p *poolOutbound) maxAttempts() int {
 // pickMemberFiltered selects a healthy member, optionally excluding tags in `tried`.
 // When `tried` is nil or every healthy member has been tried, falls back to picking
 // any healthy member (ensuring single-member pools retry the same node).
-func (p *poolOutbound) pickMemberFiltered(network string, tried map[string]bool, stickyKey string) (*memberState, error) {
-	now := time.Now()
+// A non-zero pin restricts the choice to the pinned node or group, and
+// non-empty groups (the user's credential tier) to the nodes of those groups.
+func (p *poolOutbound) pickMemberFiltered(network string, tried map[string]bool, stickyKey string, pin users.Pin, groups []string) (*memberState, error) {
+	candidates, stickyKey, err := p.eligibleMembers(network, stickyKey, pin, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out members already tried in this request.
+	if len(tried) > 0 {
+		filtered := candidates[:0]
+		for _, m := range candidates {
+			if !tried[m.tag] {
+				filtered = append(filtered, m)
+			}
+		}
+		// If filtering left nothing, fall back to all candidates so we still
+		// dial something (matches per-node single-member retry semantics).
+		if len(filtered) > 0 {
+			candidates = filtered
+		}
+	}
+
+	var member *memberState
+	if mode, ok := p.options.GroupModes[strings.ToLower(pin.Group)]; ok && pin.Node == "" {
+		member = p.selectWithMode(mode, candidates)
+	} else {
+		member = p.selectMember(candidates, stickyKey)
+	}
+	p.putCandidateBuffer(candidates)
+	return member, nil
+}
+
+// eligibleMembers returns the members a connection over network pinned to
+// pin and limited to groups may use, in a buffer from getCandidateBuffer,
+// and the sticky key that still applies. The list is never empty when err
+// is nil.
+func (p *poolOutbound) eligibleMembers(network string, stickyKey string, pin users.Pin, groups []string) ([]*memberState, string, error) {
+	now := clock.Now()
 	candidates := p.getCandidateBuffer()
 
 	p.mu.Lock()
@@ -386,7 +698,7 @@ func (p *poolOutbound) pickMemberFiltered(network string, tried map[string]bool,
 		if err := p.initializeMembersLocked(); err != nil {
 			p.mu.Unlock()
 			p.putCandidateBuffer(candidates)
-			return nil, err
+			return nil, "", err
 		}
 	}
 	candidates = p.availableMembersLocked(now, network, candidates)
@@ -402,31 +714,47 @@ func (p *poolOutbound) pickMemberFiltered(network string, tried map[string]bool,
 
 	if len(candidates) == 0 {
 		p.putCandidateBuffer(candidates)
-		return nil, E.New("no healthy proxy available")
+		return nil, "", p.noMemberError(network)
 	}
 
-	// Filter out members already tried in this request.
-	if len(tried) > 0 {
-		filtered := candidates[:0]
+	if len(groups) > 0 {
+		allowed := candidates[:0]
 		for _, m := range candidates {
-			if !tried[m.tag] {
-				filtered = append(filtered, m)
+			if p.inGroups(m, groups) {
+				allowed = append(allowed, m)
 			}
 		}
-		// If filtering left nothing, fall back to all candidates so we still
-		// dial something (matches per-node single-member retry semantics).
-		if len(filtered) > 0 {
-			candidates = filtered
+		if len(allowed) == 0 {
+			p.putCandidateBuffer(candidates)
+			return nil, "", E.New("no healthy proxy in groups ", strings.Join(groups, ", "))
 		}
+		candidates = allowed
 	}
 
-	member := p.selectMember(candidates, stickyKey)
-	p.putCandidateBuffer(candidates)
-	return member, nil
+	if !pin.IsZero() {
+		pinned := candidates[:0]
+		for _, m := range candidates {
+			if p.matchesPin(m, pin) {
+				pinned = append(pinned, m)
+			}
+		}
+		if len(pinned) == 0 {
+			p.putCandidateBuffer(candidates)
+			return nil, "", E.New("no healthy proxy matches ", pin.String())
+		}
+		// A pin overrides stickiness: the client chose the exit itself.
+		candidates, stickyKey = pinned, ""
+	}
+
+	if candidates = withoutFullMembers(candidates); len(candidates) == 0 {
+		p.putCandidateBuffer(candidates)
+		return nil, "", errNodeBusy
+	}
+	return candidates, stickyKey, nil
 }
 
 func (p *poolOutbound) pickMember(network string) (*memberState, error) {
-	now := time.Now()
+	now := clock.Now()
 	candidates := p.getCandidateBuffer()
 
 	p.mu.Lock()
@@ -450,7 +778,7 @@ func (p *poolOutbound) pickMember(network string) (*memberState, error) {
 
 	if len(candidates) == 0 {
 		p.putCandidateBuffer(candidates)
-		return nil, E.New("no healthy proxy available")
+		return nil, p.noMemberError(network)
 	}
 
 	member := p.selectMember(candidates, "")
@@ -460,24 +788,94 @@ func (p *poolOutbound) pickMember(network string) (*memberState, error) {
 
 func (p *poolOutbound) availableMembersLocked(now time.Time, network string, buf []*memberState) []*memberState {
 	result := buf[:0]
-	for _, member := range p.members {
-		// Check blacklist via shared state (auto-clears if expired)
-		if member.shared != nil && member.shared.isBlacklisted(now) {
-			// Log blacklisted nodes for debugging
-			remaining := member.shared.blacklistRemaining(now)
-			if remaining > 0 {
-				p.logger.Debug("skipping blacklisted node: ", member.tag, ", remaining: ", remaining.Round(time.Second))
+	unhealthy, standby := 0, 0
+	collect := func(standbyPass bool) {
+		for _, member := range p.members {
+			// A promoted standby member counts as a regular one.
+			isStandby := member.standby && !now.Before(member.promotedUntil)
+			if isStandby != standbyPass {
+				if isStandby {
+					standby++
+				}
+				continue
 			}
-			continue
+			// Check blacklist via shared state (auto-clears if expired)
+			if member.shared != nil && member.shared.isBlacklisted(now) {
+				// Log blacklisted nodes for debugging
+				remaining := member.shared.blacklistRemaining(now)
+				if remaining > 0 {
+					p.logger.Debug("skipping blacklisted node: ", member.tag, ", remaining: ", remaining.Round(time.Second))
+				}
+				continue
+			}
+			if network != "" && !common.Contains(member.outbound.Network(), network) {
+				continue
+			}
+			if member.shared != nil && member.shared.trialPending() {
+				continue
+			}
+			if member.shared != nil && member.shared.isUnhealthy() {
+				unhealthy++
+				continue
+			}
+			result = append(result, member)
 		}
-		if network != "" && !common.Contains(member.outbound.Network(), network) {
-			continue
+	}
+	collect(false)
+	if standby > 0 {
+		// Standby members step in while too few regular members are usable.
+		inUse := len(result) < max(p.options.StandbyThreshold, 1)
+		if inUse {
+			collect(true)
+		}
+		p.noteStandby(inUse)
+	}
+	if len(result) == 0 && unhealthy > 0 {
+		// Every usable member failed its recent probes. Probes can be wrong
+		// (e.g. the probe target itself is down), so degrade to trying them
+		// rather than refusing all traffic.
+		for _, member := range p.members {
+			if member.shared == nil || !member.shared.isUnhealthy() || member.shared.isBlacklisted(now) {
+				continue
+			}
+			if network != "" && !common.Contains(member.outbound.Network(), network) {
+				continue
+			}
+			result = append(result, member)
 		}
-		result = append(result, member)
 	}
 	return result
 }
 
+// noteStandby logs when standby members enter or leave the rotation.
+func (p *poolOutbound) noteStandby(inUse bool) {
+	if p.standbyInUse.Swap(inUse) == inUse {
+		return
+	}
+	if inUse {
+		p.logger.Warn("too few regular nodes available, standby nodes joined the rotation")
+	} else {
+		p.logger.Info("regular nodes recovered, standby nodes left the rotation")
+	}
+}
+
+// noMemberError explains an empty candidate list. UDP relaying (SOCKS5 UDP
+// ASSOCIATE through the mixed inbounds) needs a member whose protocol carries
+// UDP, e.g. socks5 or shadowsocks; a pool of HTTP proxies never has one.
+func (p *poolOutbound) noMemberError(network string) error {
+	if network == N.NetworkUDP {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, member := range p.members {
+			if common.Contains(member.outbound.Network(), network) {
+				return E.New("no healthy proxy available")
+			}
+		}
+		return E.New("no proxy in pool supports UDP")
+	}
+	return E.New("no healthy proxy available")
+}
+
 func (p *poolOutbound) releaseIfAllBlacklistedLocked(now time.Time) bool {
 	if len(p.members) == 0 {
 		return false
@@ -500,9 +898,56 @@ func (p *poolOutbound) releaseIfAllBlacklistedLocked(now time.Time) bool {
 
 const stickyFallbackKey = "_global_"
 
+// userFromCtx returns the authenticated client user: the sing-box inbound's
+// auth user (without a pinning suffix), or the one tagged by listeners that
+// dial the pool directly.
+func userFromCtx(ctx context.Context) string {
+	if md := adapter.ContextFrom(ctx); md != nil && md.User != "" {
+		name, _ := users.SplitPinned(md.User)
+		return name
+	}
+	return users.FromContext(ctx)
+}
+
+// pinFromCtx returns the node or group the request is pinned to: set by
+// listeners that dial the pool directly, or encoded in the auth username.
+func pinFromCtx(ctx context.Context) users.Pin {
+	if pin := users.PinFromContext(ctx); !pin.IsZero() {
+		return pin
+	}
+	if md := adapter.ContextFrom(ctx); md != nil && md.User != "" {
+		_, pin := users.SplitPinned(md.User)
+		return pin
+	}
+	return users.Pin{}
+}
+
+// matchesPin reports whether member is the pinned node (by tag or name) or
+// belongs to the pinned group.
+func (p *poolOutbound) matchesPin(member *memberState, pin users.Pin) bool {
+	meta := p.options.Metadata[member.tag]
+	if pin.Node != "" {
+		return member.tag == pin.Node || meta.Name == pin.Node
+	}
+	return strings.EqualFold(meta.Group, pin.Group)
+}
+
+// inGroups reports whether member belongs to one of groups.
+func (p *poolOutbound) inGroups(member *memberState, groups []string) bool {
+	group := p.options.Metadata[member.tag].Group
+	for _, g := range groups {
+		if strings.EqualFold(group, g) {
+			return true
+		}
+	}
+	return false
+}
+
 // stickyKeyFromCtx returns the sticky key (client source IP) for this request,
-// or "" when stickiness is disabled. Falls back to a shared global key when the
-// source address cannot be determined, so such requests still pin together.
+// or "" when stickiness is disabled. Listeners that dial the pool directly
+// pass the client with accesslog.WithClient. Falls back to a shared global key
+// when the source address cannot be determined, so such requests still pin
+// together.
 func (p *poolOutbound) stickyKeyFromCtx(ctx context.Context) string {
 	if !p.sticky {
 		return ""
@@ -510,6 +955,12 @@ func (p *poolOutbound) stickyKeyFromCtx(ctx context.Context) string {
 	if md := adapter.ContextFrom(ctx); md != nil && md.Source.IsValid() {
 		return md.Source.AddrString()
 	}
+	if client := accesslog.ClientFromContext(ctx); client != "" {
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			return host
+		}
+		return client
+	}
 	return stickyFallbackKey
 }
 
@@ -546,8 +997,23 @@ func (p *poolOutbound) selectSticky(candidates []*memberState, stickyKey string)
 
 // selectByMode applies the configured scheduling strategy.
 func (p *poolOutbound) selectByMode(candidates []*memberState) *memberState {
-	switch p.mode {
+	return p.selectWithMode(p.mode, candidates)
+}
+
+// selectWithMode applies the scheduling strategy mode.
+func (p *poolOutbound) selectWithMode(mode string, candidates []*memberState) *memberState {
+	return p.chooseWithMode(mode, candidates, false)
+}
+
+// chooseWithMode implements selectWithMode. With peek set it only tells the
+// member the next pick would return and leaves the round-robin position and
+// weights alone; it returns nil in random mode.
+func (p *poolOutbound) chooseWithMode(mode string, candidates []*memberState, peek bool) *memberState {
+	switch mode {
 	case modeRandom:
+		if peek {
+			return nil
+		}
 		p.rngMu.Lock()
 		idx := p.rng.Intn(len(candidates))
 		p.rngMu.Unlock()
@@ -591,12 +1057,84 @@ func (p *poolOutbound) selectByMode(candidates []*memberState) *memberState {
 			return selected
 		}
 		// Fallback: no measurements yet — round-robin.
-		idx := int(p.rrCounter.Add(1)-1) % len(candidates)
-		return candidates[idx]
+		return candidates[p.nextIndex(len(candidates), peek)]
+	case modeWeighted:
+		return p.selectWeighted(candidates, peek)
+	case modeBandwidth:
+		// Pick the candidate with the highest speed test throughput, with
+		// the same round-robin fallback as latency mode until one is measured.
+		var selected *memberState
+		var maxBandwidth float64
+		for _, member := range candidates {
+			if bandwidth := member.entry.LastBandwidth(); bandwidth > maxBandwidth {
+				selected = member
+				maxBandwidth = bandwidth
+			}
+		}
+		if selected != nil {
+			return selected
+		}
+		return candidates[p.nextIndex(len(candidates), peek)]
+	case modeCost:
+		// Pick the cheapest candidate per GB; members without a cost are
+		// flat-rate and cost nothing extra. Ties go to the least busy one,
+		// so free members share the load as in balance mode.
+		var selected *memberState
+		var minActive int32
+		for _, member := range candidates {
+			var active int32
+			if member.shared != nil {
+				active = member.shared.activeCount()
+			}
+			if selected == nil || member.costPerGB < selected.costPerGB ||
+				(member.costPerGB == selected.costPerGB && active < minActive) {
+				selected = member
+				minActive = active
+			}
+		}
+		return selected
 	default:
-		idx := int(p.rrCounter.Add(1)-1) % len(candidates)
-		return candidates[idx]
+		return candidates[p.nextIndex(len(candidates), peek)]
+	}
+}
+
+// nextIndex advances the round-robin position over n candidates, or only
+// reads it when peek is set.
+func (p *poolOutbound) nextIndex(n int, peek bool) int {
+	if peek {
+		return int(p.rrCounter.Load()) % n
+	}
+	return int(p.rrCounter.Add(1)-1) % n
+}
+
+// selectWeighted implements smooth weighted round-robin (as in nginx): every
+// pick raises each candidate's current weight by its weight, takes the
+// highest, then lowers the winner by the total. Over a cycle each member is
+// chosen in proportion to its weight, interleaved rather than in bursts, and
+// unavailable members simply drop out of the rotation. With peek set the
+// current weights are left unchanged.
+func (p *poolOutbound) selectWeighted(candidates []*memberState, peek bool) *memberState {
+	p.wrrMu.Lock()
+	defer p.wrrMu.Unlock()
+	var selected *memberState
+	selectedWeight, total := 0, 0
+	for _, member := range candidates {
+		weight := member.weight
+		if weight < 1 {
+			weight = 1
+		}
+		total += weight
+		if current := member.currentWeight + weight; selected == nil || current > selectedWeight {
+			selected, selectedWeight = member, current
+		}
+		if !peek {
+			member.currentWeight += weight
+		}
+	}
+	if !peek {
+		selected.currentWeight -= total
 	}
+	return selected
 }
 
 func (p *poolOutbound) recordFailure(member *memberState, cause error) {
@@ -604,39 +1142,95 @@ func (p *poolOutbound) recordFailure(member *memberState, cause error) {
 		p.logger.Warn("proxy ", member.tag, " failure (no shared state): ", cause)
 		return
 	}
-	failures, blacklisted, until := member.shared.recordFailure(cause, p.options.FailureThreshold, p.options.BlacklistDuration)
+	threshold, duration := p.failurePolicy(member.tag)
+	if cb := p.options.CircuitBreaker; cb.Enabled {
+		failures, opened, until := member.shared.recordBreakerFailure(cause, threshold, cb.HalfOpenInterval, cb.MaxHalfOpenInterval)
+		if opened {
+			wait := until.Sub(clock.Now()).Round(time.Second)
+			p.logger.Warn("proxy ", member.tag, " circuit open, trial in ", wait, ": ", cause)
+			log.Printf("⚠️  [pool] %s circuit OPEN, next trial in %s (at %s): %v", member.tag, wait, clock.Wall(until).Format("15:04:05"), cause)
+		} else {
+			p.logger.Warn("proxy ", member.tag, " failure ", failures, "/", threshold, ": ", cause)
+			log.Printf("[pool] %s failure %d/%d: %v", member.tag, failures, threshold, cause)
+		}
+		return
+	}
+	failures, blacklisted, until := member.shared.recordFailure(cause, threshold, duration)
 	if blacklisted {
-		p.logger.Warn("proxy ", member.tag, " blacklisted for ", p.options.BlacklistDuration, ": ", cause)
-		log.Printf("⚠️  [pool] %s BLACKLISTED for %s (until %s): %v", member.tag, p.options.BlacklistDuration, until.Format("15:04:05"), cause)
+		p.logger.Warn("proxy ", member.tag, " blacklisted for ", duration, ": ", cause)
+		log.Printf("⚠️  [pool] %s BLACKLISTED for %s (until %s): %v", member.tag, duration, clock.Wall(until).Format("15:04:05"), cause)
 		log.Printf("    To release immediately, use WebUI or: POST /api/nodes/%s/release", member.tag)
 	} else {
-		p.logger.Warn("proxy ", member.tag, " failure ", failures, "/", p.options.FailureThreshold, ": ", cause)
-		log.Printf("[pool] %s failure %d/%d: %v", member.tag, failures, p.options.FailureThreshold, cause)
+		p.logger.Warn("proxy ", member.tag, " failure ", failures, "/", threshold, ": ", cause)
+		log.Printf("[pool] %s failure %d/%d: %v", member.tag, failures, threshold, cause)
 	}
 }
 
+// failurePolicy returns the failure threshold and blacklist duration of tag.
+func (p *poolOutbound) failurePolicy(tag string) (int, time.Duration) {
+	threshold, duration := p.options.FailureThreshold, p.options.BlacklistDuration
+	meta := p.options.Metadata[tag]
+	if meta.FailureThreshold > 0 {
+		threshold = meta.FailureThreshold
+	}
+	if meta.BlacklistDuration > 0 {
+		duration = meta.BlacklistDuration
+	}
+	return threshold, duration
+}
+
 func (p *poolOutbound) recordSuccess(member *memberState) {
-	if member.shared != nil {
-		member.shared.recordSuccess()
+	if member.shared != nil && member.shared.recordSuccess() {
+		p.logger.Info("proxy ", member.tag, " trial succeeded, circuit closed")
+		log.Printf("✅ [pool] %s trial succeeded, circuit CLOSED", member.tag)
 	}
 }
 
+// openConns counts connections handed out by every pool outbound, so
+// shutdown can wait for in-flight tunnels to finish.
+var openConns atomic.Int64
+
+// OpenConnections returns the number of pool connections not yet closed.
+func OpenConnections() int64 {
+	return openConns.Load()
+}
+
 func (p *poolOutbound) wrapConn(conn net.Conn, member *memberState) net.Conn {
+	p.trackOpen()
+	if p.idle != nil {
+		conn = p.idle.track(conn, member)
+	}
 	return &trackedConn{Conn: conn, release: func() {
 		p.decActive(member)
+		p.trackClose()
 	}}
 }
 
 func (p *poolOutbound) wrapPacketConn(conn net.PacketConn, member *memberState) net.PacketConn {
+	p.trackOpen()
 	return &trackedPacketConn{PacketConn: conn, release: func() {
 		p.decActive(member)
+		p.trackClose()
 	}}
 }
 
+func (p *poolOutbound) trackOpen() {
+	openConns.Add(1)
+	p.open.Add(1)
+	p.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (p *poolOutbound) trackClose() {
+	openConns.Add(-1)
+	p.open.Add(-1)
+	p.lastUsed.Store(time.Now().UnixNano())
+}
+
 func (p *poolOutbound) makeReleaseFunc(member *memberState) func() {
 	return func() {
 		if member.shared != nil {
 			member.shared.forceRelease()
+			member.shared.resetHealth()
 		}
 	}
 }
@@ -704,46 +1298,7 @@ func (p *poolOutbound) makeProbeFunc(member *memberState) func(ctx context.Conte
 		return nil
 	}
 	return func(ctx context.Context) (time.Duration, error) {
-		start := time.Now()
-		conn, err := member.outbound.DialContext(ctx, N.NetworkTCP, destination)
-		if err != nil {
-			if member.entry != nil {
-				member.entry.RecordFailure(err)
-			}
-			return 0, err
-		}
-		defer conn.Close()
-
-		// Strict mode: upgrade to TLS and verify the certificate chain so that
-		// nodes whose exit hijacks TLS (self-signed certs) fail the probe.
-		if conn, err = upgradeProbeConn(ctx, conn, host, useTLS); err != nil {
-			if member.entry != nil {
-				member.entry.RecordFailure(err)
-			}
-			return 0, err
-		}
-
-		// Perform HTTP probe to measure actual latency (TTFB)
-		_, err = httpProbe(conn, destination.AddrString())
-		if err != nil {
-			if member.entry != nil {
-				member.entry.RecordFailure(err)
-			}
-			return 0, err
-		}
-
-		// Total duration = dial time + HTTP probe
-		duration := time.Since(start)
-		if member.entry != nil {
-			member.entry.RecordSuccessWithLatency(duration)
-		}
-		// Clear pool blacklist on successful probe — a node that passes
-		// health check should be available for selection immediately,
-		// not remain blacklisted for the full duration (fixes #8, #9).
-		if member.shared != nil {
-			member.shared.forceRelease()
-		}
-		return duration, nil
+		return p.probeMember(ctx, member, destination, host, useTLS)
 	}
 }
 
@@ -779,45 +1334,109 @@ func (p *poolOutbound) makeProbeByTagFunc(tag string) func(ctx context.Context)
 		if member == nil {
 			return 0, E.New("member not found: ", tag)
 		}
+		return p.probeMember(ctx, member, destination, host, useTLS)
+	}
+}
 
-		start := time.Now()
-		conn, err := member.outbound.DialContext(ctx, N.NetworkTCP, destination)
-		if err != nil {
-			if member.entry != nil {
-				member.entry.RecordFailure(err)
-			}
-			return 0, err
+// probeMember runs one active health check against member using the
+// configured probe type and feeds the result into the shared health state.
+func (p *poolOutbound) probeMember(ctx context.Context, member *memberState, destination M.Socksaddr, host string, useTLS bool) (time.Duration, error) {
+	start := time.Now()
+	err := p.runProbe(ctx, member, destination, host, useTLS)
+	if err != nil {
+		if member.entry != nil {
+			member.entry.RecordFailure(err)
+		}
+		if member.shared != nil && member.shared.recordProbe(false, p.options.HealthCheck.HealthyThreshold, p.options.HealthCheck.UnhealthyThreshold) {
+			log.Printf("⚠️  [pool] %s failed %d consecutive health checks, removed from rotation: %v", member.tag, p.options.HealthCheck.UnhealthyThreshold, err)
 		}
-		defer conn.Close()
+		return 0, err
+	}
 
-		// Strict mode: upgrade to TLS and verify the certificate chain so that
-		// nodes whose exit hijacks TLS (self-signed certs) fail the probe.
-		if conn, err = upgradeProbeConn(ctx, conn, host, useTLS); err != nil {
-			if member.entry != nil {
-				member.entry.RecordFailure(err)
-			}
-			return 0, err
+	// Total duration = dial time (+ TLS handshake / TTFB, depending on type)
+	duration := time.Since(start)
+	if member.entry != nil {
+		member.entry.RecordSuccessWithLatency(duration)
+	}
+	if member.shared != nil {
+		if member.shared.recordProbe(true, p.options.HealthCheck.HealthyThreshold, p.options.HealthCheck.UnhealthyThreshold) {
+			log.Printf("✅ [pool] %s passed health checks again, back in rotation", member.tag)
 		}
+		// Clear pool blacklist on successful probe — a node that passes
+		// health check should be available for selection immediately,
+		// not remain blacklisted for the full duration (fixes #8, #9).
+		member.shared.forceRelease()
+	}
+	return duration, nil
+}
 
-		// Perform HTTP probe to measure actual latency (TTFB)
-		_, err = httpProbe(conn, destination.AddrString())
-		if err != nil {
-			if member.entry != nil {
-				member.entry.RecordFailure(err)
+func (p *poolOutbound) runProbe(ctx context.Context, member *memberState, destination M.Socksaddr, host string, useTLS bool) error {
+	if p.options.HealthCheck.Type == healthCheckTLS && !useTLS {
+		// The tls probe always verifies a handshake, even when the probe
+		// target is configured as plain http.
+		useTLS = true
+		destination = M.ParseSocksaddrHostPort(host, 443)
+	}
+
+	if err := chaos.Dial(ctx, member.tag); err != nil {
+		return err
+	}
+	conn, err := member.outbound.DialContext(ctx, N.NetworkTCP, destination)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if p.options.HealthCheck.Type == healthCheckTCP {
+		return nil
+	}
+
+	// Strict mode: upgrade to TLS and verify the certificate chain so that
+	// nodes whose exit hijacks TLS (self-signed certs) fail the probe.
+	if conn, err = upgradeProbeConn(ctx, conn, host, useTLS); err != nil {
+		return err
+	}
+	if p.options.HealthCheck.Type == healthCheckTLS {
+		return nil
+	}
+
+	// Perform HTTP probe to measure actual latency (TTFB)
+	_, err = httpProbe(conn, destination.AddrString())
+	return err
+}
+
+// makeDialByTagFunc returns a dialer that always uses the member tag, for
+// per-node checks from the management API. It works before member
+// initialization like makeProbeByTagFunc.
+func (p *poolOutbound) makeDialByTagFunc(tag string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		p.mu.Lock()
+		if len(p.members) == 0 {
+			if err := p.initializeMembersLocked(); err != nil {
+				p.mu.Unlock()
+				return nil, err
+			}
+		}
+		var member *memberState
+		for _, m := range p.members {
+			if m.tag == tag {
+				member = m
+				break
 			}
-			return 0, err
 		}
+		p.mu.Unlock()
 
-		// Total duration = dial time + TTFB
-		duration := time.Since(start)
-		if member.entry != nil {
-			member.entry.RecordSuccessWithLatency(duration)
+		if member == nil {
+			return nil, E.New("member not found: ", tag)
 		}
-		// Clear pool blacklist on successful probe (fixes #8, #9)
-		if member.shared != nil {
-			member.shared.forceRelease()
+		if err := chaos.Dial(ctx, tag); err != nil {
+			return nil, err
+		}
+		conn, err := member.outbound.DialContext(ctx, N.NetworkName(network), M.ParseSocksaddr(address))
+		if err != nil {
+			return nil, err
 		}
-		return duration, nil
+		return chaos.WrapConn(conn, tag), nil
 	}
 }
 
@@ -835,6 +1454,13 @@ func (p *poolOutbound) makeBlacklistByTagFunc(tag string) func(time.Duration) {
 	}
 }
 
+// makeHealthByTagFunc creates the function applying a cluster peer's health verdict
+func (p *poolOutbound) makeHealthByTagFunc(tag string) func(bool) {
+	return func(unhealthy bool) {
+		setSharedMemberHealth(tag, unhealthy)
+	}
+}
+
 type trackedConn struct {
 	net.Conn
 	once    sync.Once
@@ -859,12 +1485,6 @@ func (c *trackedPacketConn) Close() error {
 	return err
 }
 
-func (p *poolOutbound) incActive(member *memberState) {
-	if member.shared != nil {
-		member.shared.incActive()
-	}
-}
-
 func (p *poolOutbound) decActive(member *memberState) {
 	if member.shared != nil {
 		member.shared.decActive()
@@ -0,0 +1,83 @@
+package pool
+
+import (
+	"fmt"
+	"strings"
+
+	"easy_proxies/internal/users"
+)
+
+// Prediction is the member a pool outbound would pick for the next
+// connection, as far as it can be told without opening one.
+type Prediction struct {
+	// Member is the tag of the member that would be picked, or "" when the
+	// pool picks at random.
+	Member string
+	// Candidates are the tags of the members the connection may use.
+	Candidates []string
+}
+
+// Predict tells which member of the pool outbound tag a connection over
+// network from client (an IP address, used by sticky pools) authenticated
+// as user and pinned to pin would go through. Connections opened in the meantime may change the
+// outcome of round-robin, weighted and load-based modes.
+func Predict(tag, network, client, user string, pin users.Pin) (Prediction, error) {
+	v, ok := dialerRegistry.Load(tag)
+	if !ok {
+		return Prediction{}, fmt.Errorf("pool %s is not running", tag)
+	}
+	p := v.(*poolDialerAdapter).pool
+	stickyKey := ""
+	if p.sticky {
+		stickyKey = client
+		if stickyKey == "" {
+			stickyKey = stickyFallbackKey
+		}
+	}
+	return p.predict(network, stickyKey, pin, users.Groups(user))
+}
+
+// predict mirrors pickMemberFiltered for the first attempt of a connection
+// but leaves the scheduling state (round-robin position, weights and sticky
+// pins) untouched.
+func (p *poolOutbound) predict(network, stickyKey string, pin users.Pin, groups []string) (Prediction, error) {
+	candidates, stickyKey, err := p.eligibleMembers(network, stickyKey, pin, groups)
+	if err != nil {
+		return Prediction{}, err
+	}
+	defer p.putCandidateBuffer(candidates)
+
+	prediction := Prediction{Candidates: make([]string, 0, len(candidates))}
+	for _, member := range candidates {
+		prediction.Candidates = append(prediction.Candidates, member.tag)
+	}
+
+	var member *memberState
+	if mode, ok := p.options.GroupModes[strings.ToLower(pin.Group)]; ok && pin.Node == "" {
+		member = p.chooseWithMode(mode, candidates, true)
+	} else if stickyKey != "" {
+		member = p.peekSticky(candidates, stickyKey)
+	} else {
+		member = p.chooseWithMode(p.mode, candidates, true)
+	}
+	if member != nil {
+		prediction.Member = member.tag
+	}
+	return prediction, nil
+}
+
+// peekSticky returns the member selectSticky would return without pinning
+// a new one.
+func (p *poolOutbound) peekSticky(candidates []*memberState, stickyKey string) *memberState {
+	p.stickyMu.Lock()
+	tag, ok := p.stickyMap[stickyKey]
+	p.stickyMu.Unlock()
+	if ok {
+		for _, member := range candidates {
+			if member.tag == tag {
+				return member
+			}
+		}
+	}
+	return p.chooseWithMode(p.mode, candidates, true)
+}
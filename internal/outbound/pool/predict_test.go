@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"testing"
+
+	"easy_proxies/internal/users"
+
+	N "github.com/sagernet/sing/common/network"
+)
+
+func TestPredictMatchesNextPick(t *testing.T) {
+	tcp := networkOutbound{networks: []string{N.NetworkTCP}}
+	for _, mode := range []string{modeSequential, modeWeighted} {
+		p := &poolOutbound{
+			mode: mode,
+			members: []*memberState{
+				{tag: "a", outbound: tcp, weight: 3},
+				{tag: "b", outbound: tcp, weight: 1},
+				{tag: "c", outbound: tcp},
+			},
+		}
+		for i := 0; i < 10; i++ {
+			predicted, err := p.predict(N.NetworkTCP, "", users.Pin{}, nil)
+			if err != nil || len(predicted.Candidates) != 3 {
+				t.Fatalf("%s: predict = %+v, %v", mode, predicted, err)
+			}
+			if again, _ := p.predict(N.NetworkTCP, "", users.Pin{}, nil); again.Member != predicted.Member {
+				t.Fatalf("%s: predicting changed the outcome: %s, then %s", mode, predicted.Member, again.Member)
+			}
+			member, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{}, nil)
+			if err != nil || member.tag != predicted.Member {
+				t.Fatalf("%s: predicted %s, picked %v (%v)", mode, predicted.Member, member, err)
+			}
+		}
+	}
+}
+
+func TestPredictStickyAndRandom(t *testing.T) {
+	tcp := networkOutbound{networks: []string{N.NetworkTCP}}
+	p := &poolOutbound{
+		mode:      modeRandom,
+		rng:       newRand(1),
+		sticky:    true,
+		stickyMap: map[string]string{"10.0.0.1": "b"},
+		members:   []*memberState{{tag: "a", outbound: tcp}, {tag: "b", outbound: tcp}},
+	}
+	if got, err := p.predict(N.NetworkTCP, "10.0.0.1", users.Pin{}, nil); err != nil || got.Member != "b" {
+		t.Fatalf("pinned client: %+v, %v", got, err)
+	}
+	if got, err := p.predict(N.NetworkTCP, "10.0.0.2", users.Pin{}, nil); err != nil || got.Member != "" || len(got.Candidates) != 2 {
+		t.Fatalf("random pick should be unknown: %+v, %v", got, err)
+	}
+	if _, pinned := p.stickyMap["10.0.0.2"]; pinned {
+		t.Fatal("predict must not pin new clients")
+	}
+}
@@ -0,0 +1,23 @@
+package pool
+
+import "testing"
+
+func TestSeededRandomModeRepeats(t *testing.T) {
+	candidates := []*memberState{{tag: "a"}, {tag: "b"}, {tag: "c"}, {tag: "d"}}
+	run := func(seed int64) string {
+		p := &poolOutbound{mode: modeRandom, rng: newRand(seed)}
+		var got string
+		for i := 0; i < 20; i++ {
+			got += p.selectByMode(candidates).tag
+		}
+		return got
+	}
+
+	first := run(42)
+	if again := run(42); again != first {
+		t.Fatalf("same seed picked %s, then %s", first, again)
+	}
+	if other := run(7); other == first {
+		t.Fatalf("different seeds picked the same sequence %s", first)
+	}
+}
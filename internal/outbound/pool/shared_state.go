@@ -5,6 +5,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"easy_proxies/internal/clock"
 	"easy_proxies/internal/monitor"
 )
 
@@ -17,6 +18,23 @@ type sharedMemberState struct {
 	blacklistedUntil time.Time
 	entry            atomic.Pointer[monitor.EntryHandle]
 	active           atomic.Int32
+	// Active health-check state, driven only by probes (not client traffic).
+	probeFailures  int
+	probeSuccesses int
+	unhealthy      atomic.Bool
+	// Circuit breaker state. An open circuit is a blacklist that lasts
+	// openInterval; once it expires the member is half-open and its next
+	// request is a trial.
+	openInterval time.Duration
+	halfOpen     bool
+	trial        bool // a half-open trial request is in flight
+	// Connect times of recent dials, for group SLOs. connects[connectHead:]
+	// are within the window; slowConnects of them took longer than
+	// connectTarget.
+	connects      []connectSample
+	connectHead   int
+	connectTarget time.Duration
+	slowConnects  int
 }
 
 var sharedStateStore sync.Map // map[tag]*sharedMemberState
@@ -49,11 +67,32 @@ func ResetSharedStateStore() {
 	ResetDialerRegistry()
 }
 
+// RetainSharedState drops shared state for every tag not in keep, so nodes
+// that survive a reload keep their failure, blacklist and health history.
+func RetainSharedState(keep map[string]bool) {
+	sharedStateStore.Range(func(key, _ any) bool {
+		if !keep[key.(string)] {
+			sharedStateStore.Delete(key)
+		}
+		return true
+	})
+	ResetDialerRegistry()
+}
+
+// DropSharedState forgets the shared state of tags, for nodes removed from
+// a running instance.
+func DropSharedState(tags []string) {
+	for _, tag := range tags {
+		sharedStateStore.Delete(tag)
+	}
+}
+
 func (s *sharedMemberState) attachEntry(entry *monitor.EntryHandle) {
 	if entry == nil {
 		return
 	}
 	s.entry.Store(entry)
+	entry.MarkUnhealthy(s.isUnhealthy())
 }
 
 func (s *sharedMemberState) entryHandle() *monitor.EntryHandle {
@@ -70,7 +109,7 @@ func (s *sharedMemberState) recordFailure(cause error, threshold int, duration t
 	var until time.Time
 	if s.failures >= threshold {
 		triggered = true
-		until = time.Now().Add(duration)
+		until = clock.Now().Add(duration)
 		s.failures = 0
 		s.blacklisted = true
 		s.blacklistedUntil = until
@@ -86,14 +125,86 @@ func (s *sharedMemberState) recordFailure(cause error, threshold int, duration t
 	return count, triggered, until
 }
 
-func (s *sharedMemberState) recordSuccess() {
+// recordBreakerFailure is recordFailure under a circuit breaker: the
+// circuit opens for interval after threshold failures, and a failed trial
+// reopens it at once for twice the previous interval, up to maxInterval.
+// Returns: (current failures, opened, open until time)
+func (s *sharedMemberState) recordBreakerFailure(cause error, threshold int, interval, maxInterval time.Duration) (int, bool, time.Time) {
+	s.mu.Lock()
+	s.failures++
+	count := s.failures
+	opened := false
+	var until time.Time
+	if s.halfOpen {
+		opened = true
+		s.openInterval = min(max(s.openInterval*2, interval), maxInterval)
+	} else if s.failures >= threshold {
+		opened = true
+		s.openInterval = interval
+	}
+	s.halfOpen = false
+	s.trial = false
+	if opened {
+		until = clock.Now().Add(s.openInterval)
+		s.failures = 0
+		s.blacklisted = true
+		s.blacklistedUntil = until
+	}
+	s.mu.Unlock()
+
+	if entry := s.entry.Load(); entry != nil {
+		entry.RecordFailure(cause)
+		if opened {
+			entry.Blacklist(until)
+		}
+	}
+	return count, opened, until
+}
+
+// beginTrial claims the trial request of a half-open member. It returns
+// false when another request already holds it; members that are not
+// half-open always admit.
+func (s *sharedMemberState) beginTrial() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.halfOpen {
+		return true
+	}
+	if s.trial {
+		return false
+	}
+	s.trial = true
+	return true
+}
+
+// trialPending reports whether the member is half-open with its trial
+// request in flight, so no other request may use it yet.
+func (s *sharedMemberState) trialPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.halfOpen && s.trial
+}
+
+// closeCircuitLocked returns the member to normal operation.
+func (s *sharedMemberState) closeCircuitLocked() {
+	s.openInterval = 0
+	s.halfOpen = false
+	s.trial = false
+}
+
+// recordSuccess resets the failure count and closes an open circuit.
+// Returns true when it closed one.
+func (s *sharedMemberState) recordSuccess() bool {
 	s.mu.Lock()
 	s.failures = 0
+	closed := s.halfOpen
+	s.closeCircuitLocked()
 	s.mu.Unlock()
 
 	if entry := s.entry.Load(); entry != nil {
 		entry.RecordSuccess()
 	}
+	return closed
 }
 
 // isBlacklisted checks if the node is currently blacklisted, auto-clearing if expired.
@@ -103,6 +214,8 @@ func (s *sharedMemberState) isBlacklisted(now time.Time) bool {
 	if expired {
 		s.blacklisted = false
 		s.blacklistedUntil = time.Time{}
+		// An open circuit goes half-open rather than straight back.
+		s.halfOpen = s.openInterval > 0
 	}
 	blacklisted := s.blacklisted
 	s.mu.Unlock()
@@ -132,11 +245,76 @@ func (s *sharedMemberState) blacklistRemaining(now time.Time) time.Duration {
 	return remaining
 }
 
+// recordProbe feeds one active health-check result into the member's
+// health. The member leaves rotation after unhealthyThreshold consecutive
+// failures and returns after healthyThreshold consecutive successes.
+// Returns true when this result flipped the health state.
+func (s *sharedMemberState) recordProbe(ok bool, healthyThreshold, unhealthyThreshold int) bool {
+	s.mu.Lock()
+	var flipped bool
+	if ok {
+		s.probeFailures = 0
+		s.probeSuccesses++
+		flipped = s.unhealthy.Load() && s.probeSuccesses >= healthyThreshold
+	} else {
+		s.probeSuccesses = 0
+		s.probeFailures++
+		flipped = !s.unhealthy.Load() && s.probeFailures >= unhealthyThreshold
+	}
+	if flipped {
+		s.unhealthy.Store(!ok)
+	}
+	s.mu.Unlock()
+	if flipped {
+		s.reportHealth(!ok)
+	}
+	return flipped
+}
+
+// reportHealth tells the monitor that the member left or rejoined
+// rotation, for the cluster peers.
+func (s *sharedMemberState) reportHealth(unhealthy bool) {
+	if entry := s.entry.Load(); entry != nil {
+		entry.MarkUnhealthy(unhealthy)
+	}
+}
+
+// setHealth applies a health verdict from a cluster peer. The probe
+// history starts over, so local probes need the full threshold to
+// overturn it.
+func (s *sharedMemberState) setHealth(unhealthy bool) {
+	s.mu.Lock()
+	s.probeFailures = 0
+	s.probeSuccesses = 0
+	s.unhealthy.Store(unhealthy)
+	s.mu.Unlock()
+}
+
+// isUnhealthy reports whether active health checks have taken the member
+// out of rotation.
+func (s *sharedMemberState) isUnhealthy() bool {
+	return s.unhealthy.Load()
+}
+
+// resetHealth puts the member back into rotation regardless of probe history
+// (manual release from the API).
+func (s *sharedMemberState) resetHealth() {
+	s.mu.Lock()
+	s.probeFailures = 0
+	s.probeSuccesses = 0
+	wasUnhealthy := s.unhealthy.Swap(false)
+	s.mu.Unlock()
+	if wasUnhealthy {
+		s.reportHealth(false)
+	}
+}
+
 func (s *sharedMemberState) forceRelease() {
 	s.mu.Lock()
 	s.failures = 0
 	s.blacklisted = false
 	s.blacklistedUntil = time.Time{}
+	s.closeCircuitLocked()
 	s.mu.Unlock()
 
 	if entry := s.entry.Load(); entry != nil {
@@ -144,11 +322,22 @@ func (s *sharedMemberState) forceRelease() {
 	}
 }
 
-func (s *sharedMemberState) incActive() {
-	s.active.Add(1)
+// tryIncActive counts a new connection unless limit (> 0) connections are
+// already active.
+func (s *sharedMemberState) tryIncActive(limit int32) bool {
+	for {
+		n := s.active.Load()
+		if limit > 0 && n >= limit {
+			return false
+		}
+		if s.active.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
 	if entry := s.entry.Load(); entry != nil {
 		entry.IncActive()
 	}
+	return true
 }
 
 func (s *sharedMemberState) decActive() {
@@ -166,17 +355,26 @@ func (s *sharedMemberState) activeCount() int32 {
 func releaseSharedMember(tag string) {
 	if state, ok := lookupSharedState(tag); ok {
 		state.forceRelease()
+		state.resetHealth()
+	}
+}
+
+// setSharedMemberHealth applies a cluster peer's health verdict to a node.
+func setSharedMemberHealth(tag string, unhealthy bool) {
+	if state, ok := lookupSharedState(tag); ok {
+		state.setHealth(unhealthy)
 	}
 }
 
 // blacklistSharedMember manually blacklists a node in pool shared state.
 func blacklistSharedMember(tag string, duration time.Duration) {
 	if state, ok := lookupSharedState(tag); ok {
-		until := time.Now().Add(duration)
+		until := clock.Now().Add(duration)
 		state.mu.Lock()
 		state.blacklisted = true
 		state.blacklistedUntil = until
 		state.failures = 0
+		state.closeCircuitLocked()
 		state.mu.Unlock()
 	}
 }
@@ -0,0 +1,115 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/clock"
+)
+
+func TestRecordProbeThresholds(t *testing.T) {
+	state := &sharedMemberState{}
+
+	if state.recordProbe(false, 2, 3) || state.recordProbe(false, 2, 3) {
+		t.Fatalf("member should stay in rotation before the unhealthy threshold")
+	}
+	if !state.recordProbe(false, 2, 3) || !state.isUnhealthy() {
+		t.Fatalf("third consecutive failure should remove the member")
+	}
+	if state.recordProbe(false, 2, 3) {
+		t.Fatalf("further failures must not report another transition")
+	}
+
+	if state.recordProbe(true, 2, 3) {
+		t.Fatalf("member should stay out until the healthy threshold")
+	}
+	if !state.recordProbe(true, 2, 3) || state.isUnhealthy() {
+		t.Fatalf("second consecutive success should restore the member")
+	}
+}
+
+func TestRecordProbeSuccessResetsFailureStreak(t *testing.T) {
+	state := &sharedMemberState{}
+	state.recordProbe(false, 1, 2)
+	state.recordProbe(true, 1, 2)
+	if state.recordProbe(false, 1, 2) || state.isUnhealthy() {
+		t.Fatalf("a success in between should reset the failure streak")
+	}
+}
+
+func TestResetHealthRestoresMember(t *testing.T) {
+	state := &sharedMemberState{}
+	state.recordProbe(false, 1, 1)
+	if !state.isUnhealthy() {
+		t.Fatalf("expected member to be unhealthy")
+	}
+	state.resetHealth()
+	if state.isUnhealthy() {
+		t.Fatalf("resetHealth should put the member back into rotation")
+	}
+}
+
+func TestCircuitBreakerHalfOpenTrial(t *testing.T) {
+	state := &sharedMemberState{}
+	cause := errors.New("dial timeout")
+
+	if _, opened, _ := state.recordBreakerFailure(cause, 2, time.Minute, 4*time.Minute); opened {
+		t.Fatalf("circuit should stay closed below the threshold")
+	}
+	_, opened, until := state.recordBreakerFailure(cause, 2, time.Minute, 4*time.Minute)
+	if !opened || !state.isBlacklisted(clock.Now()) {
+		t.Fatalf("circuit should open at the threshold")
+	}
+
+	// After the open interval the member is half-open: one trial only.
+	if state.isBlacklisted(until.Add(time.Second)) {
+		t.Fatalf("member should be half-open after the open interval")
+	}
+	if !state.beginTrial() || state.beginTrial() || !state.trialPending() {
+		t.Fatalf("half-open member must admit exactly one trial")
+	}
+
+	// A failed trial reopens at once for twice as long.
+	_, opened, until = state.recordBreakerFailure(cause, 2, time.Minute, 4*time.Minute)
+	if !opened || state.trialPending() {
+		t.Fatalf("failed trial should reopen the circuit")
+	}
+	if wait := until.Sub(clock.Now()); wait <= time.Minute || wait > 2*time.Minute {
+		t.Fatalf("expected the open interval to double, got %s", wait)
+	}
+
+	state.isBlacklisted(until.Add(time.Second))
+	if !state.beginTrial() {
+		t.Fatalf("expected a trial after the reopened interval")
+	}
+	if !state.recordSuccess() {
+		t.Fatalf("successful trial should close the circuit")
+	}
+	if !state.beginTrial() || !state.beginTrial() || state.trialPending() {
+		t.Fatalf("closed member must admit every request")
+	}
+}
+
+func TestCircuitBreakerBackoffIsCapped(t *testing.T) {
+	state := &sharedMemberState{}
+	cause := errors.New("refused")
+	_, _, until := state.recordBreakerFailure(cause, 1, time.Minute, 90*time.Second)
+	for i := 0; i < 3; i++ {
+		state.isBlacklisted(until.Add(time.Second))
+		state.beginTrial()
+		_, _, until = state.recordBreakerFailure(cause, 1, time.Minute, 90*time.Second)
+	}
+	if wait := until.Sub(clock.Now()); wait > 90*time.Second {
+		t.Fatalf("open interval exceeded the cap: %s", wait)
+	}
+}
+
+func TestForceReleaseClosesCircuit(t *testing.T) {
+	state := &sharedMemberState{}
+	state.recordBreakerFailure(errors.New("refused"), 1, time.Minute, time.Minute)
+	state.forceRelease()
+	if state.isBlacklisted(clock.Now()) || state.halfOpen || state.openInterval != 0 {
+		t.Fatalf("release should close the circuit")
+	}
+}
@@ -0,0 +1,230 @@
+package pool
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"easy_proxies/internal/clock"
+	"easy_proxies/internal/monitor"
+)
+
+// maxConnectSamples bounds the connect times kept per member for SLOs.
+const maxConnectSamples = 1000
+
+// SLOOptions is a connect-time objective for the members of a group: the
+// Percentile of their connect times over Window must stay at or below
+// Connect. A member that misses it leaves the rotation for Cooldown, and a
+// standby member of the group takes its place.
+type SLOOptions struct {
+	Percentile int // 1-100, default 95
+	Connect    time.Duration
+	Window     time.Duration // default 5m
+	// MinSamples is the number of connects within Window needed before the
+	// objective is judged (default 20).
+	MinSamples int
+	Cooldown   time.Duration // default Window
+}
+
+// normalizeSLOs lower-cases the group names and fills in defaults. SLOs
+// without a Connect target are dropped.
+func normalizeSLOs(slos map[string]SLOOptions) map[string]SLOOptions {
+	out := make(map[string]SLOOptions, len(slos))
+	for group, slo := range slos {
+		if slo.Connect <= 0 {
+			continue
+		}
+		if slo.Percentile <= 0 || slo.Percentile > 100 {
+			slo.Percentile = 95
+		}
+		if slo.Window <= 0 {
+			slo.Window = 5 * time.Minute
+		}
+		if slo.MinSamples <= 0 {
+			slo.MinSamples = 20
+		}
+		if slo.Cooldown <= 0 {
+			slo.Cooldown = slo.Window
+		}
+		out[strings.ToLower(group)] = slo
+	}
+	return out
+}
+
+type connectSample struct {
+	at      time.Time
+	elapsed time.Duration
+}
+
+// recordConnect adds the connect time of a dial made at now and forgets
+// those older than window. It returns how many connects are within window
+// and how many of them took longer than target. Keeping the second count
+// as samples come and go spares sorting the samples on every dial.
+func (s *sharedMemberState) recordConnect(now time.Time, elapsed, window, target time.Duration) (total, slow int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target != s.connectTarget {
+		s.connectTarget = target
+		s.slowConnects = 0
+		for _, sample := range s.connects[s.connectHead:] {
+			if sample.elapsed > target {
+				s.slowConnects++
+			}
+		}
+	}
+	s.connects = append(s.connects, connectSample{at: now, elapsed: elapsed})
+	if elapsed > target {
+		s.slowConnects++
+	}
+	cutoff := now.Add(-window)
+	for s.connectHead < len(s.connects) && (s.connects[s.connectHead].at.Before(cutoff) || len(s.connects)-s.connectHead > maxConnectSamples) {
+		if s.connects[s.connectHead].elapsed > target {
+			s.slowConnects--
+		}
+		s.connectHead++
+	}
+	// Move the kept samples to the front once the dropped ones make up
+	// half the slice, so each sample is copied a bounded number of times.
+	if s.connectHead > 0 && s.connectHead >= len(s.connects)/2 {
+		s.connects = append(s.connects[:0], s.connects[s.connectHead:]...)
+		s.connectHead = 0
+	}
+	return len(s.connects) - s.connectHead, s.slowConnects
+}
+
+// connectTimes returns a copy of the connect times within the window.
+func (s *sharedMemberState) connectTimes() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := make([]time.Duration, 0, len(s.connects)-s.connectHead)
+	for _, sample := range s.connects[s.connectHead:] {
+		samples = append(samples, sample.elapsed)
+	}
+	return samples
+}
+
+// resetConnects forgets the connect times, so a member is judged afresh.
+func (s *sharedMemberState) resetConnects() {
+	s.mu.Lock()
+	s.clearConnectsLocked()
+	s.mu.Unlock()
+}
+
+func (s *sharedMemberState) clearConnectsLocked() {
+	s.connects = nil
+	s.connectHead = 0
+	s.slowConnects = 0
+}
+
+// rotateOut takes the member out of rotation until until, like a
+// blacklist, and starts its connect times afresh.
+func (s *sharedMemberState) rotateOut(until time.Time) {
+	s.mu.Lock()
+	s.failures = 0
+	s.blacklisted = true
+	s.blacklistedUntil = until
+	s.clearConnectsLocked()
+	s.mu.Unlock()
+
+	if entry := s.entry.Load(); entry != nil {
+		entry.Blacklist(until)
+	}
+}
+
+// percentileRank is the 1-based nearest rank of the p-th percentile of n
+// samples.
+func percentileRank(n, p int) int {
+	return max((n*p+99)/100, 1)
+}
+
+// percentile returns the p-th percentile (nearest rank) of samples, which
+// must not be empty. samples is sorted in place.
+func percentile(samples []time.Duration, p int) time.Duration {
+	slices.Sort(samples)
+	return samples[percentileRank(len(samples), p)-1]
+}
+
+// observeConnect feeds the connect time of a successful dial into the SLO
+// of member's group and rotates the member out when it misses the SLO.
+func (p *poolOutbound) observeConnect(member *memberState, elapsed time.Duration) {
+	slo := member.slo
+	if slo == nil || member.shared == nil {
+		return
+	}
+	now := clock.Now()
+	total, slow := member.shared.recordConnect(now, elapsed, slo.Window, slo.Connect)
+	// The percentile is within the target as long as the connects within
+	// it reach its rank; only a miss needs the sorted times for the report.
+	if total < slo.MinSamples || total-slow >= percentileRank(total, slo.Percentile) {
+		return
+	}
+	samples := member.shared.connectTimes()
+	if len(samples) == 0 {
+		return
+	}
+	observed := percentile(samples, slo.Percentile)
+	if observed <= slo.Connect {
+		return
+	}
+
+	ev := monitor.SLOEvent{
+		Group:      member.group,
+		Node:       member.tag,
+		Percentile: slo.Percentile,
+		ObservedMs: observed.Milliseconds(),
+		TargetMs:   slo.Connect.Milliseconds(),
+		Samples:    len(samples),
+	}
+	until := now.Add(slo.Cooldown)
+	p.mu.Lock()
+	promoted, replaced := p.sloReplacementLocked(member, now, until)
+	p.mu.Unlock()
+	if replaced {
+		member.shared.rotateOut(until)
+		ev.Action, ev.Until, ev.Promoted = monitor.SLORotatedOut, clock.Wall(until), promoted
+		p.logger.Warn("proxy ", member.tag, " missed the SLO of group ", member.group, " (p", slo.Percentile, " ", observed, " > ", slo.Connect, "), out of rotation for ", slo.Cooldown)
+		log.Printf("⚠️  [pool] %s missed the %s SLO: p%d connect %s > %s over %d connects, out of rotation until %s", member.tag, member.group, slo.Percentile, observed.Round(time.Millisecond), slo.Connect, len(samples), clock.Wall(until).Format("15:04:05"))
+		if promoted != "" {
+			log.Printf("    standby %s promoted in its place", promoted)
+		}
+	} else {
+		// Nothing could take over: keep the member and judge it afresh
+		// rather than reporting the same window on every connect.
+		member.shared.resetConnects()
+		ev.Action = monitor.SLOKept
+		p.logger.Warn("proxy ", member.tag, " missed the SLO of group ", member.group, " but no other node is available, kept in rotation")
+	}
+	if p.monitor != nil {
+		p.monitor.RecordSLOEvent(ev)
+	}
+}
+
+// sloReplacementLocked finds what takes over from member while it is out
+// of rotation until until. A usable standby member of the same group is
+// promoted to a regular member meanwhile and its tag returned; otherwise
+// the other usable members carry on. It reports false when no other
+// member is usable.
+func (p *poolOutbound) sloReplacementLocked(member *memberState, now, until time.Time) (string, bool) {
+	others := false
+	for _, m := range p.members {
+		if m == member || !usable(m, now) {
+			continue
+		}
+		if m.standby && m.group == member.group && !now.Before(m.promotedUntil) {
+			m.promotedUntil = until
+			return m.tag, true
+		}
+		others = true
+	}
+	return "", others
+}
+
+// usable reports whether m may take connections: not blacklisted, not
+// failing its probes and not reserved for a half-open trial.
+func usable(m *memberState, now time.Time) bool {
+	if m.shared == nil {
+		return true
+	}
+	return !m.shared.isBlacklisted(now) && !m.shared.isUnhealthy() && !m.shared.trialPending()
+}
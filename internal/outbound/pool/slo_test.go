@@ -0,0 +1,110 @@
+package pool
+
+import (
+	"testing"
+	"time"
+
+	singlog "github.com/sagernet/sing-box/log"
+)
+
+func TestPercentile(t *testing.T) {
+	samples := make([]time.Duration, 0, 20)
+	for i := 20; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(samples, 95); got != 19*time.Millisecond {
+		t.Fatalf("p95: got %s", got)
+	}
+	if got := percentile(samples, 100); got != 20*time.Millisecond {
+		t.Fatalf("p100: got %s", got)
+	}
+	if got := percentile([]time.Duration{time.Second}, 1); got != time.Second {
+		t.Fatalf("single sample: got %s", got)
+	}
+}
+
+func TestRecordConnectCountsSlow(t *testing.T) {
+	s := &sharedMemberState{}
+	start := time.Now()
+	for i := range maxConnectSamples + 10 {
+		elapsed := 100 * time.Millisecond
+		if i < 10 {
+			elapsed = time.Second
+		}
+		s.recordConnect(start.Add(time.Duration(i)*time.Millisecond), elapsed, time.Hour, 500*time.Millisecond)
+	}
+	// The slow connects were the oldest and fell past the sample bound.
+	total, slow := s.recordConnect(start.Add(time.Second), 2*time.Second, time.Hour, 500*time.Millisecond)
+	if total != maxConnectSamples || slow != 1 {
+		t.Fatalf("got %d connects, %d slow; want %d, 1", total, slow, maxConnectSamples)
+	}
+	// Older than the window.
+	total, slow = s.recordConnect(start.Add(2*time.Hour), time.Second, time.Hour, 500*time.Millisecond)
+	if total != 1 || slow != 1 {
+		t.Fatalf("after the window: got %d connects, %d slow", total, slow)
+	}
+	// A new target recounts the kept connects.
+	if _, slow = s.recordConnect(start.Add(2*time.Hour), 100*time.Millisecond, time.Hour, 2*time.Second); slow != 0 {
+		t.Fatalf("after a new target: got %d slow", slow)
+	}
+}
+
+func TestSLORotatesOutAndPromotesStandby(t *testing.T) {
+	slo := &SLOOptions{Percentile: 95, Connect: 800 * time.Millisecond, Window: time.Minute, MinSamples: 3, Cooldown: time.Minute}
+	slow := &memberState{tag: "slow", group: "res", slo: slo, shared: &sharedMemberState{}}
+	fast := &memberState{tag: "fast", group: "res", slo: slo, shared: &sharedMemberState{}}
+	other := &memberState{tag: "other", group: "dc", shared: &sharedMemberState{}, standby: true}
+	spare := &memberState{tag: "spare", group: "res", slo: slo, shared: &sharedMemberState{}, standby: true}
+	p := &poolOutbound{
+		logger:  singlog.NewNOPFactory().Logger(),
+		options: Options{StandbyThreshold: 1},
+		members: []*memberState{slow, fast, other, spare},
+	}
+	tags := func() string {
+		var out string
+		p.mu.Lock()
+		for _, m := range p.availableMembersLocked(time.Now(), "", nil) {
+			out += m.tag + " "
+		}
+		p.mu.Unlock()
+		return out
+	}
+
+	// Too few samples to judge yet.
+	p.observeConnect(slow, 2*time.Second)
+	p.observeConnect(slow, 2*time.Second)
+	if got := tags(); got != "slow fast " {
+		t.Fatalf("rotated out before min_samples: %q", got)
+	}
+	p.observeConnect(slow, 2*time.Second)
+	if got := tags(); got != "fast spare " {
+		t.Fatalf("slow member not replaced by the group's standby: %q", got)
+	}
+	if !slow.shared.isBlacklisted(time.Now()) {
+		t.Fatal("slow member not out of rotation")
+	}
+
+	// A member within its SLO stays.
+	for range 5 {
+		p.observeConnect(fast, 100*time.Millisecond)
+	}
+	if got := tags(); got != "fast spare " {
+		t.Fatalf("member within the SLO rotated out: %q", got)
+	}
+}
+
+func TestSLOKeepsLastMember(t *testing.T) {
+	slo := &SLOOptions{Percentile: 95, Connect: 800 * time.Millisecond, Window: time.Minute, MinSamples: 1, Cooldown: time.Minute}
+	only := &memberState{tag: "only", group: "res", slo: slo, shared: &sharedMemberState{}}
+	p := &poolOutbound{
+		logger:  singlog.NewNOPFactory().Logger(),
+		members: []*memberState{only},
+	}
+	p.observeConnect(only, 2*time.Second)
+	if only.shared.isBlacklisted(time.Now()) {
+		t.Fatal("the only member was rotated out")
+	}
+	if n := len(only.shared.connects); n != 0 {
+		t.Fatalf("connect times kept after the decision: %d", n)
+	}
+}
@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	singlog "github.com/sagernet/sing-box/log"
+)
+
+func TestStandbyMembersJoinBelowThreshold(t *testing.T) {
+	a := &memberState{tag: "a", shared: &sharedMemberState{}}
+	b := &memberState{tag: "b", shared: &sharedMemberState{}}
+	spare := &memberState{tag: "spare", shared: &sharedMemberState{}, standby: true}
+	p := &poolOutbound{
+		logger:  singlog.NewNOPFactory().Logger(),
+		options: Options{StandbyThreshold: 2},
+		members: []*memberState{a, spare, b},
+	}
+	tags := func() string {
+		var out string
+		for _, m := range p.availableMembersLocked(time.Now(), "", nil) {
+			out += m.tag + " "
+		}
+		return out
+	}
+
+	if got := tags(); got != "a b " || p.standbyInUse.Load() {
+		t.Fatalf("standby member used while enough regular members are up: %q", got)
+	}
+	a.shared.recordFailure(errors.New("down"), 1, time.Minute)
+	if got := tags(); got != "b spare " || !p.standbyInUse.Load() {
+		t.Fatalf("standby member not used below the threshold: %q", got)
+	}
+	a.shared.forceRelease()
+	if got := tags(); got != "a b " || p.standbyInUse.Load() {
+		t.Fatalf("standby member kept after recovery: %q", got)
+	}
+
+	// The default threshold only calls on standby members when no regular
+	// member is left.
+	p.options.StandbyThreshold = 0
+	a.shared.recordFailure(errors.New("down"), 1, time.Minute)
+	if got := tags(); got != "b " {
+		t.Fatalf("default threshold: %q", got)
+	}
+	b.shared.recordFailure(errors.New("down"), 1, time.Minute)
+	if got := tags(); got != "spare " {
+		t.Fatalf("standby member not used with no regular member left: %q", got)
+	}
+}
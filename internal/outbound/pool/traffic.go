@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"net"
+
+	"easy_proxies/internal/monitor"
+)
+
+// countTraffic adds the bytes read and written through c to the node's
+// traffic counter, for the cost report.
+func countTraffic(c net.Conn, entry *monitor.EntryHandle) net.Conn {
+	if entry == nil {
+		return c
+	}
+	return &trafficConn{Conn: c, entry: entry}
+}
+
+// countPacketTraffic is countTraffic for packet connections.
+func countPacketTraffic(c net.PacketConn, entry *monitor.EntryHandle) net.PacketConn {
+	if entry == nil {
+		return c
+	}
+	return &trafficPacketConn{PacketConn: c, entry: entry}
+}
+
+type trafficConn struct {
+	net.Conn
+	entry *monitor.EntryHandle
+}
+
+func (c *trafficConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.entry.AddTraffic(int64(n))
+	return n, err
+}
+
+func (c *trafficConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.entry.AddTraffic(int64(n))
+	return n, err
+}
+
+type trafficPacketConn struct {
+	net.PacketConn
+	entry *monitor.EntryHandle
+}
+
+func (c *trafficPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	c.entry.AddTraffic(int64(n))
+	return n, addr, err
+}
+
+func (c *trafficPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.entry.AddTraffic(int64(n))
+	return n, err
+}
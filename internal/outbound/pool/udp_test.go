@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+
+	"easy_proxies/internal/users"
+
+	"github.com/sagernet/sing-box/adapter"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// networkOutbound only answers Network; pool selection needs nothing else.
+type networkOutbound struct {
+	adapter.Outbound
+	networks []string
+}
+
+func (o networkOutbound) Network() []string { return o.networks }
+
+func TestPickMemberSkipsTCPOnlyForUDP(t *testing.T) {
+	httpOnly := &memberState{tag: "http", outbound: networkOutbound{networks: []string{N.NetworkTCP}}}
+	socks := &memberState{tag: "socks", outbound: networkOutbound{networks: []string{N.NetworkTCP, N.NetworkUDP}}}
+	p := &poolOutbound{members: []*memberState{httpOnly, socks}}
+
+	for i := 0; i < 4; i++ {
+		member, err := p.pickMemberFiltered(N.NetworkUDP, nil, "", users.Pin{}, nil)
+		if err != nil {
+			t.Fatalf("pick udp member: %v", err)
+		}
+		if member.tag != "socks" {
+			t.Fatalf("udp traffic picked %s, want socks", member.tag)
+		}
+	}
+}
+
+func TestPickMemberReportsMissingUDPSupport(t *testing.T) {
+	p := &poolOutbound{members: []*memberState{
+		{tag: "http", outbound: networkOutbound{networks: []string{N.NetworkTCP}}},
+	}}
+	_, err := p.pickMemberFiltered(N.NetworkUDP, nil, "", users.Pin{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "supports UDP") {
+		t.Fatalf("expected missing UDP support error, got %v", err)
+	}
+	if _, err := p.pickMemberFiltered(N.NetworkTCP, nil, "", users.Pin{}, nil); err != nil {
+		t.Fatalf("tcp pick should still succeed: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package pool
+
+import "testing"
+
+func TestSelectWeightedProportional(t *testing.T) {
+	p := &poolOutbound{mode: modeWeighted}
+	fast := &memberState{tag: "fast", weight: 10}
+	slow := &memberState{tag: "slow", weight: 1}
+	unset := &memberState{tag: "unset"}
+	candidates := []*memberState{fast, slow, unset}
+
+	counts := map[string]int{}
+	for i := 0; i < 120; i++ {
+		counts[p.selectByMode(candidates).tag]++
+	}
+	if counts["fast"] != 100 || counts["slow"] != 10 || counts["unset"] != 10 {
+		t.Fatalf("expected 100/10/10 split over 10 cycles, got %v", counts)
+	}
+}
+
+func TestSelectWeightedInterleaves(t *testing.T) {
+	p := &poolOutbound{mode: modeWeighted}
+	a := &memberState{tag: "a", weight: 2}
+	b := &memberState{tag: "b", weight: 1}
+	candidates := []*memberState{a, b}
+
+	var got string
+	for i := 0; i < 6; i++ {
+		got += p.selectByMode(candidates).tag
+	}
+	if got != "abaaba" {
+		t.Fatalf("expected smooth interleaving abaaba, got %s", got)
+	}
+}
+
+func TestNormalizeOptionsAcceptsWeighted(t *testing.T) {
+	if got := normalizeOptions(Options{Mode: "Weighted"}).Mode; got != modeWeighted {
+		t.Fatalf("expected mode %q, got %q", modeWeighted, got)
+	}
+}
@@ -0,0 +1,292 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/protocol/socks"
+)
+
+// commandReadyTimeout bounds how long a SOCKS command may take to start
+// accepting connections.
+const commandReadyTimeout = 10 * time.Second
+
+// Command makes a node dial through an external command, for tunnels the
+// core has no protocol for (cloudflared access, ssh -W, ...).
+type Command struct {
+	Node    string // node name, for logs
+	Command string
+	Args    []string
+	Env     []string // extra KEY=VALUE pairs
+	// SOCKS is the address the command serves a SOCKS5 proxy on. The
+	// command then runs once and is restarted when it exits. When empty,
+	// the command is run for every connection with "{host}" and "{port}"
+	// in Args replaced by the destination, and its stdin/stdout carry the
+	// connection, like ssh's ProxyCommand.
+	SOCKS string
+}
+
+// NewCommand returns the Dialer of a command node.
+func NewCommand(c Command) (Dialer, error) {
+	if c.Command == "" {
+		return nil, fmt.Errorf("exec node %s has no command", c.Node)
+	}
+	if c.SOCKS == "" {
+		return &stdioCommand{spec: c}, nil
+	}
+	server := M.ParseSocksaddr(c.SOCKS)
+	if !server.IsValid() || server.Port == 0 {
+		return nil, fmt.Errorf("exec node %s: invalid socks address %q", c.Node, c.SOCKS)
+	}
+	return &socksCommand{spec: c, client: socks.NewClient(N.SystemDialer, server, socks.Version5, "", "")}, nil
+}
+
+func (c Command) cmd(args []string) *exec.Cmd {
+	cmd := exec.Command(c.Command, args...)
+	cmd.Env = append(os.Environ(), c.Env...)
+	return cmd
+}
+
+// logLines logs what the command writes to r.
+func (c Command) logLines(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("🔌 [exec %s] %s", c.Node, scanner.Text())
+	}
+}
+
+// socksCommand runs a command serving SOCKS5 and dials through it.
+type socksCommand struct {
+	spec   Command
+	client *socks.Client
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	exited chan struct{}
+	closed bool
+}
+
+func (s *socksCommand) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+	return s.client.DialContext(ctx, network, M.ParseSocksaddr(address))
+}
+
+// ensure starts the command unless it is running and waits until its SOCKS
+// address accepts connections.
+func (s *socksCommand) ensure(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return net.ErrClosed
+	}
+	if s.cmd != nil {
+		select {
+		case <-s.exited:
+			s.cmd = nil
+		default:
+			return nil
+		}
+	}
+
+	cmd := s.spec.cmd(s.spec.Args)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("exec node %s: %w", s.spec.Node, err)
+	}
+	exited := make(chan struct{})
+	go s.spec.logLines(stdout)
+	go func() {
+		err := cmd.Wait()
+		log.Printf("🔌 [exec %s] exited: %v", s.spec.Node, err)
+		close(exited)
+	}()
+
+	deadline := time.Now().Add(commandReadyTimeout)
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", s.spec.SOCKS)
+		if err == nil {
+			conn.Close()
+			log.Printf("🔌 [exec %s] started (pid %d), SOCKS5 on %s", s.spec.Node, cmd.Process.Pid, s.spec.SOCKS)
+			s.cmd, s.exited = cmd, exited
+			return nil
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("exec node %s: command exited before serving %s", s.spec.Node, s.spec.SOCKS)
+		case <-ctx.Done():
+			_ = cmd.Process.Kill()
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("exec node %s: nothing listening on %s after %s", s.spec.Node, s.spec.SOCKS, commandReadyTimeout)
+		}
+	}
+}
+
+func (s *socksCommand) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.cmd != nil {
+		_ = s.cmd.Process.Kill()
+		<-s.exited
+		s.cmd = nil
+	}
+	return nil
+}
+
+// stdioCommand runs the command once per connection.
+type stdioCommand struct {
+	spec Command
+}
+
+func (s *stdioCommand) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	// The destination comes from the client and ends up in argv.
+	if err := checkCommandTarget(host, port); err != nil {
+		return nil, fmt.Errorf("exec node %s: %w", s.spec.Node, err)
+	}
+	args := make([]string, len(s.spec.Args))
+	for i, arg := range s.spec.Args {
+		args[i] = strings.NewReplacer("{host}", host, "{port}", port).Replace(arg)
+	}
+	cmd := s.spec.cmd(args)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec node %s: %w", s.spec.Node, err)
+	}
+	go s.spec.logLines(stderr)
+	return &stdioConn{cmd: cmd, stdin: stdin, stdout: stdout, remote: commandAddr(address)}, nil
+}
+
+func (s *stdioCommand) Close() error { return nil }
+
+// checkCommandTarget accepts a destination only if host is an IP address or
+// a valid hostname and port a decimal port number, so a client cannot pass
+// options (a host starting with "-") or other arguments to the command.
+func checkCommandTarget(host, port string) error {
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 || port[0] == '+' {
+		return fmt.Errorf("invalid destination port %q", port)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return fmt.Errorf("invalid destination host %q", host)
+		}
+		return nil
+	}
+	if !validHostname(host) {
+		return fmt.Errorf("invalid destination host %q", host)
+	}
+	return nil
+}
+
+// validHostname reports whether host is a DNS name: dot-separated labels of
+// letters, digits, "-" and "_", none starting or ending with "-".
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stdioConn is a connection carried over a command's stdin and stdout.
+type stdioConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	remote    commandAddr
+	closeOnce sync.Once
+}
+
+func (c *stdioConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *stdioConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+func (c *stdioConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *stdioConn) LocalAddr() net.Addr  { return commandAddr("stdio") }
+func (c *stdioConn) RemoteAddr() net.Addr { return c.remote }
+
+// The pipes are *os.File on every platform Go supports; deadlines work
+// where the OS can poll pipes and are ignored elsewhere.
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *stdioConn) SetReadDeadline(t time.Time) error {
+	if f, ok := c.stdout.(*os.File); ok {
+		_ = f.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *stdioConn) SetWriteDeadline(t time.Time) error {
+	if f, ok := c.stdin.(*os.File); ok {
+		_ = f.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "exec" }
+func (a commandAddr) String() string  { return string(a) }
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperCommand is the command run by the exec node tests; it only runs
+// when started as one. In stdio mode it greets with its arguments and then
+// echoes; in socks mode it serves a minimal SOCKS5 proxy that greets with
+// the requested destination.
+func TestHelperCommand(t *testing.T) {
+	switch os.Getenv("EASY_PROXIES_TEST_COMMAND") {
+	case "stdio":
+		args := os.Args[len(os.Args)-2:]
+		fmt.Printf("dial %s %s\n", args[0], args[1])
+		_, _ = io.Copy(os.Stdout, os.Stdin)
+		os.Exit(0)
+	case "socks":
+		ln, err := net.Listen("tcp", os.Args[len(os.Args)-1])
+		if err != nil {
+			os.Exit(1)
+		}
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				os.Exit(0)
+			}
+			go serveTestSOCKS(conn)
+		}
+	}
+}
+
+func serveTestSOCKS(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(r, make([]byte, head[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		io.ReadFull(r, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	fmt.Fprintf(conn, "hello %s:%d\n", host, binary.BigEndian.Uint16(port))
+}
+
+func helperCommand(node, mode string, args ...string) Command {
+	return Command{
+		Node:    node,
+		Command: os.Args[0],
+		Args:    append([]string{"-test.run=^TestHelperCommand$", "--"}, args...),
+		Env:     []string{"EASY_PROXIES_TEST_COMMAND=" + mode},
+	}
+}
+
+func TestCommandStdio(t *testing.T) {
+	d, err := NewCommand(helperCommand("tunnel", "stdio", "{host}", "{port}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := d.DialContext(ctx, "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	if line, err := reader.ReadString('\n'); err != nil || line != "dial example.com 443\n" {
+		t.Fatalf("greeting %q, %v", line, err)
+	}
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("echo %q, %v", line, err)
+	}
+	if conn.RemoteAddr().String() != "example.com:443" {
+		t.Fatalf("remote addr %s", conn.RemoteAddr())
+	}
+}
+
+func TestCommandStdioRejectsArguments(t *testing.T) {
+	d, err := NewCommand(helperCommand("tunnel", "stdio", "{host}", "{port}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, dest := range []string{"-oProxyCommand=sh:22", "-x.example.com:443", "example.com:-1", "example.com:+443", "a b.example.com:80", "[fe80::1%-x]:80"} {
+		if conn, err := d.DialContext(context.Background(), "tcp", dest); err == nil {
+			conn.Close()
+			t.Fatalf("dialed %q", dest)
+		}
+	}
+	for _, host := range []string{"example.com", "_srv.example.com.", "192.0.2.1", "2001:db8::1"} {
+		if err := checkCommandTarget(host, "443"); err != nil {
+			t.Fatalf("rejected %q: %v", host, err)
+		}
+	}
+}
+
+func TestCommandSOCKS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spec := helperCommand("tunnel", "socks", addr)
+	spec.SOCKS = addr
+	d, err := NewCommand(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	for _, dest := range []string{"example.com:80", "192.0.2.1:8080"} {
+		conn, err := d.DialContext(ctx, "tcp", dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err != nil || line != "hello "+dest+"\n" {
+			t.Fatalf("relayed %q, %v", line, err)
+		}
+	}
+
+	// The command is shared by all connections and stopped on Close.
+	s := d.(*socksCommand)
+	if s.cmd == nil {
+		t.Fatal("command not running")
+	}
+	exited := s.exited
+	d.Close()
+	select {
+	case <-exited:
+	default:
+		t.Fatal("command still running after Close")
+	}
+	if _, err := d.DialContext(ctx, "tcp", "example.com:80"); err == nil {
+		t.Fatal("dial after Close succeeded")
+	}
+}
+
+func TestNewCommandInvalid(t *testing.T) {
+	if _, err := NewCommand(Command{Node: "n"}); err == nil {
+		t.Fatal("accepted a command node without a command")
+	}
+	_, err := NewCommand(Command{Node: "n", Command: "true", SOCKS: "localhost"})
+	if err == nil || !strings.Contains(err.Error(), "invalid socks address") {
+		t.Fatalf("expected an invalid socks address error, got %v", err)
+	}
+}
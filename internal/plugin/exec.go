@@ -0,0 +1,254 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exec plugins speak a line-based handshake, version 1:
+//
+//  1. easy_proxies starts the command once, on the first connection through
+//     any of its nodes, with EASY_PROXIES_PLUGIN=1 in its environment.
+//  2. The plugin writes one line to stdout: "EP-PLUGIN 1 <address>", where
+//     address is a loopback "ip:port" or "unix:/path/to/socket" it accepts
+//     connections on. Any other address is refused and the plugin stopped.
+//     Further output on stdout and stderr is logged.
+//  3. For every connection easy_proxies connects to that address and sends
+//     one JSON line: {"uri": node URI, "network": "tcp", "address":
+//     "host:port"}. The plugin answers "OK" or "ERR <reason>" on a line of
+//     its own, then relays raw bytes both ways until either side closes.
+//
+// A plugin that exits is started again on the next connection.
+const (
+	announcePrefix  = "EP-PLUGIN 1 "
+	announceTimeout = 10 * time.Second
+)
+
+// ExecSpec declares an exec plugin.
+type ExecSpec struct {
+	Scheme  string
+	Command string
+	Args    []string
+	Env     []string // extra KEY=VALUE pairs
+}
+
+// ConfigureExec replaces the exec plugins with specs. Running plugins whose
+// spec changed or that are no longer declared are stopped; the others keep
+// running. ConfigureExec(nil) stops them all.
+func ConfigureExec(specs []ExecSpec) {
+	next := make(map[string]*execPlugin, len(specs))
+	var stale []*execPlugin
+	mu.Lock()
+	for _, spec := range specs {
+		spec.Scheme = strings.ToLower(spec.Scheme)
+		if old, ok := execs[spec.Scheme]; ok && reflect.DeepEqual(old.spec, spec) {
+			next[spec.Scheme] = old
+			continue
+		}
+		next[spec.Scheme] = &execPlugin{spec: spec}
+	}
+	for scheme, old := range execs {
+		if next[scheme] != old {
+			stale = append(stale, old)
+		}
+	}
+	execs = next
+	mu.Unlock()
+	for _, p := range stale {
+		p.stop()
+	}
+}
+
+// execPlugin is the process of one exec plugin.
+type execPlugin struct {
+	spec ExecSpec
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	network string        // "tcp" or "unix"
+	addr    string        // announced address; "" while not running
+	exited  chan struct{} // closed when cmd exits
+}
+
+// address returns the network and address the plugin accepts connections
+// on, starting the plugin first when it is not running.
+func (p *execPlugin) address(ctx context.Context) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil {
+		select {
+		case <-p.exited:
+			p.cmd, p.addr = nil, ""
+		default:
+			return p.network, p.addr, nil
+		}
+	}
+
+	cmd := exec.Command(p.spec.Command, p.spec.Args...)
+	cmd.Env = append(append(os.Environ(), "EASY_PROXIES_PLUGIN=1"), p.spec.Env...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", "", fmt.Errorf("start plugin %s: %w", p.spec.Scheme, err)
+	}
+	exited := make(chan struct{})
+	announced := make(chan string, 1)
+	go p.logOutput(stderr, nil)
+	go p.logOutput(stdout, announced)
+	go func() {
+		err := cmd.Wait()
+		log.Printf("🔌 [plugin %s] exited: %v", p.spec.Scheme, err)
+		close(exited)
+	}()
+
+	timer := time.NewTimer(announceTimeout)
+	defer timer.Stop()
+	select {
+	case announcedAddr := <-announced:
+		network, addr, perr := parseAnnounced(announcedAddr)
+		if perr != nil {
+			err = fmt.Errorf("plugin %s: %w", p.spec.Scheme, perr)
+			break
+		}
+		log.Printf("🔌 [plugin %s] started (pid %d), listening on %s", p.spec.Scheme, cmd.Process.Pid, announcedAddr)
+		p.cmd, p.network, p.addr, p.exited = cmd, network, addr, exited
+		return network, addr, nil
+	case <-exited:
+		return "", "", fmt.Errorf("plugin %s exited before announcing its address", p.spec.Scheme)
+	case <-timer.C:
+		err = fmt.Errorf("plugin %s did not announce its address within %s", p.spec.Scheme, announceTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	_ = cmd.Process.Kill()
+	return "", "", err
+}
+
+// parseAnnounced checks the address a plugin announced and returns the
+// network and address to dial. Only loopback IPs and unix sockets are
+// accepted, so a plugin cannot point the handshake, which carries node
+// URIs with their credentials, at another host.
+func parseAnnounced(announced string) (string, string, error) {
+	if path, ok := strings.CutPrefix(announced, "unix:"); ok {
+		if path == "" {
+			return "", "", errors.New("announced an empty unix socket path")
+		}
+		return "unix", path, nil
+	}
+	addrPort, err := netip.ParseAddrPort(announced)
+	if err != nil {
+		return "", "", fmt.Errorf("announced address %q is neither a loopback ip:port nor a unix socket", announced)
+	}
+	if !addrPort.Addr().Unmap().IsLoopback() {
+		return "", "", fmt.Errorf("announced address %q is not a loopback address", announced)
+	}
+	return "tcp", addrPort.String(), nil
+}
+
+// logOutput logs the lines the plugin writes. On stdout, the first line
+// starting with the announce prefix is sent on announced instead.
+func (p *execPlugin) logOutput(r io.Reader, announced chan<- string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if announced != nil && strings.HasPrefix(line, announcePrefix) {
+			announced <- strings.TrimSpace(strings.TrimPrefix(line, announcePrefix))
+			announced = nil
+			continue
+		}
+		log.Printf("🔌 [plugin %s] %s", p.spec.Scheme, line)
+	}
+}
+
+func (p *execPlugin) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil {
+		return
+	}
+	_ = p.cmd.Process.Kill()
+	<-p.exited
+	p.cmd, p.addr = nil, ""
+}
+
+// handshake is the request line sent for each connection.
+type handshake struct {
+	URI     string `json:"uri"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+// execDialer dials the nodes of an exec plugin. The process is shared by
+// all nodes of the scheme, so closing a dialer leaves it running.
+type execDialer struct {
+	plugin *execPlugin
+	uri    string
+}
+
+func (d *execDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialNetwork, addr, err := d.plugin.address(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, dialNetwork, addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to plugin %s: %w", d.plugin.spec.Scheme, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req, _ := json.Marshal(handshake{URI: d.uri, Network: network, Address: address})
+	if _, err := conn.Write(append(req, '\n')); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("plugin %s handshake: %w", d.plugin.spec.Scheme, err)
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "OK" {
+		conn.Close()
+		if reason, ok := strings.CutPrefix(reply, "ERR"); ok {
+			return nil, fmt.Errorf("plugin %s: %s", d.plugin.spec.Scheme, strings.TrimSpace(reason))
+		}
+		return nil, fmt.Errorf("plugin %s handshake: unexpected reply %q", d.plugin.spec.Scheme, reply)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+func (d *execDialer) Close() error { return nil }
+
+// bufferedConn reads through the reader the handshake reply was read with,
+// so bytes the plugin sent right after it are not lost.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
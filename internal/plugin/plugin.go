@@ -0,0 +1,102 @@
+// Package plugin lets outbound protocols live outside the core. A plugin
+// handles the node URIs of one scheme and opens connections through them.
+//
+// Go plugins are packages linked into the binary that call Register from
+// an init function; add a blank import of the package to
+// cmd/easy_proxies/plugins.go. Exec plugins are external programs declared
+// under plugins in config.yaml and spoken to over the handshake described
+// in exec.go, so they can be written in any language. Built-in protocols
+// always win over a plugin registered for the same scheme.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dialer opens connections through one node.
+type Dialer interface {
+	// DialContext connects to address ("host:port") over network, which
+	// is always "tcp" for now.
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	// Close releases what the dialer holds. It is called when the node
+	// leaves the pool, e.g. on a config reload.
+	Close() error
+}
+
+// Factory builds the Dialer of a node from its URI. It should validate the
+// URI and fail fast: the node is skipped with the returned error.
+type Factory func(uri *url.URL) (Dialer, error)
+
+var (
+	mu      sync.RWMutex
+	modules = make(map[string]Factory)
+	execs   = make(map[string]*execPlugin)
+)
+
+// Register makes factory handle node URIs of scheme. It is meant to be
+// called from init and panics when scheme is empty or taken.
+func Register(scheme string, factory Factory) {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" || factory == nil {
+		panic("plugin: Register needs a scheme and a factory")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := modules[scheme]; dup {
+		panic("plugin: scheme registered twice: " + scheme)
+	}
+	modules[scheme] = factory
+}
+
+// Has reports whether a plugin handles scheme.
+func Has(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	mu.RLock()
+	defer mu.RUnlock()
+	_, module := modules[scheme]
+	_, external := execs[scheme]
+	return module || external
+}
+
+// Schemes lists the schemes handled by plugins, sorted.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(modules)+len(execs))
+	for scheme := range modules {
+		out = append(out, scheme)
+	}
+	for scheme := range execs {
+		if _, dup := modules[scheme]; !dup {
+			out = append(out, scheme)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// New builds the Dialer of the node rawURI with the plugin of its scheme.
+func New(rawURI string) (Dialer, error) {
+	u, err := url.Parse(rawURI)
+	if err != nil {
+		return nil, fmt.Errorf("parse uri: %w", err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	mu.RLock()
+	factory, module := modules[scheme]
+	external := execs[scheme]
+	mu.RUnlock()
+	switch {
+	case module:
+		return factory(u)
+	case external != nil:
+		return &execDialer{plugin: external, uri: rawURI}, nil
+	}
+	return nil, fmt.Errorf("no plugin handles scheme %q", u.Scheme)
+}
@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperPlugin is the exec plugin used by TestExecPlugin; it only runs
+// when started as one.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("EASY_PROXIES_PLUGIN") != "1" {
+		return
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.Exit(1)
+	}
+	fmt.Println("starting")
+	fmt.Printf("EP-PLUGIN 1 %s\n", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			os.Exit(0)
+		}
+		go func() {
+			defer conn.Close()
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				return
+			}
+			var req handshake
+			_ = json.Unmarshal([]byte(line), &req)
+			if strings.HasPrefix(req.Address, "blocked") {
+				fmt.Fprintf(conn, "ERR %s is blocked\n", req.Address)
+				return
+			}
+			fmt.Fprintf(conn, "OK\nhello %s %s %s\n", req.URI, req.Network, req.Address)
+		}()
+	}
+}
+
+func TestExecPlugin(t *testing.T) {
+	ConfigureExec([]ExecSpec{{Scheme: "Echo", Command: os.Args[0], Args: []string{"-test.run=^TestHelperPlugin$"}}})
+	t.Cleanup(func() { ConfigureExec(nil) })
+	if !Has("echo") {
+		t.Fatal("exec plugin not registered")
+	}
+
+	d, err := New("echo://node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	if err != nil || line != "hello echo://node-1 tcp example.com:80\n" {
+		t.Fatalf("relayed %q, %v", line, err)
+	}
+
+	if _, err := d.DialContext(ctx, "tcp", "blocked.example:443"); err == nil || !strings.Contains(err.Error(), "is blocked") {
+		t.Fatalf("expected the plugin's refusal, got %v", err)
+	}
+
+	// Dropping the plugin stops its process.
+	p := execs["echo"]
+	ConfigureExec(nil)
+	if Has("echo") || p.cmd != nil {
+		t.Fatal("plugin still registered or running")
+	}
+	if _, err := New("echo://node-1"); err == nil {
+		t.Fatal("expected an error for an unknown scheme")
+	}
+}
+
+func TestParseAnnounced(t *testing.T) {
+	cases := []struct {
+		announced, network, addr string
+	}{
+		{"127.0.0.1:1080", "tcp", "127.0.0.1:1080"},
+		{"[::1]:1080", "tcp", "[::1]:1080"},
+		{"unix:/run/plugin.sock", "unix", "/run/plugin.sock"},
+		{"192.0.2.1:1080", "", ""},
+		{"[::ffff:192.0.2.1]:1080", "", ""},
+		{"localhost:1080", "", ""},
+		{"127.0.0.1", "", ""},
+		{"unix:", "", ""},
+	}
+	for _, tc := range cases {
+		network, addr, err := parseAnnounced(tc.announced)
+		if tc.network == "" {
+			if err == nil {
+				t.Errorf("%s: accepted as %s %s", tc.announced, network, addr)
+			}
+			continue
+		}
+		if err != nil || network != tc.network || addr != tc.addr {
+			t.Errorf("%s: got %s %s, %v", tc.announced, network, addr, err)
+		}
+	}
+}
+
+type testDialer struct{ host string }
+
+func (d testDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, fmt.Errorf("dial through %s", d.host)
+}
+
+func (testDialer) Close() error { return nil }
+
+func TestRegister(t *testing.T) {
+	Register("TestMod", func(u *url.URL) (Dialer, error) { return testDialer{host: u.Host}, nil })
+	d, err := New("testmod://relay.example:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.(testDialer).host; got != "relay.example:9000" {
+		t.Fatalf("factory got host %q", got)
+	}
+	if schemes := Schemes(); len(schemes) != 1 || schemes[0] != "testmod" {
+		t.Fatalf("Schemes() = %v", schemes)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a scheme twice should panic")
+		}
+	}()
+	Register("testmod", func(*url.URL) (Dialer, error) { return nil, nil })
+}
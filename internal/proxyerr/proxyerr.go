@@ -0,0 +1,157 @@
+// Package proxyerr describes why a request through the pool failed: the
+// nodes tried, a stable error class and a hint on when to retry. Entries
+// that answer HTTP clients themselves put it in their 502 responses, so
+// scrapers can decide whether to retry without parsing log files.
+package proxyerr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"easy_proxies/internal/redact"
+	"easy_proxies/internal/users"
+)
+
+// Error classes, stable across releases.
+const (
+	ClassNoNode    = "no_node"        // no healthy node matches the request
+	ClassNodeBusy  = "node_busy"      // every node is at its connection limit
+	ClassUserLimit = "user_limit"     // a per-user or per-client limit was hit
+	ClassQuota     = "quota_exceeded" // the user's traffic quota is used up
+	ClassDNS       = "dns"            // the target name did not resolve
+	ClassTimeout   = "timeout"        // the node or the target did not answer in time
+	ClassRefused   = "refused"        // the connection was refused
+	ClassReset     = "reset"          // the connection was torn down
+	ClassTLS       = "tls"            // a TLS handshake with the node failed
+	ClassCanceled  = "canceled"       // the client went away
+	ClassUpstream  = "upstream"       // any other failure of the node
+)
+
+// Error is a dial through the pool that failed for good.
+type Error struct {
+	Nodes      []string      // tags of the nodes tried, in order
+	Class      string        // one of the Class constants
+	RetryAfter time.Duration // 0 when retrying will not help soon
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New wraps err, classifying it when class is empty.
+func New(err error, nodes []string, class string) *Error {
+	if class == "" {
+		class = Classify(err)
+	}
+	return &Error{Nodes: nodes, Class: class, RetryAfter: retryAfter(class), Err: err}
+}
+
+// Classify maps an error to its class.
+func Classify(err error) string {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Class
+	case errors.Is(err, users.ErrQuotaExceeded):
+		return ClassQuota
+	case errors.Is(err, users.ErrConnectionLimit), errors.Is(err, users.ErrClientLimit), errors.Is(err, users.ErrRateLimited):
+		return ClassUserLimit
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ClassDNS
+	}
+	s := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(s, "timeout") || strings.Contains(s, "deadline exceeded"):
+		return ClassTimeout
+	case strings.Contains(s, "connection refused"):
+		return ClassRefused
+	case strings.Contains(s, "tls:") || strings.Contains(s, "certificate") || strings.Contains(s, "handshake"):
+		return ClassTLS
+	case strings.Contains(s, "reset") || strings.Contains(s, "eof") || strings.Contains(s, "broken pipe"):
+		return ClassReset
+	}
+	return ClassUpstream
+}
+
+// retryAfter is the retry hint of a class. Nodes left out of rotation are
+// probed again by the health check, so no_node asks for a longer pause.
+func retryAfter(class string) time.Duration {
+	switch class {
+	case ClassNoNode:
+		return 30 * time.Second
+	case ClassDNS:
+		return 5 * time.Second
+	case ClassQuota, ClassCanceled:
+		return 0
+	}
+	return time.Second
+}
+
+// Detail is the JSON body of a 502 with error detail.
+type Detail struct {
+	Error      string   `json:"error"`
+	Class      string   `json:"class"`
+	NodesTried []string `json:"nodes_tried"`
+	RetryAfter int      `json:"retry_after,omitempty"` // seconds
+}
+
+// DetailOf describes err. Errors that did not come from the pool get a
+// class but no nodes.
+func DetailOf(err error) Detail {
+	d := Detail{Error: redact.Text(err.Error()), NodesTried: []string{}}
+	var e *Error
+	if errors.As(err, &e) {
+		d.Class = e.Class
+		d.NodesTried = append(d.NodesTried, e.Nodes...)
+		d.RetryAfter = seconds(e.RetryAfter)
+	} else {
+		d.Class = Classify(err)
+		d.RetryAfter = seconds(retryAfter(d.Class))
+	}
+	return d
+}
+
+// Header sets the detail headers of err on h: X-Proxy-Error (the class),
+// X-Proxy-Nodes-Tried and Retry-After.
+func Header(h http.Header, err error) {
+	d := DetailOf(err)
+	h.Set("X-Proxy-Error", d.Class)
+	if len(d.NodesTried) > 0 {
+		h.Set("X-Proxy-Nodes-Tried", strings.Join(d.NodesTried, ","))
+	}
+	if d.RetryAfter > 0 {
+		h.Set("Retry-After", strconv.Itoa(d.RetryAfter))
+	}
+}
+
+// Body returns the JSON body describing err.
+func Body(err error) []byte {
+	body, _ := json.Marshal(DetailOf(err))
+	return append(body, '\n')
+}
+
+// WriteBadGateway answers w with a 502 carrying the detail of err.
+func WriteBadGateway(w http.ResponseWriter, err error) {
+	Header(w.Header(), err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = w.Write(Body(err))
+}
+
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
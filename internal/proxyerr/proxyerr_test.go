@@ -0,0 +1,71 @@
+package proxyerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"easy_proxies/internal/users"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("acquire: %w", users.ErrQuotaExceeded), ClassQuota},
+		{users.ErrConnectionLimit, ClassUserLimit},
+		{users.ErrRateLimited, ClassUserLimit},
+		{context.Canceled, ClassCanceled},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, ClassDNS},
+		{errors.New("dial tcp 203.0.113.1:443: i/o timeout"), ClassTimeout},
+		{errors.New("dial tcp 203.0.113.1:443: connect: connection refused"), ClassRefused},
+		{errors.New("read: connection reset by peer"), ClassReset},
+		{errors.New("tls: handshake failure"), ClassTLS},
+		{errors.New("something else"), ClassUpstream},
+		{fmt.Errorf("wrapped: %w", New(errors.New("x"), nil, ClassNoNode)), ClassNoNode},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteBadGateway(t *testing.T) {
+	err := New(errors.New("no healthy proxy available"), []string{"us-1"}, ClassNoNode)
+	rec := httptest.NewRecorder()
+	WriteBadGateway(rec, fmt.Errorf("connect: %w", err))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Proxy-Error"); got != ClassNoNode {
+		t.Errorf("X-Proxy-Error = %q", got)
+	}
+	if got := rec.Header().Get("X-Proxy-Nodes-Tried"); got != "us-1" {
+		t.Errorf("X-Proxy-Nodes-Tried = %q", got)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	want := `{"error":"connect: no healthy proxy available","class":"no_node","nodes_tried":["us-1"],"retry_after":30}` + "\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+func TestQuotaHasNoRetryHint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteBadGateway(rec, New(users.ErrQuotaExceeded, nil, ""))
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q, want none", got)
+	}
+	if got := rec.Header().Get("X-Proxy-Error"); got != ClassQuota {
+		t.Errorf("X-Proxy-Error = %q", got)
+	}
+}
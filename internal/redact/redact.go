@@ -0,0 +1,178 @@
+// Package redact masks credentials before they reach logs, status APIs and
+// exports. Masking is on by default; the -show-secrets flag turns it off
+// process-wide for debugging.
+package redact
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces every redacted value.
+const Mask = "******"
+
+var showSecrets atomic.Bool
+
+// SetShowSecrets disables (true) or enables (false) redaction globally.
+func SetShowSecrets(show bool) {
+	showSecrets.Store(show)
+}
+
+// ShowSecrets reports whether redaction is disabled.
+func ShowSecrets() bool {
+	return showSecrets.Load()
+}
+
+// sensitiveParams lists query keys whose values are credentials in the
+// share-link formats we accept.
+var sensitiveParams = map[string]bool{
+	"password":      true,
+	"passwd":        true,
+	"pass":          true,
+	"obfs-password": true,
+	"obfsparam":     true,
+	"auth":          true,
+	"auth_str":      true,
+	"token":         true,
+	"key":           true,
+	"secret":        true,
+	"uuid":          true,
+}
+
+// plainUserSchemes are schemes where the userinfo username is an ordinary
+// login name; only the password is masked. For every other scheme the
+// username itself is the secret (vless/vmess UUID, trojan/hy2 password...).
+var plainUserSchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"socks":   true,
+	"socks5":  true,
+	"socks5h": true,
+}
+
+// opaqueSchemes carry their whole payload base64-encoded, credentials
+// included, so the payload is masked as a unit.
+var opaqueSchemes = map[string]bool{
+	"vmess": true,
+	"ssr":   true,
+}
+
+// Secret masks a single secret value. Empty values stay empty so callers can
+// still tell "unset" from "set".
+func Secret(value string) string {
+	if value == "" || ShowSecrets() {
+		return value
+	}
+	return Mask
+}
+
+// URI masks credentials inside a proxy URI while keeping scheme, host, port
+// and the node name fragment readable.
+func URI(raw string) string {
+	if raw == "" || ShowSecrets() {
+		return raw
+	}
+	schemeEnd := strings.Index(raw, "://")
+	if schemeEnd <= 0 {
+		return raw
+	}
+	scheme := strings.ToLower(raw[:schemeEnd])
+	rest := raw[schemeEnd+3:]
+
+	fragment := ""
+	if idx := strings.Index(rest, "#"); idx >= 0 {
+		fragment = rest[idx:]
+		rest = rest[:idx]
+	}
+
+	if opaqueSchemes[scheme] && !strings.Contains(rest, "@") {
+		return raw[:schemeEnd] + "://" + Mask + fragment
+	}
+
+	rawQuery := ""
+	if idx := strings.Index(rest, "?"); idx >= 0 {
+		rawQuery = rest[idx+1:]
+		rest = rest[:idx]
+	}
+
+	authority := rest
+	path := ""
+	if idx := strings.Index(rest, "/"); idx >= 0 {
+		authority = rest[:idx]
+		path = rest[idx:]
+	}
+
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		userinfo := authority[:at]
+		host := authority[at+1:]
+		if plainUserSchemes[scheme] {
+			if user, _, hasPassword := strings.Cut(userinfo, ":"); hasPassword {
+				userinfo = user + ":" + Mask
+			}
+		} else {
+			userinfo = Mask
+		}
+		authority = userinfo + "@" + host
+	} else if scheme == "ss" || scheme == "shadowsocks" {
+		// Legacy ss://base64(method:password@host:port) hides everything.
+		authority = Mask
+	}
+
+	out := raw[:schemeEnd] + "://" + authority + path
+	if rawQuery != "" {
+		out += "?" + redactQuery(rawQuery)
+	}
+	return out + fragment
+}
+
+func redactQuery(rawQuery string) string {
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		key, _, hasValue := strings.Cut(part, "=")
+		if !hasValue {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if sensitiveParams[strings.ToLower(name)] {
+			parts[i] = key + "=" + Mask
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+var uriPattern = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://[^\s"'<>]+`)
+
+// Text masks every URI embedded in free-form text such as a log line.
+func Text(s string) string {
+	if ShowSecrets() || !strings.Contains(s, "://") {
+		return s
+	}
+	return uriPattern.ReplaceAllStringFunc(s, URI)
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Writer wraps w so everything written through it passes through Text.
+// The standard logger issues one Write per line, so URIs are never split.
+func Writer(w io.Writer) io.Writer {
+	return writer{w: w}
+}
+
+func (rw writer) Write(p []byte) (int, error) {
+	if ShowSecrets() {
+		return rw.w.Write(p)
+	}
+	if _, err := rw.w.Write([]byte(Text(string(p)))); err != nil {
+		return 0, err
+	}
+	// Report the caller's length: the masked line may be shorter or longer.
+	return len(p), nil
+}
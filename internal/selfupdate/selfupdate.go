@@ -0,0 +1,273 @@
+// Package selfupdate fetches a release binary from GitHub, checks it against
+// the release's checksum file (and its ed25519 signature when a public key
+// is configured) and swaps it in for the running executable.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRepo is the GitHub repository releases are fetched from.
+const DefaultRepo = "hkxiaoyao/easy_proxies"
+
+// Asset names every release publishes next to the binaries. The checksum
+// file uses the sha256sum format; the signature is the base64 encoded
+// ed25519 signature of that file.
+const (
+	ChecksumsAsset = "checksums.txt"
+	SignatureAsset = "checksums.txt.sig"
+)
+
+// maxBinarySize caps downloads so a broken release cannot fill the disk.
+const maxBinarySize = 512 << 20
+
+// Release is a GitHub release as returned by the releases API.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Updater looks up and downloads releases.
+type Updater struct {
+	Client *http.Client
+	// API is the GitHub API base URL, https://api.github.com when empty.
+	API  string
+	Repo string
+	// PublicKey verifies the signature of the checksum file. When nil only
+	// the checksum is checked, which guards against corrupted downloads but
+	// not against a tampered release.
+	PublicKey ed25519.PublicKey
+}
+
+// Release returns the release tagged tag, or the latest one when tag is "".
+func (u *Updater) Release(ctx context.Context, tag string) (Release, error) {
+	api := u.API
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	repo := u.Repo
+	if repo == "" {
+		repo = DefaultRepo
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimRight(api, "/"), repo)
+	if tag != "" {
+		endpoint = fmt.Sprintf("%s/repos/%s/releases/tags/%s", strings.TrimRight(api, "/"), repo, tag)
+	}
+	body, err := u.get(ctx, endpoint, 1<<20)
+	if err != nil {
+		return Release{}, err
+	}
+	var rel Release
+	if err := json.Unmarshal(body, &rel); err != nil {
+		return Release{}, fmt.Errorf("decode release: %w", err)
+	}
+	if rel.Tag == "" {
+		return Release{}, errors.New("release has no tag")
+	}
+	return rel, nil
+}
+
+// AssetName is the name of the release binary for goos/goarch.
+func AssetName(goos, goarch string) string {
+	name := "easy_proxies_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Download fetches the binary for goos/goarch from rel and verifies it.
+func (u *Updater) Download(ctx context.Context, rel Release, goos, goarch string) ([]byte, error) {
+	name := AssetName(goos, goarch)
+	binary, ok := rel.asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no binary for %s/%s (%s)", rel.Tag, goos, goarch, name)
+	}
+	checksums, ok := rel.asset(ChecksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", rel.Tag, ChecksumsAsset)
+	}
+	sums, err := u.get(ctx, checksums.URL, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	if u.PublicKey != nil {
+		sigAsset, ok := rel.asset(SignatureAsset)
+		if !ok {
+			return nil, fmt.Errorf("release %s is not signed (no %s)", rel.Tag, SignatureAsset)
+		}
+		sig, err := u.get(ctx, sigAsset.URL, 1<<10)
+		if err != nil {
+			return nil, err
+		}
+		sig, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil || !ed25519.Verify(u.PublicKey, sums, sig) {
+			return nil, fmt.Errorf("bad signature on %s of release %s", ChecksumsAsset, rel.Tag)
+		}
+	}
+	want, err := checksumOf(sums, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := u.get(ctx, binary.URL, maxBinarySize)
+	if err != nil {
+		return nil, err
+	}
+	if got := sha256.Sum256(data); !bytes.Equal(got[:], want) {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %x, want %x", name, got, want)
+	}
+	return data, nil
+}
+
+func (r Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// checksumOf finds name in a sha256sum listing.
+func checksumOf(sums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("malformed checksum for %s", name)
+		}
+		return sum, nil
+	}
+	return nil, fmt.Errorf("%s lists no checksum for %s", ChecksumsAsset, name)
+}
+
+func (u *Updater) get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// Replace swaps binary in for the executable at exe. The previous binary is
+// kept as exe+".old" for a manual rollback. Renaming rather than writing in
+// place lets a running process keep its image, also on Windows.
+func Replace(exe string, binary []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".easy_proxies-upgrade-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return fmt.Errorf("%w (restoring %s also failed: %v)", err, exe, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Newer reports whether release tag latest is newer than current. Both are
+// "v"-prefixed dotted versions; a current version that does not parse (a
+// development build) is never considered up to date.
+func Newer(current, latest string) bool {
+	cur, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+	next, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	for i := range cur {
+		if next[i] != cur[i] {
+			return next[i] > cur[i]
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
@@ -0,0 +1,130 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeGitHub serves a release with a binary for linux/amd64.
+func fakeGitHub(t *testing.T, binary []byte, sign ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	name := AssetName("linux", "amd64")
+	sums := fmt.Sprintf("%x  %s\n%x  %s\n", sha256.Sum256([]byte("other")), AssetName("darwin", "arm64"), sha256.Sum256(binary), name)
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/repos/o/r/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		assets := fmt.Sprintf(`{"name":%q,"browser_download_url":"%s/dl/bin"},{"name":"checksums.txt","browser_download_url":"%s/dl/sums"}`, name, srv.URL, srv.URL)
+		if sign != nil {
+			assets += fmt.Sprintf(`,{"name":"checksums.txt.sig","browser_download_url":"%s/dl/sig"}`, srv.URL)
+		}
+		fmt.Fprintf(w, `{"tag_name":"v1.3.0","assets":[%s]}`, assets)
+	})
+	mux.HandleFunc("/dl/bin", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(binary) })
+	mux.HandleFunc("/dl/sums", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(sums)) })
+	mux.HandleFunc("/dl/sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(sign, []byte(sums))) + "\n"))
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadVerifies(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	srv := fakeGitHub(t, []byte("new binary"), priv)
+	u := &Updater{API: srv.URL, Repo: "o/r", PublicKey: pub}
+	ctx := context.Background()
+
+	rel, err := u.Release(ctx, "")
+	if err != nil || rel.Tag != "v1.3.0" {
+		t.Fatalf("release: %+v, %v", rel, err)
+	}
+	data, err := u.Download(ctx, rel, "linux", "amd64")
+	if err != nil || string(data) != "new binary" {
+		t.Fatalf("download: %q, %v", data, err)
+	}
+	if _, err := u.Download(ctx, rel, "plan9", "386"); err == nil {
+		t.Fatal("expected an error for a platform without a binary")
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	u.PublicKey = otherPub
+	if _, err := u.Download(ctx, rel, "linux", "amd64"); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("expected a signature error, got %v", err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	srv := fakeGitHub(t, []byte("new binary"), nil)
+	u := &Updater{API: srv.URL, Repo: "o/r"}
+	rel, err := u.Release(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rel.Assets {
+		if rel.Assets[i].Name == ChecksumsAsset {
+			// Point the checksums at a listing without our binary.
+			rel.Assets[i].URL = srv.URL + "/dl/bin"
+		}
+	}
+	if _, err := u.Download(context.Background(), rel, "linux", "amd64"); err == nil {
+		t.Fatal("expected an error when the binary is not listed")
+	}
+
+	// A signing key requires a signature.
+	pub, _, _ := ed25519.GenerateKey(nil)
+	u.PublicKey = pub
+	rel, _ = u.Release(context.Background(), "")
+	if _, err := u.Download(context.Background(), rel, "linux", "amd64"); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("expected an unsigned release to be refused, got %v", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "easy_proxies")
+	if err := os.WriteFile(exe, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Replace(exe, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "new" {
+		t.Fatalf("exe = %q", got)
+	}
+	if got, _ := os.ReadFile(exe + ".old"); string(got) != "old" {
+		t.Fatalf("backup = %q", got)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm()&0o100 == 0 {
+		t.Fatalf("new binary is not executable: %v", info.Mode())
+	}
+}
+
+func TestNewer(t *testing.T) {
+	cases := []struct {
+		current, latest string
+		want            bool
+	}{
+		{"v1.2.3", "v1.2.4", true},
+		{"v1.2.3", "v1.10.0", true},
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.3.0", "v1.2.9", false},
+		{"v1.2", "v1.2.1", true},
+		{"v1.2.3-rc1", "v1.2.3", false},
+		{"dev", "v1.0.0", true},
+		{"v1.0.0", "nightly", false},
+	}
+	for _, tc := range cases {
+		if got := Newer(tc.current, tc.latest); got != tc.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tc.current, tc.latest, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+// Package simulate replays recorded connections against a pool policy to
+// show how node selection and blacklisting would have played out. It backs
+// "easy_proxies simulate".
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"easy_proxies/internal/config"
+)
+
+// Record is one line of the connection history written by the JSON access
+// log or GET /api/connections/export.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Node       string    `json:"node"`
+	NodeName   string    `json:"node_name"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+func (r Record) ok() bool {
+	return r.Result != "error"
+}
+
+// ReadJSONL reads a connection history, one JSON record per line, and
+// returns it ordered by time. Blank lines are skipped.
+func ReadJSONL(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// Policy is the part of the pool config that decides selection and
+// blacklisting.
+type Policy struct {
+	Mode              string                      `json:"mode"`
+	FailureThreshold  int                         `json:"failure_threshold"`
+	BlacklistDuration time.Duration               `json:"blacklist_duration"`
+	RetryAttempts     int                         `json:"retry_attempts"`
+	CircuitBreaker    config.CircuitBreakerConfig `json:"circuit_breaker"`
+	Weights           map[string]int              `json:"-"` // by node name
+}
+
+// PolicyOf returns the pool policy of a loaded config.
+func PolicyOf(cfg *config.Config) Policy {
+	p := Policy{
+		Mode:              cfg.Pool.Mode,
+		FailureThreshold:  cfg.Pool.FailureThreshold,
+		BlacklistDuration: cfg.Pool.BlacklistDuration,
+		RetryAttempts:     cfg.Pool.RetryAttempts,
+		CircuitBreaker:    cfg.Pool.CircuitBreaker,
+		Weights:           make(map[string]int),
+	}
+	if !cfg.Pool.RetryEnabledOrDefault() {
+		p.RetryAttempts = 1
+	}
+	for _, node := range cfg.Nodes {
+		if node.Weight > 0 {
+			p.Weights[node.Name] = node.Weight
+		}
+	}
+	return p
+}
+
+// Result is the outcome of replaying the history under one policy.
+type Result struct {
+	Policy   *Policy `json:"policy,omitempty"` // nil for the recorded run
+	Requests int     `json:"requests"`
+	Failures int     `json:"failures"` // requests whose every attempt failed
+	Attempts int     `json:"attempts"`
+	// Unknown counts attempts on a node with no record near that time,
+	// which are assumed to succeed.
+	Unknown int `json:"unknown"`
+	// Blacklistings counts nodes blacklisted or circuits opened.
+	Blacklistings int `json:"blacklistings"`
+	// BlacklistedTime sums how long nodes spent blacklisted or open.
+	BlacklistedTime time.Duration `json:"blacklisted_time"`
+	// Picks is the number of requests each node served (last attempt).
+	Picks map[string]int `json:"picks"`
+	first []string
+}
+
+// Report compares the recorded history with both policies.
+type Report struct {
+	Records   int       `json:"records"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Recorded  Result    `json:"recorded"`
+	Current   Result    `json:"current"`
+	Candidate Result    `json:"candidate"`
+	Changed   int       `json:"changed"` // requests whose first pick differs between current and candidate
+}
+
+// Options tunes the replay.
+type Options struct {
+	// Window is how far from an attempt a record of the same node may be to
+	// stand for its outcome.
+	Window time.Duration
+	// Seed makes random mode reproducible.
+	Seed int64
+}
+
+// Run replays records, ordered by time, under the current and candidate
+// policies. A node's outcome at a given time is taken from its closest
+// record within Options.Window. Latency mode ranks nodes by the mean
+// duration of their successful connections so far, since the history has
+// no probe latencies.
+func Run(records []Record, current, candidate Policy, opts Options) Report {
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	o := newOracle(records)
+	report := Report{Records: len(records)}
+	if len(records) > 0 {
+		report.From = records[0].Time
+		report.To = records[len(records)-1].Time
+	}
+	report.Recorded = Result{Picks: make(map[string]int)}
+	for _, rec := range records {
+		report.Recorded.Requests++
+		report.Recorded.Attempts++
+		if !rec.ok() {
+			report.Recorded.Failures++
+		}
+		if rec.Node != "" {
+			report.Recorded.Picks[rec.Node]++
+		}
+	}
+	report.Current = replay(records, o, current, opts)
+	report.Candidate = replay(records, o, candidate, opts)
+	for i := range report.Current.first {
+		if report.Current.first[i] != report.Candidate.first[i] {
+			report.Changed++
+		}
+	}
+	return report
+}
+
+// outcome is a recorded result of a node at a time.
+type outcome struct {
+	at time.Time
+	ok bool
+}
+
+// oracle answers what happened to a node around a given time.
+type oracle struct {
+	order    []string // nodes in order of first appearance
+	names    map[string]string
+	outcomes map[string][]outcome
+}
+
+func newOracle(records []Record) *oracle {
+	o := &oracle{names: make(map[string]string), outcomes: make(map[string][]outcome)}
+	for _, rec := range records {
+		if rec.Node == "" {
+			continue
+		}
+		if _, seen := o.outcomes[rec.Node]; !seen {
+			o.order = append(o.order, rec.Node)
+			o.names[rec.Node] = rec.NodeName
+		}
+		o.outcomes[rec.Node] = append(o.outcomes[rec.Node], outcome{at: rec.Time, ok: rec.ok()})
+	}
+	return o
+}
+
+// lookup returns the outcome of node closest to at, and false when there
+// is none within window.
+func (o *oracle) lookup(node string, at time.Time, window time.Duration) (bool, bool) {
+	list := o.outcomes[node]
+	i := sort.Search(len(list), func(i int) bool { return !list[i].at.Before(at) })
+	best, found := outcome{}, false
+	bestGap := window + 1
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(list) {
+			continue
+		}
+		gap := list[j].at.Sub(at)
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap <= window && gap < bestGap {
+			best, found, bestGap = list[j], true, gap
+		}
+	}
+	return best.ok, found
+}
+
+type simNode struct {
+	key, name     string
+	weight        int
+	currentWeight int
+	failures      int
+	until         time.Time
+	blacklisted   bool
+	openInterval  time.Duration
+	halfOpen      bool
+	active        []time.Time // end times of connections in flight
+	okTotal       time.Duration
+	okCount       int64
+}
+
+type simulator struct {
+	policy Policy
+	nodes  []*simNode
+	rr     int
+	rng    *rand.Rand
+	result *Result
+}
+
+func replay(records []Record, o *oracle, policy Policy, opts Options) Result {
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = 1
+	}
+	if policy.RetryAttempts <= 0 {
+		policy.RetryAttempts = 1
+	}
+	result := Result{Policy: &policy, Picks: make(map[string]int), first: make([]string, len(records))}
+	s := &simulator{policy: policy, rng: rand.New(rand.NewSource(opts.Seed)), result: &result}
+	for _, key := range o.order {
+		name := o.names[key]
+		s.nodes = append(s.nodes, &simNode{key: key, name: name, weight: policy.Weights[name]})
+	}
+	if len(s.nodes) == 0 {
+		result.Requests = len(records)
+		result.Failures = len(records)
+		return result
+	}
+
+	for i, rec := range records {
+		now := rec.Time
+		result.Requests++
+		tried := make(map[string]bool)
+		ok := false
+		for attempt := 1; attempt <= policy.RetryAttempts; attempt++ {
+			n := s.pick(now, tried)
+			if n == nil {
+				break
+			}
+			if attempt == 1 {
+				result.first[i] = n.key
+			}
+			result.Attempts++
+			success, known := o.lookup(n.key, now, opts.Window)
+			if !known {
+				result.Unknown++
+				success = true
+			}
+			if success {
+				s.succeed(n, now, time.Duration(rec.DurationMS)*time.Millisecond)
+				result.Picks[n.key]++
+				ok = true
+				break
+			}
+			s.fail(n, now)
+			tried[n.key] = true
+			if attempt == policy.RetryAttempts {
+				result.Picks[n.key]++
+			}
+		}
+		if !ok {
+			result.Failures++
+		}
+	}
+	if len(records) > 0 {
+		end := records[len(records)-1].Time
+		for _, n := range s.nodes {
+			if n.blacklisted && n.until.After(end) {
+				// Count only the part of an open blacklist inside the history.
+				result.BlacklistedTime -= n.until.Sub(end)
+			}
+		}
+	}
+	return result
+}
+
+// pick chooses a node like the pool does: blacklisted nodes are skipped
+// (all of them are released when nothing else is left), then the policy's
+// mode decides among the rest, preferring nodes not tried yet.
+func (s *simulator) pick(now time.Time, tried map[string]bool) *simNode {
+	candidates := s.available(now, tried)
+	if len(candidates) == 0 {
+		for _, n := range s.nodes {
+			s.release(n, now)
+		}
+		candidates = s.available(now, tried)
+	}
+
+	switch s.policy.Mode {
+	case "random":
+		return candidates[s.rng.Intn(len(candidates))]
+	case "balance":
+		var selected *simNode
+		for _, n := range candidates {
+			if selected == nil || n.activeAt(now) < selected.activeAt(now) {
+				selected = n
+			}
+		}
+		return selected
+	case "latency":
+		var selected *simNode
+		for _, n := range candidates {
+			if n.okCount == 0 {
+				continue
+			}
+			if selected == nil || n.meanDuration() < selected.meanDuration() {
+				selected = n
+			}
+		}
+		if selected != nil {
+			return selected
+		}
+	case "weighted":
+		var selected *simNode
+		total := 0
+		for _, n := range candidates {
+			weight := max(n.weight, 1)
+			n.currentWeight += weight
+			total += weight
+			if selected == nil || n.currentWeight > selected.currentWeight {
+				selected = n
+			}
+		}
+		selected.currentWeight -= total
+		return selected
+	}
+	selected := candidates[s.rr%len(candidates)]
+	s.rr++
+	return selected
+}
+
+func (s *simulator) available(now time.Time, tried map[string]bool) []*simNode {
+	var all, untried []*simNode
+	for _, n := range s.nodes {
+		if n.blacklisted && now.After(n.until) {
+			n.blacklisted = false
+			n.halfOpen = n.openInterval > 0
+		}
+		if n.blacklisted {
+			continue
+		}
+		all = append(all, n)
+		if !tried[n.key] {
+			untried = append(untried, n)
+		}
+	}
+	if len(untried) > 0 {
+		return untried
+	}
+	return all
+}
+
+func (s *simulator) succeed(n *simNode, now time.Time, duration time.Duration) {
+	n.failures = 0
+	n.halfOpen = false
+	n.openInterval = 0
+	n.active = append(n.active, now.Add(duration))
+	n.okTotal += duration
+	n.okCount++
+}
+
+func (s *simulator) fail(n *simNode, now time.Time) {
+	n.failures++
+	var wait time.Duration
+	cb := s.policy.CircuitBreaker
+	switch {
+	case cb.Enabled && n.halfOpen:
+		n.openInterval = min(max(n.openInterval*2, cb.HalfOpenInterval), cb.MaxHalfOpenInterval)
+		wait = n.openInterval
+	case n.failures < s.policy.FailureThreshold:
+		return
+	case cb.Enabled:
+		n.openInterval = cb.HalfOpenInterval
+		wait = n.openInterval
+	default:
+		wait = s.policy.BlacklistDuration
+	}
+	n.halfOpen = false
+	n.failures = 0
+	n.blacklisted = true
+	n.until = now.Add(wait)
+	s.result.Blacklistings++
+	s.result.BlacklistedTime += wait
+}
+
+// release ends a blacklist early, taking the unused part off the total.
+func (s *simulator) release(n *simNode, now time.Time) {
+	if !n.blacklisted {
+		return
+	}
+	if n.until.After(now) {
+		s.result.BlacklistedTime -= n.until.Sub(now)
+	}
+	n.blacklisted = false
+	n.halfOpen = false
+	n.openInterval = 0
+	n.failures = 0
+}
+
+func (n *simNode) activeAt(now time.Time) int {
+	kept := n.active[:0]
+	for _, end := range n.active {
+		if end.After(now) {
+			kept = append(kept, end)
+		}
+	}
+	n.active = kept
+	return len(kept)
+}
+
+func (n *simNode) meanDuration() time.Duration {
+	return n.okTotal / time.Duration(n.okCount)
+}
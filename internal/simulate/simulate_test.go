@@ -0,0 +1,124 @@
+package simulate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"easy_proxies/internal/config"
+)
+
+var t0 = time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// history has node a failing for ten minutes while b stays healthy; the
+// recorded run used a alone.
+func history() []Record {
+	var records []Record
+	for i := 0; i < 30; i++ {
+		at := t0.Add(time.Duration(i) * time.Minute)
+		result := "ok"
+		if i >= 5 && i < 15 {
+			result = "error"
+		}
+		records = append(records, Record{Time: at, Node: "a", NodeName: "A", Result: result, DurationMS: 100})
+		records = append(records, Record{Time: at.Add(time.Second), Node: "b", NodeName: "B", Result: "ok", DurationMS: 300})
+	}
+	return records
+}
+
+func TestReadJSONL(t *testing.T) {
+	input := `{"time":"2026-03-01T10:01:00Z","node":"b","result":"ok","duration_ms":50}
+
+{"time":"2026-03-01T10:00:00Z","node":"a","node_name":"A","result":"error","error":"refused"}
+`
+	records, err := ReadJSONL(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Node != "a" || records[1].DurationMS != 50 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if _, err := ReadJSONL(strings.NewReader("{not json}\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected a line error, got %v", err)
+	}
+}
+
+func TestShortBlacklistRecoversSooner(t *testing.T) {
+	base := Policy{Mode: "latency", FailureThreshold: 1, BlacklistDuration: 24 * time.Hour, RetryAttempts: 1}
+	candidate := base
+	candidate.BlacklistDuration = 5 * time.Minute
+
+	report := Run(history(), base, candidate, Options{Window: 30 * time.Second})
+	if report.Records != 60 || report.Recorded.Failures != 10 {
+		t.Fatalf("unexpected recorded totals %+v", report.Recorded)
+	}
+	// Latency mode prefers a (100ms); once it fails the 24h blacklist keeps
+	// everything on b, while a 5m blacklist lets a back in.
+	if got := report.Current.Picks["a"]; got >= report.Candidate.Picks["a"] {
+		t.Fatalf("expected the candidate to use a more (current %d, candidate %d)", got, report.Candidate.Picks["a"])
+	}
+	if report.Current.Blacklistings != 1 || report.Candidate.Blacklistings < 2 {
+		t.Fatalf("blacklistings current=%d candidate=%d", report.Current.Blacklistings, report.Candidate.Blacklistings)
+	}
+	if report.Changed == 0 {
+		t.Fatal("expected some requests to pick a different node")
+	}
+	if report.Current.BlacklistedTime > report.To.Sub(report.From) {
+		t.Fatalf("blacklisted time %s should be clipped to the history", report.Current.BlacklistedTime)
+	}
+}
+
+func TestRetryAvoidsFailures(t *testing.T) {
+	noRetry := Policy{Mode: "sequential", FailureThreshold: 100, RetryAttempts: 1}
+	retry := noRetry
+	retry.RetryAttempts = 2
+
+	report := Run(history(), noRetry, retry, Options{Window: 30 * time.Second})
+	if report.Current.Failures == 0 {
+		t.Fatal("without retries some requests should fail on a")
+	}
+	if report.Candidate.Failures != 0 {
+		t.Fatalf("with a retry on b nothing should fail, got %d", report.Candidate.Failures)
+	}
+}
+
+func TestCircuitBreakerTrials(t *testing.T) {
+	fixed := Policy{Mode: "latency", FailureThreshold: 1, BlacklistDuration: time.Hour, RetryAttempts: 2}
+	breaker := fixed
+	breaker.CircuitBreaker = config.CircuitBreakerConfig{Enabled: true, HalfOpenInterval: time.Minute, MaxHalfOpenInterval: 4 * time.Minute}
+
+	report := Run(history(), fixed, breaker, Options{Window: 30 * time.Second})
+	if report.Candidate.Picks["a"] <= report.Current.Picks["a"] {
+		t.Fatalf("breaker should return to a after it recovers (fixed %d, breaker %d)", report.Current.Picks["a"], report.Candidate.Picks["a"])
+	}
+	if report.Candidate.Failures != 0 {
+		t.Fatalf("failed trials should be retried on b, got %d failures", report.Candidate.Failures)
+	}
+}
+
+func TestUnknownOutcomesAreCounted(t *testing.T) {
+	records := []Record{
+		{Time: t0, Node: "a", Result: "ok"},
+		{Time: t0.Add(time.Hour), Node: "a", Result: "ok"},
+		{Time: t0.Add(2 * time.Hour), Node: "b", Result: "ok"},
+	}
+	policy := Policy{Mode: "sequential", RetryAttempts: 1}
+	report := Run(records, policy, policy, Options{Window: time.Minute})
+	// Round-robin sends the second request to b and the third to a, neither
+	// of which has a record that close.
+	if report.Current.Unknown != 2 || report.Current.Failures != 0 {
+		t.Fatalf("expected both cross-node attempts to be unknown, got %d", report.Current.Unknown)
+	}
+}
+
+func TestPolicyOf(t *testing.T) {
+	disabled := false
+	cfg := &config.Config{Nodes: []config.NodeConfig{{Name: "A", Weight: 5}, {Name: "B"}}}
+	cfg.Pool.Mode = "weighted"
+	cfg.Pool.RetryAttempts = 3
+	cfg.Pool.RetryEnabled = &disabled
+	p := PolicyOf(cfg)
+	if p.Mode != "weighted" || p.RetryAttempts != 1 || p.Weights["A"] != 5 || len(p.Weights) != 1 {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+}
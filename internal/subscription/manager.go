@@ -375,6 +375,8 @@ func (m *Manager) doRefresh() {
 
 	// Create new config with updated nodes
 	newCfg := m.createNewConfig(nodes)
+	newCfg.ClearDegraded()
+	newCfg.SaveNodeSnapshot(nodes)
 
 	// Trigger BoxManager reload with port preservation
 	if err := m.boxMgr.ReloadWithPortMap(newCfg, portMap); err != nil {
@@ -562,10 +564,10 @@ func (m *Manager) createNewConfig(nodes []config.NodeConfig) *config.Config {
 		nodes[i].Source = config.NodeSourceSubscription
 	}
 
-	// Preserve inline nodes from base config (nodes defined directly in config.yaml)
+	// Preserve inline and template nodes from base config (nodes defined directly in config.yaml)
 	var inlineNodes []config.NodeConfig
 	for _, node := range m.baseCfg.Nodes {
-		if node.Source == config.NodeSourceInline {
+		if node.Source == config.NodeSourceInline || node.Source == config.NodeSourceTemplate {
 			inlineNodes = append(inlineNodes, node)
 		}
 	}
@@ -0,0 +1,31 @@
+// Package sysproxy points the operating system's proxy settings at the local
+// listener and restores them afterwards. Windows and macOS are supported.
+package sysproxy
+
+import (
+	"errors"
+	"net"
+	"strconv"
+)
+
+// ErrUnsupported is returned on platforms without a system proxy setting
+// this package knows how to change.
+var ErrUnsupported = errors.New("system proxy configuration is not supported on this platform")
+
+// bypassList are destinations that should never go through the proxy.
+var bypassList = []string{"localhost", "127.*", "10.*", "172.16.*", "192.168.*", "*.local", "<local>"}
+
+// Enable sets the system HTTP/HTTPS (and, where supported, SOCKS) proxy to
+// host:port. The returned func restores the settings found before the call.
+func Enable(host string, port uint16) (restore func() error, err error) {
+	return enable(host, port)
+}
+
+// Disable turns the system proxy off.
+func Disable() error {
+	return disable()
+}
+
+func hostPort(host string, port uint16) string {
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
@@ -0,0 +1,179 @@
+//go:build darwin
+
+package sysproxy
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// proxyKinds are the networksetup proxy types we manage; each has
+// -get<kind>, -set<kind> and -set<kind>state verbs.
+var proxyKinds = []string{"webproxy", "securewebproxy", "socksfirewallproxy"}
+
+type proxySetting struct {
+	enabled bool
+	server  string
+	port    int
+}
+
+func enable(host string, port uint16) (func() error, error) {
+	services, err := networkServices()
+	if err != nil {
+		return nil, err
+	}
+	prev := make(map[string]map[string]proxySetting, len(services))
+	prevBypass := make(map[string][]string, len(services))
+	for _, svc := range services {
+		prev[svc] = make(map[string]proxySetting, len(proxyKinds))
+		for _, kind := range proxyKinds {
+			setting, err := getProxy(svc, kind)
+			if err != nil {
+				return nil, err
+			}
+			prev[svc][kind] = setting
+		}
+		domains, err := getBypassDomains(svc)
+		if err != nil {
+			return nil, err
+		}
+		prevBypass[svc] = domains
+	}
+
+	restore := func() error {
+		var firstErr error
+		for svc, kinds := range prev {
+			for kind, setting := range kinds {
+				if err := applyProxy(svc, kind, setting); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+			if err := setBypassDomains(svc, prevBypass[svc]); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	next := proxySetting{enabled: true, server: host, port: int(port)}
+	for _, svc := range services {
+		for _, kind := range proxyKinds {
+			if err := applyProxy(svc, kind, next); err != nil {
+				_ = restore()
+				return nil, err
+			}
+		}
+		if err := setBypassDomains(svc, bypassList[:len(bypassList)-1]); err != nil {
+			_ = restore()
+			return nil, err
+		}
+	}
+	return restore, nil
+}
+
+func disable() error {
+	services, err := networkServices()
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		for _, kind := range proxyKinds {
+			if err := networksetup("-set"+kind+"state", svc, "off"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// networkServices lists enabled network services (disabled ones are
+// prefixed with "*" by networksetup).
+func networkServices() ([]string, error) {
+	out, err := exec.Command("networksetup", "-listallnetworkservices").Output()
+	if err != nil {
+		return nil, fmt.Errorf("list network services: %w", err)
+	}
+	var services []string
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if first || line == "" || strings.HasPrefix(line, "*") {
+			continue // the first line is an explanatory header
+		}
+		services = append(services, line)
+	}
+	return services, nil
+}
+
+func getProxy(svc, kind string) (proxySetting, error) {
+	out, err := exec.Command("networksetup", "-get"+kind, svc).Output()
+	if err != nil {
+		return proxySetting{}, fmt.Errorf("networksetup -get%s %s: %w", kind, svc, err)
+	}
+	var setting proxySetting
+	for _, line := range strings.Split(string(out), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(name) {
+		case "Enabled":
+			setting.enabled = value == "Yes"
+		case "Server":
+			setting.server = value
+		case "Port":
+			setting.port, _ = strconv.Atoi(value)
+		}
+	}
+	return setting, nil
+}
+
+// getBypassDomains returns the bypass domains of svc, none when
+// networksetup reports that there aren't any.
+func getBypassDomains(svc string) ([]string, error) {
+	out, err := exec.Command("networksetup", "-getproxybypassdomains", svc).Output()
+	if err != nil {
+		return nil, fmt.Errorf("networksetup -getproxybypassdomains %s: %w", svc, err)
+	}
+	var domains []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "There aren't any") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, nil
+}
+
+// setBypassDomains replaces the bypass domains of svc; "Empty" clears them.
+func setBypassDomains(svc string, domains []string) error {
+	if len(domains) == 0 {
+		domains = []string{"Empty"}
+	}
+	return networksetup(append([]string{"-setproxybypassdomains", svc}, domains...)...)
+}
+
+func applyProxy(svc, kind string, setting proxySetting) error {
+	if setting.server != "" {
+		if err := networksetup("-set"+kind, svc, setting.server, strconv.Itoa(setting.port)); err != nil {
+			return err
+		}
+	}
+	state := "off"
+	if setting.enabled {
+		state = "on"
+	}
+	return networksetup("-set"+kind+"state", svc, state)
+}
+
+func networksetup(args ...string) error {
+	if out, err := exec.Command("networksetup", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("networksetup %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
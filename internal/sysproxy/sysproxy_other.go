@@ -0,0 +1,11 @@
+//go:build !windows && !darwin
+
+package sysproxy
+
+func enable(string, uint16) (func() error, error) {
+	return nil, ErrUnsupported
+}
+
+func disable() error {
+	return ErrUnsupported
+}
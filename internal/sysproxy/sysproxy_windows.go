@@ -0,0 +1,120 @@
+//go:build windows
+
+package sysproxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// WinINet options that make running applications pick up registry changes.
+const (
+	internetOptionRefresh         = 37
+	internetOptionSettingsChanged = 39
+)
+
+var procInternetSetOption = windows.NewLazySystemDLL("wininet.dll").NewProc("InternetSetOptionW")
+
+type windowsState struct {
+	enable           uint64
+	server, override string
+	hasServer        bool
+	hasOverride      bool
+}
+
+func enable(host string, port uint16) (func() error, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("open internet settings: %w", err)
+	}
+	defer key.Close()
+
+	prev := readState(key)
+	next := windowsState{
+		enable:      1,
+		server:      hostPort(host, port),
+		override:    strings.Join(bypassList, ";"),
+		hasServer:   true,
+		hasOverride: true,
+	}
+	if err := writeState(key, next); err != nil {
+		return nil, err
+	}
+	refresh()
+	return func() error { return restore(prev) }, nil
+}
+
+func disable() error {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open internet settings: %w", err)
+	}
+	defer key.Close()
+	if err := key.SetDWordValue("ProxyEnable", 0); err != nil {
+		return fmt.Errorf("set ProxyEnable: %w", err)
+	}
+	refresh()
+	return nil
+}
+
+func restore(state windowsState) error {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open internet settings: %w", err)
+	}
+	defer key.Close()
+	if err := writeState(key, state); err != nil {
+		return err
+	}
+	refresh()
+	return nil
+}
+
+func readState(key registry.Key) windowsState {
+	var state windowsState
+	state.enable, _, _ = key.GetIntegerValue("ProxyEnable")
+	if v, _, err := key.GetStringValue("ProxyServer"); err == nil {
+		state.server, state.hasServer = v, true
+	}
+	if v, _, err := key.GetStringValue("ProxyOverride"); err == nil {
+		state.override, state.hasOverride = v, true
+	}
+	return state
+}
+
+func writeState(key registry.Key, state windowsState) error {
+	if err := setOrDelete(key, "ProxyServer", state.server, state.hasServer); err != nil {
+		return err
+	}
+	if err := setOrDelete(key, "ProxyOverride", state.override, state.hasOverride); err != nil {
+		return err
+	}
+	if err := key.SetDWordValue("ProxyEnable", uint32(state.enable)); err != nil {
+		return fmt.Errorf("set ProxyEnable: %w", err)
+	}
+	return nil
+}
+
+func setOrDelete(key registry.Key, name, value string, present bool) error {
+	if present {
+		if err := key.SetStringValue(name, value); err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+		return nil
+	}
+	if err := key.DeleteValue(name); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("delete %s: %w", name, err)
+	}
+	return nil
+}
+
+func refresh() {
+	procInternetSetOption.Call(0, internetOptionSettingsChanged, 0, 0)
+	procInternetSetOption.Call(0, internetOptionRefresh, 0, 0)
+}
@@ -0,0 +1,116 @@
+// Package tlsconf builds server TLS configs for the proxy entry and the
+// management API from PEM files, reloading them when they change on disk.
+package tlsconf
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadCheckInterval bounds how often certificate files are stat'ed.
+const reloadCheckInterval = 10 * time.Second
+
+// Pair is a PEM certificate (chain) and its private key.
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// Options selects the certificates a listener serves.
+type Options struct {
+	// Default is served when no other certificate matches the SNI name.
+	Default Pair
+	// SNI holds extra certificates, chosen by the names they cover.
+	SNI []Pair
+	// SelfSigned generates Default when it does not exist yet, for the
+	// given hosts.
+	SelfSigned bool
+	Hosts      []string
+}
+
+// ServerConfig loads the certificates of opts. Certificates are reloaded
+// when a file's modification time changes, so renewals need no restart.
+func ServerConfig(opts Options) (*tls.Config, error) {
+	if opts.Default.CertFile == "" || opts.Default.KeyFile == "" {
+		return nil, errors.New("cert_file and key_file are required")
+	}
+	if opts.SelfSigned {
+		if err := ensureSelfSigned(opts.Default, opts.Hosts); err != nil {
+			return nil, err
+		}
+	}
+	store := &certStore{pairs: append([]Pair{opts.Default}, opts.SNI...)}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: store.getCertificate,
+	}, nil
+}
+
+type certStore struct {
+	mu        sync.Mutex
+	pairs     []Pair
+	certs     []tls.Certificate // certs[0] is the default
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func (s *certStore) load() error {
+	certs := make([]tls.Certificate, len(s.pairs))
+	modTimes := make([]time.Time, len(s.pairs))
+	for i, pair := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate %s: %w", pair.CertFile, err)
+		}
+		certs[i] = cert
+		modTimes[i] = pairModTime(pair)
+	}
+	s.certs, s.modTimes, s.checkedAt = certs, modTimes, time.Now()
+	return nil
+}
+
+// reloadIfChanged re-reads the files when any of them changed. A pair that
+// fails to load keeps serving the previous certificates.
+func (s *certStore) reloadIfChanged() {
+	if time.Since(s.checkedAt) < reloadCheckInterval {
+		return
+	}
+	s.checkedAt = time.Now()
+	for i, pair := range s.pairs {
+		if !pairModTime(pair).Equal(s.modTimes[i]) {
+			_ = s.load()
+			return
+		}
+	}
+}
+
+func (s *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reloadIfChanged()
+	if hello.ServerName != "" {
+		for i := 1; i < len(s.certs); i++ {
+			if hello.SupportsCertificate(&s.certs[i]) == nil {
+				return &s.certs[i], nil
+			}
+		}
+	}
+	return &s.certs[0], nil
+}
+
+func pairModTime(pair Pair) time.Time {
+	var latest time.Time
+	for _, path := range []string{pair.CertFile, pair.KeyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,76 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePair(t *testing.T, dir, name string, hosts ...string) Pair {
+	t.Helper()
+	certPEM, keyPEM, err := generateSelfSigned(hosts, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := Pair{CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+	if err := os.WriteFile(pair.CertFile, certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pair.KeyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func TestServerConfigSelectsBySNI(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := ServerConfig(Options{
+		Default: writePair(t, dir, "default", "proxy.example.com"),
+		SNI:     []Pair{writePair(t, dir, "other", "other.example.org")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"other.example.org": "other.example.org",
+		"proxy.example.com": "proxy.example.com",
+		"unknown.test":      "proxy.example.com",
+		"":                  "proxy.example.com",
+	} {
+		cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: name, SupportedVersions: []uint16{tls.VersionTLS13}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.Leaf == nil || cert.Leaf.DNSNames[0] != want {
+			t.Fatalf("SNI %q got %v, want %s", name, cert.Leaf.DNSNames, want)
+		}
+	}
+}
+
+func TestServerConfigGeneratesSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	pair := Pair{CertFile: filepath.Join(dir, "tls", "listener.crt"), KeyFile: filepath.Join(dir, "tls", "listener.key")}
+	if _, err := ServerConfig(Options{Default: pair, SelfSigned: true, Hosts: []string{"localhost", "127.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(pair.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An existing certificate is reused.
+	if _, err := ServerConfig(Options{Default: pair, SelfSigned: true}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := os.ReadFile(pair.CertFile)
+	if string(first) != string(second) {
+		t.Fatal("self-signed certificate was regenerated")
+	}
+}
+
+func TestServerConfigRequiresFiles(t *testing.T) {
+	if _, err := ServerConfig(Options{}); err == nil {
+		t.Fatal("expected error without cert_file/key_file")
+	}
+}
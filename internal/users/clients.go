@@ -0,0 +1,110 @@
+package users
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrClientLimit is returned when a client IP is at max_conns_per_ip.
+	ErrClientLimit = errors.New("client connection limit reached")
+	// ErrRateLimited is returned when a listener is over
+	// max_new_conns_per_sec.
+	ErrRateLimited = errors.New("listener connection rate exceeded")
+)
+
+// ClientLimits cap connections per client IP and the rate of new
+// connections per listener. Zero means unlimited.
+type ClientLimits struct {
+	// Inbounds are the inbound tags the limits apply to; connections from
+	// other inbounds are not counted.
+	Inbounds     []string
+	MaxPerIP     int
+	NewPerSecond int
+}
+
+type clientLimiter struct {
+	limits  ClientLimits
+	buckets map[string]*bucket // inbound tag -> new connection rate
+	mu      sync.Mutex
+	active  map[netip.Addr]int
+}
+
+var clients atomic.Pointer[clientLimiter]
+
+// ConfigureClients replaces the client limits. Connections admitted under
+// the previous limits are released against the limiter they came from.
+func ConfigureClients(limits ClientLimits) {
+	if len(limits.Inbounds) == 0 || (limits.MaxPerIP <= 0 && limits.NewPerSecond <= 0) {
+		clients.Store(nil)
+		return
+	}
+	l := &clientLimiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket, len(limits.Inbounds)),
+		active:  make(map[netip.Addr]int),
+	}
+	for _, tag := range limits.Inbounds {
+		if limits.NewPerSecond > 0 {
+			l.buckets[tag] = newBucket(int64(limits.NewPerSecond))
+		} else {
+			l.buckets[tag] = nil
+		}
+	}
+	clients.Store(l)
+}
+
+// AcquireClient admits a new connection from client on inbound. The
+// returned release func must be called when the connection ends.
+func AcquireClient(inbound string, client netip.Addr) (release func(), err error) {
+	l := clients.Load()
+	if l == nil {
+		return func() {}, nil
+	}
+	b, limited := l.buckets[inbound]
+	if !limited {
+		return func() {}, nil
+	}
+	if b != nil && !b.allow() {
+		return nil, ErrRateLimited
+	}
+	if l.limits.MaxPerIP <= 0 || !client.IsValid() {
+		return func() {}, nil
+	}
+	client = client.Unmap()
+	l.mu.Lock()
+	if l.active[client] >= l.limits.MaxPerIP {
+		l.mu.Unlock()
+		return nil, ErrClientLimit
+	}
+	l.active[client]++
+	l.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			if l.active[client]--; l.active[client] <= 0 {
+				delete(l.active, client)
+			}
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// Clients returns max_conns_per_ip and the number of open connections of
+// every client IP counted against it. perIP is 0 when it is not limited.
+func Clients() (perIP int, active map[netip.Addr]int) {
+	l := clients.Load()
+	if l == nil || l.limits.MaxPerIP <= 0 {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	active = make(map[netip.Addr]int, len(l.active))
+	for addr, n := range l.active {
+		active[addr] = n
+	}
+	return l.limits.MaxPerIP, active
+}
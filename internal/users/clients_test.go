@@ -0,0 +1,53 @@
+package users
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestAcquireClientPerIP(t *testing.T) {
+	ConfigureClients(ClientLimits{Inbounds: []string{"http-in"}, MaxPerIP: 2})
+	defer ConfigureClients(ClientLimits{})
+
+	ip := netip.MustParseAddr("192.0.2.1")
+	r1, err := AcquireClient("http-in", ip)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if _, err := AcquireClient("http-in", ip); err != nil {
+		t.Fatalf("second acquire: %v", err)
+	}
+	if _, err := AcquireClient("http-in", ip); !errors.Is(err, ErrClientLimit) {
+		t.Fatalf("expected ErrClientLimit, got %v", err)
+	}
+	if _, err := AcquireClient("http-in", netip.MustParseAddr("192.0.2.2")); err != nil {
+		t.Fatalf("other clients must not be limited: %v", err)
+	}
+	if _, err := AcquireClient("in-node", ip); err != nil {
+		t.Fatalf("unlisted inbounds must not be limited: %v", err)
+	}
+	r1()
+	r1() // release is idempotent
+	if _, err := AcquireClient("http-in", netip.MustParseAddr("::ffff:192.0.2.1")); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+func TestAcquireClientRate(t *testing.T) {
+	ConfigureClients(ClientLimits{Inbounds: []string{"http-in", "sticky-in"}, NewPerSecond: 3})
+	defer ConfigureClients(ClientLimits{})
+
+	ip := netip.MustParseAddr("192.0.2.1")
+	for i := 0; i < 3; i++ {
+		if _, err := AcquireClient("http-in", ip); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	if _, err := AcquireClient("http-in", ip); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if _, err := AcquireClient("sticky-in", ip); err != nil {
+		t.Fatalf("each listener has its own rate: %v", err)
+	}
+}
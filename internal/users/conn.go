@@ -0,0 +1,163 @@
+package users
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// WrapConn counts traffic of conn against name and applies the user's rate
+// limit and quota. release (from Acquire) is called on Close. Connections of
+// unknown users are returned with only release attached.
+func WrapConn(c net.Conn, name string, release func()) net.Conn {
+	return &conn{Conn: c, user: lookup(name), release: release}
+}
+
+// WrapPacketConn is WrapConn for packet connections.
+func WrapPacketConn(c net.PacketConn, name string, release func()) net.PacketConn {
+	return &packetConn{PacketConn: c, user: lookup(name), release: release}
+}
+
+type conn struct {
+	net.Conn
+	user    *user
+	release func()
+	once    sync.Once
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	if err := c.user.checkQuota(); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(b)
+	c.user.account(n, false)
+	return n, err
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	if err := c.user.checkQuota(); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(b)
+	c.user.account(n, true)
+	return n, err
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+type packetConn struct {
+	net.PacketConn
+	user    *user
+	release func()
+	once    sync.Once
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if err := c.user.checkQuota(); err != nil {
+		return 0, nil, err
+	}
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	c.user.account(n, false)
+	return n, addr, err
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if err := c.user.checkQuota(); err != nil {
+		return 0, err
+	}
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.user.account(n, true)
+	return n, err
+}
+
+func (c *packetConn) Close() error {
+	err := c.PacketConn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func (u *user) checkQuota() error {
+	if u == nil {
+		return nil
+	}
+	if l := u.limits.Load(); l.Quota > 0 && u.upload.Load()+u.download.Load() >= l.Quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// account records n bytes and blocks as needed to honour the rate limit.
+// Callers pass what was actually transferred, so failed and short writes
+// are not charged.
+func (u *user) account(n int, upload bool) {
+	if u == nil || n <= 0 {
+		return
+	}
+	if upload {
+		u.upload.Add(int64(n))
+	} else {
+		u.download.Add(int64(n))
+	}
+	if b := u.limiter.Load(); b != nil {
+		b.wait(n)
+	}
+}
+
+// bucket is a token bucket with a one-second burst. Callers take tokens
+// first and sleep off any deficit, so large writes are never rejected.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens (bytes) per second
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (b *bucket) setRate(rate int64) {
+	b.mu.Lock()
+	b.rate = float64(rate)
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.mu.Unlock()
+}
+
+func (b *bucket) refillLocked() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+func (b *bucket) wait(n int) {
+	b.mu.Lock()
+	b.refillLocked()
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	rate := b.rate
+	b.mu.Unlock()
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / rate * float64(time.Second)))
+	}
+}
+
+// allow takes one token if available, without waiting.
+func (b *bucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
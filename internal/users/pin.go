@@ -0,0 +1,81 @@
+package users
+
+import (
+	"context"
+	"strings"
+)
+
+// Username suffixes that pin a request, e.g. "alice-node-tokyo1" or
+// "alice-group-jp". A colon cannot be used as the separator because HTTP
+// Basic auth splits username and password at the first colon.
+const (
+	nodePinSep  = "-node-"
+	groupPinSep = "-group-"
+)
+
+// Request headers that pin a request on entries that read HTTP requests
+// themselves. They take precedence over the username suffix and are
+// removed before the request is forwarded.
+const (
+	NodeHeader  = "X-Proxy-Node"
+	GroupHeader = "X-Proxy-Group"
+)
+
+// Pin restricts a single request to one node (by tag or name) or to the
+// nodes of one group.
+type Pin struct {
+	Node  string
+	Group string
+}
+
+// IsZero reports whether p pins nothing.
+func (p Pin) IsZero() bool {
+	return p.Node == "" && p.Group == ""
+}
+
+func (p Pin) String() string {
+	if p.Node != "" {
+		return "node " + p.Node
+	}
+	return "group " + p.Group
+}
+
+type pinKey struct{}
+
+// WithPin tags ctx with a per-request pin for listeners that dial the pool
+// directly.
+func WithPin(ctx context.Context, pin Pin) context.Context {
+	if pin.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, pinKey{}, pin)
+}
+
+// PinFromContext returns the pin set by WithPin.
+func PinFromContext(ctx context.Context) Pin {
+	pin, _ := ctx.Value(pinKey{}).(Pin)
+	return pin
+}
+
+// SplitPinned separates a pinning suffix from username and returns the
+// account name and the pin. Usernames without a suffix are returned as is.
+func SplitPinned(username string) (string, Pin) {
+	if i := strings.Index(username, nodePinSep); i > 0 && i+len(nodePinSep) < len(username) {
+		return username[:i], Pin{Node: username[i+len(nodePinSep):]}
+	}
+	if i := strings.Index(username, groupPinSep); i > 0 && i+len(groupPinSep) < len(username) {
+		return username[:i], Pin{Group: username[i+len(groupPinSep):]}
+	}
+	return username, Pin{}
+}
+
+// PinnedUsername is the inverse of SplitPinned.
+func PinnedUsername(username string, pin Pin) string {
+	switch {
+	case pin.Node != "":
+		return username + nodePinSep + pin.Node
+	case pin.Group != "":
+		return username + groupPinSep + pin.Group
+	}
+	return username
+}
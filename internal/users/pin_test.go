@@ -0,0 +1,40 @@
+package users
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSplitPinned(t *testing.T) {
+	cases := []struct {
+		in   string
+		user string
+		pin  Pin
+	}{
+		{"alice", "alice", Pin{}},
+		{"alice-node-tokyo1", "alice", Pin{Node: "tokyo1"}},
+		{"alice-node-jp-node-2", "alice", Pin{Node: "jp-node-2"}},
+		{"alice-group-jp", "alice", Pin{Group: "jp"}},
+		{"alice-node-", "alice-node-", Pin{}},
+		{"-node-tokyo1", "-node-tokyo1", Pin{}},
+	}
+	for _, tc := range cases {
+		user, pin := SplitPinned(tc.in)
+		if user != tc.user || pin != tc.pin {
+			t.Errorf("SplitPinned(%q) = %q, %+v; want %q, %+v", tc.in, user, pin, tc.user, tc.pin)
+		}
+		if !tc.pin.IsZero() && PinnedUsername(user, pin) != tc.in {
+			t.Errorf("PinnedUsername(%q, %+v) did not round-trip to %q", user, pin, tc.in)
+		}
+	}
+}
+
+func TestPinContext(t *testing.T) {
+	ctx := context.Background()
+	if !PinFromContext(WithPin(ctx, Pin{})).IsZero() {
+		t.Fatal("zero pin should not be stored")
+	}
+	if got := PinFromContext(WithPin(ctx, Pin{Group: "jp"})); got.Group != "jp" {
+		t.Fatalf("unexpected pin %+v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package users
+
+import "strings"
+
+// tagSep separates an opaque connection tag, such as a job ID, from the
+// username: "alice-tag-job42", or "alice-group-jp-tag-job42" after a pin.
+// The tag comes last so SplitTag can run before SplitPinned.
+const tagSep = "-tag-"
+
+// TagHeader is the request header carrying a connection tag on entries
+// that read HTTP requests themselves. It takes precedence over the
+// username suffix and is removed before the request is forwarded.
+const TagHeader = "X-Proxy-Tag"
+
+// MaxTagLen bounds the length of a connection tag.
+const MaxTagLen = 64
+
+// SplitTag separates a tag suffix from username and returns the rest of
+// the username and the cleaned tag. An invalid tag is dropped.
+func SplitTag(username string) (string, string) {
+	if i := strings.LastIndex(username, tagSep); i > 0 && i+len(tagSep) < len(username) {
+		return username[:i], CleanTag(username[i+len(tagSep):])
+	}
+	return username, ""
+}
+
+// TaggedUsername is the inverse of SplitTag.
+func TaggedUsername(username, tag string) string {
+	if tag == "" {
+		return username
+	}
+	return username + tagSep + tag
+}
+
+// CleanTag returns tag trimmed, or "" when it is longer than MaxTagLen or
+// holds characters other than letters, digits and "._:/@-", which keeps
+// tags safe in log lines and headers.
+func CleanTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if len(tag) > MaxTagLen {
+		return ""
+	}
+	for _, r := range tag {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._:/@-", r):
+		default:
+			return ""
+		}
+	}
+	return tag
+}
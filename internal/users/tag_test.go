@@ -0,0 +1,29 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitTag(t *testing.T) {
+	cases := []struct {
+		in, user, tag string
+	}{
+		{"alice", "alice", ""},
+		{"alice-tag-job42", "alice", "job42"},
+		{"alice-group-jp-tag-job-7", "alice-group-jp", "job-7"},
+		{"alice-tag-", "alice-tag-", ""},
+		{"alice-tag-bad tag", "alice", ""},
+		{"alice-tag-" + strings.Repeat("x", MaxTagLen+1), "alice", ""},
+	}
+	for _, tc := range cases {
+		user, tag := SplitTag(tc.in)
+		if user != tc.user || tag != tc.tag {
+			t.Errorf("SplitTag(%q) = %q, %q; want %q, %q", tc.in, user, tag, tc.user, tc.tag)
+		}
+	}
+	user, tag := SplitTag("alice-group-jp-tag-job42")
+	if name, pin := SplitPinned(user); name != "alice" || pin.Group != "jp" || tag != "job42" {
+		t.Errorf("tag after pin: %q %+v %q", name, pin, tag)
+	}
+}
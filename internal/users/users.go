@@ -0,0 +1,206 @@
+// Package users enforces per-user limits on the shared pool entry:
+// concurrent connection caps, bandwidth limits, traffic quotas and the node
+// groups a user's credential tier may use. It also caps connections per
+// client IP and per listener (see ConfigureClients).
+//
+// The registry is process-wide so usage counters survive config reloads;
+// Configure replaces the limits and keeps the counters of users that are
+// still configured.
+package users
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrConnectionLimit is returned when a user is at max_connections.
+	ErrConnectionLimit = errors.New("user connection limit reached")
+	// ErrQuotaExceeded is returned once a user has used up their quota.
+	ErrQuotaExceeded = errors.New("user traffic quota exceeded")
+)
+
+// Limits are the per-user caps. Zero means unlimited.
+type Limits struct {
+	RateLimit      int64 // bytes per second, upload and download combined
+	MaxConnections int
+	Quota          int64 // total bytes
+	// Tier is the credential tier the user belongs to, for display, and
+	// Groups the node groups it may use; empty Groups allows every node.
+	Tier   string
+	Groups []string
+}
+
+// Usage is a point-in-time view of one user's counters and limits.
+type Usage struct {
+	Username       string `json:"username"`
+	Active         int64  `json:"active"`
+	Upload         int64  `json:"upload"`
+	Download       int64  `json:"download"`
+	Rejected       int64  `json:"rejected"`
+	RateLimit      int64  `json:"rate_limit,omitempty"`
+	MaxConnections int    `json:"max_connections,omitempty"`
+	Quota          int64  `json:"quota,omitempty"`
+	QuotaExceeded  bool   `json:"quota_exceeded"`
+	Tier           string `json:"tier,omitempty"`
+}
+
+type user struct {
+	name     string
+	limits   atomic.Pointer[Limits]
+	limiter  atomic.Pointer[bucket]
+	active   atomic.Int64
+	upload   atomic.Int64
+	download atomic.Int64
+	rejected atomic.Int64
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]*user{}
+)
+
+// Configure replaces the set of limited users. Counters of users present
+// both before and after are kept; users no longer listed are dropped.
+func Configure(limits map[string]Limits) {
+	mu.Lock()
+	defer mu.Unlock()
+	next := make(map[string]*user, len(limits))
+	for name, l := range limits {
+		u := registry[name]
+		if u == nil {
+			u = &user{name: name}
+		}
+		l := l
+		u.limits.Store(&l)
+		if l.RateLimit > 0 {
+			if b := u.limiter.Load(); b != nil {
+				b.setRate(l.RateLimit)
+			} else {
+				u.limiter.Store(newBucket(l.RateLimit))
+			}
+		} else {
+			u.limiter.Store(nil)
+		}
+		next[name] = u
+	}
+	registry = next
+}
+
+func lookup(name string) *user {
+	if name == "" {
+		return nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return registry[name]
+}
+
+// Acquire admits a new connection for name. The returned release func must
+// be called exactly once when the connection ends. Unknown users (and the
+// empty name) are not limited.
+func Acquire(name string) (release func(), err error) {
+	u := lookup(name)
+	if u == nil {
+		return func() {}, nil
+	}
+	l := u.limits.Load()
+	if l.Quota > 0 && u.upload.Load()+u.download.Load() >= l.Quota {
+		u.rejected.Add(1)
+		return nil, ErrQuotaExceeded
+	}
+	if n := u.active.Add(1); l.MaxConnections > 0 && n > int64(l.MaxConnections) {
+		u.active.Add(-1)
+		u.rejected.Add(1)
+		return nil, ErrConnectionLimit
+	}
+	var once sync.Once
+	return func() { once.Do(func() { u.active.Add(-1) }) }, nil
+}
+
+// Groups returns the node groups name may use, or nil when it may use
+// every node.
+func Groups(name string) []string {
+	u := lookup(name)
+	if u == nil {
+		return nil
+	}
+	return u.limits.Load().Groups
+}
+
+// Snapshot returns the usage of every configured user, sorted by name.
+func Snapshot() []Usage {
+	mu.RLock()
+	list := make([]*user, 0, len(registry))
+	for _, u := range registry {
+		list = append(list, u)
+	}
+	mu.RUnlock()
+
+	out := make([]Usage, 0, len(list))
+	for _, u := range list {
+		l := u.limits.Load()
+		usage := Usage{
+			Username:       u.name,
+			Active:         u.active.Load(),
+			Upload:         u.upload.Load(),
+			Download:       u.download.Load(),
+			Rejected:       u.rejected.Load(),
+			RateLimit:      l.RateLimit,
+			MaxConnections: l.MaxConnections,
+			Quota:          l.Quota,
+			Tier:           l.Tier,
+		}
+		usage.QuotaExceeded = l.Quota > 0 && usage.Upload+usage.Download >= l.Quota
+		out = append(out, usage)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out
+}
+
+// ResetUsage clears the traffic counters of name, lifting an exhausted
+// quota. It reports whether the user exists.
+func ResetUsage(name string) bool {
+	u := lookup(name)
+	if u == nil {
+		return false
+	}
+	u.upload.Store(0)
+	u.download.Store(0)
+	u.rejected.Store(0)
+	return true
+}
+
+// RestoreUsage adds saved traffic counters to the user of the same name,
+// so accounting carries over a restart. It reports whether the user is
+// configured; counters of users no longer listed are dropped.
+func RestoreUsage(saved Usage) bool {
+	u := lookup(saved.Username)
+	if u == nil {
+		return false
+	}
+	u.upload.Add(saved.Upload)
+	u.download.Add(saved.Download)
+	u.rejected.Add(saved.Rejected)
+	return true
+}
+
+type ctxKey struct{}
+
+// WithUser tags ctx with the authenticated user for listeners that dial the
+// pool directly instead of going through a sing-box inbound.
+func WithUser(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, name)
+}
+
+// FromContext returns the user set by WithUser, or "".
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(ctxKey{}).(string)
+	return name
+}
@@ -0,0 +1,146 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcquireConnectionLimit(t *testing.T) {
+	Configure(map[string]Limits{"alice": {MaxConnections: 2}})
+	defer Configure(nil)
+
+	r1, err := Acquire("alice")
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	r2, err := Acquire("alice")
+	if err != nil {
+		t.Fatalf("second acquire: %v", err)
+	}
+	if _, err := Acquire("alice"); !errors.Is(err, ErrConnectionLimit) {
+		t.Fatalf("expected ErrConnectionLimit, got %v", err)
+	}
+	r1()
+	r1() // release is idempotent
+	if _, err := Acquire("alice"); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	r2()
+
+	if _, err := Acquire("bob"); err != nil {
+		t.Fatalf("unknown users must not be limited: %v", err)
+	}
+	if got := Snapshot()[0].Rejected; got != 1 {
+		t.Fatalf("expected 1 rejected connection, got %d", got)
+	}
+}
+
+func TestQuotaAndCounters(t *testing.T) {
+	Configure(map[string]Limits{"alice": {Quota: 10}})
+	defer Configure(nil)
+
+	client, server := net.Pipe()
+	defer server.Close()
+	release, err := Acquire("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := WrapConn(client, "alice", release)
+	go func() {
+		buf := make([]byte, 64)
+		server.Read(buf)
+		server.Write([]byte("pong!!"))
+	}()
+	if _, err := conn.Write([]byte("ping!!")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 64)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	usage := Snapshot()[0]
+	if usage.Upload != 6 || usage.Download != 6 || usage.Active != 1 || !usage.QuotaExceeded {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if _, err := conn.Write([]byte("x")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded on write, got %v", err)
+	}
+	if _, err := Acquire("alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded on acquire, got %v", err)
+	}
+	conn.Close()
+	if got := Snapshot()[0].Active; got != 0 {
+		t.Fatalf("expected no active connections after close, got %d", got)
+	}
+
+	// Reconfiguring keeps counters; resetting clears them.
+	Configure(map[string]Limits{"alice": {Quota: 10}})
+	if Snapshot()[0].Upload != 6 {
+		t.Fatal("counters should survive Configure")
+	}
+	if !ResetUsage("alice") {
+		t.Fatal("ResetUsage should find alice")
+	}
+	if _, err := Acquire("alice"); err != nil {
+		t.Fatalf("acquire after reset: %v", err)
+	}
+}
+
+func TestFailedWriteNotCharged(t *testing.T) {
+	Configure(map[string]Limits{"alice": {Quota: 100}})
+	defer Configure(nil)
+
+	client, server := net.Pipe()
+	server.Close()
+	conn := WrapConn(client, "alice", func() {})
+	defer conn.Close()
+	if _, err := conn.Write([]byte("lost")); err == nil {
+		t.Fatal("expected the write to a closed pipe to fail")
+	}
+	if got := Snapshot()[0].Upload; got != 0 {
+		t.Fatalf("failed write charged %d bytes", got)
+	}
+}
+
+func TestRestoreUsage(t *testing.T) {
+	Configure(map[string]Limits{"alice": {Quota: 100}})
+	defer Configure(nil)
+
+	if !RestoreUsage(Usage{Username: "alice", Upload: 60, Download: 40, Rejected: 2}) {
+		t.Fatal("expected alice to be restored")
+	}
+	if RestoreUsage(Usage{Username: "bob", Upload: 1}) {
+		t.Fatal("unconfigured users must not be restored")
+	}
+	got := Snapshot()[0]
+	if got.Upload != 60 || got.Download != 40 || got.Rejected != 2 || !got.QuotaExceeded {
+		t.Fatalf("unexpected usage after restore: %+v", got)
+	}
+	if _, err := Acquire("alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected the restored usage to count against the quota, got %v", err)
+	}
+}
+
+func TestBucketRateLimit(t *testing.T) {
+	b := newBucket(1000)
+	start := time.Now()
+	b.wait(1000) // burst
+	b.wait(200)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected the second wait to be throttled, took %s", elapsed)
+	}
+}
+
+func TestContextUser(t *testing.T) {
+	ctx := WithUser(context.Background(), "alice")
+	if got := FromContext(ctx); got != "alice" {
+		t.Fatalf("expected alice, got %q", got)
+	}
+	if got := FromContext(context.Background()); got != "" {
+		t.Fatalf("expected empty user, got %q", got)
+	}
+}